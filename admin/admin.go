@@ -0,0 +1,289 @@
+// Package admin 提供GoProxy客户端的运行时管理接口，供基于本包的常驻进程在运行中查看和修改状态:
+// 当前代理、代理池的健康统计、进行中的请求数、带宽限制，以及触发代理重新检测
+//
+// Admin 实现http.Handler，可挂载到仅监听本机的HTTP服务上:
+//
+//	http.ListenAndServe("127.0.0.1:9090", admin.New(client, admin.WithToken("secret")))
+//
+// 根路径为代理池状态页面，显示每个代理的延迟、成功率、状态和流量并定时刷新；
+// /api/下的接口均以JSON收发，出错时返回{"error": "..."}:
+//   - GET /api/status: 当前代理、进行中的请求数、连接统计、代理池统计和带宽限制
+//   - GET /api/pool, DELETE /api/pool: 查看、清空代理池统计
+//   - PUT /api/proxy: 切换当前代理，请求体为{"proxy": "..."}
+//   - GET /api/bandwidth, PUT /api/bandwidth: 查看、修改带宽限制，请求体为{"download_bps": 0, "upload_bps": 0}
+//   - POST /api/check: 重新检测代理，请求体为{"proxies": [...], "target": "..."}，均可省略
+//   - GET /api/checks: 每个代理最近一次的检测结果
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+
+	"github.com/fasnow/goproxy"
+)
+
+// maxRequestBody 管理接口请求体的大小上限
+const maxRequestBody = 1 << 20
+
+// Admin GoProxy客户端的管理接口，实现http.Handler，方法可直接在代码中调用
+type Admin struct {
+	client   *goproxy.GoProxy
+	token    string
+	checkURL string
+	proxies  []string
+	mux      *http.ServeMux
+
+	mu     sync.Mutex
+	checks map[string]goproxy.ProxyCheck
+}
+
+// Option Admin的配置项
+type Option func(*Admin)
+
+// WithToken 要求接口请求携带Authorization: Bearer <token>，未设置时不认证，此时只应在本机监听
+func WithToken(token string) Option {
+	return func(a *Admin) {
+		a.token = token
+	}
+}
+
+// WithCheckURL 设置检测代理时访问的地址，默认为goproxy.DefaultCheckURL
+func WithCheckURL(target string) Option {
+	return func(a *Admin) {
+		a.checkURL = target
+	}
+}
+
+// WithProxies 设置候选代理，未指定代理的重新检测会检测这些代理和当前代理
+func WithProxies(proxies ...string) Option {
+	return func(a *Admin) {
+		a.proxies = append(a.proxies, proxies...)
+	}
+}
+
+// New 创建管理client的Admin
+// 参数:
+//   - client: 被管理的客户端
+//   - opts: 配置项
+func New(client *goproxy.GoProxy, opts ...Option) *Admin {
+	a := &Admin{client: client, checks: make(map[string]goproxy.ProxyCheck)}
+	for _, opt := range opts {
+		opt(a)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", a.handleDashboard)
+	mux.HandleFunc("GET /api/status", a.handleStatus)
+	mux.HandleFunc("GET /api/pool", a.handlePool)
+	mux.HandleFunc("DELETE /api/pool", a.handleResetPool)
+	mux.HandleFunc("PUT /api/proxy", a.handleSetProxy)
+	mux.HandleFunc("GET /api/bandwidth", a.handleBandwidth)
+	mux.HandleFunc("PUT /api/bandwidth", a.handleSetBandwidth)
+	mux.HandleFunc("POST /api/check", a.handleCheck)
+	mux.HandleFunc("GET /api/checks", a.handleChecks)
+	a.mux = mux
+	return a
+}
+
+// Bandwidth 带宽限制(字节/秒)，0表示不限制
+type Bandwidth struct {
+	DownloadBps int64 `json:"download_bps"`
+	UploadBps   int64 `json:"upload_bps"`
+}
+
+// Status 客户端的运行时状态快照，可直接序列化为JSON
+type Status struct {
+	Proxy     string               `json:"proxy"`     // 当前代理(密码已脱敏)，直连时为空
+	InFlight  int64                `json:"in_flight"` // 进行中的请求数
+	Conns     goproxy.ConnStats    `json:"conns"`     // 连接统计
+	Pool      []goproxy.ProxyStats `json:"pool"`      // 每个代理的请求统计
+	Bandwidth Bandwidth            `json:"bandwidth"` // 带宽限制
+	Checks    []goproxy.ProxyCheck `json:"checks"`    // 每个代理最近一次的检测结果，按代理排序
+}
+
+// Status 返回客户端当前的状态
+func (a *Admin) Status() Status {
+	conns := a.client.ConnStats()
+	down, up := a.client.GetBandwidthLimit()
+	return Status{
+		Proxy:     redact(a.client.String()),
+		InFlight:  conns.InFlight,
+		Conns:     conns,
+		Pool:      a.client.PoolStats(),
+		Bandwidth: Bandwidth{DownloadBps: down, UploadBps: up},
+		Checks:    a.Checks(),
+	}
+}
+
+// SetProxy 切换客户端的当前代理，见GoProxy.SetProxy
+func (a *Admin) SetProxy(proxy string) error {
+	return a.client.SetProxy(proxy)
+}
+
+// SetBandwidth 修改客户端的带宽限制，见GoProxy.SetBandwidthLimit
+func (a *Admin) SetBandwidth(b Bandwidth) {
+	a.client.SetBandwidthLimit(b.DownloadBps, b.UploadBps)
+}
+
+// Recheck 并发检测代理并保存结果，返回的结果与proxies顺序相同
+// 参数:
+//   - ctx: 控制检测的取消和超时
+//   - target: 检测访问的地址，为空时使用WithCheckURL设置的地址
+//   - proxies: 要检测的代理，为空时检测WithProxies设置的候选代理和当前代理
+func (a *Admin) Recheck(ctx context.Context, target string, proxies ...string) []goproxy.ProxyCheck {
+	if len(proxies) == 0 {
+		proxies = a.candidates()
+	}
+	if target == "" {
+		target = a.checkURL
+	}
+	results := make([]goproxy.ProxyCheck, len(proxies))
+	var wg sync.WaitGroup
+	for i, proxy := range proxies {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = a.client.CheckProxy(ctx, proxy, target)
+		}()
+	}
+	wg.Wait()
+	a.mu.Lock()
+	for _, res := range results {
+		a.checks[res.Proxy] = res
+	}
+	a.mu.Unlock()
+	return results
+}
+
+// Checks 返回每个代理最近一次的检测结果，按代理排序
+func (a *Admin) Checks() []goproxy.ProxyCheck {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	checks := make([]goproxy.ProxyCheck, 0, len(a.checks))
+	for _, c := range a.checks {
+		checks = append(checks, c)
+	}
+	sort.Slice(checks, func(i, j int) bool { return checks[i].Proxy < checks[j].Proxy })
+	return checks
+}
+
+// candidates 返回候选代理和当前代理，去除重复
+func (a *Admin) candidates() []string {
+	seen := make(map[string]bool)
+	var proxies []string
+	for _, p := range append(append([]string(nil), a.proxies...), a.client.String()) {
+		if !seen[p] {
+			seen[p] = true
+			proxies = append(proxies, p)
+		}
+	}
+	return proxies
+}
+
+func (a *Admin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// 状态页面不含数据，由页面请求接口时认证
+	if a.token != "" && r.URL.Path != "/" {
+		want := "Bearer " + a.token
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(want)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="goproxy"`)
+			writeError(w, http.StatusUnauthorized, errors.New("未授权"))
+			return
+		}
+	}
+	a.mux.ServeHTTP(w, r)
+}
+
+func (a *Admin) handleStatus(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.Status())
+}
+
+func (a *Admin) handlePool(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.client.PoolStats())
+}
+
+func (a *Admin) handleResetPool(w http.ResponseWriter, r *http.Request) {
+	a.client.ResetPoolStats()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *Admin) handleSetProxy(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Proxy string `json:"proxy"`
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+	if err := a.SetProxy(body.Proxy); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, a.Status())
+}
+
+func (a *Admin) handleBandwidth(w http.ResponseWriter, r *http.Request) {
+	down, up := a.client.GetBandwidthLimit()
+	writeJSON(w, http.StatusOK, Bandwidth{DownloadBps: down, UploadBps: up})
+}
+
+func (a *Admin) handleSetBandwidth(w http.ResponseWriter, r *http.Request) {
+	var b Bandwidth
+	if !readJSON(w, r, &b) {
+		return
+	}
+	if b.DownloadBps < 0 || b.UploadBps < 0 {
+		writeError(w, http.StatusBadRequest, errors.New("带宽限制不能为负数"))
+		return
+	}
+	a.SetBandwidth(b)
+	a.handleBandwidth(w, r)
+}
+
+func (a *Admin) handleCheck(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Proxies []string `json:"proxies"`
+		Target  string   `json:"target"`
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+	writeJSON(w, http.StatusOK, a.Recheck(r.Context(), body.Target, body.Proxies...))
+}
+
+func (a *Admin) handleChecks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.Checks())
+}
+
+// readJSON 解析请求体到v，请求体为空时保持v不变，解析失败时写入400并返回false
+func readJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	err := json.NewDecoder(io.LimitReader(r.Body, maxRequestBody)).Decode(v)
+	if err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, errors.New("请求体不是有效的JSON: "+err.Error()))
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
+
+// redact 隐藏代理地址中的密码
+func redact(proxy string) string {
+	u, err := url.Parse(proxy)
+	if err != nil || u.User == nil {
+		return proxy
+	}
+	return u.Redacted()
+}
@@ -0,0 +1,118 @@
+package admin
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fasnow/goproxy"
+)
+
+// call 调用管理接口并将响应解析到v
+func call(t *testing.T, h http.Handler, method, path, body string, v any) int {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if v != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+			t.Fatalf("%s %s: 响应%q不是JSON: %v", method, path, rec.Body.String(), err)
+		}
+	}
+	return rec.Code
+}
+
+func TestAdmin(t *testing.T) {
+	// 作为HTTP代理时对所有请求返回204
+	proxySrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer proxySrv.Close()
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	closedProxy := "http://user:secret@" + ln.Addr().String()
+	ln.Close()
+
+	c := goproxy.New()
+	a := New(c, WithToken("secret"), WithCheckURL("http://goproxy-check.test/"), WithProxies(proxySrv.URL, closedProxy))
+
+	rec := httptest.NewRecorder()
+	a.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/status", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("未认证时状态码为%d", rec.Code)
+	}
+
+	var status Status
+	if code := call(t, a, http.MethodPut, "/api/proxy", `{"proxy": "`+closedProxy+`"}`, &status); code != http.StatusOK {
+		t.Fatalf("切换代理的状态码为%d", code)
+	}
+	if c.String() != closedProxy || status.Proxy != "http://user:xxxxx@"+ln.Addr().String() {
+		t.Errorf("切换后的代理为%q，状态中为%q", c.String(), status.Proxy)
+	}
+	var errBody map[string]string
+	if code := call(t, a, http.MethodPut, "/api/proxy", `{"proxy": "ftp://x"}`, &errBody); code != http.StatusBadRequest || errBody["error"] == "" {
+		t.Errorf("无效代理的状态码为%d，响应为%v", code, errBody)
+	}
+
+	var bw Bandwidth
+	if code := call(t, a, http.MethodPut, "/api/bandwidth", `{"download_bps": 1000, "upload_bps": 500}`, &bw); code != http.StatusOK || bw != (Bandwidth{1000, 500}) {
+		t.Errorf("修改带宽限制的状态码为%d，响应为%+v", code, bw)
+	}
+	if down, up := c.GetBandwidthLimit(); down != 1000 || up != 500 {
+		t.Errorf("带宽限制为%d/%d", down, up)
+	}
+	if code := call(t, a, http.MethodPut, "/api/bandwidth", `{"download_bps": -1}`, nil); code != http.StatusBadRequest {
+		t.Errorf("负数带宽限制的状态码为%d", code)
+	}
+	call(t, a, http.MethodPut, "/api/bandwidth", `{}`, nil)
+
+	// 未指定代理时检测候选代理和当前代理
+	var checks []goproxy.ProxyCheck
+	if code := call(t, a, http.MethodPost, "/api/check", ``, &checks); code != http.StatusOK || len(checks) != 2 {
+		t.Fatalf("检测的状态码为%d，结果为%+v", code, checks)
+	}
+	if !checks[0].OK || checks[0].Status != http.StatusNoContent || checks[1].OK || checks[1].Error == "" {
+		t.Errorf("检测结果为%+v", checks)
+	}
+	call(t, a, http.MethodGet, "/api/checks", "", &checks)
+	if len(checks) != 2 {
+		t.Errorf("保存的检测结果为%+v", checks)
+	}
+
+	var pool []goproxy.ProxyStats
+	call(t, a, http.MethodGet, "/api/pool", "", &pool)
+	if len(pool) != 2 {
+		t.Errorf("代理池统计为%+v", pool)
+	}
+	if code := call(t, a, http.MethodDelete, "/api/pool", "", nil); code != http.StatusNoContent || len(c.PoolStats()) != 0 {
+		t.Errorf("清空统计的状态码为%d，统计为%+v", code, c.PoolStats())
+	}
+}
+
+func TestAdmin_InFlight(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.(http.Flusher).Flush()
+		<-release
+	}))
+	defer srv.Close()
+	c := goproxy.New()
+	a := New(c)
+	resp, err := c.GetClient().Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := a.Status(); s.InFlight != 1 {
+		t.Errorf("请求进行中时InFlight为%d", s.InFlight)
+	}
+	close(release)
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if s := a.Status(); s.InFlight != 0 {
+		t.Errorf("请求结束后InFlight为%d", s.InFlight)
+	}
+}
@@ -0,0 +1,20 @@
+package admin
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// dashboardHTML 代理池状态页面，定时请求/api/status刷新
+//
+//go:embed dashboard.html
+var dashboardHTML []byte
+
+// handleDashboard 返回状态页面。页面本身不含数据，不需要认证；设置了WithToken时，
+// 在地址的片段中传入令牌(如http://127.0.0.1:9090/#token=secret)，页面请求接口时以Authorization头发送
+func (a *Admin) handleDashboard(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Security-Policy", "default-src 'self'; script-src 'unsafe-inline'; style-src 'unsafe-inline'")
+	w.Write(dashboardHTML)
+}
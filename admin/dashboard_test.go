@@ -0,0 +1,28 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fasnow/goproxy"
+)
+
+func TestAdmin_Dashboard(t *testing.T) {
+	a := New(goproxy.New(), WithToken("secret"))
+	rec := httptest.NewRecorder()
+	a.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("状态码为%d，Content-Type为%q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(rec.Body.String(), "/api/status") {
+		t.Error("页面没有请求状态接口")
+	}
+	// 只有根路径不需要认证
+	rec = httptest.NewRecorder()
+	a.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/index.html", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("其他路径的状态码为%d", rec.Code)
+	}
+}
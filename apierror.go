@@ -0,0 +1,71 @@
+package goproxy
+
+import (
+	"encoding/json"
+	"maps"
+	"mime"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// errorBodyLimit 按RegisterErrorType解码时读取的响应体的大小上限，超过时不解码
+const errorBodyLimit = 1 << 20
+
+// RegisterErrorType 注册主机返回的错误响应的类型: 通过Do和Call发往该主机的请求返回4xx或5xx且响应体为JSON时，
+// 关闭响应体并返回*StatusError，其中的Err为按prototype的类型解码响应体得到的新值，可通过errors.As取出。
+// 设置了期望的状态码且状态码符合期望时不视为错误，见SetExpectedStatus
+//
+//	c.RegisterErrorType("api.example.com", &APIError{})
+//	_, err := c.Do(req)
+//	var apiErr *APIError
+//	if errors.As(err, &apiErr) { ... }
+//
+// 参数:
+//   - pattern: 主机名，支持"*.example.com"形式的通配符(不匹配example.com本身)
+//   - prototype: 错误类型的值，如&APIError{}，只使用其类型；为nil时删除该主机的注册
+func (r *GoProxy) RegisterErrorType(pattern string, prototype error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	pattern = normalizeHost(pattern)
+	types := maps.Clone(r.errorTypes)
+	if prototype == nil {
+		delete(types, pattern)
+	} else {
+		if types == nil {
+			types = make(map[string]reflect.Type)
+		}
+		types[pattern] = reflect.TypeOf(prototype)
+	}
+	r.errorTypes = types
+}
+
+// decodeErrorBody 将响应体解码为typ类型的错误，响应体过大(为nil)或解码失败时返回nil
+func decodeErrorBody(typ reflect.Type, body []byte) error {
+	if body == nil {
+		return nil
+	}
+	ptr := typ.Kind() == reflect.Pointer
+	if ptr {
+		typ = typ.Elem()
+	}
+	v := reflect.New(typ)
+	if err := json.Unmarshal(body, v.Interface()); err != nil {
+		return nil
+	}
+	if !ptr {
+		v = v.Elem()
+	}
+	err, _ := v.Interface().(error)
+	return err
+}
+
+// isJSONResponse 判断响应体是否为JSON: Content-Type为application/json或以+json结尾，未声明时按响应体判断
+func isJSONResponse(resp *http.Response) bool {
+	ct := resp.Header.Get("Content-Type")
+	if ct == "" {
+		return true
+	}
+	mt, _, err := mime.ParseMediaType(ct)
+	return err == nil && (mt == "application/json" || strings.HasSuffix(mt, "+json"))
+}
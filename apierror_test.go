@@ -0,0 +1,96 @@
+package goproxy
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type testAPIError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *testAPIError) Error() string { return e.Code + ": " + e.Message }
+
+type testValueError struct {
+	Reason string `json:"reason"`
+}
+
+func (e testValueError) Error() string { return e.Reason }
+
+func TestGoProxy_RegisterErrorType(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok":
+			io.WriteString(w, "{}")
+		case "/html":
+			w.Header().Set("Content-Type", "text/html")
+			w.WriteHeader(http.StatusBadGateway)
+			io.WriteString(w, "<h1>bad gateway</h1>")
+		case "/value":
+			w.Header().Set("Content-Type", "application/problem+json")
+			w.WriteHeader(http.StatusConflict)
+			io.WriteString(w, `{"reason":"conflict"}`)
+		default:
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"code":"not_found","message":"no such user"}`)
+		}
+	}))
+	defer srv.Close()
+	do := func(c *GoProxy, path string, opts ...RequestOption) error {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+		resp, err := c.Do(req, opts...)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	c := New()
+	if err := do(c, "/user"); err != nil {
+		t.Fatalf("没有注册时错误为%v", err)
+	}
+	c.RegisterErrorType("127.0.0.1", &testAPIError{})
+	err := do(c, "/user")
+	var apiErr *testAPIError
+	var se *StatusError
+	if !errors.As(err, &apiErr) || apiErr.Code != "not_found" || !errors.As(err, &se) || se.StatusCode != http.StatusNotFound {
+		t.Fatalf("错误为%v", err)
+	}
+	if !strings.Contains(err.Error(), "not_found: no such user") {
+		t.Errorf("错误信息为%q", err.Error())
+	}
+	if err := do(c, "/ok"); err != nil {
+		t.Errorf("成功的响应返回错误: %v", err)
+	}
+	if err := do(c, "/html"); err != nil {
+		t.Errorf("非JSON的错误响应返回错误: %v", err)
+	}
+	// 期望的状态码优先
+	if err := do(c, "/user", WithExpectedStatus(http.StatusNotFound)); err != nil {
+		t.Errorf("符合期望的状态码返回错误: %v", err)
+	}
+	c.SetExpectedStatus(http.StatusOK)
+	if err := do(c, "/html"); !errors.As(err, &se) || se.Err != nil {
+		t.Errorf("非JSON的响应不符合期望时错误为%v", err)
+	}
+	c.SetExpectedStatus()
+
+	c.RegisterErrorType("127.0.0.1", testValueError{})
+	var valErr testValueError
+	if err := do(c, "/value"); !errors.As(err, &valErr) || valErr.Reason != "conflict" {
+		t.Errorf("值类型的错误为%v", err)
+	}
+	c.RegisterErrorType("*.example.com", &testAPIError{})
+	c.RegisterErrorType("127.0.0.1", nil)
+	if err := do(c, "/user"); err != nil {
+		t.Errorf("删除注册后错误为%v", err)
+	}
+}
@@ -0,0 +1,64 @@
+package goproxy
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strings"
+)
+
+// basicAuthValue 返回Basic认证的Authorization请求头的值
+func basicAuthValue(user, pass string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+pass))
+}
+
+// SetBasicAuth 为所有请求设置Basic认证，请求本身带有Authorization时不覆盖
+// 跟随重定向时只有与最初请求同源(协议、主机和端口都相同)的请求携带认证信息，避免凭据泄露给其他站点
+// 参数:
+//   - user: 用户名，与pass都为空时取消认证
+//   - pass: 密码
+func (r *GoProxy) SetBasicAuth(user, pass string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ct := r.transport
+	if user == "" && pass == "" {
+		ct.authorization.Store(nil)
+		return
+	}
+	value := basicAuthValue(user, pass)
+	ct.authorization.Store(&value)
+}
+
+// WithBasicAuth 为单次请求设置Basic认证，优先于SetBasicAuth的设置，重定向时的处理与SetBasicAuth相同
+func WithBasicAuth(user, pass string) RequestOption {
+	return func(o *requestOptions) {
+		o.authorization = basicAuthValue(user, pass)
+	}
+}
+
+// applyAuthorization 为没有Authorization的请求添加单次请求或全局设置的认证信息
+func (c *CustomTransport) applyAuthorization(req *http.Request, opts *requestOptions) {
+	if req.Header.Get("Authorization") != "" {
+		return
+	}
+	var value string
+	if opts != nil && opts.authorization != "" {
+		value = opts.authorization
+	} else if p := c.authorization.Load(); p != nil {
+		value = *p
+	}
+	if value != "" && sameOriginAsInitial(req) {
+		req.Header.Set("Authorization", value)
+	}
+}
+
+// sameOriginAsInitial 判断重定向产生的请求是否与重定向链中最初的请求同源，不是重定向时返回true
+func sameOriginAsInitial(req *http.Request) bool {
+	initial := req
+	for initial.Response != nil && initial.Response.Request != nil {
+		initial = initial.Response.Request
+	}
+	if initial == req {
+		return true
+	}
+	return strings.EqualFold(req.URL.Scheme, initial.URL.Scheme) && strings.EqualFold(canonicalAddr(req.URL), canonicalAddr(initial.URL))
+}
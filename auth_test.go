@@ -0,0 +1,68 @@
+package goproxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGoProxy_SetBasicAuth(t *testing.T) {
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Header.Get("Authorization"))
+	}))
+	defer other.Close()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/same":
+			http.Redirect(w, r, "/echo", http.StatusFound)
+		case "/cross":
+			http.Redirect(w, r, other.URL+"/echo", http.StatusFound)
+		default:
+			io.WriteString(w, r.Header.Get("Authorization"))
+		}
+	}))
+	defer srv.Close()
+
+	c := New()
+	c.SetCheckRedirect(nil)
+	c.SetBasicAuth("user", "pass")
+	want := "Basic dXNlcjpwYXNz"
+	if got := getBody(t, c, srv.URL+"/echo"); got != want {
+		t.Errorf("Authorization为%q", got)
+	}
+	if got := getBody(t, c, srv.URL+"/same"); got != want {
+		t.Errorf("同源重定向后Authorization为%q", got)
+	}
+	if got := getBody(t, c, srv.URL+"/cross"); got != "" {
+		t.Errorf("跨域重定向后Authorization为%q", got)
+	}
+
+	// 单次请求的设置优先，请求本身的Authorization优先级最高
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/same", nil)
+	resp, err := c.Do(req, WithBasicAuth("a", "b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "Basic YTpi" {
+		t.Errorf("单次请求的Authorization为%q", body)
+	}
+	req, _ = http.NewRequest(http.MethodGet, srv.URL+"/echo", nil)
+	req.Header.Set("Authorization", "Bearer x")
+	resp, err = c.Do(req, WithBasicAuth("a", "b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "Bearer x" {
+		t.Errorf("请求本身的Authorization被覆盖为%q", body)
+	}
+
+	c.SetBasicAuth("", "")
+	if got := getBody(t, c, srv.URL+"/echo"); got != "" {
+		t.Errorf("取消后Authorization为%q", got)
+	}
+}
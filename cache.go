@@ -0,0 +1,642 @@
+package goproxy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CacheStorage HTTP缓存的存储后端，保存序列化后的响应，需要支持并发调用
+type CacheStorage interface {
+	// Get 返回key对应的数据，不存在时ok为false
+	Get(key string) (data []byte, ok bool)
+	// Set 保存key对应的数据，覆盖已有的数据
+	Set(key string, data []byte)
+	// Delete 删除key对应的数据，不存在时忽略
+	Delete(key string)
+}
+
+// memoryCache 不限大小的内存存储
+type memoryCache struct {
+	mu    sync.RWMutex
+	items map[string][]byte
+}
+
+// NewMemoryCache 创建不限大小的内存缓存存储，适用于测试和缓存内容有限的场景，需要限制大小时使用NewLRUCache
+func NewMemoryCache() CacheStorage {
+	return &memoryCache{items: make(map[string][]byte)}
+}
+
+func (m *memoryCache) Get(key string) ([]byte, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	data, ok := m.items[key]
+	return data, ok
+}
+
+func (m *memoryCache) Set(key string, data []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.items[key] = data
+}
+
+func (m *memoryCache) Delete(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.items, key)
+}
+
+// CacheStats HTTP缓存的统计快照，可直接序列化为JSON供监控系统采集
+type CacheStats struct {
+	Hits        int64   `json:"hits"`        // 由未过期的缓存直接返回的请求数
+	Revalidated int64   `json:"revalidated"` // 缓存过期、服务器返回304后由缓存返回的请求数
+	Stale       int64   `json:"stale"`       // 按stale-while-revalidate或stale-if-error返回过期缓存的请求数
+	Misses      int64   `json:"misses"`      // 可使用缓存但由服务器返回完整响应的请求数
+	Stores      int64   `json:"stores"`      // 写入缓存的响应数
+	HitRatio    float64 `json:"hit_ratio"`   // (Hits+Revalidated+Stale)/(Hits+Revalidated+Stale+Misses)
+}
+
+// 缓存的响应中保存元数据的响应头，返回给调用方之前删除
+const (
+	cacheRequestTimeHeader  = "X-Goproxy-Cache-Request-Time"  // 发出请求的时间
+	cacheResponseTimeHeader = "X-Goproxy-Cache-Response-Time" // 收到响应的时间
+	cacheVaryPrefix         = "X-Goproxy-Cache-Vary-"         // Vary中各请求头在请求中的值
+)
+
+// heuristicStatus 默认可以缓存的状态码，没有明确的过期时间时按Last-Modified推算，见RFC 7231第6.1节
+var heuristicStatus = map[int]bool{
+	200: true, 203: true, 204: true, 300: true, 301: true, 308: true,
+	404: true, 405: true, 410: true, 414: true, 501: true,
+}
+
+// CacheTransport 遵循RFC 7234的HTTP缓存中间件，作为客户端的私有缓存:
+//   - 只缓存GET请求，按Cache-Control、Expires、Age和Date计算新鲜度，没有明确的过期时间时按Last-Modified推算
+//   - 支持请求的no-cache、no-store、max-age、max-stale、min-fresh和only-if-cached，以及响应的no-store、no-cache和must-revalidate
+//   - 过期的缓存带有ETag或Last-Modified时发送条件请求，服务器返回304后更新缓存并返回缓存的响应
+//   - 支持RFC 5861的stale-while-revalidate(先返回过期的缓存，同时在后台验证)和stale-if-error(服务器出错时返回过期的缓存)
+//   - 按Vary中的请求头区分缓存，同一地址只保存最近一次的响应；Vary为*的响应不缓存
+//   - POST、PUT、DELETE等请求成功后删除该地址的缓存
+//
+// 带有Authorization的请求只在响应明确允许(public、must-revalidate或s-maxage)时缓存，避免不同用户共享缓存。
+// 可通过GoProxy.SetTransport安装在底层Transport之上，如c.SetTransport(NewCacheTransport(NewMemoryCache(), c.GetTransport()))
+type CacheTransport struct {
+	store      CacheStorage
+	next       http.RoundTripper
+	revalidate bool        // 是否每次都向服务器验证，见NewConditionalTransport
+	offline    atomic.Bool // 是否只从缓存返回响应
+
+	hits, revalidated, stale, misses, stores atomic.Int64
+
+	mu      sync.Mutex
+	pending map[string]bool // 正在后台验证的地址
+}
+
+// NewCacheTransport 创建HTTP缓存中间件
+// 参数:
+//   - store: 缓存存储
+//   - next: 实际发送请求的RoundTripper，为nil时使用http.DefaultTransport
+func NewCacheTransport(store CacheStorage, next http.RoundTripper) *CacheTransport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &CacheTransport{store: store, next: next}
+}
+
+// Unwrap 返回实际发送请求的RoundTripper，GoProxy.SetTransport通过它在其中的*http.Transport上安装代理等设置
+func (t *CacheTransport) Unwrap() http.RoundTripper {
+	return t.next
+}
+
+// Stats 返回缓存的统计快照
+func (t *CacheTransport) Stats() CacheStats {
+	s := CacheStats{
+		Hits:        t.hits.Load(),
+		Revalidated: t.revalidated.Load(),
+		Stale:       t.stale.Load(),
+		Misses:      t.misses.Load(),
+		Stores:      t.stores.Load(),
+	}
+	if total := s.Hits + s.Revalidated + s.Stale + s.Misses; total > 0 {
+		s.HitRatio = float64(s.Hits+s.Revalidated+s.Stale) / float64(total)
+	}
+	return s
+}
+
+// RoundTrip 实现http.RoundTripper接口
+func (t *CacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	key := cacheKey(req)
+	if req.Method != http.MethodGet {
+		if t.offline.Load() {
+			return gatewayTimeout(req), nil
+		}
+		resp, err := t.next.RoundTrip(req)
+		if err == nil && !isSafeMethod(req.Method) && resp.StatusCode < 400 {
+			t.store.Delete(key)
+		}
+		return resp, err
+	}
+	reqCC := parseCacheControl(req.Header)
+	if _, ok := reqCC["no-store"]; (ok || req.Header.Get("Range") != "") && !t.offline.Load() {
+		return t.next.RoundTrip(req)
+	}
+
+	cached := t.load(key, req)
+	now := time.Now()
+	if cached != nil && (t.offline.Load() || !t.revalidate && cached.fresh(reqCC, now)) {
+		t.hits.Add(1)
+		return cached.response(req), nil
+	}
+	if _, ok := reqCC["only-if-cached"]; ok || t.offline.Load() {
+		t.misses.Add(1)
+		return gatewayTimeout(req), nil
+	}
+	if cached != nil && !t.revalidate && cached.staleWhileRevalidate(reqCC, now) {
+		t.stale.Add(1)
+		t.revalidateAsync(key, req, cached)
+		return cached.response(req), nil
+	}
+
+	resp, revalidated, err := t.fetch(key, req, cached)
+	switch {
+	case cached != nil && !t.revalidate && (err != nil || isServerError(resp.StatusCode)) && cached.staleIfError(reqCC, now):
+		if err == nil {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+			resp.Body.Close()
+		}
+		t.stale.Add(1)
+		return cached.response(req), nil
+	case err != nil:
+		return nil, err
+	case revalidated:
+		t.revalidated.Add(1)
+	default:
+		t.misses.Add(1)
+	}
+	return resp, nil
+}
+
+// fetch 向服务器请求，有带验证器的缓存时发送条件请求，服务器返回304时更新缓存并返回缓存的响应(revalidated为true)，
+// 否则返回服务器的响应，可以缓存时在响应体读取完毕后写入缓存
+func (t *CacheTransport) fetch(key string, req *http.Request, cached *cachedResponse) (resp *http.Response, revalidated bool, err error) {
+	send := req
+	conditional := false
+	if cached != nil && req.Header.Get("If-None-Match") == "" && req.Header.Get("If-Modified-Since") == "" {
+		etag, lastModified := cached.header.Get("ETag"), cached.header.Get("Last-Modified")
+		if etag != "" || lastModified != "" {
+			send = cloneRequestHeader(req)
+			if etag != "" {
+				send.Header.Set("If-None-Match", etag)
+			}
+			if lastModified != "" {
+				send.Header.Set("If-Modified-Since", lastModified)
+			}
+			conditional = true
+		}
+	}
+
+	reqTime := time.Now()
+	resp, err = t.next.RoundTrip(send)
+	if err != nil {
+		return nil, false, err
+	}
+	respTime := time.Now()
+	if conditional && resp.StatusCode == http.StatusNotModified {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		cached.update(resp.Header, reqTime, respTime)
+		t.save(key, req, cached)
+		return cached.response(req), true, nil
+	}
+
+	if !t.storable(req, resp) {
+		if !isServerError(resp.StatusCode) {
+			t.store.Delete(key)
+		}
+		return resp, false, nil
+	}
+	entry := &cachedResponse{
+		status:   resp.Status,
+		code:     resp.StatusCode,
+		header:   resp.Header.Clone(),
+		reqTime:  reqTime,
+		respTime: respTime,
+	}
+	if resp.Body == http.NoBody || resp.ContentLength == 0 {
+		t.save(key, req, entry)
+		return resp, false, nil
+	}
+	// 响应体读取完毕后写入缓存，未读完就关闭时不缓存
+	resp.Body = &cacheBodyReader{rc: resp.Body, done: func(body []byte) {
+		entry.body = body
+		t.save(key, req, entry)
+	}}
+	return resp, false, nil
+}
+
+// revalidateAsync 在后台验证过期的缓存，同一地址同一时间只有一个后台请求
+func (t *CacheTransport) revalidateAsync(key string, req *http.Request, cached *cachedResponse) {
+	t.mu.Lock()
+	if t.pending == nil {
+		t.pending = make(map[string]bool)
+	}
+	if t.pending[key] {
+		t.mu.Unlock()
+		return
+	}
+	t.pending[key] = true
+	t.mu.Unlock()
+
+	// 调用方返回后请求的context可能被取消，后台请求使用独立的超时
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(req.Context()), DefaultTimeout)
+	req = req.Clone(ctx)
+	go func() {
+		defer func() {
+			cancel()
+			t.mu.Lock()
+			delete(t.pending, key)
+			t.mu.Unlock()
+		}()
+		resp, _, err := t.fetch(key, req, cached)
+		if err != nil {
+			return
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+}
+
+// SetOffline 设置是否离线，离线时只从缓存返回响应，不论是否过期；没有缓存时返回504，不是GET的请求同样返回504，
+// 适用于无法访问代理时的开发调试
+func (t *CacheTransport) SetOffline(offline bool) {
+	t.offline.Store(offline)
+}
+
+// gatewayTimeout 返回没有可用缓存时的504响应
+func gatewayTimeout(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:     "504 Gateway Timeout",
+		StatusCode: http.StatusGatewayTimeout,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+		Body:       http.NoBody,
+		Request:    req,
+	}
+}
+
+// isServerError 判断状态码是否为stale-if-error适用的服务器错误
+func isServerError(code int) bool {
+	switch code {
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// save 将响应写入缓存
+func (t *CacheTransport) save(key string, req *http.Request, entry *cachedResponse) {
+	data, err := entry.marshal(req)
+	if err != nil {
+		return
+	}
+	t.store.Set(key, data)
+	t.stores.Add(1)
+}
+
+// load 读取与req匹配的缓存，没有或Vary不匹配时返回nil
+func (t *CacheTransport) load(key string, req *http.Request) *cachedResponse {
+	data, ok := t.store.Get(key)
+	if !ok {
+		return nil
+	}
+	entry, err := unmarshalCachedResponse(data, req)
+	if err != nil || !entry.matches(req) {
+		return nil
+	}
+	return entry
+}
+
+// cacheKey 缓存的键，为去掉片段的请求地址
+func cacheKey(req *http.Request) string {
+	u := *req.URL
+	u.Fragment, u.RawFragment = "", ""
+	return u.String()
+}
+
+// isSafeMethod 判断请求方法是否为安全方法，安全方法的请求不会使缓存失效
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// storable 判断响应是否可以缓存，见RFC 7234第3节
+func (t *CacheTransport) storable(req *http.Request, resp *http.Response) bool {
+	cc := parseCacheControl(resp.Header)
+	if _, ok := cc["no-store"]; ok {
+		return false
+	}
+	if t.revalidate {
+		// 每次都会验证，只需要响应带有验证器
+		return resp.StatusCode == http.StatusOK && (resp.Header.Get("ETag") != "" || resp.Header.Get("Last-Modified") != "") &&
+			!slices.Contains(varyHeaders(resp.Header), "*")
+	}
+	if resp.StatusCode == http.StatusPartialContent || resp.StatusCode < 200 || resp.StatusCode == http.StatusNotModified {
+		return false
+	}
+	for _, v := range resp.Header.Values("Vary") {
+		if strings.TrimSpace(v) == "*" {
+			return false
+		}
+	}
+	if req.Header.Get("Authorization") != "" {
+		_, public := cc["public"]
+		_, mustRevalidate := cc["must-revalidate"]
+		_, sMaxAge := cc["s-maxage"]
+		if !public && !mustRevalidate && !sMaxAge {
+			return false
+		}
+	}
+	// 其他状态码需要明确的过期时间
+	_, maxAge := cc["max-age"]
+	_, public := cc["public"]
+	return heuristicStatus[resp.StatusCode] || maxAge || public || resp.Header.Get("Expires") != ""
+}
+
+// parseCacheControl 解析Cache-Control，返回小写的指令名到去掉引号的值
+func parseCacheControl(h http.Header) map[string]string {
+	cc := make(map[string]string)
+	for _, v := range h.Values("Cache-Control") {
+		for _, part := range strings.Split(v, ",") {
+			name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+			if name == "" {
+				continue
+			}
+			cc[strings.ToLower(name)] = strings.Trim(value, `"`)
+		}
+	}
+	return cc
+}
+
+// parseSeconds 解析以秒为单位的非负整数，无效时ok为false
+func parseSeconds(s string) (time.Duration, bool) {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return time.Duration(n) * time.Second, true
+}
+
+// cachedResponse 缓存中的响应及其元数据
+type cachedResponse struct {
+	status   string
+	code     int
+	header   http.Header
+	body     []byte
+	reqTime  time.Time           // 发出请求的时间
+	respTime time.Time           // 收到响应的时间
+	vary     map[string][]string // Vary中各请求头在请求中的值
+}
+
+// marshal 将响应序列化为HTTP/1.1响应报文，元数据保存在额外的响应头中
+func (c *cachedResponse) marshal(req *http.Request) ([]byte, error) {
+	h := c.header.Clone()
+	h.Set(cacheRequestTimeHeader, c.reqTime.Format(time.RFC3339Nano))
+	h.Set(cacheResponseTimeHeader, c.respTime.Format(time.RFC3339Nano))
+	for _, name := range varyHeaders(c.header) {
+		h[cacheVaryPrefix+name] = req.Header.Values(name)
+	}
+	h.Del("Transfer-Encoding")
+	resp := &http.Response{
+		Status:        c.status,
+		StatusCode:    c.code,
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        h,
+		Body:          io.NopCloser(bytes.NewReader(c.body)),
+		ContentLength: int64(len(c.body)),
+	}
+	var buf bytes.Buffer
+	if err := resp.Write(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// unmarshalCachedResponse 解析marshal序列化的响应
+func unmarshalCachedResponse(data []byte, req *http.Request) (*cachedResponse, error) {
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(data)), req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	c := &cachedResponse{status: resp.Status, code: resp.StatusCode, header: resp.Header, body: body, vary: make(map[string][]string)}
+	c.reqTime, _ = time.Parse(time.RFC3339Nano, resp.Header.Get(cacheRequestTimeHeader))
+	c.respTime, _ = time.Parse(time.RFC3339Nano, resp.Header.Get(cacheResponseTimeHeader))
+	resp.Header.Del(cacheRequestTimeHeader)
+	resp.Header.Del(cacheResponseTimeHeader)
+	for name, values := range resp.Header {
+		if vary, ok := strings.CutPrefix(name, cacheVaryPrefix); ok {
+			c.vary[vary] = values
+			delete(resp.Header, name)
+		}
+	}
+	return c, nil
+}
+
+// varyHeaders 返回Vary中规范化的请求头名称
+func varyHeaders(h http.Header) []string {
+	var names []string
+	for _, v := range h.Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	return names
+}
+
+// matches 判断req中Vary列出的请求头是否与缓存时的请求相同
+func (c *cachedResponse) matches(req *http.Request) bool {
+	for _, name := range varyHeaders(c.header) {
+		if strings.Join(req.Header.Values(name), ", ") != strings.Join(c.vary[name], ", ") {
+			return false
+		}
+	}
+	return true
+}
+
+// age 返回缓存的响应在now时的年龄，见RFC 7234第4.2.3节
+func (c *cachedResponse) age(now time.Time) time.Duration {
+	date, err := http.ParseTime(c.header.Get("Date"))
+	if err != nil {
+		date = c.respTime
+	}
+	apparentAge := max(c.respTime.Sub(date), 0)
+	ageValue, _ := parseSeconds(c.header.Get("Age"))
+	correctedAge := ageValue + c.respTime.Sub(c.reqTime)
+	return max(apparentAge, correctedAge) + now.Sub(c.respTime)
+}
+
+// lifetime 返回缓存的响应的新鲜期，见RFC 7234第4.2.1和4.2.2节
+func (c *cachedResponse) lifetime(cc map[string]string) time.Duration {
+	if v, ok := cc["max-age"]; ok {
+		d, _ := parseSeconds(v)
+		return d
+	}
+	date, err := http.ParseTime(c.header.Get("Date"))
+	if err != nil {
+		date = c.respTime
+	}
+	if v := c.header.Get("Expires"); v != "" {
+		expires, err := http.ParseTime(v)
+		if err != nil {
+			return 0
+		}
+		return max(expires.Sub(date), 0)
+	}
+	if lastModified, err := http.ParseTime(c.header.Get("Last-Modified")); err == nil && heuristicStatus[c.code] {
+		return max(date.Sub(lastModified)/10, 0)
+	}
+	return 0
+}
+
+// fresh 判断缓存的响应在now时能否不经验证直接返回
+func (c *cachedResponse) fresh(reqCC map[string]string, now time.Time) bool {
+	cc := parseCacheControl(c.header)
+	if _, ok := cc["no-cache"]; ok {
+		return false
+	}
+	if _, ok := reqCC["no-cache"]; ok {
+		return false
+	}
+	if c.header.Get("Pragma") == "no-cache" && c.header.Get("Cache-Control") == "" {
+		return false
+	}
+	lifetime, age := c.lifetime(cc), c.age(now)
+	if v, ok := reqCC["max-age"]; ok {
+		if d, ok := parseSeconds(v); ok && age > d {
+			return false
+		}
+	}
+	if v, ok := reqCC["min-fresh"]; ok {
+		if d, ok := parseSeconds(v); ok {
+			age += d
+		}
+	}
+	if age < lifetime {
+		return true
+	}
+	if _, ok := cc["must-revalidate"]; ok {
+		return false
+	}
+	if v, ok := reqCC["max-stale"]; ok {
+		if v == "" {
+			return true
+		}
+		d, ok := parseSeconds(v)
+		return ok && age < lifetime+d
+	}
+	return false
+}
+
+// staleWhileRevalidate 判断过期的缓存能否按stale-while-revalidate先返回、同时在后台验证
+func (c *cachedResponse) staleWhileRevalidate(reqCC map[string]string, now time.Time) bool {
+	cc := parseCacheControl(c.header)
+	if !c.mayServeStale(cc, reqCC) {
+		return false
+	}
+	d, ok := parseSeconds(cc["stale-while-revalidate"])
+	return ok && c.age(now) < c.lifetime(cc)+d
+}
+
+// staleIfError 判断请求失败时能否按stale-if-error返回过期的缓存，请求中的stale-if-error优先
+func (c *cachedResponse) staleIfError(reqCC map[string]string, now time.Time) bool {
+	cc := parseCacheControl(c.header)
+	if !c.mayServeStale(cc, reqCC) {
+		return false
+	}
+	v, ok := reqCC["stale-if-error"]
+	if !ok {
+		v = cc["stale-if-error"]
+	}
+	d, ok := parseSeconds(v)
+	return ok && c.age(now) < c.lifetime(cc)+d
+}
+
+// mayServeStale 判断响应和请求是否允许返回过期的缓存
+func (c *cachedResponse) mayServeStale(cc, reqCC map[string]string) bool {
+	for _, name := range []string{"must-revalidate", "no-cache"} {
+		if _, ok := cc[name]; ok {
+			return false
+		}
+	}
+	_, ok := reqCC["no-cache"]
+	return !ok
+}
+
+// update 用304响应的响应头更新缓存的响应，见RFC 7234第4.3.4节
+func (c *cachedResponse) update(h http.Header, reqTime, respTime time.Time) {
+	for name, values := range h {
+		switch name {
+		case "Content-Length", "Transfer-Encoding", "Content-Encoding", "Content-Range":
+			continue
+		}
+		c.header[name] = values
+	}
+	c.reqTime, c.respTime = reqTime, respTime
+}
+
+// response 生成返回给调用方的响应，Age为缓存的年龄
+func (c *cachedResponse) response(req *http.Request) *http.Response {
+	h := c.header.Clone()
+	h.Set("Age", strconv.FormatInt(int64(c.age(time.Now())/time.Second), 10))
+	return &http.Response{
+		Status:        c.status,
+		StatusCode:    c.code,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        h,
+		Body:          io.NopCloser(bytes.NewReader(c.body)),
+		ContentLength: int64(len(c.body)),
+		Request:       req,
+	}
+}
+
+// cacheBodyReader 读取响应体的同时保存一份，读到EOF时调用done
+type cacheBodyReader struct {
+	rc   io.ReadCloser
+	buf  bytes.Buffer
+	done func(body []byte)
+}
+
+func (r *cacheBodyReader) Read(p []byte) (int, error) {
+	n, err := r.rc.Read(p)
+	r.buf.Write(p[:n])
+	if err == io.EOF && r.done != nil {
+		r.done(r.buf.Bytes())
+		r.done = nil
+	}
+	return n, err
+}
+
+func (r *cacheBodyReader) Close() error {
+	r.done = nil
+	return r.rc.Close()
+}
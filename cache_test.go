@@ -0,0 +1,229 @@
+package goproxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestCacheServer 按路径返回不同缓存策略的响应，响应体带有请求序号
+func newTestCacheServer(t *testing.T) (*httptest.Server, *atomic.Int32) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := requests.Add(1)
+		switch r.URL.Path {
+		case "/fresh":
+			w.Header().Set("Cache-Control", "max-age=3600")
+		case "/etag":
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Header().Set("ETag", `"v1"`)
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				w.Header().Set("X-Revalidated", "1")
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		case "/nostore":
+			w.Header().Set("Cache-Control", "no-store, max-age=3600")
+		case "/vary":
+			w.Header().Set("Cache-Control", "max-age=3600")
+			w.Header().Set("Vary", "Accept-Language")
+			fmt.Fprintf(w, "%s ", r.Header.Get("Accept-Language"))
+		case "/aged":
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Header().Set("Age", "120")
+		}
+		fmt.Fprintf(w, "%d", n)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func TestCacheTransport(t *testing.T) {
+	srv, requests := newTestCacheServer(t)
+	c := New()
+	cache := NewCacheTransport(NewMemoryCache(), c.GetTransport())
+	c.SetTransport(cache)
+	get := func(path string, header ...string) string {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		return doBody(t, c, req)
+	}
+
+	if a, b := get("/fresh"), get("/fresh"); a != "1" || b != "1" {
+		t.Errorf("未过期的响应为%q和%q", a, b)
+	}
+	if got := get("/fresh", "Cache-Control", "no-cache"); got != "2" {
+		t.Errorf("请求no-cache时响应为%q", got)
+	}
+	if got := get("/fresh"); got != "2" {
+		t.Errorf("缓存更新后响应为%q", got)
+	}
+
+	// 每次都需要验证，服务器返回304后使用缓存的响应体
+	if a, b := get("/etag"), get("/etag"); a != "3" || b != "3" || requests.Load() != 4 {
+		t.Errorf("验证后的响应为%q和%q，请求了%d次", a, b, requests.Load())
+	}
+	if a, b := get("/nostore"), get("/nostore"); a == b {
+		t.Errorf("no-store的响应被缓存: %q", a)
+	}
+	if a, b := get("/vary", "Accept-Language", "en"), get("/vary", "Accept-Language", "zh"); a == b {
+		t.Errorf("Vary不同的请求使用了同一缓存: %q", a)
+	}
+	if a, b := get("/aged"), get("/aged"); a == b {
+		t.Errorf("Age超过max-age的响应被缓存: %q", a)
+	}
+
+	// 修改资源后缓存失效
+	before := get("/fresh")
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/fresh", strings.NewReader("x"))
+	doBody(t, c, req)
+	if got := get("/fresh"); got == before {
+		t.Errorf("POST后仍返回缓存的响应%q", got)
+	}
+
+	stats := cache.Stats()
+	if stats.Hits != 3 || stats.Revalidated != 1 || stats.HitRatio == 0 {
+		t.Errorf("统计为%+v", stats)
+	}
+}
+
+func TestCacheTransport_OnlyIfCached(t *testing.T) {
+	srv, requests := newTestCacheServer(t)
+	c := New()
+	c.SetTransport(NewCacheTransport(NewMemoryCache(), c.GetTransport()))
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/fresh", nil)
+	req.Header.Set("Cache-Control", "only-if-cached")
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusGatewayTimeout || requests.Load() != 0 {
+		t.Errorf("没有缓存时状态码为%d，请求了%d次", resp.StatusCode, requests.Load())
+	}
+}
+
+func TestCachedResponse_Fresh(t *testing.T) {
+	now := time.Now()
+	entry := func(header ...string) *cachedResponse {
+		h := http.Header{"Date": {now.Add(-30 * time.Second).UTC().Format(http.TimeFormat)}}
+		for i := 0; i+1 < len(header); i += 2 {
+			h.Set(header[i], header[i+1])
+		}
+		return &cachedResponse{code: 200, header: h, reqTime: now.Add(-30 * time.Second), respTime: now.Add(-30 * time.Second)}
+	}
+	tests := []struct {
+		name  string
+		entry *cachedResponse
+		reqCC string
+		want  bool
+	}{
+		{"max-age", entry("Cache-Control", "max-age=60"), "", true},
+		{"过期", entry("Cache-Control", "max-age=10"), "", false},
+		{"Expires", entry("Expires", now.Add(time.Minute).UTC().Format(http.TimeFormat)), "", true},
+		{"Last-Modified推算", entry("Last-Modified", now.Add(-time.Hour).UTC().Format(http.TimeFormat)), "", true},
+		{"请求max-age", entry("Cache-Control", "max-age=60"), "max-age=10", false},
+		{"min-fresh", entry("Cache-Control", "max-age=60"), "min-fresh=40", false},
+		{"max-stale", entry("Cache-Control", "max-age=10"), "max-stale=60", true},
+		{"must-revalidate", entry("Cache-Control", "max-age=10, must-revalidate"), "max-stale", false},
+	}
+	for _, tt := range tests {
+		reqCC := parseCacheControl(http.Header{"Cache-Control": {tt.reqCC}})
+		if got := tt.entry.fresh(reqCC, now); got != tt.want {
+			t.Errorf("%s: 新鲜度为%v", tt.name, got)
+		}
+	}
+}
+
+func TestCacheTransport_Stale(t *testing.T) {
+	var requests atomic.Int32
+	var failing atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := requests.Add(1)
+		if failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		switch r.URL.Path {
+		case "/swr":
+			w.Header().Set("Cache-Control", "max-age=0, stale-while-revalidate=60")
+		case "/sie":
+			w.Header().Set("Cache-Control", "max-age=0, stale-if-error=60")
+		}
+		fmt.Fprintf(w, "%d", n)
+	}))
+	defer srv.Close()
+
+	c := New()
+	cache := NewCacheTransport(NewMemoryCache(), c.GetTransport())
+	c.SetTransport(cache)
+	get := func(path string) string {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+		return doBody(t, c, req)
+	}
+
+	// 先返回过期的缓存，后台验证完成后缓存更新
+	if a, b := get("/swr"), get("/swr"); a != "1" || b != "1" {
+		t.Errorf("stale-while-revalidate的响应为%q和%q", a, b)
+	}
+	for i := 0; i < 100 && cache.Stats().Stores < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := get("/swr"); got != "2" {
+		t.Errorf("后台验证后的响应为%q", got)
+	}
+
+	if got := get("/sie"); got == "" {
+		t.Fatal("响应为空")
+	}
+	before := get("/sie")
+	failing.Store(true)
+	if got := get("/sie"); got != before {
+		t.Errorf("服务器出错时响应为%q", got)
+	}
+	if got := get("/other"); got != "" {
+		t.Errorf("没有缓存时服务器出错的响应为%q", got)
+	}
+	if cache.Stats().Stale < 3 {
+		t.Errorf("统计为%+v", cache.Stats())
+	}
+}
+
+func TestCacheTransport_SetOffline(t *testing.T) {
+	srv, requests := newTestCacheServer(t)
+	c := New()
+	cache := NewCacheTransport(NewMemoryCache(), c.GetTransport())
+	c.SetTransport(cache)
+	status := func(path string) (int, string) {
+		t.Helper()
+		resp, err := c.GetClient().Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+	status("/aged")
+	cache.SetOffline(true)
+	// 离线时过期的缓存同样返回
+	if code, body := status("/aged"); code != http.StatusOK || body != "1" {
+		t.Errorf("离线时状态码为%d, 响应为%q", code, body)
+	}
+	if code, _ := status("/fresh"); code != http.StatusGatewayTimeout || requests.Load() != 1 {
+		t.Errorf("离线且没有缓存时状态码为%d, 请求了%d次", code, requests.Load())
+	}
+	cache.SetOffline(false)
+	if code, body := status("/aged"); code != http.StatusOK || body != "2" {
+		t.Errorf("恢复在线后状态码为%d, 响应为%q", code, body)
+	}
+}
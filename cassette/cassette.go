@@ -0,0 +1,405 @@
+// Package cassette 实现VCR风格的请求录制与回放
+// 首次运行时将真实响应录制到YAML或JSON格式的磁带文件中，之后的运行直接从磁带回放，
+// 使依赖外部服务的测试可以离线、稳定地运行。
+// 运行模式可以通过环境变量GOPROXY_CASSETTE切换，取值为record、replay、auto或off
+package cassette
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvMode 用于切换运行模式的环境变量名
+const EnvMode = "GOPROXY_CASSETTE"
+
+// Mode 磁带运行模式
+type Mode int
+
+const (
+	// ModeAuto 磁带文件存在时回放，否则录制
+	ModeAuto Mode = iota
+	// ModeRecord 总是发送真实请求并录制，覆盖已有磁带
+	ModeRecord
+	// ModeReplay 只从磁带回放，找不到匹配的记录时返回错误
+	ModeReplay
+	// ModeOff 直接透传给真实传输层，不录制也不回放
+	ModeOff
+)
+
+// ErrInteractionNotFound 回放模式下找不到匹配的录制记录
+var ErrInteractionNotFound = errors.New("cassette: 找不到匹配的录制记录")
+
+// ParseMode 解析模式字符串，空字符串解析为ModeAuto
+func ParseMode(s string) (Mode, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "auto":
+		return ModeAuto, nil
+	case "record":
+		return ModeRecord, nil
+	case "replay":
+		return ModeReplay, nil
+	case "off":
+		return ModeOff, nil
+	default:
+		return ModeAuto, fmt.Errorf("cassette: 不支持的模式: %s", s)
+	}
+}
+
+// Body 录制的消息体，非UTF-8内容使用base64编码保存
+type Body struct {
+	Encoding string `json:"encoding,omitempty" yaml:"encoding,omitempty"`
+	Data     string `json:"data" yaml:"data"`
+}
+
+func newBody(b []byte) Body {
+	if utf8.Valid(b) {
+		return Body{Data: string(b)}
+	}
+	return Body{Encoding: "base64", Data: base64.StdEncoding.EncodeToString(b)}
+}
+
+// Bytes 返回解码后的内容
+func (b Body) Bytes() []byte {
+	if b.Encoding == "base64" {
+		data, _ := base64.StdEncoding.DecodeString(b.Data)
+		return data
+	}
+	return []byte(b.Data)
+}
+
+// Request 录制的请求
+type Request struct {
+	Method string      `json:"method" yaml:"method"`
+	URL    string      `json:"url" yaml:"url"`
+	Header http.Header `json:"header,omitempty" yaml:"header,omitempty"`
+	Body   Body        `json:"body" yaml:"body"`
+}
+
+// Response 录制的响应
+type Response struct {
+	Status int         `json:"status" yaml:"status"`
+	Header http.Header `json:"header,omitempty" yaml:"header,omitempty"`
+	Body   Body        `json:"body" yaml:"body"`
+}
+
+// Interaction 一次请求与响应的录制记录
+type Interaction struct {
+	Request  Request  `json:"request" yaml:"request"`
+	Response Response `json:"response" yaml:"response"`
+}
+
+// Cassette 磁带文件的内容
+type Cassette struct {
+	Interactions []*Interaction `json:"interactions" yaml:"interactions"`
+}
+
+// Matcher 判断请求是否与录制的请求匹配
+type Matcher func(req *http.Request, body []byte, rec Request) bool
+
+// DefaultMatcher 按请求方法和完整URL匹配
+func DefaultMatcher(req *http.Request, body []byte, rec Request) bool {
+	return req.Method == rec.Method && req.URL.String() == rec.URL
+}
+
+// MatchHeaders 要求指定请求头的值与录制时一致
+func MatchHeaders(keys ...string) Matcher {
+	return func(req *http.Request, body []byte, rec Request) bool {
+		for _, key := range keys {
+			if req.Header.Get(key) != rec.Header.Get(key) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// MatchBody 要求请求体与录制时一致
+func MatchBody() Matcher {
+	return func(req *http.Request, body []byte, rec Request) bool {
+		return bytes.Equal(body, rec.Body.Bytes())
+	}
+}
+
+// Option 录制器的配置选项
+type Option func(*Recorder)
+
+// WithMode 指定运行模式，优先级高于环境变量
+func WithMode(mode Mode) Option {
+	return func(r *Recorder) {
+		r.mode = mode
+		r.modeSet = true
+	}
+}
+
+// WithMatchers 追加匹配条件，所有条件都满足才视为匹配，DefaultMatcher始终生效
+func WithMatchers(matchers ...Matcher) Option {
+	return func(r *Recorder) {
+		r.matchers = append(r.matchers, matchers...)
+	}
+}
+
+// WithFilterHeaders 录制时从请求和响应中去掉指定的请求头，避免凭据写入磁带
+func WithFilterHeaders(keys ...string) Option {
+	return func(r *Recorder) {
+		r.filter = append(r.filter, keys...)
+	}
+}
+
+// Recorder 录制与回放请求的RoundTripper
+type Recorder struct {
+	path     string
+	real     http.RoundTripper
+	mode     Mode
+	modeSet  bool
+	matchers []Matcher
+	filter   []string
+
+	mu       sync.Mutex
+	cassette *Cassette
+	used     []bool
+}
+
+// New 创建录制器
+// 参数:
+//   - path: 磁带文件路径，扩展名为.yaml或.yml时使用YAML格式，为.har时从HAR文件回放(不能录制)，否则使用JSON格式
+//   - real: 真实的传输层，为nil时使用http.DefaultTransport
+//   - opts: 配置选项
+//
+// 未通过WithMode指定模式时读取环境变量GOPROXY_CASSETTE
+func New(path string, real http.RoundTripper, opts ...Option) (*Recorder, error) {
+	if real == nil {
+		real = http.DefaultTransport
+	}
+	r := &Recorder{path: path, real: real, cassette: &Cassette{}}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if !r.modeSet {
+		mode, err := ParseMode(os.Getenv(EnvMode))
+		if err != nil {
+			return nil, err
+		}
+		r.mode = mode
+	}
+	if r.mode == ModeAuto {
+		if _, err := os.Stat(path); err == nil {
+			r.mode = ModeReplay
+		} else {
+			r.mode = ModeRecord
+		}
+	}
+	if r.mode == ModeRecord && strings.EqualFold(filepath.Ext(path), ".har") {
+		return nil, fmt.Errorf("cassette: 不能录制到HAR文件: %s", path)
+	}
+	if r.mode == ModeReplay {
+		if err := r.load(); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Mode 返回实际生效的运行模式
+func (r *Recorder) Mode() Mode {
+	return r.mode
+}
+
+// isYAML 根据扩展名判断是否使用YAML格式
+func (r *Recorder) isYAML() bool {
+	ext := strings.ToLower(filepath.Ext(r.path))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// load 读取磁带文件
+func (r *Recorder) load() error {
+	c, err := Load(r.path)
+	if err != nil {
+		return err
+	}
+	r.cassette = c
+	r.used = make([]bool, len(c.Interactions))
+	return nil
+}
+
+// Save 将已录制的记录写入磁带文件，录制模式下每录制一条都会自动保存
+func (r *Recorder) Save() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.save()
+}
+
+func (r *Recorder) save() error {
+	var data []byte
+	var err error
+	if r.isYAML() {
+		data, err = yaml.Marshal(r.cassette)
+	} else {
+		data, err = json.MarshalIndent(r.cassette, "", "  ")
+	}
+	if err != nil {
+		return fmt.Errorf("cassette: 序列化磁带失败: %w", err)
+	}
+	if dir := filepath.Dir(r.path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("cassette: 创建目录失败: %w", err)
+		}
+	}
+	if err := os.WriteFile(r.path, data, 0o644); err != nil {
+		return fmt.Errorf("cassette: 写入磁带失败: %w", err)
+	}
+	return nil
+}
+
+// Interactions 返回当前磁带中的所有记录
+func (r *Recorder) Interactions() []*Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*Interaction(nil), r.cassette.Interactions...)
+}
+
+// Unwrap 返回真实的传输层，GoProxy.SetTransport通过它在其中的*http.Transport上安装代理等设置
+func (r *Recorder) Unwrap() http.RoundTripper {
+	return r.real
+}
+
+// RoundTrip 实现http.RoundTripper接口
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	switch r.mode {
+	case ModeOff:
+		return r.real.RoundTrip(req)
+	case ModeReplay:
+		return r.replay(req)
+	default:
+		return r.record(req)
+	}
+}
+
+// readBody 读取请求体并恢复，使请求可以继续发送
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("cassette: 读取请求体失败: %w", err)
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// matches 判断请求是否与录制记录匹配
+func (r *Recorder) matches(req *http.Request, body []byte, rec Request) bool {
+	if !DefaultMatcher(req, body, rec) {
+		return false
+	}
+	for _, m := range r.matchers {
+		if !m(req, body, rec) {
+			return false
+		}
+	}
+	return true
+}
+
+// replay 从磁带中查找匹配的记录，优先使用尚未回放过的记录
+func (r *Recorder) replay(req *http.Request) (*http.Response, error) {
+	body, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	found := -1
+	for i, it := range r.cassette.Interactions {
+		if !r.matches(req, body, it.Request) {
+			continue
+		}
+		if !r.used[i] {
+			found = i
+			break
+		}
+		if found < 0 {
+			found = i
+		}
+	}
+	if found >= 0 {
+		r.used[found] = true
+	}
+	r.mu.Unlock()
+
+	if found < 0 {
+		return nil, fmt.Errorf("%w: %s %s", ErrInteractionNotFound, req.Method, req.URL)
+	}
+	rec := r.cassette.Interactions[found].Response
+	data := rec.Body.Bytes()
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", rec.Status, http.StatusText(rec.Status)),
+		StatusCode:    rec.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        rec.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(data)),
+		ContentLength: int64(len(data)),
+		Request:       req,
+	}, nil
+}
+
+// record 发送真实请求并录制
+func (r *Recorder) record(req *http.Request) (*http.Response, error) {
+	body, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+	reqHeader := req.Header.Clone()
+	resp, err := r.real.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("cassette: 读取响应体失败: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	respHeader := resp.Header.Clone()
+	for _, key := range r.filter {
+		reqHeader.Del(key)
+		respHeader.Del(key)
+	}
+	it := &Interaction{
+		Request: Request{
+			Method: req.Method,
+			URL:    req.URL.String(),
+			Header: reqHeader,
+			Body:   newBody(body),
+		},
+		Response: Response{
+			Status: resp.StatusCode,
+			Header: respHeader,
+			Body:   newBody(respBody),
+		},
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cassette.Interactions = append(r.cassette.Interactions, it)
+	r.used = append(r.used, true)
+	if err := r.save(); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp, nil
+}
@@ -0,0 +1,86 @@
+package cassette
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/fasnow/goproxy"
+)
+
+func TestRecorder(t *testing.T) {
+	var hits int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.Header().Set("X-Hit", "1")
+		io.WriteString(w, "hello "+r.URL.Path)
+	}))
+	defer srv.Close()
+
+	for _, name := range []string{"tape.yaml", "tape.json"} {
+		t.Run(name, func(t *testing.T) {
+			hits = 0
+			path := filepath.Join(t.TempDir(), name)
+			c := goproxy.New()
+
+			rec, err := New(path, c.GetTransport(), WithFilterHeaders("User-Agent"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rec.Mode() != ModeRecord {
+				t.Fatalf("磁带不存在时应为录制模式，实际%v", rec.Mode())
+			}
+			c.SetTransportRoundTripper(rec)
+			get(t, c, srv.URL+"/a")
+
+			rec, err = New(path, c.GetTransport())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rec.Mode() != ModeReplay {
+				t.Fatalf("磁带存在时应为回放模式，实际%v", rec.Mode())
+			}
+			c.SetTransportRoundTripper(rec)
+			if body := get(t, c, srv.URL+"/a"); body != "hello /a" {
+				t.Errorf("回放内容错误: %s", body)
+			}
+			if hits != 1 {
+				t.Errorf("回放时不应访问服务器，实际访问%d次", hits)
+			}
+			if _, err := c.GetClient().Get(srv.URL + "/b"); !errors.Is(err, ErrInteractionNotFound) {
+				t.Errorf("期望ErrInteractionNotFound，实际%v", err)
+			}
+			if h := rec.Interactions()[0].Request.Header.Get("User-Agent"); h != "" {
+				t.Errorf("过滤的请求头被录制: %s", h)
+			}
+		})
+	}
+}
+
+func TestParseMode(t *testing.T) {
+	t.Setenv(EnvMode, "off")
+	rec, err := New(filepath.Join(t.TempDir(), "x.json"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Mode() != ModeOff {
+		t.Errorf("环境变量未生效: %v", rec.Mode())
+	}
+	if _, err := ParseMode("bogus"); err == nil {
+		t.Error("期望非法模式返回错误")
+	}
+}
+
+func get(t *testing.T, c *goproxy.GoProxy, url string) string {
+	t.Helper()
+	resp, err := c.GetClient().Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return string(body)
+}
@@ -0,0 +1,220 @@
+package cassette
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/token"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// FixtureStyle 生成的测试桩的形式
+type FixtureStyle string
+
+const (
+	// FixtureMock 生成在mock.Transport上注册路由的函数，按完整URL匹配
+	FixtureMock FixtureStyle = "mock"
+	// FixtureHTTPTest 生成返回http.Handler的函数，用于httptest.NewServer，按方法、路径和查询字符串匹配
+	FixtureHTTPTest FixtureStyle = "httptest"
+)
+
+// defaultDropHeaders 生成测试桩时默认去掉的响应头，它们随每次请求变化或由服务器自动设置
+var defaultDropHeaders = []string{"Date", "Content-Length", "Transfer-Encoding", "Connection", "Keep-Alive"}
+
+// FixtureOptions 生成测试桩的选项
+type FixtureOptions struct {
+	Package     string       // 生成代码的包名，为空时为"fixtures"
+	Func        string       // 生成的函数名，为空时mock形式为"RegisterFixtures"，httptest形式为"FixtureHandler"
+	Style       FixtureStyle // 生成的形式，为空时为FixtureMock
+	DropHeaders []string     // 额外去掉的响应头，如Set-Cookie，Date、Content-Length等总是去掉
+}
+
+// fixture 一条录制记录对应的测试桩
+type fixture struct {
+	Method string
+	URL    string
+	Status int
+	Header [][2]string
+	Body   string
+	Once   bool // 同一请求后面还有记录，只匹配一次
+}
+
+// GenerateFixtures 将录制记录生成为Go测试桩源码，使真实服务的响应可以固定为回归测试。
+// 同一请求有多条记录时按录制顺序依次返回，最后一条之后重复返回最后一条
+func (c *Cassette) GenerateFixtures(opts FixtureOptions) ([]byte, error) {
+	if opts.Package == "" {
+		opts.Package = "fixtures"
+	}
+	if opts.Style == "" {
+		opts.Style = FixtureMock
+	}
+	if opts.Func == "" {
+		opts.Func = "RegisterFixtures"
+		if opts.Style == FixtureHTTPTest {
+			opts.Func = "FixtureHandler"
+		}
+	}
+	if !token.IsIdentifier(opts.Package) || !token.IsIdentifier(opts.Func) {
+		return nil, fmt.Errorf("cassette: 无效的包名或函数名: %s.%s", opts.Package, opts.Func)
+	}
+	var tmpl *template.Template
+	switch opts.Style {
+	case FixtureMock:
+		tmpl = mockFixtureTemplate
+	case FixtureHTTPTest:
+		tmpl = httptestFixtureTemplate
+	default:
+		return nil, fmt.Errorf("cassette: 不支持的测试桩形式: %s", opts.Style)
+	}
+	drop := slices.Concat(defaultDropHeaders, opts.DropHeaders)
+
+	fixtures := make([]*fixture, 0, len(c.Interactions))
+	last := make(map[string]*fixture)
+	for _, it := range c.Interactions {
+		f := &fixture{Method: it.Request.Method, URL: it.Request.URL, Status: it.Response.Status, Body: string(it.Response.Body.Bytes())}
+		if opts.Style == FixtureHTTPTest {
+			u, err := url.Parse(it.Request.URL)
+			if err != nil {
+				return nil, fmt.Errorf("cassette: 无效的URL %q: %w", it.Request.URL, err)
+			}
+			f.URL = u.RequestURI()
+		}
+		if f.Status == 0 {
+			f.Status = http.StatusOK
+		}
+		header := it.Response.Header.Clone()
+		for _, k := range drop {
+			header.Del(k)
+		}
+		for _, k := range slices.Sorted(maps.Keys(header)) {
+			for _, v := range header[k] {
+				f.Header = append(f.Header, [2]string{k, v})
+			}
+		}
+		key := f.Method + " " + f.URL
+		if prev, ok := last[key]; ok {
+			prev.Once = true
+		}
+		last[key] = f
+		fixtures = append(fixtures, f)
+	}
+
+	var buf bytes.Buffer
+	err := tmpl.Execute(&buf, map[string]any{"Package": opts.Package, "Func": opts.Func, "Fixtures": fixtures})
+	if err != nil {
+		return nil, fmt.Errorf("cassette: 生成测试桩失败: %w", err)
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("cassette: 格式化测试桩失败: %w", err)
+	}
+	return src, nil
+}
+
+var fixtureFuncs = template.FuncMap{
+	"quote": strconv.Quote,
+	"lowerFirst": func(s string) string {
+		return strings.ToLower(s[:1]) + s[1:]
+	},
+}
+
+// fixtureTable 两种形式共用的录制记录表
+const fixtureTable = `{{define "table"}}
+// {{lowerFirst .Func}}Data 录制的请求和响应
+var {{lowerFirst .Func}}Data = []struct {
+	Method string
+	URL    string
+	Status int
+	Header [][2]string
+	Body   string
+	Once   bool
+}{
+{{- range .Fixtures}}
+	{
+		Method: {{quote .Method}},
+		URL:    {{quote .URL}},
+		Status: {{.Status}},
+		{{- if .Header}}
+		Header: [][2]string{
+			{{- range .Header}}
+			{ {{- quote (index . 0)}}, {{quote (index . 1) -}} },
+			{{- end}}
+		},
+		{{- end}}
+		Body: {{quote .Body}},
+		{{- if .Once}}
+		Once: true,
+		{{- end}}
+	},
+{{- end}}
+}
+{{end}}`
+
+var mockFixtureTemplate = template.Must(template.New("mock").Funcs(fixtureFuncs).Parse(fixtureTable + `// Code generated by goproxy fixture; DO NOT EDIT.
+
+package {{.Package}}
+
+import "github.com/fasnow/goproxy/mock"
+
+// {{.Func}} 在t上注册录制的响应，同一请求的多条记录按录制顺序依次返回
+func {{.Func}}(t *mock.Transport) {
+	for _, f := range {{lowerFirst .Func}}Data {
+		r := t.On(f.Method, f.URL).Respond(f.Status, f.Body)
+		for _, h := range f.Header {
+			r.Header(h[0], h[1])
+		}
+		if f.Once {
+			r.Times(1)
+		}
+	}
+}
+{{template "table" .}}`))
+
+var httptestFixtureTemplate = template.Must(template.New("httptest").Funcs(fixtureFuncs).Parse(fixtureTable + `// Code generated by goproxy fixture; DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	"io"
+	"net/http"
+	"sync"
+)
+
+// {{.Func}} 返回按录制的响应应答的http.Handler，用于httptest.NewServer。
+// 按请求方法、路径和查询字符串匹配，同一请求的多条记录按录制顺序依次返回，没有匹配时返回404
+func {{.Func}}() http.Handler {
+	var mu sync.Mutex
+	used := make([]bool, len({{lowerFirst .Func}}Data))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		found := -1
+		for i, f := range {{lowerFirst .Func}}Data {
+			if f.Method != r.Method || f.URL != r.URL.RequestURI() || used[i] {
+				continue
+			}
+			found = i
+			if f.Once {
+				used[i] = true
+			}
+			break
+		}
+		mu.Unlock()
+		if found < 0 {
+			http.NotFound(w, r)
+			return
+		}
+		f := {{lowerFirst .Func}}Data[found]
+		for _, h := range f.Header {
+			w.Header().Add(h[0], h[1])
+		}
+		w.WriteHeader(f.Status)
+		io.WriteString(w, f.Body)
+	})
+}
+{{template "table" .}}`))
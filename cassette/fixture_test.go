@@ -0,0 +1,59 @@
+package cassette
+
+import (
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+func TestCassette_GenerateFixtures(t *testing.T) {
+	c, err := ParseHAR([]byte(testHAR))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 同一请求录制了两次
+	c.Interactions = append(c.Interactions, &Interaction{
+		Request:  Request{Method: "POST", URL: "https://api.example.com/login"},
+		Response: Response{Status: 429, Body: newBody([]byte("slow down"))},
+	})
+
+	src, err := c.GenerateFixtures(FixtureOptions{Package: "apitest", DropHeaders: []string{"Set-Cookie"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := parser.ParseFile(token.NewFileSet(), "fixtures.go", src, 0)
+	if err != nil {
+		t.Fatalf("生成的代码无法解析: %v\n%s", err, src)
+	}
+	code := string(src)
+	if f.Name.Name != "apitest" || !strings.Contains(code, "func RegisterFixtures(t *mock.Transport)") || !strings.HasPrefix(code, "// Code generated") {
+		t.Errorf("生成的代码为:\n%s", code)
+	}
+	for _, want := range []string{`URL:    "https://api.example.com/login"`, `{"Content-Type", "application/json"}`, `Body:   "\x00\x01\xff"`, `Status: 429`, "Once: true"} {
+		if !strings.Contains(code, want) {
+			t.Errorf("生成的代码缺少%s", want)
+		}
+	}
+	if strings.Contains(code, "Set-Cookie") || strings.Count(code, "Once: true") != 1 {
+		t.Errorf("生成的代码为:\n%s", code)
+	}
+
+	src, err = c.GenerateFixtures(FixtureOptions{Style: FixtureHTTPTest, Func: "LoginServer"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	code = string(src)
+	if _, err := parser.ParseFile(token.NewFileSet(), "fixtures.go", src, 0); err != nil {
+		t.Fatalf("生成的代码无法解析: %v\n%s", err, src)
+	}
+	if !strings.Contains(code, "package fixtures") || !strings.Contains(code, "func LoginServer() http.Handler") || !strings.Contains(code, `URL:    "/logo.png"`) || !strings.Contains(code, "loginServerData") {
+		t.Errorf("生成的代码为:\n%s", code)
+	}
+
+	for _, opts := range []FixtureOptions{{Style: "gomock"}, {Package: "my-pkg"}, {Func: "1x"}} {
+		if _, err := c.GenerateFixtures(opts); err == nil {
+			t.Errorf("%+v应返回错误", opts)
+		}
+	}
+}
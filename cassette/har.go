@@ -0,0 +1,122 @@
+package cassette
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// harFile HAR 1.2文件中用到的部分
+type harFile struct {
+	Log struct {
+		Entries []struct {
+			Request struct {
+				Method   string      `json:"method"`
+				URL      string      `json:"url"`
+				Headers  []harHeader `json:"headers"`
+				PostData *struct {
+					Text string `json:"text"`
+				} `json:"postData"`
+			} `json:"request"`
+			Response struct {
+				Status  int         `json:"status"`
+				Headers []harHeader `json:"headers"`
+				Content struct {
+					Text     string `json:"text"`
+					Encoding string `json:"encoding"`
+				} `json:"content"`
+			} `json:"response"`
+		} `json:"entries"`
+	} `json:"log"`
+}
+
+type harHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// harHeaders 转换HAR的请求头，跳过HTTP/2的伪首部
+func harHeaders(hs []harHeader) http.Header {
+	h := make(http.Header, len(hs))
+	for _, kv := range hs {
+		if strings.HasPrefix(kv.Name, ":") {
+			continue
+		}
+		h.Add(kv.Name, kv.Value)
+	}
+	return h
+}
+
+// ParseHAR 将浏览器开发者工具等导出的HAR文件转换为磁带，每个条目对应一条录制记录
+func ParseHAR(data []byte) (*Cassette, error) {
+	var f harFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("cassette: 解析HAR失败: %w", err)
+	}
+	c := &Cassette{}
+	for i, e := range f.Log.Entries {
+		if e.Request.Method == "" || e.Request.URL == "" {
+			return nil, fmt.Errorf("cassette: HAR第%d个条目缺少请求方法或URL", i+1)
+		}
+		it := &Interaction{
+			Request: Request{
+				Method: e.Request.Method,
+				URL:    e.Request.URL,
+				Header: harHeaders(e.Request.Headers),
+			},
+			Response: Response{
+				Status: e.Response.Status,
+				Header: harHeaders(e.Response.Headers),
+			},
+		}
+		if e.Request.PostData != nil {
+			it.Request.Body = newBody([]byte(e.Request.PostData.Text))
+		}
+		body := []byte(e.Response.Content.Text)
+		if e.Response.Content.Encoding == "base64" {
+			var err error
+			if body, err = base64.StdEncoding.DecodeString(e.Response.Content.Text); err != nil {
+				return nil, fmt.Errorf("cassette: HAR第%d个条目的响应体解码失败: %w", i+1, err)
+			}
+		}
+		it.Response.Body = newBody(body)
+		// 浏览器记录的是解压后的内容，去掉不再适用的编码和长度
+		it.Response.Header.Del("Content-Encoding")
+		it.Response.Header.Del("Content-Length")
+		c.Interactions = append(c.Interactions, it)
+	}
+	return c, nil
+}
+
+// Load 读取磁带文件，扩展名为.har时按HAR格式转换，为.yaml或.yml时按YAML格式，否则按JSON格式
+func Load(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cassette: 读取磁带失败: %w", err)
+	}
+	return decode(path, data)
+}
+
+// decode 按扩展名解析磁带文件的内容
+func decode(path string, data []byte) (*Cassette, error) {
+	var err error
+	c := &Cassette{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".har":
+		return ParseHAR(data)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, c)
+	default:
+		err = json.Unmarshal(data, c)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cassette: 解析磁带失败: %w", err)
+	}
+	return c, nil
+}
@@ -0,0 +1,77 @@
+package cassette
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testHAR = `{"log": {"version": "1.2", "entries": [
+	{
+		"request": {"method": "POST", "url": "https://api.example.com/login",
+			"headers": [{"name": ":authority", "value": "api.example.com"}, {"name": "Content-Type", "value": "application/json"}],
+			"postData": {"mimeType": "application/json", "text": "{\"user\":\"a\"}"}},
+		"response": {"status": 200,
+			"headers": [{"name": "Content-Type", "value": "application/json"}, {"name": "Content-Encoding", "value": "gzip"}, {"name": "Set-Cookie", "value": "a=1"}, {"name": "Set-Cookie", "value": "b=2"}],
+			"content": {"size": 11, "mimeType": "application/json", "text": "{\"ok\":true}"}}
+	},
+	{
+		"request": {"method": "GET", "url": "https://api.example.com/logo.png", "headers": []},
+		"response": {"status": 200, "headers": [], "content": {"text": "AAH/", "encoding": "base64"}}
+	}
+]}}`
+
+func TestParseHAR(t *testing.T) {
+	c, err := ParseHAR([]byte(testHAR))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Interactions) != 2 {
+		t.Fatalf("记录数为%d", len(c.Interactions))
+	}
+	login := c.Interactions[0]
+	if login.Request.Method != "POST" || string(login.Request.Body.Bytes()) != `{"user":"a"}` || login.Request.Header.Get(":authority") != "" {
+		t.Errorf("请求为%+v", login.Request)
+	}
+	if h := login.Response.Header; h.Get("Content-Encoding") != "" || len(h.Values("Set-Cookie")) != 2 {
+		t.Errorf("响应头为%v", h)
+	}
+	if logo := c.Interactions[1].Response.Body; logo.Encoding != "base64" || string(logo.Bytes()) != "\x00\x01\xff" {
+		t.Errorf("二进制响应体为%+v", logo)
+	}
+
+	for _, bad := range []string{"not json", `{"log":{"entries":[{"request":{}}]}}`, `{"log":{"entries":[{"request":{"method":"GET","url":"/"},"response":{"content":{"text":"!","encoding":"base64"}}}]}}`} {
+		if _, err := ParseHAR([]byte(bad)); err == nil {
+			t.Errorf("%s应返回错误", bad)
+		}
+	}
+}
+
+func TestRecorder_HAR(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.har")
+	if _, err := New(path, nil, WithMode(ModeAuto)); err == nil {
+		t.Error("不能录制到HAR文件")
+	}
+	if err := os.WriteFile(path, []byte(testHAR), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	rec, err := New(path, nil, WithMode(ModeAuto))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Mode() != ModeReplay {
+		t.Fatalf("模式为%v", rec.Mode())
+	}
+	client := &http.Client{Transport: rec}
+	resp, err := client.Get("https://api.example.com/logo.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "\x00\x01\xff" {
+		t.Errorf("回放的响应体为%q", body)
+	}
+}
@@ -0,0 +1,127 @@
+package goproxy
+
+import (
+	"maps"
+	"net/url"
+	"slices"
+)
+
+// Clone 创建一个配置相同但完全独立的客户端，修改任一客户端的配置都不会影响另一个
+// 复制的内容包括全局请求头、按主机设置的请求头、Cookie、TLS配置与指纹、超时、代理、解析与拨号设置、带宽限制等；
+// 连接池、DNS和ECH缓存、统计数据不复制，新客户端从空状态开始。
+// 注意: 其他http.CookieJar实现、令牌来源及其缓存的令牌、请求签名、凭据来源、Resolver、拨号函数、回调、流量日志记录器、连接记录导出器、规则路由以及SetTransport传入的中间件按引用共享
+func (r *GoProxy) Clone() *GoProxy {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ct := r.transport
+
+	c := New()
+	nct := c.transport
+	nct.GlobalHeader = ct.Headers()
+	nct.base = ct.base
+	nct.logger.Store(ct.logger.Load())
+	nct.headerOrder.Store(ct.headerOrder.Load())
+	nct.expectThreshold.Store(ct.expectThreshold.Load())
+	nct.authorization.Store(ct.authorization.Load())
+	nct.tokens.Store(ct.tokens.Load())
+	nct.signer.Store(ct.signer.Load())
+	nct.credentials.Store(ct.credentials.Load())
+	nct.referrerPolicy.Store(ct.referrerPolicy.Load())
+	nct.autoReferer.Store(ct.autoReferer.Load())
+	nct.forwarding.Store(ct.forwarding.Load())
+	nct.maxBodySize.Store(ct.maxBodySize.Load())
+	nct.hostHeaders.Store(ct.hostHeaders.Load())
+	nct.headerTemplates.Store(ct.headerTemplates.Load())
+	nct.headerVars.Store(ct.headerVars.Load())
+	nct.headerPolicy.Store(ct.headerPolicy.Load())
+	if p := ct.userAgents.Load(); p != nil {
+		nct.userAgents.Store(newUAPool(p.agents, p.mode, p.perHost))
+	}
+	if d := ct.digest.Load(); d != nil {
+		nct.digest.Store(NewDigestTransport(d.user, d.pass, nil))
+	}
+	nct.Transport = ct.Transport.Clone()
+	c.installDialers(nct.Transport)
+
+	c.client.Timeout = r.client.Timeout
+	c.client.CheckRedirect = r.client.CheckRedirect
+	c.maxRedirects = r.maxRedirects
+	c.redirectPolicy = r.redirectPolicy
+	c.templates = maps.Clone(r.templates)
+	c.expectedStatus = r.expectedStatus
+	c.responseValidator = r.responseValidator
+	c.errorTypes = r.errorTypes
+	c.speedTestDownload = r.speedTestDownload
+	c.speedTestUpload = r.speedTestUpload
+	if jar, ok := r.client.Jar.(*CookieJar); ok {
+		c.client.Jar = jar.clone()
+	} else {
+		c.client.Jar = r.client.Jar
+	}
+	c.bandwidth.down.setRate(r.bandwidth.down.getRate())
+	c.bandwidth.up.setRate(r.bandwidth.up.getRate())
+
+	c.hostTLS = maps.Clone(r.hostTLS)
+	for host, cfg := range c.hostTLS {
+		c.hostTLS[host] = cfg.Clone()
+	}
+	c.hostCerts = maps.Clone(r.hostCerts)
+	c.sniOverrides = maps.Clone(r.sniOverrides)
+	c.hostOverrides = maps.Clone(r.hostOverrides)
+	c.fingerprint = r.fingerprint
+	c.echEnabled = r.echEnabled
+	c.echDNSServer = r.echDNSServer
+	c.onTLSState = r.onTLSState
+
+	c.http2Enabled = r.http2Enabled
+	c.http2Settings = r.http2Settings
+	c.h2cHosts = maps.Clone(r.h2cHosts)
+	c.proxyHTTP2 = r.proxyHTTP2
+
+	c.masqueTemplate = r.masqueTemplate
+	c.resolver = r.resolver
+	if r.dnsCache != nil {
+		c.dnsCache = newDNSCache()
+		r.dnsCache.mu.Lock()
+		c.dnsCache.ttl, c.dnsCache.negativeTTL = r.dnsCache.ttl, r.dnsCache.negativeTTL
+		r.dnsCache.mu.Unlock()
+	}
+	c.ipPolicy = r.ipPolicy
+	c.localIP = slices.Clone(r.localIP)
+	c.iface = r.iface
+	c.fallbackDelay = r.fallbackDelay
+	c.dialFunc = r.dialFunc
+	if r.keepAlive != nil {
+		keepAlive := *r.keepAlive
+		c.keepAlive = &keepAlive
+	}
+	c.nagle = r.nagle
+	c.ssrfGuard = r.ssrfGuard
+	c.dialTimeout = r.dialTimeout
+	c.tlsHandshakeTimeout = r.tlsHandshakeTimeout
+	c.router = r.router
+	c.flowExporter = r.flowExporter
+
+	// SOCKS5拨号器绑定了所属的客户端，按原始地址重新创建
+	c.proxyUrl = r.proxyUrl
+	c.httpProxy = cloneURL(r.httpProxy)
+	c.socksProxy = cloneURL(r.socksProxy)
+	if r.socksDialer != nil {
+		c.socksDialer, _ = newSOCKS5Dialer(c, c.socksProxy)
+	}
+	nct.stats.setCurrent(r.proxyUrl)
+	return c
+}
+
+// cloneURL 复制URL及其中的用户信息，u为nil时返回nil
+func cloneURL(u *url.URL) *url.URL {
+	if u == nil {
+		return nil
+	}
+	u2 := *u
+	if u.User != nil {
+		u2.User = new(url.Userinfo)
+		*u2.User = *u.User
+	}
+	return &u2
+}
@@ -0,0 +1,59 @@
+package goproxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestGoProxy_Clone(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Header.Get("X-Token"))
+	}))
+	defer target.Close()
+	proxySrv, _ := newTestProxy(t)
+
+	c := New()
+	c.SetGlobalHeader("X-Token", "abc")
+	c.SetTimeout(5 * time.Second)
+	c.SetSNIOverride("example.com", "front.example.com")
+	c.SetBandwidthLimit(1<<20, 0)
+	c.SetDialTimeout(time.Second)
+	if err := c.SetProxy(proxySrv.URL); err != nil {
+		t.Fatal(err)
+	}
+
+	c2 := c.Clone()
+	if c2.GetTimeout() != 5*time.Second || c2.String() != c.String() {
+		t.Errorf("超时或代理未复制: %v %s", c2.GetTimeout(), c2.String())
+	}
+	if down, _ := c2.GetBandwidthLimit(); down != 1<<20 {
+		t.Errorf("带宽限制为%d", down)
+	}
+	resp, err := c2.GetClient().Get(target.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "abc" || resp.Header.Get("X-Via-Proxy") != "1" {
+		t.Errorf("克隆的客户端响应为%q, 经过代理: %v", body, resp.Header.Get("X-Via-Proxy") == "1")
+	}
+
+	// 修改克隆的客户端不影响原客户端
+	c2.SetGlobalHeader("X-Token", "def")
+	c2.SetSNIOverride("example.com", "")
+	c2.SetTimeout(time.Second)
+	if err := c2.SetProxy(""); err != nil {
+		t.Fatal(err)
+	}
+	if c.GetGlobalHeaders().Get("X-Token") != "abc" || c.sniOverrides["example.com"] != "front.example.com" ||
+		c.GetTimeout() != 5*time.Second || c.String() == "" {
+		t.Error("修改克隆的客户端影响了原客户端")
+	}
+	if c.GetTransport() == c2.GetTransport() {
+		t.Error("克隆的客户端不应共享Transport")
+	}
+}
@@ -0,0 +1,38 @@
+package goproxy
+
+import (
+	"errors"
+)
+
+// ErrClosed 客户端调用Close后继续发送请求或建立连接时返回的错误
+var ErrClosed = errors.New("客户端已关闭")
+
+// Close 关闭客户端: 关闭所有空闲连接(包括DoH解析器的连接)，清空DNS和ECH缓存，将Cookie写入SetCookieFile指定的文件，
+// 此后的请求和连接都返回ErrClosed。正在进行的请求不受影响，其连接在请求结束后关闭。重复调用是安全的
+func (r *GoProxy) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ct := r.transport
+	if ct.closed.Swap(true) {
+		return nil
+	}
+	// 关闭后不再保留连接，正在使用的连接在请求结束后直接关闭。
+	// Transport可能正在使用中，不能修改其DisableKeepAlives
+	ct.conns.closeAfterUse()
+	r.closeIdleConns()
+	if r.dnsCache != nil {
+		r.dnsCache.clear()
+	}
+	r.ech.clear()
+	// DoH解析器有自己的连接池
+	if c, ok := r.resolver.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+	if r.echDoH != nil {
+		r.echDoH.CloseIdleConnections()
+	}
+	if jar, ok := r.client.Jar.(*CookieJar); ok {
+		return jar.Flush()
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package goproxy
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGoProxy_Close(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer srv.Close()
+
+	c := New()
+	if got := getBody(t, c, srv.URL); got != "ok" {
+		t.Fatalf("响应为%q", got)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Close(); err != nil {
+		t.Error("重复关闭不应返回错误")
+	}
+	if _, err := c.GetClient().Get(srv.URL); !errors.Is(err, ErrClosed) {
+		t.Errorf("关闭后请求返回%v", err)
+	}
+	if _, err := c.DialUDP(t.Context(), "127.0.0.1:53"); !errors.Is(err, ErrClosed) {
+		t.Errorf("关闭后建立连接返回%v", err)
+	}
+}
+
+func TestGoProxy_CloseInFlight(t *testing.T) {
+	release := make(chan struct{})
+	connClosed := make(chan struct{})
+	var once sync.Once
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.(http.Flusher).Flush()
+		<-release
+		io.WriteString(w, "ok")
+	}))
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateClosed {
+			once.Do(func() { close(connClosed) })
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+
+	c := New()
+	resp, err := c.GetClient().Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	close(release)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil || string(body) != "ok" {
+		t.Fatalf("关闭时进行中的请求读取到%q，错误为%v", body, err)
+	}
+	// 请求结束后连接被关闭而不是放回连接池
+	select {
+	case <-connClosed:
+	case <-time.After(5 * time.Second):
+		t.Error("请求结束后连接没有关闭")
+	}
+}
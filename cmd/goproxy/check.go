@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fasnow/goproxy"
+)
+
+// runCheck 检测每个代理各一次，有代理不可用时退出码为1
+func runCheck(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := newFlagSet("check", "[选项] 代理...", stderr)
+	var cf clientFlags
+	cf.register(fs, false)
+	target := fs.String("url", goproxy.DefaultCheckURL, "检测访问的地址")
+	asJSON := fs.Bool("json", false, "每行输出一个JSON格式的检测结果")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errUsage
+	}
+	c, err := cf.newClient()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	results := checkAll(c, fs.Args(), *target, 1, len(fs.Args()))
+	enc := json.NewEncoder(stdout)
+	tw := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	failed := false
+	for _, rs := range results {
+		res := rs[0]
+		failed = failed || !res.OK
+		switch {
+		case *asJSON:
+			enc.Encode(res)
+		case res.OK:
+			fmt.Fprintf(tw, "OK\t%d\t%s\t%s\n", res.Status, formatMs(res.LatencyMs), res.Proxy)
+		default:
+			fmt.Fprintf(tw, "FAIL\t-\t%s\t%s: %s\n", formatMs(res.LatencyMs), res.Proxy, res.Error)
+		}
+	}
+	tw.Flush()
+	if failed {
+		return exitError(1)
+	}
+	return nil
+}
+
+// benchResult 一个代理多轮检测的汇总结果
+type benchResult struct {
+	Proxy        string  `json:"proxy"`
+	Rounds       int     `json:"rounds"`
+	Successes    int     `json:"successes"`
+	AvgLatencyMs float64 `json:"avg_latency_ms"` // 成功检测的平均延迟
+	MinLatencyMs float64 `json:"min_latency_ms"` // 成功检测的最低延迟
+	LastError    string  `json:"last_error,omitempty"`
+}
+
+// runBench 对列表中的代理各检测rounds轮，按成功次数从多到少、平均延迟从低到高输出
+func runBench(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := newFlagSet("bench", "[选项] 列表文件(每行一个代理，#开头为注释，-表示标准输入)", stderr)
+	var cf clientFlags
+	cf.register(fs, false)
+	target := fs.String("url", goproxy.DefaultCheckURL, "检测访问的地址")
+	rounds := fs.Int("n", 3, "每个代理的检测次数")
+	concurrency := fs.Int("c", 16, "同时检测的代理数")
+	asJSON := fs.Bool("json", false, "输出JSON格式的结果")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 || *rounds <= 0 || *concurrency <= 0 {
+		fs.Usage()
+		return errUsage
+	}
+	proxies, err := readProxyList(fs.Arg(0), stdin)
+	if err != nil {
+		return err
+	}
+	if len(proxies) == 0 {
+		return fmt.Errorf("%s中没有代理", fs.Arg(0))
+	}
+	c, err := cf.newClient()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	results := make([]benchResult, len(proxies))
+	for i, rs := range checkAll(c, proxies, *target, *rounds, *concurrency) {
+		results[i] = summarize(rs)
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.Successes != b.Successes {
+			return a.Successes > b.Successes
+		}
+		return a.AvgLatencyMs < b.AvgLatencyMs
+	})
+	if *asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(results)
+	}
+	tw := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "成功\t平均延迟\t最低延迟\t代理\t最近错误")
+	for _, r := range results {
+		avg, fastest := "-", "-"
+		if r.Successes > 0 {
+			avg, fastest = formatMs(r.AvgLatencyMs), formatMs(r.MinLatencyMs)
+		}
+		fmt.Fprintf(tw, "%d/%d\t%s\t%s\t%s\t%s\n", r.Successes, r.Rounds, avg, fastest, r.Proxy, r.LastError)
+	}
+	return tw.Flush()
+}
+
+// checkAll 以最多concurrency个并发对每个代理依次检测rounds轮，返回的结果与proxies顺序相同
+func checkAll(c *goproxy.GoProxy, proxies []string, target string, rounds, concurrency int) [][]goproxy.ProxyCheck {
+	results := make([][]goproxy.ProxyCheck, len(proxies))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, proxy := range proxies {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			for range rounds {
+				results[i] = append(results[i], c.CheckProxy(context.Background(), proxy, target))
+			}
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// summarize 汇总一个代理的多轮检测结果
+func summarize(checks []goproxy.ProxyCheck) benchResult {
+	r := benchResult{Proxy: checks[0].Proxy, Rounds: len(checks)}
+	var total float64
+	for _, c := range checks {
+		if !c.OK {
+			r.LastError = c.Error
+			continue
+		}
+		if r.Successes == 0 || c.LatencyMs < r.MinLatencyMs {
+			r.MinLatencyMs = c.LatencyMs
+		}
+		r.Successes++
+		total += c.LatencyMs
+	}
+	if r.Successes > 0 {
+		r.AvgLatencyMs = total / float64(r.Successes)
+	}
+	return r
+}
+
+// readProxyList 读取代理列表，忽略空行和#开头的注释，name为-时读取标准输入
+func readProxyList(name string, stdin io.Reader) ([]string, error) {
+	r := stdin
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	var proxies []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			proxies = append(proxies, line)
+		}
+	}
+	return proxies, scanner.Err()
+}
+
+// formatMs 将毫秒数格式化为易读的耗时
+func formatMs(ms float64) string {
+	return time.Duration(ms * float64(time.Millisecond)).Round(time.Millisecond).String()
+}
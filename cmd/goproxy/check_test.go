@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestProxies 返回一个对所有请求返回204的HTTP代理和一个无法连接的代理地址
+func newTestProxies(t *testing.T) (good, bad string) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(srv.Close)
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	bad = "http://" + ln.Addr().String()
+	ln.Close()
+	return srv.URL, bad
+}
+
+func TestRun_Check(t *testing.T) {
+	good, bad := newTestProxies(t)
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"check", "-url", "http://check.test/", good}, nil, &stdout, &stderr); code != 0 {
+		t.Fatalf("退出码为%d: %s", code, stderr.String())
+	}
+	if !strings.HasPrefix(stdout.String(), "OK  204") || !strings.Contains(stdout.String(), good) {
+		t.Errorf("输出为%q", stdout.String())
+	}
+
+	stdout.Reset()
+	if code := run([]string{"check", "-json", "-url", "http://check.test/", good, bad}, nil, &stdout, &stderr); code != 1 {
+		t.Errorf("有代理不可用时退出码为%d", code)
+	}
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	var res struct {
+		Proxy string `json:"proxy"`
+		OK    bool   `json:"ok"`
+	}
+	if len(lines) != 2 || json.Unmarshal([]byte(lines[1]), &res) != nil || res.Proxy != bad || res.OK {
+		t.Errorf("JSON输出为%q", stdout.String())
+	}
+	if code := run([]string{"check"}, nil, &stdout, &stderr); code != 2 {
+		t.Errorf("没有指定代理时退出码为%d", code)
+	}
+}
+
+func TestRun_Bench(t *testing.T) {
+	good, bad := newTestProxies(t)
+	list := filepath.Join(t.TempDir(), "list.txt")
+	os.WriteFile(list, []byte("# 代理列表\n"+bad+"\n\n"+good+"\n"), 0o644)
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"bench", "-n", "2", "-json", "-url", "http://check.test/", list}, nil, &stdout, &stderr); code != 0 {
+		t.Fatalf("退出码为%d: %s", code, stderr.String())
+	}
+	var results []benchResult
+	if err := json.Unmarshal(stdout.Bytes(), &results); err != nil {
+		t.Fatal(err)
+	}
+	// 可用的代理排在前面
+	if len(results) != 2 || results[0].Proxy != good || results[0].Successes != 2 || results[1].Successes != 0 || results[1].LastError == "" {
+		t.Errorf("结果为%+v", results)
+	}
+
+	// 从标准输入读取列表
+	stdout.Reset()
+	if code := run([]string{"bench", "-n", "1", "-url", "http://check.test/", "-"}, strings.NewReader(good+"\n"), &stdout, &stderr); code != 0 {
+		t.Fatalf("退出码为%d: %s", code, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "1/1") {
+		t.Errorf("输出为%q", stdout.String())
+	}
+}
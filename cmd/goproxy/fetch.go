@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+)
+
+// headerFlag 可重复指定的-H选项
+type headerFlag []string
+
+func (h *headerFlag) String() string {
+	return strings.Join(*h, ", ")
+}
+
+func (h *headerFlag) Set(v string) error {
+	if !strings.Contains(v, ":") {
+		return fmt.Errorf("请求头%q应为\"名称: 值\"的格式", v)
+	}
+	*h = append(*h, v)
+	return nil
+}
+
+// runFetch 通过代理发送一个请求，响应体写入标准输出或-o指定的文件
+func runFetch(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := newFlagSet("fetch", "[选项] URL", stderr)
+	var cf clientFlags
+	cf.register(fs, true)
+	method := fs.String("X", "", "请求方法，默认为GET，指定-d时为POST")
+	var headers headerFlag
+	fs.Var(&headers, "H", "请求头，如\"Accept: application/json\"，可重复指定")
+	data := fs.String("d", "", "请求体，以@开头时读取文件，@-表示标准输入")
+	userAgent := fs.String("A", "", "User-Agent")
+	output := fs.String("o", "", "将响应体写入文件")
+	include := fs.Bool("i", false, "输出响应头")
+	head := fs.Bool("I", false, "只请求响应头(HEAD)")
+	follow := fs.Bool("L", false, "跟随重定向")
+	fail := fs.Bool("f", false, "状态码大于等于400时不输出响应体，退出码为22")
+	verbose := fs.Bool("v", false, "在标准错误输出请求行、请求头和响应状态")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errUsage
+	}
+	c, err := cf.newClient()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if *follow {
+		c.SetMaxRedirects(10)
+	}
+
+	var body io.Reader
+	if *data != "" {
+		body, err = openData(*data, stdin)
+		if err != nil {
+			return err
+		}
+	}
+	m := *method
+	switch {
+	case m != "":
+		m = strings.ToUpper(m)
+	case *head:
+		m = http.MethodHead
+	case body != nil:
+		m = http.MethodPost
+	default:
+		m = http.MethodGet
+	}
+	req, err := http.NewRequestWithContext(context.Background(), m, fs.Arg(0), body)
+	if err != nil {
+		return err
+	}
+	for _, h := range headers {
+		name, value, _ := strings.Cut(h, ":")
+		req.Header.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+	if *userAgent != "" {
+		req.Header.Set("User-Agent", *userAgent)
+	}
+	if body != nil && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	if *verbose {
+		fmt.Fprintf(stderr, "> %s %s\n", req.Method, req.URL.RequestURI())
+		fmt.Fprintf(stderr, "> Host: %s\n", req.URL.Host)
+		writeHeader(stderr, "> ", req.Header)
+		if cf.proxy != "" {
+			fmt.Fprintf(stderr, "* 代理: %s\n", c.String())
+		}
+	}
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if *verbose {
+		fmt.Fprintf(stderr, "< %s %s\n", resp.Proto, resp.Status)
+		writeHeader(stderr, "< ", resp.Header)
+	}
+	if *fail && resp.StatusCode >= 400 {
+		fmt.Fprintf(stderr, "goproxy fetch: 服务器返回%s\n", resp.Status)
+		return exitError(22)
+	}
+	if *include || *head {
+		fmt.Fprintf(stdout, "%s %s\n", resp.Proto, resp.Status)
+		writeHeader(stdout, "", resp.Header)
+		fmt.Fprintln(stdout)
+	}
+	if *head {
+		return nil
+	}
+	if *output == "" {
+		_, err = io.Copy(stdout, resp.Body)
+		return err
+	}
+	f, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// openData 按-d的值返回请求体
+func openData(data string, stdin io.Reader) (io.Reader, error) {
+	name, ok := strings.CutPrefix(data, "@")
+	if !ok {
+		return strings.NewReader(data), nil
+	}
+	if name == "-" {
+		return stdin, nil
+	}
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(b), nil
+}
+
+// writeHeader 按名称排序输出请求头或响应头，每行以prefix开头
+func writeHeader(w io.Writer, prefix string, h http.Header) {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range h[k] {
+			fmt.Fprintf(w, "%s%s: %s\n", prefix, k, v)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRun_Fetch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/redirect":
+			http.Redirect(w, r, "/echo", http.StatusFound)
+			return
+		case "/missing":
+			http.NotFound(w, r)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Method", r.Method)
+		io.WriteString(w, r.Header.Get("X-Test")+"|"+r.UserAgent()+"|"+string(body))
+	}))
+	defer srv.Close()
+
+	fetch := func(args ...string) (int, string) {
+		t.Helper()
+		var stdout, stderr bytes.Buffer
+		code := run(append([]string{"fetch"}, args...), strings.NewReader("stdin"), &stdout, &stderr)
+		return code, stdout.String()
+	}
+	if code, out := fetch("-H", "X-Test: 1", "-A", "cli", srv.URL+"/echo"); code != 0 || out != "1|cli|" {
+		t.Errorf("GET的退出码为%d，输出为%q", code, out)
+	}
+	if code, out := fetch("-i", "-d", "a=1", srv.URL+"/echo"); code != 0 || !strings.HasPrefix(out, "HTTP/1.1 200 OK\n") ||
+		!strings.Contains(out, "X-Method: POST\n") || !strings.HasSuffix(out, "|a=1") {
+		t.Errorf("POST的退出码为%d，输出为%q", code, out)
+	}
+	if code, out := fetch("-X", "put", "-d", "@-", srv.URL+"/echo"); code != 0 || !strings.HasSuffix(out, "|stdin") {
+		t.Errorf("从标准输入读取请求体时退出码为%d，输出为%q", code, out)
+	}
+	if _, out := fetch(srv.URL + "/redirect"); !strings.Contains(out, "Found") {
+		t.Errorf("不跟随重定向时输出为%q", out)
+	}
+	if _, out := fetch("-L", srv.URL+"/redirect"); !strings.HasPrefix(out, "|") {
+		t.Errorf("跟随重定向时输出为%q", out)
+	}
+	if code, out := fetch("-f", srv.URL+"/missing"); code != 22 || out != "" {
+		t.Errorf("-f时退出码为%d，输出为%q", code, out)
+	}
+	if code, _ := fetch("http://127.0.0.1:1/"); code != 1 {
+		t.Errorf("请求失败时退出码为%d", code)
+	}
+
+	out := filepath.Join(t.TempDir(), "out")
+	if code, _ := fetch("-o", out, "-H", "X-Test: file", srv.URL+"/echo"); code != 0 {
+		t.Fatalf("-o时退出码为%d", code)
+	}
+	if b, _ := os.ReadFile(out); !strings.HasPrefix(string(b), "file|") {
+		t.Errorf("写入文件的内容为%q", b)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/fasnow/goproxy/cassette"
+)
+
+// runFixture 将HAR文件或磁带转换为Go测试桩源码，输出到-o指定的文件或标准输出
+func runFixture(args []string, _ io.Reader, stdout, stderr io.Writer) error {
+	fs := newFlagSet("fixture", "[选项] HAR或磁带文件", stderr)
+	var opts cassette.FixtureOptions
+	fs.StringVar((*string)(&opts.Style), "style", string(cassette.FixtureMock), "生成的形式: mock(注册到mock.Transport)或httptest(返回http.Handler)")
+	fs.StringVar(&opts.Package, "package", "fixtures", "生成代码的包名")
+	fs.StringVar(&opts.Func, "func", "", "生成的函数名，默认mock形式为RegisterFixtures，httptest形式为FixtureHandler")
+	drop := fs.String("drop", "", "额外去掉的响应头，逗号分隔，如Set-Cookie,Server")
+	output := fs.String("o", "", "输出文件，默认输出到标准输出")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errUsage
+	}
+	for _, h := range strings.Split(*drop, ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			opts.DropHeaders = append(opts.DropHeaders, h)
+		}
+	}
+	c, err := cassette.Load(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	src, err := c.GenerateFixtures(opts)
+	if err != nil {
+		return err
+	}
+	if *output == "" {
+		_, err = stdout.Write(src)
+		return err
+	}
+	if err := os.WriteFile(*output, src, 0o644); err != nil {
+		return err
+	}
+	fmt.Fprintf(stderr, "已生成%d条测试桩: %s\n", len(c.Interactions), *output)
+	return nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRun_Fixture(t *testing.T) {
+	dir := t.TempDir()
+	har := filepath.Join(dir, "session.har")
+	os.WriteFile(har, []byte(`{"log":{"entries":[{"request":{"method":"GET","url":"https://example.com/a?b=1","headers":[]},
+		"response":{"status":200,"headers":[{"name":"Server","value":"nginx"},{"name":"Content-Type","value":"text/plain"}],"content":{"text":"hello"}}}]}}`), 0o644)
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"fixture", "-style", "httptest", "-package", "apitest", "-drop", "Server", har}, nil, &stdout, &stderr); code != 0 {
+		t.Fatalf("退出码为%d: %s", code, stderr.String())
+	}
+	out := stdout.String()
+	if !strings.Contains(out, "package apitest") || !strings.Contains(out, "func FixtureHandler() http.Handler") ||
+		!strings.Contains(out, `"/a?b=1"`) || !strings.Contains(out, `"hello"`) || strings.Contains(out, "nginx") {
+		t.Errorf("输出为%s", out)
+	}
+
+	dst := filepath.Join(dir, "fixtures.go")
+	if code := run([]string{"fixture", "-o", dst, har}, nil, &stdout, &stderr); code != 0 {
+		t.Fatalf("退出码为%d: %s", code, stderr.String())
+	}
+	if src, _ := os.ReadFile(dst); !bytes.Contains(src, []byte("func RegisterFixtures(t *mock.Transport)")) {
+		t.Errorf("生成的文件为%s", src)
+	}
+
+	if code := run([]string{"fixture", "-style", "gomock", har}, nil, &stdout, &stderr); code != 1 {
+		t.Errorf("形式无效时退出码为%d", code)
+	}
+	if code := run([]string{"fixture"}, nil, &stdout, &stderr); code != 2 {
+		t.Errorf("没有参数时退出码为%d", code)
+	}
+}
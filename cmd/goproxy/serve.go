@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fasnow/goproxy"
+	"github.com/fasnow/goproxy/admin"
+	"github.com/fasnow/goproxy/server"
+)
+
+// runServe 运行本地代理服务器，收到SIGINT或SIGTERM时优雅关闭
+func runServe(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return serve(ctx, args, stdout, stderr)
+}
+
+// serve 监听各地址并服务到ctx结束或某个服务出错
+func serve(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("serve", "[选项]", stderr)
+	var cf clientFlags
+	cf.register(fs, true)
+	httpAddr := fs.String("http", "", "HTTP代理的监听地址，如127.0.0.1:8080")
+	socksAddr := fs.String("socks", "", "SOCKS5代理的监听地址，如127.0.0.1:1080")
+	auth := fs.String("auth", "", "要求客户端认证，格式为user:pass")
+	routerFile := fs.String("rules", "", "规则路由的YAML文件，见goproxy.ParseRouter")
+	adminAddr := fs.String("admin", "", "管理接口和状态页面的监听地址，如127.0.0.1:9090")
+	adminToken := fs.String("admin-token", "", "管理接口的令牌")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *httpAddr == "" && *socksAddr == "" {
+		fmt.Fprintln(stderr, "至少需要指定-http或-socks")
+		fs.Usage()
+		return errUsage
+	}
+	c, err := cf.newClient()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if *routerFile != "" {
+		rt, err := goproxy.LoadRouterFile(*routerFile)
+		if err != nil {
+			return err
+		}
+		c.SetRouter(rt)
+	}
+	var opts []server.Option
+	if *auth != "" {
+		user, pass, ok := strings.Cut(*auth, ":")
+		if !ok {
+			return errors.New("-auth应为user:pass的格式")
+		}
+		opts = append(opts, server.WithAuth(user, pass))
+	}
+	srv := server.New(c, opts...)
+	defer srv.Close()
+
+	errc := make(chan error, 3)
+	listen := func(name, addr string, serveFn func(net.Listener) error) error {
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "%s监听于%s\n", name, ln.Addr())
+		go func() { errc <- serveFn(ln) }()
+		return nil
+	}
+	if *httpAddr != "" {
+		if err := listen("HTTP代理", *httpAddr, srv.Serve); err != nil {
+			return err
+		}
+	}
+	if *socksAddr != "" {
+		if err := listen("SOCKS5代理", *socksAddr, srv.ServeSOCKS5); err != nil {
+			return err
+		}
+	}
+	if *adminAddr != "" {
+		var adminOpts []admin.Option
+		if *adminToken != "" {
+			adminOpts = append(adminOpts, admin.WithToken(*adminToken))
+		}
+		adminSrv := &http.Server{Handler: admin.New(c, adminOpts...), ReadHeaderTimeout: 10 * time.Second}
+		defer adminSrv.Close()
+		if err := listen("管理接口", *adminAddr, adminSrv.Serve); err != nil {
+			return err
+		}
+	}
+
+	select {
+	case <-ctx.Done():
+	case err := <-errc:
+		if !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return srv.Shutdown(shutdownCtx)
+}
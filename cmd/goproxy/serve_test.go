@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer 可在多个goroutine中读写的缓冲区
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestServe(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer target.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var stdout, stderr syncBuffer
+	done := make(chan error, 1)
+	go func() {
+		done <- serve(ctx, []string{"-http", "127.0.0.1:0", "-socks", "127.0.0.1:0", "-admin", "127.0.0.1:0", "-auth", "user:pass"}, &stdout, &stderr)
+	}()
+	addrs := map[string]string{}
+	re := regexp.MustCompile(`(\S+)监听于(\S+)`)
+	for deadline := time.Now().Add(5 * time.Second); len(addrs) < 3 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+		for _, m := range re.FindAllStringSubmatch(stdout.String(), -1) {
+			addrs[m[1]] = m[2]
+		}
+	}
+	if len(addrs) != 3 {
+		t.Fatalf("输出为%q，错误输出为%q", stdout.String(), stderr.String())
+	}
+
+	for _, proxy := range []string{"http://user:pass@" + addrs["HTTP代理"], "socks5://user:pass@" + addrs["SOCKS5代理"]} {
+		var out, errOut bytes.Buffer
+		if code := run([]string{"fetch", "-x", proxy, target.URL}, nil, &out, &errOut); code != 0 || out.String() != "ok" {
+			t.Errorf("通过%s请求的退出码为%d，输出为%q，错误为%q", proxy, code, out.String(), errOut.String())
+		}
+	}
+	resp, err := http.Get("http://" + addrs["管理接口"] + "/api/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), `"in_flight"`) {
+		t.Errorf("管理接口的响应为%q", body)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("关闭时返回%v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("取消后没有退出")
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/fasnow/goproxy"
+)
+
+// runValidate 检查配置文件(包括GOPROXY_CLIENT_开头的环境变量的覆盖)，每个文件输出OK或逐行列出错误，有文件无效时退出码为1
+func runValidate(args []string, _ io.Reader, stdout, stderr io.Writer) error {
+	fs := newFlagSet("validate", "配置文件...", stderr)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errUsage
+	}
+	failed := false
+	for _, path := range fs.Args() {
+		cfg, err := goproxy.LoadConfig(path)
+		if err == nil {
+			err = cfg.LoadEnv()
+		}
+		if err == nil {
+			err = cfg.Validate()
+		}
+		if err == nil {
+			fmt.Fprintf(stdout, "OK   %s\n", path)
+			continue
+		}
+		failed = true
+		var verr *goproxy.ValidationError
+		if !errors.As(err, &verr) {
+			fmt.Fprintf(stdout, "FAIL %s: %v\n", path, err)
+			continue
+		}
+		fmt.Fprintf(stdout, "FAIL %s: %d处错误\n", path, len(verr.Problems))
+		for _, p := range verr.Problems {
+			fmt.Fprintf(stdout, "  %s\n", p)
+		}
+	}
+	if failed {
+		return exitError(1)
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRun_Validate(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good.yaml")
+	bad := filepath.Join(dir, "bad.yaml")
+	os.WriteFile(good, []byte("proxy: http://127.0.0.1:8080\n"), 0o644)
+	os.WriteFile(bad, []byte("proxy: ftp://127.0.0.1\ntimeouts:\n  request: -1s\n"), 0o644)
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"validate", good}, nil, &stdout, &stderr); code != 0 {
+		t.Fatalf("退出码为%d: %s%s", code, stdout.String(), stderr.String())
+	}
+	stdout.Reset()
+	if code := run([]string{"validate", good, bad}, nil, &stdout, &stderr); code != 1 {
+		t.Errorf("配置无效时退出码为%d", code)
+	}
+	out := stdout.String()
+	if !strings.Contains(out, "OK   "+good) || !strings.Contains(out, "FAIL "+bad+": 2处错误") ||
+		!strings.Contains(out, "  proxy: ") || !strings.Contains(out, "  timeouts.request: ") {
+		t.Errorf("输出为%q", out)
+	}
+	if code := run([]string{"validate"}, nil, &stdout, &stderr); code != 2 {
+		t.Errorf("没有参数时退出码为%d", code)
+	}
+}
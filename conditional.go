@@ -0,0 +1,17 @@
+package goproxy
+
+import "net/http"
+
+// NewConditionalTransport 创建条件请求中间件，适用于轮询不常变化的资源:
+// 按地址记住状态码为200的响应的ETag和Last-Modified以及响应体，之后的每个GET请求都带上If-None-Match和If-Modified-Since，
+// 服务器返回304时返回记住的响应体(状态码为200)，不再重复下载。
+// 与NewCacheTransport不同，不论响应的新鲜度如何都会向服务器验证，不会返回未经服务器确认的内容；
+// 不带验证器或带有no-store的响应不保存，请求本身带有条件请求头时不处理
+// 参数:
+//   - store: 保存验证器和响应体的存储
+//   - next: 实际发送请求的RoundTripper，为nil时使用http.DefaultTransport
+func NewConditionalTransport(store CacheStorage, next http.RoundTripper) *CacheTransport {
+	t := NewCacheTransport(store, next)
+	t.revalidate = true
+	return t
+}
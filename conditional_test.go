@@ -0,0 +1,68 @@
+package goproxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestConditionalTransport(t *testing.T) {
+	var version, full, notModified atomic.Int32
+	version.Store(1)
+	modified := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 即使响应允许缓存，条件请求模式也每次验证
+		w.Header().Set("Cache-Control", "max-age=3600")
+		if r.URL.Path == "/etag" {
+			etag := fmt.Sprintf(`"v%d"`, version.Load())
+			w.Header().Set("ETag", etag)
+			if r.Header.Get("If-None-Match") == etag {
+				notModified.Add(1)
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		} else {
+			w.Header().Set("Last-Modified", modified.Format(http.TimeFormat))
+			if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !modified.After(since) {
+				notModified.Add(1)
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+		full.Add(1)
+		fmt.Fprintf(w, "v%d", version.Load())
+	}))
+	defer srv.Close()
+
+	c := New()
+	cond := NewConditionalTransport(NewLRUCache(1<<20), c.GetTransport())
+	c.SetTransport(cond)
+	body := func(path string) string {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+		return doBody(t, c, req)
+	}
+	for i := 0; i < 3; i++ {
+		if got := body("/etag"); got != "v1" {
+			t.Errorf("第%d次响应为%q", i, got)
+		}
+	}
+	if full.Load() != 1 || notModified.Load() != 2 {
+		t.Errorf("完整响应%d次, 304响应%d次", full.Load(), notModified.Load())
+	}
+	version.Store(2)
+	if got := body("/etag"); got != "v2" || full.Load() != 2 {
+		t.Errorf("资源变化后响应为%q, 完整响应%d次", got, full.Load())
+	}
+
+	body("/modified")
+	if got := body("/modified"); got != "v2" || notModified.Load() != 3 {
+		t.Errorf("按Last-Modified验证的响应为%q, 304响应%d次", got, notModified.Load())
+	}
+	if stats := cond.Stats(); stats.Hits != 0 || stats.Revalidated != 3 {
+		t.Errorf("统计为%+v", stats)
+	}
+}
@@ -0,0 +1,472 @@
+package goproxy
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config 声明式的客户端配置，可从YAML、JSON或TOML文件加载，字段为零值时保持客户端的默认设置
+//
+//	proxy: socks5://127.0.0.1:1080
+//	browser: chrome
+//	headers:
+//	  Accept-Language: zh-CN
+//	timeouts:
+//	  request: 30s
+//	  dial: 5s
+//	tls:
+//	  verify: true
+//	retry:
+//	  attempts: 3
+//	rate_limit:
+//	  download_bps: 1048576
+//	upstreams:
+//	  pool: [http://10.0.0.1:8080, http://10.0.0.2:8080]
+//	rules:
+//	  - DOMAIN-SUFFIX,example.com,pool
+//	profile: office
+//	profiles:
+//	  office:
+//	    proxy: http://proxy.office:3128
+//	  tor:
+//	    proxy: socks5://127.0.0.1:9050
+//	    headers:
+//	      Accept-Language: en-US
+type Config struct {
+	Proxy        string                       `yaml:"proxy,omitempty" json:"proxy,omitempty"`                 // 代理，格式见SetProxy
+	Proxies      []string                     `yaml:"proxies,omitempty" json:"proxies,omitempty"`             // 代理池，没有其他规则匹配的连接轮流使用其中的代理
+	Browser      string                       `yaml:"browser,omitempty" json:"browser,omitempty"`             // 浏览器身份: chrome、safari或firefox，见SetProfile
+	Headers      map[string]string            `yaml:"headers,omitempty" json:"headers,omitempty"`             // 全局请求头
+	HostHeaders  map[string]map[string]string `yaml:"host_headers,omitempty" json:"host_headers,omitempty"`   // 按主机设置的请求头，见AddHostHeaders
+	UserAgents   []string                     `yaml:"user_agents,omitempty" json:"user_agents,omitempty"`     // 随机轮换的User-Agent
+	Timeouts     TimeoutConfig                `yaml:"timeouts,omitempty" json:"timeouts,omitzero"`            // 超时
+	TLS          TLSConfig                    `yaml:"tls,omitempty" json:"tls,omitzero"`                      // TLS
+	HTTP2        *bool                        `yaml:"http2,omitempty" json:"http2,omitempty"`                 // 是否开启HTTP/2
+	DNS          DNSConfig                    `yaml:"dns,omitempty" json:"dns,omitzero"`                      // 域名解析
+	Retry        RetryPolicyConfig            `yaml:"retry,omitempty" json:"retry,omitzero"`                  // 重试
+	RateLimit    RateLimitConfig              `yaml:"rate_limit,omitempty" json:"rate_limit,omitzero"`        // 带宽限制
+	MaxRedirects int                          `yaml:"max_redirects,omitempty" json:"max_redirects,omitempty"` // 最多跟随的重定向次数
+	MaxBodySize  int64                        `yaml:"max_body_size,omitempty" json:"max_body_size,omitempty"` // 响应体大小上限(字节)
+	Upstreams    map[string][]string          `yaml:"upstreams,omitempty" json:"upstreams,omitempty"`         // 规则路由的上游代理组，见NewRouter
+	Rules        []string                     `yaml:"rules,omitempty" json:"rules,omitempty" env:";"`         // 规则路由的规则，见NewRouter；规则含有逗号，环境变量中以分号分隔
+	Profile      string                       `yaml:"profile,omitempty" json:"profile,omitempty"`             // 默认使用的配置组，见UseProfile
+	Profiles     map[string]*Config           `yaml:"profiles,omitempty" json:"profiles,omitempty"`           // 命名的配置组，使用时覆盖上面的配置，见UseProfile
+}
+
+// TimeoutConfig 超时配置，为0时保持默认
+type TimeoutConfig struct {
+	Request        Duration `yaml:"request,omitempty" json:"request,omitempty"`                 // 整个请求，见SetTimeout
+	Dial           Duration `yaml:"dial,omitempty" json:"dial,omitempty"`                       // 建立连接，见SetDialTimeout
+	TLSHandshake   Duration `yaml:"tls_handshake,omitempty" json:"tls_handshake,omitempty"`     // TLS握手，见SetTLSHandshakeTimeout
+	ResponseHeader Duration `yaml:"response_header,omitempty" json:"response_header,omitempty"` // 等待响应头，见SetResponseHeaderTimeout
+	IdleConn       Duration `yaml:"idle_conn,omitempty" json:"idle_conn,omitempty"`             // 空闲连接保持时间，见SetIdleConnTimeout
+}
+
+// TLSConfig TLS配置
+type TLSConfig struct {
+	Verify      *bool  `yaml:"verify,omitempty" json:"verify,omitempty"`           // 是否校验服务器证书，见SetTLSVerify
+	Fingerprint string `yaml:"fingerprint,omitempty" json:"fingerprint,omitempty"` // TLS指纹，如chrome，优先于browser中的指纹
+	CAFile      string `yaml:"ca_file,omitempty" json:"ca_file,omitempty"`         // 校验服务器证书使用的CA文件
+	CertFile    string `yaml:"cert_file,omitempty" json:"cert_file,omitempty"`     // 双向认证的客户端证书文件
+	KeyFile     string `yaml:"key_file,omitempty" json:"key_file,omitempty"`       // 双向认证的客户端私钥文件
+	MinVersion  string `yaml:"min_version,omitempty" json:"min_version,omitempty"` // 最低TLS版本，如"1.2"
+	MaxVersion  string `yaml:"max_version,omitempty" json:"max_version,omitempty"` // 最高TLS版本，如"1.3"
+}
+
+// DNSConfig 域名解析配置
+type DNSConfig struct {
+	DoH   string            `yaml:"doh,omitempty" json:"doh,omitempty"`     // DNS-over-HTTPS地址，见SetDoH
+	DoT   string            `yaml:"dot,omitempty" json:"dot,omitempty"`     // DNS-over-TLS地址，见SetDoT
+	Cache bool              `yaml:"cache,omitempty" json:"cache,omitempty"` // 是否开启DNS缓存
+	Hosts map[string]string `yaml:"hosts,omitempty" json:"hosts,omitempty"` // 固定解析的主机，见SetHostOverride
+}
+
+// RetryPolicyConfig 重试配置，attempts大于0时安装RetryTransport
+type RetryPolicyConfig struct {
+	Attempts   int      `yaml:"attempts,omitempty" json:"attempts,omitempty"`       // 最多重试的次数
+	Backoff    Duration `yaml:"backoff,omitempty" json:"backoff,omitempty"`         // 第一次重试前的等待时间
+	MaxBackoff Duration `yaml:"max_backoff,omitempty" json:"max_backoff,omitempty"` // 等待时间上限
+	// Statuses 按请求方法可重试的状态码，键为请求方法，"*"为所有方法，如{"*": [502, 522, 524], "GET": [500]}；
+	// 为POST等非幂等方法指定状态码时该方法的请求也按这些状态码重试，见RetryStatusCodes；为空时使用内置的状态码列表，见RetryPolicy.StatusCodes
+	Statuses map[string][]int `yaml:"statuses,omitempty" json:"statuses,omitempty"`
+}
+
+// policy 转换为RetryPolicy
+func (c RetryPolicyConfig) policy() RetryPolicy {
+	p := RetryPolicy{
+		Attempts:   c.Attempts,
+		Backoff:    time.Duration(c.Backoff),
+		MaxBackoff: time.Duration(c.MaxBackoff),
+	}
+	if len(c.Statuses) > 0 {
+		p.StatusCodes = &RetryStatusCodes{}
+		for method, codes := range c.Statuses {
+			if method == "*" {
+				p.StatusCodes.Any = codes
+				continue
+			}
+			if p.StatusCodes.Methods == nil {
+				p.StatusCodes.Methods = make(map[string][]int)
+			}
+			p.StatusCodes.Methods[method] = codes
+		}
+	}
+	return p
+}
+
+// RateLimitConfig 带宽限制配置(字节/秒)，为0时不限制
+type RateLimitConfig struct {
+	DownloadBps int64 `yaml:"download_bps,omitempty" json:"download_bps,omitempty"`
+	UploadBps   int64 `yaml:"upload_bps,omitempty" json:"upload_bps,omitempty"`
+}
+
+// Duration 配置文件中的时长，写作"30s"、"1m30s"等，也可以写作秒数
+type Duration time.Duration
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	s := strings.TrimSpace(string(text))
+	if secs, err := strconv.ParseFloat(s, 64); err == nil {
+		*d = Duration(secs * float64(time.Second))
+		return nil
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("无效的时长%q", s)
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	return d.UnmarshalText(bytes.Trim(data, `"`))
+}
+
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	return d.UnmarshalText([]byte(node.Value))
+}
+
+// ParseConfig 解析配置
+// 参数:
+//   - data: 配置内容
+//   - format: 格式，"yaml"、"json"或"toml"
+func ParseConfig(data []byte, format string) (*Config, error) {
+	var cfg Config
+	switch strings.ToLower(format) {
+	case "yaml", "yml":
+		if err := decodeYAMLConfig(data, &cfg); err != nil {
+			return nil, err
+		}
+	case "json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&cfg); err != nil {
+			return nil, fmt.Errorf("解析配置失败: %w", err)
+		}
+	case "toml":
+		m, err := parseTOML(data)
+		if err != nil {
+			return nil, fmt.Errorf("解析配置失败: %w", err)
+		}
+		// 经YAML转换为结构体，与YAML配置共用字段名和类型转换
+		out, err := yaml.Marshal(m)
+		if err != nil {
+			return nil, fmt.Errorf("解析配置失败: %w", err)
+		}
+		if err := decodeYAMLConfig(out, &cfg); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("不支持的配置格式: %q", format)
+	}
+	return &cfg, nil
+}
+
+// decodeYAMLConfig 解析YAML配置，未知的字段视为错误以发现拼写错误
+func decodeYAMLConfig(data []byte, cfg *Config) error {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("解析配置失败: %w", err)
+	}
+	return nil
+}
+
+// LoadConfig 从文件加载配置，按扩展名(.yaml、.yml、.json、.toml)确定格式
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取配置文件失败: %w", err)
+	}
+	return ParseConfig(data, configFormat(path))
+}
+
+// configFormat 按扩展名返回配置文件格式
+func configFormat(path string) string {
+	return strings.TrimPrefix(filepath.Ext(path), ".")
+}
+
+// NewFromConfig 从配置文件创建客户端，格式见Config和LoadConfig，GOPROXY_CLIENT_开头的环境变量覆盖文件中的配置，见Config.LoadEnv
+func NewFromConfig(path string) (*GoProxy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取配置文件失败: %w", err)
+	}
+	cfg, err := parseConfigFile(path, data)
+	if err != nil {
+		return nil, err
+	}
+	r := New()
+	if err := cfg.Apply(r); err != nil {
+		r.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// browserProfiles Config.Browser可用的浏览器身份
+var browserProfiles = map[string]Profile{
+	ProfileChrome.Name:  ProfileChrome,
+	ProfileSafari.Name:  ProfileSafari,
+	ProfileFirefox.Name: ProfileFirefox,
+}
+
+// Apply 将配置应用到客户端，为零值的字段不修改客户端的设置。应用前先调用Validate，有错误时不修改客户端；
+// 应用时遇到错误返回，此前的设置已经生效。设置了profile时同时应用该配置组，之后可以通过UseProfile切换
+func (c *Config) Apply(r *GoProxy) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	eff, err := c.resolve(c.Profile)
+	if err != nil {
+		return err
+	}
+	if err := eff.apply(r); err != nil {
+		return err
+	}
+	r.config.mu.Lock()
+	r.config.base, r.config.profile, r.config.effective = c, c.Profile, eff
+	r.config.mu.Unlock()
+	return nil
+}
+
+// apply 将合并了配置组的配置应用到客户端
+func (c *Config) apply(r *GoProxy) error {
+	if c.Browser != "" {
+		p, ok := browserProfiles[strings.ToLower(c.Browser)]
+		if !ok {
+			return fmt.Errorf("未知的浏览器身份: %q", c.Browser)
+		}
+		if err := r.SetProfile(p); err != nil {
+			return err
+		}
+	}
+	for k, v := range c.Headers {
+		r.SetGlobalHeader(k, v)
+	}
+	for pattern, headers := range c.HostHeaders {
+		h := make(http.Header, len(headers))
+		for k, v := range headers {
+			h.Set(k, v)
+		}
+		r.AddHostHeaders(pattern, h)
+	}
+	if len(c.UserAgents) > 0 {
+		r.SetUserAgents(c.UserAgents, UARandom)
+	}
+
+	if c.Proxy != "" {
+		if err := r.SetProxy(c.Proxy); err != nil {
+			return err
+		}
+	}
+	rt, err := c.router()
+	if err != nil {
+		return err
+	}
+	if rt != nil {
+		r.SetRouter(rt)
+	}
+
+	if err := c.Timeouts.apply(r); err != nil {
+		return err
+	}
+	if err := c.TLS.apply(r); err != nil {
+		return err
+	}
+	if c.HTTP2 != nil {
+		r.EnableHTTP2(*c.HTTP2)
+	}
+	if err := c.DNS.apply(r); err != nil {
+		return err
+	}
+	if c.RateLimit.DownloadBps != 0 || c.RateLimit.UploadBps != 0 {
+		r.SetBandwidthLimit(c.RateLimit.DownloadBps, c.RateLimit.UploadBps)
+	}
+	if c.MaxRedirects != 0 {
+		r.SetMaxRedirects(c.MaxRedirects)
+	}
+	if c.MaxBodySize != 0 {
+		r.SetMaxBodySize(c.MaxBodySize)
+	}
+	if c.Retry.Attempts > 0 {
+		r.setRetryPolicy(c.Retry.policy())
+	}
+	return nil
+}
+
+// poolGroup Config.Proxies在规则路由中的上游组名
+const poolGroup = "pool"
+
+// router 按upstreams、rules和proxies创建规则路由，都为空时返回nil
+// proxies作为名为pool的上游组，并追加一条FINAL规则使其他规则没有匹配的连接轮流使用
+func (c *Config) router() (*Router, error) {
+	if len(c.Rules) == 0 && len(c.Proxies) == 0 {
+		return nil, nil
+	}
+	upstreams := make(map[string][]string, len(c.Upstreams)+1)
+	for name, proxies := range c.Upstreams {
+		upstreams[name] = proxies
+	}
+	rules := c.Rules
+	if len(c.Proxies) > 0 {
+		if _, ok := upstreams[poolGroup]; ok {
+			return nil, fmt.Errorf("上游组名%s与proxies冲突", poolGroup)
+		}
+		upstreams[poolGroup] = c.Proxies
+		rules = append(append([]string(nil), rules...), "FINAL,"+poolGroup)
+	}
+	return NewRouter(upstreams, rules)
+}
+
+func (t TimeoutConfig) apply(r *GoProxy) error {
+	if t.Request > 0 {
+		r.SetTimeout(time.Duration(t.Request))
+	}
+	if t.Dial > 0 {
+		r.SetDialTimeout(time.Duration(t.Dial))
+	}
+	if t.TLSHandshake > 0 {
+		r.SetTLSHandshakeTimeout(time.Duration(t.TLSHandshake))
+	}
+	if t.ResponseHeader > 0 {
+		r.SetResponseHeaderTimeout(time.Duration(t.ResponseHeader))
+	}
+	if t.IdleConn > 0 {
+		r.SetIdleConnTimeout(time.Duration(t.IdleConn))
+	}
+	return nil
+}
+
+func (t TLSConfig) apply(r *GoProxy) error {
+	if t.Verify != nil {
+		r.SetTLSVerify(*t.Verify)
+	}
+	if t.Fingerprint != "" {
+		if err := r.SetTLSFingerprint(TLSFingerprint(strings.ToLower(t.Fingerprint))); err != nil {
+			return err
+		}
+	}
+	if t.CAFile != "" {
+		if err := r.LoadCAFile(t.CAFile); err != nil {
+			return err
+		}
+	}
+	if t.CertFile != "" || t.KeyFile != "" {
+		if err := r.LoadClientCertFile(t.CertFile, t.KeyFile); err != nil {
+			return err
+		}
+	}
+	if t.MinVersion != "" {
+		v, err := parseTLSVersion(t.MinVersion)
+		if err != nil {
+			return err
+		}
+		if err := r.SetTLSMinVersion(v); err != nil {
+			return err
+		}
+	}
+	if t.MaxVersion != "" {
+		v, err := parseTLSVersion(t.MaxVersion)
+		if err != nil {
+			return err
+		}
+		if err := r.SetTLSMaxVersion(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseTLSVersion 解析"1.2"或"TLS1.2"形式的TLS版本
+func parseTLSVersion(s string) (uint16, error) {
+	switch strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(s)), "TLS") {
+	case "1.0", "10":
+		return tls.VersionTLS10, nil
+	case "1.1", "11":
+		return tls.VersionTLS11, nil
+	case "1.2", "12":
+		return tls.VersionTLS12, nil
+	case "1.3", "13":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("无效的TLS版本: %q", s)
+}
+
+func (d DNSConfig) apply(r *GoProxy) error {
+	if d.DoH != "" {
+		if err := r.SetDoH(d.DoH); err != nil {
+			return err
+		}
+	}
+	if d.DoT != "" {
+		if err := r.SetDoT(d.DoT); err != nil {
+			return err
+		}
+	}
+	if d.Cache {
+		r.EnableDNSCache(true)
+	}
+	for host, addr := range d.Hosts {
+		r.SetHostOverride(host, addr)
+	}
+	return nil
+}
+
+// setRetryPolicy 修改已安装的RetryTransport的策略，没有时在当前中间件外层安装一个
+func (r *GoProxy) setRetryPolicy(p RetryPolicy) {
+	r.mu.Lock()
+	for rt := r.transport.base; rt != nil; {
+		if t, ok := rt.(*RetryTransport); ok {
+			r.mu.Unlock()
+			t.SetPolicy(p)
+			return
+		}
+		u, ok := rt.(interface{ Unwrap() http.RoundTripper })
+		if !ok {
+			break
+		}
+		rt = u.Unwrap()
+	}
+	next := r.transport.base
+	if next == nil {
+		next = r.transport.Transport
+	}
+	r.mu.Unlock()
+	r.SetTransport(NewRetryTransport(p, next))
+}
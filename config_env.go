@@ -0,0 +1,130 @@
+package goproxy
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix 覆盖配置的环境变量前缀
+const EnvPrefix = "GOPROXY_CLIENT_"
+
+// LoadEnv 以GOPROXY_CLIENT_开头的环境变量覆盖配置，用于在部署环境中更换代理和超时而不修改代码或配置文件。
+// 变量名为前缀加上大写的配置项，嵌套的配置项以"_"连接，如GOPROXY_CLIENT_PROXY、GOPROXY_CLIENT_TIMEOUTS_REQUEST、
+// GOPROXY_CLIENT_TLS_VERIFY。列表写作以逗号分隔的值，如GOPROXY_CLIENT_PROXIES=http://a:8080,http://b:8080；
+// 规则本身含有逗号，GOPROXY_CLIENT_RULES以分号分隔，如GOPROXY_CLIENT_RULES=DOMAIN,a.example,up1;MATCH,DIRECT，写作YAML列表时需给规则加引号；
+// 列表和映射也可以写作YAML流式语法，如GOPROXY_CLIENT_HEADERS={X-Env: prod}。值为空时清除该配置项。
+// 未知的变量和无法解析的值视为错误，一次返回所有错误，此时配置不被修改。
+// NewFromConfig和WatchConfig在加载配置文件后自动调用，重新加载时同样生效
+func (c *Config) LoadEnv() error {
+	return c.loadEnv(os.Environ())
+}
+
+// loadEnv 以environ("KEY=value"列表)中的变量覆盖配置
+func (c *Config) loadEnv(environ []string) error {
+	fields := make(map[string]envField)
+	var walk func(prefix string, v reflect.Value)
+	walk = func(prefix string, v reflect.Value) {
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			name := prefix + strings.ToUpper(strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0])
+			if f := v.Field(i); f.Kind() == reflect.Struct {
+				walk(name+"_", f)
+			} else {
+				sep := t.Field(i).Tag.Get("env")
+				if sep == "" {
+					sep = ","
+				}
+				fields[name] = envField{f, sep}
+			}
+		}
+	}
+	// 先在副本上修改，有错误时不影响c
+	cfg := *c
+	walk(EnvPrefix, reflect.ValueOf(&cfg).Elem())
+
+	environ = slices.Clone(environ)
+	slices.Sort(environ)
+	var errs []error
+	for _, kv := range environ {
+		name, value, _ := strings.Cut(kv, "=")
+		if !strings.HasPrefix(name, EnvPrefix) {
+			continue
+		}
+		f, ok := fields[name]
+		if !ok {
+			errs = append(errs, fmt.Errorf("未知的环境变量%s", name))
+			continue
+		}
+		if err := setEnvField(f.v, strings.TrimSpace(value), f.sep); err != nil {
+			errs = append(errs, fmt.Errorf("环境变量%s的值无效: %w", name, err))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	*c = cfg
+	return nil
+}
+
+// envField 可由环境变量覆盖的配置项
+type envField struct {
+	v   reflect.Value
+	sep string // 列表的分隔符，由字段的env标签指定，默认为逗号
+}
+
+// setEnvField 将环境变量的值写入配置项，值为空时写入零值
+// 参数:
+//   - f: 配置项
+//   - value: 环境变量的值
+//   - sep: 列表不以"["开头时各项的分隔符
+func setEnvField(f reflect.Value, value, sep string) error {
+	if value == "" {
+		f.SetZero()
+		return nil
+	}
+	if u, ok := f.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(value))
+	}
+	switch f.Kind() {
+	case reflect.String:
+		// 原样使用，不按YAML解释yes、null等值
+		f.SetString(value)
+		return nil
+	case reflect.Slice:
+		if !strings.HasPrefix(value, "[") {
+			var list []string
+			for _, s := range strings.Split(value, sep) {
+				if s = strings.TrimSpace(s); s != "" {
+					list = append(list, s)
+				}
+			}
+			f.Set(reflect.ValueOf(list))
+			return nil
+		}
+	}
+	p := reflect.New(f.Type())
+	if err := yaml.Unmarshal([]byte(value), p.Interface()); err != nil {
+		return err
+	}
+	f.Set(p.Elem())
+	return nil
+}
+
+// parseConfigFile 解析配置文件的内容并以环境变量覆盖
+func parseConfigFile(path string, data []byte) (*Config, error) {
+	cfg, err := ParseConfig(data, configFormat(path))
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.LoadEnv(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
@@ -0,0 +1,117 @@
+package goproxy
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfig_LoadEnv(t *testing.T) {
+	cfg := &Config{Proxy: "http://127.0.0.1:8080", Browser: "firefox", MaxRedirects: 5}
+	err := cfg.loadEnv([]string{
+		"PATH=/usr/bin",
+		"GOPROXY_CLIENT_PROXY=socks5://127.0.0.1:1080",
+		"GOPROXY_CLIENT_BROWSER=",
+		"GOPROXY_CLIENT_PROXIES=http://a:1, http://b:2",
+		"GOPROXY_CLIENT_USER_AGENTS=[ua1, ua2]",
+		"GOPROXY_CLIENT_HEADERS={X-Env: prod}",
+		"GOPROXY_CLIENT_TIMEOUTS_REQUEST=30s",
+		"GOPROXY_CLIENT_TIMEOUTS_DIAL=5",
+		"GOPROXY_CLIENT_TLS_VERIFY=true",
+		"GOPROXY_CLIENT_HTTP2=false",
+		"GOPROXY_CLIENT_RETRY_ATTEMPTS=3",
+		"GOPROXY_CLIENT_UPSTREAMS={corp: [socks5://10.0.0.1:1080]}",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Config{
+		Proxy:        "socks5://127.0.0.1:1080",
+		Proxies:      []string{"http://a:1", "http://b:2"},
+		UserAgents:   []string{"ua1", "ua2"},
+		Headers:      map[string]string{"X-Env": "prod"},
+		Timeouts:     TimeoutConfig{Request: Duration(30 * time.Second), Dial: Duration(5 * time.Second)},
+		TLS:          TLSConfig{Verify: new(bool)},
+		HTTP2:        new(bool),
+		Retry:        RetryPolicyConfig{Attempts: 3},
+		Upstreams:    map[string][]string{"corp": {"socks5://10.0.0.1:1080"}},
+		MaxRedirects: 5,
+	}
+	*want.TLS.Verify = true
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("覆盖后的配置为%+v", cfg)
+	}
+
+	// 有错误时配置不变，一次报告所有错误
+	before := *cfg
+	err = cfg.loadEnv([]string{
+		"GOPROXY_CLIENT_PROXY=http://127.0.0.1:1",
+		"GOPROXY_CLIENT_TIMEOUT=30s",
+		"GOPROXY_CLIENT_MAX_REDIRECTS=many",
+		"GOPROXY_CLIENT_TIMEOUTS_DIAL=soon",
+	})
+	if err == nil {
+		t.Fatal("无效的环境变量没有报告错误")
+	}
+	for _, name := range []string{"GOPROXY_CLIENT_TIMEOUT", "GOPROXY_CLIENT_MAX_REDIRECTS", "GOPROXY_CLIENT_TIMEOUTS_DIAL"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("错误中没有%s: %v", name, err)
+		}
+	}
+	if !reflect.DeepEqual(*cfg, before) {
+		t.Errorf("有错误时配置被修改: %+v", cfg)
+	}
+}
+
+func TestConfig_LoadEnvRules(t *testing.T) {
+	// 规则本身含有逗号，以分号分隔
+	cfg := &Config{}
+	err := cfg.loadEnv([]string{"GOPROXY_CLIENT_RULES=DOMAIN,example.com,up1; IP-CIDR,10.0.0.0/8,DIRECT,no-resolve;"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"DOMAIN,example.com,up1", "IP-CIDR,10.0.0.0/8,DIRECT,no-resolve"}
+	if !reflect.DeepEqual(cfg.Rules, want) {
+		t.Errorf("规则为%q", cfg.Rules)
+	}
+	if err := cfg.loadEnv([]string{"GOPROXY_CLIENT_RULES=DOMAIN,example.com,up1"}); err != nil || !reflect.DeepEqual(cfg.Rules, want[:1]) {
+		t.Errorf("单条规则为%q，错误为%v", cfg.Rules, err)
+	}
+	// YAML列表中含逗号的规则需加引号
+	if err := cfg.loadEnv([]string{`GOPROXY_CLIENT_RULES=["DOMAIN,example.com,up1", "MATCH,DIRECT"]`}); err != nil || !reflect.DeepEqual(cfg.Rules, []string{"DOMAIN,example.com,up1", "MATCH,DIRECT"}) {
+		t.Errorf("YAML列表的规则为%q，错误为%v", cfg.Rules, err)
+	}
+}
+
+func TestNewFromConfig_Env(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "client.yaml")
+	os.WriteFile(path, []byte("proxy: http://127.0.0.1:8080\ntimeouts:\n  request: 10s\n"), 0o644)
+	t.Setenv("GOPROXY_CLIENT_PROXY", "socks5://127.0.0.1:1080")
+	c, err := NewFromConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if c.String() != "socks5://127.0.0.1:1080" || c.GetTimeout() != 10*time.Second {
+		t.Errorf("代理为%q，超时为%v", c.String(), c.GetTimeout())
+	}
+
+	w, err := c.WatchConfig(path, time.Hour, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	// 文件没有变化时Reload同样重新读取环境变量
+	t.Setenv("GOPROXY_CLIENT_TIMEOUTS_REQUEST", "3s")
+	ch := w.Reload()
+	if ch.Err != nil || !reflect.DeepEqual(ch.Changed, []string{"timeouts.request"}) || c.GetTimeout() != 3*time.Second {
+		t.Errorf("重新加载的结果为%+v，超时为%v", ch, c.GetTimeout())
+	}
+	t.Setenv("GOPROXY_CLIENT_TIMEOUTS_REQUEST", "-")
+	if ch := w.Reload(); ch.Err == nil || c.GetTimeout() != 3*time.Second {
+		t.Errorf("环境变量无效时结果为%+v，超时为%v", ch, c.GetTimeout())
+	}
+}
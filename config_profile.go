@@ -0,0 +1,114 @@
+package goproxy
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"sync"
+)
+
+// configState 通过Config.Apply应用的配置，UseProfile和ConfigWatcher在此基础上切换配置组
+type configState struct {
+	mu        sync.Mutex
+	base      *Config // 应用的配置，包含所有配置组
+	profile   string  // 当前使用的配置组，为空时只使用基础配置
+	effective *Config // 合并了当前配置组后实际生效的配置
+}
+
+// UseProfile 切换到配置中的命名配置组，用于在办公室、机房、Tor等不同网络环境之间切换代理、请求头和TLS设置。
+// 新配置组先在一个临时客户端上完整应用一遍，通过后只重新应用与当前配置不同的配置项，
+// 当前配置组设置而新配置组没有设置的配置项恢复为基础配置的值。新的设置对之后发起的请求生效
+// 参数:
+//   - name: 配置组名称，为空时切换回不使用配置组的基础配置
+func (r *GoProxy) UseProfile(name string) error {
+	r.config.mu.Lock()
+	defer r.config.mu.Unlock()
+	if r.config.base == nil {
+		return errors.New("客户端没有通过Config应用配置")
+	}
+	_, err := r.switchConfig(r.config.base, name)
+	return err
+}
+
+// CurrentProfile 返回当前使用的配置组名称，没有使用配置组时返回空字符串
+func (r *GoProxy) CurrentProfile() string {
+	r.config.mu.Lock()
+	defer r.config.mu.Unlock()
+	return r.config.profile
+}
+
+// Profiles 返回已应用的配置中所有配置组的名称
+func (r *GoProxy) Profiles() []string {
+	r.config.mu.Lock()
+	defer r.config.mu.Unlock()
+	if r.config.base == nil {
+		return nil
+	}
+	return slices.Sorted(maps.Keys(r.config.base.Profiles))
+}
+
+// switchConfig 以base合并配置组profile后的配置替换当前生效的配置，返回发生变化的配置项，调用方需持有r.config.mu
+// 新配置先在临时客户端上完整应用一遍，有错误时客户端保持原有配置
+func (r *GoProxy) switchConfig(base *Config, profile string) ([]string, error) {
+	if err := base.Validate(); err != nil {
+		return nil, err
+	}
+	eff, err := base.resolve(profile)
+	if err != nil {
+		return nil, err
+	}
+	// 发现无效的代理、规则和证书文件等
+	scratch := New()
+	err = eff.apply(scratch)
+	scratch.Close()
+	if err != nil {
+		return nil, err
+	}
+	changed := configDiff(r.config.effective, eff)
+	if err := eff.reapply(r, r.config.effective, changed); err != nil {
+		return nil, err
+	}
+	r.config.base, r.config.profile, r.config.effective = base, profile, eff
+	return changed, nil
+}
+
+// resolve 返回合并了配置组name的配置: 配置组中非零值的字段覆盖基础配置，映射按键合并，name为空时返回基础配置
+func (c *Config) resolve(name string) (*Config, error) {
+	eff := *c
+	if name != "" {
+		p, ok := c.Profiles[name]
+		if !ok {
+			return nil, fmt.Errorf("配置组%q不存在", name)
+		}
+		if p != nil {
+			mergeConfig(reflect.ValueOf(&eff).Elem(), reflect.ValueOf(p).Elem())
+		}
+	}
+	eff.Profile, eff.Profiles = name, nil
+	return &eff, nil
+}
+
+// mergeConfig 将src中非零值的字段合并到dst，结构体逐字段合并，映射复制后按键合并，其他类型直接覆盖
+func mergeConfig(dst, src reflect.Value) {
+	for i := 0; i < dst.NumField(); i++ {
+		d, s := dst.Field(i), src.Field(i)
+		switch {
+		case d.Kind() == reflect.Struct:
+			mergeConfig(d, s)
+		case s.IsZero():
+		case d.Kind() == reflect.Map:
+			m := reflect.MakeMapWithSize(d.Type(), d.Len()+s.Len())
+			for _, v := range []reflect.Value{d, s} {
+				iter := v.MapRange()
+				for iter.Next() {
+					m.SetMapIndex(iter.Key(), iter.Value())
+				}
+			}
+			d.Set(m)
+		default:
+			d.Set(s)
+		}
+	}
+}
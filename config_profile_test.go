@@ -0,0 +1,146 @@
+package goproxy
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testProfilesYAML = `
+proxy: http://127.0.0.1:8080
+headers:
+  X-Base: "1"
+timeouts:
+  request: 10s
+profile: office
+profiles:
+  office:
+    proxy: http://127.0.0.1:3128
+  tor:
+    proxy: socks5://127.0.0.1:9050
+    headers:
+      X-Tor: "1"
+    tls:
+      verify: true
+    timeouts:
+      request: 60s
+  datacenter:
+`
+
+func TestGoProxy_UseProfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "client.yaml")
+	os.WriteFile(path, []byte(testProfilesYAML), 0o644)
+	c, err := NewFromConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if c.CurrentProfile() != "office" || c.String() != "http://127.0.0.1:3128" {
+		t.Fatalf("默认配置组为%q，代理为%q", c.CurrentProfile(), c.String())
+	}
+	if got := c.Profiles(); !reflect.DeepEqual(got, []string{"datacenter", "office", "tor"}) {
+		t.Errorf("配置组为%v", got)
+	}
+
+	if err := c.UseProfile("tor"); err != nil {
+		t.Fatal(err)
+	}
+	h := c.GetGlobalHeaders()
+	if c.String() != "socks5://127.0.0.1:9050" || h.Get("X-Base") != "1" || h.Get("X-Tor") != "1" ||
+		!c.GetTLSVerify() || c.GetTimeout() != time.Minute {
+		t.Errorf("切换到tor后代理为%q，请求头为%v，校验证书为%v，超时为%v", c.String(), h, c.GetTLSVerify(), c.GetTimeout())
+	}
+
+	// 没有设置的配置项恢复为基础配置
+	if err := c.UseProfile("datacenter"); err != nil {
+		t.Fatal(err)
+	}
+	h = c.GetGlobalHeaders()
+	if c.String() != "http://127.0.0.1:8080" || h.Get("X-Tor") != "" || c.GetTLSVerify() || c.GetTimeout() != 10*time.Second {
+		t.Errorf("切换到datacenter后代理为%q，请求头为%v，校验证书为%v，超时为%v", c.String(), h, c.GetTLSVerify(), c.GetTimeout())
+	}
+
+	if err := c.UseProfile("home"); err == nil || c.CurrentProfile() != "datacenter" {
+		t.Errorf("切换到不存在的配置组时错误为%v，当前配置组为%q", err, c.CurrentProfile())
+	}
+	if err := New().UseProfile("tor"); err == nil {
+		t.Error("没有应用配置时切换配置组没有报告错误")
+	}
+}
+
+func TestGoProxy_UseProfileWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "client.yaml")
+	os.WriteFile(path, []byte(testProfilesYAML), 0o644)
+	c := New()
+	defer c.Close()
+	w, err := c.WatchConfig(path, time.Hour, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if err := c.UseProfile("tor"); err != nil {
+		t.Fatal(err)
+	}
+	// 重新加载后保持UseProfile选择的配置组
+	os.WriteFile(path, []byte(strings.Replace(testProfilesYAML, "socks5://127.0.0.1:9050", "socks5://127.0.0.1:9150", 1)), 0o644)
+	ch := w.Reload()
+	if ch.Err != nil || !reflect.DeepEqual(ch.Changed, []string{"proxy"}) || c.String() != "socks5://127.0.0.1:9150" {
+		t.Errorf("重新加载的结果为%+v，代理为%q", ch, c.String())
+	}
+	// 文件中的profile变化时改用新的配置组
+	os.WriteFile(path, []byte(strings.Replace(testProfilesYAML, "profile: office", "profile: datacenter", 1)), 0o644)
+	if ch := w.Reload(); ch.Err != nil || c.CurrentProfile() != "datacenter" || c.String() != "http://127.0.0.1:8080" {
+		t.Errorf("重新加载的结果为%+v，配置组为%q，代理为%q", ch, c.CurrentProfile(), c.String())
+	}
+}
+
+func TestConfig_ValidateProfiles(t *testing.T) {
+	cfg := &Config{
+		Proxy:   "ftp://base",
+		Profile: "home",
+		Profiles: map[string]*Config{
+			"tor":    {Proxy: "gopher://127.0.0.1:9050"},
+			"nested": {Profiles: map[string]*Config{"x": nil}},
+			"office": {Headers: map[string]string{"X-Office": "1"}},
+		},
+	}
+	var verr *ValidationError
+	if !errors.As(cfg.Validate(), &verr) {
+		t.Fatal("没有报告错误")
+	}
+	var fields []string
+	for _, p := range verr.Problems {
+		fields = append(fields, p.Field)
+	}
+	// 基础配置的错误不在每个配置组中重复报告
+	want := []string{"proxy", "profile", "profiles.nested", "profiles.tor.proxy"}
+	if !reflect.DeepEqual(fields, want) {
+		t.Errorf("错误的字段为%v", fields)
+	}
+}
+
+func TestParseConfig_TOMLProfiles(t *testing.T) {
+	cfg, err := ParseConfig([]byte(`
+proxy = "http://127.0.0.1:8080"
+
+[profiles.tor]
+proxy = "socks5://127.0.0.1:9050"
+
+[profiles.tor.headers]
+X-Tor = "1"
+`), "toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	eff, err := cfg.resolve("tor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if eff.Proxy != "socks5://127.0.0.1:9050" || eff.Headers["X-Tor"] != "1" || eff.Profiles != nil {
+		t.Errorf("合并后的配置为%+v", eff)
+	}
+}
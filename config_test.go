@@ -0,0 +1,223 @@
+package goproxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testConfigYAML = `
+proxy: http://127.0.0.1:8080
+browser: firefox
+headers:
+  X-Test: "1"
+user_agents: [ua1, ua2]
+timeouts:
+  request: 30s
+  dial: 5
+tls:
+  verify: true
+  fingerprint: chrome
+  min_version: "1.2"
+http2: true
+retry:
+  attempts: 2
+  backoff: 10ms
+rate_limit:
+  download_bps: 1000
+max_redirects: 5
+upstreams:
+  corp: [socks5://10.0.0.1:1080]
+rules:
+  - DOMAIN-SUFFIX,corp.example,corp
+`
+
+const testConfigJSON = `{
+  "proxy": "http://127.0.0.1:8080",
+  "browser": "firefox",
+  "headers": {"X-Test": "1"},
+  "user_agents": ["ua1", "ua2"],
+  "timeouts": {"request": "30s", "dial": 5},
+  "tls": {"verify": true, "fingerprint": "chrome", "min_version": "1.2"},
+  "http2": true,
+  "retry": {"attempts": 2, "backoff": "10ms"},
+  "rate_limit": {"download_bps": 1000},
+  "max_redirects": 5,
+  "upstreams": {"corp": ["socks5://10.0.0.1:1080"]},
+  "rules": ["DOMAIN-SUFFIX,corp.example,corp"]
+}`
+
+const testConfigTOML = `
+proxy = "http://127.0.0.1:8080"
+browser = "firefox"
+user_agents = ["ua1", "ua2"]
+http2 = true
+max_redirects = 5
+rules = ["DOMAIN-SUFFIX,corp.example,corp"]
+
+[headers]
+X-Test = "1"
+
+[timeouts]
+request = "30s"
+dial = 5
+
+[tls]
+verify = true
+fingerprint = "chrome"
+min_version = "1.2"
+
+[retry]
+attempts = 2
+backoff = "10ms"
+
+[rate_limit]
+download_bps = 1000
+
+[upstreams]
+corp = ["socks5://10.0.0.1:1080"]
+`
+
+func TestParseConfig(t *testing.T) {
+	want, err := ParseConfig([]byte(testConfigYAML), "yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want.Timeouts.Request != Duration(30*time.Second) || want.Timeouts.Dial != Duration(5*time.Second) || *want.TLS.Verify != true {
+		t.Errorf("YAML配置为%+v", want)
+	}
+	for format, data := range map[string]string{"json": testConfigJSON, "toml": testConfigTOML} {
+		cfg, err := ParseConfig([]byte(data), format)
+		if err != nil {
+			t.Errorf("%s: %v", format, err)
+			continue
+		}
+		if !reflect.DeepEqual(cfg, want) {
+			t.Errorf("%s配置为%+v", format, cfg)
+		}
+	}
+
+	// 未知的字段视为错误
+	for format, data := range map[string]string{"yaml": "proxyy: x", "json": `{"proxyy": "x"}`, "toml": `proxyy = "x"`} {
+		if _, err := ParseConfig([]byte(data), format); err == nil || !strings.Contains(err.Error(), "proxyy") {
+			t.Errorf("%s: 未知字段的错误为%v", format, err)
+		}
+	}
+	if _, err := ParseConfig([]byte("timeouts:\n  request: soon"), "yaml"); err == nil || !strings.Contains(err.Error(), "无效的时长") {
+		t.Errorf("无效时长的错误为%v", err)
+	}
+	if _, err := ParseConfig(nil, "ini"); err == nil {
+		t.Error("不支持的格式应返回错误")
+	}
+	if cfg, err := ParseConfig(nil, "yaml"); err != nil || !reflect.DeepEqual(cfg, &Config{}) {
+		t.Errorf("空配置为%+v，错误为%v", cfg, err)
+	}
+}
+
+func TestNewFromConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "client.yaml")
+	os.WriteFile(path, []byte(testConfigYAML), 0o644)
+	c, err := NewFromConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if c.String() != "http://127.0.0.1:8080" || c.GetTimeout() != 30*time.Second || !c.GetTLSVerify() || !c.IsHTTP2Enabled() {
+		t.Errorf("代理为%q，超时为%v", c.String(), c.GetTimeout())
+	}
+	// tls.fingerprint优先于browser中的指纹，browser的请求头与headers合并
+	h := c.GetGlobalHeaders()
+	if c.GetTLSFingerprint() != FingerprintChrome || h.Get("X-Test") != "1" || h.Get("User-Agent") != ProfileFirefox.Headers.Get("User-Agent") {
+		t.Errorf("指纹为%q，请求头为%v", c.GetTLSFingerprint(), h)
+	}
+	if !reflect.DeepEqual(c.GetUserAgents(), []string{"ua1", "ua2"}) {
+		t.Errorf("User-Agent列表为%v", c.GetUserAgents())
+	}
+	if down, _ := c.GetBandwidthLimit(); down != 1000 {
+		t.Errorf("下载限速为%d", down)
+	}
+	if c.GetRouter() == nil || c.GetRouter().Match(t.Context(), "a.corp.example", nil) != "corp" {
+		t.Error("规则路由没有生效")
+	}
+	rt, ok := c.transport.base.(*RetryTransport)
+	if !ok || rt.Policy() != (RetryPolicy{Attempts: 2, Backoff: 10 * time.Millisecond}) {
+		t.Errorf("重试中间件为%#v", c.transport.base)
+	}
+	// 再次应用时修改已安装的重试中间件
+	cfg := &Config{Retry: RetryPolicyConfig{Attempts: 5}}
+	if err := cfg.Apply(c); err != nil || c.transport.base != rt || rt.Policy().Attempts != 5 {
+		t.Errorf("再次应用后的重试中间件为%#v，错误为%v", c.transport.base, err)
+	}
+	// statuses中的"*"适用于所有方法
+	cfg = &Config{Retry: RetryPolicyConfig{Attempts: 1, Statuses: map[string][]int{"*": {522}, "get": {500}}}}
+	if err := cfg.Apply(c); err != nil {
+		t.Fatal(err)
+	}
+	want := &RetryStatusCodes{Any: []int{522}, Methods: map[string][]int{"GET": {500}}}
+	if got := rt.Policy().StatusCodes; !reflect.DeepEqual(got, want) {
+		t.Errorf("可重试的状态码为%#v", got)
+	}
+
+	if _, err := NewFromConfig(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("文件不存在时应返回错误")
+	}
+	os.WriteFile(path, []byte("browser: netscape"), 0o644)
+	if _, err := NewFromConfig(path); err == nil || !strings.Contains(err.Error(), "netscape") {
+		t.Errorf("未知浏览器的错误为%v", err)
+	}
+}
+
+func TestConfig_Proxies(t *testing.T) {
+	cfg := &Config{Proxies: []string{"http://10.0.0.1:8080", "http://10.0.0.2:8080"}, Rules: []string{"DOMAIN,direct.example,DIRECT"}}
+	c := New()
+	defer c.Close()
+	if err := cfg.Apply(c); err != nil {
+		t.Fatal(err)
+	}
+	rt := c.GetRouter()
+	if rt.Match(t.Context(), "direct.example", nil) != RouteDirect || rt.Match(t.Context(), "other.example", nil) != poolGroup {
+		t.Error("代理池没有作为最后的规则")
+	}
+	cfg.Upstreams = map[string][]string{poolGroup: {"http://x"}}
+	if err := cfg.Apply(New()); err == nil {
+		t.Error("上游组名与代理池冲突时应返回错误")
+	}
+}
+
+func TestConfig_RetryDispatch(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hits.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(w, r.Proto)
+	}))
+	defer srv.Close()
+
+	// 配置安装的重试中间件不影响单次请求选项的发送方式，重试的请求同样使用HTTP/1.0
+	c := New()
+	defer c.Close()
+	cfg := &Config{Retry: RetryPolicyConfig{Attempts: 2}}
+	if err := cfg.Apply(c); err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	resp, err := c.Do(req, WithHTTP10())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	if string(b) != "HTTP/1.0" || hits.Load() != 2 {
+		t.Errorf("响应为%q，请求%d次", b, hits.Load())
+	}
+}
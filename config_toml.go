@@ -0,0 +1,416 @@
+package goproxy
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// parseTOML 解析配置文件常用的TOML子集: 表、表数组、点分隔的键、字符串、整数、浮点数、布尔值、数组和内联表，
+// 不支持日期时间和多行字符串
+func parseTOML(data []byte) (map[string]any, error) {
+	if !utf8.Valid(data) {
+		return nil, fmt.Errorf("TOML不是有效的UTF-8")
+	}
+	p := &tomlParser{s: string(data), line: 1}
+	root := make(map[string]any)
+	current := root
+	for {
+		p.skipBlank(true)
+		if p.eof() {
+			return root, nil
+		}
+		var err error
+		switch {
+		case strings.HasPrefix(p.s[p.pos:], "[["):
+			p.pos += 2
+			current, err = p.arrayTable(root)
+		case p.peek() == '[':
+			p.pos++
+			current, err = p.table(root)
+		default:
+			err = p.keyValue(current)
+		}
+		if err == nil {
+			err = p.endOfLine()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("TOML第%d行: %w", p.line, err)
+		}
+	}
+}
+
+// tomlParser TOML解析状态
+type tomlParser struct {
+	s    string
+	pos  int
+	line int
+}
+
+func (p *tomlParser) eof() bool {
+	return p.pos >= len(p.s)
+}
+
+func (p *tomlParser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.s[p.pos]
+}
+
+// skipBlank 跳过空白和注释，newlines为true时同时跳过换行
+func (p *tomlParser) skipBlank(newlines bool) {
+	for !p.eof() {
+		switch c := p.peek(); {
+		case c == ' ' || c == '\t' || c == '\r':
+			p.pos++
+		case c == '\n' && newlines:
+			p.pos++
+			p.line++
+		case c == '#':
+			for !p.eof() && p.peek() != '\n' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// endOfLine 确认当前行剩余的只有空白和注释
+func (p *tomlParser) endOfLine() error {
+	p.skipBlank(false)
+	if p.eof() {
+		return nil
+	}
+	if p.peek() != '\n' {
+		return fmt.Errorf("多余的内容%q", p.rest())
+	}
+	return nil
+}
+
+// rest 返回当前行剩余的内容，用于错误信息
+func (p *tomlParser) rest() string {
+	end := strings.IndexByte(p.s[p.pos:], '\n')
+	if end < 0 {
+		return p.s[p.pos:]
+	}
+	return p.s[p.pos : p.pos+end]
+}
+
+// expect 跳过空白后读取字符c
+func (p *tomlParser) expect(c byte) error {
+	p.skipBlank(false)
+	if p.peek() != c {
+		return fmt.Errorf("应为%q，实际为%q", c, p.rest())
+	}
+	p.pos++
+	return nil
+}
+
+// table 解析[a.b]表头，返回该表
+func (p *tomlParser) table(root map[string]any) (map[string]any, error) {
+	path, err := p.key()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(']'); err != nil {
+		return nil, err
+	}
+	return tomlSubTable(root, path)
+}
+
+// arrayTable 解析[[a.b]]表头，在表数组末尾追加一个表并返回
+func (p *tomlParser) arrayTable(root map[string]any) (map[string]any, error) {
+	path, err := p.key()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(']'); err != nil {
+		return nil, err
+	}
+	if err := p.expect(']'); err != nil {
+		return nil, err
+	}
+	parent, err := tomlSubTable(root, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	name := path[len(path)-1]
+	table := make(map[string]any)
+	switch v := parent[name].(type) {
+	case nil:
+		parent[name] = []any{table}
+	case []any:
+		parent[name] = append(v, table)
+	default:
+		return nil, fmt.Errorf("%s已定义为其他类型", strings.Join(path, "."))
+	}
+	return table, nil
+}
+
+// keyValue 解析key = value并写入table
+func (p *tomlParser) keyValue(table map[string]any) error {
+	path, err := p.key()
+	if err != nil {
+		return err
+	}
+	if err := p.expect('='); err != nil {
+		return err
+	}
+	p.skipBlank(false)
+	value, err := p.value()
+	if err != nil {
+		return err
+	}
+	parent, err := tomlSubTable(table, path[:len(path)-1])
+	if err != nil {
+		return err
+	}
+	name := path[len(path)-1]
+	if _, ok := parent[name]; ok {
+		return fmt.Errorf("重复的键%s", strings.Join(path, "."))
+	}
+	parent[name] = value
+	return nil
+}
+
+// key 解析点分隔的键，每段为裸键或带引号的字符串
+func (p *tomlParser) key() ([]string, error) {
+	var path []string
+	for {
+		p.skipBlank(false)
+		var part string
+		switch c := p.peek(); {
+		case c == '"' || c == '\'':
+			s, err := p.str()
+			if err != nil {
+				return nil, err
+			}
+			part = s
+		default:
+			start := p.pos
+			for !p.eof() && isBareKeyChar(p.peek()) {
+				p.pos++
+			}
+			if start == p.pos {
+				return nil, fmt.Errorf("无效的键%q", p.rest())
+			}
+			part = p.s[start:p.pos]
+		}
+		path = append(path, part)
+		p.skipBlank(false)
+		if p.peek() != '.' {
+			return path, nil
+		}
+		p.pos++
+	}
+}
+
+func isBareKeyChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+// value 解析一个值
+func (p *tomlParser) value() (any, error) {
+	switch c := p.peek(); {
+	case c == '"' || c == '\'':
+		return p.str()
+	case c == '[':
+		p.pos++
+		return p.array()
+	case c == '{':
+		p.pos++
+		return p.inlineTable()
+	case strings.HasPrefix(p.s[p.pos:], "true"):
+		p.pos += 4
+		return true, nil
+	case strings.HasPrefix(p.s[p.pos:], "false"):
+		p.pos += 5
+		return false, nil
+	}
+	return p.number()
+}
+
+// str 解析基本字符串或字面量字符串
+func (p *tomlParser) str() (string, error) {
+	quote := p.peek()
+	if strings.HasPrefix(p.s[p.pos:], strings.Repeat(string(quote), 3)) {
+		return "", fmt.Errorf("不支持多行字符串")
+	}
+	p.pos++
+	var b strings.Builder
+	for {
+		if p.eof() || p.peek() == '\n' {
+			return "", fmt.Errorf("字符串没有结束")
+		}
+		c := p.peek()
+		p.pos++
+		switch {
+		case c == quote:
+			return b.String(), nil
+		case c == '\\' && quote == '"':
+			if err := p.escape(&b); err != nil {
+				return "", err
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+}
+
+// escape 解析基本字符串中\之后的转义序列
+func (p *tomlParser) escape(b *strings.Builder) error {
+	if p.eof() {
+		return fmt.Errorf("字符串没有结束")
+	}
+	c := p.peek()
+	p.pos++
+	switch c {
+	case 'b':
+		b.WriteByte('\b')
+	case 't':
+		b.WriteByte('\t')
+	case 'n':
+		b.WriteByte('\n')
+	case 'f':
+		b.WriteByte('\f')
+	case 'r':
+		b.WriteByte('\r')
+	case '"', '\\':
+		b.WriteByte(c)
+	case 'u', 'U':
+		n := 4
+		if c == 'U' {
+			n = 8
+		}
+		if p.pos+n > len(p.s) {
+			return fmt.Errorf("无效的转义序列")
+		}
+		code, err := strconv.ParseUint(p.s[p.pos:p.pos+n], 16, 32)
+		if err != nil || !utf8.ValidRune(rune(code)) {
+			return fmt.Errorf("无效的转义序列\\%c%s", c, p.s[p.pos:p.pos+n])
+		}
+		p.pos += n
+		b.WriteRune(rune(code))
+	default:
+		return fmt.Errorf("无效的转义序列\\%c", c)
+	}
+	return nil
+}
+
+// array 解析[之后的数组，可以跨行
+func (p *tomlParser) array() ([]any, error) {
+	list := []any{}
+	for {
+		p.skipBlank(true)
+		if p.peek() == ']' {
+			p.pos++
+			return list, nil
+		}
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+		p.skipBlank(true)
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case ']':
+		default:
+			return nil, fmt.Errorf("数组中应为','或']'，实际为%q", p.rest())
+		}
+	}
+}
+
+// inlineTable 解析{之后的内联表
+func (p *tomlParser) inlineTable() (map[string]any, error) {
+	table := make(map[string]any)
+	p.skipBlank(false)
+	if p.peek() == '}' {
+		p.pos++
+		return table, nil
+	}
+	for {
+		if err := p.keyValue(table); err != nil {
+			return nil, err
+		}
+		p.skipBlank(false)
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case '}':
+			p.pos++
+			return table, nil
+		default:
+			return nil, fmt.Errorf("内联表中应为','或'}'，实际为%q", p.rest())
+		}
+	}
+}
+
+// number 解析整数或浮点数
+func (p *tomlParser) number() (any, error) {
+	start := p.pos
+	for !p.eof() && strings.IndexByte("+-._:0123456789abcdefinoxABCDEFTZ", p.peek()) >= 0 {
+		p.pos++
+	}
+	tok := p.s[start:p.pos]
+	if tok == "" {
+		return nil, fmt.Errorf("无效的值%q", p.rest())
+	}
+	if strings.ContainsAny(tok, ":TZ") || strings.Count(tok, "-") >= 2 {
+		return nil, fmt.Errorf("不支持日期时间%q", tok)
+	}
+	digits := strings.ReplaceAll(tok, "_", "")
+	unsigned := strings.TrimLeft(digits, "+-")
+	var v any
+	var err error
+	switch {
+	case unsigned == "inf":
+		v = math.Inf(1)
+		if digits[0] == '-' {
+			v = math.Inf(-1)
+		}
+	case unsigned == "nan":
+		v = math.NaN()
+	case strings.HasPrefix(digits, "0x"), strings.HasPrefix(digits, "0o"), strings.HasPrefix(digits, "0b"):
+		v, err = strconv.ParseInt(digits, 0, 64)
+	case !strings.ContainsAny(digits, ".eE"):
+		v, err = strconv.ParseInt(digits, 10, 64)
+	default:
+		v, err = strconv.ParseFloat(digits, 64)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("无效的值%q", tok)
+	}
+	return v, nil
+}
+
+// tomlSubTable 沿path查找或创建子表，路径上的表数组取最后一个表
+func tomlSubTable(table map[string]any, path []string) (map[string]any, error) {
+	for i, name := range path {
+		switch v := table[name].(type) {
+		case nil:
+			sub := make(map[string]any)
+			table[name] = sub
+			table = sub
+		case map[string]any:
+			table = v
+		case []any:
+			var last map[string]any
+			if len(v) > 0 {
+				last, _ = v[len(v)-1].(map[string]any)
+			}
+			if last == nil {
+				return nil, fmt.Errorf("%s不是表", strings.Join(path[:i+1], "."))
+			}
+			table = last
+		default:
+			return nil, fmt.Errorf("%s不是表", strings.Join(path[:i+1], "."))
+		}
+	}
+	return table, nil
+}
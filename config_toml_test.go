@@ -0,0 +1,89 @@
+package goproxy
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTOML(t *testing.T) {
+	m, err := parseTOML([]byte(`
+# 注释
+proxy = "socks5://127.0.0.1:1080" # 行尾注释
+"quoted key" = 'C:\path'
+escaped = "a\tb\u00e9"
+count = 1_000
+hex = 0xff
+ratio = 1.5e2
+off = false
+list = [
+  "a", # 数组中的注释
+  "b",
+]
+nested = [[1, 2], []]
+point = { x = 1, y.z = "deep" }
+timeouts.dial = "5s"
+
+[tls]
+verify = true
+
+[upstreams]
+pool = ["http://a", "http://b"]
+
+[[items]]
+name = "first"
+[[items]]
+name = "second"
+[items.sub]
+k = -inf
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"proxy":      "socks5://127.0.0.1:1080",
+		"quoted key": `C:\path`,
+		"escaped":    "a\tbé",
+		"count":      int64(1000),
+		"hex":        int64(255),
+		"ratio":      150.0,
+		"off":        false,
+		"list":       []any{"a", "b"},
+		"nested":     []any{[]any{int64(1), int64(2)}, []any{}},
+		"point":      map[string]any{"x": int64(1), "y": map[string]any{"z": "deep"}},
+		"timeouts":   map[string]any{"dial": "5s"},
+		"tls":        map[string]any{"verify": true},
+		"upstreams":  map[string]any{"pool": []any{"http://a", "http://b"}},
+		"items": []any{
+			map[string]any{"name": "first"},
+			map[string]any{"name": "second", "sub": map[string]any{"k": math.Inf(-1)}},
+		},
+	}
+	if !reflect.DeepEqual(m, want) {
+		t.Errorf("解析结果为%#v", m)
+	}
+}
+
+func TestParseTOML_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"重复的键", "a = 1\na = 2", "第2行: 重复的键a"},
+		{"缺少等号", "a 1", "应为'='"},
+		{"字符串没有结束", `a = "x`, "字符串没有结束"},
+		{"多行字符串", `a = """x"""`, "不支持多行字符串"},
+		{"日期时间", "a = 2024-01-02T03:04:05Z", "不支持日期时间"},
+		{"多余的内容", "a = 1 2", "多余的内容"},
+		{"键不是表", "a = 1\n[a.b]", "a不是表"},
+		{"无效的转义", `a = "\q"`, "无效的转义序列"},
+	}
+	for _, tt := range tests {
+		_, err := parseTOML([]byte(tt.data))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: 错误为%v", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,357 @@
+package goproxy
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http/httpguts"
+)
+
+// ConfigProblem 配置中的一处错误
+type ConfigProblem struct {
+	Field   string // 出错的字段，如"proxies[1]"、"timeouts.request"、"rules[2]"
+	Message string // 错误说明
+}
+
+func (p ConfigProblem) String() string {
+	return p.Field + ": " + p.Message
+}
+
+// ValidationError Validate发现的全部配置错误
+type ValidationError struct {
+	Problems []ConfigProblem
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		msgs[i] = p.String()
+	}
+	return fmt.Sprintf("配置有%d处错误: %s", len(e.Problems), strings.Join(msgs, "; "))
+}
+
+// minTimeout 小于该值的超时多半是漏写了单位
+const minTimeout = time.Millisecond
+
+// Validate 检查配置，一次返回所有错误而不是在应用或请求时才逐个发现，没有错误时返回nil，否则返回*ValidationError
+// 检查代理地址、浏览器身份、请求头、规则(格式、上游是否存在、重复和冲突、被前面的规则覆盖而不会生效)、
+// 超时(负数、漏写单位、整体超时小于各阶段超时)、TLS、DNS、各项数值以及与基础配置合并后的各配置组。
+// 只检查证书等文件是否存在，不检查内容
+func (c *Config) Validate() error {
+	v := &validator{}
+	if c.Proxy != "" {
+		v.proxy("proxy", c.Proxy, true)
+		if len(c.Proxies) > 0 {
+			v.add("proxy", "与proxies同时设置，没有规则匹配的连接使用proxies，proxy不会生效")
+		}
+	}
+	for i, p := range c.Proxies {
+		v.proxy(fmt.Sprintf("proxies[%d]", i), p, false)
+	}
+	if c.Browser != "" {
+		if _, ok := browserProfiles[strings.ToLower(c.Browser)]; !ok {
+			v.add("browser", fmt.Sprintf("未知的浏览器身份%q，可用: chrome、safari、firefox", c.Browser))
+		}
+	}
+	v.headers("headers", c.Headers)
+	for _, pattern := range slices.Sorted(maps.Keys(c.HostHeaders)) {
+		v.headers("host_headers."+pattern, c.HostHeaders[pattern])
+	}
+	for i, ua := range c.UserAgents {
+		if ua == "" || !httpguts.ValidHeaderFieldValue(ua) {
+			v.add(fmt.Sprintf("user_agents[%d]", i), "无效的User-Agent")
+		}
+	}
+	c.validateRouting(v)
+	c.Timeouts.validate(v)
+	c.TLS.validate(v)
+	c.DNS.validate(v)
+
+	if c.Retry.Attempts < 0 {
+		v.add("retry.attempts", "不能为负数")
+	}
+	v.duration("retry.backoff", c.Retry.Backoff)
+	v.duration("retry.max_backoff", c.Retry.MaxBackoff)
+	if c.Retry.Backoff > 0 && c.Retry.MaxBackoff > 0 && c.Retry.Backoff > c.Retry.MaxBackoff {
+		v.add("retry.backoff", fmt.Sprintf("%s大于max_backoff(%s)", time.Duration(c.Retry.Backoff), time.Duration(c.Retry.MaxBackoff)))
+	}
+	if c.RateLimit.DownloadBps < 0 {
+		v.add("rate_limit.download_bps", "不能为负数")
+	}
+	if c.RateLimit.UploadBps < 0 {
+		v.add("rate_limit.upload_bps", "不能为负数")
+	}
+	if c.MaxRedirects < 0 {
+		v.add("max_redirects", "不能为负数")
+	}
+	if c.MaxBodySize < 0 {
+		v.add("max_body_size", "不能为负数")
+	}
+	c.validateProfiles(v)
+	return v.err()
+}
+
+// validateProfiles 检查各配置组与基础配置合并后的配置，只报告基础配置中没有的错误，字段名以"profiles.名称."开头
+func (c *Config) validateProfiles(v *validator) {
+	if c.Profile != "" {
+		if _, ok := c.Profiles[c.Profile]; !ok {
+			v.add("profile", fmt.Sprintf("配置组%q不存在", c.Profile))
+		}
+	}
+	base := make(map[ConfigProblem]bool, len(v.problems))
+	for _, p := range v.problems {
+		base[p] = true
+	}
+	for _, name := range slices.Sorted(maps.Keys(c.Profiles)) {
+		field := "profiles." + name
+		if name == "" {
+			v.add("profiles", "配置组名称不能为空")
+			continue
+		}
+		if p := c.Profiles[name]; p != nil && (p.Profile != "" || len(p.Profiles) > 0) {
+			v.add(field, "配置组中不能再设置profile和profiles")
+			continue
+		}
+		eff, _ := c.resolve(name)
+		eff.Profile = ""
+		var verr *ValidationError
+		if !errors.As(eff.Validate(), &verr) {
+			continue
+		}
+		for _, p := range verr.Problems {
+			if !base[p] {
+				v.add(field+"."+p.Field, p.Message)
+			}
+		}
+	}
+}
+
+// validateRouting 检查upstreams和rules
+func (c *Config) validateRouting(v *validator) {
+	for _, name := range slices.Sorted(maps.Keys(c.Upstreams)) {
+		field := "upstreams." + name
+		switch {
+		case name == RouteDirect || name == RouteReject:
+			v.add(field, "名称与内置名称冲突")
+		case name == poolGroup && len(c.Proxies) > 0:
+			v.add(field, fmt.Sprintf("名称%s与proxies冲突", poolGroup))
+		case len(c.Upstreams[name]) == 0:
+			v.add(field, "没有代理")
+		}
+		for i, p := range c.Upstreams[name] {
+			v.proxy(fmt.Sprintf("%s[%d]", field, i), p, false)
+		}
+	}
+
+	type ruleKey struct{ kind, value string }
+	seen := make(map[ruleKey]int)
+	final := -1
+	var parsed []routeRule
+	for i, line := range c.Rules {
+		field := fmt.Sprintf("rules[%d]", i)
+		rule, err := parseRouteRule(line)
+		if err != nil {
+			v.add(field, fmt.Sprintf("%q无效: %v", line, err))
+			continue
+		}
+		if _, ok := c.Upstreams[rule.target]; !ok && rule.target != RouteDirect && rule.target != RouteReject &&
+			!(rule.target == poolGroup && len(c.Proxies) > 0) {
+			v.add(field, fmt.Sprintf("上游%s不存在", rule.target))
+		}
+		if final >= 0 {
+			v.add(field, fmt.Sprintf("位于rules[%d]的FINAL之后，不会生效", final))
+			continue
+		}
+		if rule.kind == "FINAL" {
+			final = i
+			if len(c.Proxies) > 0 {
+				v.add(field, "与proxies冲突，设置proxies时会追加FINAL,"+poolGroup)
+			}
+			continue
+		}
+		key := ruleKey{rule.kind, rule.value}
+		if rule.cidr != nil {
+			key.value = rule.cidr.String()
+		}
+		if j, ok := seen[key]; ok {
+			if prev := parsed[j]; prev.target == rule.target {
+				v.add(field, fmt.Sprintf("与rules[%d]重复", j))
+			} else {
+				v.add(field, fmt.Sprintf("与rules[%d]冲突(上游为%s)，不会生效", j, prev.target))
+			}
+		} else if j := shadowedBy(parsed, rule); j >= 0 {
+			v.add(field, fmt.Sprintf("被rules[%d]覆盖，不会生效", j))
+		} else {
+			seen[key] = i
+		}
+		// parsed按规则序号保存，解析失败的规则留空
+		for len(parsed) < i {
+			parsed = append(parsed, routeRule{})
+		}
+		parsed = append(parsed, rule)
+	}
+}
+
+// shadowedBy 返回覆盖了域名规则rule的前面规则的序号，即rule能匹配的域名一定先被该规则匹配，没有时返回-1
+func shadowedBy(prev []routeRule, rule routeRule) int {
+	switch rule.kind {
+	case "DOMAIN", "DOMAIN-SUFFIX", "DOMAIN-KEYWORD":
+	default:
+		return -1
+	}
+	for j, p := range prev {
+		switch p.kind {
+		case "DOMAIN-SUFFIX":
+			if rule.kind != "DOMAIN-KEYWORD" && (rule.value == p.value || strings.HasSuffix(rule.value, "."+p.value)) {
+				return j
+			}
+		case "DOMAIN-KEYWORD":
+			if strings.Contains(rule.value, p.value) {
+				return j
+			}
+		}
+	}
+	return -1
+}
+
+// validate 检查超时
+func (t TimeoutConfig) validate(v *validator) {
+	v.duration("timeouts.request", t.Request)
+	v.duration("timeouts.dial", t.Dial)
+	v.duration("timeouts.tls_handshake", t.TLSHandshake)
+	v.duration("timeouts.response_header", t.ResponseHeader)
+	v.duration("timeouts.idle_conn", t.IdleConn)
+	if t.Request <= 0 {
+		return
+	}
+	for _, phase := range []struct {
+		name string
+		d    Duration
+	}{{"dial", t.Dial}, {"tls_handshake", t.TLSHandshake}, {"response_header", t.ResponseHeader}} {
+		if phase.d > t.Request {
+			v.add("timeouts."+phase.name, fmt.Sprintf("%s大于整个请求的超时(%s)，不会生效", time.Duration(phase.d), time.Duration(t.Request)))
+		}
+	}
+}
+
+// validate 检查TLS配置
+func (t TLSConfig) validate(v *validator) {
+	if t.Fingerprint != "" && TLSFingerprint(strings.ToLower(t.Fingerprint)) != FingerprintGo {
+		if _, ok := fingerprintIDs[TLSFingerprint(strings.ToLower(t.Fingerprint))]; !ok {
+			v.add("tls.fingerprint", fmt.Sprintf("不支持的TLS指纹%q", t.Fingerprint))
+		}
+	}
+	var minV, maxV uint16
+	if t.MinVersion != "" {
+		var err error
+		if minV, err = parseTLSVersion(t.MinVersion); err != nil {
+			v.add("tls.min_version", err.Error())
+		}
+	}
+	if t.MaxVersion != "" {
+		var err error
+		if maxV, err = parseTLSVersion(t.MaxVersion); err != nil {
+			v.add("tls.max_version", err.Error())
+		}
+	}
+	if minV != 0 && maxV != 0 && minV > maxV {
+		v.add("tls.min_version", fmt.Sprintf("%s大于max_version(%s)", t.MinVersion, t.MaxVersion))
+	}
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		v.add("tls", "cert_file和key_file需要同时设置")
+	}
+	v.file("tls.ca_file", t.CAFile)
+	v.file("tls.cert_file", t.CertFile)
+	v.file("tls.key_file", t.KeyFile)
+	if t.CAFile != "" && t.Verify != nil && !*t.Verify {
+		v.add("tls.ca_file", "verify为false，CA文件不会生效")
+	}
+}
+
+// validate 检查DNS配置
+func (d DNSConfig) validate(v *validator) {
+	if d.DoH != "" {
+		if u, err := url.Parse(d.DoH); err != nil || u.Scheme != "https" || u.Host == "" {
+			v.add("dns.doh", fmt.Sprintf("%q不是有效的https地址", d.DoH))
+		}
+		if d.DoT != "" {
+			v.add("dns", "doh和dot只能设置一个")
+		}
+	}
+	for _, host := range slices.Sorted(maps.Keys(d.Hosts)) {
+		if d.Hosts[host] == "" {
+			v.add("dns.hosts."+host, "地址为空")
+		}
+	}
+}
+
+// validator 收集配置错误
+type validator struct {
+	problems []ConfigProblem
+}
+
+func (v *validator) add(field, msg string) {
+	v.problems = append(v.problems, ConfigProblem{Field: field, Message: msg})
+}
+
+func (v *validator) err() error {
+	if len(v.problems) == 0 {
+		return nil
+	}
+	return &ValidationError{Problems: v.problems}
+}
+
+// proxy 检查代理地址，unix为false时不允许Unix套接字代理(代理池和上游组)
+func (v *validator) proxy(field, s string, unix bool) {
+	u, isUnix, err := parseProxyURL(s)
+	switch {
+	case err != nil:
+		v.add(field, err.Error())
+	case isUnix && !unix:
+		v.add(field, "不支持Unix套接字代理")
+	case u.Host == "":
+		v.add(field, fmt.Sprintf("代理地址%q缺少主机", redactProxy(s)))
+	}
+}
+
+// headers 检查请求头的名称和值
+func (v *validator) headers(field string, h map[string]string) {
+	for _, k := range slices.Sorted(maps.Keys(h)) {
+		switch {
+		case !httpguts.ValidHeaderFieldName(k):
+			v.add(field, fmt.Sprintf("无效的请求头名称%q", k))
+		case !httpguts.ValidHeaderFieldValue(h[k]):
+			v.add(field+"."+k, "无效的请求头值")
+		}
+	}
+}
+
+// duration 检查时长不为负数且没有漏写单位
+func (v *validator) duration(field string, d Duration) {
+	switch {
+	case d < 0:
+		v.add(field, "不能为负数")
+	case d > 0 && time.Duration(d) < minTimeout:
+		v.add(field, fmt.Sprintf("%s过短，是否漏写了单位", time.Duration(d)))
+	}
+}
+
+// file 检查文件存在
+func (v *validator) file(field, path string) {
+	if path == "" {
+		return
+	}
+	if _, err := os.Stat(path); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			v.add(field, fmt.Sprintf("文件%s不存在", path))
+		} else {
+			v.add(field, err.Error())
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package goproxy
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfig_Validate(t *testing.T) {
+	cfg, err := ParseConfig([]byte(testConfigYAML), "yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("有效的配置报告错误: %v", err)
+	}
+
+	f := false
+	cfg = &Config{
+		Proxy:       "ftp://127.0.0.1:21",
+		Proxies:     []string{"http://127.0.0.1:8080", "unix:///tmp/proxy.sock", "socks5://"},
+		Browser:     "opera",
+		Headers:     map[string]string{"Bad Name": "1", "X-Ok": "a\nb"},
+		HostHeaders: map[string]map[string]string{"*.example.com": {"X-Ok": "1"}},
+		Timeouts:    TimeoutConfig{Request: Duration(time.Second), Dial: Duration(2 * time.Second), TLSHandshake: 30, IdleConn: -1},
+		TLS: TLSConfig{
+			Verify: &f, Fingerprint: "netscape", CAFile: filepath.Join(t.TempDir(), "missing.pem"),
+			CertFile: "client.pem", MinVersion: "1.3", MaxVersion: "1.2",
+		},
+		DNS:       DNSConfig{DoH: "http://dns.example/dns-query", DoT: "1.1.1.1:853"},
+		Retry:     RetryPolicyConfig{Attempts: -1, Backoff: Duration(time.Minute), MaxBackoff: Duration(time.Second)},
+		RateLimit: RateLimitConfig{UploadBps: -1},
+		Upstreams: map[string][]string{
+			"DIRECT": {"http://127.0.0.1:1"},
+			"empty":  nil,
+			"pool":   {"http://127.0.0.1:2"},
+			"corp":   {"socks5://10.0.0.1:1080"},
+		},
+		Rules: []string{
+			"DOMAIN-SUFFIX,example.com,corp",
+			"DOMAIN,www.example.com,DIRECT",
+			"DOMAIN-SUFFIX,example.com,corp",
+			"DOMAIN-SUFFIX,Example.com.,DIRECT",
+			"IP-CIDR,10.0.0.0/8,missing",
+			"FOO,bar,corp",
+			"MATCH,corp",
+			"DOMAIN,late.example,DIRECT",
+		},
+		MaxRedirects: -1,
+	}
+	err = cfg.Validate()
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("错误为%v", err)
+	}
+	got := make(map[string]string)
+	for _, p := range verr.Problems {
+		got[p.Field] += p.Message + ";"
+	}
+	want := map[string]string{
+		"proxy":                  "不支持的代理协议",
+		"proxies[1]":             "Unix套接字",
+		"proxies[2]":             "缺少主机",
+		"browser":                "opera",
+		"headers":                "Bad Name",
+		"headers.X-Ok":           "无效的请求头值",
+		"timeouts.dial":          "大于整个请求的超时",
+		"timeouts.tls_handshake": "漏写了单位",
+		"timeouts.idle_conn":     "负数",
+		"tls.fingerprint":        "netscape",
+		"tls.min_version":        "大于max_version",
+		"tls":                    "cert_file和key_file",
+		"tls.ca_file":            "verify为false",
+		"tls.cert_file":          "不存在",
+		"dns.doh":                "https",
+		"dns":                    "只能设置一个",
+		"retry.attempts":         "负数",
+		"retry.backoff":          "大于max_backoff",
+		"rate_limit.upload_bps":  "负数",
+		"max_redirects":          "负数",
+		"upstreams.DIRECT":       "内置名称",
+		"upstreams.empty":        "没有代理",
+		"upstreams.pool":         "与proxies冲突",
+		"rules[1]":               "被rules[0]覆盖",
+		"rules[2]":               "与rules[0]重复",
+		"rules[3]":               "与rules[0]冲突",
+		"rules[4]":               "上游missing不存在",
+		"rules[5]":               "不支持的规则类型",
+		"rules[6]":               "与proxies冲突",
+		"rules[7]":               "FINAL之后",
+	}
+	for field, msg := range want {
+		if !strings.Contains(got[field], msg) {
+			t.Errorf("%s: 错误为%q，应包含%q", field, got[field], msg)
+		}
+	}
+	if _, ok := got["host_headers.*.example.com"]; ok {
+		t.Error("有效的按主机请求头报告了错误")
+	}
+	if !strings.HasPrefix(err.Error(), "配置有") {
+		t.Errorf("错误信息为%q", err.Error())
+	}
+}
+
+func TestConfig_ApplyValidates(t *testing.T) {
+	c := New()
+	cfg := &Config{Headers: map[string]string{"X-Test": "1"}, Proxy: "ftp://127.0.0.1"}
+	var verr *ValidationError
+	if err := cfg.Apply(c); !errors.As(err, &verr) {
+		t.Fatalf("错误为%v", err)
+	}
+	if c.GetGlobalHeaders().Get("X-Test") != "" {
+		t.Error("配置无效时修改了客户端")
+	}
+
+	path := filepath.Join(t.TempDir(), "goproxy.yaml")
+	os.WriteFile(path, []byte("proxies: [http://127.0.0.1:1, gopher://x]\nmax_body_size: -1\n"), 0o644)
+	_, err := NewFromConfig(path)
+	if !errors.As(err, &verr) || len(verr.Problems) != 2 {
+		t.Errorf("错误为%v", err)
+	}
+}
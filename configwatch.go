@@ -0,0 +1,341 @@
+package goproxy
+
+import (
+	"bytes"
+	"crypto/tls"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ConfigChange 一次重新加载配置文件的结果
+type ConfigChange struct {
+	Path    string   // 配置文件路径
+	Changed []string // 发生变化的配置项，如"proxy"、"timeouts.request"、"rules"
+	Err     error    // 加载或校验失败的原因，不为nil时新配置被拒绝，客户端保持原有配置
+}
+
+// ConfigWatcher 监视配置文件并在变化时重新应用，由WatchConfig创建
+type ConfigWatcher struct {
+	r        *GoProxy
+	path     string
+	interval time.Duration
+	fn       func(ConfigChange)
+
+	mu      sync.Mutex
+	cfg     *Config // 当前生效的配置
+	data    []byte  // 当前生效的配置文件内容
+	modTime time.Time
+	lastErr string // 最近一次报告的错误，相同的错误不重复回调
+
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// WatchConfig 从配置文件加载并应用配置，之后每隔interval检查文件，内容变化时重新加载:
+// 新配置先在一个临时客户端上完整应用一遍，有任何错误时拒绝整个新配置，客户端保持原有配置；
+// 通过后只重新应用发生变化的配置项，从新配置中删除的配置项恢复为默认值。
+// 新的设置对之后发起的请求生效，进行中的请求不受影响
+// 参数:
+//   - path: 配置文件路径，格式见LoadConfig，加载后以环境变量覆盖，见Config.LoadEnv
+//   - interval: 检查间隔，小于等于0时为1秒
+//   - fn: 每次重新加载后的回调，报告变化的配置项或被拒绝的原因，可以为nil
+func (r *GoProxy) WatchConfig(path string, interval time.Duration, fn func(ConfigChange)) (*ConfigWatcher, error) {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	data, modTime, err := readConfigFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := parseConfigFile(path, data)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.Apply(r); err != nil {
+		return nil, err
+	}
+	w := &ConfigWatcher{
+		r:        r,
+		path:     path,
+		interval: interval,
+		fn:       fn,
+		cfg:      cfg,
+		data:     data,
+		modTime:  modTime,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go w.loop()
+	return w, nil
+}
+
+// Config 返回当前生效的配置
+func (w *ConfigWatcher) Config() *Config {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.cfg
+}
+
+// Reload 立即重新加载配置文件并重新读取环境变量，用于收到SIGHUP等信号时，结果不传给回调
+func (w *ConfigWatcher) Reload() ConfigChange {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.reload(true)
+}
+
+// Close 停止监视，已应用的配置保持不变。重复调用是安全的
+func (w *ConfigWatcher) Close() error {
+	w.once.Do(func() { close(w.stop) })
+	<-w.done
+	return nil
+}
+
+func (w *ConfigWatcher) loop() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+		}
+		w.mu.Lock()
+		change := w.reload(false)
+		report := change.Err != nil || len(change.Changed) > 0
+		if change.Err != nil {
+			// 文件保持错误时只报告一次
+			msg := change.Err.Error()
+			report = msg != w.lastErr
+			w.lastErr = msg
+		} else {
+			w.lastErr = ""
+		}
+		w.mu.Unlock()
+		if report && w.fn != nil {
+			w.fn(change)
+		}
+	}
+}
+
+// reload 读取配置文件，内容变化或force为true时校验并应用新配置，调用方需持有w.mu
+func (w *ConfigWatcher) reload(force bool) ConfigChange {
+	change := ConfigChange{Path: w.path}
+	if !force {
+		if fi, err := os.Stat(w.path); err == nil && fi.ModTime().Equal(w.modTime) {
+			return change
+		}
+	}
+	data, modTime, err := readConfigFile(w.path)
+	if err != nil {
+		change.Err = err
+		return change
+	}
+	// 环境变量的变化不会改变文件，force时总是重新解析
+	if !force && bytes.Equal(data, w.data) {
+		w.modTime = modTime
+		return change
+	}
+	cfg, err := parseConfigFile(w.path, data)
+	if err != nil {
+		change.Err = err
+		return change
+	}
+	r := w.r
+	r.config.mu.Lock()
+	defer r.config.mu.Unlock()
+	// 保持UseProfile选择的配置组，文件中的profile变化时改用新的值
+	profile := r.config.profile
+	if cfg.Profile != w.cfg.Profile {
+		profile = cfg.Profile
+	}
+	change.Changed, err = r.switchConfig(cfg, profile)
+	if err != nil {
+		change.Err = err
+		return change
+	}
+	w.cfg, w.data, w.modTime = cfg, data, modTime
+	return change
+}
+
+// readConfigFile 读取配置文件的内容和修改时间
+func readConfigFile(path string) ([]byte, time.Time, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	data, err := os.ReadFile(path)
+	return data, fi.ModTime(), err
+}
+
+// configDiff 比较两份配置，返回发生变化的配置项，嵌套的配置项以"."连接，如"timeouts.request"
+func configDiff(old, new *Config) []string {
+	var changed []string
+	var walk func(prefix string, a, b reflect.Value)
+	walk = func(prefix string, a, b reflect.Value) {
+		t := a.Type()
+		for i := 0; i < t.NumField(); i++ {
+			name := prefix + strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]
+			fa, fb := a.Field(i), b.Field(i)
+			if fa.Kind() == reflect.Struct {
+				walk(name+".", fa, fb)
+				continue
+			}
+			if !reflect.DeepEqual(fa.Interface(), fb.Interface()) {
+				changed = append(changed, name)
+			}
+		}
+	}
+	walk("", reflect.ValueOf(old).Elem(), reflect.ValueOf(new).Elem())
+	return changed
+}
+
+// reapply 重新应用changed中的配置项，值为零的配置项恢复为客户端的默认值
+func (c *Config) reapply(r *GoProxy, old *Config, changed []string) error {
+	sections := make(map[string]bool)
+	for _, name := range changed {
+		section, _, _ := strings.Cut(name, ".")
+		sections[section] = true
+	}
+	// 删除浏览器身份时一并删除其请求头，全局请求头需要重新设置
+	if sections["browser"] {
+		if p, ok := browserProfiles[strings.ToLower(old.Browser)]; ok {
+			for k := range p.Headers {
+				r.DelGlobalHeader(k)
+			}
+			r.SetHeaderOrder()
+			r.SetTLSFingerprint(FingerprintGo)
+		}
+		if c.Browser != "" {
+			if err := r.SetProfile(browserProfiles[strings.ToLower(c.Browser)]); err != nil {
+				return err
+			}
+		}
+		if r.GetGlobalHeaders().Get("User-Agent") == "" {
+			r.SetGlobalHeader("User-Agent", DefaultUA)
+		}
+		sections["headers"], sections["tls"] = true, true
+	}
+	if sections["headers"] {
+		for k := range old.Headers {
+			if _, ok := c.Headers[k]; !ok {
+				r.DelGlobalHeader(k)
+			}
+		}
+		for k, v := range c.Headers {
+			r.SetGlobalHeader(k, v)
+		}
+	}
+	if sections["host_headers"] {
+		for pattern := range old.HostHeaders {
+			r.DelHostHeaders(pattern)
+		}
+		for pattern, headers := range c.HostHeaders {
+			h := make(http.Header, len(headers))
+			for k, v := range headers {
+				h.Set(k, v)
+			}
+			r.AddHostHeaders(pattern, h)
+		}
+	}
+	if sections["user_agents"] {
+		r.SetUserAgents(c.UserAgents, UARandom)
+	}
+	if sections["proxy"] {
+		if err := r.SetProxy(c.Proxy); err != nil {
+			return err
+		}
+	}
+	if sections["proxies"] || sections["upstreams"] || sections["rules"] {
+		rt, err := c.router()
+		if err != nil {
+			return err
+		}
+		r.SetRouter(rt)
+	}
+	if sections["timeouts"] {
+		t := c.Timeouts
+		timeout := time.Duration(t.Request)
+		if timeout <= 0 {
+			timeout = DefaultTimeout
+		}
+		r.SetTimeout(timeout)
+		r.SetDialTimeout(time.Duration(t.Dial))
+		r.SetTLSHandshakeTimeout(time.Duration(t.TLSHandshake))
+		r.SetResponseHeaderTimeout(time.Duration(t.ResponseHeader))
+		r.SetIdleConnTimeout(time.Duration(t.IdleConn))
+	}
+	if sections["tls"] {
+		if err := c.reapplyTLS(r, old); err != nil {
+			return err
+		}
+	}
+	if sections["http2"] {
+		r.EnableHTTP2(c.HTTP2 != nil && *c.HTTP2)
+	}
+	if sections["dns"] {
+		if c.DNS.DoH == "" && c.DNS.DoT == "" {
+			r.SetResolver(nil)
+		}
+		for host := range old.DNS.Hosts {
+			r.SetHostOverride(host, "")
+		}
+		r.EnableDNSCache(c.DNS.Cache)
+		if err := c.DNS.apply(r); err != nil {
+			return err
+		}
+	}
+	if sections["retry"] {
+		r.setRetryPolicy(c.Retry.policy())
+	}
+	if sections["rate_limit"] {
+		r.SetBandwidthLimit(c.RateLimit.DownloadBps, c.RateLimit.UploadBps)
+	}
+	if sections["max_redirects"] {
+		r.SetMaxRedirects(c.MaxRedirects)
+	}
+	if sections["max_body_size"] {
+		r.SetMaxBodySize(c.MaxBodySize)
+	}
+	return nil
+}
+
+// reapplyTLS 重新应用TLS配置，删除的配置项恢复为默认值
+func (c *Config) reapplyTLS(r *GoProxy, old *Config) error {
+	t := c.TLS
+	r.SetTLSVerify(t.Verify != nil && *t.Verify)
+	fp := TLSFingerprint(strings.ToLower(t.Fingerprint))
+	if fp == "" {
+		fp = browserProfiles[strings.ToLower(c.Browser)].Fingerprint
+	}
+	if err := r.SetTLSFingerprint(fp); err != nil {
+		return err
+	}
+	if t.CAFile != old.TLS.CAFile {
+		r.SetRootCAs(nil)
+	}
+	if t.CertFile == "" && old.TLS.CertFile != "" {
+		r.mu.Lock()
+		r.updateTLSConfig(func(cfg *tls.Config) {
+			cfg.Certificates = nil
+		})
+		r.mu.Unlock()
+	}
+	versions := t
+	versions.Verify, versions.Fingerprint = nil, ""
+	if t.CAFile == old.TLS.CAFile {
+		versions.CAFile = ""
+	}
+	if versions.MinVersion == "" {
+		r.SetTLSMinVersion(0)
+	}
+	if versions.MaxVersion == "" {
+		r.SetTLSMaxVersion(0)
+	}
+	return versions.apply(r)
+}
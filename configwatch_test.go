@@ -0,0 +1,108 @@
+package goproxy
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConfigDiff(t *testing.T) {
+	verify := true
+	old := &Config{Proxy: "http://a", Headers: map[string]string{"X": "1"}, Timeouts: TimeoutConfig{Dial: Duration(time.Second)}}
+	new := &Config{Proxy: "http://b", Headers: map[string]string{"X": "1"}, Timeouts: TimeoutConfig{Request: Duration(time.Second)}, TLS: TLSConfig{Verify: &verify}}
+	want := []string{"proxy", "timeouts.request", "timeouts.dial", "tls.verify"}
+	if got := configDiff(old, new); !reflect.DeepEqual(got, want) {
+		t.Errorf("变化的配置项为%v", got)
+	}
+	if got := configDiff(old, old); len(got) != 0 {
+		t.Errorf("相同配置的变化为%v", got)
+	}
+}
+
+func TestGoProxy_WatchConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "client.yaml")
+	write := func(data string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		// 保证修改时间变化
+		future := time.Now().Add(time.Duration(len(data)) * time.Second)
+		os.Chtimes(path, future, future)
+	}
+	write("proxy: http://127.0.0.1:8080\nheaders:\n  X-Old: \"1\"\ntimeouts:\n  dial: 5s\n")
+
+	var mu sync.Mutex
+	var changes []ConfigChange
+	c := New()
+	defer c.Close()
+	w, err := c.WatchConfig(path, 10*time.Millisecond, func(ch ConfigChange) {
+		mu.Lock()
+		changes = append(changes, ch)
+		mu.Unlock()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if c.String() != "http://127.0.0.1:8080" || c.GetGlobalHeaders().Get("X-Old") != "1" {
+		t.Fatalf("初始配置没有生效: 代理为%q", c.String())
+	}
+	wait := func(n int) ConfigChange {
+		t.Helper()
+		for deadline := time.Now().Add(3 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+			mu.Lock()
+			if len(changes) >= n {
+				ch := changes[n-1]
+				mu.Unlock()
+				return ch
+			}
+			mu.Unlock()
+		}
+		t.Fatalf("没有收到第%d次回调", n)
+		return ConfigChange{}
+	}
+
+	// 删除的配置项恢复默认值
+	write("proxy: socks5://127.0.0.1:1080\nheaders:\n  X-New: \"2\"\ntimeouts:\n  request: 3s\n")
+	ch := wait(1)
+	if ch.Err != nil || !reflect.DeepEqual(ch.Changed, []string{"proxy", "headers", "timeouts.request", "timeouts.dial"}) {
+		t.Errorf("第一次变化为%+v", ch)
+	}
+	h := c.GetGlobalHeaders()
+	if c.String() != "socks5://127.0.0.1:1080" || h.Get("X-Old") != "" || h.Get("X-New") != "2" || c.GetTimeout() != 3*time.Second {
+		t.Errorf("重新加载后代理为%q，请求头为%v，超时为%v", c.String(), h, c.GetTimeout())
+	}
+
+	// 无效的配置被拒绝，原配置保持不变
+	write("proxy: socks5://127.0.0.1:1080\nrules:\n  - DOMAIN,example.com,missing\n")
+	ch = wait(2)
+	if ch.Err == nil || !strings.Contains(ch.Err.Error(), "missing") || len(ch.Changed) != 0 {
+		t.Errorf("无效配置的结果为%+v", ch)
+	}
+	if c.GetRouter() != nil || c.GetTimeout() != 3*time.Second || w.Config().Timeouts.Request != Duration(3*time.Second) {
+		t.Error("无效的配置被应用")
+	}
+
+	// 恢复有效后重新应用
+	write("timeouts:\n  request: 3s\n")
+	ch = wait(3)
+	if ch.Err != nil || c.String() != "" || c.GetGlobalHeaders().Get("X-New") != "" {
+		t.Errorf("恢复后的结果为%+v，代理为%q", ch, c.String())
+	}
+
+	w.Close()
+	w.Close()
+	write("proxy: http://127.0.0.1:9999\n")
+	if ch := w.Reload(); ch.Err != nil || c.String() != "http://127.0.0.1:9999" {
+		t.Errorf("手动重新加载的结果为%+v，代理为%q", ch, c.String())
+	}
+
+	if _, err := New().WatchConfig(filepath.Join(t.TempDir(), "missing.yaml"), 0, nil); err == nil {
+		t.Error("文件不存在时应返回错误")
+	}
+}
@@ -0,0 +1,223 @@
+package goproxy
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// ConnStats 连接统计快照，可直接序列化为JSON供监控系统采集，用于排查端口耗尽、连接池过小等容量问题
+type ConnStats struct {
+	Dials      int64           `json:"dials"`       // 累计拨号次数
+	DialErrors int64           `json:"dial_errors"` // 累计拨号失败次数
+	Open       int             `json:"open"`        // 当前打开的连接数
+	Idle       int             `json:"idle"`        // 当前空闲(没有进行中的请求)的连接数
+	Requests   int64           `json:"requests"`    // 累计获取到连接的请求数
+	Reused     int64           `json:"reused"`      // 其中复用已有连接的请求数
+	ReuseRatio float64         `json:"reuse_ratio"` // 连接复用率(0-1)
+	InFlight   int64           `json:"in_flight"`   // 进行中的请求数，响应体关闭前都计为进行中
+	Hosts      []HostConnStats `json:"hosts"`       // 按连接地址统计，按地址排序
+}
+
+// HostConnStats 单个连接地址的连接统计
+type HostConnStats struct {
+	Addr string `json:"addr"` // 连接地址，直接连接或通过隧道时为目标地址，HTTP代理转发http请求时为代理地址
+	Open int    `json:"open"` // 当前打开的连接数
+	Idle int    `json:"idle"` // 当前空闲的连接数
+}
+
+// connTracker 跟踪dialContext建立的所有连接
+type connTracker struct {
+	mu         sync.Mutex
+	conns      map[*trackedConn]struct{}
+	dials      int64
+	dialErrors int64
+	requests   int64
+	reused     int64
+	closed     bool // 客户端已关闭，连接上的请求结束后直接关闭连接
+}
+
+func newConnTracker() *connTracker {
+	return &connTracker{conns: make(map[*trackedConn]struct{})}
+}
+
+// track 记录一次拨号结果，成功时返回跟踪关闭的连接
+func (t *connTracker) track(addr string, conn net.Conn, err error) net.Conn {
+	if t == nil {
+		return conn
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.dials++
+	if err != nil {
+		t.dialErrors++
+		return conn
+	}
+	tc := &trackedConn{Conn: conn, addr: addr, tracker: t}
+	t.conns[tc] = struct{}{}
+	return tc
+}
+
+// gotConn 记录请求获取到的连接，返回请求结束时调用的函数
+func (t *connTracker) gotConn(info httptrace.GotConnInfo) func() {
+	t.mu.Lock()
+	t.requests++
+	if info.Reused {
+		t.reused++
+	}
+	t.mu.Unlock()
+	tc := unwrapTrackedConn(info.Conn)
+	if tc == nil {
+		return func() {}
+	}
+	tc.active.Add(1)
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			if tc.active.Add(-1) == 0 && t.isClosed() {
+				tc.Close()
+			}
+		})
+	}
+}
+
+// closeAfterUse 使正在使用的连接在其上的请求结束后关闭，不再放回连接池复用
+func (t *connTracker) closeAfterUse() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closed = true
+}
+
+func (t *connTracker) isClosed() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.closed
+}
+
+// snapshot 返回统计快照
+func (t *connTracker) snapshot() ConnStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := ConnStats{
+		Dials:      t.dials,
+		DialErrors: t.dialErrors,
+		Open:       len(t.conns),
+		Requests:   t.requests,
+		Reused:     t.reused,
+	}
+	if t.requests > 0 {
+		s.ReuseRatio = float64(t.reused) / float64(t.requests)
+	}
+	hosts := make(map[string]*HostConnStats)
+	for tc := range t.conns {
+		h := hosts[tc.addr]
+		if h == nil {
+			h = &HostConnStats{Addr: tc.addr}
+			hosts[tc.addr] = h
+		}
+		h.Open++
+		if tc.active.Load() <= 0 {
+			h.Idle++
+			s.Idle++
+		}
+	}
+	for _, h := range hosts {
+		s.Hosts = append(s.Hosts, *h)
+	}
+	sort.Slice(s.Hosts, func(i, j int) bool { return s.Hosts[i].Addr < s.Hosts[j].Addr })
+	return s
+}
+
+// reset 清空累计计数，当前打开的连接保持跟踪
+func (t *connTracker) reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.dials, t.dialErrors, t.requests, t.reused = 0, 0, 0, 0
+}
+
+// trackedConn 关闭时从connTracker中移除的连接
+type trackedConn struct {
+	net.Conn
+	addr    string
+	tracker *connTracker
+	active  atomic.Int32 // 进行中的请求数
+	once    sync.Once
+}
+
+func (c *trackedConn) Close() error {
+	c.once.Do(func() {
+		c.tracker.mu.Lock()
+		delete(c.tracker.conns, c)
+		c.tracker.mu.Unlock()
+	})
+	return c.Conn.Close()
+}
+
+// NetConn 返回被包装的连接
+func (c *trackedConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+// unwrapTrackedConn 沿NetConn逐层解开TLS等包装，找到其中的trackedConn
+func unwrapTrackedConn(conn net.Conn) *trackedConn {
+	for conn != nil {
+		if tc, ok := conn.(*trackedConn); ok {
+			return tc
+		}
+		u, ok := conn.(interface{ NetConn() net.Conn })
+		if !ok {
+			return nil
+		}
+		conn = u.NetConn()
+	}
+	return nil
+}
+
+// traceConn 在请求的context中加入记录所获取连接的ClientTrace，返回请求结束时调用的函数
+func (t *connTracker) traceConn(req *http.Request) (*http.Request, func()) {
+	var mu sync.Mutex
+	done := func() {}
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			release := t.gotConn(info)
+			mu.Lock()
+			done = release
+			mu.Unlock()
+		},
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+	return req, func() {
+		mu.Lock()
+		release := done
+		mu.Unlock()
+		release()
+	}
+}
+
+// onCloseBody 关闭后调用onClose的响应体
+type onCloseBody struct {
+	io.ReadCloser
+	onClose func()
+}
+
+func (b *onCloseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.onClose()
+	return err
+}
+
+// ConnStats 返回连接统计，包括拨号次数、当前打开和空闲的连接数、连接复用率以及进行中的请求数
+func (r *GoProxy) ConnStats() ConnStats {
+	s := r.transport.conns.snapshot()
+	s.InFlight = r.transport.inFlight.Load()
+	return s
+}
+
+// ResetConnStats 清空累计的拨号和复用计数，当前连接数不受影响
+func (r *GoProxy) ResetConnStats() {
+	r.transport.conns.reset()
+}
@@ -0,0 +1,53 @@
+package goproxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestGoProxy_ConnStats(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	c := New()
+	for i := 0; i < 3; i++ {
+		getBody(t, c, srv.URL)
+	}
+	resp, err := c.GetClient().Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := c.ConnStats()
+	if s.Dials != 1 || s.Open != 1 || s.Idle != 0 || s.Requests != 4 || s.Reused != 3 || s.ReuseRatio != 0.75 || s.InFlight != 1 {
+		t.Errorf("请求进行中的统计为%+v", s)
+	}
+	resp.Body.Close()
+	s = c.ConnStats()
+	if s.Idle != 1 || s.InFlight != 0 || len(s.Hosts) != 1 || s.Hosts[0] != (HostConnStats{Addr: u.Host, Open: 1, Idle: 1}) {
+		t.Errorf("请求结束后的统计为%+v", s)
+	}
+
+	c.GetTransport().CloseIdleConnections()
+	// Transport在后台关闭连接
+	for deadline := time.Now().Add(time.Second); c.ConnStats().Open != 0 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err := c.GetClient().Get("http://127.0.0.1:1"); err == nil {
+		t.Fatal("连接关闭的端口应返回错误")
+	}
+	s = c.ConnStats()
+	if s.Open != 0 || s.Dials != 2 || s.DialErrors != 1 {
+		t.Errorf("关闭连接后的统计为%+v", s)
+	}
+	c.ResetConnStats()
+	if s := c.ConnStats(); s.Dials != 0 || s.Requests != 0 {
+		t.Errorf("清空后的统计为%+v", s)
+	}
+}
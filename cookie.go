@@ -0,0 +1,413 @@
+package goproxy
+
+import (
+	"cmp"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// cookieEntry 保存在CookieJar中的单个Cookie
+type cookieEntry struct {
+	Name     string        `json:"name"`
+	Value    string        `json:"value"`
+	Quoted   bool          `json:"quoted,omitempty"`
+	Domain   string        `json:"domain"`            // 所属域名，不含前导点
+	Path     string        `json:"path"`              // 路径
+	HostOnly bool          `json:"host_only"`         // 是否只发送给Domain本身，不发送给子域名
+	Secure   bool          `json:"secure"`            // 是否只通过HTTPS发送
+	HttpOnly bool          `json:"http_only"`         // 是否禁止脚本访问
+	SameSite http.SameSite `json:"same_site"`         // SameSite属性
+	Expires  time.Time     `json:"expires,omitzero"`  // 过期时间，零值表示会话Cookie
+	Creation time.Time     `json:"creation,omitzero"` // 创建时间，用于发送时排序
+	seq      uint64        // 保存顺序，创建时间相同时用于排序
+}
+
+// expired 判断Cookie在now时是否已过期，会话Cookie永不过期
+func (e *cookieEntry) expired(now time.Time) bool {
+	return !e.Expires.IsZero() && !e.Expires.After(now)
+}
+
+// cookie 转换为http.Cookie，保留域名、路径等属性
+func (e *cookieEntry) cookie() *http.Cookie {
+	c := &http.Cookie{
+		Name:     e.Name,
+		Value:    e.Value,
+		Quoted:   e.Quoted,
+		Path:     e.Path,
+		Secure:   e.Secure,
+		HttpOnly: e.HttpOnly,
+		SameSite: e.SameSite,
+		Expires:  e.Expires,
+	}
+	if !e.HostOnly {
+		c.Domain = e.Domain
+	}
+	return c
+}
+
+// CookieJar 实现http.CookieJar的Cookie存储，按RFC 6265匹配域名和路径，
+// 与net/http/cookiejar不同的是可以按域名列出和删除Cookie
+type CookieJar struct {
+	mu      sync.Mutex
+	entries map[string]map[string]*cookieEntry // 域名 -> 名称;路径 -> Cookie
+	seq     uint64                             // 最近保存的Cookie序号
+	policy  cookiePolicy                       // 保存和发送策略，见cookiepolicy.go
+
+	// 文件持久化，见NewFileCookieJar
+	file       string        // 保存Cookie的文件
+	flushDelay time.Duration // 自动写入延迟，为0时不自动写入
+	flushTimer *time.Timer   // 已安排的自动写入
+	dirty      bool          // 上次写入后Cookie是否有变化
+	flushMu    sync.Mutex    // 保证同一时间只有一次写入
+}
+
+// NewCookieJar 创建空的CookieJar，使用公共后缀列表拒绝为"com"、"co.uk"等公共后缀设置的Cookie
+func NewCookieJar() *CookieJar {
+	return &CookieJar{entries: make(map[string]map[string]*cookieEntry)}
+}
+
+// SetCookies 实现http.CookieJar接口，保存响应u中设置的Cookie
+// 域名不匹配或为公共后缀的Cookie被忽略，Max-Age小于0或已过期的Cookie删除已有的同名Cookie；
+// 只读、禁用的域名和过滤函数见SetReadOnly、SetBlockedDomains和SetFilter
+func (j *CookieJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	host, ok := cookieHost(u)
+	if !ok {
+		return
+	}
+	j.mu.Lock()
+	p := j.policy
+	j.mu.Unlock()
+	if p.readOnly || p.blocks(host) {
+		return
+	}
+	if p.filter != nil {
+		// 过滤函数由调用方提供，不能持有锁调用
+		kept := make([]*http.Cookie, 0, len(cookies))
+		for _, c := range cookies {
+			if p.filter(u, c) {
+				kept = append(kept, c)
+			}
+		}
+		cookies = kept
+	}
+
+	now := time.Now()
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	changed := false
+	for _, c := range cookies {
+		e, ok := newCookieEntry(c, host, u.Path, now)
+		if !ok {
+			continue
+		}
+		key := e.Name + ";" + e.Path
+		if e.expired(now) {
+			if _, ok := j.entries[e.Domain][key]; ok {
+				delete(j.entries[e.Domain], key)
+				changed = true
+			}
+			if len(j.entries[e.Domain]) == 0 {
+				delete(j.entries, e.Domain)
+			}
+			continue
+		}
+		j.put(key, e)
+		changed = true
+	}
+	if changed {
+		j.changed()
+	}
+}
+
+// put 保存e，替换同名Cookie时保留原创建时间，调用方需持有j.mu
+func (j *CookieJar) put(key string, e *cookieEntry) {
+	m := j.entries[e.Domain]
+	if m == nil {
+		m = make(map[string]*cookieEntry)
+		j.entries[e.Domain] = m
+	}
+	j.seq++
+	e.seq = j.seq
+	if old, ok := m[key]; ok {
+		e.Creation, e.seq = old.Creation, old.seq
+	}
+	m[key] = e
+}
+
+// Cookies 实现http.CookieJar接口，返回请求u应携带的Cookie
+// 路径较长的Cookie排在前面，路径长度相同时先创建的排在前面
+func (j *CookieJar) Cookies(u *url.URL) []*http.Cookie {
+	host, ok := cookieHost(u)
+	if !ok {
+		return nil
+	}
+	secure := u.Scheme == "https" || u.Scheme == "wss"
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+	now := time.Now()
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.policy.blocks(host) {
+		return nil
+	}
+	var selected []*cookieEntry
+	// 依次检查host及其各级父域名
+	for domain := host; ; {
+		for key, e := range j.entries[domain] {
+			if e.expired(now) {
+				delete(j.entries[domain], key)
+				continue
+			}
+			if e.HostOnly && domain != host || e.Secure && !secure || !pathMatch(path, e.Path) {
+				continue
+			}
+			selected = append(selected, e)
+		}
+		if len(j.entries[domain]) == 0 {
+			delete(j.entries, domain)
+		}
+		i := strings.IndexByte(domain, '.')
+		if i < 0 || net.ParseIP(host) != nil {
+			break
+		}
+		domain = domain[i+1:]
+	}
+	slices.SortFunc(selected, func(a, b *cookieEntry) int {
+		if n := len(b.Path) - len(a.Path); n != 0 {
+			return n
+		}
+		if n := a.Creation.Compare(b.Creation); n != 0 {
+			return n
+		}
+		return cmp.Compare(a.seq, b.seq)
+	})
+	cookies := make([]*http.Cookie, len(selected))
+	for i, e := range selected {
+		cookies[i] = &http.Cookie{Name: e.Name, Value: e.Value, Quoted: e.Quoted}
+	}
+	return cookies
+}
+
+// DomainCookies 返回domain及其子域名下所有未过期的Cookie，包含域名、路径、过期时间等属性；
+// domain为空时返回全部Cookie
+func (j *CookieJar) DomainCookies(domain string) []*http.Cookie {
+	domain = canonicalCookieDomain(domain)
+	now := time.Now()
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	var entries []*cookieEntry
+	for d, m := range j.entries {
+		if !domainWithin(d, domain) {
+			continue
+		}
+		for _, e := range m {
+			if !e.expired(now) {
+				entries = append(entries, e)
+			}
+		}
+	}
+	sortCookieEntries(entries)
+	cookies := make([]*http.Cookie, len(entries))
+	for i, e := range entries {
+		cookies[i] = e.cookie()
+	}
+	return cookies
+}
+
+// DeleteDomain 删除domain及其子域名下的所有Cookie，domain为空时删除全部Cookie
+func (j *CookieJar) DeleteDomain(domain string) {
+	domain = canonicalCookieDomain(domain)
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for d := range j.entries {
+		if domainWithin(d, domain) {
+			delete(j.entries, d)
+			j.changed()
+		}
+	}
+}
+
+// sortCookieEntries 按域名、路径、名称排序，使列出和保存的结果稳定
+func sortCookieEntries(entries []*cookieEntry) {
+	slices.SortFunc(entries, func(a, b *cookieEntry) int {
+		return strings.Compare(a.Domain+";"+a.Path+";"+a.Name, b.Domain+";"+b.Path+";"+b.Name)
+	})
+}
+
+// clone 复制CookieJar中的所有Cookie，新的CookieJar不绑定文件
+func (j *CookieJar) clone() *CookieJar {
+	c := NewCookieJar()
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for d, m := range j.entries {
+		cm := make(map[string]*cookieEntry, len(m))
+		for key, e := range m {
+			e2 := *e
+			cm[key] = &e2
+		}
+		c.entries[d] = cm
+	}
+	c.seq = j.seq
+	c.policy = j.policy.clone()
+	return c
+}
+
+// newCookieEntry 按RFC 6265第5.3节处理响应中的Cookie，不应保存时返回false
+func newCookieEntry(c *http.Cookie, host, reqPath string, now time.Time) (*cookieEntry, bool) {
+	if c.Name == "" {
+		return nil, false
+	}
+	e := &cookieEntry{
+		Name:     c.Name,
+		Value:    c.Value,
+		Quoted:   c.Quoted,
+		Path:     c.Path,
+		Secure:   c.Secure,
+		HttpOnly: c.HttpOnly,
+		SameSite: c.SameSite,
+		Creation: now,
+	}
+	switch {
+	case c.MaxAge < 0:
+		e.Expires = time.Unix(1, 0)
+	case c.MaxAge > 0:
+		e.Expires = now.Add(time.Duration(c.MaxAge) * time.Second)
+	case !c.Expires.IsZero():
+		e.Expires = c.Expires
+	}
+
+	domain := canonicalCookieDomain(c.Domain)
+	if domain == "" || domain == host {
+		e.Domain, e.HostOnly = host, c.Domain == ""
+	} else {
+		// IP地址只能设置为主机Cookie
+		if net.ParseIP(host) != nil || !strings.HasSuffix(host, "."+domain) {
+			return nil, false
+		}
+		e.Domain = domain
+	}
+	if !e.HostOnly && net.ParseIP(host) == nil {
+		if ps, _ := publicsuffix.PublicSuffix(e.Domain); ps == e.Domain {
+			if e.Domain != host {
+				return nil, false
+			}
+			e.HostOnly = true
+		}
+	}
+
+	if e.Path == "" || e.Path[0] != '/' {
+		e.Path = defaultCookiePath(reqPath)
+	}
+	return e, true
+}
+
+// cookieHost 返回u中用于匹配Cookie的主机名，不是HTTP(S)或WebSocket地址时返回false
+func cookieHost(u *url.URL) (string, bool) {
+	switch u.Scheme {
+	case "http", "https", "ws", "wss":
+	default:
+		return "", false
+	}
+	host := canonicalCookieDomain(u.Hostname())
+	return host, host != ""
+}
+
+// canonicalCookieDomain 转为小写并去掉前导点和末尾的点，国际化域名转换为punycode
+func canonicalCookieDomain(domain string) string {
+	return normalizeHost(strings.Trim(domain, "."))
+}
+
+// domainWithin 判断d是否等于domain或为其子域名，domain为空时总是返回true
+func domainWithin(d, domain string) bool {
+	return domain == "" || d == domain || strings.HasSuffix(d, "."+domain)
+}
+
+// defaultCookiePath 按RFC 6265第5.1.4节计算默认路径
+func defaultCookiePath(path string) string {
+	i := strings.LastIndexByte(path, '/')
+	if i <= 0 {
+		return "/"
+	}
+	return path[:i]
+}
+
+// pathMatch 按RFC 6265第5.1.4节判断请求路径是否匹配Cookie路径
+func pathMatch(reqPath, cookiePath string) bool {
+	if !strings.HasPrefix(reqPath, cookiePath) {
+		return false
+	}
+	return len(reqPath) == len(cookiePath) || strings.HasSuffix(cookiePath, "/") || reqPath[len(cookiePath)] == '/'
+}
+
+// EnableCookies 开启或关闭Cookie管理，开启后响应设置的Cookie会保存并在后续请求中自动携带
+// 关闭时丢弃已保存的Cookie；重复开启不会清空已有的Cookie
+func (r *GoProxy) EnableCookies(enable bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !enable {
+		r.client.Jar = nil
+	} else if r.client.Jar == nil {
+		r.client.Jar = NewCookieJar()
+	}
+}
+
+// GetCookieJar 返回当前使用的CookieJar，未开启Cookie管理或使用了其他http.CookieJar实现时返回nil
+func (r *GoProxy) GetCookieJar() *CookieJar {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	jar, _ := r.client.Jar.(*CookieJar)
+	return jar
+}
+
+// GetCookies 返回domain及其子域名下保存的Cookie，domain为空时返回全部Cookie
+func (r *GoProxy) GetCookies(domain string) []*http.Cookie {
+	if jar := r.GetCookieJar(); jar != nil {
+		return jar.DomainCookies(domain)
+	}
+	return nil
+}
+
+// SetCookies 手动保存Cookie，如导入浏览器中的登录状态，需先调用EnableCookies开启Cookie管理
+// 参数:
+//   - rawURL: Cookie所属的地址，未指定Domain和Path的Cookie按该地址设置
+//   - cookies: 要保存的Cookie
+func (r *GoProxy) SetCookies(rawURL string, cookies []*http.Cookie) error {
+	jar := r.GetCookieJar()
+	if jar == nil {
+		return errors.New("未开启Cookie管理")
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if _, ok := cookieHost(u); !ok {
+		return errors.New("Cookie地址必须是http或https URL")
+	}
+	jar.SetCookies(u, cookies)
+	return nil
+}
+
+// DelCookies 删除domain及其子域名下保存的Cookie
+func (r *GoProxy) DelCookies(domain string) {
+	if jar := r.GetCookieJar(); jar != nil && domain != "" {
+		jar.DeleteDomain(domain)
+	}
+}
+
+// ClearCookies 删除保存的全部Cookie
+func (r *GoProxy) ClearCookies() {
+	if jar := r.GetCookieJar(); jar != nil {
+		jar.DeleteDomain("")
+	}
+}
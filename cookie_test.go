@@ -0,0 +1,114 @@
+package goproxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+var _ http.CookieJar = (*CookieJar)(nil)
+
+// newTestCookieServer /login设置example.com域Cookie和主机Cookie，其他路径返回请求携带的Cookie
+func newTestCookieServer(t *testing.T) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc", Domain: "example.com", Path: "/"})
+			http.SetCookie(w, &http.Cookie{Name: "host", Value: "1"})
+			return
+		}
+		io.WriteString(w, r.Header.Get("Cookie"))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestGoProxy_EnableCookies(t *testing.T) {
+	srv := newTestCookieServer(t)
+	u, _ := url.Parse(srv.URL)
+
+	c := New()
+	c.SetHostOverride("*.example.com", u.Host)
+	getBody(t, c, "http://www.example.com/login")
+	if got := getBody(t, c, "http://www.example.com/echo"); got != "" {
+		t.Errorf("未开启时携带了Cookie: %q", got)
+	}
+
+	c.EnableCookies(true)
+	getBody(t, c, "http://www.example.com/login")
+	if got := getBody(t, c, "http://www.example.com/echo"); got != "session=abc; host=1" {
+		t.Errorf("Cookie为%q", got)
+	}
+	if got := getBody(t, c, "http://api.example.com/echo"); got != "session=abc" {
+		t.Errorf("子域名Cookie为%q", got)
+	}
+	if n := len(c.GetCookies("example.com")); n != 2 {
+		t.Errorf("example.com下有%d个Cookie", n)
+	}
+	if n := len(c.GetCookies("api.example.com")); n != 0 {
+		t.Errorf("api.example.com下有%d个Cookie", n)
+	}
+
+	clone := c.Clone()
+	c.DelCookies("example.com")
+	if got := getBody(t, c, "http://www.example.com/echo"); got != "" {
+		t.Errorf("删除后Cookie为%q", got)
+	}
+	if got := getBody(t, clone, "http://www.example.com/echo"); got != "session=abc; host=1" {
+		t.Errorf("克隆的客户端Cookie为%q", got)
+	}
+
+	if err := c.SetCookies("http://www.example.com/", []*http.Cookie{{Name: "manual", Value: "x"}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := getBody(t, c, "http://www.example.com/echo"); got != "manual=x" {
+		t.Errorf("手动设置后Cookie为%q", got)
+	}
+	c.EnableCookies(false)
+	if c.GetCookieJar() != nil || c.SetCookies("http://www.example.com/", nil) == nil {
+		t.Error("关闭后不应保存Cookie")
+	}
+}
+
+func TestCookieJar(t *testing.T) {
+	jar := NewCookieJar()
+	set := func(rawURL string, cookies ...*http.Cookie) {
+		u, _ := url.Parse(rawURL)
+		jar.SetCookies(u, cookies)
+	}
+	get := func(rawURL string) (names []string) {
+		u, _ := url.Parse(rawURL)
+		for _, c := range jar.Cookies(u) {
+			names = append(names, c.Name)
+		}
+		return names
+	}
+
+	set("https://www.example.co.uk/a/b",
+		&http.Cookie{Name: "suffix", Domain: "co.uk"},   // 公共后缀，应被拒绝
+		&http.Cookie{Name: "other", Domain: "other.uk"}, // 域名不匹配，应被拒绝
+		&http.Cookie{Name: "dir"},                       // 默认路径为/a
+		&http.Cookie{Name: "root", Path: "/", Secure: true},
+		&http.Cookie{Name: "old", MaxAge: -1},
+	)
+	if got := get("https://www.example.co.uk/a/c"); len(got) != 2 || got[0] != "dir" || got[1] != "root" {
+		t.Errorf("HTTPS请求的Cookie为%v", got)
+	}
+	if got := get("http://www.example.co.uk/ab"); len(got) != 0 {
+		t.Errorf("路径不匹配的HTTP请求Cookie为%v", got)
+	}
+
+	set("https://www.example.co.uk/", &http.Cookie{Name: "root", MaxAge: -1})
+	if got := get("https://www.example.co.uk/a"); len(got) != 1 || got[0] != "dir" {
+		t.Errorf("删除后Cookie为%v", got)
+	}
+
+	set("http://127.0.0.1/", &http.Cookie{Name: "ip"}, &http.Cookie{Name: "bad", Domain: "0.0.1"})
+	if got := get("http://127.0.0.1/"); len(got) != 1 || got[0] != "ip" {
+		t.Errorf("IP地址的Cookie为%v", got)
+	}
+	if n := len(jar.DomainCookies("")); n != 2 {
+		t.Errorf("共有%d个Cookie", n)
+	}
+}
@@ -0,0 +1,310 @@
+package goproxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CookieFormat Cookie文件格式
+type CookieFormat int
+
+const (
+	// CookieJSON JSON数组格式，保留SameSite、创建时间等全部属性
+	CookieJSON CookieFormat = iota
+	// CookieNetscape Netscape cookies.txt格式，可与curl、wget及浏览器扩展互相导入导出
+	CookieNetscape
+)
+
+// cookieFormatOf 按扩展名判断Cookie文件格式，.txt为Netscape格式，其他为JSON格式
+func cookieFormatOf(path string) CookieFormat {
+	if strings.EqualFold(filepath.Ext(path), ".txt") {
+		return CookieNetscape
+	}
+	return CookieJSON
+}
+
+// Save 将未过期的Cookie(包括会话Cookie)按format格式写入w
+func (j *CookieJar) Save(w io.Writer, format CookieFormat) error {
+	j.mu.Lock()
+	data, err := j.marshal(format)
+	j.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// marshal 按format序列化未过期的Cookie，调用方需持有j.mu
+func (j *CookieJar) marshal(format CookieFormat) ([]byte, error) {
+	entries := j.validEntries()
+	if format != CookieNetscape {
+		if entries == nil {
+			entries = []*cookieEntry{}
+		}
+		data, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("序列化Cookie失败: %w", err)
+		}
+		return data, nil
+	}
+	var buf bytes.Buffer
+	buf.WriteString("# Netscape HTTP Cookie File\n\n")
+	for _, e := range entries {
+		if e.HttpOnly {
+			buf.WriteString("#HttpOnly_")
+		}
+		domain := e.Domain
+		if !e.HostOnly {
+			domain = "." + domain
+		}
+		var expires int64
+		if !e.Expires.IsZero() {
+			expires = e.Expires.Unix()
+		}
+		fmt.Fprintf(&buf, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+			domain, netscapeBool(!e.HostOnly), e.Path, netscapeBool(e.Secure), expires, e.Name, e.Value)
+	}
+	return buf.Bytes(), nil
+}
+
+// Load 从r读取format格式的Cookie并合并到当前CookieJar，同名Cookie被替换，已过期的Cookie被忽略
+func (j *CookieJar) Load(r io.Reader, format CookieFormat) error {
+	var entries []*cookieEntry
+	var err error
+	if format == CookieNetscape {
+		entries, err = parseNetscapeCookies(r)
+	} else {
+		err = json.NewDecoder(r).Decode(&entries)
+	}
+	if err != nil {
+		return fmt.Errorf("解析Cookie失败: %w", err)
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.add(entries)
+	return nil
+}
+
+// validEntries 返回按sortCookieEntries排序的未过期Cookie，调用方需持有j.mu
+func (j *CookieJar) validEntries() []*cookieEntry {
+	now := time.Now()
+	var entries []*cookieEntry
+	for _, m := range j.entries {
+		for _, e := range m {
+			if !e.expired(now) {
+				entries = append(entries, e)
+			}
+		}
+	}
+	sortCookieEntries(entries)
+	return entries
+}
+
+// add 保存从文件或会话中读取的Cookie，跳过无效和已过期的Cookie，调用方需持有j.mu
+func (j *CookieJar) add(entries []*cookieEntry) {
+	now := time.Now()
+	for _, e := range entries {
+		if e == nil {
+			continue
+		}
+		e.Domain = canonicalCookieDomain(e.Domain)
+		if e.Name == "" || e.Domain == "" || e.expired(now) {
+			continue
+		}
+		if e.Path == "" || e.Path[0] != '/' {
+			e.Path = "/"
+		}
+		if e.Creation.IsZero() {
+			e.Creation = now
+		}
+		j.put(e.Name+";"+e.Path, e)
+	}
+	j.changed()
+}
+
+// parseNetscapeCookies 解析Netscape cookies.txt格式，跳过注释和空行
+func parseNetscapeCookies(r io.Reader) ([]*cookieEntry, error) {
+	var entries []*cookieEntry
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimRight(sc.Text(), "\r")
+		e := &cookieEntry{}
+		if rest, ok := strings.CutPrefix(line, "#HttpOnly_"); ok {
+			line, e.HttpOnly = rest, true
+		}
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.SplitN(line, "\t", 7)
+		if len(fields) != 7 {
+			return nil, fmt.Errorf("第%d行字段数错误", n)
+		}
+		expires, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("第%d行过期时间错误: %w", n, err)
+		}
+		if expires > 0 {
+			e.Expires = time.Unix(expires, 0)
+		}
+		e.Domain = fields[0]
+		e.HostOnly = !strings.EqualFold(fields[1], "TRUE")
+		e.Path = fields[2]
+		e.Secure = strings.EqualFold(fields[3], "TRUE")
+		e.Name, e.Value = fields[5], fields[6]
+		entries = append(entries, e)
+	}
+	return entries, sc.Err()
+}
+
+func netscapeBool(b bool) string {
+	if b {
+		return "TRUE"
+	}
+	return "FALSE"
+}
+
+// NewFileCookieJar 创建保存到path的CookieJar，path存在时先加载其中的Cookie
+// 扩展名为.txt时使用Netscape cookies.txt格式，否则使用JSON格式。
+// Cookie变化后不会自动写入文件，需调用Flush或通过SetAutoFlush开启自动写入
+func NewFileCookieJar(path string) (*CookieJar, error) {
+	j := NewCookieJar()
+	j.file = path
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return j, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("打开Cookie文件失败: %w", err)
+	}
+	defer f.Close()
+	if err := j.Load(f, cookieFormatOf(path)); err != nil {
+		return nil, err
+	}
+	j.mu.Lock()
+	j.dirty = false
+	j.mu.Unlock()
+	return j, nil
+}
+
+// SetAutoFlush 设置Cookie变化后自动写入文件的延迟，延迟内的多次变化合并为一次写入
+// 参数:
+//   - delay: 写入延迟，小于等于0时关闭自动写入；仅对NewFileCookieJar创建的CookieJar有效
+func (j *CookieJar) SetAutoFlush(delay time.Duration) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.flushDelay = max(delay, 0)
+	if j.dirty {
+		j.scheduleFlush()
+	}
+}
+
+// changed 标记Cookie已变化，开启自动写入时安排一次写入，调用方需持有j.mu
+func (j *CookieJar) changed() {
+	j.dirty = true
+	j.scheduleFlush()
+}
+
+// scheduleFlush 开启自动写入且尚未安排时，在flushDelay后写入文件，调用方需持有j.mu
+func (j *CookieJar) scheduleFlush() {
+	if j.file == "" || j.flushDelay <= 0 || j.flushTimer != nil {
+		return
+	}
+	j.flushTimer = time.AfterFunc(j.flushDelay, func() { j.Flush() })
+}
+
+// Flush 将Cookie写入NewFileCookieJar指定的文件，没有变化时直接返回
+// 先写入临时文件再替换，进程在写入过程中退出也不会损坏原文件
+func (j *CookieJar) Flush() error {
+	j.flushMu.Lock()
+	defer j.flushMu.Unlock()
+	j.mu.Lock()
+	if j.flushTimer != nil {
+		j.flushTimer.Stop()
+		j.flushTimer = nil
+	}
+	if j.file == "" || !j.dirty {
+		j.mu.Unlock()
+		return nil
+	}
+	path := j.file
+	data, err := j.marshal(cookieFormatOf(path))
+	j.dirty = false
+	j.mu.Unlock()
+
+	if err == nil {
+		err = writeFileAtomic(path, data)
+	}
+	if err != nil {
+		// 写入失败时保留变化标记，下次Flush重试
+		j.mu.Lock()
+		j.dirty = true
+		j.mu.Unlock()
+	}
+	return err
+}
+
+// writeFileAtomic 通过同目录下的临时文件替换path
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("创建目录失败: %w", err)
+	}
+	f, err := os.CreateTemp(dir, filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("创建临时文件失败: %w", err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("写入文件失败: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("写入文件失败: %w", err)
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return fmt.Errorf("写入文件失败: %w", err)
+	}
+	return nil
+}
+
+// SetCookieFile 开启Cookie管理并将Cookie保存到文件，文件存在时先加载其中的Cookie，替换当前的CookieJar
+// 已通过BlockCookies等设置的Cookie策略保持不变
+// 参数:
+//   - path: Cookie文件路径，扩展名为.txt时使用Netscape cookies.txt格式，否则使用JSON格式
+//   - flushDelay: Cookie变化后自动写入文件的延迟，小于等于0时只在调用SaveCookies或Close时写入
+func (r *GoProxy) SetCookieFile(path string, flushDelay time.Duration) error {
+	jar, err := NewFileCookieJar(path)
+	if err != nil {
+		return err
+	}
+	jar.SetAutoFlush(flushDelay)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if old, ok := r.client.Jar.(*CookieJar); ok {
+		// 保留已设置的Cookie策略
+		old.mu.Lock()
+		jar.policy = old.policy.clone()
+		old.mu.Unlock()
+	}
+	r.client.Jar = jar
+	return nil
+}
+
+// SaveCookies 将Cookie立即写入SetCookieFile指定的文件，未设置文件时直接返回
+func (r *GoProxy) SaveCookies() error {
+	if jar := r.GetCookieJar(); jar != nil {
+		return jar.Flush()
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package goproxy
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testNetscapeCookies = `# Netscape HTTP Cookie File
+# 注释行
+
+.example.com	TRUE	/	TRUE	4102444800	session	abc
+#HttpOnly_www.example.com	FALSE	/app	FALSE	0	token	x=1
+old.example.com	FALSE	/	FALSE	1	expired	1
+`
+
+func TestCookieJar_Netscape(t *testing.T) {
+	jar := NewCookieJar()
+	if err := jar.Load(strings.NewReader(testNetscapeCookies), CookieNetscape); err != nil {
+		t.Fatal(err)
+	}
+	cookies := jar.DomainCookies("example.com")
+	if len(cookies) != 2 {
+		t.Fatalf("加载了%d个Cookie", len(cookies))
+	}
+	if c := cookies[0]; c.Name != "session" || c.Domain != "example.com" || !c.Secure || c.Expires.Unix() != 4102444800 {
+		t.Errorf("域Cookie为%+v", c)
+	}
+	if c := cookies[1]; c.Name != "token" || c.Value != "x=1" || c.Domain != "" || c.Path != "/app" || !c.HttpOnly || !c.Expires.IsZero() {
+		t.Errorf("主机Cookie为%+v", c)
+	}
+
+	var buf bytes.Buffer
+	if err := jar.Save(&buf, CookieNetscape); err != nil {
+		t.Fatal(err)
+	}
+	want := "# Netscape HTTP Cookie File\n\n" +
+		".example.com\tTRUE\t/\tTRUE\t4102444800\tsession\tabc\n" +
+		"#HttpOnly_www.example.com\tFALSE\t/app\tFALSE\t0\ttoken\tx=1\n"
+	if buf.String() != want {
+		t.Errorf("保存结果为%q", buf.String())
+	}
+
+	if err := jar.Load(strings.NewReader("example.com\tTRUE\t/\n"), CookieNetscape); err == nil {
+		t.Error("字段数错误应返回错误")
+	}
+}
+
+func TestGoProxy_SetCookieFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cookies.json")
+	c := New()
+	if err := c.SetCookieFile(path, 10*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	cookie := &http.Cookie{Name: "session", Value: "abc", SameSite: http.SameSiteStrictMode}
+	if err := c.SetCookies("https://example.com/", []*http.Cookie{cookie}); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, err := os.Stat(path); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("未自动写入Cookie文件")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	c2 := New()
+	if err := c2.SetCookieFile(path, 0); err != nil {
+		t.Fatal(err)
+	}
+	if got := c2.GetCookies(""); len(got) != 1 || got[0].Value != "abc" || got[0].SameSite != http.SameSiteStrictMode {
+		t.Errorf("加载的Cookie为%+v", got)
+	}
+
+	// 未开启自动写入时由Close写入
+	c2.DelCookies("example.com")
+	if err := c2.Close(); err != nil {
+		t.Fatal(err)
+	}
+	jar, err := NewFileCookieJar(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(jar.DomainCookies("")); n != 0 {
+		t.Errorf("Close后文件中有%d个Cookie", n)
+	}
+
+	os.WriteFile(path, []byte("{"), 0o644)
+	if err := c.SetCookieFile(path, 0); err == nil {
+		t.Error("文件格式错误应返回错误")
+	}
+}
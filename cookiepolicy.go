@@ -0,0 +1,88 @@
+package goproxy
+
+import (
+	"net/http"
+	"net/url"
+	"slices"
+)
+
+// CookieFilter 在保存响应设置的每个Cookie前调用，返回false时丢弃该Cookie
+// 可以修改c，如缩短过期时间或去掉Domain使其只对当前主机有效
+type CookieFilter func(u *url.URL, c *http.Cookie) bool
+
+// cookiePolicy CookieJar的保存和发送策略
+type cookiePolicy struct {
+	blocked  []string     // 不保存也不发送Cookie的域名
+	readOnly bool         // 是否忽略响应设置的Cookie
+	filter   CookieFilter // 保存前调用的过滤函数
+}
+
+// blocks 判断是否禁用host的Cookie
+func (p *cookiePolicy) blocks(host string) bool {
+	for _, domain := range p.blocked {
+		if domainWithin(host, domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetBlockedDomains 设置禁用Cookie的域名，发往这些域名及其子域名的请求不携带Cookie，其响应设置的Cookie也不保存
+// 参数:
+//   - domains: 域名列表，如"doubleclick.net"；为空时取消所有禁用
+func (j *CookieJar) SetBlockedDomains(domains ...string) {
+	var blocked []string
+	for _, domain := range domains {
+		if domain = canonicalCookieDomain(domain); domain != "" {
+			blocked = append(blocked, domain)
+		}
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.policy.blocked = blocked
+}
+
+// SetReadOnly 设置为只读时继续发送已保存的Cookie，但忽略响应设置的Cookie，
+// 适合导入登录状态后不希望其被服务器修改的场景。Load和ImportSession不受影响
+func (j *CookieJar) SetReadOnly(readOnly bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.policy.readOnly = readOnly
+}
+
+// SetFilter 设置保存每个Cookie前调用的过滤函数，可用于去掉跟踪Cookie而保留功能性Cookie，fn为nil时取消过滤
+// 过滤函数可能被并发调用；SetCookies手动保存的Cookie同样经过过滤
+func (j *CookieJar) SetFilter(fn CookieFilter) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.policy.filter = fn
+}
+
+// clone 复制策略
+func (p cookiePolicy) clone() cookiePolicy {
+	p.blocked = slices.Clone(p.blocked)
+	return p
+}
+
+// BlockCookies 禁用指定域名及其子域名的Cookie，需先调用EnableCookies或SetCookieFile开启Cookie管理
+// 参数:
+//   - domains: 域名列表；为空时取消所有禁用
+func (r *GoProxy) BlockCookies(domains ...string) {
+	if jar := r.GetCookieJar(); jar != nil {
+		jar.SetBlockedDomains(domains...)
+	}
+}
+
+// SetCookiesReadOnly 设置是否忽略响应设置的Cookie，已保存的Cookie仍会发送，需先开启Cookie管理
+func (r *GoProxy) SetCookiesReadOnly(readOnly bool) {
+	if jar := r.GetCookieJar(); jar != nil {
+		jar.SetReadOnly(readOnly)
+	}
+}
+
+// SetCookieFilter 设置保存每个Cookie前调用的过滤函数，需先开启Cookie管理，见CookieJar.SetFilter
+func (r *GoProxy) SetCookieFilter(fn CookieFilter) {
+	if jar := r.GetCookieJar(); jar != nil {
+		jar.SetFilter(fn)
+	}
+}
@@ -0,0 +1,53 @@
+package goproxy
+
+import (
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"testing"
+)
+
+func TestGoProxy_CookiePolicy(t *testing.T) {
+	srv := newTestCookieServer(t)
+	u, _ := url.Parse(srv.URL)
+
+	c := New()
+	c.SetHostOverride("*.example.com", u.Host)
+	c.EnableCookies(true)
+	var seen int
+	c.SetCookieFilter(func(u *url.URL, cookie *http.Cookie) bool {
+		seen++
+		return cookie.Name != "host"
+	})
+	getBody(t, c, "http://www.example.com/login")
+	if got := getBody(t, c, "http://www.example.com/echo"); got != "session=abc" || seen != 2 {
+		t.Errorf("过滤后Cookie为%q, 过滤函数调用%d次", got, seen)
+	}
+
+	c.BlockCookies("API.example.com")
+	if got := getBody(t, c, "http://api.example.com/echo"); got != "" {
+		t.Errorf("禁用的域名携带了Cookie: %q", got)
+	}
+	c.ClearCookies()
+	getBody(t, c, "http://api.example.com/login")
+	if n := len(c.GetCookies("")); n != 0 {
+		t.Errorf("保存了禁用域名设置的%d个Cookie", n)
+	}
+	c.BlockCookies()
+	c.SetCookieFilter(nil)
+
+	c.SetCookiesReadOnly(true)
+	if err := c.SetCookieFile(filepath.Join(t.TempDir(), "cookies.json"), 0); err != nil {
+		t.Fatal(err)
+	}
+	getBody(t, c, "http://www.example.com/login")
+	if n := len(c.GetCookies("")); n != 0 {
+		t.Errorf("只读时保存了%d个Cookie", n)
+	}
+	if err := c.ImportSession([]byte(`{"version":1,"cookies":[{"name":"a","value":"1","domain":"www.example.com","host_only":true}]}`)); err != nil {
+		t.Fatal(err)
+	}
+	if got := getBody(t, c, "http://www.example.com/echo"); got != "a=1" {
+		t.Errorf("只读时导入的Cookie为%q", got)
+	}
+}
@@ -0,0 +1,248 @@
+package goproxy
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Credentials 用户名和密码
+type Credentials struct {
+	Username string // 用户名
+	Password string // 密码
+}
+
+// CredentialProvider 按主机名查找凭据，用于代理认证和目标站点的Basic认证，避免将密码写在代理地址或源码中
+type CredentialProvider interface {
+	// Credentials 返回host(不含端口)的凭据，没有凭据时返回nil, nil
+	Credentials(ctx context.Context, host string) (*Credentials, error)
+}
+
+// CredentialProviderFunc 将函数转为CredentialProvider
+type CredentialProviderFunc func(ctx context.Context, host string) (*Credentials, error)
+
+// Credentials 实现CredentialProvider接口
+func (f CredentialProviderFunc) Credentials(ctx context.Context, host string) (*Credentials, error) {
+	return f(ctx, host)
+}
+
+// ChainCredentials 依次查询providers，返回第一个找到的凭据，任一查询出错时返回该错误
+func ChainCredentials(providers ...CredentialProvider) CredentialProvider {
+	return CredentialProviderFunc(func(ctx context.Context, host string) (*Credentials, error) {
+		for _, p := range providers {
+			cred, err := p.Credentials(ctx, host)
+			if err != nil || cred != nil {
+				return cred, err
+			}
+		}
+		return nil, nil
+	})
+}
+
+// EnvCredentials 从环境变量读取凭据，变量名为"前缀_主机_USERNAME"和"前缀_主机_PASSWORD"，
+// 其中主机转为大写，字母和数字以外的字符替换为下划线。
+// 如前缀为"GOPROXY"时，proxy.example.com的凭据为GOPROXY_PROXY_EXAMPLE_COM_USERNAME和GOPROXY_PROXY_EXAMPLE_COM_PASSWORD
+type EnvCredentials struct {
+	Prefix string // 环境变量名的前缀，为空时不加前缀
+}
+
+// Credentials 实现CredentialProvider接口，两个变量都未设置时视为没有凭据
+func (e EnvCredentials) Credentials(_ context.Context, host string) (*Credentials, error) {
+	name := strings.Map(func(c rune) rune {
+		switch {
+		case 'a' <= c && c <= 'z':
+			return c - 'a' + 'A'
+		case 'A' <= c && c <= 'Z' || '0' <= c && c <= '9':
+			return c
+		}
+		return '_'
+	}, host)
+	if e.Prefix != "" {
+		name = e.Prefix + "_" + name
+	}
+	user, okUser := os.LookupEnv(name + "_USERNAME")
+	pass, okPass := os.LookupEnv(name + "_PASSWORD")
+	if !okUser && !okPass {
+		return nil, nil
+	}
+	return &Credentials{Username: user, Password: pass}, nil
+}
+
+// NetrcCredentials 从netrc文件读取凭据，支持machine、default、login、password和macdef，每次查询都重新读取文件
+type NetrcCredentials struct {
+	// Path netrc文件路径，为空时使用环境变量NETRC指定的文件，未设置时使用用户主目录下的.netrc(Windows下为_netrc)
+	Path string
+}
+
+// Credentials 实现CredentialProvider接口，文件不存在时视为没有凭据
+func (n NetrcCredentials) Credentials(_ context.Context, host string) (*Credentials, error) {
+	path := n.Path
+	if path == "" {
+		path = os.Getenv("NETRC")
+	}
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, nil
+		}
+		name := ".netrc"
+		if runtime.GOOS == "windows" {
+			name = "_netrc"
+		}
+		path = filepath.Join(home, name)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("读取netrc文件失败: %w", err)
+	}
+	defer f.Close()
+	cred, err := parseNetrc(bufio.NewScanner(f), host)
+	if err != nil {
+		return nil, fmt.Errorf("读取netrc文件失败: %w", err)
+	}
+	return cred, nil
+}
+
+// parseNetrc 返回netrc中host对应的凭据，没有对应的machine时使用default
+func parseNetrc(s *bufio.Scanner, host string) (*Credentials, error) {
+	var (
+		found, fallback *Credentials
+		current         *Credentials // 当前machine或default的凭据，为nil时跳过login和password
+		inMacro         bool
+		next            string // 等待值的关键字
+	)
+	for s.Scan() {
+		line := s.Text()
+		if inMacro {
+			// 宏定义以空行结束
+			inMacro = strings.TrimSpace(line) != ""
+			continue
+		}
+		for _, field := range strings.Fields(line) {
+			if inMacro {
+				// 宏名所在行的剩余内容忽略，宏体从下一行开始
+				break
+			}
+			if next != "" {
+				switch next {
+				case "machine":
+					current = nil
+					if found == nil && strings.EqualFold(field, host) {
+						found = new(Credentials)
+						current = found
+					}
+				case "login":
+					if current != nil {
+						current.Username = field
+					}
+				case "password":
+					if current != nil {
+						current.Password = field
+					}
+				case "macdef":
+					inMacro = true
+				}
+				next = ""
+				continue
+			}
+			switch field {
+			case "machine", "login", "password", "account", "macdef":
+				next = field
+			case "default":
+				current = nil
+				if fallback == nil {
+					fallback = new(Credentials)
+					current = fallback
+				}
+			}
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if found != nil {
+		return found, nil
+	}
+	return fallback, nil
+}
+
+// KeychainCredentials 从操作系统的凭据存储读取凭据:
+// macOS使用钥匙串中服务器为主机名的互联网密码，Linux通过secret-tool查询server属性为主机名的条目，
+// Windows使用凭据管理器中目标名为主机名的普通凭据。系统不支持或未安装相应工具时视为没有凭据
+type KeychainCredentials struct{}
+
+// Credentials 实现CredentialProvider接口
+func (KeychainCredentials) Credentials(ctx context.Context, host string) (*Credentials, error) {
+	cred, err := keychainLookup(ctx, host)
+	if err != nil {
+		return nil, fmt.Errorf("读取系统凭据失败: %w", err)
+	}
+	return cred, nil
+}
+
+// SetCredentialProvider 设置凭据来源，为nil时取消
+// 代理地址不含用户信息时按代理服务器的主机名查询凭据用于代理认证；
+// 请求没有Authorization且未设置SetBasicAuth、令牌和Digest认证时，按目标主机名查询凭据添加Basic认证，重定向时只在同源请求中添加
+// 参数:
+//   - p: 凭据来源，可通过ChainCredentials组合EnvCredentials、NetrcCredentials和KeychainCredentials
+//
+// 返回值:
+//   - error: 已设置代理时重新查询代理凭据失败的错误
+func (r *GoProxy) SetCredentialProvider(p CredentialProvider) error {
+	r.mu.Lock()
+	ct := r.transport
+	if p == nil {
+		ct.credentials.Store(nil)
+	} else {
+		ct.credentials.Store(&p)
+	}
+	proxyUrl := r.proxyUrl
+	r.mu.Unlock()
+	if proxyUrl == "" {
+		return nil
+	}
+	return r.SetProxy(proxyUrl)
+}
+
+// proxyCredentials 代理地址不含用户信息时从凭据来源查询并填入proxyURL
+func (c *CustomTransport) proxyCredentials(proxyURL *url.URL) error {
+	p := c.credentials.Load()
+	if p == nil || proxyURL.User != nil {
+		return nil
+	}
+	cred, err := (*p).Credentials(context.Background(), proxyURL.Hostname())
+	if err != nil {
+		return fmt.Errorf("查询代理凭据失败: %w", err)
+	}
+	if cred != nil {
+		proxyURL.User = url.UserPassword(cred.Username, cred.Password)
+	}
+	return nil
+}
+
+// applyCredentials 为没有Authorization的同源请求添加凭据来源中目标主机的Basic认证
+func (c *CustomTransport) applyCredentials(req *http.Request) error {
+	p := c.credentials.Load()
+	if p == nil || req.Header.Get("Authorization") != "" || !sameOriginAsInitial(req) {
+		return nil
+	}
+	cred, err := (*p).Credentials(req.Context(), req.URL.Hostname())
+	if err != nil {
+		return fmt.Errorf("查询凭据失败: %w", err)
+	}
+	if cred != nil {
+		req.Header.Set("Authorization", basicAuthValue(cred.Username, cred.Password))
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package goproxy
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEnvCredentials(t *testing.T) {
+	t.Setenv("TEST_PROXY_EXAMPLE_COM_USERNAME", "user")
+	t.Setenv("TEST_PROXY_EXAMPLE_COM_PASSWORD", "pass")
+	cred, err := EnvCredentials{Prefix: "TEST"}.Credentials(context.Background(), "proxy.example.com")
+	if err != nil || cred == nil || *cred != (Credentials{"user", "pass"}) {
+		t.Errorf("凭据为%+v, 错误为%v", cred, err)
+	}
+	if cred, _ := (EnvCredentials{Prefix: "TEST"}).Credentials(context.Background(), "other.example.com"); cred != nil {
+		t.Errorf("未设置的主机凭据为%+v", cred)
+	}
+}
+
+func TestParseNetrc(t *testing.T) {
+	const netrc = `machine a.example.com login alice password p1
+macdef init
+machine b.example.com login mallory password x
+
+machine B.example.com
+	login bob
+	password p2
+default login anon password guest
+`
+	tests := []struct {
+		host string
+		want Credentials
+	}{
+		{"a.example.com", Credentials{"alice", "p1"}},
+		{"b.example.com", Credentials{"bob", "p2"}},
+		{"c.example.com", Credentials{"anon", "guest"}},
+	}
+	for _, tt := range tests {
+		cred, err := parseNetrc(bufio.NewScanner(strings.NewReader(netrc)), tt.host)
+		if err != nil || cred == nil || *cred != tt.want {
+			t.Errorf("%s的凭据为%+v, 错误为%v", tt.host, cred, err)
+		}
+	}
+	if cred, _ := parseNetrc(bufio.NewScanner(strings.NewReader("machine a login u password p\n")), "b"); cred != nil {
+		t.Errorf("没有default时凭据为%+v", cred)
+	}
+}
+
+func TestNetrcCredentials(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "netrc")
+	if err := os.WriteFile(path, []byte("machine 127.0.0.1 login admin password secret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("NETRC", path)
+	cred, err := NetrcCredentials{}.Credentials(context.Background(), "127.0.0.1")
+	if err != nil || cred == nil || *cred != (Credentials{"admin", "secret"}) {
+		t.Errorf("凭据为%+v, 错误为%v", cred, err)
+	}
+	if cred, err := (NetrcCredentials{Path: path + ".missing"}).Credentials(context.Background(), "127.0.0.1"); cred != nil || err != nil {
+		t.Errorf("文件不存在时凭据为%+v, 错误为%v", cred, err)
+	}
+}
+
+func TestChainCredentials(t *testing.T) {
+	none := CredentialProviderFunc(func(context.Context, string) (*Credentials, error) { return nil, nil })
+	fixed := CredentialProviderFunc(func(context.Context, string) (*Credentials, error) { return &Credentials{"u", "p"}, nil })
+	failed := CredentialProviderFunc(func(context.Context, string) (*Credentials, error) { return nil, errors.New("不可用") })
+	if cred, err := ChainCredentials(none, fixed, failed).Credentials(context.Background(), "h"); err != nil || cred == nil || cred.Username != "u" {
+		t.Errorf("凭据为%+v, 错误为%v", cred, err)
+	}
+	if _, err := ChainCredentials(none, failed, fixed).Credentials(context.Background(), "h"); err == nil {
+		t.Error("查询出错时应返回错误")
+	}
+}
+
+func TestGoProxy_SetCredentialProvider(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "admin" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer srv.Close()
+	c := New()
+	status := func(c *GoProxy) int {
+		t.Helper()
+		resp, err := c.GetClient().Get(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := status(c); code != http.StatusUnauthorized {
+		t.Errorf("未设置凭据时状态码为%d", code)
+	}
+	c.SetCredentialProvider(CredentialProviderFunc(func(_ context.Context, host string) (*Credentials, error) {
+		if host != "127.0.0.1" {
+			return nil, nil
+		}
+		return &Credentials{"admin", "secret"}, nil
+	}))
+	if code := status(c); code != http.StatusOK {
+		t.Errorf("设置凭据后状态码为%d", code)
+	}
+	if code := status(c.Clone()); code != http.StatusOK {
+		t.Errorf("复制的客户端状态码为%d", code)
+	}
+
+	c.SetCredentialProvider(CredentialProviderFunc(func(context.Context, string) (*Credentials, error) {
+		return nil, errors.New("钥匙串已锁定")
+	}))
+	if _, err := c.GetClient().Get(srv.URL); err == nil || !strings.Contains(err.Error(), "钥匙串已锁定") {
+		t.Errorf("查询失败时错误为%v", err)
+	}
+}
+
+func TestGoProxy_SetCredentialProvider_Proxy(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer target.Close()
+	proxySrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Proxy-Authorization") != basicAuthValue("puser", "ppass") {
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+		resp, err := http.Get(r.URL.String())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		resp.Body.Close()
+		w.WriteHeader(resp.StatusCode)
+	}))
+	defer proxySrv.Close()
+
+	c := New()
+	if err := c.SetProxy(proxySrv.URL); err != nil {
+		t.Fatal(err)
+	}
+	status := func() int {
+		t.Helper()
+		resp, err := c.GetClient().Get(target.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := status(); code != http.StatusProxyAuthRequired {
+		t.Errorf("未设置凭据时状态码为%d", code)
+	}
+	if err := c.SetCredentialProvider(ChainCredentials(EnvCredentials{Prefix: "TEST"})); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEST_127_0_0_1_USERNAME", "puser")
+	t.Setenv("TEST_127_0_0_1_PASSWORD", "ppass")
+	// 代理凭据在设置代理时查询
+	if err := c.SetProxy(proxySrv.URL); err != nil {
+		t.Fatal(err)
+	}
+	if code := status(); code != http.StatusOK {
+		t.Errorf("设置凭据后状态码为%d", code)
+	}
+	if c.String() != proxySrv.URL {
+		t.Errorf("代理地址为%s", c)
+	}
+}
@@ -0,0 +1,198 @@
+package goproxy
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule 定时任务的执行时间表
+type Schedule interface {
+	// Next 返回t之后的下一次执行时间，没有时返回零值
+	Next(t time.Time) time.Time
+}
+
+// everySchedule 固定间隔的时间表
+type everySchedule time.Duration
+
+func (d everySchedule) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(d))
+}
+
+// cronSchedule cron表达式的时间表，每个字段为允许取值的位集合
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	domStar, dowStar              bool // 日和星期字段是否以"*"开头，此时只按另一个字段匹配
+	loc                           *time.Location
+}
+
+// cron表达式各字段的取值范围
+type cronField struct {
+	name     string
+	min, max int
+	names    []string // 从min开始的名称，如月份和星期
+}
+
+var cronFields = [...]cronField{
+	{name: "分钟", min: 0, max: 59},
+	{name: "小时", min: 0, max: 23},
+	{name: "日", min: 1, max: 31},
+	{name: "月", min: 1, max: 12, names: []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}},
+	{name: "星期", min: 0, max: 7, names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}},
+}
+
+// cronDescriptors 预定义的表达式
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// ParseCron 解析标准的5字段cron表达式(分 时 日 月 星期)，按本地时区计算执行时间。
+// 支持"*"、列表"1,15"、范围"1-5"、步长"*/10"和"10-30/5"、月份和星期的英文缩写(JAN、MON)，星期的0和7都表示星期日；
+// 日和星期都不为"*"时满足其一即执行。也支持@hourly、@daily、@weekly、@monthly、@yearly和"@every 时长"
+// 开头加"TZ=时区 "时按该时区计算，如"TZ=Asia/Shanghai 0 9 * * MON-FRI"
+func ParseCron(expr string) (Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	loc := time.Local
+	if rest, ok := strings.CutPrefix(expr, "TZ="); ok {
+		name, spec, _ := strings.Cut(rest, " ")
+		var err error
+		if loc, err = time.LoadLocation(name); err != nil {
+			return nil, fmt.Errorf("cron表达式%q的时区无效: %w", expr, err)
+		}
+		expr = strings.TrimSpace(spec)
+	}
+	if rest, ok := strings.CutPrefix(expr, "@every "); ok {
+		d, err := time.ParseDuration(strings.TrimSpace(rest))
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("cron表达式%q的间隔无效", expr)
+		}
+		return everySchedule(d), nil
+	}
+	spec := expr
+	if strings.HasPrefix(spec, "@") {
+		var ok bool
+		if spec, ok = cronDescriptors[strings.ToLower(spec)]; !ok {
+			return nil, fmt.Errorf("未知的cron表达式%q", expr)
+		}
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("cron表达式%q应有5个字段，实际为%d个", expr, len(fields))
+	}
+	var sets [len(cronFields)]uint64
+	for i, f := range fields {
+		set, err := parseCronField(f, cronFields[i])
+		if err != nil {
+			return nil, fmt.Errorf("cron表达式%q的%s字段: %w", expr, cronFields[i].name, err)
+		}
+		sets[i] = set
+	}
+	// 星期日可以写作0或7
+	if sets[4]&(1<<7) != 0 {
+		sets[4] = sets[4]&^(1<<7) | 1
+	}
+	return &cronSchedule{
+		minute: sets[0], hour: sets[1], dom: sets[2], month: sets[3], dow: sets[4],
+		domStar: strings.HasPrefix(fields[2], "*") || fields[2] == "?",
+		dowStar: strings.HasPrefix(fields[4], "*") || fields[4] == "?",
+		loc:     loc,
+	}, nil
+}
+
+// parseCronField 解析一个字段，返回允许取值的位集合
+func parseCronField(s string, f cronField) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(s, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepStr); err != nil || step <= 0 {
+				return 0, fmt.Errorf("无效的步长%q", stepStr)
+			}
+		}
+		lo, hi := f.min, f.max
+		switch {
+		case rng == "*" || rng == "?":
+			if f.names != nil && f.max == 7 {
+				// "*"不重复包含7
+				hi = 6
+			}
+		default:
+			a, b, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = cronValue(a, f); err != nil {
+				return 0, err
+			}
+			hi = lo
+			if isRange {
+				if hi, err = cronValue(b, f); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				// "5/10"表示从5开始到最大值
+				hi = f.max
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("范围%q的起始值大于结束值", rng)
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
+
+// cronValue 解析字段中的一个数值或名称
+func cronValue(s string, f cronField) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(s, name) {
+			return f.min + i, nil
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("无效的值%q，应在%d到%d之间", s, f.min, f.max)
+	}
+	return v, nil
+}
+
+func (s *cronSchedule) Next(t time.Time) time.Time {
+	orig := t.Location()
+	t = t.In(s.loc).Truncate(time.Minute).Add(time.Minute)
+	// 表达式可能永远不会满足，如"0 0 30 2 *"
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case s.month&(1<<int(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, s.loc)
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, s.loc)
+		case s.hour&(1<<t.Hour()) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, s.loc)
+		case s.minute&(1<<t.Minute()) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t.In(orig)
+		}
+	}
+	return time.Time{}
+}
+
+// dayMatches 判断日期是否满足日和星期字段，两者都有限制时满足其一即可
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<t.Day()) != 0
+	dow := s.dow&(1<<int(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
@@ -0,0 +1,61 @@
+package goproxy
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	loc, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Skip("没有时区数据")
+	}
+	// 2026-01-30是星期五
+	from := time.Date(2026, 1, 30, 10, 17, 30, 0, loc)
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2026, 1, 30, 10, 18, 0, 0, loc)},
+		{"*/15 * * * *", time.Date(2026, 1, 30, 10, 30, 0, 0, loc)},
+		{"5/20 9-11 * * *", time.Date(2026, 1, 30, 10, 25, 0, 0, loc)},
+		{"0 9 * * MON-FRI", time.Date(2026, 2, 2, 9, 0, 0, 0, loc)},
+		{"0 0 * * 7", time.Date(2026, 2, 1, 0, 0, 0, 0, loc)},
+		{"30 8 1,15 * *", time.Date(2026, 2, 1, 8, 30, 0, 0, loc)},
+		{"0 0 29 feb *", time.Date(2028, 2, 29, 0, 0, 0, 0, loc)},
+		// 日和星期都有限制时满足其一即可
+		{"0 12 13 * 5", time.Date(2026, 1, 30, 12, 0, 0, 0, loc)},
+		{"@monthly", time.Date(2026, 2, 1, 0, 0, 0, 0, loc)},
+		{"@hourly", time.Date(2026, 1, 30, 11, 0, 0, 0, loc)},
+		{"@every 90s", from.Add(90 * time.Second)},
+		{"TZ=UTC 0 3 * * *", time.Date(2026, 1, 30, 3, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		expr := tt.expr
+		if expr[0] != 'T' {
+			expr = "TZ=Asia/Shanghai " + expr
+		}
+		s, err := ParseCron(expr)
+		if err != nil {
+			t.Errorf("%s: %v", tt.expr, err)
+			continue
+		}
+		if got := s.Next(from); !got.Equal(tt.want) {
+			t.Errorf("%s: 下一次为%v，应为%v", tt.expr, got, tt.want)
+		}
+	}
+
+	never, err := ParseCron("0 0 30 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := never.Next(from); !got.IsZero() {
+		t.Errorf("不可能的日期的下一次为%v", got)
+	}
+
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* * 0 * *", "5-1 * * * *", "*/0 * * * *", "* * * foo *", "@sometimes", "@every -1s", "TZ=Nowhere/City * * * * *"} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("%q应返回错误", expr)
+		}
+	}
+}
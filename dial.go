@@ -0,0 +1,466 @@
+package goproxy
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// installDialers 将代理选择和拨号逻辑安装到Transport上
+// 只有访问http目标且使用HTTP/HTTPS代理时交由Transport以绝对路径形式转发，
+// 其余情况(https目标、SOCKS5代理)都由dialContext/dialTLSContext自行建立隧道，
+// 以便TLS握手始终由本包控制。调用方需持有r.mu
+func (r *GoProxy) installDialers(t *http.Transport) {
+	t.Proxy = r.proxyFunc
+	t.DialContext = r.dialTransportContext
+	t.DialTLSContext = r.dialTLSContext
+	t.CloseIdleConnections()
+	r.utlsH2.closeIdle()
+	r.h2c.closeIdle()
+	r.proxyH2.closeIdle()
+}
+
+// proxyFunc 作为Transport.Proxy使用，只对http目标返回HTTP代理
+func (r *GoProxy) proxyFunc(req *http.Request) (*url.URL, error) {
+	r.mu.Lock()
+	p := r.httpProxy
+	_, overridden := lookupHost(r.hostOverrides, req.URL.Hostname())
+	routed := r.router != nil
+	guard := r.ssrfGuard
+	r.mu.Unlock()
+	if p == nil || p.Scheme != "http" || req.URL.Scheme != "http" || routed {
+		// 使用规则路由时由dialContext按目标选择上游
+		return nil, nil
+	}
+	if strings.HasSuffix(req.URL.Hostname(), unixHostSuffix) {
+		// Unix套接字目标总是直接连接
+		return nil, nil
+	}
+	if overridden {
+		// 代理会按URL中的主机名连接，改为通过CONNECT隧道连接固定地址
+		return nil, nil
+	}
+	if guard != nil {
+		if guard.spec.ResolveForProxy {
+			// 代理会按URL中的主机名解析，改为通过CONNECT隧道连接本地解析并检查过的地址
+			return nil, nil
+		}
+		// 由代理转发时不经过dialContext，在这里检查目标
+		if err := guard.checkTarget(canonicalAddr(req.URL)); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// directDialer 不经过代理直接建立连接，同时作为SOCKS5代理的前置拨号器
+type directDialer struct {
+	r *GoProxy
+}
+
+func (d directDialer) Dial(network, addr string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, addr)
+}
+
+func (d directDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	conn, err := d.r.dialDirect(ctx, network, addr)
+	if err != nil {
+		// 只有SOCKS5代理通过directDialer拨号，失败即无法连接代理服务器
+		return nil, d.r.annotate(ctx, newError(ErrProxyUnreachable, err), PhaseDial)
+	}
+	return conn, nil
+}
+
+// dialDirect 不经过代理直接连接addr，设置了Resolver时由其解析域名，开启DNS缓存时优先使用缓存的结果，
+// 并按SetIPPolicy选择地址族、按SetLocalAddr/SetInterface绑定源地址，多个地址时按SetFallbackDelay并行连接
+func (r *GoProxy) dialDirect(ctx context.Context, network, addr string) (net.Conn, error) {
+	if r.transport.closed.Load() {
+		return nil, ErrClosed
+	}
+	r.mu.Lock()
+	p := dialPlan{
+		res:           r.resolver,
+		policy:        r.ipPolicy,
+		localIP:       r.localIP,
+		iface:         r.iface,
+		fallbackDelay: r.fallbackDelay,
+		dialFunc:      r.dialFunc,
+		keepAlive:     r.keepAlive,
+		nagle:         r.nagle,
+	}
+	cache := r.dnsCache
+	r.mu.Unlock()
+	if path, ok := unixSocketPath(addr); ok {
+		return p.netDial(ctx, "unix", path, nil)
+	}
+	if ctx.Value(noResolverKey{}) != nil {
+		p.res, cache = nil, nil
+	}
+	p.guard, _ = ctx.Value(ssrfGuardKey{}).(*ssrfGuard)
+	if cache != nil {
+		p.res = cachedResolver{cache, p.res}
+	}
+	return p.dial(ctx, network, addr)
+}
+
+// DialFunc 建立网络连接的函数，与net.Dialer.DialContext的签名相同
+type DialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// SetDialContext 设置建立底层连接的函数，为nil时使用net.Dialer
+// 该函数位于代理之下: 直接连接目标、连接HTTP/SOCKS5代理服务器以及连接Unix套接字时都由它拨出，
+// 代理隧道、TLS握手、带宽限制等仍在其返回的连接之上进行，可用于标记连接或接入自定义隧道。
+// 设置了Resolver或IP地址族策略时addr为解析后的IP地址，否则为原始主机名；SetLocalAddr和SetInterface不再生效
+func (r *GoProxy) SetDialContext(fn DialFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.dialFunc = fn
+	r.closeIdleConns()
+}
+
+// DialContext 按当前代理配置建立到addr(host:port)的TCP连接，与请求使用相同的上游代理、SetHostOverride、
+// 解析器、超时和带宽限制，可用于转发任意TCP流量；连接上不进行TLS握手
+func (r *GoProxy) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+	default:
+		return nil, fmt.Errorf("不支持的网络类型: %s", network)
+	}
+	if r.transport.closed.Load() {
+		return nil, ErrClosed
+	}
+	return r.dialContext(ctx, network, addr)
+}
+
+// dialTransportContext 作为Transport.DialContext使用，包装连接以支持SetHeaderOrder
+func (r *GoProxy) dialTransportContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	conn, err := r.dialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	return wrapHeaderOrder(conn), nil
+}
+
+// dialContext 按当前代理配置建立到addr的原始连接，Transport的所有连接都经由这里拨出
+//   - 使用HTTP/HTTPS代理时: addr为代理本身(Transport转发http请求)则直连代理，否则通过CONNECT建立隧道
+//   - 使用SOCKS5代理时: 通过SOCKS5代理连接
+//   - 未使用代理或目标为Unix套接字时: 直接连接
+//
+// 设置了SetRouter时按目标选择上游代替以上代理；SetHostOverride设置的主机在这里替换为实际连接的地址
+func (r *GoProxy) dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	ctx, cancel := r.withDialTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	r.mu.Lock()
+	httpProxy := r.httpProxy
+	socks := r.socksDialer
+	router, res := r.router, r.resolver
+	flows, proxyKey := r.flowExporter, r.proxyUrl
+	guard := r.ssrfGuard
+	target := addr
+	// Transport以绝对路径形式经HTTP代理转发http请求，此时addr为代理本身，目标已在proxyFunc中检查
+	forwarding := router == nil && httpProxy != nil && addr == canonicalAddr(httpProxy)
+	if !forwarding {
+		addr = r.overrideAddr(addr)
+	}
+	r.mu.Unlock()
+
+	var conn net.Conn
+	var err error
+	if forwarding || ctx.Value(noResolverKey{}) != nil {
+		// 目标已在proxyFunc中检查；DoH/DoT服务器由使用者配置，不受SSRF防护限制
+		guard = nil
+	}
+	if guard != nil {
+		if err = guard.checkTarget(target); err == nil && addr != target {
+			err = guard.checkTarget(addr)
+		}
+		if err != nil {
+			if flows != nil {
+				exportFailedFlow(flows, target, proxyKey, start, err)
+			}
+			return nil, r.annotate(ctx, err, PhaseDial)
+		}
+	}
+	_, isUnix := unixSocketPath(addr)
+	if router != nil && !isUnix {
+		host, _, _ := net.SplitHostPort(target)
+		upstream, matched, err := router.route(ctx, host, res)
+		if err != nil {
+			if flows != nil {
+				exportFailedFlow(flows, target, RouteReject, start, err)
+			}
+			return nil, annotateError(err, PhaseDial, RouteReject)
+		}
+		if matched {
+			httpProxy, socks = nil, nil
+			proxyKey = directProxyKey
+			if upstream != nil {
+				proxyKey = upstream.String()
+				if upstream.Scheme == "socks5" {
+					if socks, err = newSOCKS5Dialer(r, upstream); err != nil {
+						return nil, annotateError(err, PhaseDial, redactProxy(proxyKey))
+					}
+				} else {
+					httpProxy = upstream
+				}
+			}
+			ctx = context.WithValue(ctx, routedProxyKey{}, proxyKey)
+		}
+	}
+	if guard != nil && guard.spec.ResolveForProxy && !isUnix && (httpProxy != nil || socks != nil) {
+		if addr, err = r.resolveForProxy(ctx, guard, network, addr); err != nil {
+			if flows != nil {
+				exportFailedFlow(flows, target, proxyKey, start, err)
+			}
+			return nil, r.annotate(ctx, err, PhaseResolve)
+		}
+	}
+	switch {
+	case isUnix:
+		conn, err = r.dialDirect(ctx, network, addr)
+	case forwarding:
+		conn, err = r.dialDirect(ctx, network, addr)
+		err = newError(ErrProxyUnreachable, err)
+	case httpProxy != nil:
+		conn, err = r.dialConnect(ctx, httpProxy, addr)
+	case socks != nil:
+		if cd, ok := socks.(proxy.ContextDialer); ok {
+			conn, err = cd.DialContext(ctx, network, addr)
+		} else {
+			conn, err = socks.Dial(network, addr)
+		}
+		err = r.annotate(ctx, socksError(err), PhaseProxyHandshake)
+	default:
+		if guard != nil {
+			ctx = context.WithValue(ctx, ssrfGuardKey{}, guard)
+		}
+		conn, err = r.dialDirect(ctx, network, addr)
+	}
+	if proxyKey == "" {
+		proxyKey = directProxyKey
+	}
+	conns := r.transport.conns
+	if err != nil {
+		err = r.annotate(ctx, err, PhaseDial)
+		conns.track(addr, nil, err)
+		if flows != nil {
+			exportFailedFlow(flows, target, proxyKey, start, err)
+		}
+		return nil, err
+	}
+	conn = conns.track(addr, r.transport.stats.wrapConn(r.bandwidth.wrapConn(conn), proxyKey), nil)
+	return newFlowConn(conn, flows, target, proxyKey, start), nil
+}
+
+// dialTLSContext 建立到addr的TLS连接，Transport访问https目标时使用
+func (r *GoProxy) dialTLSContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	r.mu.Lock()
+	alpn := r.alpnProtocols()
+	if r.fingerprint != FingerprintGo {
+		// Transport只能在标准库的TLS连接上使用HTTP/2，uTLS连接上的HTTP/2由utlsH2Transport处理
+		alpn = []string{"http/1.1"}
+	}
+	r.mu.Unlock()
+	if o, _ := ctx.Value(requestOptionsKey{}).(*requestOptions); o != nil && o.httpVersion != "" || r.headerOrderForced(ctx) {
+		alpn = []string{"http/1.1"}
+	}
+	conn, err := r.dialTLS(ctx, network, addr, alpn)
+	if err != nil {
+		return nil, err
+	}
+	if conn.ConnectionState().NegotiatedProtocol == "h2" {
+		// Transport只在*tls.Conn上使用HTTP/2，不能包装
+		return conn, nil
+	}
+	return wrapHeaderOrder(conn), nil
+}
+
+// tlsConn 标准库或uTLS建立的TLS连接
+type tlsConn interface {
+	net.Conn
+	ConnectionState() tls.ConnectionState
+}
+
+// dialTLS 建立到addr的TLS连接，alpn不为空时替换TLS配置中的NextProtos作为握手时声明的ALPN协议
+func (r *GoProxy) dialTLS(ctx context.Context, network, addr string, alpn []string) (tlsConn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	fp := r.fingerprint
+	r.mu.Unlock()
+	cfg := r.tlsConfigForHost(ctx, host)
+	if alpn != nil {
+		cfg.NextProtos = alpn
+	}
+	if config := r.echConfigFor(ctx, host, port); config != nil {
+		applyECH(cfg, config)
+	}
+	conn, err := r.handshakeTLS(ctx, network, addr, cfg, fp)
+	var echErr *tls.ECHRejectionError
+	if errors.As(err, &echErr) && len(echErr.RetryConfigList) > 0 {
+		// 服务器已轮换ECH密钥，使用服务器返回的新配置重试一次
+		applyECH(cfg, echErr.RetryConfigList)
+		conn, err = r.handshakeTLS(ctx, network, addr, cfg, fp)
+	}
+	return conn, err
+}
+
+// handshakeTLS 建立到addr的连接并按cfg完成TLS握手，设置了TLS指纹时由uTLS握手
+func (r *GoProxy) handshakeTLS(ctx context.Context, network, addr string, cfg *tls.Config, fp TLSFingerprint) (tlsConn, error) {
+	if fp != FingerprintGo {
+		return r.handshakeUTLS(ctx, network, addr, cfg, fp)
+	}
+	conn, err := r.dialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	setFlowSNI(conn, cfg.ServerName)
+	tlsConn := tls.Client(conn, cfg)
+	hsCtx, cancel := r.withHandshakeTimeout(ctx)
+	err = tlsConn.HandshakeContext(hsCtx)
+	cancel()
+	r.notifyTLSState(addr, cfg.ServerName, tlsConn, err)
+	if err != nil {
+		conn.Close()
+		return nil, r.annotate(ctx, newError(ErrTLSHandshake, err), PhaseTLS)
+	}
+	return tlsConn, nil
+}
+
+// dialConnect 通过HTTP/HTTPS代理的CONNECT方法建立到addr的隧道
+func (r *GoProxy) dialConnect(ctx context.Context, proxyURL *url.URL, addr string) (net.Conn, error) {
+	r.mu.Lock()
+	h2 := r.proxyHTTP2
+	r.mu.Unlock()
+	if h2 && proxyURL.Scheme == "https" {
+		conn, err := r.dialConnectH2(ctx, proxyURL, addr)
+		if !errors.Is(err, errProxyNoH2) {
+			return conn, err
+		}
+	}
+	conn, err := r.dialProxy(ctx, proxyURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if auth := proxyAuthorization(proxyURL); auth != "" {
+		req.Header.Set("Proxy-Authorization", auth)
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, r.annotate(ctx, fmt.Errorf("发送CONNECT请求失败: %w", err), PhaseProxyHandshake)
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		if ctx.Err() != nil {
+			return nil, r.annotate(ctx, ctx.Err(), PhaseProxyHandshake)
+		}
+		return nil, r.annotate(ctx, fmt.Errorf("读取CONNECT响应失败: %w", err), PhaseProxyHandshake)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, r.annotate(ctx, connectError(resp), PhaseProxyHandshake)
+	}
+	if br.Buffered() > 0 {
+		// 代理随200响应一起发来的隧道数据已读入缓冲区
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn 先读取缓冲区中已读入的数据的连接
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// NetConn 返回被包装的连接
+func (c *bufferedConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+// dialProxy 建立到HTTP/HTTPS代理服务器的连接，https代理完成TLS握手并使用HTTP/1.1
+func (r *GoProxy) dialProxy(ctx context.Context, proxyURL *url.URL) (net.Conn, error) {
+	conn, err := r.dialDirect(ctx, "tcp", canonicalAddr(proxyURL))
+	if err != nil {
+		return nil, newError(ErrProxyUnreachable, err)
+	}
+	if proxyURL.Scheme != "https" {
+		return conn, nil
+	}
+	cfg := r.tlsConfigForHost(context.Background(), proxyURL.Hostname())
+	cfg.NextProtos = nil
+	tlsConn := tls.Client(conn, cfg)
+	hsCtx, cancel := r.withHandshakeTimeout(ctx)
+	defer cancel()
+	if err := tlsConn.HandshakeContext(hsCtx); err != nil {
+		conn.Close()
+		return nil, r.annotate(ctx, newError(ErrProxyUnreachable, newError(ErrTLSHandshake, err)), PhaseProxyHandshake)
+	}
+	return tlsConn, nil
+}
+
+// connectError 返回代理服务器拒绝CONNECT请求的错误，407时为ErrProxyAuth
+func connectError(resp *http.Response) error {
+	err := fmt.Errorf("代理服务器拒绝CONNECT请求: %s", resp.Status)
+	if resp.StatusCode == http.StatusProxyAuthRequired {
+		return newError(ErrProxyAuth, err)
+	}
+	return err
+}
+
+// proxyAuthorization 根据代理地址中的用户名密码生成Proxy-Authorization头
+func proxyAuthorization(u *url.URL) string {
+	if u.User == nil {
+		return ""
+	}
+	password, _ := u.User.Password()
+	return basicAuthValue(u.User.Username(), password)
+}
+
+// canonicalAddr 返回URL的host:port，省略端口时按协议补全默认端口
+func canonicalAddr(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		switch u.Scheme {
+		case "https":
+			port = "443"
+		case "socks5":
+			port = "1080"
+		default:
+			port = "80"
+		}
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
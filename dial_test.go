@@ -0,0 +1,267 @@
+package goproxy
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// newTestProxy 启动一个同时支持CONNECT隧道和绝对路径转发的HTTP代理
+func newTestProxy(t *testing.T) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var connects atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			r.RequestURI = ""
+			resp, err := http.DefaultTransport.RoundTrip(r)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadGateway)
+				return
+			}
+			defer resp.Body.Close()
+			w.Header().Set("X-Via-Proxy", "1")
+			w.WriteHeader(resp.StatusCode)
+			io.Copy(w, resp.Body)
+			return
+		}
+		connects.Add(1)
+		upstream, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			upstream.Close()
+			return
+		}
+		io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+		go func() {
+			io.Copy(upstream, conn)
+			upstream.Close()
+		}()
+		io.Copy(conn, upstream)
+		conn.Close()
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &connects
+}
+
+func TestGoProxy_HTTPProxy(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "plain")
+	}))
+	defer target.Close()
+	tlsTarget := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "secure")
+	}))
+	defer tlsTarget.Close()
+	proxySrv, connects := newTestProxy(t)
+
+	c := New()
+	if err := c.SetProxy(proxySrv.URL); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := c.GetClient().Get(target.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.Header.Get("X-Via-Proxy") != "1" {
+		t.Error("http请求应由代理以绝对路径形式转发")
+	}
+
+	resp, err = c.GetClient().Get(tlsTarget.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "secure" || connects.Load() != 1 {
+		t.Errorf("https请求应通过CONNECT隧道发送: %s, connects=%d", body, connects.Load())
+	}
+}
+
+func TestGoProxy_SetDialContext(t *testing.T) {
+	target := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer target.Close()
+	proxySrv, _ := newTestProxy(t)
+
+	var mu sync.Mutex
+	var dialed []string
+	c := New()
+	c.SetKeepAlive(false)
+	c.SetDialContext(func(ctx context.Context, network, addr string) (net.Conn, error) {
+		mu.Lock()
+		dialed = append(dialed, addr)
+		mu.Unlock()
+		return (&net.Dialer{}).DialContext(ctx, network, addr)
+	})
+	last := func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		return dialed[len(dialed)-1]
+	}
+
+	u, _ := url.Parse(target.URL)
+	if got := getBody(t, c, target.URL); got != "ok" || last() != u.Host {
+		t.Errorf("响应为%q, 拨号地址为%s", got, last())
+	}
+	// 使用代理时只拨号代理服务器，隧道在返回的连接上建立
+	if err := c.SetProxy(proxySrv.URL); err != nil {
+		t.Fatal(err)
+	}
+	pu, _ := url.Parse(proxySrv.URL)
+	if got := getBody(t, c, target.URL); got != "ok" || last() != pu.Host {
+		t.Errorf("响应为%q, 拨号地址为%s", got, last())
+	}
+
+	c.SetDialContext(nil)
+	n := len(dialed)
+	getBody(t, c, target.URL)
+	if len(dialed) != n {
+		t.Error("清除后不应再调用自定义拨号函数")
+	}
+}
+
+func TestGoProxy_DialContext(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.Copy(conn, conn)
+	}()
+	proxySrv, connects := newTestProxy(t)
+
+	c := New()
+	c.SetProxy(proxySrv.URL)
+	conn, err := c.DialContext(context.Background(), "tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	io.WriteString(conn, "ping")
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "ping" || connects.Load() != 1 {
+		t.Errorf("读取到%q, 错误为%v, CONNECT%d次", buf, err, connects.Load())
+	}
+	if _, err := c.DialContext(context.Background(), "udp", ln.Addr().String()); err == nil {
+		t.Error("udp应返回错误")
+	}
+}
+
+// newTestSOCKS5 启动一个不要求认证、只支持CONNECT的SOCKS5代理
+func newTestSOCKS5(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveTestSOCKS5(conn)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func serveTestSOCKS5(conn net.Conn) {
+	defer conn.Close()
+	buf := make([]byte, 256)
+	// VER NMETHODS METHODS，选择无需认证
+	if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+		return
+	}
+	io.ReadFull(conn, buf[:buf[1]])
+	conn.Write([]byte{0x05, 0x00})
+	// VER CMD RSV DST.ADDR
+	if _, err := io.ReadFull(conn, buf[:3]); err != nil || buf[1] != 0x01 {
+		return
+	}
+	host, port, err := readSOCKS5Addr(conn)
+	if err != nil {
+		return
+	}
+	target, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		conn.Write([]byte{0x05, 0x05, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer target.Close()
+	conn.Write([]byte{0x05, 0x00, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+	go io.Copy(target, conn)
+	io.Copy(conn, target)
+}
+
+func TestGoProxy_SOCKS5Proxy(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer srv.Close()
+
+	c := New()
+	if err := c.SetProxy("socks5://" + newTestSOCKS5(t)); err != nil {
+		t.Fatal(err)
+	}
+	if got := getBody(t, c, srv.URL); got != "ok" {
+		t.Errorf("通过SOCKS5代理的响应为%q", got)
+	}
+}
+
+func TestGoProxy_ConnectBufferedData(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		if _, err := http.ReadRequest(bufio.NewReader(conn)); err != nil {
+			return
+		}
+		// 隧道数据与200响应在同一次写入中发出
+		io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\nhello")
+		io.Copy(io.Discard, conn)
+	}()
+
+	c := New()
+	if err := c.SetProxy("http://" + ln.Addr().String()); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := c.DialContext(context.Background(), "tcp", "example.com:80")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "hello" {
+		t.Errorf("读取到%q，错误为%v", buf, err)
+	}
+}
@@ -0,0 +1,285 @@
+package goproxy
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// authChallenge WWW-Authenticate中的一个认证质询
+type authChallenge struct {
+	scheme string            // 认证方案，小写
+	params map[string]string // 参数，键为小写
+}
+
+// parseChallenges 解析WWW-Authenticate请求头，一个头中可以包含多个以逗号分隔的质询
+func parseChallenges(values []string) []authChallenge {
+	var challenges []authChallenge
+	for _, s := range values {
+		for i := 0; i < len(s); {
+			if c := s[i]; c == ' ' || c == '\t' || c == ',' {
+				i++
+				continue
+			}
+			start := i
+			for i < len(s) && !strings.ContainsRune(" \t,=", rune(s[i])) {
+				i++
+			}
+			token := strings.ToLower(s[start:i])
+			j := i
+			for j < len(s) && (s[j] == ' ' || s[j] == '\t') {
+				j++
+			}
+			if j >= len(s) || s[j] != '=' || len(challenges) == 0 {
+				challenges = append(challenges, authChallenge{scheme: token, params: make(map[string]string)})
+				continue
+			}
+			// 参数值可以是token或带引号的字符串
+			i = j + 1
+			for i < len(s) && (s[i] == ' ' || s[i] == '\t') {
+				i++
+			}
+			var value string
+			if i < len(s) && s[i] == '"' {
+				var b strings.Builder
+				for i++; i < len(s) && s[i] != '"'; i++ {
+					if s[i] == '\\' && i+1 < len(s) {
+						i++
+					}
+					b.WriteByte(s[i])
+				}
+				i++
+				value = b.String()
+			} else {
+				start := i
+				for i < len(s) && s[i] != ',' {
+					i++
+				}
+				value = strings.TrimSpace(s[start:i])
+			}
+			challenges[len(challenges)-1].params[token] = value
+		}
+	}
+	return challenges
+}
+
+// digestHashes Digest认证支持的算法
+var digestHashes = map[string]func() hash.Hash{
+	"MD5":         md5.New,
+	"SHA-256":     sha256.New,
+	"SHA-512-256": sha512.New512_256,
+}
+
+// digestChallenge 服务器下发的Digest质询及使用该质询的请求计数
+type digestChallenge struct {
+	realm     string
+	nonce     string
+	opaque    string
+	algorithm string // 大写的算法名，如MD5、SHA-256-sess
+	qop       bool   // 是否使用qop=auth
+	userhash  bool
+	nc        uint32 // 已使用该nonce的请求数
+}
+
+// newDigestChallenge 从WWW-Authenticate中选出支持的Digest质询，有多个时优先使用更强的算法
+func newDigestChallenge(values []string) (*digestChallenge, bool) {
+	var best *digestChallenge
+	rank := map[string]int{"MD5": 1, "SHA-256": 2, "SHA-512-256": 3}
+	for _, c := range parseChallenges(values) {
+		if c.scheme != "digest" || c.params["nonce"] == "" {
+			continue
+		}
+		ch := &digestChallenge{
+			realm:     c.params["realm"],
+			nonce:     c.params["nonce"],
+			opaque:    c.params["opaque"],
+			algorithm: strings.ToUpper(c.params["algorithm"]),
+			userhash:  strings.EqualFold(c.params["userhash"], "true"),
+		}
+		if ch.algorithm == "" {
+			ch.algorithm = "MD5"
+		}
+		if _, ok := digestHashes[strings.TrimSuffix(ch.algorithm, "-SESS")]; !ok {
+			continue
+		}
+		if qop, ok := c.params["qop"]; ok {
+			// 只支持qop=auth，服务器只接受auth-int时无法认证
+			for _, q := range strings.Split(qop, ",") {
+				if strings.EqualFold(strings.TrimSpace(q), "auth") {
+					ch.qop = true
+				}
+			}
+			if !ch.qop {
+				continue
+			}
+		}
+		if best == nil || rank[strings.TrimSuffix(ch.algorithm, "-SESS")] > rank[strings.TrimSuffix(best.algorithm, "-SESS")] {
+			best = ch
+		}
+	}
+	return best, best != nil
+}
+
+// authorize 按RFC 7616计算请求的Authorization请求头，调用方需保证同一质询的调用互斥
+func (ch *digestChallenge) authorize(user, pass, method, uri, cnonce string) string {
+	newHash := digestHashes[strings.TrimSuffix(ch.algorithm, "-SESS")]
+	h := func(s string) string {
+		hh := newHash()
+		io.WriteString(hh, s)
+		return hex.EncodeToString(hh.Sum(nil))
+	}
+	ch.nc++
+	nc := fmt.Sprintf("%08x", ch.nc)
+
+	ha1 := h(user + ":" + ch.realm + ":" + pass)
+	if strings.HasSuffix(ch.algorithm, "-SESS") {
+		ha1 = h(ha1 + ":" + ch.nonce + ":" + cnonce)
+	}
+	ha2 := h(method + ":" + uri)
+	var response string
+	if ch.qop {
+		response = h(ha1 + ":" + ch.nonce + ":" + nc + ":" + cnonce + ":auth:" + ha2)
+	} else {
+		response = h(ha1 + ":" + ch.nonce + ":" + ha2)
+	}
+
+	username := user
+	if ch.userhash {
+		username = h(user + ":" + ch.realm)
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `Digest username=%s, realm=%s, nonce=%s, uri=%s, algorithm=%s, response=%s`,
+		quoteAuthParam(username), quoteAuthParam(ch.realm), quoteAuthParam(ch.nonce), quoteAuthParam(uri), ch.algorithm, quoteAuthParam(response))
+	if ch.opaque != "" {
+		fmt.Fprintf(&sb, ", opaque=%s", quoteAuthParam(ch.opaque))
+	}
+	if ch.qop {
+		fmt.Fprintf(&sb, ", qop=auth, nc=%s, cnonce=%s", nc, quoteAuthParam(cnonce))
+	}
+	if ch.userhash {
+		sb.WriteString(", userhash=true")
+	}
+	return sb.String()
+}
+
+// quoteAuthParam 将s转为带引号的字符串，转义其中的引号和反斜杠
+func quoteAuthParam(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// DigestTransport 实现RFC 7616 Digest认证(qop=auth)的中间件
+// 收到Digest质询的401响应后计算认证信息并重试一次；质询按主机缓存，
+// 之后发往同一主机的请求直接使用缓存的nonce认证，nonce过期(stale=true)时服务器再次质询即可自动更新。
+// 请求体无法重放(未设置GetBody)时不重试，直接返回401响应。
+// 可通过GoProxy.SetTransport安装在底层Transport之上，或使用GoProxy.SetDigestAuth
+type DigestTransport struct {
+	user, pass string
+	next       http.RoundTripper
+
+	mu         sync.Mutex
+	challenges map[string]*digestChallenge // 主机 -> 最近的质询
+}
+
+// NewDigestTransport 创建Digest认证中间件
+// 参数:
+//   - user: 用户名
+//   - pass: 密码
+//   - next: 实际发送请求的RoundTripper，为nil时使用http.DefaultTransport
+func NewDigestTransport(user, pass string, next http.RoundTripper) *DigestTransport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &DigestTransport{user: user, pass: pass, next: next, challenges: make(map[string]*digestChallenge)}
+}
+
+// RoundTrip 实现http.RoundTripper接口
+func (d *DigestTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return d.roundTrip(req, d.next.RoundTrip)
+}
+
+// Unwrap 返回实际发送请求的RoundTripper，GoProxy.SetTransport通过它在其中的*http.Transport上安装代理等设置
+func (d *DigestTransport) Unwrap() http.RoundTripper {
+	return d.next
+}
+
+// roundTrip 通过send发送请求并处理Digest质询，请求本身带有Authorization时不处理
+func (d *DigestTransport) roundTrip(req *http.Request, send func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+	if req.Header.Get("Authorization") != "" {
+		return send(req)
+	}
+	host := canonicalAddr(req.URL)
+	uri := req.URL.RequestURI()
+	if auth := d.authorize(host, req.Method, uri); auth != "" {
+		req = cloneRequestHeader(req)
+		req.Header.Set("Authorization", auth)
+	}
+	resp, err := send(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	ch, ok := newDigestChallenge(resp.Header.Values("WWW-Authenticate"))
+	if !ok {
+		return resp, nil
+	}
+	d.mu.Lock()
+	d.challenges[host] = ch
+	d.mu.Unlock()
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return resp, nil
+	}
+
+	r2 := cloneRequestHeader(req)
+	if req.GetBody != nil {
+		if r2.Body, err = req.GetBody(); err != nil {
+			return resp, nil
+		}
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	resp.Body.Close()
+	r2.Header.Set("Authorization", d.authorize(host, req.Method, uri))
+	return send(r2)
+}
+
+// authorize 使用host缓存的质询计算Authorization，没有缓存时返回空字符串
+func (d *DigestTransport) authorize(host, method, uri string) string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	ch := d.challenges[host]
+	if ch == nil {
+		return ""
+	}
+	b := make([]byte, 16)
+	rand.Read(b)
+	return ch.authorize(d.user, d.pass, method, uri, hex.EncodeToString(b))
+}
+
+// cloneRequestHeader 浅复制请求并复制请求头，修改请求头不影响原请求
+func cloneRequestHeader(req *http.Request) *http.Request {
+	r2 := *req
+	r2.Header = req.Header.Clone()
+	return &r2
+}
+
+// SetDigestAuth 为所有请求启用Digest认证，服务器返回Digest质询时自动认证，见DigestTransport
+// 与SetTransport安装的中间件不同，代理、TLS指纹、HTTP/2等设置对认证请求同样生效
+// 参数:
+//   - user: 用户名，与pass都为空时取消认证
+//   - pass: 密码
+func (r *GoProxy) SetDigestAuth(user, pass string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ct := r.transport
+	if user == "" && pass == "" {
+		ct.digest.Store(nil)
+		return
+	}
+	ct.digest.Store(NewDigestTransport(user, pass, nil))
+}
@@ -0,0 +1,129 @@
+package goproxy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestDigestChallenge_Authorize(t *testing.T) {
+	// RFC 7616第3.9.1节的示例
+	values := []string{
+		`Digest realm="http-auth@example.org", qop="auth, auth-int", algorithm=SHA-256, nonce="7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"`,
+		`Digest realm="http-auth@example.org", qop="auth, auth-int", algorithm=MD5, nonce="7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS", Basic realm="x"`,
+	}
+	ch, ok := newDigestChallenge(values)
+	if !ok || ch.algorithm != "SHA-256" {
+		t.Fatalf("质询为%+v", ch)
+	}
+	cnonce := "f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ"
+	auth := ch.authorize("Mufasa", "Circle of Life", http.MethodGet, "/dir/index.html", cnonce)
+	if !strings.Contains(auth, `response="753927fa0e85d155564e2e272a28d1802ca10daf4496794697cf8db5856cb6c1"`) {
+		t.Errorf("SHA-256认证为%s", auth)
+	}
+	ch, _ = newDigestChallenge(values[1:])
+	auth = ch.authorize("Mufasa", "Circle of Life", http.MethodGet, "/dir/index.html", cnonce)
+	if !strings.Contains(auth, `response="8ca523f5e9506fed4657c9700eebdbec"`) || !strings.Contains(auth, "nc=00000001") {
+		t.Errorf("MD5认证为%s", auth)
+	}
+	if _, ok := newDigestChallenge([]string{`Digest realm="a", nonce="n", qop="auth-int"`, `Basic realm="a"`}); ok {
+		t.Error("只支持auth-int时不应使用Digest认证")
+	}
+}
+
+// newTestDigestServer 要求SHA-256 Digest认证的测试服务器，nonce修改当前有效的nonce，requests返回收到的请求数
+func newTestDigestServer(t *testing.T, user, pass string) (srv *httptest.Server, nonce func(string), requests func() int) {
+	var mu sync.Mutex
+	current, count := "n1", 0
+	h := func(s string) string {
+		sum := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(sum[:])
+	}
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		count++
+		challenges := parseChallenges(r.Header.Values("Authorization"))
+		if len(challenges) == 1 && challenges[0].scheme == "digest" {
+			p := challenges[0].params
+			ha1 := h(user + ":test:" + pass)
+			ha2 := h(r.Method + ":" + r.URL.RequestURI())
+			want := h(ha1 + ":" + p["nonce"] + ":" + p["nc"] + ":" + p["cnonce"] + ":auth:" + ha2)
+			if p["username"] == user && p["uri"] == r.URL.RequestURI() && p["response"] == want && p["opaque"] == "o" {
+				if p["nonce"] == current {
+					body, _ := io.ReadAll(r.Body)
+					fmt.Fprintf(w, "%s %s", p["nc"], body)
+					return
+				}
+				w.Header().Set("WWW-Authenticate", `Digest realm="test", qop="auth", algorithm=SHA-256, opaque="o", stale=true, nonce="`+current+`"`)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+		}
+		w.Header().Set("WWW-Authenticate", `Digest realm="test", qop="auth", algorithm=SHA-256, opaque="o", nonce="`+current+`"`)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func(n string) {
+			mu.Lock()
+			current = n
+			mu.Unlock()
+		}, func() int {
+			mu.Lock()
+			defer mu.Unlock()
+			return count
+		}
+}
+
+func TestGoProxy_SetDigestAuth(t *testing.T) {
+	srv, setNonce, requests := newTestDigestServer(t, "admin", "secret")
+
+	c := New()
+	c.SetDigestAuth("admin", "secret")
+	post := func() (int, string) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/cgi?a=1", strings.NewReader("body"))
+		resp, err := c.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+	if code, body := post(); code != http.StatusOK || body != "00000001 body" || requests() != 2 {
+		t.Errorf("状态码为%d, 响应为%q, 请求%d次", code, body, requests())
+	}
+	// 复用缓存的nonce，不再需要质询
+	if code, body := post(); code != http.StatusOK || body != "00000002 body" || requests() != 3 {
+		t.Errorf("状态码为%d, 响应为%q, 请求%d次", code, body, requests())
+	}
+	setNonce("n2")
+	if code, body := post(); code != http.StatusOK || body != "00000001 body" || requests() != 5 {
+		t.Errorf("nonce过期后状态码为%d, 响应为%q, 请求%d次", code, body, requests())
+	}
+
+	c.SetDigestAuth("admin", "wrong")
+	if code, _ := post(); code != http.StatusUnauthorized || requests() != 7 {
+		t.Errorf("密码错误时状态码为%d, 请求%d次", code, requests())
+	}
+	c.SetDigestAuth("", "")
+	if code, _ := post(); code != http.StatusUnauthorized || requests() != 8 {
+		t.Errorf("取消后状态码为%d, 请求%d次", code, requests())
+	}
+}
+
+func TestDigestTransport(t *testing.T) {
+	srv, _, _ := newTestDigestServer(t, "admin", "secret")
+	c := New()
+	c.SetTransport(NewDigestTransport("admin", "secret", c.GetTransport()))
+	if got := getBody(t, c, srv.URL); got != "00000001 " {
+		t.Errorf("响应为%q", got)
+	}
+}
@@ -0,0 +1,245 @@
+package goproxy
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// diskCacheIndexFile 磁盘缓存目录中索引文件的名称
+const diskCacheIndexFile = "index.json"
+
+// diskCacheEntry 索引中的一条记录
+type diskCacheEntry struct {
+	Hash       string    `json:"hash"`        // 内容的SHA-256，即数据文件名
+	Size       int64     `json:"size"`        // 数据大小
+	AccessedAt time.Time `json:"accessed_at"` // 最近一次读写的时间，淘汰时优先删除最久未访问的记录
+}
+
+// DiskCache 基于文件的缓存存储，实现CacheStorage接口，重启后缓存仍然可用
+// 数据按内容的SHA-256保存为独立文件，内容相同的记录共享同一文件，读取时校验哈希，文件损坏时视为不存在；
+// 键与文件的对应关系保存在索引文件中。总大小超过上限时按最近访问时间淘汰。
+// 索引在写入和删除时保存，读取只更新内存中的访问时间，可调用Flush保存
+type DiskCache struct {
+	dir      string
+	maxBytes int64
+
+	mu      sync.Mutex
+	entries map[string]*diskCacheEntry // 键 -> 记录
+	refs    map[string]int             // 内容哈希 -> 引用它的记录数
+	size    int64                      // 所有数据文件的总大小
+}
+
+// NewDiskCache 创建磁盘缓存存储，目录中已有索引时加载其中的记录，并删除索引中不存在的数据文件
+// 参数:
+//   - dir: 缓存目录，不存在时自动创建
+//   - maxBytes: 数据文件的总大小上限，小于等于0时不限制
+func NewDiskCache(dir string, maxBytes int64) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("创建缓存目录失败: %w", err)
+	}
+	d := &DiskCache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		entries:  make(map[string]*diskCacheEntry),
+		refs:     make(map[string]int),
+	}
+	data, err := os.ReadFile(filepath.Join(dir, diskCacheIndexFile))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("读取缓存索引失败: %w", err)
+	}
+	if len(data) > 0 {
+		var entries map[string]*diskCacheEntry
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return nil, fmt.Errorf("解析缓存索引失败: %w", err)
+		}
+		for key, e := range entries {
+			info, err := os.Stat(d.path(e.Hash))
+			if err != nil || info.Size() != e.Size {
+				continue
+			}
+			d.entries[key] = e
+			if d.refs[e.Hash] == 0 {
+				d.size += e.Size
+			}
+			d.refs[e.Hash]++
+		}
+	}
+	d.removeOrphans()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.evict()
+	return d, d.saveIndex()
+}
+
+// path 返回内容哈希对应的数据文件路径，按哈希的前两位分目录
+func (d *DiskCache) path(hash string) string {
+	if len(hash) < 2 {
+		return filepath.Join(d.dir, "_", hash)
+	}
+	return filepath.Join(d.dir, hash[:2], hash)
+}
+
+// removeOrphans 删除没有被索引引用的数据文件和写入中断留下的临时文件
+func (d *DiskCache) removeOrphans() {
+	dirs, _ := os.ReadDir(d.dir)
+	for _, sub := range dirs {
+		if !sub.IsDir() {
+			if strings.HasPrefix(sub.Name(), diskCacheIndexFile+".tmp") {
+				os.Remove(filepath.Join(d.dir, sub.Name()))
+			}
+			continue
+		}
+		files, _ := os.ReadDir(filepath.Join(d.dir, sub.Name()))
+		for _, f := range files {
+			if d.refs[f.Name()] == 0 {
+				os.Remove(filepath.Join(d.dir, sub.Name(), f.Name()))
+			}
+		}
+	}
+}
+
+// Get 实现CacheStorage接口
+func (d *DiskCache) Get(key string) ([]byte, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	e, ok := d.entries[key]
+	if !ok {
+		return nil, false
+	}
+	data, err := os.ReadFile(d.path(e.Hash))
+	if sum := sha256.Sum256(data); err != nil || hex.EncodeToString(sum[:]) != e.Hash {
+		d.remove(key)
+		d.saveIndex()
+		return nil, false
+	}
+	e.AccessedAt = time.Now()
+	return data, true
+}
+
+// Set 实现CacheStorage接口，写入失败或数据超过大小上限时不保存
+func (d *DiskCache) Set(key string, data []byte) {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	size := int64(len(data))
+	if d.maxBytes > 0 && size > d.maxBytes {
+		d.Delete(key)
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if e, ok := d.entries[key]; ok && e.Hash == hash {
+		e.AccessedAt = time.Now()
+		return
+	}
+	if d.refs[hash] == 0 {
+		if err := writeFileAtomic(d.path(hash), data); err != nil {
+			return
+		}
+	}
+	d.remove(key)
+	d.entries[key] = &diskCacheEntry{Hash: hash, Size: size, AccessedAt: time.Now()}
+	if d.refs[hash] == 0 {
+		d.size += size
+	}
+	d.refs[hash]++
+	d.evict()
+	d.saveIndex()
+}
+
+// Delete 实现CacheStorage接口
+func (d *DiskCache) Delete(key string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.entries[key]; ok {
+		d.remove(key)
+		d.saveIndex()
+	}
+}
+
+// Size 返回数据文件的总大小
+func (d *DiskCache) Size() int64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.size
+}
+
+// Len 返回缓存的记录数
+func (d *DiskCache) Len() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.entries)
+}
+
+// Flush 保存索引，包括读取时更新的访问时间
+func (d *DiskCache) Flush() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.saveIndex()
+}
+
+// Clear 删除所有记录和数据文件
+func (d *DiskCache) Clear() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for key := range d.entries {
+		d.remove(key)
+	}
+	return d.saveIndex()
+}
+
+// remove 删除记录，数据文件不再被引用时一并删除，调用方需持有锁
+func (d *DiskCache) remove(key string) {
+	e, ok := d.entries[key]
+	if !ok {
+		return
+	}
+	delete(d.entries, key)
+	d.refs[e.Hash]--
+	if d.refs[e.Hash] <= 0 {
+		delete(d.refs, e.Hash)
+		os.Remove(d.path(e.Hash))
+		d.size -= e.Size
+	}
+}
+
+// evict 总大小超过上限时删除最久未访问的记录，调用方需持有锁
+func (d *DiskCache) evict() {
+	if d.maxBytes <= 0 || d.size <= d.maxBytes {
+		return
+	}
+	keys := slices.Collect(maps.Keys(d.entries))
+	slices.SortFunc(keys, func(a, b string) int {
+		return d.entries[a].AccessedAt.Compare(d.entries[b].AccessedAt)
+	})
+	for _, key := range keys {
+		if d.size <= d.maxBytes {
+			return
+		}
+		d.remove(key)
+	}
+}
+
+// saveIndex 保存索引文件，调用方需持有锁
+func (d *DiskCache) saveIndex() error {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(d.entries); err != nil {
+		return fmt.Errorf("保存缓存索引失败: %w", err)
+	}
+	if err := writeFileAtomic(filepath.Join(d.dir, diskCacheIndexFile), buf.Bytes()); err != nil {
+		return fmt.Errorf("保存缓存索引失败: %w", err)
+	}
+	return nil
+}
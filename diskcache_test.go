@@ -0,0 +1,93 @@
+package goproxy
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDiskCache(t *testing.T) {
+	dir := t.TempDir()
+	d, err := NewDiskCache(dir, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Set("a", []byte("12345"))
+	d.Set("b", []byte("12345"))
+	if data, ok := d.Get("a"); !ok || string(data) != "12345" {
+		t.Errorf("读取的数据为%q", data)
+	}
+	// 内容相同的记录共享数据文件
+	if d.Size() != 5 || d.Len() != 2 {
+		t.Errorf("总大小为%d, 记录数为%d", d.Size(), d.Len())
+	}
+	d.Set("c", []byte("abcde"))
+	d.Get("c")
+	// 超过上限时淘汰最久未访问的记录，b被删除后a仍引用共享的数据文件
+	d.Set("d", []byte("xyz"))
+	if _, ok := d.Get("b"); ok {
+		t.Error("最久未访问的记录未被淘汰")
+	}
+	if d.Size() > 10 {
+		t.Errorf("淘汰后总大小为%d", d.Size())
+	}
+	d.Set("big", []byte(strings.Repeat("x", 11)))
+	if _, ok := d.Get("big"); ok {
+		t.Error("超过上限的数据不应保存")
+	}
+
+	// 重新打开后记录仍然存在
+	keys := d.Len()
+	d.Flush()
+	d2, err := NewDiskCache(dir, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d2.Len() != keys || d2.Size() != d.Size() {
+		t.Errorf("重新打开后记录数为%d, 总大小为%d", d2.Len(), d2.Size())
+	}
+	if data, ok := d2.Get("d"); !ok || string(data) != "xyz" {
+		t.Errorf("重新打开后读取的数据为%q", data)
+	}
+
+	// 数据文件损坏时视为不存在
+	d2.Set("e", []byte("hello"))
+	matches, _ := filepath.Glob(filepath.Join(dir, "*", "*"))
+	for _, m := range matches {
+		if data, _ := os.ReadFile(m); string(data) == "hello" {
+			os.WriteFile(m, []byte("hellx"), 0o644)
+		}
+	}
+	if _, ok := d2.Get("e"); ok {
+		t.Error("损坏的数据文件不应返回")
+	}
+
+	if err := d2.Clear(); err != nil || d2.Len() != 0 || d2.Size() != 0 {
+		t.Errorf("清空后记录数为%d, 总大小为%d, 错误为%v", d2.Len(), d2.Size(), err)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dir, "*", "*")); len(matches) != 0 {
+		t.Errorf("清空后仍有数据文件%v", matches)
+	}
+}
+
+func TestDiskCache_CacheTransport(t *testing.T) {
+	srv, requests := newTestCacheServer(t)
+	dir := t.TempDir()
+	get := func() string {
+		t.Helper()
+		d, err := NewDiskCache(dir, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := New()
+		c.SetTransport(NewCacheTransport(d, c.GetTransport()))
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/fresh", nil)
+		return doBody(t, c, req)
+	}
+	// 模拟重启: 每次创建新的客户端和存储
+	if a, b := get(), get(); a != "1" || b != "1" || requests.Load() != 1 {
+		t.Errorf("重启后的响应为%q和%q，请求了%d次", a, b, requests.Load())
+	}
+}
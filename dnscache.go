@@ -0,0 +1,234 @@
+package goproxy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultDNSCacheTTL 解析器不提供TTL时缓存解析结果的时长
+	DefaultDNSCacheTTL = time.Minute
+	// DefaultDNSNegativeTTL 缓存域名不存在结果的时长
+	DefaultDNSNegativeTTL = 10 * time.Second
+)
+
+// ttlResolver 能够返回记录TTL的解析器，如DoHResolver、DoTResolver
+type ttlResolver interface {
+	lookupTTL(ctx context.Context, host string) ([]net.IPAddr, time.Duration, error)
+}
+
+// DNSCacheStats DNS缓存的统计快照，可直接序列化为JSON供监控系统采集
+type DNSCacheStats struct {
+	Hits         int64   `json:"hits"`          // 命中缓存的次数，包括命中否定缓存
+	NegativeHits int64   `json:"negative_hits"` // 命中否定缓存的次数
+	Misses       int64   `json:"misses"`        // 未命中缓存而实际解析的次数
+	HitRate      float64 `json:"hit_rate"`      // 命中率(0-1)
+	Entries      int     `json:"entries"`       // 当前缓存的域名数，包括已过期但未清理的
+}
+
+// dnsCacheEntry 单个域名的缓存结果
+type dnsCacheEntry struct {
+	ips     []net.IPAddr
+	err     error         // 域名不存在时的错误，用于否定缓存
+	expires time.Time     // 过期时间
+	cached  bool          // 解析结果是否被缓存，临时错误不缓存
+	done    chan struct{} // 解析完成后关闭，解析期间同一域名的其他查询等待该结果
+}
+
+// dnsCache 按域名缓存解析结果，同一域名的并发查询只解析一次
+type dnsCache struct {
+	mu           sync.Mutex
+	entries      map[string]*dnsCacheEntry
+	ttl          time.Duration // 解析器不提供TTL时使用的缓存时长
+	negativeTTL  time.Duration // 否定缓存时长，为0时不缓存失败结果
+	hits         int64
+	negativeHits int64
+	misses       int64
+}
+
+func newDNSCache() *dnsCache {
+	return &dnsCache{
+		entries:     make(map[string]*dnsCacheEntry),
+		ttl:         DefaultDNSCacheTTL,
+		negativeTTL: DefaultDNSNegativeTTL,
+	}
+}
+
+// lookup 优先返回缓存的结果，缓存不存在或已过期时使用res解析，res为nil时使用系统解析
+func (c *dnsCache) lookup(ctx context.Context, res Resolver, host string) ([]net.IPAddr, error) {
+	key := normalizeHost(host)
+	c.mu.Lock()
+	if e, ok := c.entries[key]; ok {
+		select {
+		case <-e.done:
+			if time.Now().Before(e.expires) {
+				c.hits++
+				if e.err != nil {
+					c.negativeHits++
+				}
+				c.mu.Unlock()
+				return e.ips, e.err
+			}
+		default:
+			// 其他查询正在解析该域名，等待其结果
+			c.mu.Unlock()
+			select {
+			case <-e.done:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			if !e.cached {
+				// 对方的结果未被缓存，自行解析
+				ips, _, err := c.resolve(ctx, res, host)
+				return ips, err
+			}
+			c.mu.Lock()
+			c.hits++
+			if e.err != nil {
+				c.negativeHits++
+			}
+			c.mu.Unlock()
+			return e.ips, e.err
+		}
+	}
+	e := &dnsCacheEntry{done: make(chan struct{})}
+	c.entries[key] = e
+	c.misses++
+	c.mu.Unlock()
+
+	ips, ttl, err := c.resolve(ctx, res, host)
+	c.mu.Lock()
+	switch {
+	case err == nil && ttl > 0:
+		e.ips, e.expires, e.cached = ips, time.Now().Add(ttl), true
+	case isNotFound(err) && c.negativeTTL > 0:
+		e.err, e.expires, e.cached = err, time.Now().Add(c.negativeTTL), true
+	default:
+		// 临时错误或TTL为0的结果不缓存
+		if c.entries[key] == e {
+			delete(c.entries, key)
+		}
+	}
+	close(e.done)
+	c.mu.Unlock()
+	return ips, err
+}
+
+// resolve 不经过缓存解析host，同时返回结果应缓存的时长
+func (c *dnsCache) resolve(ctx context.Context, res Resolver, host string) ([]net.IPAddr, time.Duration, error) {
+	if tr, ok := res.(ttlResolver); ok {
+		return tr.lookupTTL(ctx, host)
+	}
+	if res == nil {
+		res = net.DefaultResolver
+	}
+	c.mu.Lock()
+	ttl := c.ttl
+	c.mu.Unlock()
+	ips, err := res.LookupIPAddr(ctx, host)
+	return ips, ttl, err
+}
+
+// clear 清空缓存的解析结果，统计数据保持不变
+func (c *dnsCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, e := range c.entries {
+		select {
+		case <-e.done:
+			delete(c.entries, key)
+		default:
+		}
+	}
+}
+
+// stats 返回统计快照
+func (c *dnsCache) stats() DNSCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := DNSCacheStats{
+		Hits:         c.hits,
+		NegativeHits: c.negativeHits,
+		Misses:       c.misses,
+		Entries:      len(c.entries),
+	}
+	if total := c.hits + c.misses; total > 0 {
+		s.HitRate = float64(c.hits) / float64(total)
+	}
+	return s
+}
+
+// isNotFound 判断err是否表示域名不存在，只有这类错误会被否定缓存
+func isNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
+
+// cachedResolver 通过dnsCache查询的Resolver
+type cachedResolver struct {
+	cache *dnsCache
+	res   Resolver
+}
+
+func (c cachedResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	return c.cache.lookup(ctx, c.res, host)
+}
+
+// EnableDNSCache 开启或关闭直接连接时的DNS缓存，关闭时清空缓存和统计数据
+// 缓存时长优先使用记录的TTL(DoH/DoT解析器)，系统解析等不提供TTL的解析器使用SetDNSCacheTTL设置的时长；
+// 域名不存在的结果按否定缓存时长缓存，超时等临时错误不缓存
+func (r *GoProxy) EnableDNSCache(enable bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !enable {
+		r.dnsCache = nil
+	} else if r.dnsCache == nil {
+		r.dnsCache = newDNSCache()
+	}
+}
+
+// SetDNSCacheTTL 设置DNS缓存时长，需先调用EnableDNSCache开启缓存
+// 参数:
+//   - ttl: 解析器不提供TTL时缓存解析结果的时长，小于等于0时使用DefaultDNSCacheTTL
+//   - negativeTTL: 缓存域名不存在结果的时长，为0时不缓存失败结果，小于0时使用DefaultDNSNegativeTTL
+func (r *GoProxy) SetDNSCacheTTL(ttl, negativeTTL time.Duration) {
+	if ttl <= 0 {
+		ttl = DefaultDNSCacheTTL
+	}
+	if negativeTTL < 0 {
+		negativeTTL = DefaultDNSNegativeTTL
+	}
+	r.mu.Lock()
+	cache := r.dnsCache
+	r.mu.Unlock()
+	if cache == nil {
+		return
+	}
+	cache.mu.Lock()
+	cache.ttl, cache.negativeTTL = ttl, negativeTTL
+	cache.mu.Unlock()
+}
+
+// ClearDNSCache 清空缓存的解析结果，统计数据保持不变
+func (r *GoProxy) ClearDNSCache() {
+	r.mu.Lock()
+	cache := r.dnsCache
+	r.mu.Unlock()
+	if cache != nil {
+		cache.clear()
+	}
+}
+
+// DNSCacheStats 返回DNS缓存的命中统计，未开启缓存时返回零值
+func (r *GoProxy) DNSCacheStats() DNSCacheStats {
+	r.mu.Lock()
+	cache := r.dnsCache
+	r.mu.Unlock()
+	if cache == nil {
+		return DNSCacheStats{}
+	}
+	return cache.stats()
+}
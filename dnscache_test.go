@@ -0,0 +1,147 @@
+package goproxy
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingResolver 将internal.test解析为127.0.0.1并记录查询次数
+type countingResolver struct {
+	lookups atomic.Int64
+	delay   time.Duration
+}
+
+func (c *countingResolver) LookupIPAddr(_ context.Context, host string) ([]net.IPAddr, error) {
+	c.lookups.Add(1)
+	time.Sleep(c.delay)
+	if host != "internal.test" {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return []net.IPAddr{{IP: net.IPv4(127, 0, 0, 1)}}, nil
+}
+
+// ttlCountingResolver 在countingResolver的基础上返回固定的TTL
+type ttlCountingResolver struct {
+	countingResolver
+	ttl time.Duration
+}
+
+func (c *ttlCountingResolver) lookupTTL(ctx context.Context, host string) ([]net.IPAddr, time.Duration, error) {
+	ips, err := c.LookupIPAddr(ctx, host)
+	return ips, c.ttl, err
+}
+
+func TestGoProxy_EnableDNSCache(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+	target := "http://internal.test:" + u.Port()
+
+	c := New()
+	c.SetKeepAlive(false)
+	res := &countingResolver{}
+	c.SetResolver(res)
+	c.EnableDNSCache(true)
+	for i := 0; i < 3; i++ {
+		if got := getBody(t, c, target); got != "ok" {
+			t.Fatalf("响应为%q", got)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := c.GetClient().Get("http://missing.test/"); err == nil {
+			t.Fatal("无法解析的域名应返回错误")
+		}
+	}
+	if n := res.lookups.Load(); n != 2 {
+		t.Errorf("实际解析%d次", n)
+	}
+	stats := c.DNSCacheStats()
+	if stats.Hits != 3 || stats.NegativeHits != 1 || stats.Misses != 2 || stats.Entries != 2 || stats.HitRate != 0.6 {
+		t.Errorf("统计为%+v", stats)
+	}
+
+	c.ClearDNSCache()
+	getBody(t, c, target)
+	if n := res.lookups.Load(); n != 3 {
+		t.Errorf("清空缓存后实际解析%d次", n)
+	}
+
+	c.EnableDNSCache(false)
+	getBody(t, c, target)
+	if n := res.lookups.Load(); n != 4 || c.DNSCacheStats() != (DNSCacheStats{}) {
+		t.Errorf("关闭缓存后实际解析%d次, 统计为%+v", n, c.DNSCacheStats())
+	}
+}
+
+func TestDNSCache_TTL(t *testing.T) {
+	cache := newDNSCache()
+	cache.ttl, cache.negativeTTL = 50*time.Millisecond, 0
+	res := &countingResolver{}
+	for i := 0; i < 2; i++ {
+		cache.lookup(t.Context(), res, "internal.test")
+		cache.lookup(t.Context(), res, "missing.test")
+	}
+	if n := res.lookups.Load(); n != 3 {
+		t.Errorf("否定缓存关闭时实际解析%d次", n)
+	}
+	time.Sleep(60 * time.Millisecond)
+	cache.lookup(t.Context(), res, "internal.test")
+	if n := res.lookups.Load(); n != 4 {
+		t.Errorf("过期后实际解析%d次", n)
+	}
+
+	// 优先使用记录的TTL，TTL为0时不缓存
+	tr := &ttlCountingResolver{ttl: time.Hour}
+	cache.lookup(t.Context(), tr, "internal.test")
+	time.Sleep(60 * time.Millisecond)
+	cache.lookup(t.Context(), tr, "INTERNAL.test")
+	tr.ttl = 0
+	cache.lookup(t.Context(), tr, "other.test")
+	cache.lookup(t.Context(), tr, "other.test")
+	if n := tr.lookups.Load(); n != 3 {
+		t.Errorf("使用记录TTL时实际解析%d次", n)
+	}
+}
+
+func TestDNSCache_NormalizeHost(t *testing.T) {
+	// 大小写和末尾的点不同的同一域名共用缓存
+	cache := newDNSCache()
+	res := &countingResolver{}
+	for _, host := range []string{"internal.test", "Internal.Test", "internal.test."} {
+		if _, err := cache.lookup(t.Context(), res, host); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := res.lookups.Load(); n != 1 {
+		t.Errorf("实际解析%d次", n)
+	}
+}
+
+func TestDNSCache_Concurrent(t *testing.T) {
+	cache := newDNSCache()
+	res := &countingResolver{delay: 50 * time.Millisecond}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if ips, err := cache.lookup(t.Context(), res, "internal.test"); err != nil || len(ips) != 1 {
+				t.Errorf("解析结果为%v, %v", ips, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := res.lookups.Load(); n != 1 {
+		t.Errorf("并发查询实际解析%d次", n)
+	}
+}
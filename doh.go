@@ -0,0 +1,226 @@
+package goproxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// DoHResolver 基于DNS-over-HTTPS(RFC 8484)的域名解析器
+type DoHResolver struct {
+	Endpoint string       // 查询地址，如"https://1.1.1.1/dns-query"
+	Client   *http.Client // 发送查询的HTTP客户端，为nil时使用http.DefaultClient
+}
+
+// LookupIPAddr 实现Resolver接口，同时查询A和AAAA记录
+func (d *DoHResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	ips, _, err := lookupIPAddrTTL(ctx, host, d.exchange)
+	return ips, err
+}
+
+// lookupTTL 查询host的地址及记录的TTL
+func (d *DoHResolver) lookupTTL(ctx context.Context, host string) ([]net.IPAddr, time.Duration, error) {
+	return lookupIPAddrTTL(ctx, host, d.exchange)
+}
+
+// CloseIdleConnections 关闭Client的空闲连接，Client为nil时使用的http.DefaultClient由其他代码共用，不关闭
+func (d *DoHResolver) CloseIdleConnections() {
+	if d.Client != nil {
+		d.Client.CloseIdleConnections()
+	}
+}
+
+// exchange 通过POST发送一次DNS查询
+func (d *DoHResolver) exchange(ctx context.Context, name string, qtype dnsmessage.Type) (*dnsmessage.Message, error) {
+	query, id, err := buildDNSQuery(name, qtype)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.Endpoint, bytes.NewReader(query))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+	client := d.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("发送DoH查询失败: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("DoH服务器返回错误: %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 65535))
+	if err != nil {
+		return nil, fmt.Errorf("读取DoH响应失败: %w", err)
+	}
+	return parseDNSResponse(body, id)
+}
+
+// DoTResolver 基于DNS-over-TLS(RFC 7858)的域名解析器，每次查询使用新的连接
+type DoTResolver struct {
+	Addr       string      // 服务器地址，如"1.1.1.1:853"
+	ServerName string      // 校验证书使用的名称，为空时使用Addr中的主机
+	TLSConfig  *tls.Config // TLS配置，为nil时使用系统根证书校验
+	// Dial 建立TCP连接，为nil时直接连接
+	Dial func(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// LookupIPAddr 实现Resolver接口，同时查询A和AAAA记录
+func (d *DoTResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	ips, _, err := lookupIPAddrTTL(ctx, host, d.exchange)
+	return ips, err
+}
+
+// lookupTTL 查询host的地址及记录的TTL
+func (d *DoTResolver) lookupTTL(ctx context.Context, host string) ([]net.IPAddr, time.Duration, error) {
+	return lookupIPAddrTTL(ctx, host, d.exchange)
+}
+
+// exchange 建立TLS连接并发送一次DNS查询
+func (d *DoTResolver) exchange(ctx context.Context, name string, qtype dnsmessage.Type) (*dnsmessage.Message, error) {
+	query, id, err := buildDNSQuery(name, qtype)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := dialWith(ctx, d.Dial, "tcp", d.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("连接DoT服务器失败: %w", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	cfg := d.TLSConfig.Clone()
+	if cfg == nil {
+		cfg = &tls.Config{}
+	}
+	if cfg.ServerName == "" {
+		cfg.ServerName = d.ServerName
+	}
+	if cfg.ServerName == "" {
+		cfg.ServerName, _, _ = net.SplitHostPort(d.Addr)
+	}
+	tlsConn := tls.Client(conn, cfg)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return nil, fmt.Errorf("与DoT服务器TLS握手失败: %w", err)
+	}
+	return dnsConnExchange(tlsConn, true, query, id)
+}
+
+// lookupIPAddrTTL 通过exchange并发查询A和AAAA记录，返回合并后的地址和最小的TTL
+func lookupIPAddrTTL(ctx context.Context, host string, exchange func(context.Context, string, dnsmessage.Type) (*dnsmessage.Message, error)) ([]net.IPAddr, time.Duration, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IPAddr{{IP: ip}}, 0, nil
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+	}
+	type result struct {
+		msg *dnsmessage.Message
+		err error
+	}
+	types := []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA}
+	results := make([]chan result, len(types))
+	for i, qtype := range types {
+		results[i] = make(chan result, 1)
+		go func() {
+			msg, err := exchange(ctx, host, qtype)
+			results[i] <- result{msg, err}
+		}()
+	}
+
+	var ips []net.IPAddr
+	var ttl time.Duration
+	var firstErr error
+	for _, ch := range results {
+		res := <-ch
+		if res.err != nil {
+			if firstErr == nil {
+				firstErr = res.err
+			}
+			continue
+		}
+		for _, ans := range res.msg.Answers {
+			var ip net.IP
+			switch body := ans.Body.(type) {
+			case *dnsmessage.AResource:
+				ip = net.IP(body.A[:])
+			case *dnsmessage.AAAAResource:
+				ip = net.IP(body.AAAA[:])
+			default:
+				continue
+			}
+			ips = append(ips, net.IPAddr{IP: ip})
+			if t := time.Duration(ans.Header.TTL) * time.Second; ttl == 0 || t < ttl {
+				ttl = t
+			}
+		}
+	}
+	if len(ips) == 0 {
+		if firstErr != nil {
+			return nil, 0, firstErr
+		}
+		return nil, 0, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return ips, ttl, nil
+}
+
+// noResolverKey 标记拨号时不使用自定义解析器的context键
+// DoH/DoT查询本身需要连接DNS服务器，使用系统解析以免递归
+type noResolverKey struct{}
+
+// bootstrapDial 按当前代理配置拨号，直接连接时使用系统解析
+func (r *GoProxy) bootstrapDial(ctx context.Context, network, addr string) (net.Conn, error) {
+	return r.dialContext(context.WithValue(ctx, noResolverKey{}, true), network, addr)
+}
+
+// SetDoH 使用DNS-over-HTTPS解析域名，查询按当前代理配置发送，服务器证书按系统根证书校验
+// 参数:
+//   - endpoint: 查询地址，如"https://1.1.1.1/dns-query"；使用域名时该域名本身由系统解析
+func (r *GoProxy) SetDoH(endpoint string) error {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return fmt.Errorf("DoH地址解析失败: %w", err)
+	}
+	if u.Scheme != "https" || u.Host == "" {
+		return errors.New("DoH地址必须是https URL")
+	}
+	r.SetResolver(&DoHResolver{
+		Endpoint: endpoint,
+		Client: &http.Client{
+			Transport: &http.Transport{DialContext: r.bootstrapDial, ForceAttemptHTTP2: true},
+			Timeout:   10 * time.Second,
+		},
+	})
+	return nil
+}
+
+// SetDoT 使用DNS-over-TLS解析域名，查询按当前代理配置发送，服务器证书按系统根证书校验
+// 参数:
+//   - addr: 服务器地址，如"1.1.1.1:853"，省略端口时使用853
+func (r *GoProxy) SetDoT(addr string) error {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "853")
+	}
+	if host, _, _ := net.SplitHostPort(addr); host == "" {
+		return errors.New("DoT地址缺少主机")
+	}
+	r.SetResolver(&DoTResolver{Addr: addr, Dial: r.bootstrapDial})
+	return nil
+}
@@ -0,0 +1,158 @@
+package goproxy
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// answerTestDNS 将internal.test解析为127.0.0.1，其他域名返回NXDOMAIN
+func answerTestDNS(t *testing.T, query []byte) []byte {
+	var msg dnsmessage.Message
+	if err := msg.Unpack(query); err != nil || len(msg.Questions) != 1 {
+		t.Errorf("DNS查询格式错误: %v", err)
+		return nil
+	}
+	q := msg.Questions[0]
+	msg.Header.Response = true
+	if q.Name.String() != "internal.test." {
+		msg.Header.RCode = dnsmessage.RCodeNameError
+	} else if q.Type == dnsmessage.TypeA {
+		msg.Answers = []dnsmessage.Resource{{
+			Header: dnsmessage.ResourceHeader{Name: q.Name, Type: q.Type, Class: q.Class, TTL: 60},
+			Body:   &dnsmessage.AResource{A: [4]byte{127, 0, 0, 1}},
+		}}
+	}
+	resp, err := msg.Pack()
+	if err != nil {
+		t.Error(err)
+	}
+	return resp
+}
+
+// newTestDoH 启动DoH测试服务器
+func newTestDoH(t *testing.T) *httptest.Server {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/dns-message" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		query, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/dns-message")
+		w.Write(answerTestDNS(t, query))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// newTestDoT 使用与srv相同的证书启动DoT测试服务器，返回监听地址
+func newTestDoT(t *testing.T, srv *httptest.Server) string {
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: srv.TLS.Certificates})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				var n uint16
+				if err := binary.Read(conn, binary.BigEndian, &n); err != nil {
+					return
+				}
+				query := make([]byte, n)
+				if _, err := io.ReadFull(conn, query); err != nil {
+					return
+				}
+				resp := answerTestDNS(t, query)
+				conn.Write(binary.BigEndian.AppendUint16(nil, uint16(len(resp))))
+				conn.Write(resp)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestDoHResolver(t *testing.T) {
+	dohSrv := newTestDoH(t)
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer target.Close()
+	u, _ := url.Parse(target.URL)
+
+	res := &DoHResolver{Endpoint: dohSrv.URL, Client: dohSrv.Client()}
+	ips, ttl, err := res.lookupTTL(t.Context(), "internal.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ips) != 1 || !ips[0].IP.Equal(net.IPv4(127, 0, 0, 1)) || ttl != 60*time.Second {
+		t.Errorf("解析结果为%v, TTL为%v", ips, ttl)
+	}
+	if _, err := res.LookupIPAddr(t.Context(), "missing.test"); err == nil {
+		t.Error("不存在的域名应返回错误")
+	}
+
+	c := New()
+	c.SetResolver(res)
+	if got := getBody(t, c, "http://internal.test:"+u.Port()); got != "ok" {
+		t.Errorf("响应为%q", got)
+	}
+}
+
+func TestDoTResolver(t *testing.T) {
+	dohSrv := newTestDoH(t)
+	addr := newTestDoT(t, dohSrv)
+	roots := dohSrv.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+
+	res := &DoTResolver{Addr: addr, TLSConfig: &tls.Config{RootCAs: roots}}
+	ips, err := res.LookupIPAddr(t.Context(), "internal.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ips) != 1 || !ips[0].IP.Equal(net.IPv4(127, 0, 0, 1)) {
+		t.Errorf("解析结果为%v", ips)
+	}
+
+	res.TLSConfig = nil
+	if _, err := res.LookupIPAddr(t.Context(), "internal.test"); err == nil {
+		t.Error("不受信任的证书应返回错误")
+	}
+}
+
+func TestGoProxy_SetDoH(t *testing.T) {
+	c := New()
+	for _, endpoint := range []string{"http://1.1.1.1/dns-query", "https:///dns-query", "::"} {
+		if err := c.SetDoH(endpoint); err == nil {
+			t.Errorf("%q应返回错误", endpoint)
+		}
+	}
+	if err := c.SetDoH("https://1.1.1.1/dns-query"); err != nil {
+		t.Fatal(err)
+	}
+	if res, ok := c.GetResolver().(*DoHResolver); !ok || res.Endpoint != "https://1.1.1.1/dns-query" {
+		t.Errorf("解析器为%#v", c.GetResolver())
+	}
+
+	if err := c.SetDoT("1.1.1.1"); err != nil {
+		t.Fatal(err)
+	}
+	if res, ok := c.GetResolver().(*DoTResolver); !ok || res.Addr != "1.1.1.1:853" {
+		t.Errorf("解析器为%#v", c.GetResolver())
+	}
+	if err := c.SetDoT(":853"); err == nil {
+		t.Error("缺少主机应返回错误")
+	}
+}
@@ -0,0 +1,531 @@
+package goproxy
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrChecksumMismatch 下载的文件与Download.Checksum不一致，不完整的文件已被删除
+var ErrChecksumMismatch = errors.New("文件校验和不一致")
+
+// errRestartDownload 已下载的部分与服务器上的文件不一致，清空后重新下载
+var errRestartDownload = errors.New("已下载的部分与服务器上的文件不一致")
+
+// downloadPartSuffix 下载中的文件的后缀，完成并校验后重命名为目标路径，再次下载时从该文件的末尾继续
+const downloadPartSuffix = ".part"
+
+// Download 一个下载任务
+type Download struct {
+	URL      string      // 下载地址
+	Path     string      // 保存的路径，下载过程中写入Path+".part"，完成并校验后重命名为Path
+	Proxy    string      // 本任务使用的代理，格式同SetProxy，为空时由WithDownloadProxy选择或使用客户端的代理
+	Checksum string      // 校验和，格式为"算法:十六进制值"，算法为md5、sha1、sha256或sha512，为空时不校验
+	Header   http.Header // 本任务额外的请求头
+}
+
+// DownloadProgress 下载管理器的整体进度
+type DownloadProgress struct {
+	Queued    int   // 等待中的任务数
+	Active    int   // 下载中的任务数
+	Completed int   // 已完成的任务数
+	Failed    int   // 失败的任务数
+	Written   int64 // 所有任务已下载的字节数，包括从此前的下载继续时已有的部分
+	Total     int64 // 所有已知大小的任务的总字节数
+}
+
+// DownloadOption DownloadManager的选项
+type DownloadOption func(*DownloadManager)
+
+// WithDownloadWorkers 设置同时下载的任务数，默认为4
+func WithDownloadWorkers(n int) DownloadOption {
+	return func(m *DownloadManager) {
+		if n > 0 {
+			m.workers = n
+		}
+	}
+}
+
+// WithDownloadRetry 设置下载失败后的重试策略，重试时从已下载的位置继续，默认重试3次
+func WithDownloadRetry(p RetryPolicy) DownloadOption {
+	return func(m *DownloadManager) {
+		m.retry = p
+	}
+}
+
+// WithDownloadProxy 设置为Proxy为空的任务选择代理的函数，返回空字符串时使用客户端的代理，
+// 可用于将任务分散到多个代理
+func WithDownloadProxy(fn func(d Download) string) DownloadOption {
+	return func(m *DownloadManager) {
+		m.selectProxy = fn
+	}
+}
+
+// WithDownloadProgress 设置整体进度的回调，任务状态变化和每次写入数据后调用，回调应尽快返回
+func WithDownloadProgress(fn func(p DownloadProgress)) DownloadOption {
+	return func(m *DownloadManager) {
+		m.onProgress = fn
+	}
+}
+
+// DownloadManager 下载管理器: 任务排队后由固定数量的工作协程下载，支持按任务选择代理、
+// 失败重试、断点续传、校验和验证和整体进度统计
+//
+//	m := goproxy.NewDownloadManager(c, goproxy.WithDownloadWorkers(8))
+//	for _, u := range urls {
+//		m.Add(ctx, goproxy.Download{URL: u, Path: filepath.Join(dir, path.Base(u))})
+//	}
+//	err := m.Wait()
+type DownloadManager struct {
+	client      *GoProxy
+	workers     int
+	retry       RetryPolicy
+	selectProxy func(d Download) string
+	onProgress  func(p DownloadProgress)
+
+	mu       sync.Mutex
+	queue    []*DownloadTask
+	tasks    []*DownloadTask
+	running  int                 // 运行中的工作协程数
+	proxies  map[string]*GoProxy // 按代理地址缓存的客户端
+	progress DownloadProgress
+	pending  sync.WaitGroup
+}
+
+// NewDownloadManager 创建下载管理器
+// 参数:
+//   - c: 发送请求的客户端，使用其请求头、TLS等配置
+//   - opts: 选项
+func NewDownloadManager(c *GoProxy, opts ...DownloadOption) *DownloadManager {
+	m := &DownloadManager{
+		client:  c,
+		workers: 4,
+		retry:   RetryPolicy{Attempts: 3},
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// DownloadTask 已加入下载管理器的任务
+type DownloadTask struct {
+	Download
+	ctx     context.Context
+	done    chan struct{}
+	err     error
+	written atomic.Int64
+	total   atomic.Int64
+	// validator 首次响应的强ETag或Last-Modified，继续下载时作为If-Range发送，只由下载该任务的工作协程访问
+	validator string
+}
+
+// Done 返回任务结束(成功或失败)时关闭的通道
+func (t *DownloadTask) Done() <-chan struct{} {
+	return t.done
+}
+
+// Wait 等待任务结束并返回其错误
+func (t *DownloadTask) Wait() error {
+	<-t.done
+	return t.err
+}
+
+// Err 返回任务的错误，任务未结束或成功时返回nil
+func (t *DownloadTask) Err() error {
+	select {
+	case <-t.done:
+		return t.err
+	default:
+		return nil
+	}
+}
+
+// Progress 返回任务已下载的字节数和总字节数，总字节数未知时为-1
+func (t *DownloadTask) Progress() (written, total int64) {
+	return t.written.Load(), t.total.Load()
+}
+
+// Add 将任务加入队列，有空闲的工作协程时立即开始下载
+// 参数:
+//   - ctx: 任务的上下文，结束时取消尚未完成的下载
+//   - d: 下载任务
+func (m *DownloadManager) Add(ctx context.Context, d Download) *DownloadTask {
+	t := &DownloadTask{Download: d, ctx: ctx, done: make(chan struct{})}
+	t.total.Store(-1)
+	m.pending.Add(1)
+	m.mu.Lock()
+	m.tasks = append(m.tasks, t)
+	m.queue = append(m.queue, t)
+	m.progress.Queued++
+	if m.running < m.workers {
+		m.running++
+		go m.work()
+	}
+	p := m.progress
+	m.mu.Unlock()
+	m.notify(p)
+	return t
+}
+
+// Wait 等待已加入的所有任务结束，返回各失败任务的错误
+func (m *DownloadManager) Wait() error {
+	m.pending.Wait()
+	m.mu.Lock()
+	tasks := m.tasks
+	m.mu.Unlock()
+	var errs []error
+	for _, t := range tasks {
+		if err := t.Err(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Tasks 返回已加入的所有任务
+func (m *DownloadManager) Tasks() []*DownloadTask {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]*DownloadTask(nil), m.tasks...)
+}
+
+// Progress 返回整体进度
+func (m *DownloadManager) Progress() DownloadProgress {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.progress
+}
+
+// work 工作协程，逐个取出队列中的任务下载，队列为空时退出
+func (m *DownloadManager) work() {
+	for {
+		m.mu.Lock()
+		if len(m.queue) == 0 {
+			m.running--
+			m.mu.Unlock()
+			return
+		}
+		t := m.queue[0]
+		m.queue[0] = nil
+		m.queue = m.queue[1:]
+		m.progress.Queued--
+		m.progress.Active++
+		p := m.progress
+		m.mu.Unlock()
+		m.notify(p)
+
+		t.err = m.run(t)
+		if t.err != nil {
+			t.err = fmt.Errorf("下载%s失败: %w", t.URL, t.err)
+		}
+		m.mu.Lock()
+		m.progress.Active--
+		if t.err != nil {
+			m.progress.Failed++
+		} else {
+			m.progress.Completed++
+		}
+		p = m.progress
+		m.mu.Unlock()
+		close(t.done)
+		m.pending.Done()
+		m.notify(p)
+	}
+}
+
+// notify 调用进度回调
+func (m *DownloadManager) notify(p DownloadProgress) {
+	if m.onProgress != nil {
+		m.onProgress(p)
+	}
+}
+
+// addBytes 累加整体进度的字节数
+func (m *DownloadManager) addBytes(written, total int64) {
+	m.mu.Lock()
+	m.progress.Written += written
+	m.progress.Total += total
+	p := m.progress
+	m.mu.Unlock()
+	if written != 0 || total != 0 {
+		m.notify(p)
+	}
+}
+
+// Close 关闭为各代理创建的客户端副本及其连接，不关闭传入NewDownloadManager的客户端，应在Wait返回后调用。
+// 此后再加入的指定了代理的任务会重新创建客户端副本
+func (m *DownloadManager) Close() error {
+	m.mu.Lock()
+	proxies := m.proxies
+	m.proxies = nil
+	m.mu.Unlock()
+	var errs []error
+	for _, c := range proxies {
+		errs = append(errs, c.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// clientFor 返回任务使用的客户端，指定了代理时使用按代理地址缓存的客户端副本
+func (m *DownloadManager) clientFor(d Download) (*GoProxy, error) {
+	proxy := d.Proxy
+	if proxy == "" && m.selectProxy != nil {
+		proxy = m.selectProxy(d)
+	}
+	if proxy == "" {
+		return m.client, nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if c, ok := m.proxies[proxy]; ok {
+		return c, nil
+	}
+	c := m.client.Clone()
+	if err := c.SetProxy(proxy); err != nil {
+		return nil, err
+	}
+	if m.proxies == nil {
+		m.proxies = make(map[string]*GoProxy)
+	}
+	m.proxies[proxy] = c
+	return c, nil
+}
+
+// run 下载一个任务，失败时按重试策略从已下载的位置继续
+func (m *DownloadManager) run(t *DownloadTask) (err error) {
+	newHash, want, err := parseChecksum(t.Checksum)
+	if err != nil {
+		return err
+	}
+	c, err := m.clientFor(t.Download)
+	if err != nil {
+		return err
+	}
+	// 任务失败时从整体进度中去掉本任务已计入的字节数
+	var counted, countedTotal int64
+	defer func() {
+		if err != nil {
+			m.addBytes(-counted, -countedTotal)
+		}
+	}()
+	report := func(written, total int64) {
+		m.addBytes(written-counted, total-countedTotal)
+		counted, countedTotal = written, total
+	}
+	for attempt := 0; ; attempt++ {
+		var resp *http.Response
+		resp, err = m.fetch(c, t, report)
+		if err == nil {
+			break
+		}
+		if t.ctx.Err() != nil || attempt >= m.retry.Attempts || !downloadRetryable(resp, err) {
+			return err
+		}
+		wait := m.retry.backoff(attempt)
+		if resp != nil {
+			wait = retryAfter(resp, wait, m.retry.maxBackoff())
+		}
+		if err := sleepContext(t.ctx, wait); err != nil {
+			return err
+		}
+	}
+	part := t.Path + downloadPartSuffix
+	if newHash != nil {
+		if err := verifyChecksum(part, newHash(), want); err != nil {
+			os.Remove(part)
+			return err
+		}
+	}
+	return os.Rename(part, t.Path)
+}
+
+// fetch 发送一次下载请求并写入.part文件，已有.part文件时通过Range请求继续下载，
+// 已知首次响应的ETag或Last-Modified时同时发送If-Range，服务器上的文件已改变时返回200，清空.part文件后从头下载。
+// 状态码错误时同时返回响应(响应体已关闭)以便判断是否重试
+func (m *DownloadManager) fetch(c *GoProxy, t *DownloadTask, report func(written, total int64)) (*http.Response, error) {
+	part := t.Path + downloadPartSuffix
+	f, err := os.OpenFile(part, os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(t.ctx, http.MethodGet, t.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range t.Header {
+		req.Header[k] = v
+	}
+	if offset > 0 {
+		req.Header.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-")
+		if t.validator != "" {
+			req.Header.Set("If-Range", t.validator)
+		}
+	}
+	// 状态码由下载管理器自己检查
+	resp, err := c.doStream(WithOptions(req, WithExpectedStatus()))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0 && contentRangeStart(resp) == offset:
+	case offset > 0 && (resp.StatusCode == http.StatusPartialContent || resp.StatusCode == http.StatusRequestedRangeNotSatisfiable):
+		// 返回的范围与已有的部分对不上，清空后重试
+		if err := f.Truncate(0); err != nil {
+			return nil, err
+		}
+		report(0, 0)
+		return nil, errRestartDownload
+	case resp.StatusCode/100 == 2:
+		// 服务器不支持Range请求或文件已改变(If-Range不匹配)，从头下载
+		if err := f.Truncate(0); err != nil {
+			return nil, err
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		offset = 0
+	default:
+		se, _ := newStatusError(req, resp, statusErrorBodyLimit)
+		return resp, se
+	}
+
+	if v := rangeValidator(resp); v != "" || offset == 0 {
+		t.validator = v
+	}
+
+	total := int64(-1)
+	if resp.ContentLength >= 0 {
+		total = offset + resp.ContentLength
+	}
+	t.total.Store(total)
+	t.written.Store(offset)
+	report(offset, max(total, 0))
+	w := &progressWriter{w: f, fn: func(n int64) {
+		report(t.written.Add(n), max(total, 0))
+	}}
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return nil, err
+	}
+	if total >= 0 && t.written.Load() != total {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return nil, f.Close()
+}
+
+// downloadRetryable 判断一次下载失败后是否值得重试
+func downloadRetryable(resp *http.Response, err error) bool {
+	if errors.Is(err, errRestartDownload) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	if resp != nil {
+		return ClassifyRetry(resp, nil) != RetryNever
+	}
+	return ClassifyRetry(nil, err) != RetryNever
+}
+
+// progressWriter 每次写入后回调写入的字节数
+type progressWriter struct {
+	w  io.Writer
+	fn func(n int64)
+}
+
+func (w *progressWriter) Write(b []byte) (int, error) {
+	n, err := w.w.Write(b)
+	if n > 0 {
+		w.fn(int64(n))
+	}
+	return n, err
+}
+
+// rangeValidator 返回可以作为If-Range发送的强ETag，没有时返回Last-Modified，
+// 弱ETag不能用于If-Range(RFC 9110 13.1.5)
+func rangeValidator(resp *http.Response) string {
+	if etag := resp.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return resp.Header.Get("Last-Modified")
+}
+
+// contentRangeStart 返回206响应Content-Range的起始位置，无法解析时返回-1
+func contentRangeStart(resp *http.Response) int64 {
+	v, ok := strings.CutPrefix(resp.Header.Get("Content-Range"), "bytes ")
+	if !ok {
+		return -1
+	}
+	start, _, ok := strings.Cut(v, "-")
+	if !ok {
+		return -1
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(start), 10, 64)
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+// parseChecksum 解析"算法:十六进制值"格式的校验和，为空时返回nil
+func parseChecksum(s string) (func() hash.Hash, []byte, error) {
+	if s == "" {
+		return nil, nil, nil
+	}
+	algo, value, ok := strings.Cut(s, ":")
+	if !ok {
+		return nil, nil, fmt.Errorf("无效的校验和%q，格式应为\"算法:十六进制值\"", s)
+	}
+	var newHash func() hash.Hash
+	switch strings.ToLower(algo) {
+	case "md5":
+		newHash = md5.New
+	case "sha1":
+		newHash = sha1.New
+	case "sha256":
+		newHash = sha256.New
+	case "sha512":
+		newHash = sha512.New
+	default:
+		return nil, nil, fmt.Errorf("不支持的校验和算法%q", algo)
+	}
+	want, err := hex.DecodeString(value)
+	if err != nil || len(want) != newHash().Size() {
+		return nil, nil, fmt.Errorf("无效的%s校验和%q", algo, value)
+	}
+	return newHash, want, nil
+}
+
+// verifyChecksum 计算文件的校验和并与want比较
+func verifyChecksum(path string, h hash.Hash, want []byte) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+	if got := h.Sum(nil); string(got) != string(want) {
+		return fmt.Errorf("%w: 期望%x，实际为%x", ErrChecksumMismatch, want, got)
+	}
+	return nil
+}
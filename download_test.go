@@ -0,0 +1,253 @@
+package goproxy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newRangeServer 返回支持Range请求的文件服务器，failFirst为true时每个文件的第一次请求返回503
+func newRangeServer(t *testing.T, files map[string]string, failFirst bool) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var requests atomic.Int32
+	var failed sync.Map
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		data, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if _, seen := failed.LoadOrStore(r.URL.Path, true); failFirst && !seen {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(data))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func TestDownloadManager(t *testing.T) {
+	files := map[string]string{}
+	for i := range 6 {
+		files[fmt.Sprintf("/f%d", i)] = strings.Repeat(strconv.Itoa(i), 1000+i)
+	}
+	srv, _ := newRangeServer(t, files, true)
+	dir := t.TempDir()
+
+	var maxActive atomic.Int32
+	var last atomic.Pointer[DownloadProgress]
+	m := NewDownloadManager(New(),
+		WithDownloadWorkers(2),
+		WithDownloadRetry(RetryPolicy{Attempts: 2, Backoff: time.Millisecond}),
+		WithDownloadProgress(func(p DownloadProgress) {
+			if int32(p.Active) > maxActive.Load() {
+				maxActive.Store(int32(p.Active))
+			}
+			last.Store(&p)
+		}))
+	var total int64
+	for name, data := range files {
+		sum := sha256.Sum256([]byte(data))
+		m.Add(context.Background(), Download{
+			URL:      srv.URL + name,
+			Path:     filepath.Join(dir, name[1:]),
+			Checksum: "sha256:" + hex.EncodeToString(sum[:]),
+		})
+		total += int64(len(data))
+	}
+	if err := m.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range files {
+		got, err := os.ReadFile(filepath.Join(dir, name[1:]))
+		if err != nil || string(got) != data {
+			t.Errorf("%s的内容不正确: %v", name, err)
+		}
+	}
+	if maxActive.Load() > 2 {
+		t.Errorf("同时下载了%d个任务", maxActive.Load())
+	}
+	p := m.Progress()
+	if p.Completed != len(files) || p.Failed != 0 || p.Active != 0 || p.Queued != 0 || p.Written != total || p.Total != total {
+		t.Errorf("整体进度为%+v", p)
+	}
+	if *last.Load() != p {
+		t.Errorf("最后一次回调的进度为%+v", *last.Load())
+	}
+	for _, task := range m.Tasks() {
+		if written, size := task.Progress(); written != size || size != int64(len(files["/"+filepath.Base(task.Path)])) {
+			t.Errorf("%s的进度为%d/%d", task.URL, written, size)
+		}
+	}
+}
+
+func TestDownloadManager_Resume(t *testing.T) {
+	data := strings.Repeat("0123456789", 100)
+	var ranges atomic.Value
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges.Store(r.Header.Get("Range"))
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(data))
+	}))
+	defer srv.Close()
+	path := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(path+downloadPartSuffix, []byte(data[:300]), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewDownloadManager(New())
+	if err := m.Add(context.Background(), Download{URL: srv.URL, Path: path}).Wait(); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := os.ReadFile(path)
+	if string(got) != data || ranges.Load() != "bytes=300-" {
+		t.Errorf("Range为%v，文件长度%d", ranges.Load(), len(got))
+	}
+	if _, err := os.Stat(path + downloadPartSuffix); !os.IsNotExist(err) {
+		t.Errorf(".part文件没有删除: %v", err)
+	}
+
+	// 已有的部分超过服务器上的文件时重新下载
+	os.WriteFile(path+downloadPartSuffix, []byte(data+"extra"), 0o644)
+	if err := m.Add(context.Background(), Download{URL: srv.URL, Path: path}).Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(path); string(got) != data {
+		t.Errorf("重新下载的文件长度为%d", len(got))
+	}
+}
+
+func TestDownloadManager_Errors(t *testing.T) {
+	srv, requests := newRangeServer(t, map[string]string{"/a": "hello"}, false)
+	dir := t.TempDir()
+	m := NewDownloadManager(New(), WithDownloadRetry(RetryPolicy{Attempts: 2, Backoff: time.Millisecond}))
+
+	bad := m.Add(context.Background(), Download{URL: srv.URL + "/a", Path: filepath.Join(dir, "a"), Checksum: "md5:00000000000000000000000000000000"})
+	if err := bad.Wait(); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("错误为%v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a"+downloadPartSuffix)); !os.IsNotExist(err) {
+		t.Errorf("校验失败的文件没有删除: %v", err)
+	}
+
+	requests.Store(0)
+	missing := m.Add(context.Background(), Download{URL: srv.URL + "/missing", Path: filepath.Join(dir, "b")})
+	var se *StatusError
+	if err := missing.Wait(); !errors.As(err, &se) || se.StatusCode != http.StatusNotFound || requests.Load() != 1 {
+		t.Errorf("错误为%v，请求了%d次", err, requests.Load())
+	}
+
+	invalid := m.Add(context.Background(), Download{URL: srv.URL + "/a", Path: filepath.Join(dir, "c"), Checksum: "crc32:1234"})
+	if invalid.Wait() == nil {
+		t.Error("不支持的校验和算法应返回错误")
+	}
+
+	err := m.Wait()
+	if err == nil || !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("Wait的错误为%v", err)
+	}
+	if p := m.Progress(); p.Failed != 3 || p.Written != 0 {
+		t.Errorf("整体进度为%+v", p)
+	}
+}
+
+func TestDownloadManager_Proxy(t *testing.T) {
+	var proxied atomic.Int32
+	proxySrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.IsAbs() {
+			proxied.Add(1)
+		}
+		fmt.Fprint(w, "via proxy")
+	}))
+	defer proxySrv.Close()
+	srv, _ := newRangeServer(t, map[string]string{"/direct": "direct", "/selected": "direct"}, false)
+	dir := t.TempDir()
+
+	m := NewDownloadManager(New(), WithDownloadProxy(func(d Download) string {
+		if strings.HasSuffix(d.URL, "/selected") {
+			return proxySrv.URL
+		}
+		return ""
+	}))
+	m.Add(context.Background(), Download{URL: srv.URL + "/direct", Path: filepath.Join(dir, "direct")})
+	m.Add(context.Background(), Download{URL: srv.URL + "/selected", Path: filepath.Join(dir, "selected")})
+	m.Add(context.Background(), Download{URL: srv.URL + "/direct", Path: filepath.Join(dir, "explicit"), Proxy: proxySrv.URL})
+	if err := m.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{"direct": "direct", "selected": "via proxy", "explicit": "via proxy"} {
+		if got, _ := os.ReadFile(filepath.Join(dir, name)); string(got) != want {
+			t.Errorf("%s的内容为%q", name, got)
+		}
+	}
+	if proxied.Load() != 2 {
+		t.Errorf("经过代理的请求为%d个", proxied.Load())
+	}
+
+	// Close关闭为代理创建的客户端副本，不影响原客户端
+	c, err := m.clientFor(Download{Proxy: proxySrv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetClient().Get(srv.URL + "/direct"); !errors.Is(err, ErrClosed) {
+		t.Errorf("Close后副本的请求错误为%v", err)
+	}
+	if _, err := m.client.GetClient().Get(srv.URL + "/direct"); err != nil {
+		t.Errorf("Close后原客户端的请求错误为%v", err)
+	}
+}
+
+func TestDownloadManager_IfRange(t *testing.T) {
+	v1, v2 := strings.Repeat("a", 1000), strings.Repeat("b", 1000)
+	var requests atomic.Int32
+	var ifRange atomic.Value
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			// 第一次请求只返回一半后断开
+			w.Header().Set("ETag", `"v1"`)
+			w.Header().Set("Content-Length", strconv.Itoa(len(v1)))
+			io.WriteString(w, v1[:500])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		// 此后文件已改变，If-Range不匹配时ServeContent返回完整的200响应
+		ifRange.Store(r.Header.Get("If-Range"))
+		w.Header().Set("ETag", `"v2"`)
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(v2))
+	}))
+	defer srv.Close()
+	path := filepath.Join(t.TempDir(), "file")
+
+	m := NewDownloadManager(New(), WithDownloadRetry(RetryPolicy{Attempts: 2, Backoff: time.Millisecond}))
+	task := m.Add(context.Background(), Download{URL: srv.URL, Path: path})
+	if err := task.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if ifRange.Load() != `"v1"` {
+		t.Errorf("继续下载时的If-Range为%v", ifRange.Load())
+	}
+	if got, _ := os.ReadFile(path); string(got) != v2 {
+		t.Errorf("文件改变后下载的内容不正确: %.20q...", got)
+	}
+	if written, total := task.Progress(); written != int64(len(v2)) || total != int64(len(v2)) {
+		t.Errorf("进度为%d/%d", written, total)
+	}
+}
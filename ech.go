@@ -0,0 +1,331 @@
+package goproxy
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// DefaultECHDNSServer 可用于SetECHDNSServer的明文DNS服务器
+//
+// Deprecated: 默认不再以明文DNS查询ECH配置，见DefaultECHDoHEndpoint
+const DefaultECHDNSServer = "1.1.1.1:53"
+
+// DefaultECHDoHEndpoint 没有设置DoH/DoT解析器时查询ECH配置使用的DoH地址，查询通过当前代理发送
+const DefaultECHDoHEndpoint = "https://1.1.1.1/dns-query"
+
+// echNegativeTTL 目标不支持ECH时的缓存时间
+const echNegativeTTL = 5 * time.Minute
+
+// echMinTTL 缓存ECH配置的最短时间
+const echMinTTL = time.Minute
+
+// typeHTTPS DNS HTTPS资源记录类型(RFC 9460)
+const typeHTTPS dnsmessage.Type = 65
+
+// svcParamECH SVCB记录中ech参数的键
+const svcParamECH = 5
+
+// echEntry 缓存的ECH配置，config为nil表示目标不支持ECH
+type echEntry struct {
+	config  []byte
+	expires time.Time
+}
+
+// echCache 按查询名缓存ECH配置
+type echCache struct {
+	mu    sync.Mutex
+	items map[string]echEntry
+}
+
+func (c *echCache) get(name string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.items[name]
+	if !ok || time.Now().After(e.expires) {
+		return nil, false
+	}
+	return e.config, true
+}
+
+func (c *echCache) set(name string, config []byte, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.items == nil {
+		c.items = make(map[string]echEntry)
+	}
+	c.items[name] = echEntry{config: config, expires: time.Now().Add(ttl)}
+}
+
+// clear 清空缓存的ECH配置
+func (c *echCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.items = nil
+}
+
+// EnableECH 开启或关闭加密ClientHello(ECH)
+// 开启后连接https目标前通过DNS HTTPS记录查询目标的ECH配置(查询方式见SetECHDNSServer)，目标支持时SNI将被加密，
+// 代理和链路上的观察者都无法看到真实的目标主机名；目标不支持时照常握手。
+// ECH要求TLS 1.3，握手时会自动将最低版本提升到TLS 1.3
+func (r *GoProxy) EnableECH(enable bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.echEnabled = enable
+	r.closeIdleConns()
+}
+
+// SetECHDNSServer 设置以明文DNS查询ECH配置的服务器(host:port)，为空时恢复默认。
+// 默认使用SetDoH/SetDoT设置的解析器查询，没有设置时通过当前代理以DoH向DefaultECHDoHEndpoint查询；
+// 注意明文DNS查询直接发往DNS服务器，不经过代理，链路上的观察者可以看到目标主机名
+func (r *GoProxy) SetECHDNSServer(addr string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.echDNSServer = addr
+}
+
+// echConfigFor 返回连接host:port时使用的ECH配置列表，未开启ECH或目标不支持时返回nil
+func (r *GoProxy) echConfigFor(ctx context.Context, host, port string) []byte {
+	r.mu.Lock()
+	enabled := r.echEnabled
+	r.mu.Unlock()
+	if !enabled || net.ParseIP(host) != nil {
+		return nil
+	}
+	name := host
+	if port != "" && port != "443" {
+		name = "_" + port + "._https." + host
+	}
+	if config, ok := r.ech.get(name); ok {
+		return config
+	}
+	config, ttl, err := lookupECHConfig(ctx, r.echExchange(), name)
+	if err != nil {
+		// 查询失败时不缓存，下次连接重新查询
+		return nil
+	}
+	if config == nil {
+		ttl = echNegativeTTL
+	} else if ttl < echMinTTL {
+		ttl = echMinTTL
+	}
+	r.ech.set(name, config, ttl)
+	return config
+}
+
+// dnsExchangeFunc 发送一次DNS查询的函数
+type dnsExchangeFunc func(ctx context.Context, name string, qtype dnsmessage.Type) (*dnsmessage.Message, error)
+
+// echExchange 返回查询ECH配置的函数: 设置了SetECHDNSServer时以明文DNS查询，否则使用DoH/DoT解析器，
+// 都没有时通过当前代理向DefaultECHDoHEndpoint发送DoH查询，以免目标主机名以明文泄露
+func (r *GoProxy) echExchange() dnsExchangeFunc {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if server := r.echDNSServer; server != "" {
+		return func(ctx context.Context, name string, qtype dnsmessage.Type) (*dnsmessage.Message, error) {
+			return dnsExchange(ctx, server, name, qtype)
+		}
+	}
+	switch res := r.resolver.(type) {
+	case *DoHResolver:
+		return res.exchange
+	case *DoTResolver:
+		return res.exchange
+	}
+	if r.echDoH == nil {
+		r.echDoH = &DoHResolver{
+			Endpoint: DefaultECHDoHEndpoint,
+			Client: &http.Client{
+				Transport: &http.Transport{DialContext: r.bootstrapDial, ForceAttemptHTTP2: true},
+				Timeout:   10 * time.Second,
+			},
+		}
+	}
+	return r.echDoH.exchange
+}
+
+// lookupECHConfig 通过DNS HTTPS记录查询name的ECH配置列表
+func lookupECHConfig(ctx context.Context, exchange dnsExchangeFunc, name string) ([]byte, time.Duration, error) {
+	msg, err := exchange(ctx, name, typeHTTPS)
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, ans := range msg.Answers {
+		if ans.Header.Type != typeHTTPS {
+			continue
+		}
+		res, ok := ans.Body.(*dnsmessage.UnknownResource)
+		if !ok {
+			continue
+		}
+		if config := parseSVCBECH(res.Data); config != nil {
+			return config, time.Duration(ans.Header.TTL) * time.Second, nil
+		}
+	}
+	return nil, 0, nil
+}
+
+// parseSVCBECH 从SVCB/HTTPS记录的RDATA中取出ech参数
+// RDATA格式: SvcPriority(2字节) TargetName(未压缩域名) 若干个SvcParam(键2字节、长度2字节、值)
+func parseSVCBECH(data []byte) []byte {
+	if len(data) < 3 {
+		return nil
+	}
+	// 优先级为0表示别名模式，不携带参数
+	if binary.BigEndian.Uint16(data) == 0 {
+		return nil
+	}
+	i := 2
+	for i < len(data) {
+		l := int(data[i])
+		i++
+		if l == 0 {
+			break
+		}
+		i += l
+	}
+	for i+4 <= len(data) {
+		key := binary.BigEndian.Uint16(data[i:])
+		l := int(binary.BigEndian.Uint16(data[i+2:]))
+		i += 4
+		if i+l > len(data) {
+			return nil
+		}
+		if key == svcParamECH {
+			return append([]byte(nil), data[i:i+l]...)
+		}
+		i += l
+	}
+	return nil
+}
+
+// dnsExchange 向DNS服务器发送查询，UDP响应被截断时改用TCP重试
+func dnsExchange(ctx context.Context, server, name string, qtype dnsmessage.Type) (*dnsmessage.Message, error) {
+	query, id, err := buildDNSQuery(name, qtype)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+	}
+	msg, err := dnsRoundTrip(ctx, "udp", server, query, id)
+	if err == nil && msg.Truncated {
+		msg, err = dnsRoundTrip(ctx, "tcp", server, query, id)
+	}
+	return msg, err
+}
+
+// buildDNSQuery 构造递归查询报文，附带EDNS0以允许较大的UDP响应
+func buildDNSQuery(name string, qtype dnsmessage.Type) ([]byte, uint16, error) {
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+	qname, err := dnsmessage.NewName(name)
+	if err != nil {
+		return nil, 0, fmt.Errorf("无效的域名: %w", err)
+	}
+	id := uint16(time.Now().UnixNano())
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id, RecursionDesired: true})
+	b.EnableCompression()
+	if err := b.StartQuestions(); err != nil {
+		return nil, 0, err
+	}
+	if err := b.Question(dnsmessage.Question{Name: qname, Type: qtype, Class: dnsmessage.ClassINET}); err != nil {
+		return nil, 0, err
+	}
+	if err := b.StartAdditionals(); err != nil {
+		return nil, 0, err
+	}
+	var opt dnsmessage.ResourceHeader
+	if err := opt.SetEDNS0(1232, dnsmessage.RCodeSuccess, false); err != nil {
+		return nil, 0, err
+	}
+	if err := b.OPTResource(opt, dnsmessage.OPTResource{}); err != nil {
+		return nil, 0, err
+	}
+	query, err := b.Finish()
+	return query, id, err
+}
+
+// dnsRoundTrip 通过UDP或TCP完成一次DNS查询
+func dnsRoundTrip(ctx context.Context, network, server string, query []byte, id uint16) (*dnsmessage.Message, error) {
+	conn, err := (&net.Dialer{}).DialContext(ctx, network, server)
+	if err != nil {
+		return nil, fmt.Errorf("连接DNS服务器失败: %w", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	return dnsConnExchange(conn, network == "tcp", query, id)
+}
+
+// dnsConnExchange 在已建立的连接上完成一次DNS查询，stream为true时使用TCP/TLS的两字节长度前缀格式
+func dnsConnExchange(conn net.Conn, stream bool, query []byte, id uint16) (*dnsmessage.Message, error) {
+	var resp []byte
+	if stream {
+		buf := make([]byte, 2+len(query))
+		binary.BigEndian.PutUint16(buf, uint16(len(query)))
+		copy(buf[2:], query)
+		if _, err := conn.Write(buf); err != nil {
+			return nil, fmt.Errorf("发送DNS查询失败: %w", err)
+		}
+		var l [2]byte
+		if _, err := io.ReadFull(conn, l[:]); err != nil {
+			return nil, fmt.Errorf("读取DNS响应失败: %w", err)
+		}
+		resp = make([]byte, binary.BigEndian.Uint16(l[:]))
+		if _, err := io.ReadFull(conn, resp); err != nil {
+			return nil, fmt.Errorf("读取DNS响应失败: %w", err)
+		}
+	} else {
+		if _, err := conn.Write(query); err != nil {
+			return nil, fmt.Errorf("发送DNS查询失败: %w", err)
+		}
+		buf := make([]byte, 65535)
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, fmt.Errorf("读取DNS响应失败: %w", err)
+		}
+		resp = buf[:n]
+	}
+	return parseDNSResponse(resp, id)
+}
+
+// parseDNSResponse 解析DNS响应并校验ID和响应码
+func parseDNSResponse(resp []byte, id uint16) (*dnsmessage.Message, error) {
+	var msg dnsmessage.Message
+	if err := msg.Unpack(resp); err != nil {
+		return nil, fmt.Errorf("解析DNS响应失败: %w", err)
+	}
+	if msg.ID != id {
+		return nil, errors.New("DNS响应ID不匹配")
+	}
+	if msg.RCode != dnsmessage.RCodeSuccess && msg.RCode != dnsmessage.RCodeNameError {
+		return nil, fmt.Errorf("DNS查询失败: %s", msg.RCode)
+	}
+	return &msg, nil
+}
+
+// applyECH 将ECH配置写入TLS配置
+func applyECH(cfg *tls.Config, config []byte) {
+	cfg.EncryptedClientHelloConfigList = config
+	if cfg.MinVersion < tls.VersionTLS13 {
+		cfg.MinVersion = tls.VersionTLS13
+	}
+	if cfg.MaxVersion != 0 && cfg.MaxVersion < tls.VersionTLS13 {
+		cfg.MaxVersion = tls.VersionTLS13
+	}
+}
@@ -0,0 +1,214 @@
+package goproxy
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// newTestECHKey 生成ECH密钥，返回服务端密钥和客户端使用的ECHConfigList
+func newTestECHKey(t *testing.T) (tls.EncryptedClientHelloKey, []byte) {
+	t.Helper()
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub := key.PublicKey().Bytes()
+	publicName := "public.example"
+
+	var contents []byte
+	contents = append(contents, 1)                             // config_id
+	contents = binary.BigEndian.AppendUint16(contents, 0x0020) // KEM: DHKEM(X25519, HKDF-SHA256)
+	contents = binary.BigEndian.AppendUint16(contents, uint16(len(pub)))
+	contents = append(contents, pub...)
+	contents = binary.BigEndian.AppendUint16(contents, 4)      // cipher_suites长度
+	contents = binary.BigEndian.AppendUint16(contents, 0x0001) // KDF: HKDF-SHA256
+	contents = binary.BigEndian.AppendUint16(contents, 0x0001) // AEAD: AES-128-GCM
+	contents = append(contents, 0)                             // maximum_name_length
+	contents = append(contents, byte(len(publicName)))
+	contents = append(contents, publicName...)
+	contents = binary.BigEndian.AppendUint16(contents, 0) // extensions
+
+	var config []byte
+	config = binary.BigEndian.AppendUint16(config, 0xfe0d)
+	config = binary.BigEndian.AppendUint16(config, uint16(len(contents)))
+	config = append(config, contents...)
+
+	list := binary.BigEndian.AppendUint16(nil, uint16(len(config)))
+	list = append(list, config...)
+	return tls.EncryptedClientHelloKey{Config: config, PrivateKey: key.Bytes(), SendAsRetry: true}, list
+}
+
+// answerHTTPSQuery 对HTTPS记录查询返回指定的ECH配置，对A记录查询返回127.0.0.1
+func answerHTTPSQuery(query, echList []byte) []byte {
+	var req dnsmessage.Message
+	if err := req.Unpack(query); err != nil || len(req.Questions) == 0 {
+		return nil
+	}
+	// SvcPriority=1, TargetName=".", ech参数
+	rdata := binary.BigEndian.AppendUint16(nil, 1)
+	rdata = append(rdata, 0)
+	rdata = binary.BigEndian.AppendUint16(rdata, svcParamECH)
+	rdata = binary.BigEndian.AppendUint16(rdata, uint16(len(echList)))
+	rdata = append(rdata, echList...)
+
+	q := req.Questions[0]
+	resp := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: req.ID, Response: true, RecursionAvailable: true},
+		Questions: req.Questions,
+	}
+	switch q.Type {
+	case typeHTTPS:
+		resp.Answers = []dnsmessage.Resource{{
+			Header: dnsmessage.ResourceHeader{Name: q.Name, Type: typeHTTPS, Class: dnsmessage.ClassINET, TTL: 300},
+			Body:   &dnsmessage.UnknownResource{Type: typeHTTPS, Data: rdata},
+		}}
+	case dnsmessage.TypeA:
+		resp.Answers = []dnsmessage.Resource{{
+			Header: dnsmessage.ResourceHeader{Name: q.Name, Type: q.Type, Class: dnsmessage.ClassINET, TTL: 300},
+			Body:   &dnsmessage.AResource{A: [4]byte{127, 0, 0, 1}},
+		}}
+	}
+	out, _ := resp.Pack()
+	return out
+}
+
+// newTestHTTPSDNS 启动一个对所有HTTPS记录查询都返回指定ECH配置的UDP DNS服务器
+func newTestHTTPSDNS(t *testing.T, echList []byte) string {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if out := answerHTTPSQuery(buf[:n], echList); out != nil {
+				pc.WriteTo(out, addr)
+			}
+		}
+	}()
+	return pc.LocalAddr().String()
+}
+
+// newTestECHServer 启动接受ECH的TLS服务器，返回以localhost访问的地址
+func newTestECHServer(t *testing.T, echKey tls.EncryptedClientHelloKey) string {
+	t.Helper()
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.TLS = &tls.Config{EncryptedClientHelloKeys: []tls.EncryptedClientHelloKey{echKey}}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	_, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	return "https://localhost:" + port
+}
+
+func TestGoProxy_EnableECH(t *testing.T) {
+	echKey, echList := newTestECHKey(t)
+	dnsAddr := newTestHTTPSDNS(t, echList)
+
+	url := newTestECHServer(t, echKey)
+
+	c := New()
+	c.SetECHDNSServer(dnsAddr)
+	resp, err := c.GetClient().Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.TLS.ECHAccepted {
+		t.Fatal("未开启ECH时不应使用ECH")
+	}
+
+	c.EnableECH(true)
+	resp, err = c.GetClient().Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if !resp.TLS.ECHAccepted {
+		t.Error("开启ECH后握手应使用ECH")
+	}
+}
+
+func TestGoProxy_ECHOverDoH(t *testing.T) {
+	echKey, echList := newTestECHKey(t)
+	url := newTestECHServer(t, echKey)
+	var queries atomic.Int32
+	dohSrv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries.Add(1)
+		query, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/dns-message")
+		w.Write(answerHTTPSQuery(query, echList))
+	}))
+	defer dohSrv.Close()
+
+	// 设置了DoH解析器时ECH配置同样通过DoH查询
+	c := New()
+	c.SetResolver(&DoHResolver{Endpoint: dohSrv.URL, Client: dohSrv.Client()})
+	c.EnableECH(true)
+	resp, err := c.GetClient().Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if !resp.TLS.ECHAccepted || queries.Load() == 0 {
+		t.Errorf("ECHAccepted为%v，DoH查询%d次", resp.TLS.ECHAccepted, queries.Load())
+	}
+}
+
+func TestGoProxy_ECHDefaultViaProxy(t *testing.T) {
+	var mu sync.Mutex
+	var connects []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		connects = append(connects, r.Host)
+		mu.Unlock()
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer proxy.Close()
+
+	// 没有设置解析器和明文DNS服务器时，ECH配置通过代理以DoH查询
+	c := New()
+	if err := c.SetProxy(proxy.URL); err != nil {
+		t.Fatal(err)
+	}
+	c.EnableECH(true)
+	if config := c.echConfigFor(context.Background(), "example.com", "443"); config != nil {
+		t.Errorf("查询失败时不应返回ECH配置: %x", config)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(connects) == 0 || connects[0] != "1.1.1.1:443" {
+		t.Errorf("代理收到的CONNECT为%v", connects)
+	}
+}
+
+func TestParseSVCBECH(t *testing.T) {
+	if parseSVCBECH([]byte{0, 0, 0}) != nil {
+		t.Error("别名模式不应返回ECH配置")
+	}
+	rdata := []byte{0, 1, 3, 'f', 'o', 'o', 0, 0, 1, 0, 3, 'h', '2', '!'}
+	if parseSVCBECH(rdata) != nil {
+		t.Error("没有ech参数时应返回nil")
+	}
+	rdata = append(rdata, 0, svcParamECH, 0, 2, 0xaa, 0xbb)
+	if got := parseSVCBECH(rdata); len(got) != 2 || got[0] != 0xaa {
+		t.Errorf("ech参数解析错误: %x", got)
+	}
+}
@@ -0,0 +1,243 @@
+package goproxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// 请求失败的错误类别，返回的错误包装了原始错误，可通过errors.Is判断类别、通过errors.As取出原始错误
+var (
+	// ErrProxyUnreachable 无法连接代理服务器，包括连接被拒绝、代理地址解析失败和与HTTPS代理握手失败
+	ErrProxyUnreachable = errors.New("无法连接代理服务器")
+	// ErrProxyAuth 代理服务器认证失败，HTTP代理对CONNECT请求返回407或SOCKS5认证未通过
+	ErrProxyAuth = errors.New("代理认证失败")
+	// ErrDNS 目标域名解析失败
+	ErrDNS = errors.New("域名解析失败")
+	// ErrTLSHandshake 与目标服务器或HTTPS代理的TLS握手失败，包括证书校验失败
+	ErrTLSHandshake = errors.New("TLS握手失败")
+	// ErrTimeout 连接、握手、等待响应头或整个请求超时，类别为其他错误但由超时引起时同样匹配
+	ErrTimeout = errors.New("请求超时")
+	// ErrBodyTooLarge 响应体超过SetMaxBodySize设置的大小
+	ErrBodyTooLarge = errors.New("响应体过大")
+)
+
+// Phase 请求失败时所处的阶段
+type Phase string
+
+const (
+	PhaseResolve        Phase = "resolve"         // 解析域名
+	PhaseDial           Phase = "dial"            // 连接目标或代理服务器
+	PhaseProxyHandshake Phase = "proxy-handshake" // 与代理服务器握手、建立CONNECT或SOCKS5隧道
+	PhaseTLS            Phase = "tls"             // 与目标服务器TLS握手
+	PhaseRead           Phase = "read"            // 发送请求、等待和读取响应
+)
+
+// Error 带有类别和上下文的请求错误，可通过errors.As取出以区分"代理拒绝CONNECT"和"目标不可达"等情况
+type Error struct {
+	Kind  error  // 错误类别，为上面的ErrXxx之一，无法归类时为nil
+	Phase Phase  // 失败的阶段，未知时为空
+	Proxy string // 使用的代理(密码已脱敏)，直连时为direct，未知时为空
+	Err   error  // 原始错误
+}
+
+func (e *Error) Error() string {
+	msg := e.Err.Error()
+	if e.Kind != nil {
+		msg = e.Kind.Error() + ": " + msg
+	}
+	var ctx []string
+	if e.Phase != "" {
+		ctx = append(ctx, "阶段: "+string(e.Phase))
+	}
+	if e.Proxy != "" {
+		ctx = append(ctx, "代理: "+e.Proxy)
+	}
+	if len(ctx) > 0 {
+		msg += " (" + strings.Join(ctx, ", ") + ")"
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is 匹配错误类别，由超时引起的错误同时匹配ErrTimeout
+func (e *Error) Is(target error) bool {
+	return target != nil && target == e.Kind || target == ErrTimeout && e.Timeout()
+}
+
+// Timeout 与net.Error的同名方法相同，使url.Error.Timeout等判断保持有效
+func (e *Error) Timeout() bool {
+	return e.Kind == ErrTimeout || isTimeout(e.Err)
+}
+
+// newError 以kind包装err，err为nil、由调用方取消或已属于该类别时原样返回
+func newError(kind, err error) error {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, kind) {
+		return err
+	}
+	return &Error{Kind: kind, Err: err}
+}
+
+// classifyError 为没有类别的错误按原始错误的类型补充类别，无法归类时原样返回
+func classifyError(err error) error {
+	var e *Error
+	if err == nil || errors.As(err, &e) {
+		return err
+	}
+	if kind := errorKind(err); kind != nil {
+		return &Error{Kind: kind, Err: err}
+	}
+	return err
+}
+
+// annotateError 为刚产生的err补充失败阶段和代理: err中已有*Error时只填写其中为空的字段，否则按原始错误归类后包装。
+// 已填写的字段不再修改，同一错误返回给多个请求时不会被并发写入
+func annotateError(err error, phase Phase, proxy string) error {
+	if err == nil {
+		return nil
+	}
+	var e *Error
+	if !errors.As(err, &e) {
+		kind := errorKind(err)
+		return &Error{Kind: kind, Phase: phaseOf(kind, phase), Proxy: proxy, Err: err}
+	}
+	if e.Phase == "" {
+		e.Phase = phaseOf(e.Kind, phase)
+	}
+	if e.Proxy == "" {
+		e.Proxy = proxy
+	}
+	return err
+}
+
+// annotate 以当前代理补充err的上下文，见annotateError；连接经路由规则选择了上游时使用该上游
+func (r *GoProxy) annotate(ctx context.Context, err error, phase Phase) error {
+	if err == nil {
+		return nil
+	}
+	proxy, routed := ctx.Value(routedProxyKey{}).(string)
+	if !routed {
+		r.mu.Lock()
+		proxy = r.proxyUrl
+		r.mu.Unlock()
+	}
+	if proxy == "" {
+		proxy = directProxyKey
+	}
+	return annotateError(err, phase, redactProxy(proxy))
+}
+
+// errorKind 按原始错误的类型判断类别，无法归类时返回nil
+func errorKind(err error) error {
+	var dnsErr *net.DNSError
+	switch {
+	case isTimeout(err):
+		return ErrTimeout
+	case errors.As(err, &dnsErr):
+		return ErrDNS
+	}
+	return nil
+}
+
+// phaseOf 域名解析失败的阶段总是PhaseResolve，其他类别为phase
+func phaseOf(kind error, phase Phase) Phase {
+	if kind == ErrDNS {
+		return PhaseResolve
+	}
+	return phase
+}
+
+// isTimeout 判断err是否由超时引起
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, errResponseHeaderTimeout) {
+		return true
+	}
+	var te interface{ Timeout() bool }
+	return errors.As(err, &te) && te.Timeout()
+}
+
+// socksAuthErrors golang.org/x/net/proxy在SOCKS5认证失败时返回的错误信息，该包没有导出对应的错误变量
+var socksAuthErrors = []string{
+	"no acceptable authentication methods",
+	"invalid username/password",
+	"username/password authentication failed",
+	"unsupported authentication method",
+}
+
+// socksError 为通过SOCKS5代理连接失败的错误补充类别: 认证失败为ErrProxyAuth，已有类别(连接代理失败)的保持不变
+func socksError(err error) error {
+	if err == nil {
+		return nil
+	}
+	for _, msg := range socksAuthErrors {
+		if strings.Contains(err.Error(), msg) {
+			return newError(ErrProxyAuth, err)
+		}
+	}
+	return err
+}
+
+// SetMaxBodySize 设置响应体的大小上限，Content-Length超过上限时请求直接返回ErrBodyTooLarge，
+// 未声明长度的响应体在读取超过上限时返回ErrBodyTooLarge
+// 参数:
+//   - n: 大小上限(字节)，小于等于0时不限制
+func (r *GoProxy) SetMaxBodySize(n int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.transport.maxBodySize.Store(max(n, 0))
+}
+
+// limitBody 按SetMaxBodySize限制响应体，Content-Length已超过上限时关闭响应体并返回错误
+func (c *CustomTransport) limitBody(req *http.Request, resp *http.Response) error {
+	n := c.maxBodySize.Load()
+	if n <= 0 || req.Method == http.MethodHead {
+		return nil
+	}
+	if resp.ContentLength > n {
+		resp.Body.Close()
+		return &Error{Kind: ErrBodyTooLarge, Phase: PhaseRead, Err: fmt.Errorf("Content-Length为%d字节，上限为%d字节", resp.ContentLength, n)}
+	}
+	resp.Body = &limitedBody{rc: resp.Body, remaining: n, limit: n}
+	return nil
+}
+
+// limitedBody 读取超过limit字节时返回ErrBodyTooLarge的响应体
+type limitedBody struct {
+	rc        io.ReadCloser
+	remaining int64
+	limit     int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining < 0 {
+		return 0, b.err()
+	}
+	// 多读一个字节以判断是否超过上限
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+	n, err := b.rc.Read(p)
+	if int64(n) > b.remaining {
+		n = int(b.remaining)
+		b.remaining = -1
+		return n, b.err()
+	}
+	b.remaining -= int64(n)
+	return n, err
+}
+
+// err 返回超过上限的错误
+func (b *limitedBody) err() error {
+	return &Error{Kind: ErrBodyTooLarge, Phase: PhaseRead, Err: fmt.Errorf("超过%d字节", b.limit)}
+}
+
+func (b *limitedBody) Close() error {
+	return b.rc.Close()
+}
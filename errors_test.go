@@ -0,0 +1,160 @@
+package goproxy
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestErrorKinds(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(300 * time.Millisecond)
+		}
+		io.WriteString(w, "ok")
+	}))
+	defer srv.Close()
+	// 拒绝所有CONNECT请求，要求代理认证
+	authProxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusProxyAuthRequired)
+	}))
+	defer authProxy.Close()
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	closedAddr := ln.Addr().String()
+	ln.Close()
+
+	tests := []struct {
+		name  string
+		setup func(c *GoProxy)
+		url   string
+		want  error
+	}{
+		{"代理无法连接", func(c *GoProxy) { c.SetProxy("http://" + closedAddr) }, "https://example.com", ErrProxyUnreachable},
+		{"SOCKS5代理无法连接", func(c *GoProxy) { c.SetProxy("socks5://" + closedAddr) }, "http://example.com", ErrProxyUnreachable},
+		{"代理认证", func(c *GoProxy) { c.SetProxy(authProxy.URL) }, "https://example.com", ErrProxyAuth},
+		{"域名解析", func(c *GoProxy) {}, "http://goproxy-test.invalid", ErrDNS},
+		{"TLS握手", func(c *GoProxy) {}, strings.Replace(srv.URL, "http://", "https://", 1), ErrTLSHandshake},
+		{"等待响应头超时", func(c *GoProxy) { c.SetResponseHeaderTimeout(50 * time.Millisecond) }, srv.URL + "/slow", ErrTimeout},
+		{"整体超时", func(c *GoProxy) { c.SetTimeout(50 * time.Millisecond) }, srv.URL + "/slow", ErrTimeout},
+	}
+	for _, tt := range tests {
+		c := New()
+		tt.setup(c)
+		req, _ := http.NewRequest(http.MethodGet, tt.url, nil)
+		resp, err := c.Do(req)
+		if err == nil {
+			resp.Body.Close()
+			t.Errorf("%s: 请求成功", tt.name)
+			continue
+		}
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: 错误为%v", tt.name, err)
+		}
+		var urlErr *url.Error
+		if !errors.As(err, &urlErr) {
+			t.Errorf("%s: 错误不是*url.Error: %T", tt.name, err)
+		}
+	}
+}
+
+func TestError_Timeout(t *testing.T) {
+	err := newError(ErrProxyUnreachable, &net.OpError{Op: "dial", Err: timeoutErr{}})
+	if !errors.Is(err, ErrProxyUnreachable) || !errors.Is(err, ErrTimeout) || errors.Is(err, ErrDNS) {
+		t.Errorf("连接代理超时的错误分类错误: %v", err)
+	}
+	var opErr *net.OpError
+	if !errors.As(err, &opErr) {
+		t.Error("无法取出原始错误")
+	}
+	if te, ok := err.(interface{ Timeout() bool }); !ok || !te.Timeout() {
+		t.Error("Timeout()应为true")
+	}
+	if socksError(nil) != nil {
+		t.Error("SOCKS5连接成功时不应返回错误")
+	}
+}
+
+type timeoutErr struct{}
+
+func (timeoutErr) Error() string { return "i/o timeout" }
+func (timeoutErr) Timeout() bool { return true }
+
+func TestGoProxy_SetMaxBodySize(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/chunked" {
+			w.(http.Flusher).Flush()
+		}
+		io.WriteString(w, strings.Repeat("a", 100))
+	}))
+	defer srv.Close()
+	c := New()
+	c.SetMaxBodySize(50)
+	if _, err := c.GetClient().Get(srv.URL); !errors.Is(err, ErrBodyTooLarge) {
+		t.Errorf("Content-Length超过上限时错误为%v", err)
+	}
+	resp, err := c.GetClient().Get(srv.URL + "/chunked")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !errors.Is(err, ErrBodyTooLarge) || len(body) != 50 {
+		t.Errorf("读取了%d字节，错误为%v", len(body), err)
+	}
+
+	c.SetMaxBodySize(100)
+	if got := getBody(t, c, srv.URL+"/chunked"); len(got) != 100 {
+		t.Errorf("未超过上限时读取了%d字节", len(got))
+	}
+}
+
+func TestError_Context(t *testing.T) {
+	authProxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusProxyAuthRequired)
+	}))
+	defer authProxy.Close()
+	// 返回响应头后断开连接
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		conn.Close()
+	}))
+	defer broken.Close()
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	closedAddr := ln.Addr().String()
+	ln.Close()
+
+	tests := []struct {
+		name  string
+		proxy string
+		url   string
+		phase Phase
+		want  string
+	}{
+		{"代理拒绝连接", "http://user:secret@" + closedAddr, "https://example.com", PhaseDial, "http://user:xxxxx@" + closedAddr},
+		{"代理拒绝CONNECT", authProxy.URL, "https://example.com", PhaseProxyHandshake, authProxy.URL},
+		{"域名解析", "", "http://goproxy-test.invalid", PhaseResolve, "direct"},
+		{"读取响应", "", broken.URL, PhaseRead, "direct"},
+	}
+	for _, tt := range tests {
+		c := New()
+		c.SetProxy(tt.proxy)
+		_, err := c.GetClient().Get(tt.url)
+		var e *Error
+		if !errors.As(err, &e) {
+			t.Errorf("%s: 错误为%v", tt.name, err)
+			continue
+		}
+		if e.Phase != tt.phase || e.Proxy != tt.want {
+			t.Errorf("%s: 阶段为%q，代理为%q", tt.name, e.Phase, e.Proxy)
+		}
+		if strings.Contains(err.Error(), "secret") {
+			t.Errorf("%s: 错误信息中包含密码: %v", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package goproxy
+
+import (
+	"time"
+)
+
+// DefaultExpectContinueTimeout 开启自动Expect: 100-continue且未设置等待时间时使用的等待时间
+const DefaultExpectContinueTimeout = time.Second
+
+// SetExpectContinueTimeout 设置发送带有"Expect: 100-continue"请求头的请求后，等待服务器100响应的最长时间，
+// 超时后照常发送请求体；为0时不等待，立即发送请求体
+func (r *GoProxy) SetExpectContinueTimeout(timeout time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.transport.Transport.ExpectContinueTimeout = timeout
+}
+
+// SetAutoExpectContinue 请求体长度已知且不小于threshold字节时自动添加"Expect: 100-continue"请求头，为0时关闭
+// 服务器或代理提前拒绝请求(如认证失败、请求体过大)时不会发送请求体，避免重复上传大量数据。
+// 未设置SetExpectContinueTimeout时使用DefaultExpectContinueTimeout。
+// 注意: 只对HTTP/1.1请求生效
+func (r *GoProxy) SetAutoExpectContinue(threshold int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ct := r.transport
+	ct.expectThreshold.Store(max(threshold, 0))
+	if threshold > 0 && ct.Transport.ExpectContinueTimeout == 0 {
+		ct.Transport.ExpectContinueTimeout = DefaultExpectContinueTimeout
+	}
+}
@@ -0,0 +1,62 @@
+package goproxy
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// countingReader 记录被读取的字节数
+type countingReader struct {
+	r io.Reader
+	n atomic.Int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+func TestGoProxy_SetAutoExpectContinue(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			// 未读取请求体即拒绝
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		io.Copy(io.Discard, r.Body)
+		w.Header().Set("X-Expect", r.Header.Get("Expect"))
+	}))
+	defer srv.Close()
+
+	c := New()
+	c.SetAutoExpectContinue(1024)
+	send := func(size int, auth bool) (*http.Response, int64) {
+		body := &countingReader{r: bytes.NewReader(make([]byte, size))}
+		req, _ := http.NewRequest(http.MethodPost, srv.URL, body)
+		req.ContentLength = int64(size)
+		if auth {
+			req.Header.Set("Authorization", "Bearer x")
+		}
+		resp, err := c.GetClient().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp, body.n.Load()
+	}
+
+	if resp, n := send(1<<20, false); resp.StatusCode != http.StatusUnauthorized || n != 0 {
+		t.Errorf("被拒绝的请求读取了%d字节请求体, 状态码%d", n, resp.StatusCode)
+	}
+	if resp, n := send(1<<20, true); resp.Header.Get("X-Expect") != "100-continue" || n != 1<<20 {
+		t.Errorf("Expect为%q, 读取%d字节", resp.Header.Get("X-Expect"), n)
+	}
+	if resp, _ := send(10, true); resp.Header.Get("X-Expect") != "" {
+		t.Error("小于阈值的请求不应添加Expect")
+	}
+}
@@ -0,0 +1,157 @@
+package goproxy
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// ErrUnexpectedStatus 响应的状态码不在SetExpectedStatus或WithExpectedStatus期望的范围内
+var ErrUnexpectedStatus = errors.New("响应状态码不符合预期")
+
+// statusErrorBodyLimit StatusError中保存的响应体的大小上限
+const statusErrorBodyLimit = 4 << 10
+
+// StatusError 状态码不符合预期的响应，保存了响应头和响应体的开头部分，响应体已经关闭。
+// errors.Is(err, ErrUnexpectedStatus)为true
+type StatusError struct {
+	StatusCode int         // 状态码
+	Status     string      // 状态行，如"404 Not Found"
+	Method     string      // 请求方法
+	URL        string      // 请求的URL
+	Header     http.Header // 响应头
+	Body       []byte      // 响应体的前4KB
+	Truncated  bool        // 响应体是否超过4KB而被截断
+	Err        error       // 按RegisterErrorType注册的类型解码响应体得到的错误，没有时为nil
+}
+
+func (e *StatusError) Error() string {
+	msg := fmt.Sprintf("%s: %s %s返回%s", ErrUnexpectedStatus, e.Method, e.URL, e.Status)
+	if e.Err != nil {
+		return msg + ": " + e.Err.Error()
+	}
+	if body := strings.TrimSpace(string(e.Body)); body != "" {
+		if len(body) > 200 {
+			body = body[:200] + "..."
+		}
+		msg += ": " + body
+	}
+	return msg
+}
+
+func (e *StatusError) Is(target error) bool {
+	return target == ErrUnexpectedStatus
+}
+
+func (e *StatusError) Unwrap() error {
+	return e.Err
+}
+
+// ResponseValidator 检查响应，返回错误时Do关闭响应体并返回该错误
+type ResponseValidator func(resp *http.Response) error
+
+// SetExpectedStatus 设置期望的状态码，通过Do和Call发送的请求返回其他状态码时关闭响应体并返回*StatusError，
+// 免去每次请求后检查resp.StatusCode。没有参数时不检查，单次请求可通过WithExpectedStatus覆盖
+// 参数:
+//   - codes: 期望的状态码，如200、201
+func (r *GoProxy) SetExpectedStatus(codes ...int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.expectedStatus = slices.Clone(codes)
+}
+
+// SetResponseValidator 设置检查响应的函数，在检查状态码之后调用，为nil时不检查，单次请求可通过WithResponseValidator覆盖
+func (r *GoProxy) SetResponseValidator(fn ResponseValidator) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.responseValidator = fn
+}
+
+// WithExpectedStatus 设置单次请求期望的状态码，覆盖SetExpectedStatus，没有参数时本次请求不检查状态码
+func WithExpectedStatus(codes ...int) RequestOption {
+	return func(o *requestOptions) {
+		o.expectedStatus = slices.Clone(codes)
+		o.expectedStatusSet = true
+	}
+}
+
+// WithResponseValidator 设置单次请求检查响应的函数，覆盖SetResponseValidator，为nil时本次请求不检查
+func WithResponseValidator(fn ResponseValidator) RequestOption {
+	return func(o *requestOptions) {
+		o.validator = fn
+		o.validatorSet = true
+	}
+}
+
+// checkResponse 按期望的状态码和检查函数检查Do得到的响应，不符合时关闭响应体并返回*url.Error
+func (r *GoProxy) checkResponse(req *http.Request, resp *http.Response) error {
+	host := req.URL.Hostname()
+	if resp.Request != nil {
+		// 跟随重定向后按最终的主机查找错误类型
+		host = resp.Request.URL.Hostname()
+	}
+	r.mu.Lock()
+	codes, validator := r.expectedStatus, r.responseValidator
+	errType, hasErrType := lookupHost(r.errorTypes, host)
+	r.mu.Unlock()
+	if o := optionsFromRequest(req); o != nil {
+		if o.expectedStatusSet {
+			codes = o.expectedStatus
+		}
+		if o.validatorSet {
+			validator = o.validator
+		}
+	}
+	decode := hasErrType && resp.StatusCode >= 400 && isJSONResponse(resp)
+	var err error
+	if len(codes) > 0 && !slices.Contains(codes, resp.StatusCode) || len(codes) == 0 && decode {
+		limit := int64(statusErrorBodyLimit)
+		if decode {
+			limit = errorBodyLimit
+		}
+		se, body := newStatusError(req, resp, limit)
+		if decode {
+			se.Err = decodeErrorBody(errType, body)
+		}
+		err = se
+	} else if validator != nil {
+		err = validator(resp)
+	}
+	if err == nil {
+		return nil
+	}
+	resp.Body.Close()
+	return &url.Error{Op: urlErrorOp(req.Method), URL: req.URL.Redacted(), Err: err}
+}
+
+// newStatusError 读取至多limit字节的响应体并创建StatusError，同时返回读取的响应体，超过limit时返回nil
+func newStatusError(req *http.Request, resp *http.Response, limit int64) (*StatusError, []byte) {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	e := &StatusError{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Method:     req.Method,
+		URL:        req.URL.Redacted(),
+		Header:     resp.Header,
+		Body:       body,
+	}
+	if len(body) > statusErrorBodyLimit {
+		e.Body, e.Truncated = body[:statusErrorBodyLimit], true
+	}
+	if int64(len(body)) > limit {
+		body = nil
+	}
+	return e, body
+}
+
+// urlErrorOp 与http.Client相同，url.Error.Op为首字母大写的请求方法
+func urlErrorOp(method string) string {
+	if method == "" {
+		return "Get"
+	}
+	return method[:1] + strings.ToLower(method[1:])
+}
@@ -0,0 +1,108 @@
+package goproxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestGoProxy_SetExpectedStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		code, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/"))
+		w.Header().Set("X-Code", r.URL.Path)
+		w.WriteHeader(code)
+		if code == http.StatusInternalServerError {
+			io.WriteString(w, strings.Repeat("x", statusErrorBodyLimit+10))
+			return
+		}
+		fmt.Fprintf(w, `{"error":"status %d"}`, code)
+	}))
+	defer srv.Close()
+	do := func(c *GoProxy, path string, opts ...RequestOption) (*http.Response, error) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+		resp, err := c.Do(req, opts...)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return resp, err
+	}
+
+	c := New()
+	if _, err := do(c, "/404"); err != nil {
+		t.Fatalf("没有设置期望时错误为%v", err)
+	}
+	c.SetExpectedStatus(http.StatusOK, http.StatusCreated)
+	if _, err := do(c, "/201"); err != nil {
+		t.Errorf("期望的状态码返回错误: %v", err)
+	}
+	resp, err := do(c, "/404")
+	var se *StatusError
+	var urlErr *url.Error
+	if resp != nil || !errors.Is(err, ErrUnexpectedStatus) || !errors.As(err, &se) || !errors.As(err, &urlErr) {
+		t.Fatalf("响应为%v，错误为%v", resp, err)
+	}
+	if se.StatusCode != 404 || string(se.Body) != `{"error":"status 404"}` || se.Header.Get("X-Code") != "/404" ||
+		se.Truncated || se.Method != "GET" || !strings.Contains(err.Error(), "404 Not Found") {
+		t.Errorf("错误为%+v", se)
+	}
+
+	_, err = do(c, "/500")
+	if !errors.As(err, &se) || len(se.Body) != statusErrorBodyLimit || !se.Truncated {
+		t.Errorf("响应体为%d字节，截断为%v", len(se.Body), se.Truncated)
+	}
+
+	// 单次请求覆盖客户端的设置
+	if _, err := do(c, "/404", WithExpectedStatus(http.StatusNotFound)); err != nil {
+		t.Errorf("单次请求期望404时错误为%v", err)
+	}
+	if _, err := do(c, "/500", WithExpectedStatus()); err != nil {
+		t.Errorf("单次请求不检查时错误为%v", err)
+	}
+}
+
+func TestGoProxy_SetResponseValidator(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", r.URL.Query().Get("type"))
+	}))
+	defer srv.Close()
+	errNotJSON := errors.New("not json")
+	c := New()
+	c.SetResponseValidator(func(resp *http.Response) error {
+		if resp.Header.Get("Content-Type") != "application/json" {
+			return errNotJSON
+		}
+		return nil
+	})
+	get := func(typ string, opts ...RequestOption) error {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"?type="+url.QueryEscape(typ), nil)
+		resp, err := c.Do(req, opts...)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+	if err := get("application/json"); err != nil {
+		t.Errorf("通过检查的响应返回错误: %v", err)
+	}
+	if err := get("text/html"); !errors.Is(err, errNotJSON) {
+		t.Errorf("错误为%v", err)
+	}
+	if err := get("text/html", WithResponseValidator(nil)); err != nil {
+		t.Errorf("单次请求不检查时错误为%v", err)
+	}
+
+	// 请求模板中的期望状态码
+	c.SetResponseValidator(nil)
+	c.RegisterTemplate("ok", RequestTemplate{URL: srv.URL, Expect: []int{http.StatusNoContent}})
+	if _, err := c.Call(context.Background(), "ok", nil); !errors.Is(err, ErrUnexpectedStatus) {
+		t.Errorf("模板期望的状态码不符时错误为%v", err)
+	}
+}
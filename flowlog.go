@@ -0,0 +1,195 @@
+package goproxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// FlowRecord 一条连接记录，在连接关闭或拨号失败时生成，用于分析客户端实际建立了哪些连接
+type FlowRecord struct {
+	Start      time.Time `json:"start"`            // 开始拨号的时间
+	Src        string    `json:"src,omitempty"`    // 本地地址
+	Dst        string    `json:"dst"`              // 目标地址(host:port)，HTTP代理转发http请求时为代理地址
+	Remote     string    `json:"remote,omitempty"` // 实际连接的对端地址，使用代理时为代理服务器
+	Proxy      string    `json:"proxy"`            // 使用的代理(密码已脱敏)，直连时为direct
+	SNI        string    `json:"sni,omitempty"`    // 在连接上进行TLS握手时的SNI
+	BytesSent  int64     `json:"bytes_sent"`       // 发送的字节数，包括TLS开销
+	BytesRecv  int64     `json:"bytes_recv"`       // 接收的字节数，包括TLS开销
+	DurationMs float64   `json:"duration_ms"`      // 从开始拨号到连接关闭的耗时(毫秒)
+	Error      string    `json:"error,omitempty"`  // 拨号失败的原因
+}
+
+// FlowExporter 接收连接记录，ExportFlow可能被并发调用，返回的错误被忽略
+type FlowExporter interface {
+	ExportFlow(rec FlowRecord) error
+}
+
+// FlowExporterFunc 以函数作为FlowExporter
+type FlowExporterFunc func(rec FlowRecord)
+
+// ExportFlow 实现FlowExporter接口
+func (f FlowExporterFunc) ExportFlow(rec FlowRecord) error {
+	f(rec)
+	return nil
+}
+
+// FileFlowExporter 将连接记录以JSONL格式追加写入文件
+type FileFlowExporter struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFileFlowExporter 以追加方式打开path，创建文件导出器
+func NewFileFlowExporter(path string) (*FileFlowExporter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("打开连接记录文件失败: %w", err)
+	}
+	return &FileFlowExporter{file: f}, nil
+}
+
+// ExportFlow 实现FlowExporter接口
+func (e *FileFlowExporter) ExportFlow(rec FlowRecord) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.file == nil {
+		return fmt.Errorf("连接记录文件已关闭")
+	}
+	_, err = e.file.Write(line)
+	return err
+}
+
+// Close 关闭文件，关闭后的记录被丢弃
+func (e *FileFlowExporter) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.file == nil {
+		return nil
+	}
+	err := e.file.Close()
+	e.file = nil
+	return err
+}
+
+// UDPFlowExporter 将每条连接记录以一个JSON数据报发送到收集端，不保证送达
+type UDPFlowExporter struct {
+	conn net.Conn
+}
+
+// NewUDPFlowExporter 创建UDP导出器
+// 参数:
+//   - addr: 收集端地址(host:port)
+func NewUDPFlowExporter(addr string) (*UDPFlowExporter, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("连接收集端失败: %w", err)
+	}
+	return &UDPFlowExporter{conn: conn}, nil
+}
+
+// ExportFlow 实现FlowExporter接口
+func (e *UDPFlowExporter) ExportFlow(rec FlowRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	_, err = e.conn.Write(data)
+	return err
+}
+
+// Close 关闭UDP连接
+func (e *UDPFlowExporter) Close() error {
+	return e.conn.Close()
+}
+
+// SetFlowExporter 设置连接记录的导出器，客户端建立的每个连接在关闭时导出一条记录，拨号失败时同样导出；
+// 为nil时不再记录。只影响之后建立的连接，导出器由调用方负责关闭
+func (r *GoProxy) SetFlowExporter(e FlowExporter) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.flowExporter = e
+}
+
+// exportFailedFlow 导出一次失败的拨号
+func exportFailedFlow(e FlowExporter, dst, proxy string, start time.Time, err error) {
+	e.ExportFlow(FlowRecord{
+		Start:      start,
+		Dst:        dst,
+		Proxy:      redactProxy(proxy),
+		DurationMs: float64(time.Since(start)) / float64(time.Millisecond),
+		Error:      err.Error(),
+	})
+}
+
+// flowConn 统计收发字节数并在关闭时导出连接记录的连接
+type flowConn struct {
+	net.Conn
+	exporter   FlowExporter
+	rec        FlowRecord
+	sent, recv atomic.Int64
+	sni        atomic.Pointer[string]
+	once       sync.Once
+}
+
+// newFlowConn 包装conn，e为nil时原样返回
+func newFlowConn(conn net.Conn, e FlowExporter, dst, proxy string, start time.Time) net.Conn {
+	if e == nil {
+		return conn
+	}
+	rec := FlowRecord{Start: start, Dst: dst, Proxy: redactProxy(proxy)}
+	if addr := conn.LocalAddr(); addr != nil {
+		rec.Src = addr.String()
+	}
+	if addr := conn.RemoteAddr(); addr != nil {
+		rec.Remote = addr.String()
+	}
+	return &flowConn{Conn: conn, exporter: e, rec: rec}
+}
+
+// setFlowSNI 记录在conn上进行TLS握手时的SNI，conn不是flowConn时忽略
+func setFlowSNI(conn net.Conn, sni string) {
+	if fc, ok := conn.(*flowConn); ok && sni != "" {
+		fc.sni.Store(&sni)
+	}
+}
+
+func (c *flowConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.recv.Add(int64(n))
+	return n, err
+}
+
+func (c *flowConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.sent.Add(int64(n))
+	return n, err
+}
+
+func (c *flowConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(func() {
+		rec := c.rec
+		rec.BytesSent, rec.BytesRecv = c.sent.Load(), c.recv.Load()
+		rec.DurationMs = float64(time.Since(rec.Start)) / float64(time.Millisecond)
+		if sni := c.sni.Load(); sni != nil {
+			rec.SNI = *sni
+		}
+		c.exporter.ExportFlow(rec)
+	})
+	return err
+}
+
+// NetConn 返回被包装的连接，使连接统计等可以沿NetConn找到内层的连接
+func (c *flowConn) NetConn() net.Conn {
+	return c.Conn
+}
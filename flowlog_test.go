@@ -0,0 +1,102 @@
+package goproxy
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGoProxy_SetFlowExporter(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+	var mu sync.Mutex
+	var flows []FlowRecord
+	c := New()
+	c.SetTLSVerify(false)
+	c.SetHostOverride("flow.test", "127.0.0.1")
+	c.SetFlowExporter(FlowExporterFunc(func(rec FlowRecord) {
+		mu.Lock()
+		flows = append(flows, rec)
+		mu.Unlock()
+	}))
+	_, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	if got := getBody(t, c, "https://flow.test:"+port); got != "ok" {
+		t.Fatalf("响应为%q", got)
+	}
+	c.GetTransport().CloseIdleConnections()
+
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	closedAddr := ln.Addr().String()
+	ln.Close()
+	c.GetClient().Get("http://" + closedAddr)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(flows) != 2 {
+		t.Fatalf("记录了%d个连接: %+v", len(flows), flows)
+	}
+	f := flows[0]
+	if f.Dst != "flow.test:"+port || f.Remote != srv.Listener.Addr().String() || f.SNI != "flow.test" ||
+		f.Proxy != "direct" || f.BytesSent == 0 || f.BytesRecv == 0 || f.Src == "" || f.Error != "" {
+		t.Errorf("连接记录为%+v", f)
+	}
+	if f = flows[1]; f.Dst != closedAddr || f.Error == "" {
+		t.Errorf("拨号失败的记录为%+v", f)
+	}
+}
+
+func TestFlowExporters(t *testing.T) {
+	rec := FlowRecord{Start: time.Now(), Dst: "example.com:443", Proxy: "direct", BytesSent: 10}
+
+	path := filepath.Join(t.TempDir(), "flows.jsonl")
+	fe, err := NewFileFlowExporter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fe.ExportFlow(rec)
+	fe.ExportFlow(rec)
+	fe.Close()
+	if err := fe.ExportFlow(rec); err == nil {
+		t.Error("关闭后导出应返回错误")
+	}
+	f, _ := os.Open(path)
+	defer f.Close()
+	lines := 0
+	for sc := bufio.NewScanner(f); sc.Scan(); lines++ {
+		var got FlowRecord
+		if err := json.Unmarshal(sc.Bytes(), &got); err != nil || got.Dst != rec.Dst {
+			t.Errorf("第%d行为%s", lines+1, sc.Text())
+		}
+	}
+	if lines != 2 {
+		t.Errorf("写入了%d行", lines)
+	}
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	ue, err := NewUDPFlowExporter(pc.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ue.Close()
+	ue.ExportFlow(rec)
+	buf := make([]byte, 2048)
+	pc.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil || !strings.Contains(string(buf[:n]), `"dst":"example.com:443"`) {
+		t.Errorf("收到%q, 错误为%v", buf[:n], err)
+	}
+}
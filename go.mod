@@ -2,4 +2,17 @@ module github.com/fasnow/goproxy
 
 go 1.24.1
 
-require golang.org/x/net v0.38.0
+require (
+	github.com/refraction-networking/utls v1.8.2
+	golang.org/x/net v0.38.0
+	golang.org/x/oauth2 v0.30.0
+	golang.org/x/text v0.23.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/andybalholm/brotli v1.0.6 // indirect
+	github.com/klauspost/compress v1.18.0 // indirect
+	golang.org/x/crypto v0.36.0 // indirect
+	golang.org/x/sys v0.31.0 // indirect
+)
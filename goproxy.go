@@ -4,11 +4,14 @@ package goproxy
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
 	"net/url"
+	"reflect"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/net/proxy"
@@ -27,35 +30,137 @@ var DefaultHTTPClient = &http.Client{
 
 // GoProxy 结构体定义了代理客户端的主要属性和方法
 type GoProxy struct {
-	client   *http.Client // HTTP客户端实例
-	proxyUrl string       // 代理服务器URL
-	mu       sync.Mutex   // 互斥锁，用于保护并发操作
+	client    *http.Client     // HTTP客户端实例
+	transport *CustomTransport // client使用的CustomTransport，配置都保存在这里，不依赖client.Transport的类型
+	proxyUrl  string           // 代理服务器URL
+	mu        sync.Mutex       // 互斥锁，用于保护并发操作
+
+	httpProxy   *url.URL          // HTTP/HTTPS代理地址
+	socksDialer proxy.Dialer      // SOCKS5代理拨号器
+	socksProxy  *url.URL          // SOCKS5代理地址
+	bandwidth   *bandwidthLimiter // 客户端级别的带宽限制
+	router      *Router           // 规则路由，为nil时所有连接使用上面的代理
+
+	flowExporter FlowExporter // 连接记录的导出器，为nil时不记录
+
+	hostTLS       map[string]*tls.Config     // 按主机配置的TLS配置
+	hostCerts     map[string]tls.Certificate // 按主机配置的客户端证书
+	sniOverrides  map[string]string          // 按主机配置的SNI
+	hostOverrides map[string]string          // 按主机配置的实际连接地址
+	fingerprint   TLSFingerprint             // TLS客户端指纹
+	echEnabled    bool                       // 是否启用ECH
+	echDNSServer  string                     // 以明文DNS查询ECH配置的服务器，为空时使用DoH
+	echDoH        *DoHResolver               // 未设置DoH/DoT解析器时查询ECH配置的解析器，首次使用时创建
+	ech           echCache                   // ECH配置缓存
+
+	onTLSState func(addr string, state tls.ConnectionState) // TLS握手完成后的回调
+
+	http2Enabled  bool             // 是否开启HTTP/2
+	http2Settings HTTP2Settings    // HTTP/2连接参数
+	utlsH2        *utlsH2Transport // 使用TLS指纹时的HTTP/2连接池
+	h2cHosts      map[string]bool  // 按主机配置的h2c
+	h2c           *h2cTransport    // h2c请求使用的Transport
+	proxyHTTP2    bool             // 是否通过HTTP/2与HTTPS代理建立隧道
+	proxyH2       proxyH2Pool      // 与HTTPS代理之间的HTTP/2连接池
+
+	masqueTemplate string               // CONNECT-UDP请求的URI模板
+	resolver       Resolver             // 域名解析器，为nil时使用系统默认解析
+	dnsCache       *dnsCache            // DNS缓存，为nil时不缓存
+	ipPolicy       IPPolicy             // IP地址族策略
+	localIP        net.IP               // 直接连接时绑定的源地址
+	iface          string               // 直接连接时绑定的网卡
+	fallbackDelay  time.Duration        // Happy Eyeballs启动下一次连接前的等待时间
+	dialFunc       DialFunc             // 自定义的底层拨号函数
+	keepAlive      *net.KeepAliveConfig // TCP keepalive参数
+	nagle          bool                 // 是否开启Nagle算法
+	ssrfGuard      *ssrfGuard           // SSRF防护规则，为nil时不检查
+
+	dialTimeout         time.Duration // 建立连接的超时时间
+	tlsHandshakeTimeout time.Duration // TLS握手的超时时间
+
+	maxRedirects   int            // 最多跟随的重定向次数
+	redirectPolicy RedirectPolicy // 跟随重定向时的附加规则
+
+	expectedStatus    []int                   // 期望的状态码，为空时不检查
+	responseValidator ResponseValidator       // 检查响应的函数
+	errorTypes        map[string]reflect.Type // 按主机注册的错误响应类型，修改时整体替换
+
+	config    configState                 // 通过Config.Apply应用的配置
+	templates map[string]*RequestTemplate // 通过RegisterTemplate注册的请求模板
+
+	speedTestDownload string // SpeedTest下载测速的地址模板
+	speedTestUpload   string // SpeedTest上传测速的地址
 }
 
 func New() *GoProxy {
-	return &GoProxy{
-		client: &http.Client{
-			Transport: &CustomTransport{
-				GlobalHeader: http.Header{"User-Agent": []string{DefaultUA}},
-				Transport: &http.Transport{
-					TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-				},
-			},
-			Timeout: DefaultTimeout,
-			// 禁止重定向
-			CheckRedirect: func(req *http.Request, via []*http.Request) error {
-				return http.ErrUseLastResponse
-			},
+	r := &GoProxy{
+		bandwidth: newBandwidthLimiter(),
+	}
+	r.utlsH2 = &utlsH2Transport{r: r}
+	r.h2c = &h2cTransport{r: r}
+	r.transport = &CustomTransport{
+		GlobalHeader: http.Header{"User-Agent": []string{DefaultUA}},
+		stats:        newStatsCollector(),
+		conns:        newConnTracker(),
+		alt:          altTransports{r.h2c, r.utlsH2},
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
 		},
 	}
+	r.client = &http.Client{
+		Transport: r.transport,
+		Timeout:   DefaultTimeout,
+		// 默认不跟随重定向，见SetMaxRedirects
+		CheckRedirect: redirectChecker(0, 0),
+	}
+	r.installDialers(r.transport.Transport)
+	return r
 }
 
 // CustomTransport 自定义传输层，用于处理HTTP请求的传输
 type CustomTransport struct {
 	// GlobalHeader 用于存储自定义的HTTP请求头
 	// 在发送请求时会自动添加到每个请求中，对于单
+	// 注意: 发送请求的同时修改应通过SetHeader等方法，直接修改该字段不是并发安全的
 	GlobalHeader http.Header     // 自定义请求头
 	Transport    *http.Transport // 底层传输实现
+
+	headerMu sync.RWMutex // 保护GlobalHeader
+
+	base     http.RoundTripper             // 替代Transport发送请求的RoundTripper，为nil时使用Transport
+	alt      http.RoundTripper             // 优先尝试的RoundTripper，返回http.ErrSkipAltProtocol时交由Transport处理
+	stats    *statsCollector               // 按代理统计请求结果，为nil时不统计
+	inFlight atomic.Int64                  // 进行中(响应体尚未关闭)的请求数
+	conns    *connTracker                  // 连接统计，为nil时不统计
+	logger   atomic.Pointer[TrafficLogger] // 流量日志记录器，为nil时不记录
+
+	headerOrder atomic.Pointer[[]string] // 请求头的发送顺序，为nil时使用Go默认的顺序
+	closed      atomic.Bool              // 客户端是否已关闭
+
+	expectThreshold atomic.Int64 // 自动添加Expect: 100-continue的请求体长度下限，为0时不添加
+
+	authorization atomic.Pointer[string]             // SetBasicAuth设置的Authorization请求头，为nil时不添加
+	tokens        atomic.Pointer[tokenCache]         // SetTokenSource设置的令牌来源，为nil时不添加
+	digest        atomic.Pointer[DigestTransport]    // SetDigestAuth设置的Digest认证，为nil时不处理质询
+	signer        atomic.Pointer[Signer]             // SetSigner设置的请求签名，为nil时不签名
+	credentials   atomic.Pointer[CredentialProvider] // SetCredentialProvider设置的凭据来源，为nil时不查询
+
+	referrerPolicy atomic.Int32            // Referer的生成规则
+	autoReferer    atomic.Bool             // 是否自动添加Referer
+	lastURL        atomic.Pointer[url.URL] // 开启自动Referer时上一次请求的地址
+
+	forwarding atomic.Pointer[redirectForwarding] // 跨源重定向时的转发规则，为nil时使用默认规则
+
+	maxBodySize atomic.Int64 // 响应体的大小上限，为0时不限制
+
+	hostHeaders atomic.Pointer[map[string]http.Header] // 按主机设置的请求头，修改时整体替换
+
+	headerTemplates atomic.Bool                              // 是否替换请求头中的模板变量
+	headerVars      atomic.Pointer[map[string]HeaderVarFunc] // 自定义的模板变量，修改时整体替换
+
+	userAgents atomic.Pointer[uaPool] // 轮换使用的User-Agent，为nil时使用全局请求头
+
+	headerPolicy atomic.Pointer[headerPolicy] // 合并自定义请求头的规则，为nil时使用默认规则
 }
 
 // SetHeader 设置自定义请求头
@@ -65,6 +170,8 @@ type CustomTransport struct {
 //
 // 注意: 如果设置User-Agent，将会覆盖默认的User-Agent
 func (c *CustomTransport) SetHeader(key, value string) {
+	c.headerMu.Lock()
+	defer c.headerMu.Unlock()
 	if c.GlobalHeader == nil {
 		c.GlobalHeader = make(http.Header)
 	}
@@ -78,6 +185,8 @@ func (c *CustomTransport) SetHeader(key, value string) {
 //
 // 注意: 如果添加User-Agent，将会覆盖默认的User-Agent
 func (c *CustomTransport) AddHeader(key, value string) {
+	c.headerMu.Lock()
+	defer c.headerMu.Unlock()
 	if c.GlobalHeader == nil {
 		c.GlobalHeader = make(http.Header)
 	}
@@ -88,6 +197,8 @@ func (c *CustomTransport) AddHeader(key, value string) {
 // 参数:
 //   - key: 要删除的请求头键名
 func (c *CustomTransport) DelHeader(key string) {
+	c.headerMu.Lock()
+	defer c.headerMu.Unlock()
 	if c.GlobalHeader != nil {
 		c.GlobalHeader.Del(key)
 	}
@@ -95,107 +206,358 @@ func (c *CustomTransport) DelHeader(key string) {
 
 // ClearHeaders 清除所有自定义请求头
 func (c *CustomTransport) ClearHeaders() {
+	c.headerMu.Lock()
+	defer c.headerMu.Unlock()
 	c.GlobalHeader = make(http.Header)
 }
 
+// SetHeaders 用h替换全部自定义请求头，调用后修改h不影响已设置的请求头
+func (c *CustomTransport) SetHeaders(h http.Header) {
+	c.headerMu.Lock()
+	defer c.headerMu.Unlock()
+	c.GlobalHeader = canonicalHeader(h)
+}
+
+// MergeHeaders 将h合并到自定义请求头中，h中的请求头替换同名的自定义请求头，其他自定义请求头保持不变
+func (c *CustomTransport) MergeHeaders(h http.Header) {
+	c.headerMu.Lock()
+	defer c.headerMu.Unlock()
+	if c.GlobalHeader == nil {
+		c.GlobalHeader = make(http.Header)
+	}
+	for key, values := range canonicalHeader(h) {
+		c.GlobalHeader[key] = values
+	}
+}
+
+// Headers 返回自定义请求头的副本
+func (c *CustomTransport) Headers() http.Header {
+	c.headerMu.RLock()
+	defer c.headerMu.RUnlock()
+	if c.GlobalHeader == nil {
+		return make(http.Header)
+	}
+	return c.GlobalHeader.Clone()
+}
+
+// canonicalHeader 返回h的副本，请求头名称转换为规范形式，同名的值合并
+func canonicalHeader(h http.Header) http.Header {
+	out := make(http.Header, len(h))
+	for key, values := range h {
+		for _, value := range values {
+			out.Add(key, value)
+		}
+	}
+	return out
+}
+
 // RoundTrip 实现了http.RoundTripper接口，用于处理HTTP请求
 // 自动添加User-Agent和其他自定义请求头
-func (c *CustomTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+func (c *CustomTransport) RoundTrip(req *http.Request) (resp *http.Response, err error) {
+	// 为没有类别的错误补充类别，见ErrTimeout等
+	defer func() { err = classifyError(err) }()
+	if c.closed.Load() {
+		return nil, ErrClosed
+	}
+	req, err = rewriteUnixRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	// 国际化域名统一转换为punycode后再匹配规则和连接
+	req = asciiRequest(req)
 	// 复制原始请求头，避免修改原始请求
 	req.Header = req.Header.Clone()
 
-	// 以下请求头只能有单个值,使用Set
-	singleValueHeaders := map[string]bool{
-		"Authorization":     true,
-		"Content-Type":      true,
-		"Content-Length":    true,
-		"Content-Encoding":  true,
-		"Host":              true,
-		"User-Agent":        true,
-		"If-Match":          true,
-		"If-None-Match":     true,
-		"If-Modified-Since": true,
-		"If-Range":          true,
-		"Range":             true,
+	// 跨源重定向时按转发规则过滤请求头
+	fw, initial := c.crossOriginForwarding(req)
+	if fw != nil {
+		fw.filter(req, initial)
 	}
 
+	// 按主机设置的请求头只发往匹配的主机，不受转发规则限制，优先于全局请求头
+	m := c.newHeaderMerge(req)
+	if h, ok := lookupHost(c.hostHeaderRules(), req.URL.Hostname()); ok {
+		m.merge(req.Header, h, nil)
+	}
+	c.applyUserAgent(req, m)
 	// 遍历自定义请求头
-	for key, values := range c.GlobalHeader {
-		for _, value := range values {
-			if singleValueHeaders[key] {
-				// req中的优先级更高
-				if _, ok := req.Header[key]; ok {
-					continue
-				}
-				// 对于单值请求头,使用Set覆盖
-				req.Header.Set(key, value)
-				break // 只使用第一个值
-			} else {
-				// 对于可以多值的请求头,使用Add追加
-				// 如果key已存在则使用Add追加,否则使用Set设置
-				if _, ok := req.Header[key]; ok {
-					req.Header.Add(key, value)
-				} else {
-					req.Header.Set(key, value)
-				}
-				continue
+	c.headerMu.RLock()
+	m.merge(req.Header, c.GlobalHeader, fw)
+	c.headerMu.RUnlock()
+
+	opts := optionsFromRequest(req)
+	c.applyAuthorization(req, opts)
+	c.applyReferer(req)
+	if c.autoReferer.Load() && req.Context().Value(noTokenKey{}) == nil {
+		u := req.URL
+		defer func() {
+			if err == nil {
+				c.lastURL.Store(u)
 			}
+		}()
+	}
+	if n := c.expectThreshold.Load(); n > 0 && req.ContentLength >= n && req.Header.Get("Expect") == "" &&
+		(opts == nil || opts.httpVersion != "1.0") {
+		req.Header.Set("Expect", "100-continue")
+	}
+	if tokens := c.tokens.Load(); tokens != nil && req.Header.Get("Authorization") == "" && sameOriginAsInitial(req) &&
+		req.Context().Value(noTokenKey{}) == nil {
+		return c.roundTripWithToken(req, opts, tokens)
+	}
+	if digest := c.digest.Load(); digest != nil {
+		return digest.roundTrip(req, func(req *http.Request) (*http.Response, error) {
+			return c.send(req, opts)
+		})
+	}
+	if err := c.applyCredentials(req); err != nil {
+		return nil, err
+	}
+	return c.send(req, opts)
+}
+
+// send 按单次请求的选项发送请求
+func (c *CustomTransport) send(req *http.Request, opts *requestOptions) (*http.Response, error) {
+	if s := c.signer.Load(); s != nil {
+		var err error
+		if req, err = sign(req, *s); err != nil {
+			return nil, err
+		}
+	}
+	if opts == nil {
+		return c.roundTrip(req)
+	}
+	if opts.closeConn && !req.Close {
+		r2 := *req
+		r2.Close = true
+		req = &r2
+	}
+	if req.Body != nil && req.Body != http.NoBody && (opts.uploadProgress != nil || opts.uploadBps > 0) {
+		r2 := *req
+		if opts.uploadBps > 0 {
+			limiter := &rateLimiter{}
+			limiter.setRate(opts.uploadBps)
+			r2.Body = &throttledReader{rc: r2.Body, limiter: limiter}
+		}
+		if opts.uploadProgress != nil {
+			total := req.ContentLength
+			if total == 0 {
+				total = -1
+			}
+			r2.Body = &progressReader{rc: r2.Body, total: total, fn: opts.uploadProgress}
+		}
+		req = &r2
+	}
+
+	resp, err := c.roundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	if opts.downloadBps > 0 {
+		limiter := &rateLimiter{}
+		limiter.setRate(opts.downloadBps)
+		resp.Body = &throttledReader{rc: resp.Body, limiter: limiter}
+	}
+	if opts.progress != nil {
+		resp.Body = &progressReader{rc: resp.Body, total: resp.ContentLength, fn: opts.progress}
+	}
+	return resp, nil
+}
+
+// roundTrip 通过底层传输发送请求，并记录统计和流量日志
+func (c *CustomTransport) roundTrip(req *http.Request) (*http.Response, error) {
+	proxy := directProxyKey
+	if c.stats != nil {
+		proxy = c.stats.currentProxy()
+	}
+	next := http.RoundTripper(roundTripperFunc(c.dispatch))
+	if c.base != nil {
+		// 中间件最终调用的Transport上注册了dispatchProtocol，请求同样经过dispatch
+		next = c.base
+	}
+	releaseConn := func() {}
+	if c.conns != nil {
+		req, releaseConn = c.conns.traceConn(req)
+	}
+	// 请求失败或响应体关闭时结束，响应体可能被多次关闭
+	c.inFlight.Add(1)
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			releaseConn()
+			c.inFlight.Add(-1)
+		})
+	}
+	start := time.Now()
+	resp, err := next.RoundTrip(req)
+	if err != nil {
+		release()
+	} else {
+		resp.Body = &onCloseBody{ReadCloser: resp.Body, onClose: release}
+		if err = c.limitBody(req, resp); err != nil {
+			resp = nil
 		}
 	}
+	err = annotateError(err, PhaseRead, redactProxy(proxy))
+	if c.stats != nil {
+		c.stats.record(proxy, time.Since(start), err)
+	}
+	if l := c.logger.Load(); l != nil {
+		l.observe(req, resp, err, proxy, start)
+	}
+	return resp, err
+}
 
-	return c.Transport.RoundTrip(req)
+// dispatchedKey 标记请求已经过dispatch的context键
+type dispatchedKey struct{}
+
+// dispatch 选择发送请求的方式: 先尝试alt(h2c、uTLS HTTP/2)，alt不适用时按单次请求的选项
+// 使用HTTP/1.0、不保持连接的独立Transport或共用的Transport发送
+func (c *CustomTransport) dispatch(req *http.Request) (*http.Response, error) {
+	req = req.WithContext(context.WithValue(req.Context(), dispatchedKey{}, true))
+	if c.alt != nil {
+		var resp *http.Response
+		var err error
+		if timeout := c.Transport.ResponseHeaderTimeout; timeout > 0 {
+			resp, err = roundTripHeaderTimeout(c.alt, req, timeout)
+		} else {
+			resp, err = c.alt.RoundTrip(req)
+		}
+		if err != http.ErrSkipAltProtocol {
+			return resp, err
+		}
+	}
+	req = c.withHeaderOrder(req)
+	t := c.Transport
+	if opts := optionsFromRequest(req); opts != nil && opts.httpVersion == "1.0" {
+		return http10RoundTrip(t, req)
+	} else if opts != nil && (opts.ownConn() || len(opts.headerOrder) > 0 && t.ForceAttemptHTTP2) {
+		// 开启HTTP/2时单独指定请求头顺序的请求同样需要独立的HTTP/1.1连接
+		// 单次请求的选项影响连接建立，使用不保持连接的独立Transport，避免连接被其他请求复用
+		t = t.Clone()
+		t.DisableKeepAlives = true
+	}
+	return t.RoundTrip(req)
+}
+
+// dispatchProtocol 通过RegisterProtocol注册在SetTransport中间件包装的Transport上，
+// 使中间件直接调用Transport发送的请求同样经过dispatch
+type dispatchProtocol struct {
+	c *CustomTransport
+}
+
+func (p dispatchProtocol) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Context().Value(dispatchedKey{}) != nil {
+		// dispatch选定的Transport发送请求时交回Transport处理
+		return nil, http.ErrSkipAltProtocol
+	}
+	return p.c.dispatch(req)
+}
+
+// registerDispatch 在t上为http和https注册dispatchProtocol
+func (c *CustomTransport) registerDispatch(t *http.Transport) {
+	for _, scheme := range []string{"http", "https"} {
+		func() {
+			// 已注册过(包括Clone复制来的注册或调用方自己注册的协议)时RegisterProtocol会panic，保留已有的注册
+			defer func() { recover() }()
+			t.RegisterProtocol(scheme, dispatchProtocol{c})
+		}()
+	}
 }
 
 // SetProxy 设置代理服务器
-// 支持HTTP、HTTPS和SOCKS5代理
-// 参数s为空字符串时表示不使用代理
+// 支持HTTP、HTTPS和SOCKS5代理，以及通过Unix套接字连接的HTTP代理("unix:///path/to/proxy.sock")
+// 和SOCKS5代理("socks5+unix:///path/to/proxy.sock")
+// 参数s为空字符串时表示不使用代理；地址不含用户信息且设置了SetCredentialProvider时从凭据来源查询代理认证信息
 func (r *GoProxy) SetProxy(s string) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	ct := r.client.Transport.(*CustomTransport)
+	if err := r.checkTransport(); err != nil {
+		return err
+	}
+	ct := r.transport
 	if s == "" {
-		ct.Transport.Proxy = nil
-		ct.Transport.DialContext = nil
+		r.httpProxy = nil
+		r.socksDialer = nil
+		r.socksProxy = nil
 		r.proxyUrl = ""
+		r.installDialers(ct.Transport)
+		if ct.stats != nil {
+			ct.stats.setCurrent("")
+		}
 		return nil // 不使用代理，设置成功
 	}
 
-	proxyURL, err := url.Parse(s)
+	proxyURL, isUnix, err := parseProxyURL(s)
 	if err != nil {
-		return fmt.Errorf("代理地址解析失败: %w", err)
-	}
-
-	switch proxyURL.Scheme {
-	case "http", "https":
-		ct.Transport.Proxy = http.ProxyURL(proxyURL)
-		ct.Transport.DialContext = nil
-	case "socks5":
-		var auth *proxy.Auth
-		if proxyURL.User != nil {
-			auth = &proxy.Auth{
-				User:     proxyURL.User.Username(),
-				Password: "",
-			}
-			if password, ok := proxyURL.User.Password(); ok {
-				auth.Password = password
-			}
+		return err
+	}
+	// Unix套接字代理没有主机名，不查询凭据
+	if !isUnix {
+		if err := ct.proxyCredentials(proxyURL); err != nil {
+			return err
 		}
-		dialer, err := proxy.SOCKS5("tcp", proxyURL.Host, auth, proxy.Direct)
+	}
+
+	if proxyURL.Scheme == "socks5" {
+		dialer, err := newSOCKS5Dialer(r, proxyURL)
 		if err != nil {
 			return fmt.Errorf("创建SOCKS5代理失败: %w", err)
 		}
-		ct.Transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
-			return dialer.Dial(network, addr)
-		}
-		ct.Transport.Proxy = nil
-	default:
-		return fmt.Errorf("不支持的代理协议: %s", proxyURL.Scheme)
+		r.httpProxy = nil
+		r.socksDialer = dialer
+		r.socksProxy = proxyURL
+	} else {
+		r.httpProxy = proxyURL
+		r.socksDialer = nil
+		r.socksProxy = nil
 	}
 	r.proxyUrl = s
+	r.installDialers(ct.Transport)
+	if ct.stats != nil {
+		ct.stats.setCurrent(s)
+	}
 	return nil // 设置成功
 }
 
-// SetTimeout 设置HTTP请求的超时时间
+// parseProxyURL 解析SetProxy格式的代理地址，Unix套接字代理转换为以unixSocketHost为主机的http或socks5地址
+func parseProxyURL(s string) (u *url.URL, isUnix bool, err error) {
+	u, err = url.Parse(s)
+	if err != nil {
+		return nil, false, fmt.Errorf("代理地址解析失败: %w", err)
+	}
+	switch u.Scheme {
+	case "unix", "socks5+unix":
+		if u.Host != "" || u.Path == "" {
+			return nil, false, fmt.Errorf("无效的Unix套接字代理地址: %s", s)
+		}
+		scheme := "http"
+		if u.Scheme == "socks5+unix" {
+			scheme = "socks5"
+		}
+		return &url.URL{Scheme: scheme, User: u.User, Host: unixSocketHost(u.Path)}, true, nil
+	case "http", "https", "socks5":
+		return u, false, nil
+	}
+	return nil, false, fmt.Errorf("不支持的代理协议: %s", u.Scheme)
+}
+
+// newSOCKS5Dialer 创建通过r直接连接SOCKS5代理服务器的拨号器
+func newSOCKS5Dialer(r *GoProxy, proxyURL *url.URL) (proxy.Dialer, error) {
+	var auth *proxy.Auth
+	if proxyURL.User != nil {
+		auth = &proxy.Auth{
+			User:     proxyURL.User.Username(),
+			Password: "",
+		}
+		if password, ok := proxyURL.User.Password(); ok {
+			auth.Password = password
+		}
+	}
+	return proxy.SOCKS5("tcp", canonicalAddr(proxyURL), auth, directDialer{r})
+}
+
+// SetTimeout 设置HTTP请求的超时时间，包括读取响应体，各阶段的超时见SetDialTimeout、SetTLSHandshakeTimeout、
+// SetResponseHeaderTimeout和SetIdleConnTimeout
 func (r *GoProxy) SetTimeout(timeout time.Duration) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
@@ -208,10 +570,37 @@ func (r *GoProxy) GetTimeout() time.Duration {
 }
 
 // GetClient 获取HTTP客户端实例
+// 注意: 替换返回的Client的Transport后代理等设置不再作用于请求，此时SetProxy返回ErrTransportReplaced；
+// 以中间件包装原Transport并提供Unwrap() http.RoundTripper方法时设置仍然生效
 func (r *GoProxy) GetClient() *http.Client {
 	return r.client
 }
 
+// ErrTransportReplaced GetClient返回的Client的Transport已被替换，设置不会作用于请求
+var ErrTransportReplaced = errors.New("http.Client的Transport已被替换，设置不会生效")
+
+// checkTransport 检查client是否仍经由r.transport发送请求，沿Unwrap方法查找被中间件包装的r.transport
+func (r *GoProxy) checkTransport() error {
+	rt := r.client.Transport
+	for rt != nil {
+		if rt == http.RoundTripper(r.transport) {
+			return nil
+		}
+		u, ok := rt.(interface{ Unwrap() http.RoundTripper })
+		if !ok {
+			break
+		}
+		rt = u.Unwrap()
+	}
+	return ErrTransportReplaced
+}
+
+// GetTransport 获取底层的http.Transport实例
+// 代理、TLS等设置都作用在该实例上，可作为cassette等中间件的真实传输层
+func (r *GoProxy) GetTransport() *http.Transport {
+	return r.transport.Transport
+}
+
 // String 返回当前代理服务器的URL字符串
 func (r *GoProxy) String() string {
 	return r.proxyUrl
@@ -219,54 +608,124 @@ func (r *GoProxy) String() string {
 
 // 添加一个设置全局请求头的方法
 func (r *GoProxy) SetGlobalHeader(key, value string) {
-	r.mu.Lock()
-	defer r.mu.Unlock()
-	r.client.Transport.(*CustomTransport).SetHeader(key, value)
+	r.transport.SetHeader(key, value)
+}
+
+// AddGlobalHeader 为全局请求头添加一个值，已有的值保留
+func (r *GoProxy) AddGlobalHeader(key, value string) {
+	r.transport.AddHeader(key, value)
+}
+
+// SetGlobalHeaders 用h替换全部全局请求头，包括默认的User-Agent；调用后修改h不影响已设置的请求头
+func (r *GoProxy) SetGlobalHeaders(h http.Header) {
+	r.transport.SetHeaders(h)
+}
+
+// MergeGlobalHeaders 将h合并到全局请求头中，h中的请求头替换同名的全局请求头，其他全局请求头保持不变
+func (r *GoProxy) MergeGlobalHeaders(h http.Header) {
+	r.transport.MergeHeaders(h)
 }
 
 // 添加一个删除全局请求头的方法
 func (r *GoProxy) DelGlobalHeader(key string) {
-	r.client.Transport.(*CustomTransport).DelHeader(key)
+	r.transport.DelHeader(key)
 }
 
 // 添加一个清除所有全局请求头的方法
 func (r *GoProxy) ClearGlobalHeaders() {
-	r.client.Transport.(*CustomTransport).ClearHeaders()
+	r.transport.ClearHeaders()
 }
 
 // 添加一个获取全局请求头的方法
+// 返回的是副本，修改它不影响全局请求头，应使用SetGlobalHeader等方法修改
 func (r *GoProxy) GetGlobalHeaders() http.Header {
-	return r.client.Transport.(*CustomTransport).GlobalHeader
+	return r.transport.Headers()
 }
 
 // 自动设置UserAgent
 func (r *GoProxy) AutoSetUserAgent(autoSet bool) {
-	r.mu.Lock()
-	defer r.mu.Unlock()
-	if _, ok := r.client.Transport.(*CustomTransport).GlobalHeader["User-Agent"]; ok {
+	ct := r.transport
+	ct.headerMu.Lock()
+	defer ct.headerMu.Unlock()
+	if _, ok := ct.GlobalHeader["User-Agent"]; ok {
 		return
 	}
 	if autoSet {
-		r.client.Transport.(*CustomTransport).SetHeader("User-Agent", DefaultUA)
+		if ct.GlobalHeader == nil {
+			ct.GlobalHeader = make(http.Header)
+		}
+		ct.GlobalHeader.Set("User-Agent", DefaultUA)
 	} else {
-		r.client.Transport.(*CustomTransport).DelHeader("User-Agent")
+		ct.GlobalHeader.Del("User-Agent")
 	}
 }
 
+// SetCheckRedirect 设置自定义的重定向检查函数，与http.Client.CheckRedirect相同，为nil时使用Go默认的策略(最多跟随10次)
+// 会覆盖SetMaxRedirects的设置；设置了WithFollowRedirects的请求不调用checkRedirect
 func (r *GoProxy) SetCheckRedirect(checkRedirect func(req *http.Request, via []*http.Request) error) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	r.client.CheckRedirect = checkRedirect
+	r.client.CheckRedirect = customRedirectChecker(checkRedirect, r.redirectPolicy)
 }
 
-func (r *GoProxy) SetTransport(transport *http.Transport) {
+// SetTransport 设置发送请求的RoundTripper，全局请求头、统计和流量日志等仍由CustomTransport处理
+//   - *http.Transport: 作为底层Transport，代理、TLS指纹、解析器等设置安装在它上面
+//   - 包装了*http.Transport的中间件: 沿中间件的Unwrap() http.RoundTripper方法逐层找到其中的*http.Transport，
+//     在其上安装代理等设置，请求经由中间件发送，中间件的包装得以保留。中间件调用该Transport时，
+//     h2c、uTLS HTTP/2、WithHTTP10等单次请求选项和请求头顺序照常生效
+//   - 其他RoundTripper: 与SetTransportRoundTripper相同，请求直接交由它发送，代理等设置不生效
+//
+// 传入nil时恢复默认的Transport。注意: 传入的Transport的HTTP/2行为由其自身的字段决定
+func (r *GoProxy) SetTransport(rt http.RoundTripper) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	ct := r.client.Transport.(*CustomTransport)
-	if transport == nil {
-		// 如果传入的transport为nil，则使用默认的transport避免panic
-		ct.Transport = &http.Transport{}
+	ct := r.transport
+	if rt == nil {
+		ct.base = nil
+		ct.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+		r.installDialers(ct.Transport)
+		r.rebuildTransport()
 		return
 	}
-	ct.Transport = transport
+	t := unwrapTransport(rt)
+	if t != nil {
+		ct.Transport = t
+		r.installDialers(t)
+	}
+	if rt == http.RoundTripper(t) {
+		ct.base = nil
+	} else {
+		ct.base = rt
+		if t != nil {
+			ct.registerDispatch(t)
+		}
+	}
+}
+
+// unwrapTransport 沿Unwrap方法逐层查找rt中的*http.Transport，找不到时返回nil
+func unwrapTransport(rt http.RoundTripper) *http.Transport {
+	for rt != nil {
+		if t, ok := rt.(*http.Transport); ok {
+			if rt == http.DefaultTransport {
+				// 不修改全局共享的默认Transport
+				return nil
+			}
+			return t
+		}
+		u, ok := rt.(interface{ Unwrap() http.RoundTripper })
+		if !ok {
+			return nil
+		}
+		rt = u.Unwrap()
+	}
+	return nil
+}
+
+// SetTransportRoundTripper 设置替代底层Transport发送请求的RoundTripper
+// 全局请求头、统计和流量日志等仍然生效，只是最终请求交由rt发送，
+// 常用于在单元测试中安装mock.Transport。rt为nil时恢复使用底层Transport
+func (r *GoProxy) SetTransportRoundTripper(rt http.RoundTripper) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.transport.base = rt
 }
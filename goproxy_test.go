@@ -2,8 +2,16 @@
 package goproxy
 
 import (
+	"errors"
+	"io"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
 	"testing"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 func TestGoProxy_SetProxy(t *testing.T) {
@@ -54,3 +62,164 @@ func TestGoProxy_SetProxy(t *testing.T) {
 		t.Log(resp.StatusCode)
 	}
 }
+
+// countingMiddleware 记录请求次数后交由next发送的中间件
+type countingMiddleware struct {
+	next http.RoundTripper
+	n    atomic.Int32
+}
+
+func (m *countingMiddleware) RoundTrip(req *http.Request) (*http.Response, error) {
+	m.n.Add(1)
+	return m.next.RoundTrip(req)
+}
+
+func (m *countingMiddleware) Unwrap() http.RoundTripper {
+	return m.next
+}
+
+func TestGoProxy_SetTransport(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer target.Close()
+	proxySrv, _ := newTestProxy(t)
+
+	c := New()
+	if err := c.SetProxy(proxySrv.URL); err != nil {
+		t.Fatal(err)
+	}
+	viaProxy := func() bool {
+		resp, err := c.GetClient().Get(target.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.Header.Get("X-Via-Proxy") == "1"
+	}
+
+	// 包装了Transport的中间件得以保留，代理设置安装在其中的Transport上
+	inner := &http.Transport{}
+	mw := &countingMiddleware{next: inner}
+	c.SetTransport(mw)
+	if !viaProxy() || mw.n.Load() != 1 {
+		t.Errorf("中间件调用%d次", mw.n.Load())
+	}
+	if c.GetTransport() != inner {
+		t.Error("底层Transport应为中间件包装的Transport")
+	}
+
+	c.SetTransport(&http.Transport{})
+	if !viaProxy() || mw.n.Load() != 1 {
+		t.Error("替换为Transport后应不再经过中间件且仍使用代理")
+	}
+
+	c.SetTransport(nil)
+	if !viaProxy() {
+		t.Error("恢复默认Transport后应仍使用代理")
+	}
+	if unwrapTransport(&countingMiddleware{next: http.DefaultTransport}) != nil {
+		t.Error("不应修改http.DefaultTransport")
+	}
+}
+
+func TestGoProxy_SetTransportDispatch(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Proto)
+	})
+	srv := httptest.NewServer(h2c.NewHandler(handler, &http2.Server{}))
+	defer srv.Close()
+
+	// 中间件包装的Transport上仍按单次请求的选项和h2c等设置选择发送方式
+	c := New()
+	mw := &countingMiddleware{next: c.GetTransport()}
+	c.SetTransport(mw)
+	do := func(opts ...RequestOption) string {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+		resp, err := c.Do(req, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		return string(b)
+	}
+	if got := do(WithHTTP10()); got != "HTTP/1.0" {
+		t.Errorf("WithHTTP10经过中间件后为%s", got)
+	}
+	if got := do(WithH2C()); got != "HTTP/2.0" {
+		t.Errorf("WithH2C经过中间件后为%s", got)
+	}
+	u, _ := url.Parse(srv.URL)
+	c.SetHostH2C(u.Hostname(), true)
+	if got := do(); got != "HTTP/2.0" {
+		t.Errorf("SetHostH2C经过中间件后为%s", got)
+	}
+	c.SetHostH2C(u.Hostname(), false)
+	if got := do(); got != "HTTP/1.1" {
+		t.Errorf("默认请求为%s", got)
+	}
+	if mw.n.Load() != 4 {
+		t.Errorf("中间件调用%d次", mw.n.Load())
+	}
+}
+
+func TestGoProxy_TransportReplaced(t *testing.T) {
+	c := New()
+	client := c.GetClient()
+	// 包装原Transport的中间件不影响设置
+	client.Transport = NewDigestTransport("user", "pass", client.Transport)
+	if err := c.SetProxy("http://127.0.0.1:8080"); err != nil {
+		t.Fatalf("包装Transport后设置代理失败: %v", err)
+	}
+
+	client.Transport = http.DefaultTransport
+	if err := c.SetProxy("http://127.0.0.1:8080"); !errors.Is(err, ErrTransportReplaced) {
+		t.Errorf("替换Transport后设置代理的错误为%v", err)
+	}
+	// 其他设置不再依赖Transport的类型，不会panic
+	c.SetGlobalHeader("X-Test", "1")
+	c.SetMaxRedirects(1)
+	c.SetReferrerPolicy(ReferrerOrigin)
+	if got := c.GetGlobalHeaders().Get("X-Test"); got != "1" {
+		t.Errorf("全局请求头为%q", got)
+	}
+}
+
+func TestGoProxy_GlobalHeaders(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Header.Get("X-A")+"|"+r.Header.Get("X-B")+"|"+r.Header.Get("User-Agent"))
+	}))
+	defer srv.Close()
+	c := New()
+	h := c.GetGlobalHeaders()
+	h.Set("X-A", "leak")
+	if got := getBody(t, c, srv.URL); got != "||"+DefaultUA {
+		t.Errorf("修改GetGlobalHeaders的返回值影响了请求: %q", got)
+	}
+
+	c.SetGlobalHeaders(http.Header{"x-a": {"1"}, "X-B": {"2"}})
+	if got := getBody(t, c, srv.URL); got != "1|2|Go-http-client/1.1" {
+		t.Errorf("替换后的响应为%q", got)
+	}
+	c.MergeGlobalHeaders(http.Header{"X-B": {"3"}, "User-Agent": {"ua"}})
+	if got := getBody(t, c, srv.URL); got != "1|3|ua" {
+		t.Errorf("合并后的响应为%q", got)
+	}
+
+	// 发送请求的同时修改全局请求头
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			c.SetGlobalHeader("X-A", "x")
+			c.MergeGlobalHeaders(http.Header{"X-B": {"y"}})
+			c.GetGlobalHeaders()
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		getBody(t, c, srv.URL)
+	}
+	<-done
+}
@@ -0,0 +1,93 @@
+package goproxy
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"sync"
+
+	"golang.org/x/net/http2"
+)
+
+// SetHostH2C 设置访问指定主机的http请求是否使用h2c(明文HTTP/2)
+// h2c采用prior knowledge方式，连接建立后直接发送HTTP/2帧而不经过Upgrade协商，
+// 适用于内网不启用TLS的gRPC/HTTP2服务。只对http目标生效，https目标不受影响。
+// 使用HTTP代理时通过CONNECT隧道连接目标
+// 参数:
+//   - host: 目标主机名，支持"*.example.com"形式的通配符
+//   - enable: 是否使用h2c，为false时删除该主机的设置
+func (r *GoProxy) SetHostH2C(host string, enable bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	host = normalizeHost(host)
+	if !enable {
+		delete(r.h2cHosts, host)
+		return
+	}
+	if r.h2cHosts == nil {
+		r.h2cHosts = make(map[string]bool)
+	}
+	r.h2cHosts[host] = true
+}
+
+// WithH2C 单次请求使用h2c(明文HTTP/2)，见SetHostH2C
+func WithH2C() RequestOption {
+	return func(o *requestOptions) {
+		o.h2c = true
+	}
+}
+
+// h2cTransport 以prior knowledge方式发送h2c请求，连接由内部的http2.Transport复用
+type h2cTransport struct {
+	r *GoProxy
+
+	mu sync.Mutex
+	t  *http2.Transport
+}
+
+// RoundTrip 实现http.RoundTripper接口，请求不使用h2c时返回http.ErrSkipAltProtocol
+func (t *h2cTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme != "http" {
+		return nil, http.ErrSkipAltProtocol
+	}
+	r := t.r
+	opts := optionsFromRequest(req)
+	r.mu.Lock()
+	enabled, _ := lookupHost(r.h2cHosts, req.URL.Hostname())
+	settings := r.http2Settings
+	r.mu.Unlock()
+	if !enabled && (opts == nil || !opts.h2c) {
+		return nil, http.ErrSkipAltProtocol
+	}
+	if opts != nil && opts.httpVersion != "" {
+		return nil, http.ErrSkipAltProtocol
+	}
+
+	t.mu.Lock()
+	if t.t == nil {
+		t.t = &http2.Transport{
+			AllowHTTP:        true,
+			ReadIdleTimeout:  settings.ReadIdleTimeout,
+			PingTimeout:      settings.PingTimeout,
+			WriteByteTimeout: settings.WriteByteTimeout,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				// AllowHTTP时http目标同样经由DialTLSContext拨号，此处建立的是明文连接
+				return r.dialContext(ctx, network, addr)
+			},
+		}
+	}
+	h2t := t.t
+	t.mu.Unlock()
+	return h2t.RoundTrip(req)
+}
+
+// closeIdle 关闭空闲连接，之后的请求按新的配置建立连接
+func (t *h2cTransport) closeIdle() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.t != nil {
+		t.t.CloseIdleConnections()
+		t.t = nil
+	}
+}
@@ -0,0 +1,53 @@
+package goproxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+func TestGoProxy_H2C(t *testing.T) {
+	srv := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	}), &http2.Server{}))
+	defer srv.Close()
+
+	c := New()
+	if got := getBody(t, c, srv.URL); got != "HTTP/1.1" {
+		t.Fatalf("默认应使用HTTP/1.1，实际为%s", got)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	resp, err := c.Do(req, WithH2C())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.ProtoMajor != 2 {
+		t.Fatalf("WithH2C应使用HTTP/2，实际为%s", resp.Proto)
+	}
+
+	u, _ := url.Parse(srv.URL)
+	c.SetHostH2C(u.Hostname(), true)
+	if got := getBody(t, c, srv.URL); got != "HTTP/2.0" {
+		t.Fatalf("按主机开启后应使用HTTP/2，实际为%s", got)
+	}
+
+	// 经由HTTP代理时通过CONNECT隧道发送h2c
+	p, connects := newTestProxy(t)
+	if err := c.SetProxy(p.URL); err != nil {
+		t.Fatal(err)
+	}
+	if got := getBody(t, c, srv.URL); got != "HTTP/2.0" || connects.Load() != 1 {
+		t.Fatalf("经代理应使用HTTP/2，实际为%s，CONNECT次数%d", got, connects.Load())
+	}
+
+	c.SetHostH2C(u.Hostname(), false)
+	if got := getBody(t, c, srv.URL); got != "HTTP/1.1" {
+		t.Fatalf("关闭后应使用HTTP/1.1，实际为%s", got)
+	}
+}
@@ -0,0 +1,122 @@
+package goproxy
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// DefaultFallbackDelay Happy Eyeballs中启动下一次连接前的默认等待时间，与net.Dialer一致
+const DefaultFallbackDelay = 300 * time.Millisecond
+
+// SetFallbackDelay 设置直接连接目标或代理服务器时Happy Eyeballs(RFC 8305)的等待时间
+// 域名解析出多个地址时交替使用IPv6和IPv4地址发起连接，前一个连接在delay内未建立或失败时立即并行尝试下一个，
+// 使用第一个成功的连接，以减少双栈网络中某一地址族不通时的连接耗时
+// 参数:
+//   - delay: 启动下一次连接前的等待时间，为0时使用DefaultFallbackDelay，小于0时关闭并行连接，依次尝试每个地址
+func (r *GoProxy) SetFallbackDelay(delay time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.fallbackDelay = delay
+}
+
+// GetFallbackDelay 获取Happy Eyeballs的等待时间
+func (r *GoProxy) GetFallbackDelay() time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.fallbackDelay
+}
+
+// interleaveFamilies 从第一个地址的地址族开始交替排列IPv6和IPv4地址，同一地址族内保持原有顺序
+func interleaveFamilies(ips []net.IP) []net.IP {
+	if len(ips) == 0 {
+		return ips
+	}
+	var primary, secondary []net.IP
+	first := ips[0].To4() != nil
+	for _, ip := range ips {
+		if (ip.To4() != nil) == first {
+			primary = append(primary, ip)
+		} else {
+			secondary = append(secondary, ip)
+		}
+	}
+	result := make([]net.IP, 0, len(ips))
+	for i := 0; i < len(primary) || i < len(secondary); i++ {
+		if i < len(primary) {
+			result = append(result, primary[i])
+		}
+		if i < len(secondary) {
+			result = append(result, secondary[i])
+		}
+	}
+	return result
+}
+
+// dialParallel 按顺序连接ips，前一个连接失败或超过等待时间仍未建立时启动下一个，返回第一个成功的连接
+// 其余连接被取消，已建立的多余连接会被关闭
+func (p dialPlan) dialParallel(ctx context.Context, network string, ips []net.IP, port string) (net.Conn, error) {
+	delay := p.fallbackDelay
+	if delay == 0 {
+		delay = DefaultFallbackDelay
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	results := make(chan result, len(ips))
+	next, pending := 0, 0
+	start := func() {
+		ip := ips[next]
+		next++
+		pending++
+		go func() {
+			conn, err := p.dialIP(ctx, network, ip, port)
+			results <- result{conn, err}
+		}()
+	}
+
+	var timer <-chan time.Time
+	startNext := func() {
+		if next >= len(ips) {
+			timer = nil
+			return
+		}
+		start()
+		if delay > 0 {
+			timer = time.After(delay)
+		}
+	}
+	startNext()
+
+	var firstErr error
+	for pending > 0 {
+		select {
+		case res := <-results:
+			pending--
+			if res.err == nil {
+				go func(n int) {
+					for ; n > 0; n-- {
+						if late := <-results; late.conn != nil {
+							late.conn.Close()
+						}
+					}
+				}(pending)
+				return res.conn, nil
+			}
+			if firstErr == nil {
+				firstErr = res.err
+			}
+			if ctx.Err() != nil {
+				continue
+			}
+			startNext()
+		case <-timer:
+			startNext()
+		}
+	}
+	return nil, firstErr
+}
@@ -0,0 +1,51 @@
+package goproxy
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestGoProxy_SetFallbackDelay(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	c := New()
+	// 192.0.2.1为文档保留地址，连接不会建立
+	c.SetResolver(staticResolver{"internal.test": {
+		{IP: net.ParseIP("192.0.2.1")},
+		{IP: net.ParseIP("127.0.0.1")},
+	}})
+	c.SetFallbackDelay(50 * time.Millisecond)
+	if c.GetFallbackDelay() != 50*time.Millisecond {
+		t.Fatal("等待时间未保存")
+	}
+	start := time.Now()
+	if got := getBody(t, c, "http://internal.test:"+u.Port()); got != "ok" {
+		t.Errorf("响应为%q", got)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("连接耗时%v, 未并行尝试下一个地址", elapsed)
+	}
+}
+
+func TestInterleaveFamilies(t *testing.T) {
+	var ips []net.IP
+	for _, s := range []string{"2001:db8::1", "2001:db8::2", "2001:db8::3", "10.0.0.1", "10.0.0.2"} {
+		ips = append(ips, net.ParseIP(s))
+	}
+	want := []string{"2001:db8::1", "10.0.0.1", "2001:db8::2", "10.0.0.2", "2001:db8::3"}
+	got := interleaveFamilies(ips)
+	for i, ip := range got {
+		if ip.String() != want[i] {
+			t.Fatalf("排列结果为%v", got)
+		}
+	}
+}
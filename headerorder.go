@@ -0,0 +1,210 @@
+package goproxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// headerOrderKey 在请求和连接包装之间传递头部顺序的内部请求头，写入连接前被移除
+const headerOrderKey = "X-Goproxy-Header-Order"
+
+// maxHeaderBlock 连接包装缓存请求头的上限，超过后原样发送
+const maxHeaderBlock = 1 << 20
+
+// SetHeaderOrder 设置HTTP/1.x请求头在报文中的顺序和大小写
+// Go默认会规范化请求头名称的大小写并按字母顺序发送，部分反爬系统会据此识别客户端。
+// 设置后names中列出的请求头按给定顺序排在最前面，名称按给定的大小写写出(匹配时不区分大小写)，
+// 未列出的请求头保持原有的相对顺序排在其后。可以包含"Host"以调整其位置。
+// names为空时恢复默认行为。
+// 注意: HTTP/2要求名称小写且不保证顺序，设置后https连接只协商HTTP/1.1
+func (r *GoProxy) SetHeaderOrder(names ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ct := r.transport
+	if len(names) == 0 {
+		ct.headerOrder.Store(nil)
+	} else {
+		names = append([]string(nil), names...)
+		ct.headerOrder.Store(&names)
+	}
+	r.closeIdleConns()
+}
+
+// GetHeaderOrder 获取SetHeaderOrder设置的请求头顺序
+func (r *GoProxy) GetHeaderOrder() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if p := r.transport.headerOrder.Load(); p != nil {
+		return append([]string(nil), *p...)
+	}
+	return nil
+}
+
+// WithHeaderOrder 设置单次请求的请求头顺序和大小写，优先级高于SetHeaderOrder，见SetHeaderOrder
+func WithHeaderOrder(names ...string) RequestOption {
+	return func(o *requestOptions) {
+		o.headerOrder = append([]string(nil), names...)
+	}
+}
+
+// headerOrderFor 返回请求生效的请求头顺序
+func (c *CustomTransport) headerOrderFor(req *http.Request) []string {
+	if o := optionsFromRequest(req); o != nil && len(o.headerOrder) > 0 {
+		return o.headerOrder
+	}
+	if p := c.headerOrder.Load(); p != nil {
+		return *p
+	}
+	return nil
+}
+
+// withHeaderOrder 将请求头顺序以内部请求头的形式附加到请求上，由连接包装在发送时处理
+func (c *CustomTransport) withHeaderOrder(req *http.Request) *http.Request {
+	order := c.headerOrderFor(req)
+	if len(order) == 0 {
+		return req
+	}
+	r2 := *req
+	r2.Header = req.Header.Clone()
+	r2.Header[headerOrderKey] = []string{strings.Join(order, ",")}
+	return &r2
+}
+
+// headerOrderForced 连接是否需要只协商HTTP/1.1以便控制请求头顺序
+func (r *GoProxy) headerOrderForced(ctx context.Context) bool {
+	if o, _ := ctx.Value(requestOptionsKey{}).(*requestOptions); o != nil && len(o.headerOrder) > 0 {
+		return true
+	}
+	return r.transport.headerOrder.Load() != nil
+}
+
+// headerOrderConn 按内部请求头指定的顺序改写HTTP/1.x请求头
+// Transport的每个请求都从一次新的Write开始，以请求行开头的Write被缓存到请求头结束后再改写发送
+type headerOrderConn struct {
+	net.Conn
+	buf     []byte
+	pending bool
+}
+
+// NetConn 返回被包装的连接
+func (c *headerOrderConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+// wrapHeaderOrder 包装连接，TLS连接保留ConnectionState以便响应的TLS字段可用
+func wrapHeaderOrder(conn net.Conn) net.Conn {
+	hc := &headerOrderConn{Conn: conn}
+	if tc, ok := conn.(tlsConn); ok {
+		return &headerOrderTLSConn{headerOrderConn: hc, state: tc}
+	}
+	return hc
+}
+
+func (c *headerOrderConn) Write(b []byte) (int, error) {
+	if !c.pending {
+		if !looksLikeRequestLine(b) {
+			return c.Conn.Write(b)
+		}
+		c.pending = true
+	}
+	c.buf = append(c.buf, b...)
+	end := bytes.Index(c.buf, []byte("\r\n\r\n"))
+	if end < 0 {
+		if len(c.buf) > maxHeaderBlock {
+			return len(b), c.flush(c.buf)
+		}
+		return len(b), nil
+	}
+	out := c.buf
+	if block, ok := reorderHeaderBlock(c.buf[:end+2]); ok {
+		out = append(block, c.buf[end+2:]...)
+	}
+	return len(b), c.flush(out)
+}
+
+// flush 发送数据并结束缓存
+func (c *headerOrderConn) flush(out []byte) error {
+	c.buf = c.buf[:0]
+	c.pending = false
+	_, err := c.Conn.Write(out)
+	return err
+}
+
+// looksLikeRequestLine 判断数据是否以HTTP请求方法开头
+func looksLikeRequestLine(b []byte) bool {
+	i := bytes.IndexByte(b, ' ')
+	if i <= 0 || i > 16 {
+		return false
+	}
+	for _, ch := range b[:i] {
+		if ch < 'A' || ch > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// reorderHeaderBlock 按内部请求头改写请求头块(包含请求行，以\r\n结尾)，没有内部请求头时返回false
+func reorderHeaderBlock(block []byte) ([]byte, bool) {
+	lines := strings.Split(strings.TrimSuffix(string(block), "\r\n"), "\r\n")
+	var order []string
+	kept := []string{lines[0]}
+	for _, line := range lines[1:] {
+		name, value, _ := strings.Cut(line, ":")
+		if strings.EqualFold(name, headerOrderKey) {
+			for _, name := range strings.Split(value, ",") {
+				if name = strings.TrimSpace(name); name != "" {
+					order = append(order, name)
+				}
+			}
+			continue
+		}
+		kept = append(kept, line)
+	}
+	if order == nil {
+		return nil, false
+	}
+
+	index := make(map[string]int, len(order))
+	for i, name := range order {
+		index[strings.ToLower(name)] = i
+	}
+	ordered := make([][]string, len(order))
+	var rest []string
+	for _, line := range kept[1:] {
+		name, value, _ := strings.Cut(line, ":")
+		if i, ok := index[strings.ToLower(name)]; ok {
+			ordered[i] = append(ordered[i], order[i]+":"+value)
+		} else {
+			rest = append(rest, line)
+		}
+	}
+	var out strings.Builder
+	out.WriteString(kept[0])
+	out.WriteString("\r\n")
+	for _, group := range ordered {
+		for _, line := range group {
+			out.WriteString(line)
+			out.WriteString("\r\n")
+		}
+	}
+	for _, line := range rest {
+		out.WriteString(line)
+		out.WriteString("\r\n")
+	}
+	return []byte(out.String()), true
+}
+
+// headerOrderTLSConn 包装TLS连接的headerOrderConn
+type headerOrderTLSConn struct {
+	*headerOrderConn
+	state tlsConn
+}
+
+func (c *headerOrderTLSConn) ConnectionState() tls.ConnectionState {
+	return c.state.ConnectionState()
+}
@@ -0,0 +1,149 @@
+package goproxy
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newTestRawServer 启动一个记录原始请求头块的HTTP服务
+func newTestRawServer(t *testing.T) (string, <-chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	blocks := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				br := bufio.NewReader(conn)
+				for {
+					var block strings.Builder
+					for {
+						line, err := br.ReadString('\n')
+						if err != nil {
+							return
+						}
+						if line == "\r\n" {
+							break
+						}
+						block.WriteString(line)
+					}
+					blocks <- block.String()
+					io.WriteString(conn, "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok")
+				}
+			}()
+		}
+	}()
+	return "http://" + ln.Addr().String(), blocks
+}
+
+// headerNames 返回请求头块中的请求头名称
+func headerNames(block string) []string {
+	var names []string
+	for _, line := range strings.Split(strings.TrimSpace(block), "\r\n")[1:] {
+		name, _, _ := strings.Cut(line, ":")
+		names = append(names, name)
+	}
+	return names
+}
+
+func TestGoProxy_SetHeaderOrder(t *testing.T) {
+	url, blocks := newTestRawServer(t)
+	c := New()
+	newReq := func() *http.Request {
+		req, _ := http.NewRequest(http.MethodGet, url, nil)
+		req.Header.Set("Accept", "*/*")
+		req.Header.Set("Sec-Ch-Ua", `"Chromium";v="133"`)
+		return req
+	}
+
+	c.SetHeaderOrder("sec-ch-ua", "User-Agent", "Host", "accept")
+	resp, err := c.GetClient().Do(newReq())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	got := headerNames(<-blocks)
+	want := []string{"sec-ch-ua", "User-Agent", "Host", "accept", "Accept-Encoding"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("请求头顺序为%v，期望%v", got, want)
+	}
+
+	// 单次请求的顺序优先，连接复用时同样生效
+	resp, err = c.Do(newReq(), WithHeaderOrder("ACCEPT", "Host"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	got = headerNames(<-blocks)
+	if len(got) < 2 || got[0] != "ACCEPT" || got[1] != "Host" {
+		t.Errorf("单次请求的请求头顺序为%v", got)
+	}
+
+	c.SetHeaderOrder()
+	if c.GetHeaderOrder() != nil {
+		t.Error("清空后应返回nil")
+	}
+	resp, err = c.GetClient().Do(newReq())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if block := <-blocks; strings.Contains(block, headerOrderKey) || !strings.Contains(block, "Sec-Ch-Ua:") {
+		t.Errorf("默认请求头块: %q", block)
+	}
+}
+
+func TestGoProxy_SetHeaderOrderHTTP2(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(headerOrderKey) != "" {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+		io.WriteString(w, r.Proto)
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	c := New()
+	c.EnableHTTP2(true)
+	c.SetHeaderOrder("User-Agent")
+	if got := getBody(t, c, srv.URL); got != "HTTP/1.1" {
+		t.Errorf("设置请求头顺序后应使用HTTP/1.1，实际为%s", got)
+	}
+	c.SetHeaderOrder()
+	if got := getBody(t, c, srv.URL); got != "HTTP/2.0" {
+		t.Errorf("清空后应恢复HTTP/2，实际为%s", got)
+	}
+}
+
+func TestReorderHeaderBlock(t *testing.T) {
+	block := []byte("GET / HTTP/1.1\r\nB: 1\r\nA: 2\r\nX-Goproxy-Header-Order: a, c\r\nC: 3\r\nB: 4\r\n")
+	out, ok := reorderHeaderBlock(block)
+	if !ok {
+		t.Fatal("应识别内部请求头")
+	}
+	want := "GET / HTTP/1.1\r\na: 2\r\nc: 3\r\nB: 1\r\nB: 4\r\n"
+	if string(out) != want {
+		t.Errorf("改写结果为%q", out)
+	}
+	if _, ok := reorderHeaderBlock([]byte("GET / HTTP/1.1\r\nA: 1\r\n")); ok {
+		t.Error("没有内部请求头时不应改写")
+	}
+	if !looksLikeRequestLine([]byte("GET / HTTP/1.1")) || looksLikeRequestLine(bytes.Repeat([]byte("a"), 10)) {
+		t.Error("请求行识别错误")
+	}
+}
@@ -0,0 +1,151 @@
+package goproxy
+
+import (
+	"net/http"
+	"slices"
+)
+
+// HeaderPrecedence 自定义请求头(全局、按主机设置和轮换的User-Agent)与请求本身的同名请求头冲突时的处理方式
+type HeaderPrecedence uint8
+
+const (
+	// RequestFirst 请求本身优先: 单值请求头保留请求的值，多值请求头在请求的值之后追加自定义的值
+	RequestFirst HeaderPrecedence = iota
+	// CustomFirst 自定义请求头优先: 替换请求本身的同名请求头
+	CustomFirst
+)
+
+// HeaderPolicy 合并自定义请求头的规则
+// 各来源之间的优先级固定为: 按主机设置的请求头 > 轮换的User-Agent > 全局请求头
+type HeaderPolicy struct {
+	// SingleValue 只能有单个值的请求头，自定义的值只使用第一个，已有值时不再追加；为nil时使用DefaultSingleValueHeaders
+	SingleValue []string
+	// Precedence 与请求本身的同名请求头冲突时的处理方式
+	Precedence HeaderPrecedence
+}
+
+// DefaultSingleValueHeaders 返回默认的单值请求头列表
+func DefaultSingleValueHeaders() []string {
+	return []string{
+		"Authorization",
+		"Content-Type",
+		"Content-Length",
+		"Content-Encoding",
+		"Host",
+		"User-Agent",
+		"If-Match",
+		"If-None-Match",
+		"If-Modified-Since",
+		"If-Range",
+		"Range",
+	}
+}
+
+// SetHeaderPolicy 设置合并自定义请求头的规则
+// 参数:
+//   - p: 合并规则，调用后修改p不影响已设置的规则；为nil时恢复默认规则(默认单值请求头，请求本身优先)
+func (r *GoProxy) SetHeaderPolicy(p *HeaderPolicy) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if p == nil {
+		r.transport.headerPolicy.Store(nil)
+		return
+	}
+	r.transport.headerPolicy.Store(newHeaderPolicy(p.SingleValue, p.Precedence))
+}
+
+// GetHeaderPolicy 返回当前的请求头合并规则
+func (r *GoProxy) GetHeaderPolicy() *HeaderPolicy {
+	hp := r.transport.headerPolicy.Load()
+	if hp == nil {
+		hp = defaultHeaderPolicy
+	}
+	p := &HeaderPolicy{Precedence: hp.precedence}
+	for key := range hp.single {
+		p.SingleValue = append(p.SingleValue, key)
+	}
+	slices.Sort(p.SingleValue)
+	return p
+}
+
+// headerPolicy 规范化请求头名称后的HeaderPolicy
+type headerPolicy struct {
+	single     map[string]bool
+	precedence HeaderPrecedence
+}
+
+// defaultHeaderPolicy 未设置SetHeaderPolicy时使用的规则
+var defaultHeaderPolicy = newHeaderPolicy(nil, RequestFirst)
+
+// newHeaderPolicy 创建合并规则，single为nil时使用默认的单值请求头
+func newHeaderPolicy(single []string, precedence HeaderPrecedence) *headerPolicy {
+	if single == nil {
+		single = DefaultSingleValueHeaders()
+	}
+	p := &headerPolicy{single: make(map[string]bool, len(single)), precedence: precedence}
+	for _, key := range single {
+		p.single[http.CanonicalHeaderKey(key)] = true
+	}
+	return p
+}
+
+// headerMerge 将各来源的自定义请求头依次合并到一个请求中
+type headerMerge struct {
+	policy *headerPolicy
+	own    map[string]bool     // 请求本身带有的请求头
+	expand func(string) string // 替换模板变量，为nil时不替换
+}
+
+// newHeaderMerge 为req创建合并过程，需在合并任何自定义请求头之前调用
+func (c *CustomTransport) newHeaderMerge(req *http.Request) *headerMerge {
+	p := c.headerPolicy.Load()
+	if p == nil {
+		p = defaultHeaderPolicy
+	}
+	own := make(map[string]bool, len(req.Header))
+	for key := range req.Header {
+		own[key] = true
+	}
+	return &headerMerge{policy: p, own: own, expand: c.headerExpander(req)}
+}
+
+// applies 判断名为key的自定义请求头合并到dst时是否会生效(而不是被已有的值忽略)
+func (m *headerMerge) applies(dst http.Header, key string) bool {
+	if _, ok := dst[key]; !ok || !m.policy.single[key] {
+		return true
+	}
+	return m.own[key] && m.policy.precedence == CustomFirst
+}
+
+// merge 将自定义请求头h合并到请求头dst中，优先级高的来源应先合并；fw不为nil时跳过跨源重定向不转发的请求头
+func (m *headerMerge) merge(dst, h http.Header, fw *redirectForwarding) {
+	for key, values := range h {
+		if fw != nil && !fw.forwards(key) || len(values) == 0 {
+			continue
+		}
+		if m.own[key] && m.policy.precedence == CustomFirst {
+			// 替换请求本身的值，此后视为自定义的值，优先级更低的来源不再替换
+			dst.Del(key)
+			delete(m.own, key)
+		}
+		if m.policy.single[key] {
+			// 已有的值优先级更高
+			if _, ok := dst[key]; !ok {
+				dst.Set(key, m.value(values[0]))
+			}
+			continue
+		}
+		// 多值请求头追加
+		for _, value := range values {
+			dst.Add(key, m.value(value))
+		}
+	}
+}
+
+// value 替换value中的模板变量
+func (m *headerMerge) value(value string) string {
+	if m.expand != nil {
+		return m.expand(value)
+	}
+	return value
+}
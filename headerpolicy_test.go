@@ -0,0 +1,50 @@
+package goproxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGoProxy_SetHeaderPolicy(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, key := range []string{"User-Agent", "Accept", "X-Tag"} {
+			w.Write([]byte(strings.Join(r.Header.Values(key), ",") + "|"))
+		}
+	}))
+	defer srv.Close()
+	c := New()
+	c.SetGlobalHeader("User-Agent", "global-ua")
+	c.SetGlobalHeader("Accept", "text/html")
+	c.AddGlobalHeader("X-Tag", "a")
+	c.AddGlobalHeader("X-Tag", "b")
+	get := func() string {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+		req.Header.Set("User-Agent", "req-ua")
+		req.Header.Set("Accept", "application/json")
+		return doBody(t, c, req)
+	}
+
+	if got := get(); got != "req-ua|application/json,text/html|a,b|" {
+		t.Errorf("默认规则的响应为%q", got)
+	}
+	c.SetHeaderPolicy(&HeaderPolicy{SingleValue: []string{"user-agent", "accept", "x-tag"}})
+	if got := get(); got != "req-ua|application/json|a|" {
+		t.Errorf("自定义单值请求头的响应为%q", got)
+	}
+	c.SetHeaderPolicy(&HeaderPolicy{Precedence: CustomFirst})
+	if got := get(); got != "global-ua|text/html|a,b|" {
+		t.Errorf("自定义请求头优先的响应为%q", got)
+	}
+	// 按主机设置的请求头仍优先于全局请求头
+	c.AddHostHeaders(mustParseURL(t, srv.URL).Hostname(), http.Header{"User-Agent": {"host-ua"}})
+	if got := get(); got != "host-ua|text/html|a,b|" {
+		t.Errorf("按主机设置时的响应为%q", got)
+	}
+	c.SetHeaderPolicy(nil)
+	if p := c.GetHeaderPolicy(); p.Precedence != RequestFirst || len(p.SingleValue) != len(DefaultSingleValueHeaders()) {
+		t.Errorf("恢复默认后的规则为%+v", p)
+	}
+}
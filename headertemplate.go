@@ -0,0 +1,123 @@
+package goproxy
+
+import (
+	"crypto/rand"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HeaderVarFunc 返回请求头模板中变量的值，req为正在发送的请求
+type HeaderVarFunc func(req *http.Request) string
+
+// builtinHeaderVars 内置的模板变量
+var builtinHeaderVars = map[string]HeaderVarFunc{
+	"now_rfc1123": func(*http.Request) string { return time.Now().UTC().Format(http.TimeFormat) },
+	"now_rfc3339": func(*http.Request) string { return time.Now().UTC().Format(time.RFC3339) },
+	"now_unix":    func(*http.Request) string { return strconv.FormatInt(time.Now().Unix(), 10) },
+	"now_unix_ms": func(*http.Request) string { return strconv.FormatInt(time.Now().UnixMilli(), 10) },
+	"uuid":        func(*http.Request) string { return newUUID() },
+	"host":        func(req *http.Request) string { return req.URL.Host },
+	"method":      func(req *http.Request) string { return req.Method },
+}
+
+// SetHeaderTemplates 设置是否在发送时替换全局请求头和按主机设置的请求头中的模板变量，默认不替换
+// 变量写作"{{name}}"，每个请求单独求值，请求本身带有的请求头不替换。内置变量:
+//   - now_rfc1123、now_rfc3339: 当前时间，如Date请求头使用的格式
+//   - now_unix、now_unix_ms: 当前的Unix时间戳(秒、毫秒)
+//   - uuid: 随机的UUID v4
+//   - host、method: 请求的主机(含端口)和方法
+//   - env:NAME: 环境变量NAME的值，如"Bearer {{env:TOKEN}}"
+//
+// 未知的变量保持原样
+func (r *GoProxy) SetHeaderTemplates(enabled bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.transport.headerTemplates.Store(enabled)
+}
+
+// RegisterHeaderVar 注册自定义的模板变量，与内置变量同名时覆盖内置变量，fn为nil时删除
+// 参数:
+//   - name: 变量名，在请求头中写作"{{name}}"
+//   - fn: 返回变量值的函数，可能被并发调用
+func (r *GoProxy) RegisterHeaderVar(name string, fn HeaderVarFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ct := r.transport
+	vars := make(map[string]HeaderVarFunc)
+	if p := ct.headerVars.Load(); p != nil {
+		vars = maps.Clone(*p)
+	}
+	if fn == nil {
+		delete(vars, name)
+	} else {
+		vars[name] = fn
+	}
+	ct.headerVars.Store(&vars)
+}
+
+// headerExpander 返回替换请求头模板变量的函数，未开启模板时返回nil
+func (c *CustomTransport) headerExpander(req *http.Request) func(string) string {
+	if !c.headerTemplates.Load() {
+		return nil
+	}
+	var vars map[string]HeaderVarFunc
+	if p := c.headerVars.Load(); p != nil {
+		vars = *p
+	}
+	return func(value string) string {
+		return expandHeaderTemplate(value, func(name string) (string, bool) {
+			if fn, ok := vars[name]; ok {
+				return fn(req), true
+			}
+			if env, ok := strings.CutPrefix(name, "env:"); ok {
+				return os.Getenv(env), true
+			}
+			if fn, ok := builtinHeaderVars[name]; ok {
+				return fn(req), true
+			}
+			return "", false
+		})
+	}
+}
+
+// expandHeaderTemplate 替换value中的"{{name}}"，lookup返回false的变量保持原样
+func expandHeaderTemplate(value string, lookup func(name string) (string, bool)) string {
+	if !strings.Contains(value, "{{") {
+		return value
+	}
+	var b strings.Builder
+	for {
+		start := strings.Index(value, "{{")
+		if start < 0 {
+			break
+		}
+		end := strings.Index(value[start+2:], "}}")
+		if end < 0 {
+			break
+		}
+		end += start + 2
+		b.WriteString(value[:start])
+		if v, ok := lookup(strings.TrimSpace(value[start+2 : end])); ok {
+			b.WriteString(v)
+		} else {
+			b.WriteString(value[start : end+2])
+		}
+		value = value[end+2:]
+	}
+	b.WriteString(value)
+	return b.String()
+}
+
+// newUUID 生成随机的UUID v4
+func newUUID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
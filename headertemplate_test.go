@@ -0,0 +1,46 @@
+package goproxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestGoProxy_SetHeaderTemplates(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, key := range []string{"X-Request-Id", "Authorization", "X-Date", "X-Custom", "X-Literal"} {
+			io.WriteString(w, r.Header.Get(key)+"\n")
+		}
+	}))
+	defer srv.Close()
+	t.Setenv("GOPROXY_TEST_TOKEN", "secret")
+
+	c := New()
+	c.SetGlobalHeader("X-Request-Id", "{{uuid}}")
+	c.SetGlobalHeader("Authorization", "Bearer {{env:GOPROXY_TEST_TOKEN}}")
+	c.SetGlobalHeader("X-Date", "{{ now_rfc1123 }}")
+	c.SetGlobalHeader("X-Custom", "{{tenant}}-{{method}}")
+	c.SetGlobalHeader("X-Literal", "{{unknown}} {{")
+	c.RegisterHeaderVar("tenant", func(*http.Request) string { return "t1" })
+
+	if got := getBody(t, c, srv.URL); !strings.HasPrefix(got, "{{uuid}}\n") {
+		t.Errorf("未开启模板时响应为%q", got)
+	}
+	c.SetHeaderTemplates(true)
+	a := strings.Split(getBody(t, c, srv.URL), "\n")
+	b := strings.Split(getBody(t, c, srv.URL), "\n")
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	if !uuid.MatchString(a[0]) || a[0] == b[0] {
+		t.Errorf("uuid为%q和%q", a[0], b[0])
+	}
+	if a[1] != "Bearer secret" || !strings.HasSuffix(a[2], " GMT") || a[3] != "t1-GET" || a[4] != "{{unknown}} {{" {
+		t.Errorf("响应为%q", a)
+	}
+	// 全局请求头本身保持模板
+	if got := c.GetGlobalHeaders().Get("X-Request-Id"); got != "{{uuid}}" {
+		t.Errorf("全局请求头被修改为%q", got)
+	}
+}
@@ -0,0 +1,74 @@
+package goproxy
+
+import (
+	"maps"
+	"net/http"
+)
+
+// AddHostHeaders 添加只发往匹配主机的请求头，用于API密钥、租户标识等不应发给其他主机的请求头
+// 同一主机有多条规则匹配时只使用精确匹配或最长的通配符规则；重复添加同一规则时合并请求头。
+// 单值请求头(如Authorization)优先于全局请求头，请求本身带有的请求头优先级最高；跨源重定向时按新地址的主机重新匹配
+// 参数:
+//   - pattern: 主机名，支持"*.example.com"形式的通配符(不匹配example.com本身)
+//   - h: 请求头，调用后修改h不影响已添加的规则
+func (r *GoProxy) AddHostHeaders(pattern string, h http.Header) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ct := r.transport
+	rules := maps.Clone(ct.hostHeaderRules())
+	if rules == nil {
+		rules = make(map[string]http.Header)
+	}
+	pattern = normalizeHost(pattern)
+	merged := rules[pattern].Clone()
+	if merged == nil {
+		merged = make(http.Header)
+	}
+	for key, values := range h {
+		for _, value := range values {
+			merged.Add(key, value)
+		}
+	}
+	rules[pattern] = merged
+	ct.hostHeaders.Store(&rules)
+}
+
+// DelHostHeaders 删除AddHostHeaders添加的规则
+// 参数:
+//   - pattern: 添加规则时使用的主机名
+//   - keys: 要删除的请求头，为空时删除整条规则
+func (r *GoProxy) DelHostHeaders(pattern string, keys ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ct := r.transport
+	pattern = normalizeHost(pattern)
+	rules := maps.Clone(ct.hostHeaderRules())
+	if _, ok := rules[pattern]; !ok {
+		return
+	}
+	if len(keys) > 0 {
+		h := rules[pattern].Clone()
+		for _, key := range keys {
+			h.Del(key)
+		}
+		rules[pattern] = h
+	}
+	if len(keys) == 0 || len(rules[pattern]) == 0 {
+		delete(rules, pattern)
+	}
+	ct.hostHeaders.Store(&rules)
+}
+
+// GetHostHeaders 返回host实际会使用的按主机设置的请求头，没有匹配的规则时返回nil
+func (r *GoProxy) GetHostHeaders(host string) http.Header {
+	h, _ := lookupHost(r.transport.hostHeaderRules(), host)
+	return h.Clone()
+}
+
+// hostHeaderRules 返回按主机设置的请求头，返回的map不可修改
+func (c *CustomTransport) hostHeaderRules() map[string]http.Header {
+	if p := c.hostHeaders.Load(); p != nil {
+		return *p
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package goproxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestGoProxy_AddHostHeaders(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if to := r.URL.Query().Get("to"); to != "" {
+			http.Redirect(w, r, to, http.StatusFound)
+			return
+		}
+		io.WriteString(w, r.Header.Get("X-Api-Key")+"|"+r.Header.Get("User-Agent"))
+	}))
+	defer srv.Close()
+	port := mustParseURL(t, srv.URL).Port()
+	c := New()
+	for _, host := range []string{"api.example.com", "a.b.example.com", "other.test"} {
+		c.SetHostOverride(host, "127.0.0.1")
+	}
+	c.AddHostHeaders("*.example.com", http.Header{"X-Api-Key": {"wildcard"}})
+	c.AddHostHeaders("API.example.com", http.Header{"X-Api-Key": {"exact"}, "User-Agent": {"host-ua"}})
+	get := func(host, path string) string {
+		t.Helper()
+		return getBody(t, c, "http://"+host+":"+port+path)
+	}
+
+	if got := get("api.example.com", "/"); got != "exact|host-ua" {
+		t.Errorf("精确匹配的响应为%q", got)
+	}
+	if got := get("a.b.example.com", "/"); got != "wildcard|"+DefaultUA {
+		t.Errorf("通配符匹配的响应为%q", got)
+	}
+	if got := get("other.test", "/"); got != "|"+DefaultUA {
+		t.Errorf("不匹配的主机的响应为%q", got)
+	}
+	// 跨源重定向时按新主机匹配，不把原主机的请求头带过去
+	c.SetMaxRedirects(1)
+	to := url.QueryEscape("http://other.test:" + port + "/")
+	if got := get("api.example.com", "/?to="+to); got != "|"+DefaultUA {
+		t.Errorf("重定向后的响应为%q", got)
+	}
+	// 请求本身的请求头优先
+	req, _ := http.NewRequest(http.MethodGet, "http://api.example.com:"+port+"/", nil)
+	req.Header.Set("User-Agent", "req-ua")
+	if got := doBody(t, c, req); got != "exact|req-ua" {
+		t.Errorf("请求本身带有User-Agent时响应为%q", got)
+	}
+
+	c.DelHostHeaders("api.example.com", "User-Agent")
+	if h := c.GetHostHeaders("api.example.com"); h.Get("User-Agent") != "" || h.Get("X-Api-Key") != "exact" {
+		t.Errorf("删除User-Agent后规则为%v", h)
+	}
+	c.DelHostHeaders("api.example.com")
+	if got := get("api.example.com", "/"); got != "wildcard|"+DefaultUA {
+		t.Errorf("删除精确规则后响应为%q", got)
+	}
+}
@@ -0,0 +1,365 @@
+// Package htmldoc 将HTML响应解析为可以用CSS选择器查询的文档，类似goquery
+// 响应体按Content-Type、BOM和<meta charset>自动转换为UTF-8后再解析，抓取代码无需每次自行处理编码:
+//
+//	resp, err := c.Do(req)
+//	if err != nil { ... }
+//	doc, err := htmldoc.FromResponse(resp)
+//	if err != nil { ... }
+//	doc.Find("article h2 > a").Each(func(i int, s *htmldoc.Selection) {
+//		fmt.Println(s.Text(), doc.AbsURL(s.AttrOr("href", "")))
+//	})
+package htmldoc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+)
+
+// Document 解析后的HTML文档，嵌入的Selection只包含文档根节点
+type Document struct {
+	*Selection
+	// URL 文档的地址，用于AbsURL解析相对链接；有<base href>时为其指向的地址，未知时为nil
+	URL *url.URL
+	// Charset 解码前响应体的编码，如"utf-8"、"gbk"
+	Charset string
+}
+
+// Parse 解析UTF-8编码的HTML
+func Parse(r io.Reader) (*Document, error) {
+	root, err := html.Parse(r)
+	if err != nil {
+		return nil, fmt.Errorf("htmldoc: 解析HTML失败: %w", err)
+	}
+	return newDocument(root, nil, "utf-8"), nil
+}
+
+// ParseWithCharset 按contentType中的charset、BOM或<meta charset>确定编码，转换为UTF-8后解析HTML，
+// 都没有时按内容猜测，默认为windows-1252
+// 参数:
+//   - r: HTML内容
+//   - contentType: Content-Type响应头，可以为空
+func ParseWithCharset(r io.Reader, contentType string) (*Document, error) {
+	// 读取开头的部分确定编码，与charset.NewReader相同
+	peek := make([]byte, 1024)
+	n, err := io.ReadFull(r, peek)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, fmt.Errorf("htmldoc: 读取HTML失败: %w", err)
+	}
+	peek = peek[:n]
+	enc, name, _ := charset.DetermineEncoding(peek, contentType)
+	body := io.MultiReader(bytes.NewReader(peek), r)
+	root, err := html.Parse(enc.NewDecoder().Reader(body))
+	if err != nil {
+		return nil, fmt.Errorf("htmldoc: 解析HTML失败: %w", err)
+	}
+	return newDocument(root, nil, name), nil
+}
+
+// FromResponse 读取并关闭resp的响应体，按响应的编码解析为文档，文档的URL为响应对应的请求地址(跟随重定向后的最终地址)。
+// 响应的Content-Type不是HTML或XHTML时返回错误，没有Content-Type时按HTML解析
+func FromResponse(resp *http.Response) (*Document, error) {
+	if resp == nil || resp.Body == nil {
+		return nil, errors.New("htmldoc: 响应为空")
+	}
+	defer resp.Body.Close()
+	ct := resp.Header.Get("Content-Type")
+	if mediaType, _, _ := strings.Cut(strings.ToLower(ct), ";"); ct != "" {
+		switch strings.TrimSpace(mediaType) {
+		case "text/html", "application/xhtml+xml":
+		default:
+			return nil, fmt.Errorf("htmldoc: 响应不是HTML: %s", ct)
+		}
+	}
+	doc, err := ParseWithCharset(resp.Body, ct)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Request != nil {
+		doc.URL = doc.baseURL(resp.Request.URL)
+	}
+	return doc, nil
+}
+
+// newDocument 以root创建文档
+func newDocument(root *html.Node, u *url.URL, charsetName string) *Document {
+	doc := &Document{URL: u, Charset: charsetName}
+	doc.Selection = &Selection{Nodes: []*html.Node{root}, doc: doc}
+	return doc
+}
+
+// baseURL 按文档中的<base href>解析u
+func (d *Document) baseURL(u *url.URL) *url.URL {
+	if href, ok := d.Find("base[href]").Attr("href"); ok {
+		if base, err := u.Parse(strings.TrimSpace(href)); err == nil {
+			return base
+		}
+	}
+	return u
+}
+
+// Title 返回<title>的文本，去掉首尾空白
+func (d *Document) Title() string {
+	return strings.TrimSpace(d.Find("title").First().Text())
+}
+
+// AbsURL 将文档中的链接(如href、src属性的值)解析为绝对地址，文档的URL未知或ref无效时原样返回
+func (d *Document) AbsURL(ref string) string {
+	ref = strings.TrimSpace(ref)
+	if d.URL == nil || ref == "" {
+		return ref
+	}
+	u, err := d.URL.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return u.String()
+}
+
+// Links 按出现顺序返回文档中所有<a href>指向的绝对地址，去掉重复、空链接、锚点和javascript:链接
+func (d *Document) Links() []string {
+	var links []string
+	seen := make(map[string]bool)
+	d.Find("a[href]").Each(func(_ int, s *Selection) {
+		href := strings.TrimSpace(s.AttrOr("href", ""))
+		if href == "" || strings.HasPrefix(href, "#") || strings.HasPrefix(strings.ToLower(href), "javascript:") {
+			return
+		}
+		abs := d.AbsURL(href)
+		if !seen[abs] {
+			seen[abs] = true
+			links = append(links, abs)
+		}
+	})
+	return links
+}
+
+// Selection 一组元素，查询方法返回新的Selection，不修改原有的Selection
+type Selection struct {
+	Nodes []*html.Node
+	doc   *Document
+}
+
+// newSelection 创建同一文档中的Selection
+func (s *Selection) newSelection(nodes []*html.Node) *Selection {
+	return &Selection{Nodes: nodes, doc: s.doc}
+}
+
+// Document 返回Selection所属的文档
+func (s *Selection) Document() *Document {
+	return s.doc
+}
+
+// Find 返回各元素的后代中匹配选择器的元素，按文档顺序排列且不重复。
+// 选择器的语法见Selector，选择器无效时返回空的Selection，需要区分时先用Compile检查
+func (s *Selection) Find(selector string) *Selection {
+	sel, err := Compile(selector)
+	if err != nil {
+		return s.newSelection(nil)
+	}
+	return s.FindSelector(sel)
+}
+
+// FindSelector 与Find相同，使用编译好的选择器
+func (s *Selection) FindSelector(sel *Selector) *Selection {
+	var nodes []*html.Node
+	seen := make(map[*html.Node]bool)
+	for _, n := range s.Nodes {
+		for c := range n.Descendants() {
+			if !seen[c] && sel.Match(c) {
+				seen[c] = true
+				nodes = append(nodes, c)
+			}
+		}
+	}
+	return s.newSelection(nodes)
+}
+
+// Filter 返回匹配选择器的元素
+func (s *Selection) Filter(selector string) *Selection {
+	sel, err := Compile(selector)
+	if err != nil {
+		return s.newSelection(nil)
+	}
+	var nodes []*html.Node
+	for _, n := range s.Nodes {
+		if sel.Match(n) {
+			nodes = append(nodes, n)
+		}
+	}
+	return s.newSelection(nodes)
+}
+
+// Is 判断是否有元素匹配选择器
+func (s *Selection) Is(selector string) bool {
+	return s.Filter(selector).Len() > 0
+}
+
+// Children 返回各元素的子元素
+func (s *Selection) Children() *Selection {
+	var nodes []*html.Node
+	for _, n := range s.Nodes {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type == html.ElementNode {
+				nodes = append(nodes, c)
+			}
+		}
+	}
+	return s.newSelection(nodes)
+}
+
+// Parent 返回各元素的父元素，去掉重复
+func (s *Selection) Parent() *Selection {
+	var nodes []*html.Node
+	seen := make(map[*html.Node]bool)
+	for _, n := range s.Nodes {
+		if p := n.Parent; p != nil && p.Type == html.ElementNode && !seen[p] {
+			seen[p] = true
+			nodes = append(nodes, p)
+		}
+	}
+	return s.newSelection(nodes)
+}
+
+// Closest 返回各元素自身或最近的匹配选择器的祖先元素，去掉重复
+func (s *Selection) Closest(selector string) *Selection {
+	sel, err := Compile(selector)
+	if err != nil {
+		return s.newSelection(nil)
+	}
+	var nodes []*html.Node
+	seen := make(map[*html.Node]bool)
+	for _, n := range s.Nodes {
+		for p := n; p != nil; p = p.Parent {
+			if sel.Match(p) {
+				if !seen[p] {
+					seen[p] = true
+					nodes = append(nodes, p)
+				}
+				break
+			}
+		}
+	}
+	return s.newSelection(nodes)
+}
+
+// Len 返回元素的个数
+func (s *Selection) Len() int {
+	return len(s.Nodes)
+}
+
+// Eq 返回第i个元素，i为负数时从末尾计数，越界时返回空的Selection
+func (s *Selection) Eq(i int) *Selection {
+	if i < 0 {
+		i += len(s.Nodes)
+	}
+	if i < 0 || i >= len(s.Nodes) {
+		return s.newSelection(nil)
+	}
+	return s.newSelection(s.Nodes[i : i+1])
+}
+
+// First 返回第一个元素
+func (s *Selection) First() *Selection {
+	return s.Eq(0)
+}
+
+// Last 返回最后一个元素
+func (s *Selection) Last() *Selection {
+	return s.Eq(-1)
+}
+
+// Each 对每个元素调用fn
+func (s *Selection) Each(fn func(i int, s *Selection)) *Selection {
+	for i := range s.Nodes {
+		fn(i, s.Eq(i))
+	}
+	return s
+}
+
+// Map 对每个元素调用fn，返回结果列表
+func (s *Selection) Map(fn func(i int, s *Selection) string) []string {
+	result := make([]string, len(s.Nodes))
+	for i := range s.Nodes {
+		result[i] = fn(i, s.Eq(i))
+	}
+	return result
+}
+
+// Text 返回所有元素及其后代的文本，按文档顺序拼接，不包括<script>和<style>的内容
+func (s *Selection) Text() string {
+	var sb strings.Builder
+	for _, n := range s.Nodes {
+		writeText(&sb, n)
+	}
+	return sb.String()
+}
+
+// Attr 返回第一个元素的属性值
+func (s *Selection) Attr(name string) (string, bool) {
+	if len(s.Nodes) == 0 {
+		return "", false
+	}
+	return attr(s.Nodes[0], strings.ToLower(name))
+}
+
+// AttrOr 返回第一个元素的属性值，没有该属性时返回def
+func (s *Selection) AttrOr(name, def string) string {
+	if v, ok := s.Attr(name); ok {
+		return v
+	}
+	return def
+}
+
+// HTML 返回第一个元素的内部HTML
+func (s *Selection) HTML() (string, error) {
+	if len(s.Nodes) == 0 {
+		return "", nil
+	}
+	var buf bytes.Buffer
+	for c := s.Nodes[0].FirstChild; c != nil; c = c.NextSibling {
+		if err := html.Render(&buf, c); err != nil {
+			return "", err
+		}
+	}
+	return buf.String(), nil
+}
+
+// OuterHTML 返回第一个元素本身的HTML
+func (s *Selection) OuterHTML() (string, error) {
+	if len(s.Nodes) == 0 {
+		return "", nil
+	}
+	var buf bytes.Buffer
+	if err := html.Render(&buf, s.Nodes[0]); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// nodeText 返回n及其后代的文本
+func nodeText(n *html.Node) string {
+	var sb strings.Builder
+	writeText(&sb, n)
+	return sb.String()
+}
+
+func writeText(sb *strings.Builder, n *html.Node) {
+	switch {
+	case n.Type == html.TextNode:
+		sb.WriteString(n.Data)
+		return
+	case n.Type == html.ElementNode && (n.Data == "script" || n.Data == "style"):
+		return
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		writeText(sb, c)
+	}
+}
@@ -0,0 +1,110 @@
+package htmldoc
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+func gbk(t *testing.T, s string) string {
+	b, err := simplifiedchinese.GBK.NewEncoder().String(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func newResponse(contentType, body, rawURL string) *http.Response {
+	u, _ := url.Parse(rawURL)
+	return &http.Response{
+		StatusCode: 200,
+		Header:     http.Header{"Content-Type": {contentType}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    &http.Request{URL: u},
+	}
+}
+
+func TestFromResponseCharset(t *testing.T) {
+	page := `<html><head><meta charset="gbk"><title> 中文标题 </title></head><body><p>你好</p></body></html>`
+	cases := []struct {
+		name, contentType, body string
+	}{
+		{"meta", "text/html", gbk(t, page)},
+		{"header", "text/html; charset=GBK", gbk(t, strings.Replace(page, `<meta charset="gbk">`, "", 1))},
+		{"utf8", "text/html; charset=utf-8", strings.Replace(page, "gbk", "utf-8", 1)},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			doc, err := FromResponse(newResponse(tc.contentType, tc.body, "https://example.com/"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := doc.Title(); got != "中文标题" {
+				t.Errorf("Title() = %q", got)
+			}
+			if got := doc.Find("p").Text(); got != "你好" {
+				t.Errorf("p = %q", got)
+			}
+		})
+	}
+}
+
+func TestFromResponseNotHTML(t *testing.T) {
+	if _, err := FromResponse(newResponse("application/json", `{}`, "https://example.com/")); err == nil {
+		t.Error("JSON response should be rejected")
+	}
+}
+
+func TestDocumentLinks(t *testing.T) {
+	page := `<html><head><base href="/docs/"></head><body>
+<a href="a.html">A</a><a href="#top">top</a><a href="javascript:void(0)">js</a>
+<a href="https://other.com/b">B</a><a href="a.html">A again</a>
+<img src="img/x.png"></body></html>`
+	doc, err := FromResponse(newResponse("text/html", page, "https://example.com/index/page"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"https://example.com/docs/a.html", "https://other.com/b"}
+	if got := doc.Links(); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("Links() = %v, want %v", got, want)
+	}
+	if got := doc.AbsURL(doc.Find("img").AttrOr("src", "")); got != "https://example.com/docs/img/x.png" {
+		t.Errorf("AbsURL = %q", got)
+	}
+}
+
+func TestSelection(t *testing.T) {
+	doc, err := Parse(strings.NewReader(testPage))
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := doc.Find("li")
+	if items.Len() != 4 || items.First().Text() != "一" || items.Last().Text() != "四" || items.Eq(-2).Text() != "三" {
+		t.Errorf("unexpected items: %v", items.Map(func(_ int, s *Selection) string { return s.Text() }))
+	}
+	if items.Eq(10).Len() != 0 {
+		t.Error("Eq out of range should be empty")
+	}
+	if got := items.Parent().Len(); got != 1 {
+		t.Errorf("Parent().Len() = %d", got)
+	}
+	if got := doc.Find("ul").Children().Filter(".active").Text(); got != "二" {
+		t.Errorf("Children().Filter() = %q", got)
+	}
+	if !doc.Find("a").First().Closest("div").Is("#main") {
+		t.Error("Closest(div) should be #main")
+	}
+	if got, _ := doc.Find("li.active").OuterHTML(); got != `<li class="item active">二</li>` {
+		t.Errorf("OuterHTML() = %q", got)
+	}
+	if got, _ := doc.Find("li").Last().HTML(); got != `<a href="/four" lang="zh-CN">四</a>` {
+		t.Errorf("HTML() = %q", got)
+	}
+	if doc.AbsURL("/x") != "/x" {
+		t.Error("AbsURL without document URL should return ref unchanged")
+	}
+}
@@ -0,0 +1,461 @@
+package htmldoc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Selector 编译后的CSS选择器，支持的语法:
+//   - 类型、通配符、ID和类: div、*、#main、.item、a.external
+//   - 属性: [href]、[type=text]、[class~=a]、[href^=https]、[src$=".png"]、[title*=foo]、[lang|=zh]
+//   - 伪类: :first-child、:last-child、:only-child、:nth-child(2)、:nth-child(odd)、:nth-child(2n+1)、
+//     :empty、:not(选择器)、:contains(文本)
+//   - 组合: 后代(空格)、子元素(>)、相邻兄弟(+)、后续兄弟(~)，以及用逗号分隔的多个选择器
+type Selector struct {
+	groups []complexSelector
+}
+
+// complexSelector 由组合符连接的复合选择器，parts[0]为最左边的部分
+type complexSelector struct {
+	parts []compound
+	// combinators[i]连接parts[i]和parts[i+1]
+	combinators []byte
+}
+
+// compound 作用于同一元素的简单选择器
+type compound struct {
+	tag     string // 小写的标签名，为空时匹配任意元素
+	filters []func(*html.Node) bool
+}
+
+// Compile 编译CSS选择器
+func Compile(sel string) (*Selector, error) {
+	p := &selectorParser{s: sel}
+	s, err := p.parseGroups()
+	if err != nil {
+		return nil, fmt.Errorf("htmldoc: 无效的选择器%q: %w", sel, err)
+	}
+	return s, nil
+}
+
+// MustCompile 与Compile相同，选择器无效时panic，用于固定的选择器
+func MustCompile(sel string) *Selector {
+	s, err := Compile(sel)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// Match 判断元素n是否匹配选择器
+func (s *Selector) Match(n *html.Node) bool {
+	if n == nil || n.Type != html.ElementNode {
+		return false
+	}
+	for i := range s.groups {
+		if s.groups[i].match(n, len(s.groups[i].parts)-1) {
+			return true
+		}
+	}
+	return false
+}
+
+// match 判断n是否匹配parts[:i+1]，从右向左匹配
+func (c *complexSelector) match(n *html.Node, i int) bool {
+	if !c.parts[i].match(n) {
+		return false
+	}
+	if i == 0 {
+		return true
+	}
+	switch c.combinators[i-1] {
+	case ' ':
+		for p := n.Parent; p != nil; p = p.Parent {
+			if p.Type == html.ElementNode && c.match(p, i-1) {
+				return true
+			}
+		}
+	case '>':
+		return n.Parent != nil && n.Parent.Type == html.ElementNode && c.match(n.Parent, i-1)
+	case '+':
+		prev := prevElement(n)
+		return prev != nil && c.match(prev, i-1)
+	case '~':
+		for prev := prevElement(n); prev != nil; prev = prevElement(prev) {
+			if c.match(prev, i-1) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (c *compound) match(n *html.Node) bool {
+	if n.Type != html.ElementNode || c.tag != "" && n.Data != c.tag {
+		return false
+	}
+	for _, f := range c.filters {
+		if !f(n) {
+			return false
+		}
+	}
+	return true
+}
+
+// prevElement 返回n之前的兄弟元素
+func prevElement(n *html.Node) *html.Node {
+	for p := n.PrevSibling; p != nil; p = p.PrevSibling {
+		if p.Type == html.ElementNode {
+			return p
+		}
+	}
+	return nil
+}
+
+// nextElement 返回n之后的兄弟元素
+func nextElement(n *html.Node) *html.Node {
+	for p := n.NextSibling; p != nil; p = p.NextSibling {
+		if p.Type == html.ElementNode {
+			return p
+		}
+	}
+	return nil
+}
+
+// attr 返回元素的属性值
+func attr(n *html.Node, name string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Namespace == "" && a.Key == name {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+// selectorParser 选择器的递归下降解析器
+type selectorParser struct {
+	s   string
+	pos int
+}
+
+func (p *selectorParser) parseGroups() (*Selector, error) {
+	s := &Selector{}
+	for {
+		c, err := p.parseComplex()
+		if err != nil {
+			return nil, err
+		}
+		s.groups = append(s.groups, c)
+		p.skipSpace()
+		if p.pos == len(p.s) {
+			return s, nil
+		}
+		if p.s[p.pos] != ',' {
+			return nil, fmt.Errorf("位置%d处有意外的字符%q", p.pos, p.s[p.pos])
+		}
+		p.pos++
+	}
+}
+
+func (p *selectorParser) parseComplex() (complexSelector, error) {
+	var c complexSelector
+	p.skipSpace()
+	for {
+		part, err := p.parseCompound()
+		if err != nil {
+			return c, err
+		}
+		c.parts = append(c.parts, part)
+		hadSpace := p.skipSpace()
+		if p.pos == len(p.s) || p.s[p.pos] == ',' || p.s[p.pos] == ')' {
+			return c, nil
+		}
+		comb := byte(' ')
+		switch p.s[p.pos] {
+		case '>', '+', '~':
+			comb = p.s[p.pos]
+			p.pos++
+			p.skipSpace()
+		default:
+			if !hadSpace {
+				return c, fmt.Errorf("位置%d处有意外的字符%q", p.pos, p.s[p.pos])
+			}
+		}
+		c.combinators = append(c.combinators, comb)
+	}
+}
+
+func (p *selectorParser) parseCompound() (compound, error) {
+	var c compound
+	start := p.pos
+	if p.pos < len(p.s) && p.s[p.pos] == '*' {
+		p.pos++
+	} else if name := p.parseIdent(); name != "" {
+		c.tag = strings.ToLower(name)
+	}
+	for p.pos < len(p.s) {
+		var f func(*html.Node) bool
+		var err error
+		switch p.s[p.pos] {
+		case '#':
+			p.pos++
+			id := p.parseIdent()
+			if id == "" {
+				return c, fmt.Errorf("位置%d处缺少ID", p.pos)
+			}
+			f = func(n *html.Node) bool {
+				v, _ := attr(n, "id")
+				return v == id
+			}
+		case '.':
+			p.pos++
+			class := p.parseIdent()
+			if class == "" {
+				return c, fmt.Errorf("位置%d处缺少类名", p.pos)
+			}
+			f = attrMatcher("class", "~=", class)
+		case '[':
+			f, err = p.parseAttr()
+		case ':':
+			f, err = p.parsePseudo()
+		default:
+			if p.pos == start {
+				return c, fmt.Errorf("位置%d处缺少选择器", p.pos)
+			}
+			return c, nil
+		}
+		if err != nil {
+			return c, err
+		}
+		c.filters = append(c.filters, f)
+	}
+	if p.pos == start {
+		return c, fmt.Errorf("位置%d处缺少选择器", p.pos)
+	}
+	return c, nil
+}
+
+// parseAttr 解析[name]、[name=value]等属性选择器
+func (p *selectorParser) parseAttr() (func(*html.Node) bool, error) {
+	p.pos++
+	p.skipSpace()
+	name := strings.ToLower(p.parseIdent())
+	if name == "" {
+		return nil, fmt.Errorf("位置%d处缺少属性名", p.pos)
+	}
+	p.skipSpace()
+	if p.pos < len(p.s) && p.s[p.pos] == ']' {
+		p.pos++
+		return func(n *html.Node) bool {
+			_, ok := attr(n, name)
+			return ok
+		}, nil
+	}
+	op := ""
+	for _, candidate := range []string{"=", "~=", "^=", "$=", "*=", "|="} {
+		if strings.HasPrefix(p.s[p.pos:], candidate) {
+			op = candidate
+			break
+		}
+	}
+	if op == "" {
+		return nil, fmt.Errorf("位置%d处缺少属性运算符", p.pos)
+	}
+	p.pos += len(op)
+	p.skipSpace()
+	value, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos == len(p.s) || p.s[p.pos] != ']' {
+		return nil, fmt.Errorf("位置%d处缺少\"]\"", p.pos)
+	}
+	p.pos++
+	return attrMatcher(name, op, value), nil
+}
+
+// attrMatcher 返回按运算符比较属性值的函数
+func attrMatcher(name, op, value string) func(*html.Node) bool {
+	return func(n *html.Node) bool {
+		v, ok := attr(n, name)
+		if !ok {
+			return false
+		}
+		switch op {
+		case "=":
+			return v == value
+		case "~=":
+			for _, field := range strings.Fields(v) {
+				if field == value {
+					return true
+				}
+			}
+			return false
+		case "^=":
+			return value != "" && strings.HasPrefix(v, value)
+		case "$=":
+			return value != "" && strings.HasSuffix(v, value)
+		case "*=":
+			return value != "" && strings.Contains(v, value)
+		case "|=":
+			return v == value || strings.HasPrefix(v, value+"-")
+		}
+		return false
+	}
+}
+
+// parsePseudo 解析伪类
+func (p *selectorParser) parsePseudo() (func(*html.Node) bool, error) {
+	p.pos++
+	name := strings.ToLower(p.parseIdent())
+	switch name {
+	case "first-child":
+		return func(n *html.Node) bool { return prevElement(n) == nil }, nil
+	case "last-child":
+		return func(n *html.Node) bool { return nextElement(n) == nil }, nil
+	case "only-child":
+		return func(n *html.Node) bool { return prevElement(n) == nil && nextElement(n) == nil }, nil
+	case "empty":
+		return func(n *html.Node) bool {
+			for c := n.FirstChild; c != nil; c = c.NextSibling {
+				if c.Type == html.ElementNode || c.Type == html.TextNode && c.Data != "" {
+					return false
+				}
+			}
+			return true
+		}, nil
+	case "nth-child", "not", "contains":
+	default:
+		return nil, fmt.Errorf("不支持的伪类:%s", name)
+	}
+	if p.pos == len(p.s) || p.s[p.pos] != '(' {
+		return nil, fmt.Errorf("伪类:%s缺少参数", name)
+	}
+	p.pos++
+	p.skipSpace()
+	var f func(*html.Node) bool
+	switch name {
+	case "nth-child":
+		end := strings.IndexByte(p.s[p.pos:], ')')
+		if end < 0 {
+			return nil, fmt.Errorf("伪类:%s缺少\")\"", name)
+		}
+		a, b, err := parseNth(strings.TrimSpace(p.s[p.pos : p.pos+end]))
+		if err != nil {
+			return nil, err
+		}
+		p.pos += end
+		f = func(n *html.Node) bool {
+			i := 1
+			for prev := prevElement(n); prev != nil; prev = prevElement(prev) {
+				i++
+			}
+			if a == 0 {
+				return i == b
+			}
+			return (i-b)%a == 0 && (i-b)/a >= 0
+		}
+	case "not":
+		inner, err := p.parseComplex()
+		if err != nil {
+			return nil, err
+		}
+		f = func(n *html.Node) bool { return !inner.match(n, len(inner.parts)-1) }
+	case "contains":
+		text, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		f = func(n *html.Node) bool { return strings.Contains(nodeText(n), text) }
+	}
+	p.skipSpace()
+	if p.pos == len(p.s) || p.s[p.pos] != ')' {
+		return nil, fmt.Errorf("伪类:%s缺少\")\"", name)
+	}
+	p.pos++
+	return f, nil
+}
+
+// parseNth 解析:nth-child的参数an+b
+func parseNth(s string) (a, b int, err error) {
+	s = strings.ReplaceAll(strings.ToLower(s), " ", "")
+	switch s {
+	case "odd":
+		return 2, 1, nil
+	case "even":
+		return 2, 0, nil
+	}
+	before, after, hasN := strings.Cut(s, "n")
+	if !hasN {
+		b, err = strconv.Atoi(s)
+		return 0, b, err
+	}
+	switch before {
+	case "", "+":
+		a = 1
+	case "-":
+		a = -1
+	default:
+		if a, err = strconv.Atoi(before); err != nil {
+			return 0, 0, fmt.Errorf("无效的:nth-child参数%q", s)
+		}
+	}
+	if after != "" {
+		if b, err = strconv.Atoi(after); err != nil {
+			return 0, 0, fmt.Errorf("无效的:nth-child参数%q", s)
+		}
+	}
+	return a, b, nil
+}
+
+// parseIdent 解析标识符，支持反斜杠转义
+func (p *selectorParser) parseIdent() string {
+	var sb strings.Builder
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		switch {
+		case c == '\\' && p.pos+1 < len(p.s):
+			sb.WriteByte(p.s[p.pos+1])
+			p.pos += 2
+			continue
+		case c == '-' || c == '_' || c >= 0x80 || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z':
+			sb.WriteByte(c)
+			p.pos++
+			continue
+		}
+		break
+	}
+	return sb.String()
+}
+
+// parseValue 解析带引号或不带引号的值
+func (p *selectorParser) parseValue() (string, error) {
+	if p.pos < len(p.s) && (p.s[p.pos] == '"' || p.s[p.pos] == '\'') {
+		quote := p.s[p.pos]
+		end := strings.IndexByte(p.s[p.pos+1:], quote)
+		if end < 0 {
+			return "", fmt.Errorf("位置%d处的字符串没有结束", p.pos)
+		}
+		v := p.s[p.pos+1 : p.pos+1+end]
+		p.pos += end + 2
+		return v, nil
+	}
+	v := p.parseIdent()
+	if v == "" {
+		return "", fmt.Errorf("位置%d处缺少值", p.pos)
+	}
+	return v, nil
+}
+
+// skipSpace 跳过空白，返回是否跳过了空白
+func (p *selectorParser) skipSpace() bool {
+	start := p.pos
+	for p.pos < len(p.s) && strings.IndexByte(" \t\r\n\f", p.s[p.pos]) >= 0 {
+		p.pos++
+	}
+	return p.pos > start
+}
@@ -0,0 +1,77 @@
+package htmldoc
+
+import (
+	"strings"
+	"testing"
+)
+
+const testPage = `<html><body>
+<div id="main" class="content wide">
+	<h1>标题</h1>
+	<ul>
+		<li class="item">一</li>
+		<li class="item active">二</li>
+		<li class="item">三</li>
+		<li class="item"><a href="/four" lang="zh-CN">四</a></li>
+	</ul>
+	<p></p>
+	<a href="https://example.com/x.png" title="logo image">图</a>
+</div>
+<span>外部</span>
+</body></html>`
+
+func TestSelector(t *testing.T) {
+	doc, err := Parse(strings.NewReader(testPage))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		sel  string
+		want string
+	}{
+		{"li", "一二三四"},
+		{"#main > h1", "标题"},
+		{"div.content.wide h1", "标题"},
+		{"li.active", "二"},
+		{"li:first-child", "一"},
+		{"li:last-child", "四"},
+		{"li:nth-child(2n+1)", "一三"},
+		{"li:nth-child(even)", "二四"},
+		{"li:nth-child(-n+2)", "一二"},
+		{"li:not(.active)", "一三四"},
+		{"li.active + li", "三"},
+		{"li.active ~ li", "三四"},
+		{"a[href^=https]", "图"},
+		{`a[href$=".png"]`, "图"},
+		{"a[title~=image]", "图"},
+		{"a[title*=go]", "图"},
+		{"a[lang|=zh]", "四"},
+		{"li:contains(三)", "三"},
+		{"h1, span", "标题外部"},
+		{"#main > span", ""},
+		{"body > span", "外部"},
+	}
+	for _, tc := range cases {
+		if got := doc.Find(tc.sel).Text(); got != tc.want {
+			t.Errorf("Find(%q) = %q, want %q", tc.sel, got, tc.want)
+		}
+	}
+	if n := doc.Find("p:empty").Len(); n != 1 {
+		t.Errorf("p:empty matched %d, want 1", n)
+	}
+	if n := doc.Find("*").Len(); n < 10 {
+		t.Errorf("* matched %d elements", n)
+	}
+}
+
+func TestCompileInvalid(t *testing.T) {
+	for _, sel := range []string{"", "div >", "[href", "li:nth-child(x)", ":unknown", "a,", "div)"} {
+		if _, err := Compile(sel); err == nil {
+			t.Errorf("Compile(%q) should fail", sel)
+		}
+	}
+	doc, _ := Parse(strings.NewReader(testPage))
+	if doc.Find("[href").Len() != 0 {
+		t.Error("invalid selector should return an empty selection")
+	}
+}
@@ -0,0 +1,232 @@
+package goproxy
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// HTTP2Settings HTTP/2连接参数，零值字段使用Go的默认值
+type HTTP2Settings struct {
+	MaxConcurrentStreams int           // 每个连接上允许同时进行的请求数
+	ReadIdleTimeout      time.Duration // 连接上多久没有收到数据后发送PING进行健康检查，0表示不检查
+	PingTimeout          time.Duration // 等待PING响应的超时时间，超时后关闭连接
+	WriteByteTimeout     time.Duration // 写入数据的超时时间，超时后关闭连接
+}
+
+// EnableHTTP2 开启或关闭HTTP/2
+// 开启后访问https目标时通过ALPN协商HTTP/2，服务器不支持时自动回退到HTTP/1.1。
+// 设置了TLS指纹时同样可以使用HTTP/2，此时的连接由本包自行管理。
+// New创建的客户端默认只使用HTTP/1.1
+func (r *GoProxy) EnableHTTP2(enable bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.http2Enabled = enable
+	r.rebuildTransport()
+}
+
+// IsHTTP2Enabled 返回是否开启了HTTP/2
+func (r *GoProxy) IsHTTP2Enabled() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.http2Enabled
+}
+
+// SetHTTP2Settings 设置HTTP/2连接参数，对之后新建的连接生效
+func (r *GoProxy) SetHTTP2Settings(s HTTP2Settings) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.http2Settings = s
+	r.rebuildTransport()
+}
+
+// GetHTTP2Settings 获取HTTP/2连接参数
+func (r *GoProxy) GetHTTP2Settings() HTTP2Settings {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.http2Settings
+}
+
+// rebuildTransport 按当前HTTP/2配置重建底层Transport
+// http.Transport只在第一次发送请求时读取HTTP/2相关配置，之后修改不会生效，
+// 因此需要复制出新的Transport并替换，旧Transport的空闲连接随之关闭。调用方需持有r.mu
+func (r *GoProxy) rebuildTransport() {
+	ct := r.transport
+	old := ct.Transport
+	t := old.Clone()
+	t.TLSNextProto = nil
+	t.ForceAttemptHTTP2 = r.http2Enabled
+	if r.http2Enabled {
+		t.HTTP2 = &http.HTTP2Config{
+			MaxConcurrentStreams: r.http2Settings.MaxConcurrentStreams,
+			SendPingTimeout:      r.http2Settings.ReadIdleTimeout,
+			PingTimeout:          r.http2Settings.PingTimeout,
+			WriteByteTimeout:     r.http2Settings.WriteByteTimeout,
+		}
+	} else {
+		// TLSNextProto为空map是关闭HTTP/2的约定方式
+		t.HTTP2 = nil
+		t.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+		// 开启HTTP/2后Transport会在TLS配置的NextProtos中加入h2，关闭时需要移除
+		if cfg := t.TLSClientConfig; cfg != nil && slices.Contains(cfg.NextProtos, "h2") {
+			cfg = cfg.Clone()
+			cfg.NextProtos = slices.DeleteFunc(cfg.NextProtos, func(p string) bool { return p == "h2" })
+			t.TLSClientConfig = cfg
+		}
+	}
+	ct.Transport = t
+	old.CloseIdleConnections()
+	r.utlsH2.closeIdle()
+	r.h2c.closeIdle()
+}
+
+// closeIdleConns 关闭所有空闲连接，使新的连接配置对后续请求生效。调用方需持有r.mu
+func (r *GoProxy) closeIdleConns() {
+	r.transport.Transport.CloseIdleConnections()
+	r.utlsH2.closeIdle()
+	r.h2c.closeIdle()
+	r.proxyH2.closeIdle()
+}
+
+// alpnProtocols 返回TLS握手时通过ALPN声明的协议，调用方需持有r.mu
+func (r *GoProxy) alpnProtocols() []string {
+	if r.http2Enabled {
+		return []string{"h2", "http/1.1"}
+	}
+	return nil
+}
+
+// utlsH2Transport 在uTLS连接上发送HTTP/2请求
+// http.Transport只能在*tls.Conn上使用HTTP/2，设置了TLS指纹并开启HTTP/2时由它接管https请求：
+// 首次连接某个目标时按指纹以h2和http/1.1协商ALPN，服务器选择h2则复用该连接，
+// 否则记录该目标只支持HTTP/1.1，之后交回http.Transport处理
+type utlsH2Transport struct {
+	r *GoProxy
+
+	mu    sync.Mutex
+	conns map[string]*http2.ClientConn // 按目标地址缓存的HTTP/2连接
+	h1    map[string]bool              // 只支持HTTP/1.1的目标地址
+}
+
+// RoundTrip 实现http.RoundTripper接口，不适用时返回http.ErrSkipAltProtocol
+func (t *utlsH2Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := t.r
+	r.mu.Lock()
+	enabled := r.http2Enabled && r.fingerprint != FingerprintGo
+	settings := r.http2Settings
+	r.mu.Unlock()
+	if !enabled || req.URL.Scheme != "https" {
+		return nil, http.ErrSkipAltProtocol
+	}
+	if opts := optionsFromRequest(req); opts != nil && opts.ownConn() || r.headerOrderForced(req.Context()) {
+		// 影响连接建立或需要控制请求头顺序的请求交由Transport处理
+		return nil, http.ErrSkipAltProtocol
+	}
+	addr := canonicalAddr(req.URL)
+
+	t.mu.Lock()
+	if t.h1[addr] {
+		t.mu.Unlock()
+		return nil, http.ErrSkipAltProtocol
+	}
+	cc := t.conns[addr]
+	t.mu.Unlock()
+
+	if cc != nil && cc.CanTakeNewRequest() &&
+		(settings.MaxConcurrentStreams <= 0 || cc.State().StreamsActive < settings.MaxConcurrentStreams) {
+		resp, err := cc.RoundTrip(req)
+		if err == nil || !isRetryableH2Err(err) {
+			return resp, err
+		}
+	}
+
+	conn, err := r.dialTLS(req.Context(), "tcp", addr, []string{"h2", "http/1.1"})
+	if err != nil {
+		return nil, err
+	}
+	if conn.ConnectionState().NegotiatedProtocol != "h2" {
+		conn.Close()
+		t.mu.Lock()
+		if t.h1 == nil {
+			t.h1 = make(map[string]bool)
+		}
+		t.h1[addr] = true
+		t.mu.Unlock()
+		return nil, http.ErrSkipAltProtocol
+	}
+	h2t := &http2.Transport{
+		ReadIdleTimeout:  settings.ReadIdleTimeout,
+		PingTimeout:      settings.PingTimeout,
+		WriteByteTimeout: settings.WriteByteTimeout,
+	}
+	cc, err = h2t.NewClientConn(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	t.mu.Lock()
+	if t.conns == nil {
+		t.conns = make(map[string]*http2.ClientConn)
+	}
+	if old := t.conns[addr]; old != nil && old != cc {
+		// 旧连接上可能还有进行中的请求，等待其结束后再关闭。
+		// 旧连接已从t.conns中移除，不能使用请求的context，否则请求结束后Shutdown提前返回，连接不再被关闭
+		go shutdownClientConn(old, h2ShutdownTimeout)
+	}
+	t.conns[addr] = cc
+	t.mu.Unlock()
+	return cc.RoundTrip(req)
+}
+
+// h2ShutdownTimeout 被替换的HTTP/2连接等待进行中的请求结束的最长时间，超时后强制关闭
+const h2ShutdownTimeout = 5 * time.Minute
+
+// shutdownClientConn 等待cc上进行中的请求结束后关闭连接，超过timeout时强制关闭
+func shutdownClientConn(cc *http2.ClientConn, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := cc.Shutdown(ctx); err != nil {
+		cc.Close()
+	}
+}
+
+// closeIdle 移除所有HTTP/2连接并清空协议记录
+// 空闲连接立即关闭，仍有请求进行中的连接在请求结束后关闭
+func (t *utlsH2Transport) closeIdle() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, cc := range t.conns {
+		if cc.State().StreamsActive == 0 {
+			cc.Close()
+		} else {
+			go cc.Shutdown(context.Background())
+		}
+	}
+	t.conns = nil
+	t.h1 = nil
+}
+
+// altTransports 依次尝试的一组RoundTripper，都返回http.ErrSkipAltProtocol时由Transport处理
+type altTransports []http.RoundTripper
+
+// RoundTrip 实现http.RoundTripper接口
+func (a altTransports) RoundTrip(req *http.Request) (*http.Response, error) {
+	for _, rt := range a {
+		resp, err := rt.RoundTrip(req)
+		if err != http.ErrSkipAltProtocol {
+			return resp, err
+		}
+	}
+	return nil, http.ErrSkipAltProtocol
+}
+
+// isRetryableH2Err 判断连接已失效、可以换新连接重试的错误
+func isRetryableH2Err(err error) bool {
+	return err == http2.ErrNoCachedConn || err == net.ErrClosed
+}
@@ -0,0 +1,108 @@
+package goproxy
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+func newTestH2Server(t *testing.T) *httptest.Server {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestGoProxy_EnableHTTP2(t *testing.T) {
+	srv := newTestH2Server(t)
+	c := New()
+	if got := getBody(t, c, srv.URL); got != "HTTP/1.1" {
+		t.Fatalf("默认应使用HTTP/1.1，实际为%s", got)
+	}
+
+	c.EnableHTTP2(true)
+	c.SetHTTP2Settings(HTTP2Settings{MaxConcurrentStreams: 10, ReadIdleTimeout: time.Second, PingTimeout: time.Second})
+	if !c.IsHTTP2Enabled() || c.GetHTTP2Settings().MaxConcurrentStreams != 10 {
+		t.Fatal("HTTP/2配置未保存")
+	}
+	if got := getBody(t, c, srv.URL); got != "HTTP/2.0" {
+		t.Fatalf("开启后应使用HTTP/2，实际为%s", got)
+	}
+
+	c.EnableHTTP2(false)
+	if got := getBody(t, c, srv.URL); got != "HTTP/1.1" {
+		t.Fatalf("关闭后应使用HTTP/1.1，实际为%s", got)
+	}
+}
+
+func TestGoProxy_HTTP2WithFingerprint(t *testing.T) {
+	srv := newTestH2Server(t)
+	c := New()
+	if err := c.SetTLSFingerprint(FingerprintChrome); err != nil {
+		t.Fatal(err)
+	}
+	if got := getBody(t, c, srv.URL); got != "HTTP/1.1" {
+		t.Fatalf("未开启HTTP/2时应使用HTTP/1.1，实际为%s", got)
+	}
+
+	c.EnableHTTP2(true)
+	for range 3 {
+		resp, err := c.GetClient().Get(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.ProtoMajor != 2 || resp.TLS == nil {
+			t.Fatalf("应通过uTLS连接使用HTTP/2，实际为%s", resp.Proto)
+		}
+	}
+
+	// 服务器不支持HTTP/2时回退到HTTP/1.1
+	h1 := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	}))
+	defer h1.Close()
+	if got := getBody(t, c, h1.URL); got != "HTTP/1.1" {
+		t.Fatalf("应回退到HTTP/1.1，实际为%s", got)
+	}
+}
+
+func TestShutdownClientConn(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.(http.Flusher).Flush()
+		<-release
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	conn, err := tls.Dial("tcp", srv.Listener.Addr().String(), &tls.Config{InsecureSkipVerify: true, NextProtos: []string{"h2"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cc, err := (&http2.Transport{}).NewClientConn(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	resp, err := cc.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	// 请求一直没有结束时，超时后强制关闭连接
+	shutdownClientConn(cc, 50*time.Millisecond)
+	if !cc.State().Closed {
+		t.Error("超时后连接应被关闭")
+	}
+}
@@ -0,0 +1,191 @@
+package goproxy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+)
+
+// WithHTTP10 单次请求以HTTP/1.0发送，响应结束后关闭连接
+// 适用于只支持HTTP/1.0的老旧服务器或代理。HTTP/1.0不支持分块传输，
+// 长度未知的请求体会先完整读入内存以计算Content-Length
+func WithHTTP10() RequestOption {
+	return func(o *requestOptions) {
+		o.httpVersion = "1.0"
+	}
+}
+
+// WithHTTP11 单次请求强制使用HTTP/1.1，即使开启了HTTP/2或h2c
+// 设置后该请求使用独立的连接，不会复用或被复用
+func WithHTTP11() RequestOption {
+	return func(o *requestOptions) {
+		o.httpVersion = "1.1"
+	}
+}
+
+// WithCloseConnection 单次请求发送Connection: close，响应结束后关闭连接而不放回连接池
+func WithCloseConnection() RequestOption {
+	return func(o *requestOptions) {
+		o.closeConn = true
+	}
+}
+
+// SetKeepAlive 设置是否复用连接，关闭后每个请求都使用新的连接并在响应结束后关闭
+func (r *GoProxy) SetKeepAlive(enable bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t := r.transport.Transport
+	t.DisableKeepAlives = !enable
+	if !enable {
+		r.closeIdleConns()
+	}
+}
+
+// http10RoundTrip 通过t上安装的代理和拨号函数以HTTP/1.0发送请求，每个请求使用独立的连接
+func http10RoundTrip(t *http.Transport, req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("读取请求体失败: %w", err)
+		}
+	}
+
+	// Transport.Proxy只对http目标返回代理，https目标的隧道由拨号函数建立
+	var proxyURL *url.URL
+	if t.Proxy != nil && req.URL.Scheme == "http" {
+		p, err := t.Proxy(req)
+		if err != nil {
+			return nil, err
+		}
+		proxyURL = p
+	}
+	var conn net.Conn
+	var err error
+	if proxyURL != nil {
+		conn, err = dialWith(ctx, t.DialContext, "tcp", canonicalAddr(proxyURL))
+	} else {
+		conn, err = dialHTTP10(ctx, t, req)
+	}
+	if err != nil {
+		return nil, err
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+
+	var buf bytes.Buffer
+	uri := req.URL.RequestURI()
+	if proxyURL != nil {
+		// 经HTTP代理转发时使用绝对路径形式
+		uri = req.URL.String()
+	}
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	fmt.Fprintf(&buf, "%s %s HTTP/1.0\r\nHost: %s\r\n", req.Method, uri, host)
+	h := req.Header.Clone()
+	h.Del("Host")
+	h.Del("Connection")
+	h.Del("Transfer-Encoding")
+	if proxyURL != nil {
+		if auth := proxyAuthorization(proxyURL); auth != "" {
+			h.Set("Proxy-Authorization", auth)
+		}
+	}
+	if body != nil || req.Method == http.MethodPost || req.Method == http.MethodPut {
+		h.Set("Content-Length", strconv.Itoa(len(body)))
+	}
+	h.Write(&buf)
+	buf.WriteString("\r\n")
+	buf.Write(body)
+	if _, err := conn.Write(buf.Bytes()); err != nil {
+		stop()
+		conn.Close()
+		return nil, fmt.Errorf("发送请求失败: %w", err)
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		stop()
+		conn.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("读取响应失败: %w", err)
+	}
+	resp.Body = &connClosingBody{ReadCloser: resp.Body, conn: conn, stop: stop}
+	return resp, nil
+}
+
+// dialHTTP10 建立HTTP/1.0请求到目标的连接
+func dialHTTP10(ctx context.Context, t *http.Transport, req *http.Request) (net.Conn, error) {
+	addr := canonicalAddr(req.URL)
+	switch {
+	case req.URL.Scheme == "https" && t.DialTLSContext != nil:
+		return t.DialTLSContext(ctx, "tcp", addr)
+	case req.URL.Scheme == "https":
+		conn, err := dialWith(ctx, t.DialContext, "tcp", addr)
+		if err != nil {
+			return nil, err
+		}
+		cfg := t.TLSClientConfig.Clone()
+		if cfg == nil {
+			cfg = &tls.Config{}
+		}
+		if cfg.ServerName == "" {
+			cfg.ServerName = req.URL.Hostname()
+		}
+		cfg.NextProtos = []string{"http/1.1"}
+		tlsConn := tls.Client(conn, cfg)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return tlsConn, nil
+	case req.URL.Scheme == "http":
+		return dialWith(ctx, t.DialContext, "tcp", addr)
+	default:
+		return nil, errors.New("不支持的协议: " + req.URL.Scheme)
+	}
+}
+
+// dialWith 使用dial建立连接，dial为nil时直接连接
+func dialWith(ctx context.Context, dial func(ctx context.Context, network, addr string) (net.Conn, error), network, addr string) (net.Conn, error) {
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	return dial(ctx, network, addr)
+}
+
+// connClosingBody 响应体关闭时一并关闭连接
+type connClosingBody struct {
+	io.ReadCloser
+	conn net.Conn
+	stop func() bool
+	once sync.Once
+}
+
+func (b *connClosingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() {
+		b.stop()
+		b.conn.Close()
+	})
+	return err
+}
+
+// roundTripperFunc 将函数适配为http.RoundTripper
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
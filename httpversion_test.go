@@ -0,0 +1,81 @@
+package goproxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGoProxy_HTTPVersionOptions(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		fmt.Fprintf(w, "%s close=%v body=%s", r.Proto, r.Close, body)
+	})
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+	tlsSrv := httptest.NewUnstartedServer(handler)
+	tlsSrv.EnableHTTP2 = true
+	tlsSrv.StartTLS()
+	defer tlsSrv.Close()
+
+	c := New()
+	do := func(method, url string, body io.Reader, opts ...RequestOption) string {
+		t.Helper()
+		req, _ := http.NewRequest(method, url, body)
+		resp, err := c.Do(req, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		return string(b)
+	}
+
+	if got := do(http.MethodGet, srv.URL, nil, WithHTTP10()); got != "HTTP/1.0 close=true body=" {
+		t.Errorf("HTTP/1.0请求: %s", got)
+	}
+	// 长度未知的请求体
+	body := io.MultiReader(strings.NewReader("a"), strings.NewReader("b"))
+	if got := do(http.MethodPost, tlsSrv.URL, body, WithHTTP10()); got != "HTTP/1.0 close=true body=ab" {
+		t.Errorf("https目标的HTTP/1.0请求: %s", got)
+	}
+	if got := do(http.MethodGet, srv.URL, nil, WithCloseConnection()); got != "HTTP/1.1 close=true body=" {
+		t.Errorf("WithCloseConnection: %s", got)
+	}
+	if got := do(http.MethodGet, srv.URL, nil); got != "HTTP/1.1 close=false body=" {
+		t.Errorf("默认请求: %s", got)
+	}
+
+	c.EnableHTTP2(true)
+	if got := do(http.MethodGet, tlsSrv.URL, nil); !strings.HasPrefix(got, "HTTP/2.0") {
+		t.Errorf("开启HTTP/2后: %s", got)
+	}
+	if got := do(http.MethodGet, tlsSrv.URL, nil, WithHTTP11()); !strings.HasPrefix(got, "HTTP/1.1") {
+		t.Errorf("WithHTTP11: %s", got)
+	}
+	c.EnableHTTP2(false)
+
+	c.SetKeepAlive(false)
+	if got := do(http.MethodGet, srv.URL, nil); got != "HTTP/1.1 close=true body=" {
+		t.Errorf("关闭连接复用后: %s", got)
+	}
+	c.SetKeepAlive(true)
+
+	// 经HTTP代理以绝对路径形式转发
+	p, _ := newTestProxy(t)
+	if err := c.SetProxy(p.URL); err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	resp, err := c.Do(req, WithHTTP10())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.Header.Get("X-Via-Proxy") != "1" || resp.StatusCode != http.StatusOK {
+		t.Errorf("HTTP/1.0请求未经过代理: %s", resp.Status)
+	}
+}
@@ -0,0 +1,118 @@
+package goproxy
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// ToASCIIHost 将国际化域名转换为DNS解析、SNI和证书校验使用的ASCII形式(punycode)，
+// 如"Bücher.example."转换为"xn--bcher-kva.example"。结果为小写并去掉末尾的点，
+// 已是ASCII的主机名和IP地址只转为小写，支持"*.例子.com"形式的通配符
+func ToASCIIHost(host string) (string, error) {
+	host = strings.TrimSuffix(host, ".")
+	if isASCII(host) {
+		return strings.ToLower(host), nil
+	}
+	prefix := ""
+	if rest, ok := strings.CutPrefix(host, "*."); ok {
+		prefix, host = "*.", rest
+	}
+	ascii, err := idna.Lookup.ToASCII(host)
+	if err != nil {
+		return "", err
+	}
+	return prefix + ascii, nil
+}
+
+// ToUnicodeHost 将punycode形式的主机名转换为Unicode形式，用于日志和界面显示，无法转换时原样返回
+func ToUnicodeHost(host string) string {
+	if !strings.Contains(strings.ToLower(host), "xn--") {
+		return host
+	}
+	display, err := idna.Display.ToUnicode(host)
+	if err != nil {
+		return host
+	}
+	// 转换回去不一致时说明不是有效的punycode
+	if ascii, err := idna.Lookup.ToASCII(display); err != nil || !strings.EqualFold(ascii, host) {
+		return host
+	}
+	return display
+}
+
+// normalizeHost 按主机匹配的规则(SetHostOverride、AddHostHeaders、路由规则等)使用的主机名形式，
+// 使Unicode和punycode写法的同一域名匹配相同的规则；不是有效的国际化域名时只转为小写并去掉末尾的点
+func normalizeHost(host string) string {
+	ascii, err := ToASCIIHost(host)
+	if err != nil {
+		return strings.ToLower(strings.TrimSuffix(host, "."))
+	}
+	return ascii
+}
+
+// asciiHostPort 将"主机[:端口]"中的国际化域名转换为punycode，其他情况原样返回
+func asciiHostPort(hostport string) string {
+	if isASCII(hostport) {
+		return hostport
+	}
+	host, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return normalizeHost(hostport)
+	}
+	return net.JoinHostPort(normalizeHost(host), port)
+}
+
+// asciiRequest 主机名为国际化域名时返回URL和Host转换为punycode的副本，
+// 使拨号、SNI、Host请求头和按主机的规则都使用同一形式
+func asciiRequest(req *http.Request) *http.Request {
+	host, reqHost := asciiHostPort(req.URL.Host), asciiHostPort(req.Host)
+	if host == req.URL.Host && reqHost == req.Host {
+		return req
+	}
+	r2 := *req
+	u := *req.URL
+	u.Host = host
+	r2.URL = &u
+	r2.Host = reqHost
+	return &r2
+}
+
+// displayURL 返回u脱敏后的字符串，主机名为Unicode形式，用于日志
+func displayURL(u *url.URL) string {
+	s := u.Redacted()
+	host := u.Hostname()
+	display := ToUnicodeHost(host)
+	if display == host {
+		return s
+	}
+	if port := u.Port(); port != "" {
+		display += ":" + port
+	}
+	// url.URL.String会转义主机名中的非ASCII字符，直接替换权限部分中的主机名
+	start := strings.Index(s, "//")
+	if start < 0 {
+		return s
+	}
+	start += 2
+	if u.User != nil {
+		start += strings.IndexByte(s[start:], '@') + 1
+	}
+	if !strings.HasPrefix(s[start:], u.Host) {
+		return s
+	}
+	return s[:start] + display + s[start+len(u.Host):]
+}
+
+// isASCII 判断s是否只包含ASCII字符
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,72 @@
+package goproxy
+
+import (
+	"net"
+	"slices"
+)
+
+// IPPolicy 连接时选择IP地址族的策略
+type IPPolicy int
+
+const (
+	IPDualStack IPPolicy = iota // 默认，按解析结果的顺序使用IPv4和IPv6地址
+	IPv4Only                    // 只使用IPv4地址
+	IPv6Only                    // 只使用IPv6地址
+	PreferIPv4                  // 优先使用IPv4地址，失败后再尝试IPv6地址
+	PreferIPv6                  // 优先使用IPv6地址，失败后再尝试IPv4地址
+)
+
+// restrictNetwork 按策略将tcp、udp等网络限定为对应的地址族
+func (p IPPolicy) restrictNetwork(network string) string {
+	var suffix string
+	switch p {
+	case IPv4Only:
+		suffix = "4"
+	case IPv6Only:
+		suffix = "6"
+	default:
+		return network
+	}
+	switch network {
+	case "tcp", "udp", "ip":
+		return network + suffix
+	}
+	return network
+}
+
+// sortIPs 按策略将优先的地址族排在前面，同一地址族内保持解析结果的顺序
+func (p IPPolicy) sortIPs(ips []net.IPAddr) []net.IPAddr {
+	if p != PreferIPv4 && p != PreferIPv6 {
+		return ips
+	}
+	sorted := slices.Clone(ips)
+	slices.SortStableFunc(sorted, func(a, b net.IPAddr) int {
+		return p.rank(a.IP) - p.rank(b.IP)
+	})
+	return sorted
+}
+
+// rank 地址的优先级，值越小越优先
+func (p IPPolicy) rank(ip net.IP) int {
+	if (ip.To4() != nil) == (p == PreferIPv4) {
+		return 0
+	}
+	return 1
+}
+
+// SetIPPolicy 设置直接连接目标或代理服务器时使用的IP地址族
+// 部分代理或网络只能路由一种地址族，双栈回退会导致难以排查的间歇性失败，此时可限定或优先使用某一地址族。
+// 注意: 通过代理访问目标时，目标地址由代理解析和连接，不受该设置影响
+func (r *GoProxy) SetIPPolicy(p IPPolicy) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ipPolicy = p
+	r.closeIdleConns()
+}
+
+// GetIPPolicy 获取当前的IP地址族策略
+func (r *GoProxy) GetIPPolicy() IPPolicy {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.ipPolicy
+}
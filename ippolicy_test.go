@@ -0,0 +1,67 @@
+package goproxy
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestGoProxy_SetIPPolicy(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	c := New()
+	c.SetResolver(staticResolver{"internal.test": {
+		{IP: net.ParseIP("::1")},
+		{IP: net.ParseIP("127.0.0.1")},
+	}})
+	c.SetIPPolicy(IPv4Only)
+	if c.GetIPPolicy() != IPv4Only {
+		t.Fatal("策略未保存")
+	}
+	if got := getBody(t, c, "http://internal.test:"+u.Port()); got != "ok" {
+		t.Errorf("响应为%q", got)
+	}
+
+	c.SetIPPolicy(IPv6Only)
+	for _, target := range []string{"http://internal.test:" + u.Port(), srv.URL} {
+		if _, err := c.GetClient().Get(target); err == nil {
+			t.Errorf("%s: 只使用IPv6时不应连接IPv4地址", target)
+		}
+	}
+}
+
+func TestIPPolicy_SortIPs(t *testing.T) {
+	ips := []net.IPAddr{
+		{IP: net.ParseIP("10.0.0.1")},
+		{IP: net.ParseIP("2001:db8::1")},
+		{IP: net.ParseIP("10.0.0.2")},
+		{IP: net.ParseIP("2001:db8::2")},
+	}
+	tests := []struct {
+		policy IPPolicy
+		want   []string
+	}{
+		{IPDualStack, []string{"10.0.0.1", "2001:db8::1", "10.0.0.2", "2001:db8::2"}},
+		{PreferIPv4, []string{"10.0.0.1", "10.0.0.2", "2001:db8::1", "2001:db8::2"}},
+		{PreferIPv6, []string{"2001:db8::1", "2001:db8::2", "10.0.0.1", "10.0.0.2"}},
+	}
+	for _, tt := range tests {
+		got := tt.policy.sortIPs(ips)
+		for i, ip := range got {
+			if ip.IP.String() != tt.want[i] {
+				t.Errorf("策略%d: 排序结果为%v", tt.policy, got)
+				break
+			}
+		}
+	}
+	if IPv4Only.restrictNetwork("tcp") != "tcp4" || IPv6Only.restrictNetwork("udp") != "udp6" || PreferIPv6.restrictNetwork("tcp") != "tcp" {
+		t.Error("网络类型限定错误")
+	}
+}
@@ -0,0 +1,45 @@
+package goproxy
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"os/exec"
+	"regexp"
+)
+
+var (
+	keychainAccountRe  = regexp.MustCompile(`"acct"<blob>="(.*)"`)
+	keychainPasswordRe = regexp.MustCompile(`(?m)^password: (?:0x([0-9A-Fa-f]+)\s*)?(?:"(.*)")?$`)
+)
+
+// keychainLookup 通过security命令查询钥匙串中服务器为host的互联网密码
+func keychainLookup(ctx context.Context, host string) (*Credentials, error) {
+	// -g将密码输出到标准错误，账户等属性输出到标准输出
+	out, err := exec.CommandContext(ctx, "security", "find-internet-password", "-s", host, "-g").CombinedOutput()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.Is(err, exec.ErrNotFound) || errors.As(err, &exitErr) {
+			// 未找到条目时security以非零状态退出
+			return nil, nil
+		}
+		return nil, err
+	}
+	m := keychainPasswordRe.FindSubmatch(out)
+	if m == nil {
+		return nil, nil
+	}
+	cred := &Credentials{Password: string(m[2])}
+	if len(m[1]) > 0 {
+		// 含非ASCII字符的密码以十六进制输出
+		pass, err := hex.DecodeString(string(m[1]))
+		if err != nil {
+			return nil, err
+		}
+		cred.Password = string(pass)
+	}
+	if m := keychainAccountRe.FindSubmatch(out); m != nil {
+		cred.Username = string(m[1])
+	}
+	return cred, nil
+}
@@ -0,0 +1,44 @@
+package goproxy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+)
+
+// keychainLookup 通过secret-tool查询Secret Service中server属性为host的条目，用户名取自user属性
+func keychainLookup(ctx context.Context, host string) (*Credentials, error) {
+	out, err := exec.CommandContext(ctx, "secret-tool", "search", "server", host).CombinedOutput()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.Is(err, exec.ErrNotFound) || errors.As(err, &exitErr) {
+			// 未安装secret-tool、没有Secret Service或未找到条目
+			return nil, nil
+		}
+		return nil, err
+	}
+	var cred *Credentials
+	s := bufio.NewScanner(bytes.NewReader(out))
+	for s.Scan() {
+		key, value, ok := strings.Cut(s.Text(), " = ")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "secret":
+			if cred != nil {
+				// 只使用第一个条目
+				return cred, nil
+			}
+			cred = &Credentials{Password: value}
+		case "attribute.user":
+			if cred != nil {
+				cred.Username = value
+			}
+		}
+	}
+	return cred, nil
+}
@@ -0,0 +1,10 @@
+//go:build !darwin && !linux && !windows
+
+package goproxy
+
+import "context"
+
+// keychainLookup 当前系统不支持读取系统凭据，总是返回没有凭据
+func keychainLookup(context.Context, string) (*Credentials, error) {
+	return nil, nil
+}
@@ -0,0 +1,83 @@
+package goproxy
+
+import (
+	"context"
+	"syscall"
+	"unicode/utf16"
+	"unsafe"
+)
+
+var (
+	modAdvapi32   = syscall.NewLazyDLL("advapi32.dll")
+	procCredReadW = modAdvapi32.NewProc("CredReadW")
+	procCredFree  = modAdvapi32.NewProc("CredFree")
+)
+
+const (
+	credTypeGeneric = 1    // CRED_TYPE_GENERIC
+	errorNotFound   = 1168 // ERROR_NOT_FOUND
+)
+
+// winCredential 对应Windows的CREDENTIALW结构
+type winCredential struct {
+	Flags              uint32
+	Type               uint32
+	TargetName         *uint16
+	Comment            *uint16
+	LastWritten        syscall.Filetime
+	CredentialBlobSize uint32
+	CredentialBlob     *byte
+	Persist            uint32
+	AttributeCount     uint32
+	Attributes         uintptr
+	TargetAlias        *uint16
+	UserName           *uint16
+}
+
+// keychainLookup 通过CredReadW读取凭据管理器中目标名为host的普通凭据
+func keychainLookup(_ context.Context, host string) (*Credentials, error) {
+	target, err := syscall.UTF16PtrFromString(host)
+	if err != nil {
+		return nil, err
+	}
+	if err := procCredReadW.Find(); err != nil {
+		return nil, nil
+	}
+	var c *winCredential
+	ret, _, err := procCredReadW.Call(uintptr(unsafe.Pointer(target)), credTypeGeneric, 0, uintptr(unsafe.Pointer(&c)))
+	if ret == 0 {
+		if errno, ok := err.(syscall.Errno); ok && errno == errorNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer procCredFree.Call(uintptr(unsafe.Pointer(c)))
+
+	cred := &Credentials{Username: utf16PtrToString(c.UserName)}
+	if c.CredentialBlobSize > 0 {
+		blob := unsafe.Slice(c.CredentialBlob, c.CredentialBlobSize)
+		if len(blob)%2 == 0 {
+			// 凭据管理器保存的密码为UTF-16LE编码
+			u := make([]uint16, len(blob)/2)
+			for i := range u {
+				u[i] = uint16(blob[2*i]) | uint16(blob[2*i+1])<<8
+			}
+			cred.Password = string(utf16.Decode(u))
+		} else {
+			cred.Password = string(blob)
+		}
+	}
+	return cred, nil
+}
+
+// utf16PtrToString 将以0结尾的UTF-16字符串转为string
+func utf16PtrToString(p *uint16) string {
+	if p == nil {
+		return ""
+	}
+	n := 0
+	for ptr := unsafe.Pointer(p); *(*uint16)(ptr) != 0; n++ {
+		ptr = unsafe.Add(ptr, 2)
+	}
+	return string(utf16.Decode(unsafe.Slice(p, n)))
+}
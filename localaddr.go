@@ -0,0 +1,84 @@
+package goproxy
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// SetLocalAddr 设置直接连接目标和连接代理服务器时绑定的源IP，用于多出口的主机，为空时取消绑定
+// 设置后只连接与源IP地址族相同的目标地址，并取消SetInterface的设置
+func (r *GoProxy) SetLocalAddr(ip string) error {
+	var parsed net.IP
+	if ip != "" {
+		if parsed = net.ParseIP(ip); parsed == nil {
+			return fmt.Errorf("无效的源IP: %s", ip)
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.localIP = parsed
+	r.iface = ""
+	r.closeIdleConns()
+	return nil
+}
+
+// SetInterface 设置直接连接目标和连接代理服务器时使用的网卡，为空时取消绑定
+// 连接时按目标的地址族选择该网卡上的地址作为源地址，并取消SetLocalAddr的设置
+func (r *GoProxy) SetInterface(name string) error {
+	if name != "" {
+		if _, err := net.InterfaceByName(name); err != nil {
+			return fmt.Errorf("查找网卡%s失败: %w", name, err)
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.iface = name
+	r.localIP = nil
+	r.closeIdleConns()
+	return nil
+}
+
+// interfaceAddr 返回网卡name上指定地址族的地址，优先使用非链路本地地址
+func interfaceAddr(name string, ipv6 bool) (net.IP, error) {
+	ifi, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("查找网卡%s失败: %w", name, err)
+	}
+	addrs, err := ifi.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("获取网卡%s的地址失败: %w", name, err)
+	}
+	var linkLocal net.IP
+	for _, a := range addrs {
+		ipNet, ok := a.(*net.IPNet)
+		if !ok || (ipNet.IP.To4() == nil) != ipv6 {
+			continue
+		}
+		if !ipNet.IP.IsLinkLocalUnicast() {
+			return ipNet.IP, nil
+		}
+		if linkLocal == nil {
+			linkLocal = ipNet.IP
+		}
+	}
+	if linkLocal != nil {
+		return linkLocal, nil
+	}
+	family := "IPv4"
+	if ipv6 {
+		family = "IPv6"
+	}
+	return nil, fmt.Errorf("网卡%s没有可用的%s地址", name, family)
+}
+
+// localAddr 将源IP转换为network对应的本地地址，ip为nil时返回nil
+func localAddr(network string, ip net.IP) net.Addr {
+	if ip == nil {
+		return nil
+	}
+	if strings.HasPrefix(network, "udp") {
+		return &net.UDPAddr{IP: ip}
+	}
+	return &net.TCPAddr{IP: ip}
+}
@@ -0,0 +1,50 @@
+package goproxy
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGoProxy_SetLocalAddr(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, _ := net.SplitHostPort(r.RemoteAddr)
+		io.WriteString(w, host)
+	}))
+	defer srv.Close()
+
+	c := New()
+	c.SetKeepAlive(false)
+	if err := c.SetLocalAddr("127.0.0.2"); err != nil {
+		t.Fatal(err)
+	}
+	if got := getBody(t, c, srv.URL); got != "127.0.0.2" {
+		t.Errorf("源地址为%s", got)
+	}
+	if err := c.SetLocalAddr("bad"); err == nil {
+		t.Error("无效的IP应返回错误")
+	}
+
+	var loopback string
+	ifaces, _ := net.Interfaces()
+	for _, ifi := range ifaces {
+		if ifi.Flags&net.FlagLoopback != 0 {
+			loopback = ifi.Name
+			break
+		}
+	}
+	if loopback == "" {
+		t.Skip("没有回环网卡")
+	}
+	if err := c.SetInterface(loopback); err != nil {
+		t.Fatal(err)
+	}
+	if got := getBody(t, c, srv.URL); got != "127.0.0.1" {
+		t.Errorf("源地址为%s", got)
+	}
+	if err := c.SetInterface("no-such-iface0"); err == nil {
+		t.Error("不存在的网卡应返回错误")
+	}
+}
@@ -0,0 +1,150 @@
+package goproxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"time"
+)
+
+// ErrStopPolling LongPollHandler返回该错误时LongPoll正常结束并返回nil
+var ErrStopPolling = errors.New("停止轮询")
+
+// LongPollHandler 处理一次长轮询得到的响应，返回后响应体被关闭
+// next为下一次轮询的请求，可以修改其URL和请求头以携带新的游标；返回错误时LongPoll结束
+type LongPollHandler func(resp *http.Response, next *http.Request) error
+
+// LongPollOption LongPoll的选项
+type LongPollOption func(*longPoll)
+
+// longPoll LongPoll的配置
+type longPoll struct {
+	interval time.Duration
+	retry    RetryPolicy
+	timeout  time.Duration
+}
+
+// WithPollInterval 设置一次轮询完成后到发起下一次轮询的等待时间，实际等待[d/2, d]之间的随机时间以避免大量客户端同时请求，默认不等待
+func WithPollInterval(d time.Duration) LongPollOption {
+	return func(p *longPoll) {
+		p.interval = d
+	}
+}
+
+// WithPollRetry 设置轮询出错后的退避策略，Attempts为允许连续失败的次数，小于等于0时不限制，默认从100ms退避到10s
+func WithPollRetry(p RetryPolicy) LongPollOption {
+	return func(lp *longPoll) {
+		lp.retry = p
+	}
+}
+
+// WithPollTimeout 设置单次轮询的超时，超时视为本次轮询完成而不是错误，立即发起下一次轮询。
+// 默认只受客户端超时(SetTimeout)的限制，长轮询的等待时间较长时需要相应调大
+func WithPollTimeout(d time.Duration) LongPollOption {
+	return func(p *longPoll) {
+		p.timeout = d
+	}
+}
+
+// LongPoll 反复发送长轮询请求，直到ctx结束、handler返回错误或出现不可重试的错误，用于只提供长轮询变更通知的API。
+// 请求通过Do发送，使用客户端的代理和请求头等配置。每次轮询的结果:
+//   - 2xx(204除外): 调用handler，之后发起下一次轮询
+//   - 204、304或超时: 没有新数据，直接发起下一次轮询
+//   - 其他状态码和网络错误: ClassifyRetry判断可以重试时按退避策略等待后重试，否则返回错误
+//
+// 参数:
+//   - ctx: 结束轮询的上下文，结束时返回ctx.Err()
+//   - req: 轮询请求，有请求体时需要能够通过GetBody重新获取
+//   - handler: 处理响应的函数，返回ErrStopPolling时LongPoll返回nil
+//   - opts: 选项
+func (r *GoProxy) LongPoll(ctx context.Context, req *http.Request, handler LongPollHandler, opts ...LongPollOption) error {
+	var p longPoll
+	for _, opt := range opts {
+		opt(&p)
+	}
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return errors.New("长轮询请求的请求体无法重新获取")
+	}
+	failures := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		next, err := rewindRequest(req)
+		if err != nil {
+			return err
+		}
+		next = next.Clone(ctx)
+		wait, err := r.poll(next, &p, handler, failures)
+		switch {
+		case errors.Is(err, ErrStopPolling):
+			return nil
+		case err == nil:
+			failures = 0
+			req = next
+			wait = jitter(p.interval)
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case wait < 0:
+			return err
+		default:
+			if failures++; p.retry.Attempts > 0 && failures > p.retry.Attempts {
+				return fmt.Errorf("长轮询连续失败%d次: %w", failures, err)
+			}
+		}
+		if err := sleepContext(ctx, wait); err != nil {
+			return err
+		}
+	}
+}
+
+// poll 发送一次轮询请求，成功时返回nil；可以重试的错误返回按此前连续失败的次数failures退避的等待时间，
+// 不可重试的错误和handler的错误返回-1
+func (r *GoProxy) poll(req *http.Request, p *longPoll, handler LongPollHandler, failures int) (time.Duration, error) {
+	ctx := req.Context()
+	send := req
+	if p.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.timeout)
+		defer cancel()
+		send = req.WithContext(ctx)
+	}
+	resp, err := r.Do(send)
+	if err != nil {
+		if req.Context().Err() == nil && isTimeout(err) {
+			// 服务器在超时前没有新数据
+			return 0, nil
+		}
+		if ClassifyRetry(nil, err) == RetryNever {
+			return -1, err
+		}
+		return p.retry.backoff(failures), err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNoContent || resp.StatusCode == http.StatusNotModified:
+		return 0, nil
+	case resp.StatusCode/100 == 2:
+		if err := handler(resp, req); err != nil {
+			return -1, err
+		}
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		return 0, nil
+	}
+	se, _ := newStatusError(req, resp, statusErrorBodyLimit)
+	if ClassifyRetry(resp, nil) == RetryNever {
+		return -1, se
+	}
+	return retryAfter(resp, p.retry.backoff(failures), p.retry.maxBackoff()), se
+}
+
+// jitter 返回[d/2, d]之间的随机时间，d小于等于0时返回0
+func jitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + rand.N(d/2+1)
+}
@@ -0,0 +1,92 @@
+package goproxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGoProxy_LongPoll(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := requests.Add(1)
+		since, _ := strconv.Atoi(r.URL.Query().Get("since"))
+		switch n {
+		case 2:
+			// 没有新数据
+			w.WriteHeader(http.StatusNoContent)
+			return
+		case 3:
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		case 4:
+			// 超过单次轮询的超时
+			time.Sleep(200 * time.Millisecond)
+			return
+		}
+		fmt.Fprintf(w, "%d", since+1)
+	}))
+	defer srv.Close()
+
+	c := New()
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/events?since=0", nil)
+	var events []string
+	err := c.LongPoll(context.Background(), req, func(resp *http.Response, next *http.Request) error {
+		body, _ := io.ReadAll(resp.Body)
+		events = append(events, string(body))
+		if len(events) == 3 {
+			return ErrStopPolling
+		}
+		q := next.URL.Query()
+		q.Set("since", string(body))
+		next.URL.RawQuery = q.Encode()
+		return nil
+	}, WithPollTimeout(50*time.Millisecond), WithPollRetry(RetryPolicy{Backoff: time.Millisecond}), WithPollInterval(time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(events) != "[1 2 3]" || requests.Load() != 6 {
+		t.Errorf("事件为%v，请求了%d次", events, requests.Load())
+	}
+}
+
+func TestGoProxy_LongPollErrors(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.URL.Path == "/forbidden" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+	c := New()
+	handler := func(*http.Response, *http.Request) error { return nil }
+
+	// 不可重试的状态码立即返回
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/forbidden", nil)
+	if err := c.LongPoll(context.Background(), req, handler); !errors.Is(err, ErrUnexpectedStatus) || requests.Load() != 1 {
+		t.Errorf("错误为%v，请求了%d次", err, requests.Load())
+	}
+	// 超过连续失败次数
+	req, _ = http.NewRequest(http.MethodGet, srv.URL+"/bad", nil)
+	err := c.LongPoll(context.Background(), req, handler, WithPollRetry(RetryPolicy{Attempts: 2, Backoff: time.Millisecond}))
+	if !errors.Is(err, ErrUnexpectedStatus) || requests.Load() != 4 {
+		t.Errorf("错误为%v，请求了%d次", err, requests.Load())
+	}
+	// ctx结束
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = c.LongPoll(ctx, req, handler, WithPollRetry(RetryPolicy{Backoff: 10 * time.Millisecond}))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("ctx结束时错误为%v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package goproxy
+
+import (
+	"container/list"
+	"sync"
+)
+
+// lruItem LRU链表中的一条记录
+type lruItem struct {
+	key  string
+	data []byte
+}
+
+// LRUCache 按字节数限制大小的内存缓存存储，实现CacheStorage接口
+// 每条记录按键和数据的长度之和计算大小，总大小超过上限时删除最久未访问的记录，适合缓存大量较小的响应
+type LRUCache struct {
+	maxBytes int64
+
+	mu    sync.Mutex
+	ll    *list.List               // 按访问时间排序，表头为最近访问
+	items map[string]*list.Element // 键 -> 链表中的记录
+	size  int64                    // 所有记录的总大小
+}
+
+// NewLRUCache 创建LRU内存缓存存储
+// 参数:
+//   - maxBytes: 总大小上限，小于等于0时不限制
+func NewLRUCache(maxBytes int64) *LRUCache {
+	return &LRUCache{maxBytes: maxBytes, ll: list.New(), items: make(map[string]*list.Element)}
+}
+
+// Get 实现CacheStorage接口
+func (c *LRUCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.ll.MoveToFront(el)
+	return el.Value.(*lruItem).data, true
+}
+
+// Set 实现CacheStorage接口，单条记录超过大小上限时不保存
+func (c *LRUCache) Set(key string, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	size := int64(len(key) + len(data))
+	if c.maxBytes > 0 && size > c.maxBytes {
+		c.remove(key)
+		return
+	}
+	if el, ok := c.items[key]; ok {
+		item := el.Value.(*lruItem)
+		c.size += int64(len(data) - len(item.data))
+		item.data = data
+		c.ll.MoveToFront(el)
+	} else {
+		c.items[key] = c.ll.PushFront(&lruItem{key: key, data: data})
+		c.size += size
+	}
+	for c.maxBytes > 0 && c.size > c.maxBytes {
+		c.remove(c.ll.Back().Value.(*lruItem).key)
+	}
+}
+
+// Delete 实现CacheStorage接口
+func (c *LRUCache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.remove(key)
+}
+
+// Len 返回缓存的记录数
+func (c *LRUCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+// Size 返回所有记录的总大小
+func (c *LRUCache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+// remove 删除记录，调用方需持有锁
+func (c *LRUCache) remove(key string) {
+	el, ok := c.items[key]
+	if !ok {
+		return
+	}
+	item := c.ll.Remove(el).(*lruItem)
+	delete(c.items, key)
+	c.size -= int64(len(item.key) + len(item.data))
+}
@@ -0,0 +1,53 @@
+package goproxy
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestLRUCache(t *testing.T) {
+	c := NewLRUCache(12)
+	c.Set("a", []byte("1234"))
+	c.Set("b", []byte("1234"))
+	if c.Size() != 10 || c.Len() != 2 {
+		t.Errorf("总大小为%d, 记录数为%d", c.Size(), c.Len())
+	}
+	// 访问a后b成为最久未访问的记录
+	c.Get("a")
+	c.Set("c", []byte("12"))
+	if _, ok := c.Get("b"); ok {
+		t.Error("最久未访问的记录未被淘汰")
+	}
+	if data, ok := c.Get("a"); !ok || string(data) != "1234" {
+		t.Errorf("a的数据为%q", data)
+	}
+	// 更新已有的记录
+	c.Set("a", []byte("12"))
+	if c.Size() != 6 {
+		t.Errorf("更新后总大小为%d", c.Size())
+	}
+	c.Set("big", []byte(strings.Repeat("x", 10)))
+	if _, ok := c.Get("big"); ok || c.Len() != 2 {
+		t.Errorf("超过上限的数据被保存，记录数为%d", c.Len())
+	}
+	c.Delete("a")
+	if _, ok := c.Get("a"); ok || c.Size() != 3 {
+		t.Errorf("删除后总大小为%d", c.Size())
+	}
+}
+
+func TestLRUCache_CacheTransport(t *testing.T) {
+	srv, requests := newTestCacheServer(t)
+	c := New()
+	c.SetTransport(NewCacheTransport(NewLRUCache(1<<20), c.GetTransport()))
+	for i := 0; i < 3; i++ {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/fresh", nil)
+		if got := doBody(t, c, req); got != "1" {
+			t.Errorf("响应为%q", got)
+		}
+	}
+	if requests.Load() != 1 {
+		t.Errorf("请求了%d次", requests.Load())
+	}
+}
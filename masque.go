@@ -0,0 +1,252 @@
+package goproxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultMASQUETemplate CONNECT-UDP请求使用的默认URI模板(RFC 9298)
+const DefaultMASQUETemplate = "/.well-known/masque/udp/{target_host}/{target_port}/"
+
+// capsuleDatagram DATAGRAM capsule的类型(RFC 9297)
+const capsuleDatagram = 0x00
+
+// maxCapsuleSize 接受的最大capsule长度，足够容纳任意UDP数据报
+const maxCapsuleSize = 1 << 17
+
+// SetMASQUETemplate 设置CONNECT-UDP请求使用的URI模板，为空时使用DefaultMASQUETemplate
+// 模板中的{target_host}和{target_port}分别替换为目标主机和端口
+func (r *GoProxy) SetMASQUETemplate(tmpl string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.masqueTemplate = tmpl
+}
+
+// DialUDP 按当前代理配置建立到addr(host:port)的UDP"连接"
+// 返回的连接每次Write发送一个数据报，每次Read读取一个数据报，可用于DNS、QUIC等基于UDP的协议。
+//   - 使用HTTP/HTTPS代理时: 代理需支持MASQUE(CONNECT-UDP，RFC 9298)，
+//     通过HTTP/1.1 Upgrade建立隧道，数据报以DATAGRAM capsule传输
+//   - 使用SOCKS5代理时: 通过UDP ASSOCIATE由代理中继，见ListenUDP
+//   - 未使用代理时: 直接建立UDP连接
+//
+// 设置了SSRF防护时与DialContext相同，连接前检查目标的主机名、端口和IP，直接连接时检查解析后的每个地址，
+// 通过代理且开启ResolveForProxy时在本地解析并检查后让代理连接该IP地址
+func (r *GoProxy) DialUDP(ctx context.Context, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	httpProxy := r.httpProxy
+	socksProxy := r.socksProxy
+	tmpl := r.masqueTemplate
+	guard := r.ssrfGuard
+	r.mu.Unlock()
+	if guard != nil {
+		if err := guard.checkTarget(addr); err != nil {
+			return nil, r.annotate(ctx, err, PhaseDial)
+		}
+		if guard.spec.ResolveForProxy && (httpProxy != nil || socksProxy != nil) {
+			if addr, err = r.resolveForProxy(ctx, guard, "udp", addr); err != nil {
+				return nil, r.annotate(ctx, err, PhaseResolve)
+			}
+			host, port, _ = net.SplitHostPort(addr)
+		}
+	}
+	switch {
+	case httpProxy != nil:
+		return r.dialMASQUE(ctx, httpProxy, tmpl, host, port)
+	case socksProxy != nil:
+		pc, err := listenSOCKS5UDP(ctx, r.dialDirect, socksProxy)
+		if err != nil {
+			return nil, err
+		}
+		return &packetConnAdapter{PacketConn: pc, remote: tunnelAddr{"udp", addr}}, nil
+	default:
+		if guard != nil {
+			ctx = context.WithValue(ctx, ssrfGuardKey{}, guard)
+		}
+		return r.dialDirect(ctx, "udp", addr)
+	}
+}
+
+// dialMASQUE 通过代理的CONNECT-UDP建立到host:port的UDP隧道
+func (r *GoProxy) dialMASQUE(ctx context.Context, proxyURL *url.URL, tmpl, host, port string) (net.Conn, error) {
+	if tmpl == "" {
+		tmpl = DefaultMASQUETemplate
+	}
+	path := strings.NewReplacer(
+		"{target_host}", url.PathEscape(host),
+		"{target_port}", url.PathEscape(port),
+	).Replace(tmpl)
+
+	conn, err := r.dialProxy(ctx, proxyURL)
+	if err != nil {
+		return nil, err
+	}
+	conn = r.bandwidth.wrapConn(conn)
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	req := &http.Request{
+		Method: http.MethodGet,
+		URL:    &url.URL{Opaque: path},
+		Host:   proxyURL.Host,
+		Header: http.Header{
+			"Connection":       {"Upgrade"},
+			"Upgrade":          {"connect-udp"},
+			"Capsule-Protocol": {"?1"},
+		},
+	}
+	if auth := proxyAuthorization(proxyURL); auth != "" {
+		req.Header.Set("Proxy-Authorization", auth)
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("发送CONNECT-UDP请求失败: %w", err)
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("读取CONNECT-UDP响应失败: %w", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		resp.Body.Close()
+		conn.Close()
+		return nil, fmt.Errorf("代理服务器拒绝CONNECT-UDP请求: %s", resp.Status)
+	}
+	return &masqueConn{
+		Conn:   conn,
+		br:     br,
+		remote: tunnelAddr{"udp", net.JoinHostPort(host, port)},
+	}, nil
+}
+
+// masqueConn 将CONNECT-UDP隧道包装为面向数据报的net.Conn
+type masqueConn struct {
+	net.Conn
+	br     *bufio.Reader
+	remote net.Addr
+	wmu    sync.Mutex
+}
+
+// Read 读取一个数据报，b不足以容纳时多余部分被丢弃，与UDP套接字的行为一致
+func (c *masqueConn) Read(b []byte) (int, error) {
+	for {
+		typ, payload, err := readCapsule(c.br)
+		if err != nil {
+			return 0, err
+		}
+		if typ != capsuleDatagram {
+			// 忽略未知类型的capsule
+			continue
+		}
+		id, n := parseVarint(payload)
+		if n == 0 || id != 0 {
+			// 只处理上下文ID为0的UDP负载
+			continue
+		}
+		return copy(b, payload[n:]), nil
+	}
+}
+
+// Write 以DATAGRAM capsule发送一个数据报
+func (c *masqueConn) Write(b []byte) (int, error) {
+	buf := appendVarint(nil, capsuleDatagram)
+	buf = appendVarint(buf, uint64(len(b)+1))
+	buf = append(buf, 0) // 上下文ID
+	buf = append(buf, b...)
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if _, err := c.Conn.Write(buf); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (c *masqueConn) RemoteAddr() net.Addr { return c.remote }
+
+// readCapsule 读取一个capsule，返回类型和内容
+func readCapsule(br *bufio.Reader) (uint64, []byte, error) {
+	typ, err := readVarint(br)
+	if err != nil {
+		return 0, nil, err
+	}
+	length, err := readVarint(br)
+	if err != nil {
+		return 0, nil, err
+	}
+	if length > maxCapsuleSize {
+		return 0, nil, fmt.Errorf("capsule过大: %d字节", length)
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(br, payload); err != nil {
+		return 0, nil, err
+	}
+	return typ, payload, nil
+}
+
+// readVarint 从br中读取一个QUIC变长整数(RFC 9000 16节)
+func readVarint(br *bufio.Reader) (uint64, error) {
+	first, err := br.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	n := 1 << (first >> 6)
+	v := uint64(first & 0x3f)
+	for i := 1; i < n; i++ {
+		b, err := br.ReadByte()
+		if err != nil {
+			return 0, io.ErrUnexpectedEOF
+		}
+		v = v<<8 | uint64(b)
+	}
+	return v, nil
+}
+
+// parseVarint 从b的开头解析一个QUIC变长整数，返回值和占用的字节数，b不完整时字节数为0
+func parseVarint(b []byte) (uint64, int) {
+	if len(b) == 0 {
+		return 0, 0
+	}
+	n := 1 << (b[0] >> 6)
+	if len(b) < n {
+		return 0, 0
+	}
+	v := uint64(b[0] & 0x3f)
+	for i := 1; i < n; i++ {
+		v = v<<8 | uint64(b[i])
+	}
+	return v, n
+}
+
+// appendVarint 以QUIC变长整数编码追加v
+func appendVarint(b []byte, v uint64) []byte {
+	switch {
+	case v < 1<<6:
+		return append(b, byte(v))
+	case v < 1<<14:
+		return binary.BigEndian.AppendUint16(b, uint16(v)|0x4000)
+	case v < 1<<30:
+		return binary.BigEndian.AppendUint32(b, uint32(v)|0x80000000)
+	default:
+		return binary.BigEndian.AppendUint64(b, v|0xc000000000000000)
+	}
+}
@@ -0,0 +1,199 @@
+package goproxy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestUDPEcho 启动一个原样返回数据报的UDP服务
+func newTestUDPEcho(t *testing.T) string {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			pc.WriteTo(buf[:n], addr)
+		}
+	}()
+	return pc.LocalAddr().String()
+}
+
+// newTestMASQUEProxy 启动一个通过HTTP/1.1 Upgrade提供CONNECT-UDP的代理
+func newTestMASQUEProxy(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/.well-known/masque/udp/"), "/")
+		if r.Header.Get("Upgrade") != "connect-udp" || len(parts) < 2 {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		host, _ := url.PathUnescape(parts[0])
+		upstream, err := net.Dial("udp", net.JoinHostPort(host, parts[1]))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer upstream.Close()
+		conn, brw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.WriteString(conn, "HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: connect-udp\r\nCapsule-Protocol: ?1\r\n\r\n")
+		go func() {
+			buf := make([]byte, 65535)
+			for {
+				n, err := upstream.Read(buf)
+				if err != nil {
+					return
+				}
+				capsule := appendVarint(nil, capsuleDatagram)
+				capsule = appendVarint(capsule, uint64(n+1))
+				capsule = append(append(capsule, 0), buf[:n]...)
+				conn.Write(capsule)
+			}
+		}()
+		for {
+			typ, payload, err := readCapsule(brw.Reader)
+			if err != nil {
+				return
+			}
+			if typ == capsuleDatagram {
+				upstream.Write(payload[1:])
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestGoProxy_DialUDP(t *testing.T) {
+	echo := newTestUDPEcho(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	check := func(c *GoProxy) {
+		t.Helper()
+		conn, err := c.DialUDP(ctx, echo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		for _, msg := range []string{"hello", strings.Repeat("x", 1200)} {
+			if _, err := conn.Write([]byte(msg)); err != nil {
+				t.Fatal(err)
+			}
+			buf := make([]byte, 2048)
+			n, err := conn.Read(buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(buf[:n]) != msg {
+				t.Fatalf("数据报内容不一致: %q", buf[:n])
+			}
+		}
+	}
+
+	c := New()
+	check(c)
+	if err := c.SetProxy(newTestMASQUEProxy(t).URL); err != nil {
+		t.Fatal(err)
+	}
+	check(c)
+	if conn, err := c.DialUDP(ctx, echo); err == nil {
+		if conn.RemoteAddr().Network() != "udp" {
+			t.Errorf("RemoteAddr网络类型应为udp")
+		}
+		conn.Close()
+	}
+
+	// 代理不支持CONNECT-UDP时返回错误
+	p, _ := newTestProxy(t)
+	if err := c.SetProxy(p.URL); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.DialUDP(ctx, echo); err == nil {
+		t.Error("代理不支持CONNECT-UDP时应返回错误")
+	}
+}
+
+func TestVarint(t *testing.T) {
+	for _, v := range []uint64{0, 63, 64, 16383, 16384, 1<<30 - 1, 1 << 30, 1<<62 - 1} {
+		b := appendVarint(nil, v)
+		got, n := parseVarint(b)
+		if got != v || n != len(b) {
+			t.Errorf("parseVarint(%d) = %d, %d", v, got, n)
+		}
+		got2, err := readVarint(bufio.NewReader(bytes.NewReader(b)))
+		if err != nil || got2 != v {
+			t.Errorf("readVarint(%d) = %d, %v", v, got2, err)
+		}
+	}
+}
+
+func TestGoProxy_DialUDPSSRFGuard(t *testing.T) {
+	echo := newTestUDPEcho(t)
+	_, port, _ := net.SplitHostPort(echo)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	c := New()
+	c.SetResolver(staticResolver{"loop.test": {{IP: net.ParseIP("127.0.0.1")}}})
+	c.SetSSRFGuard(&SSRFGuard{})
+	// 直接连接时检查目标和解析后的地址，各种代理下同样检查目标
+	for _, proxyURL := range []string{"", newTestMASQUEProxy(t).URL, "socks5://127.0.0.1:1"} {
+		if proxyURL != "" {
+			if err := c.SetProxy(proxyURL); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := c.DialUDP(ctx, echo); !errors.Is(err, ErrDestinationDenied) {
+			t.Errorf("代理%q下连接回环地址的错误为%v", proxyURL, err)
+		}
+		if _, err := c.DialUDP(ctx, "localhost:"+port); !errors.Is(err, ErrDestinationDenied) {
+			t.Errorf("代理%q下连接localhost的错误为%v", proxyURL, err)
+		}
+	}
+	c.SetProxy("")
+	if _, err := c.DialUDP(ctx, "loop.test:"+port); !errors.Is(err, ErrDestinationDenied) {
+		t.Errorf("直接连接解析到回环地址的域名的错误为%v", err)
+	}
+
+	// ResolveForProxy时在本地解析，代理连接检查通过的IP地址
+	c.SetProxy(newTestMASQUEProxy(t).URL)
+	c.SetSSRFGuard(&SSRFGuard{ResolveForProxy: true})
+	if _, err := c.DialUDP(ctx, "loop.test:"+port); !errors.Is(err, ErrDestinationDenied) {
+		t.Errorf("通过代理连接解析到回环地址的域名的错误为%v", err)
+	}
+	c.SetSSRFGuard(&SSRFGuard{AllowCIDRs: []string{"127.0.0.0/8"}, ResolveForProxy: true})
+	conn, err := c.DialUDP(ctx, "loop.test:"+port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	conn.Write([]byte("hello"))
+	buf := make([]byte, 16)
+	if n, err := conn.Read(buf); err != nil || string(buf[:n]) != "hello" {
+		t.Errorf("读取到%q，错误为%v", buf[:n], err)
+	}
+}
@@ -0,0 +1,197 @@
+// Package mock 提供用于单元测试的桩RoundTripper
+// 按请求方法和URL(精确匹配、正则或自定义函数)匹配请求并返回预设的响应，
+// 可通过GoProxy.SetTransportRoundTripper安装，使测试无需访问网络
+package mock
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+)
+
+// ErrNoMatch 没有路由匹配请求时返回的错误
+var ErrNoMatch = errors.New("mock: 没有匹配的路由")
+
+// Transport 桩RoundTripper，按注册顺序匹配路由
+type Transport struct {
+	mu     sync.Mutex
+	routes []*Route
+	calls  []*http.Request
+}
+
+// New 创建一个空的mock Transport
+func New() *Transport {
+	return &Transport{}
+}
+
+// Route 一条路由规则及其预设响应
+type Route struct {
+	t       *Transport // 所属的Transport，hits和times由其mu保护
+	match   func(*http.Request) bool
+	status  int
+	header  http.Header
+	body    []byte
+	err     error
+	handler func(*http.Request) (*http.Response, error)
+	times   int // 剩余可匹配次数，<=0表示不限
+	limited bool
+	hits    int
+}
+
+// On 注册精确匹配的路由
+// 参数:
+//   - method: 请求方法，为空时匹配任意方法
+//   - url: 完整的请求URL，需与req.URL.String()完全一致
+func (t *Transport) On(method, url string) *Route {
+	return t.OnFunc(func(req *http.Request) bool {
+		return methodMatch(method, req) && req.URL.String() == url
+	})
+}
+
+// OnRegexp 注册按正则表达式匹配URL的路由
+// 参数:
+//   - method: 请求方法，为空时匹配任意方法
+//   - pattern: 匹配req.URL.String()的正则表达式
+func (t *Transport) OnRegexp(method, pattern string) *Route {
+	re := regexp.MustCompile(pattern)
+	return t.OnFunc(func(req *http.Request) bool {
+		return methodMatch(method, req) && re.MatchString(req.URL.String())
+	})
+}
+
+// OnFunc 注册自定义匹配函数的路由
+func (t *Transport) OnFunc(match func(*http.Request) bool) *Route {
+	rt := &Route{t: t, match: match, status: http.StatusOK, header: make(http.Header)}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.routes = append(t.routes, rt)
+	return rt
+}
+
+func methodMatch(method string, req *http.Request) bool {
+	return method == "" || method == req.Method
+}
+
+// Respond 设置响应状态码和响应体
+func (r *Route) Respond(status int, body string) *Route {
+	r.status = status
+	r.body = []byte(body)
+	return r
+}
+
+// RespondJSON 设置状态码并将v序列化为JSON响应体，同时设置Content-Type
+func (r *Route) RespondJSON(status int, v any) *Route {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(fmt.Sprintf("mock: 序列化JSON失败: %v", err))
+	}
+	r.status = status
+	r.body = b
+	r.header.Set("Content-Type", "application/json")
+	return r
+}
+
+// Header 设置响应头
+func (r *Route) Header(key, value string) *Route {
+	r.header.Add(key, value)
+	return r
+}
+
+// Error 使匹配的请求返回错误而不是响应，用于模拟网络故障
+func (r *Route) Error(err error) *Route {
+	r.err = err
+	return r
+}
+
+// Handle 使用自定义函数生成响应
+func (r *Route) Handle(fn func(*http.Request) (*http.Response, error)) *Route {
+	r.handler = fn
+	return r
+}
+
+// Times 限制路由可匹配的次数，用尽后继续匹配后面注册的路由
+func (r *Route) Times(n int) *Route {
+	r.times = n
+	r.limited = true
+	return r
+}
+
+// Hits 返回路由被匹配的次数
+func (r *Route) Hits() int {
+	r.t.mu.Lock()
+	defer r.t.mu.Unlock()
+	return r.hits
+}
+
+// response 根据预设构造响应，每次调用都返回新的响应体
+func (r *Route) response(req *http.Request) (*http.Response, error) {
+	if r.handler != nil {
+		return r.handler(req)
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	header := r.header.Clone()
+	header.Set("Content-Length", strconv.Itoa(len(r.body)))
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", r.status, http.StatusText(r.status)),
+		StatusCode:    r.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(r.body)),
+		ContentLength: int64(len(r.body)),
+		Request:       req,
+	}, nil
+}
+
+// RoundTrip 实现http.RoundTripper接口
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	t.calls = append(t.calls, req)
+	var matched *Route
+	for _, rt := range t.routes {
+		if rt.limited && rt.times <= 0 {
+			continue
+		}
+		if rt.match(req) {
+			matched = rt
+			rt.hits++
+			if rt.limited {
+				rt.times--
+			}
+			break
+		}
+	}
+	t.mu.Unlock()
+
+	if req.Body != nil {
+		defer req.Body.Close()
+	}
+	if matched == nil {
+		return nil, fmt.Errorf("%w: %s %s", ErrNoMatch, req.Method, req.URL)
+	}
+	return matched.response(req)
+}
+
+// Calls 返回收到的所有请求
+func (t *Transport) Calls() []*http.Request {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]*http.Request(nil), t.calls...)
+}
+
+// Reset 清空所有路由和请求记录
+func (t *Transport) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.routes = nil
+	t.calls = nil
+}
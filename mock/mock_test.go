@@ -0,0 +1,78 @@
+package mock
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/fasnow/goproxy"
+)
+
+func TestTransport(t *testing.T) {
+	m := New()
+	m.On("GET", "https://api.example.com/users/1").RespondJSON(200, map[string]int{"id": 1})
+	m.OnRegexp("", `/limited$`).Respond(503, "busy").Times(1)
+	m.OnRegexp("", `/limited$`).Respond(200, "ok")
+
+	c := goproxy.New()
+	c.SetTransportRoundTripper(m)
+
+	resp, err := c.GetClient().Get("https://api.example.com/users/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 200 || string(body) != `{"id":1}` {
+		t.Errorf("响应错误: %d %s", resp.StatusCode, body)
+	}
+
+	for _, want := range []int{503, 200} {
+		resp, err := c.GetClient().Get("https://api.example.com/limited")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("期望状态码%d，实际%d", want, resp.StatusCode)
+		}
+	}
+
+	if _, err := c.GetClient().Get("https://api.example.com/other"); !errors.Is(err, ErrNoMatch) {
+		t.Errorf("期望ErrNoMatch，实际%v", err)
+	}
+
+	calls := m.Calls()
+	if len(calls) != 4 {
+		t.Fatalf("期望4次请求，实际%d次", len(calls))
+	}
+	if calls[0].Header.Get("User-Agent") != goproxy.DefaultUA {
+		t.Error("全局请求头未生效")
+	}
+}
+
+func TestRoute_HitsConcurrent(t *testing.T) {
+	m := New()
+	route := m.OnRegexp("", `/ping$`).Respond(200, "pong")
+	c := goproxy.New()
+	c.SetTransportRoundTripper(m)
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 10 {
+				if resp, err := c.GetClient().Get("https://api.example.com/ping"); err == nil {
+					resp.Body.Close()
+				}
+				route.Hits()
+			}
+		}()
+	}
+	wg.Wait()
+	if route.Hits() != 80 {
+		t.Errorf("路由被匹配%d次", route.Hits())
+	}
+}
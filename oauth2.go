@@ -0,0 +1,63 @@
+package goproxy
+
+import (
+	"context"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// OAuth2Context 返回携带当前客户端的context，传给golang.org/x/oauth2的Config.Exchange、Config.TokenSource等方法后，
+// 获取和刷新令牌的请求同样经过代理、全局请求头、TLS指纹等设置，而不是使用oauth2默认的http.DefaultClient。
+// 这些请求不携带SetTokenSource等设置的令牌
+func (r *GoProxy) OAuth2Context(ctx context.Context) context.Context {
+	return context.WithValue(context.WithValue(ctx, noTokenKey{}, true), oauth2.HTTPClient, r.client)
+}
+
+// oauth2Tokens 由fetch获取oauth2令牌的tokenCache，按令牌的过期时间缓存
+func oauth2Tokens(fetch func(ctx context.Context) (*oauth2.Token, error)) *tokenCache {
+	return &tokenCache{fetch: func(ctx context.Context) (string, time.Time, error) {
+		tok, err := fetch(ctx)
+		if err != nil || tok.AccessToken == "" {
+			return "", time.Time{}, err
+		}
+		return tok.Type() + " " + tok.AccessToken, tok.Expiry, nil
+	}}
+}
+
+// SetOAuth2TokenSource 使用oauth2.TokenSource为所有请求添加令牌，行为与SetTokenSource相同，
+// 令牌按其过期时间缓存，过期前自动重新获取
+// 参数:
+//   - ts: 令牌来源，通常由oauth2.Config.TokenSource(r.OAuth2Context(ctx), token)创建；为nil时取消令牌认证。
+//     注意: oauth2.ReuseTokenSource在令牌过期前总是返回同一令牌，服务器返回401后的重试可能仍使用原令牌
+func (r *GoProxy) SetOAuth2TokenSource(ts oauth2.TokenSource) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ct := r.transport
+	if ts == nil {
+		ct.tokens.Store(nil)
+		return
+	}
+	ct.tokens.Store(oauth2Tokens(func(context.Context) (*oauth2.Token, error) {
+		return ts.Token()
+	}))
+}
+
+// SetClientCredentials 使用OAuth2客户端凭据模式(RFC 6749第4.4节)为所有请求添加令牌，
+// 令牌请求经由当前客户端发送；令牌过期或服务器返回401时重新获取
+// 参数:
+//   - cfg: 客户端凭据配置，调用后修改cfg不影响已设置的认证；为nil时取消令牌认证
+func (r *GoProxy) SetClientCredentials(cfg *clientcredentials.Config) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ct := r.transport
+	if cfg == nil {
+		ct.tokens.Store(nil)
+		return
+	}
+	c := *cfg
+	ct.tokens.Store(oauth2Tokens(func(ctx context.Context) (*oauth2.Token, error) {
+		return c.Token(r.OAuth2Context(ctx))
+	}))
+}
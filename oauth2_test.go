@@ -0,0 +1,92 @@
+package goproxy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// newTestOAuth2Server /token按客户端凭据模式签发令牌，其他路径只接受最近签发的令牌
+func newTestOAuth2Server(t *testing.T, expiresIn int) (*httptest.Server, *atomic.Int64) {
+	var issued atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			id, secret, _ := r.BasicAuth()
+			if r.FormValue("grant_type") != "client_credentials" || id != "id" || secret != "secret" || r.Header.Get("X-Worker") != "1" {
+				http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"access_token":"tk%d","token_type":"bearer","expires_in":%d}`, issued.Add(1), expiresIn)
+			return
+		}
+		if r.Header.Get("Authorization") != fmt.Sprintf("Bearer tk%d", issued.Load()) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		io.WriteString(w, r.Header.Get("Authorization"))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &issued
+}
+
+func TestGoProxy_SetClientCredentials(t *testing.T) {
+	srv, issued := newTestOAuth2Server(t, 3600)
+	c := New()
+	c.SetGlobalHeader("X-Worker", "1")
+	c.SetClientCredentials(&clientcredentials.Config{ClientID: "id", ClientSecret: "secret", TokenURL: srv.URL + "/token"})
+	for i := 0; i < 2; i++ {
+		if got := getBody(t, c, srv.URL+"/api"); got != "Bearer tk1" {
+			t.Errorf("响应为%q", got)
+		}
+	}
+	if issued.Load() != 1 {
+		t.Errorf("令牌签发了%d次", issued.Load())
+	}
+
+	// 服务器拒绝令牌后重新获取
+	issued.Add(1)
+	if got := getBody(t, c, srv.URL+"/api"); got != "Bearer tk3" {
+		t.Errorf("令牌被拒绝后响应为%q", got)
+	}
+
+	c.SetClientCredentials(&clientcredentials.Config{ClientID: "id", ClientSecret: "wrong", TokenURL: srv.URL + "/token"})
+	if _, err := c.GetClient().Get(srv.URL + "/api"); err == nil {
+		t.Error("获取令牌失败时应返回错误")
+	}
+}
+
+func TestGoProxy_SetOAuth2TokenSource(t *testing.T) {
+	// 令牌有效期短于tokenExpiryDelta，每次请求都重新获取
+	srv, _ := newTestOAuth2Server(t, 5)
+	c := New()
+	c.SetGlobalHeader("X-Worker", "1")
+	cfg := &clientcredentials.Config{ClientID: "id", ClientSecret: "secret", TokenURL: srv.URL + "/token"}
+	c.SetOAuth2TokenSource(cfg.TokenSource(c.OAuth2Context(context.Background())))
+	for i := 1; i <= 2; i++ {
+		if got := getBody(t, c, srv.URL+"/api"); got != fmt.Sprintf("Bearer tk%d", i) {
+			t.Errorf("响应为%q", got)
+		}
+	}
+
+	c.SetOAuth2TokenSource(oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "tk2"}))
+	if got := getBody(t, c, srv.URL+"/api"); got != "Bearer tk2" {
+		t.Errorf("静态令牌的响应为%q", got)
+	}
+	c.SetOAuth2TokenSource(nil)
+	resp, err := c.GetClient().Get(srv.URL + "/api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("取消后状态码为%d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,123 @@
+package goproxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// RequestOption 单次请求的选项，只对当前请求生效，不影响客户端的全局配置
+type RequestOption func(*requestOptions)
+
+// requestOptions 保存单次请求的选项
+type requestOptions struct {
+	progress       func(written, total int64) // 下载进度回调
+	uploadProgress func(written, total int64) // 上传进度回调
+	downloadBps    int64                      // 单次请求的下载限速
+	uploadBps      int64                      // 单次请求的上传限速
+	serverName     string                     // 单次请求的TLS SNI
+	h2c            bool                       // 单次请求使用h2c
+	httpVersion    string                     // 单次请求强制使用的HTTP版本，"1.0"或"1.1"
+	closeConn      bool                       // 单次请求结束后关闭连接
+	headerOrder    []string                   // 单次请求的请求头顺序
+	authorization  string                     // 单次请求的Authorization请求头
+	redirects      int                        // 单次请求最多跟随的重定向次数
+	redirectsSet   bool                       // 是否设置了单次请求的重定向次数
+
+	expectedStatus    []int             // 单次请求期望的状态码
+	expectedStatusSet bool              // 是否设置了单次请求期望的状态码
+	validator         ResponseValidator // 单次请求检查响应的函数
+	validatorSet      bool              // 是否设置了单次请求检查响应的函数
+}
+
+// ownConn 选项是否影响连接的建立，此时请求需要使用独立的连接
+func (o *requestOptions) ownConn() bool {
+	return o.serverName != "" || o.httpVersion != ""
+}
+
+// requestOptionsKey 请求选项在context中的键
+type requestOptionsKey struct{}
+
+// WithOptions 将请求选项附加到请求上，返回携带选项的新请求
+// 适用于直接通过GetClient().Do发送请求的场景
+func WithOptions(req *http.Request, opts ...RequestOption) *http.Request {
+	if len(opts) == 0 {
+		return req
+	}
+	o := &requestOptions{}
+	if prev := optionsFromRequest(req); prev != nil {
+		copied := *prev
+		o = &copied
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return req.WithContext(context.WithValue(req.Context(), requestOptionsKey{}, o))
+}
+
+// optionsFromRequest 取出请求上携带的选项，没有时返回nil
+func optionsFromRequest(req *http.Request) *requestOptions {
+	o, _ := req.Context().Value(requestOptionsKey{}).(*requestOptions)
+	return o
+}
+
+// Do 发送HTTP请求，opts只对本次请求生效
+// 返回的错误为*url.Error，其中的错误按ErrTimeout等分类，http.Client自身的超时同样匹配ErrTimeout；
+// 状态码不符合SetExpectedStatus期望时其中的错误为*StatusError，见SetExpectedStatus
+func (r *GoProxy) Do(req *http.Request, opts ...RequestOption) (*http.Response, error) {
+	return r.send(r.client, WithOptions(req, opts...))
+}
+
+// send 通过client发送请求，为错误分类并检查响应，见Do
+func (r *GoProxy) send(client *http.Client, req *http.Request) (*http.Response, error) {
+	resp, err := client.Do(req)
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		urlErr.Err = classifyError(urlErr.Err)
+	}
+	if err == nil {
+		if err := r.checkResponse(req, resp); err != nil {
+			return nil, err
+		}
+	}
+	return resp, err
+}
+
+// WithProgress 设置下载进度回调
+// 每次读取响应体时回调，written为已读取的字节数，total为响应的Content-Length，未知时为-1
+func WithProgress(fn func(written, total int64)) RequestOption {
+	return func(o *requestOptions) {
+		o.progress = fn
+	}
+}
+
+// WithUploadProgress 设置上传进度回调
+// 每次发送请求体数据时回调，written为已发送的字节数，total为请求的Content-Length，未知时为-1
+func WithUploadProgress(fn func(written, total int64)) RequestOption {
+	return func(o *requestOptions) {
+		o.uploadProgress = fn
+	}
+}
+
+// progressReader 统计读取字节数并回调进度的ReadCloser
+type progressReader struct {
+	rc      io.ReadCloser
+	written int64
+	total   int64
+	fn      func(written, total int64)
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.rc.Read(b)
+	if n > 0 {
+		p.written += int64(n)
+		p.fn(p.written, p.total)
+	}
+	return n, err
+}
+
+func (p *progressReader) Close() error {
+	return p.rc.Close()
+}
@@ -0,0 +1,40 @@
+package goproxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestGoProxy_DoWithProgress(t *testing.T) {
+	body := strings.Repeat("a", 100000)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		io.WriteString(w, body)
+	}))
+	defer srv.Close()
+
+	var down, downTotal, up, upTotal int64
+	c := New()
+	req, _ := http.NewRequest("POST", srv.URL, strings.NewReader("hello world"))
+	resp, err := c.Do(req,
+		WithProgress(func(written, total int64) { down, downTotal = written, total }),
+		WithUploadProgress(func(written, total int64) { up, upTotal = written, total }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	if down != int64(len(body)) || downTotal != int64(len(body)) {
+		t.Errorf("下载进度错误: %d/%d", down, downTotal)
+	}
+	if up != 11 || upTotal != 11 {
+		t.Errorf("上传进度错误: %d/%d", up, upTotal)
+	}
+}
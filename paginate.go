@@ -0,0 +1,251 @@
+package goproxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// PageStrategy 分页方式，决定如何请求下一页: CursorPages、NumberedPages或LinkPages
+type PageStrategy interface {
+	// nextPage 根据本页的请求、响应、响应体和条目数返回下一页的请求，没有下一页时返回nil
+	nextPage(req *http.Request, resp *http.Response, body []byte, items int) (*http.Request, error)
+}
+
+// CursorPages 游标分页: 从响应体中取出下一页的游标，放入下一页请求的查询参数，游标为空、null或不存在时结束
+type CursorPages struct {
+	Param string // 游标的查询参数名，如"cursor"
+	Field string // 游标在JSON响应体中的路径，以"."分隔，如"meta.next_cursor"
+}
+
+// NumberedPages 页码分页: 依次递增页码，某页的条目数为0或少于Size时结束
+type NumberedPages struct {
+	Param     string // 页码的查询参数名，如"page"
+	Start     int    // 第一页的页码，第一页的请求已带有页码参数时从该值继续递增
+	SizeParam string // 每页条目数的查询参数名，如"per_page"，为空时不设置
+	Size      int    // 每页条目数，大于0时条目数少于该值的页视为最后一页
+}
+
+// LinkPages 按响应的Link请求头(RFC 8288)中rel="next"的地址请求下一页，没有该地址时结束，如GitHub API
+type LinkPages struct{}
+
+// Pagination 分页请求的配置
+type Pagination struct {
+	Strategy PageStrategy // 分页方式
+	Items    string       // 条目数组在JSON响应体中的路径，以"."分隔，如"data"，为空时响应体本身是数组
+	MaxPages int          // 最多请求的页数，小于等于0时不限制
+}
+
+// Page 分页请求得到的一页
+type Page[T any] struct {
+	Number     int         // 页的序号，从1开始
+	Items      []T         // 本页的条目
+	StatusCode int         // 响应的状态码
+	Header     http.Header // 响应头
+	Body       []byte      // 响应体，可用于读取条目以外的字段
+}
+
+// Paginate 从req开始依次请求各页，将每页的条目按JSON解码为T并逐页返回，免去手写的翻页循环。
+// 请求通过c.Do发送，使用客户端的代理和请求头等配置；响应状态码不是2xx时返回*StatusError并结束。
+// 出错后迭代结束，调用方停止迭代时不再请求下一页。req应为GET等没有请求体的请求
+//
+//	for page, err := range goproxy.Paginate[User](c, req, goproxy.Pagination{Strategy: goproxy.LinkPages{}}) {
+//		if err != nil { ... }
+//	}
+func Paginate[T any](c *GoProxy, req *http.Request, p Pagination) iter.Seq2[*Page[T], error] {
+	return func(yield func(*Page[T], error) bool) {
+		if p.Strategy == nil {
+			yield(nil, errors.New("没有设置分页方式"))
+			return
+		}
+		req, err := p.Strategy.nextPage(req, nil, nil, -1)
+		for n := 1; err == nil && req != nil && (p.MaxPages <= 0 || n <= p.MaxPages); n++ {
+			page, resp, fetchErr := fetchPage[T](c, req, p.Items)
+			if fetchErr != nil {
+				yield(nil, fetchErr)
+				return
+			}
+			page.Number = n
+			if !yield(page, nil) {
+				return
+			}
+			req, err = p.Strategy.nextPage(req, resp, page.Body, len(page.Items))
+		}
+		if err != nil {
+			yield(nil, err)
+		}
+	}
+}
+
+// PaginateItems 与Paginate相同，但逐个返回各页的条目
+func PaginateItems[T any](c *GoProxy, req *http.Request, p Pagination) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		for page, err := range Paginate[T](c, req, p) {
+			if err != nil {
+				var zero T
+				yield(zero, err)
+				return
+			}
+			for _, item := range page.Items {
+				if !yield(item, nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// fetchPage 请求一页并解码条目，返回的响应体已经关闭
+func fetchPage[T any](c *GoProxy, req *http.Request, itemsPath string) (*Page[T], *http.Response, error) {
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		se, _ := newStatusError(req, resp, statusErrorBodyLimit)
+		return nil, nil, &url.Error{Op: urlErrorOp(req.Method), URL: req.URL.Redacted(), Err: se}
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	page := &Page[T]{StatusCode: resp.StatusCode, Header: resp.Header, Body: body}
+	raw, err := jsonPath(body, itemsPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("读取%s的条目失败: %w", req.URL.Redacted(), err)
+	}
+	if raw != nil {
+		if err := json.Unmarshal(raw, &page.Items); err != nil {
+			return nil, nil, fmt.Errorf("解码%s的条目失败: %w", req.URL.Redacted(), err)
+		}
+	}
+	return page, resp, nil
+}
+
+func (s CursorPages) nextPage(req *http.Request, resp *http.Response, body []byte, items int) (*http.Request, error) {
+	if resp == nil {
+		return req, nil
+	}
+	raw, err := jsonPath(body, s.Field)
+	if err != nil {
+		return nil, fmt.Errorf("读取游标失败: %w", err)
+	}
+	var cursor any
+	if raw != nil {
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.UseNumber()
+		if err := dec.Decode(&cursor); err != nil {
+			return nil, fmt.Errorf("读取游标失败: %w", err)
+		}
+	}
+	switch v := cursor.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		if v == "" {
+			return nil, nil
+		}
+		return withQuery(req, s.Param, v), nil
+	case json.Number:
+		return withQuery(req, s.Param, v.String()), nil
+	}
+	return nil, fmt.Errorf("游标%s不是字符串或数字", s.Field)
+}
+
+func (s NumberedPages) nextPage(req *http.Request, resp *http.Response, body []byte, items int) (*http.Request, error) {
+	if resp == nil {
+		if s.SizeParam != "" && s.Size > 0 {
+			req = withQuery(req, s.SizeParam, strconv.Itoa(s.Size))
+		}
+		if req.URL.Query().Has(s.Param) {
+			return req, nil
+		}
+		return withQuery(req, s.Param, strconv.Itoa(s.Start)), nil
+	}
+	if items == 0 || s.Size > 0 && items < s.Size {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(req.URL.Query().Get(s.Param))
+	if err != nil {
+		return nil, fmt.Errorf("无效的页码: %w", err)
+	}
+	return withQuery(req, s.Param, strconv.Itoa(n+1)), nil
+}
+
+func (LinkPages) nextPage(req *http.Request, resp *http.Response, body []byte, items int) (*http.Request, error) {
+	if resp == nil {
+		return req, nil
+	}
+	next := linkNext(resp.Header.Values("Link"))
+	if next == "" {
+		return nil, nil
+	}
+	u, err := req.URL.Parse(next)
+	if err != nil {
+		return nil, fmt.Errorf("无效的下一页地址%q: %w", next, err)
+	}
+	r := req.Clone(req.Context())
+	r.URL = u
+	r.Host = ""
+	return r, nil
+}
+
+// linkNext 返回Link请求头中rel="next"的地址，没有时返回空字符串
+func linkNext(values []string) string {
+	for _, v := range values {
+		for _, link := range strings.Split(v, ",") {
+			target, params, ok := strings.Cut(strings.TrimSpace(link), ";")
+			if !ok || !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+			for _, param := range strings.Split(params, ";") {
+				name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+				if !strings.EqualFold(name, "rel") {
+					continue
+				}
+				for _, rel := range strings.Fields(strings.Trim(value, `"`)) {
+					if strings.EqualFold(rel, "next") {
+						return target[1 : len(target)-1]
+					}
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// withQuery 返回设置了查询参数name的请求副本
+func withQuery(req *http.Request, name, value string) *http.Request {
+	r := req.Clone(req.Context())
+	q := r.URL.Query()
+	q.Set(name, value)
+	r.URL.RawQuery = q.Encode()
+	return r
+}
+
+// jsonPath 返回JSON中以"."分隔的路径处的值，路径为空时返回整个JSON，路径不存在时返回nil
+func jsonPath(data []byte, path string) (json.RawMessage, error) {
+	raw := json.RawMessage(data)
+	if path == "" {
+		return raw, nil
+	}
+	for _, key := range strings.Split(path, ".") {
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &obj); err != nil {
+			return nil, fmt.Errorf("%s不是JSON对象", path)
+		}
+		var ok bool
+		if raw, ok = obj[key]; !ok {
+			return nil, nil
+		}
+	}
+	return raw, nil
+}
@@ -0,0 +1,145 @@
+package goproxy
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// newTestPageServer 返回共7个条目的分页API: /cursor、/numbered和/link
+func newTestPageServer(t *testing.T) *httptest.Server {
+	const total = 7
+	items := func(from, n int) string {
+		s := "["
+		for i := from; i < min(from+n, total); i++ {
+			if i > from {
+				s += ","
+			}
+			s += strconv.Itoa(i)
+		}
+		return s + "]"
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		switch r.URL.Path {
+		case "/cursor":
+			from, _ := strconv.Atoi(q.Get("after"))
+			next := "null"
+			if from+3 < total {
+				next = strconv.Itoa(from + 3)
+			}
+			fmt.Fprintf(w, `{"data":%s,"meta":{"next":%s}}`, items(from, 3), next)
+		case "/numbered":
+			page, _ := strconv.Atoi(q.Get("page"))
+			size, _ := strconv.Atoi(q.Get("per_page"))
+			fmt.Fprint(w, items((page-1)*size, size))
+		case "/link":
+			from, _ := strconv.Atoi(q.Get("from"))
+			if from+2 < total {
+				w.Header().Set("Link", fmt.Sprintf(`</link?from=0>; rel="first", </link?from=%d>; rel="next"`, from+2))
+			}
+			fmt.Fprint(w, items(from, 2))
+		case "/fail":
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestPaginate(t *testing.T) {
+	srv := newTestPageServer(t)
+	c := New()
+	want := []int{0, 1, 2, 3, 4, 5, 6}
+	tests := []struct {
+		name  string
+		path  string
+		p     Pagination
+		pages int
+	}{
+		{"游标", "/cursor", Pagination{Strategy: CursorPages{Param: "after", Field: "meta.next"}, Items: "data"}, 3},
+		{"页码", "/numbered", Pagination{Strategy: NumberedPages{Param: "page", Start: 1, SizeParam: "per_page", Size: 3}}, 3},
+		{"Link", "/link", Pagination{Strategy: LinkPages{}}, 4},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+tt.path, nil)
+		var got []int
+		pages := 0
+		for page, err := range Paginate[int](c, req, tt.p) {
+			if err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			pages++
+			if page.Number != pages {
+				t.Errorf("%s: 第%d页的序号为%d", tt.name, pages, page.Number)
+			}
+			got = append(got, page.Items...)
+		}
+		if !reflect.DeepEqual(got, want) || pages != tt.pages {
+			t.Errorf("%s: 请求了%d页，条目为%v", tt.name, pages, got)
+		}
+	}
+}
+
+func TestPaginateItems(t *testing.T) {
+	srv := newTestPageServer(t)
+	c := New()
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/link", nil)
+	var got []int
+	for item, err := range PaginateItems[int](c, req, Pagination{Strategy: LinkPages{}}) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got = append(got, item); len(got) == 3 {
+			break
+		}
+	}
+	if !reflect.DeepEqual(got, []int{0, 1, 2}) {
+		t.Errorf("提前停止时条目为%v", got)
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, srv.URL+"/link", nil)
+	n := 0
+	for range PaginateItems[int](c, req, Pagination{Strategy: LinkPages{}, MaxPages: 2}) {
+		n++
+	}
+	if n != 4 {
+		t.Errorf("最多2页时得到%d个条目", n)
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, srv.URL+"/fail", nil)
+	for _, err := range PaginateItems[int](c, req, Pagination{Strategy: LinkPages{}}) {
+		if !errors.Is(err, ErrUnexpectedStatus) {
+			t.Errorf("服务器出错时错误为%v", err)
+		}
+	}
+	req, _ = http.NewRequest(http.MethodGet, srv.URL+"/cursor", nil)
+	for _, err := range PaginateItems[int](c, req, Pagination{Strategy: CursorPages{Param: "after", Field: "data"}, Items: "data"}) {
+		if err != nil {
+			return
+		}
+	}
+	t.Error("游标不是字符串或数字时没有报告错误")
+}
+
+func TestLinkNext(t *testing.T) {
+	tests := []struct {
+		values []string
+		want   string
+	}{
+		{[]string{`<https://api.example.com/items?page=2>; rel="next", <https://api.example.com/items?page=5>; rel="last"`}, "https://api.example.com/items?page=2"},
+		{[]string{`</a>; rel="prev"`, `</b>; rel="prefetch next"`}, "/b"},
+		{[]string{`</a>; rel=next`}, "/a"},
+		{[]string{`</a>; rel="last"`}, ""},
+		{nil, ""},
+	}
+	for _, tt := range tests {
+		if got := linkNext(tt.values); got != tt.want {
+			t.Errorf("linkNext(%q) = %q", tt.values, got)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package goproxy
+
+import (
+	"time"
+)
+
+// SetMaxIdleConns 设置所有主机的最大空闲连接数，为0时不限制
+func (r *GoProxy) SetMaxIdleConns(n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.transport.Transport.MaxIdleConns = n
+}
+
+// SetMaxIdleConnsPerHost 设置每个主机的最大空闲连接数，为0时使用http.DefaultMaxIdleConnsPerHost
+// 高并发访问少量主机时应适当调大，否则超出的连接在请求结束后会被关闭而无法复用
+func (r *GoProxy) SetMaxIdleConnsPerHost(n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.transport.Transport.MaxIdleConnsPerHost = n
+}
+
+// SetMaxConnsPerHost 设置每个主机的最大连接数，包括正在建立、使用中和空闲的连接，为0时不限制
+// 达到上限后新的请求会等待已有连接可用
+func (r *GoProxy) SetMaxConnsPerHost(n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.transport.Transport.MaxConnsPerHost = n
+}
+
+// SetIdleConnTimeout 设置空闲连接在关闭前保持的最长时间，为0时不限制
+func (r *GoProxy) SetIdleConnTimeout(timeout time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.transport.Transport.IdleConnTimeout = timeout
+}
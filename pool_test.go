@@ -0,0 +1,24 @@
+package goproxy
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGoProxy_PoolSettings(t *testing.T) {
+	c := New()
+	c.SetMaxIdleConns(50)
+	c.SetMaxIdleConnsPerHost(20)
+	c.SetMaxConnsPerHost(10)
+	c.SetIdleConnTimeout(30 * time.Second)
+	// 重建Transport后设置仍然保留
+	c.EnableHTTP2(true)
+
+	tr := c.GetTransport()
+	if tr.MaxIdleConns != 50 || tr.MaxIdleConnsPerHost != 20 || tr.MaxConnsPerHost != 10 || tr.IdleConnTimeout != 30*time.Second {
+		t.Errorf("连接池设置未生效: %d %d %d %v", tr.MaxIdleConns, tr.MaxIdleConnsPerHost, tr.MaxConnsPerHost, tr.IdleConnTimeout)
+	}
+	if tr.DialContext == nil {
+		t.Error("不应丢失已安装的拨号函数")
+	}
+}
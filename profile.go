@@ -0,0 +1,95 @@
+package goproxy
+
+import (
+	"net/http"
+)
+
+// Profile 浏览器身份配置，包含一组相互一致的请求头、请求头顺序和TLS指纹
+// 只修改User-Agent而TLS指纹、sec-ch-ua等仍是Go的特征时很容易被识别，使用Profile可一次性设置完整的身份
+type Profile struct {
+	Name        string         // 配置名称
+	Headers     http.Header    // 全局请求头
+	HeaderOrder []string       // HTTP/1.x请求头顺序，见SetHeaderOrder
+	Fingerprint TLSFingerprint // TLS指纹
+}
+
+// 内置的浏览器身份配置
+// 注意: 配置中不包含Accept-Encoding，由Transport自动设置为gzip并透明解压，
+// 手动设置br、zstd等编码后需要自行解压响应体
+var (
+	// ProfileChrome Windows上的Chrome
+	ProfileChrome = Profile{
+		Name: "chrome",
+		Headers: http.Header{
+			"Sec-Ch-Ua":                 {`"Not(A:Brand";v="99", "Google Chrome";v="133", "Chromium";v="133"`},
+			"Sec-Ch-Ua-Mobile":          {"?0"},
+			"Sec-Ch-Ua-Platform":        {`"Windows"`},
+			"Upgrade-Insecure-Requests": {"1"},
+			"User-Agent":                {"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/133.0.0.0 Safari/537.36"},
+			"Accept":                    {"text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7"},
+			"Sec-Fetch-Site":            {"none"},
+			"Sec-Fetch-Mode":            {"navigate"},
+			"Sec-Fetch-User":            {"?1"},
+			"Sec-Fetch-Dest":            {"document"},
+			"Accept-Language":           {"en-US,en;q=0.9"},
+		},
+		HeaderOrder: []string{
+			"Host", "Connection", "sec-ch-ua", "sec-ch-ua-mobile", "sec-ch-ua-platform",
+			"Upgrade-Insecure-Requests", "User-Agent", "Accept", "Sec-Fetch-Site", "Sec-Fetch-Mode",
+			"Sec-Fetch-User", "Sec-Fetch-Dest", "Accept-Encoding", "Accept-Language", "Cookie",
+		},
+		Fingerprint: FingerprintChrome,
+	}
+
+	// ProfileSafari macOS上的Safari
+	ProfileSafari = Profile{
+		Name: "safari",
+		Headers: http.Header{
+			"Sec-Fetch-Dest":  {"document"},
+			"User-Agent":      {"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/18.3 Safari/605.1.15"},
+			"Accept":          {"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"},
+			"Sec-Fetch-Site":  {"none"},
+			"Sec-Fetch-Mode":  {"navigate"},
+			"Accept-Language": {"en-US,en;q=0.9"},
+			"Priority":        {"u=0, i"},
+		},
+		HeaderOrder: []string{
+			"Host", "Sec-Fetch-Dest", "User-Agent", "Accept", "Sec-Fetch-Site", "Sec-Fetch-Mode",
+			"Accept-Language", "Priority", "Accept-Encoding", "Cookie", "Connection",
+		},
+		Fingerprint: FingerprintSafari,
+	}
+
+	// ProfileFirefox Linux上的Firefox
+	ProfileFirefox = Profile{
+		Name: "firefox",
+		Headers: http.Header{
+			"User-Agent":                {"Mozilla/5.0 (X11; Linux x86_64; rv:135.0) Gecko/20100101 Firefox/135.0"},
+			"Accept":                    {"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"},
+			"Accept-Language":           {"en-US,en;q=0.5"},
+			"Upgrade-Insecure-Requests": {"1"},
+			"Sec-Fetch-Dest":            {"document"},
+			"Sec-Fetch-Mode":            {"navigate"},
+			"Sec-Fetch-Site":            {"none"},
+			"Sec-Fetch-User":            {"?1"},
+			"Priority":                  {"u=0, i"},
+		},
+		HeaderOrder: []string{
+			"Host", "User-Agent", "Accept", "Accept-Language", "Accept-Encoding", "Connection", "Cookie",
+			"Upgrade-Insecure-Requests", "Sec-Fetch-Dest", "Sec-Fetch-Mode", "Sec-Fetch-Site",
+			"Sec-Fetch-User", "Priority",
+		},
+		Fingerprint: FingerprintFirefox,
+	}
+)
+
+// SetProfile 应用浏览器身份配置: 设置TLS指纹和请求头顺序，并用配置中的请求头覆盖同名的全局请求头
+// 其他全局请求头保持不变
+func (r *GoProxy) SetProfile(p Profile) error {
+	if err := r.SetTLSFingerprint(p.Fingerprint); err != nil {
+		return err
+	}
+	r.transport.MergeHeaders(p.Headers)
+	r.SetHeaderOrder(p.HeaderOrder...)
+	return nil
+}
@@ -0,0 +1,47 @@
+package goproxy
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestGoProxy_SetProfile(t *testing.T) {
+	url, blocks := newTestRawServer(t)
+	c := New()
+	c.SetGlobalHeader("X-Token", "abc")
+	if err := c.SetProfile(ProfileChrome); err != nil {
+		t.Fatal(err)
+	}
+	if c.GetTLSFingerprint() != FingerprintChrome {
+		t.Errorf("TLS指纹为%q", c.GetTLSFingerprint())
+	}
+	if ua := c.GetGlobalHeaders().Get("User-Agent"); !strings.Contains(ua, "Windows") {
+		t.Errorf("User-Agent为%q", ua)
+	}
+
+	resp, err := c.GetClient().Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	got := strings.Join(headerNames(<-blocks), ",")
+	want := "Host,sec-ch-ua,sec-ch-ua-mobile,sec-ch-ua-platform,Upgrade-Insecure-Requests,User-Agent,Accept," +
+		"Sec-Fetch-Site,Sec-Fetch-Mode,Sec-Fetch-User,Sec-Fetch-Dest,Accept-Encoding,Accept-Language,X-Token"
+	if got != want {
+		t.Errorf("请求头顺序为%s", got)
+	}
+
+	for _, p := range []Profile{ProfileSafari, ProfileFirefox} {
+		if err := c.SetProfile(p); err != nil {
+			t.Fatal(err)
+		}
+		if c.GetTLSFingerprint() != p.Fingerprint || c.GetGlobalHeaders().Get("User-Agent") != p.Headers.Get("User-Agent") {
+			t.Errorf("%s: 配置未生效", p.Name)
+		}
+	}
+
+	if err := c.SetProfile(Profile{Fingerprint: "netscape", Headers: http.Header{"User-Agent": {"x"}}}); err == nil {
+		t.Error("未知指纹应返回错误")
+	}
+}
@@ -0,0 +1,85 @@
+package goproxy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// DefaultCheckURL CheckProxy默认访问的地址，返回204且没有响应体
+const DefaultCheckURL = "https://www.gstatic.com/generate_204"
+
+// ProxyCheck 一次代理检测的结果，可直接序列化为JSON
+type ProxyCheck struct {
+	Proxy     string    `json:"proxy"`            // 代理地址(密码已脱敏)，直连时为direct
+	OK        bool      `json:"ok"`               // 是否可用
+	Status    int       `json:"status,omitempty"` // 检测地址返回的状态码
+	LatencyMs float64   `json:"latency_ms"`       // 从发出请求到收到响应头的耗时(毫秒)
+	Error     string    `json:"error,omitempty"`  // 不可用的原因
+	CheckedAt time.Time `json:"checked_at"`       // 检测时间
+}
+
+// CheckProxy 以当前客户端的配置(TLS指纹、请求头、超时等)通过proxy访问target，检测代理是否可用，
+// 结果同时计入PoolStats中该代理的统计。收到任何响应即视为可用，代理返回407时视为认证失败
+// 参数:
+//   - ctx: 控制检测的取消和超时
+//   - proxy: 代理地址，格式与SetProxy相同，为空时检测当前代理
+//   - target: 检测访问的地址，为空时使用DefaultCheckURL
+func (r *GoProxy) CheckProxy(ctx context.Context, proxy, target string) ProxyCheck {
+	if proxy == "" {
+		r.mu.Lock()
+		proxy = r.proxyUrl
+		r.mu.Unlock()
+	}
+	if target == "" {
+		target = DefaultCheckURL
+	}
+	key := proxy
+	if key == "" {
+		key = directProxyKey
+	}
+	result := ProxyCheck{Proxy: redactProxy(key), CheckedAt: time.Now()}
+
+	status, latency, err := r.checkProxy(ctx, proxy, target)
+	result.Status = status
+	result.LatencyMs = float64(latency) / float64(time.Millisecond)
+	if err != nil {
+		result.Error = err.Error()
+	} else {
+		result.OK = true
+	}
+	if stats := r.transport.stats; stats != nil {
+		stats.record(key, latency, err)
+	}
+	return result
+}
+
+// checkProxy 使用r的副本通过proxy请求target，返回状态码和收到响应头的耗时
+func (r *GoProxy) checkProxy(ctx context.Context, proxy, target string) (int, time.Duration, error) {
+	c := r.Clone()
+	defer c.Close()
+	// 检测指定的代理，不经过规则路由
+	c.SetRouter(nil)
+	c.SetFlowExporter(nil)
+	if err := c.SetProxy(proxy); err != nil {
+		return 0, 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	start := time.Now()
+	resp, err := c.Do(req)
+	latency := time.Since(start)
+	if err != nil {
+		return 0, latency, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode == http.StatusProxyAuthRequired {
+		return resp.StatusCode, latency, &Error{Kind: ErrProxyAuth, Phase: PhaseProxyHandshake, Err: fmt.Errorf("代理返回%s", resp.Status)}
+	}
+	return resp.StatusCode, latency, nil
+}
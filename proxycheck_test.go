@@ -0,0 +1,46 @@
+package goproxy
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGoProxy_CheckProxy(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer target.Close()
+	proxySrv, _ := newTestProxy(t)
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	closedAddr := ln.Addr().String()
+	ln.Close()
+
+	c := New()
+	res := c.CheckProxy(context.Background(), proxySrv.URL, target.URL)
+	if !res.OK || res.Status != http.StatusNoContent || res.Proxy != proxySrv.URL {
+		t.Errorf("检测结果为%+v", res)
+	}
+	bad := "http://user:secret@" + closedAddr
+	res = c.CheckProxy(context.Background(), bad, target.URL)
+	if res.OK || res.Error == "" || res.Proxy != "http://user:xxxxx@"+closedAddr {
+		t.Errorf("不可用代理的检测结果为%+v", res)
+	}
+	// 检测不改变当前代理，结果计入统计
+	if c.String() != "" {
+		t.Errorf("当前代理变为%s", c.String())
+	}
+	stats := map[string]ProxyStats{}
+	for _, s := range c.PoolStats() {
+		stats[s.Proxy] = s
+	}
+	if stats[proxySrv.URL].Successes != 1 || stats["http://user:xxxxx@"+closedAddr].Failures != 1 {
+		t.Errorf("统计为%+v", c.PoolStats())
+	}
+	// 为空时检测当前代理(直连)
+	if res = c.CheckProxy(context.Background(), "", target.URL); !res.OK || res.Proxy != "direct" {
+		t.Errorf("直连的检测结果为%+v", res)
+	}
+}
@@ -0,0 +1,200 @@
+package goproxy
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// errProxyNoH2 代理服务器不支持HTTP/2，需要回退到HTTP/1.1的CONNECT
+var errProxyNoH2 = errors.New("代理服务器不支持HTTP/2")
+
+// EnableProxyHTTP2 开启或关闭通过HTTP/2与HTTPS代理建立CONNECT隧道
+// 开启后与代理之间通过ALPN协商HTTP/2，每条隧道是同一个代理连接上的一个流，
+// 大量并发隧道不再需要各自建立TCP和TLS连接；代理不支持HTTP/2时自动回退到HTTP/1.1。
+// 只对https代理生效
+func (r *GoProxy) EnableProxyHTTP2(enable bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.proxyHTTP2 = enable
+	r.closeIdleConns()
+}
+
+// proxyH2Pool 与HTTPS代理之间的HTTP/2连接池
+type proxyH2Pool struct {
+	mu    sync.Mutex
+	proxy string               // 连接所属的代理地址
+	conns []*http2.ClientConn  // 可复用的HTTP/2连接
+	h1    map[string]time.Time // 协商结果为HTTP/1.1的代理及记录时间
+}
+
+// proxyH1TTL 代理不支持HTTP/2的记录保留时间，过期后重新协商
+const proxyH1TTL = 10 * time.Minute
+
+// get 返回到代理的可用HTTP/2连接，没有时新建
+func (p *proxyH2Pool) get(ctx context.Context, r *GoProxy, proxyURL *url.URL) (*http2.ClientConn, error) {
+	key := proxyURL.String()
+	p.mu.Lock()
+	if at, ok := p.h1[key]; ok && time.Since(at) < proxyH1TTL {
+		p.mu.Unlock()
+		return nil, errProxyNoH2
+	}
+	if p.proxy == key {
+		for _, cc := range p.conns {
+			if cc.CanTakeNewRequest() {
+				p.mu.Unlock()
+				return cc, nil
+			}
+		}
+	}
+	p.mu.Unlock()
+
+	conn, err := r.dialDirect(ctx, "tcp", canonicalAddr(proxyURL))
+	if err != nil {
+		return nil, newError(ErrProxyUnreachable, err)
+	}
+	cfg := r.tlsConfigForHost(context.Background(), proxyURL.Hostname())
+	cfg.NextProtos = []string{"h2", "http/1.1"}
+	tlsConn := tls.Client(conn, cfg)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, r.annotate(ctx, newError(ErrProxyUnreachable, newError(ErrTLSHandshake, err)), PhaseProxyHandshake)
+	}
+	if tlsConn.ConnectionState().NegotiatedProtocol != "h2" {
+		tlsConn.Close()
+		p.mu.Lock()
+		if p.h1 == nil {
+			p.h1 = make(map[string]time.Time)
+		}
+		p.h1[key] = time.Now()
+		p.mu.Unlock()
+		return nil, errProxyNoH2
+	}
+	cc, err := (&http2.Transport{}).NewClientConn(tlsConn)
+	if err != nil {
+		tlsConn.Close()
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.proxy != key {
+		p.closeLocked()
+		p.proxy = key
+	}
+	// 顺便清理已关闭的连接
+	live := p.conns[:0]
+	for _, c := range p.conns {
+		if !c.State().Closed {
+			live = append(live, c)
+		}
+	}
+	p.conns = append(live, cc)
+	return cc, nil
+}
+
+// closeIdle 移除所有连接，空闲连接立即关闭，仍有隧道的连接在隧道全部结束后关闭
+func (p *proxyH2Pool) closeIdle() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closeLocked()
+	p.h1 = nil
+}
+
+func (p *proxyH2Pool) closeLocked() {
+	for _, cc := range p.conns {
+		if cc.State().StreamsActive == 0 {
+			cc.Close()
+		} else {
+			go cc.Shutdown(context.Background())
+		}
+	}
+	p.conns = nil
+}
+
+// dialConnectH2 在与代理的HTTP/2连接上通过CONNECT建立到addr的隧道
+func (r *GoProxy) dialConnectH2(ctx context.Context, proxyURL *url.URL, addr string) (net.Conn, error) {
+	cc, err := r.proxyH2.get(ctx, r, proxyURL)
+	if err != nil {
+		return nil, err
+	}
+	pr, pw := io.Pipe()
+	// 隧道的生命周期长于建立连接时的ctx，流在连接关闭时结束
+	tunnelCtx, cancel := context.WithCancel(context.Background())
+	req := (&http.Request{
+		Method:        http.MethodConnect,
+		URL:           &url.URL{Host: addr},
+		Host:          addr,
+		Header:        make(http.Header),
+		Body:          pr,
+		ContentLength: -1,
+	}).WithContext(tunnelCtx)
+	if auth := proxyAuthorization(proxyURL); auth != "" {
+		req.Header.Set("Proxy-Authorization", auth)
+	}
+	stop := context.AfterFunc(ctx, cancel)
+	resp, err := cc.RoundTrip(req)
+	stopped := stop()
+	if err != nil {
+		cancel()
+		pw.Close()
+		if !stopped {
+			return nil, r.annotate(ctx, ctx.Err(), PhaseProxyHandshake)
+		}
+		return nil, r.annotate(ctx, fmt.Errorf("发送CONNECT请求失败: %w", err), PhaseProxyHandshake)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		cancel()
+		pw.Close()
+		return nil, r.annotate(ctx, connectError(resp), PhaseProxyHandshake)
+	}
+	return &h2TunnelConn{body: resp.Body, pw: pw, cancel: cancel, addr: addr}, nil
+}
+
+// h2TunnelConn 将HTTP/2 CONNECT流包装为net.Conn
+// 请求体为写入方向，响应体为读取方向。读写超时不受支持，由上层通过关闭连接中断
+type h2TunnelConn struct {
+	body   io.ReadCloser
+	pw     *io.PipeWriter
+	cancel context.CancelFunc
+	addr   string
+	once   sync.Once
+}
+
+func (c *h2TunnelConn) Read(b []byte) (int, error)  { return c.body.Read(b) }
+func (c *h2TunnelConn) Write(b []byte) (int, error) { return c.pw.Write(b) }
+
+func (c *h2TunnelConn) Close() error {
+	c.once.Do(func() {
+		c.pw.Close()
+		c.body.Close()
+		c.cancel()
+	})
+	return nil
+}
+
+func (c *h2TunnelConn) LocalAddr() net.Addr  { return tunnelAddr{"tcp", "h2-connect"} }
+func (c *h2TunnelConn) RemoteAddr() net.Addr { return tunnelAddr{"tcp", c.addr} }
+
+func (c *h2TunnelConn) SetDeadline(time.Time) error      { return nil }
+func (c *h2TunnelConn) SetReadDeadline(time.Time) error  { return nil }
+func (c *h2TunnelConn) SetWriteDeadline(time.Time) error { return nil }
+
+// tunnelAddr 隧道连接的地址
+type tunnelAddr struct {
+	network string
+	addr    string
+}
+
+func (a tunnelAddr) Network() string { return a.network }
+func (a tunnelAddr) String() string  { return a.addr }
@@ -0,0 +1,97 @@
+package goproxy
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// newTestH2Proxy 启动一个通过HTTP/2提供CONNECT的HTTPS代理，返回代理和建立的TCP连接数
+func newTestH2Proxy(t *testing.T) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var conns atomic.Int32
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect || r.ProtoMajor != 2 {
+			http.Error(w, "需要HTTP/2 CONNECT", http.StatusMethodNotAllowed)
+			return
+		}
+		upstream, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer upstream.Close()
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		go func() {
+			io.Copy(upstream, r.Body)
+			upstream.(*net.TCPConn).CloseWrite()
+		}()
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := upstream.Read(buf)
+			if n > 0 {
+				w.Write(buf[:n])
+				w.(http.Flusher).Flush()
+			}
+			if err != nil {
+				return
+			}
+		}
+	}))
+	srv.EnableHTTP2 = true
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv, &conns
+}
+
+func TestGoProxy_EnableProxyHTTP2(t *testing.T) {
+	target := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "secure")
+	}))
+	defer target.Close()
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "plain")
+	}))
+	defer plain.Close()
+	p, conns := newTestH2Proxy(t)
+
+	c := New()
+	c.EnableProxyHTTP2(true)
+	if err := c.SetProxy(p.URL); err != nil {
+		t.Fatal(err)
+	}
+	// 每次请求都新建隧道，多条隧道复用同一个代理连接
+	c.GetTransport().DisableKeepAlives = true
+	for range 3 {
+		if got := getBody(t, c, target.URL); got != "secure" {
+			t.Fatalf("https目标响应错误: %q", got)
+		}
+		if got := getBody(t, c, plain.URL); got != "plain" {
+			t.Fatalf("http目标响应错误: %q", got)
+		}
+	}
+	if n := conns.Load(); n != 1 {
+		t.Errorf("多条隧道应复用一个代理连接，实际建立%d个", n)
+	}
+
+	// 代理不支持HTTP/2时回退到HTTP/1.1 CONNECT
+	h1, connects := newTestProxy(t)
+	h1Proxy := httptest.NewUnstartedServer(h1.Config.Handler)
+	h1Proxy.StartTLS()
+	defer h1Proxy.Close()
+	if err := c.SetProxy(h1Proxy.URL); err != nil {
+		t.Fatal(err)
+	}
+	if got := getBody(t, c, target.URL); got != "secure" || connects.Load() != 1 {
+		t.Fatalf("回退后响应错误: %q，CONNECT次数%d", got, connects.Load())
+	}
+}
@@ -0,0 +1,234 @@
+package goproxy
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// RedirectPolicy 跟随重定向时的附加规则，可以按位组合
+type RedirectPolicy uint8
+
+const (
+	// RedirectSameHost 只跟随到与最初请求主机名相同的重定向，其他重定向直接返回重定向响应
+	RedirectSameHost RedirectPolicy = 1 << iota
+	// RedirectStripAuth 重定向到与最初请求不同源(协议、主机或端口不同)的地址时删除请求本身带有的Authorization，
+	// Go默认只在重定向到其他域名(不含子域名)时删除
+	RedirectStripAuth
+)
+
+// SetMaxRedirects 设置最多跟随的重定向次数，超过后返回最后一次的重定向响应，不返回错误
+// 默认为0，即不跟随重定向；会覆盖SetCheckRedirect的设置
+// 参数:
+//   - n: 最多跟随的重定向次数，小于等于0时不跟随
+func (r *GoProxy) SetMaxRedirects(n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.maxRedirects = max(n, 0)
+	r.client.CheckRedirect = redirectChecker(r.maxRedirects, r.redirectPolicy)
+}
+
+// SetRedirectPolicy 设置跟随重定向时的附加规则，只在SetMaxRedirects允许跟随重定向时生效；会覆盖SetCheckRedirect的设置
+// 参数:
+//   - p: 重定向规则，如RedirectSameHost|RedirectStripAuth；为0时没有附加规则
+func (r *GoProxy) SetRedirectPolicy(p RedirectPolicy) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.redirectPolicy = p
+	r.client.CheckRedirect = redirectChecker(r.maxRedirects, r.redirectPolicy)
+}
+
+// WithFollowRedirects 设置单次请求最多跟随的重定向次数，优先于SetMaxRedirects和SetCheckRedirect的设置，
+// SetRedirectPolicy设置的附加规则仍然生效
+// 参数:
+//   - n: 最多跟随的重定向次数，小于等于0时不跟随
+func WithFollowRedirects(n int) RequestOption {
+	return func(o *requestOptions) {
+		o.redirects = max(n, 0)
+		o.redirectsSet = true
+	}
+}
+
+// requestRedirects 返回单次请求设置的重定向次数
+func requestRedirects(req *http.Request) (int, bool) {
+	if o := optionsFromRequest(req); o != nil && o.redirectsSet {
+		return o.redirects, true
+	}
+	return 0, false
+}
+
+// customRedirectChecker 包装SetCheckRedirect设置的函数，设置了WithFollowRedirects的请求按单次请求的次数检查
+func customRedirectChecker(fn func(req *http.Request, via []*http.Request) error, policy RedirectPolicy) func(req *http.Request, via []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if _, ok := requestRedirects(req); ok {
+			return redirectChecker(0, policy)(req, via)
+		}
+		if fn == nil {
+			// 与http.Client的默认策略相同
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			return nil
+		}
+		return fn(req, via)
+	}
+}
+
+// redirectChecker 返回按最大次数和附加规则检查重定向的CheckRedirect，单次请求设置的次数优先
+func redirectChecker(maxRedirects int, policy RedirectPolicy) func(req *http.Request, via []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		n, ok := requestRedirects(req)
+		if !ok {
+			n = maxRedirects
+		}
+		if len(via) > n {
+			return http.ErrUseLastResponse
+		}
+		initial := via[0]
+		if policy&RedirectSameHost != 0 && !strings.EqualFold(req.URL.Hostname(), initial.URL.Hostname()) {
+			return http.ErrUseLastResponse
+		}
+		if policy&RedirectStripAuth != 0 && !sameOriginAsInitial(req) {
+			req.Header.Del("Authorization")
+		}
+		return nil
+	}
+}
+
+// RedirectRecord 重定向链中的一次请求
+type RedirectRecord struct {
+	URL        *url.URL // 请求的地址
+	StatusCode int      // 响应的状态码
+}
+
+// RedirectHistory 返回得到resp的完整重定向链，按请求顺序排列，最后一项为resp本身；没有重定向时只有一项
+func RedirectHistory(resp *http.Response) []RedirectRecord {
+	if resp == nil || resp.Request == nil {
+		return nil
+	}
+	history := []RedirectRecord{{URL: resp.Request.URL, StatusCode: resp.StatusCode}}
+	for req := resp.Request; req.Response != nil && req.Response.Request != nil; req = req.Response.Request {
+		history = append(history, RedirectRecord{URL: req.Response.Request.URL, StatusCode: req.Response.StatusCode})
+	}
+	for i, j := 0, len(history)-1; i < j; i, j = i+1, j-1 {
+		history[i], history[j] = history[j], history[i]
+	}
+	return history
+}
+
+// RedirectForwarding 跟随重定向到与最初请求不同源的地址时转发请求头和Cookie的规则，
+// 同源重定向不受影响。Authorization由认证设置和RedirectStripAuth处理，Cookie管理器中的Cookie按域名规则添加，都不受此规则影响
+type RedirectForwarding struct {
+	// Headers 转发的请求头白名单，包括全局请求头和请求本身的请求头；为nil时转发全部请求头
+	Headers []string
+	// Strip 不转发的请求头，优先于Headers
+	Strip []string
+	// Cookies 是否转发请求本身带有的Cookie请求头
+	Cookies bool
+}
+
+// DefaultRedirectForwarding 返回默认的转发规则: 转发除常见凭据请求头外的全部请求头，不转发请求本身带有的Cookie
+func DefaultRedirectForwarding() *RedirectForwarding {
+	return &RedirectForwarding{
+		Strip: []string{"Proxy-Authorization", "X-Api-Key", "X-Auth-Token", "X-Access-Token", "X-Csrf-Token"},
+	}
+}
+
+// SetRedirectForwarding 设置跨源重定向时转发请求头和Cookie的规则，替代Go默认只按域名删除敏感请求头的行为
+// 参数:
+//   - f: 转发规则，调用后修改f不影响已设置的规则；为nil时恢复DefaultRedirectForwarding
+func (r *GoProxy) SetRedirectForwarding(f *RedirectForwarding) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if f == nil {
+		f = DefaultRedirectForwarding()
+	}
+	fw := &redirectForwarding{strip: make(map[string]bool), cookies: f.Cookies}
+	if f.Headers != nil {
+		fw.headers = make(map[string]bool)
+		for _, name := range f.Headers {
+			fw.headers[http.CanonicalHeaderKey(name)] = true
+		}
+	}
+	for _, name := range f.Strip {
+		fw.strip[http.CanonicalHeaderKey(name)] = true
+	}
+	r.transport.forwarding.Store(fw)
+}
+
+// redirectForwarding 规范化请求头名称后的RedirectForwarding
+type redirectForwarding struct {
+	headers map[string]bool // 为nil时转发全部请求头
+	strip   map[string]bool
+	cookies bool
+}
+
+// defaultForwarding 未设置SetRedirectForwarding时使用的规则
+var defaultForwarding = func() *redirectForwarding {
+	fw := &redirectForwarding{strip: make(map[string]bool)}
+	for _, name := range DefaultRedirectForwarding().Strip {
+		fw.strip[http.CanonicalHeaderKey(name)] = true
+	}
+	return fw
+}()
+
+// forwards 判断跨源重定向时是否转发名为key的请求头，key应为规范形式
+func (f *redirectForwarding) forwards(key string) bool {
+	return !f.strip[key] && (f.headers == nil || f.headers[key])
+}
+
+// crossOriginForwarding 请求是跨源重定向时返回转发规则和最初的请求，否则返回nil
+func (c *CustomTransport) crossOriginForwarding(req *http.Request) (*redirectForwarding, *http.Request) {
+	if req.Response == nil || sameOriginAsInitial(req) {
+		return nil, nil
+	}
+	initial := req
+	for initial.Response != nil && initial.Response.Request != nil {
+		initial = initial.Response.Request
+	}
+	fw := c.forwarding.Load()
+	if fw == nil {
+		fw = defaultForwarding
+	}
+	return fw, initial
+}
+
+// filter 按规则处理http.Client从最初的请求复制到重定向请求中的请求头，
+// 不在最初请求中的请求头(如Referer和Cookie管理器添加的Cookie)保留
+func (f *redirectForwarding) filter(req, initial *http.Request) {
+	for key := range initial.Header {
+		key = http.CanonicalHeaderKey(key)
+		if key == "Authorization" || key == "Cookie" {
+			continue
+		}
+		if !f.forwards(key) {
+			req.Header.Del(key)
+		}
+	}
+
+	manual := initial.Cookies()
+	if len(manual) == 0 {
+		return
+	}
+	own := make(map[string]bool, len(manual))
+	for _, ck := range manual {
+		own[ck.String()] = true
+	}
+	var cookies []string
+	for _, ck := range req.Cookies() {
+		if !own[ck.String()] {
+			cookies = append(cookies, ck.String())
+		}
+	}
+	if f.cookies {
+		for _, ck := range manual {
+			cookies = append(cookies, ck.String())
+		}
+	}
+	if len(cookies) == 0 {
+		req.Header.Del("Cookie")
+	} else {
+		req.Header.Set("Cookie", strings.Join(cookies, "; "))
+	}
+}
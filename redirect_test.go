@@ -0,0 +1,189 @@
+package goproxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// newTestRedirectServer /r/n重定向到/r/n-1，/r/0返回请求的Authorization
+func newTestRedirectServer(t *testing.T) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if to := r.URL.Query().Get("to"); to != "" {
+			http.Redirect(w, r, to, http.StatusFound)
+			return
+		}
+		n, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/r/"))
+		if n > 0 {
+			http.Redirect(w, r, fmt.Sprintf("/r/%d", n-1), http.StatusMovedPermanently)
+			return
+		}
+		io.WriteString(w, r.Header.Get("Authorization"))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestGoProxy_SetMaxRedirects(t *testing.T) {
+	srv := newTestRedirectServer(t)
+	c := New()
+	get := func(url string) *http.Response {
+		t.Helper()
+		resp, err := c.GetClient().Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+	if resp := get(srv.URL + "/r/2"); resp.StatusCode != http.StatusMovedPermanently {
+		t.Errorf("默认状态码为%d", resp.StatusCode)
+	}
+
+	c.SetMaxRedirects(2)
+	resp := get(srv.URL + "/r/2")
+	history := RedirectHistory(resp)
+	want := []int{http.StatusMovedPermanently, http.StatusMovedPermanently, http.StatusOK}
+	if len(history) != len(want) {
+		t.Fatalf("重定向链为%v", history)
+	}
+	for i, h := range history {
+		if h.StatusCode != want[i] || h.URL.Path != fmt.Sprintf("/r/%d", 2-i) {
+			t.Errorf("第%d项为%s %d", i, h.URL, h.StatusCode)
+		}
+	}
+	// 超过次数时返回最后的重定向响应
+	if resp := get(srv.URL + "/r/3"); resp.StatusCode != http.StatusMovedPermanently || len(RedirectHistory(resp)) != 3 {
+		t.Errorf("超过次数时状态码为%d, 重定向链为%v", resp.StatusCode, RedirectHistory(resp))
+	}
+}
+
+func TestGoProxy_SetRedirectPolicy(t *testing.T) {
+	srv := newTestRedirectServer(t)
+	// 127.0.0.1与localhost为不同的主机
+	other := strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)
+	c := New()
+	c.SetMaxRedirects(5)
+	c.SetRedirectPolicy(RedirectSameHost)
+	resp, err := c.GetClient().Get(srv.URL + "/?to=" + other + "/r/0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Errorf("重定向到其他主机时状态码为%d", resp.StatusCode)
+	}
+
+	// Go默认在同一域名的不同端口之间保留Authorization
+	c.SetRedirectPolicy(RedirectStripAuth)
+	srv2 := newTestRedirectServer(t)
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/?to="+srv2.URL+"/r/0", nil)
+	req.Header.Set("Authorization", "Bearer x")
+	if got := doBody(t, c, req); got != "" {
+		t.Errorf("跨源重定向后Authorization为%q", got)
+	}
+	req, _ = http.NewRequest(http.MethodGet, srv.URL+"/r/1", nil)
+	req.Header.Set("Authorization", "Bearer x")
+	if got := doBody(t, c, req); got != "Bearer x" {
+		t.Errorf("同源重定向后Authorization为%q", got)
+	}
+}
+
+// doBody 发送请求并返回响应体
+func doBody(t *testing.T, c *GoProxy, req *http.Request) string {
+	t.Helper()
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return string(body)
+}
+
+func TestWithFollowRedirects(t *testing.T) {
+	srv := newTestRedirectServer(t)
+	c := New()
+	status := func(opts ...RequestOption) int {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/r/2", nil)
+		resp, err := c.Do(req, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := status(WithFollowRedirects(2)); code != http.StatusOK {
+		t.Errorf("单次请求跟随重定向时状态码为%d", code)
+	}
+	if code := status(WithFollowRedirects(1)); code != http.StatusMovedPermanently {
+		t.Errorf("次数不足时状态码为%d", code)
+	}
+	// 不影响客户端的设置
+	if code := status(); code != http.StatusMovedPermanently {
+		t.Errorf("默认状态码为%d", code)
+	}
+
+	c.SetMaxRedirects(5)
+	if code := status(WithFollowRedirects(0)); code != http.StatusMovedPermanently {
+		t.Errorf("单次请求禁止重定向时状态码为%d", code)
+	}
+	c.SetCheckRedirect(func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	})
+	if code := status(WithFollowRedirects(2)); code != http.StatusOK {
+		t.Errorf("自定义检查函数时状态码为%d", code)
+	}
+}
+
+func TestGoProxy_SetRedirectForwarding(t *testing.T) {
+	echo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if to := r.URL.Query().Get("to"); to != "" {
+			http.Redirect(w, r, to, http.StatusFound)
+			return
+		}
+		for _, name := range []string{"X-Api-Key", "X-Custom", "X-Global", "X-Auth-Token", "Cookie"} {
+			fmt.Fprintf(w, "%s=%s;", name, r.Header.Get(name))
+		}
+	}))
+	defer echo.Close()
+	srv := newTestRedirectServer(t)
+
+	c := New()
+	c.SetMaxRedirects(1)
+	c.SetGlobalHeader("X-Global", "g")
+	c.SetGlobalHeader("X-Auth-Token", "t")
+	get := func(url string) string {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, url, nil)
+		req.Header.Set("X-Api-Key", "k")
+		req.Header.Set("X-Custom", "c")
+		req.Header.Set("Cookie", "a=1")
+		return doBody(t, c, req)
+	}
+	// 127.0.0.1的不同端口为不同源，Go默认转发全部请求头
+	if got := get(srv.URL + "/?to=" + echo.URL); got != "X-Api-Key=;X-Custom=c;X-Global=g;X-Auth-Token=;Cookie=;" {
+		t.Errorf("默认规则转发的请求头为%s", got)
+	}
+	if got := get(echo.URL); got != "X-Api-Key=k;X-Custom=c;X-Global=g;X-Auth-Token=t;Cookie=a=1;" {
+		t.Errorf("没有重定向时请求头为%s", got)
+	}
+
+	c.SetRedirectForwarding(&RedirectForwarding{Headers: []string{"x-global", "x-api-key"}, Cookies: true})
+	if got := get(srv.URL + "/?to=" + echo.URL); got != "X-Api-Key=k;X-Custom=;X-Global=g;X-Auth-Token=;Cookie=a=1;" {
+		t.Errorf("白名单转发的请求头为%s", got)
+	}
+	// 同源重定向不受影响
+	c.SetRedirectForwarding(&RedirectForwarding{Headers: []string{}})
+	if got := get(echo.URL + "/?to=/"); got != "X-Api-Key=k;X-Custom=c;X-Global=g;X-Auth-Token=t;Cookie=a=1;" {
+		t.Errorf("同源重定向的请求头为%s", got)
+	}
+	if got := get(srv.URL + "/?to=" + echo.URL); got != "X-Api-Key=;X-Custom=;X-Global=;X-Auth-Token=;Cookie=;" {
+		t.Errorf("不转发时请求头为%s", got)
+	}
+}
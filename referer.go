@@ -0,0 +1,88 @@
+package goproxy
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// ReferrerPolicy Referer请求头的生成规则，与浏览器的Referrer-Policy对应
+type ReferrerPolicy int32
+
+const (
+	// ReferrerDefault 重定向时使用Go默认的行为: 携带完整的上一地址，从HTTPS重定向到HTTP时不携带
+	ReferrerDefault ReferrerPolicy = iota
+	// ReferrerNone 不发送Referer，对应no-referrer
+	ReferrerNone
+	// ReferrerOrigin 只发送来源页面的源，如"https://example.com/"，对应origin
+	ReferrerOrigin
+	// ReferrerFull 发送去掉用户信息和片段的完整地址，从HTTPS到HTTP时不发送，对应no-referrer-when-downgrade
+	ReferrerFull
+)
+
+// SetReferrerPolicy 设置重定向和自动Referer使用的生成规则
+// 跟随重定向时按规则重新生成Referer(ReferrerDefault时保持Go默认的行为)，覆盖请求本身带有的Referer
+func (r *GoProxy) SetReferrerPolicy(p ReferrerPolicy) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.transport.referrerPolicy.Store(int32(p))
+}
+
+// SetAutoReferer 设置是否自动添加Referer，开启后没有Referer的请求以上一次请求的最终地址作为来源页面，
+// 模拟浏览器中依次打开页面的会话流程；按SetReferrerPolicy的规则生成，ReferrerDefault时与ReferrerFull相同
+// 注意: 并发请求时"上一次请求"取决于完成顺序，应只在顺序发送请求的场景中开启
+func (r *GoProxy) SetAutoReferer(enabled bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ct := r.transport
+	ct.autoReferer.Store(enabled)
+	if !enabled {
+		ct.lastURL.Store(nil)
+	}
+}
+
+// applyReferer 按规则为重定向的请求重新生成Referer，开启自动Referer时为没有Referer的请求添加Referer
+func (c *CustomTransport) applyReferer(req *http.Request) {
+	policy := ReferrerPolicy(c.referrerPolicy.Load())
+	if req.Response != nil && req.Response.Request != nil {
+		if policy == ReferrerDefault {
+			return
+		}
+		if ref := refererFor(req.Response.Request.URL, req.URL, policy); ref != "" {
+			req.Header.Set("Referer", ref)
+		} else {
+			req.Header.Del("Referer")
+		}
+		return
+	}
+	if !c.autoReferer.Load() || req.Header.Get("Referer") != "" {
+		return
+	}
+	if last := c.lastURL.Load(); last != nil {
+		if policy == ReferrerDefault {
+			policy = ReferrerFull
+		}
+		if ref := refererFor(last, req.URL, policy); ref != "" {
+			req.Header.Set("Referer", ref)
+		}
+	}
+}
+
+// refererFor 按规则返回从from请求to时的Referer，不应发送时返回空字符串
+func refererFor(from, to *url.URL, policy ReferrerPolicy) string {
+	if from.Scheme != "http" && from.Scheme != "https" {
+		return ""
+	}
+	switch policy {
+	case ReferrerOrigin:
+		return from.Scheme + "://" + from.Host + "/"
+	case ReferrerFull:
+		if from.Scheme == "https" && to.Scheme == "http" {
+			return ""
+		}
+		u := *from
+		u.User = nil
+		u.Fragment, u.RawFragment = "", ""
+		return u.String()
+	}
+	return ""
+}
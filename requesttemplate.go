@@ -0,0 +1,278 @@
+package goproxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"net/http"
+	"net/url"
+	"reflect"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/http/httpguts"
+)
+
+// RequestTemplate 命名的请求模板，通过RegisterTemplate注册后以Call传入参数发起请求，
+// 免去API客户端中重复拼接URL、请求头和JSON请求体的代码
+//
+//	c.RegisterTemplate("getUser", goproxy.RequestTemplate{
+//		URL:     "https://api.example.com/users/{{id}}",
+//		Headers: map[string]string{"Authorization": "Bearer {{token}}"},
+//		Query:   []goproxy.TemplateParam{{Name: "fields"}},
+//	})
+//	resp, err := c.Call(ctx, "getUser", map[string]any{"id": 7, "token": tok})
+type RequestTemplate struct {
+	Method  string            // 请求方法，为空时为GET
+	URL     string            // URL模板，"{{name}}"替换为参数，位于查询字符串之前时按路径段转义，之后按查询参数转义
+	Headers map[string]string // 请求头，值中的"{{name}}"替换为参数
+	Query   []TemplateParam   // 追加到查询字符串的参数，值为切片时重复该参数
+	Body    []TemplateParam   // 组成JSON对象请求体的参数，为空时请求没有请求体
+	Expect  []int             // 期望的状态码，不为空时覆盖SetExpectedStatus，见WithExpectedStatus
+}
+
+// TemplateParam 请求模板中查询字符串或请求体的参数
+type TemplateParam struct {
+	Name     string // 参数名
+	Type     string // 参数类型: string、number、integer、boolean、array或object，为空时不检查
+	Required bool   // 是否必需，未传入时Call返回错误
+	Default  any    // 未传入时使用的值，为nil时省略该参数
+}
+
+// templateParamTypes TemplateParam.Type可用的类型
+var templateParamTypes = []string{"string", "number", "integer", "boolean", "array", "object"}
+
+// RegisterTemplate 注册命名的请求模板，同名的模板被替换
+// URL和请求头中引用的参数都是必需的，Call传入模板没有用到的参数时返回错误以发现拼写错误
+// 参数:
+//   - name: 模板名称，Call时使用
+//   - t: 请求模板
+func (r *GoProxy) RegisterTemplate(name string, t RequestTemplate) error {
+	if err := t.validate(); err != nil {
+		return fmt.Errorf("请求模板%s无效: %w", name, err)
+	}
+	t.Headers = maps.Clone(t.Headers)
+	t.Query = slices.Clone(t.Query)
+	t.Body = slices.Clone(t.Body)
+	t.Expect = slices.Clone(t.Expect)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.templates == nil {
+		r.templates = make(map[string]*RequestTemplate)
+	}
+	r.templates[name] = &t
+	return nil
+}
+
+// Call 以参数填充命名的请求模板并发起请求，调用方负责关闭响应体
+// 参数:
+//   - ctx: 请求的上下文
+//   - name: RegisterTemplate注册的模板名称
+//   - params: 参数，URL和请求头中的参数按fmt.Sprint格式化，请求体中的参数按JSON编码
+//   - opts: 请求选项，见Do
+func (r *GoProxy) Call(ctx context.Context, name string, params map[string]any, opts ...RequestOption) (*http.Response, error) {
+	r.mu.Lock()
+	t, ok := r.templates[name]
+	r.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("请求模板%s不存在", name)
+	}
+	req, err := t.NewRequest(ctx, params)
+	if err != nil {
+		return nil, fmt.Errorf("请求模板%s: %w", name, err)
+	}
+	if len(t.Expect) > 0 {
+		opts = append([]RequestOption{WithExpectedStatus(t.Expect...)}, opts...)
+	}
+	return r.Do(req, opts...)
+}
+
+// NewRequest 以参数填充模板并创建请求，缺少必需参数、类型不符或传入未知参数时返回错误
+func (t *RequestTemplate) NewRequest(ctx context.Context, params map[string]any) (*http.Request, error) {
+	used := make(map[string]bool, len(params))
+	var missing []string
+	expand := func(s string, escape func(string) string) string {
+		return expandHeaderTemplate(s, func(name string) (string, bool) {
+			used[name] = true
+			v, ok := params[name]
+			if !ok || v == nil {
+				missing = append(missing, name)
+				return "", true
+			}
+			return escape(formatParam(v)), true
+		})
+	}
+	raw := t.URL
+	var rawQuery string
+	if i := strings.IndexByte(raw, '?'); i >= 0 {
+		raw, rawQuery = raw[:i], raw[i:]
+	}
+	rawURL := expand(raw, url.PathEscape) + expand(rawQuery, url.QueryEscape)
+	header := make(http.Header, len(t.Headers))
+	for k, v := range t.Headers {
+		header.Set(k, expand(v, func(s string) string { return s }))
+	}
+
+	var errs []error
+	if len(missing) > 0 {
+		slices.Sort(missing)
+		errs = append(errs, fmt.Errorf("缺少参数%s", strings.Join(slices.Compact(missing), "、")))
+	}
+	values := func(defs []TemplateParam) map[string]any {
+		m := make(map[string]any, len(defs))
+		for _, p := range defs {
+			used[p.Name] = true
+			v, ok := params[p.Name]
+			if !ok || v == nil {
+				if p.Required {
+					errs = append(errs, fmt.Errorf("缺少参数%s", p.Name))
+				} else if p.Default != nil {
+					m[p.Name] = p.Default
+				}
+				continue
+			}
+			if p.Type != "" && !paramHasType(v, p.Type) {
+				errs = append(errs, fmt.Errorf("参数%s的类型应为%s", p.Name, p.Type))
+				continue
+			}
+			m[p.Name] = v
+		}
+		return m
+	}
+	query := values(t.Query)
+	body := values(t.Body)
+	for _, name := range slices.Sorted(maps.Keys(params)) {
+		if !used[name] {
+			errs = append(errs, fmt.Errorf("未知的参数%s", name))
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("URL无效: %w", err)
+	}
+	if len(query) > 0 {
+		q := u.Query()
+		for _, p := range t.Query {
+			v, ok := query[p.Name]
+			if !ok {
+				continue
+			}
+			if rv := reflect.ValueOf(v); rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() != reflect.Uint8 {
+				for i := 0; i < rv.Len(); i++ {
+					q.Add(p.Name, formatParam(rv.Index(i).Interface()))
+				}
+			} else {
+				q.Add(p.Name, formatParam(v))
+			}
+		}
+		u.RawQuery = q.Encode()
+	}
+	method := t.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	var req *http.Request
+	if len(t.Body) > 0 {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("编码请求体失败: %w", err)
+		}
+		req, err = http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+	} else if req, err = http.NewRequestWithContext(ctx, method, u.String(), nil); err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	return req, nil
+}
+
+// validate 检查模板的方法、URL和参数定义
+func (t *RequestTemplate) validate() error {
+	if t.Method != "" && !httpguts.ValidHeaderFieldName(t.Method) {
+		return fmt.Errorf("无效的请求方法%q", t.Method)
+	}
+	// 以占位值替换参数后检查URL
+	u, err := url.Parse(expandHeaderTemplate(t.URL, func(string) (string, bool) { return "x", true }))
+	if err != nil {
+		return fmt.Errorf("URL无效: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("URL应为http或https的绝对地址: %q", t.URL)
+	}
+	for k := range t.Headers {
+		if !httpguts.ValidHeaderFieldName(k) {
+			return fmt.Errorf("无效的请求头名称%q", k)
+		}
+	}
+	seen := make(map[string]bool)
+	for _, p := range slices.Concat(t.Query, t.Body) {
+		switch {
+		case p.Name == "":
+			return errors.New("参数名不能为空")
+		case seen[p.Name]:
+			return fmt.Errorf("参数%s重复", p.Name)
+		case p.Type != "" && !slices.Contains(templateParamTypes, p.Type):
+			return fmt.Errorf("参数%s的类型%q未知", p.Name, p.Type)
+		case p.Default != nil && p.Type != "" && !paramHasType(p.Default, p.Type):
+			return fmt.Errorf("参数%s的默认值类型应为%s", p.Name, p.Type)
+		}
+		seen[p.Name] = true
+	}
+	return nil
+}
+
+// formatParam 将URL、请求头和查询字符串中的参数格式化为字符串
+func formatParam(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	}
+	return fmt.Sprint(v)
+}
+
+// paramHasType 判断v编码为JSON后是否为typ类型
+func paramHasType(v any, typ string) bool {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return false
+		}
+		rv = rv.Elem()
+	}
+	switch rv.Kind() {
+	case reflect.String:
+		return typ == "string"
+	case reflect.Bool:
+		return typ == "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return typ == "integer" || typ == "number"
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		return typ == "number" || typ == "integer" && f == math.Trunc(f)
+	case reflect.Slice, reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			// []byte编码为base64字符串
+			return typ == "string"
+		}
+		return typ == "array"
+	case reflect.Map, reflect.Struct:
+		return typ == "object"
+	}
+	return false
+}
@@ -0,0 +1,133 @@
+package goproxy
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGoProxy_Call(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		json.NewEncoder(w).Encode(map[string]string{
+			"method": r.Method,
+			"uri":    r.URL.RequestURI(),
+			"auth":   r.Header.Get("Authorization"),
+			"type":   r.Header.Get("Content-Type"),
+			"body":   string(body),
+		})
+	}))
+	defer srv.Close()
+
+	c := New()
+	if err := c.RegisterTemplate("getUser", RequestTemplate{
+		URL:     srv.URL + "/users/{{id}}?v={{version}}",
+		Headers: map[string]string{"Authorization": "Bearer {{token}}"},
+		Query:   []TemplateParam{{Name: "fields"}, {Name: "limit", Type: "integer", Default: 10}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RegisterTemplate("createUser", RequestTemplate{
+		Method: http.MethodPost,
+		URL:    srv.URL + "/users",
+		Body:   []TemplateParam{{Name: "name", Type: "string", Required: true}, {Name: "tags", Type: "array"}, {Name: "admin", Type: "boolean", Default: false}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	call := func(name string, params map[string]any) (map[string]string, error) {
+		t.Helper()
+		resp, err := c.Call(context.Background(), name, params)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		var got map[string]string
+		json.NewDecoder(resp.Body).Decode(&got)
+		return got, nil
+	}
+
+	got, err := call("getUser", map[string]any{"id": "a/b", "version": "1&2", "token": "tok", "fields": []string{"x", "y"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["method"] != "GET" || got["uri"] != "/users/a%2Fb?fields=x&fields=y&limit=10&v=1%262" || got["auth"] != "Bearer tok" {
+		t.Errorf("请求为%v", got)
+	}
+
+	got, err = call("createUser", map[string]any{"name": "alice", "tags": []string{"a"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["method"] != "POST" || got["type"] != "application/json" || got["body"] != `{"admin":false,"name":"alice","tags":["a"]}` {
+		t.Errorf("请求为%v", got)
+	}
+
+	// 一次报告所有参数错误
+	_, err = call("createUser", map[string]any{"tags": "a", "nmae": "bob"})
+	if err == nil || !strings.Contains(err.Error(), "缺少参数name") || !strings.Contains(err.Error(), "参数tags的类型应为array") ||
+		!strings.Contains(err.Error(), "未知的参数nmae") {
+		t.Errorf("错误为%v", err)
+	}
+	if _, err = call("getUser", map[string]any{"id": 1}); err == nil || !strings.Contains(err.Error(), "缺少参数token、version") {
+		t.Errorf("缺少URL和请求头中的参数时错误为%v", err)
+	}
+	if _, err = call("deleteUser", nil); err == nil {
+		t.Error("调用不存在的模板没有报告错误")
+	}
+
+	// Clone后模板仍可用
+	resp, err := c.Clone().Call(context.Background(), "createUser", map[string]any{"name": "bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+}
+
+func TestRequestTemplate_Validate(t *testing.T) {
+	tests := []struct {
+		name string
+		t    RequestTemplate
+	}{
+		{"方法", RequestTemplate{Method: "GET X", URL: "http://example.com"}},
+		{"相对地址", RequestTemplate{URL: "/users/{{id}}"}},
+		{"请求头", RequestTemplate{URL: "http://example.com", Headers: map[string]string{"Bad Name": "1"}}},
+		{"参数重复", RequestTemplate{URL: "http://example.com", Query: []TemplateParam{{Name: "a"}}, Body: []TemplateParam{{Name: "a"}}}},
+		{"类型", RequestTemplate{URL: "http://example.com", Body: []TemplateParam{{Name: "a", Type: "int"}}}},
+		{"默认值", RequestTemplate{URL: "http://example.com", Body: []TemplateParam{{Name: "a", Type: "integer", Default: "1"}}}},
+	}
+	c := New()
+	for _, tt := range tests {
+		if err := c.RegisterTemplate("t", tt.t); err == nil {
+			t.Errorf("%s: 无效的模板注册成功", tt.name)
+		}
+	}
+}
+
+func TestParamHasType(t *testing.T) {
+	tests := []struct {
+		v    any
+		typ  string
+		want bool
+	}{
+		{1, "integer", true},
+		{1, "number", true},
+		{1.5, "integer", false},
+		{2.0, "integer", true},
+		{"1", "number", false},
+		{[]byte("x"), "string", true},
+		{[]int{1}, "array", true},
+		{map[string]any{}, "object", true},
+		{struct{}{}, "object", true},
+		{true, "boolean", true},
+		{(*int)(nil), "integer", false},
+	}
+	for _, tt := range tests {
+		if got := paramHasType(tt.v, tt.typ); got != tt.want {
+			t.Errorf("paramHasType(%#v, %s) = %v", tt.v, tt.typ, got)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package goproxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// Resolver 域名解析器，*net.Resolver实现了该接口
+type Resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// SetResolver 设置直接连接目标或代理服务器时使用的域名解析器，为nil时使用系统默认解析
+// 可传入指定了Dial的*net.Resolver以使用特定的DNS服务器，或自行实现Resolver以支持分区解析等场景。
+// 注意: 通过HTTP代理的CONNECT或SOCKS5代理访问目标时，目标域名由代理解析
+func (r *GoProxy) SetResolver(res Resolver) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.resolver = res
+	if r.dnsCache != nil {
+		r.dnsCache.clear()
+	}
+	r.closeIdleConns()
+}
+
+// GetResolver 获取当前使用的域名解析器，未设置时返回nil
+func (r *GoProxy) GetResolver() Resolver {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.resolver
+}
+
+// dialPlan 一次直接连接使用的配置快照
+type dialPlan struct {
+	res     Resolver // 域名解析器，为nil时由net.Dialer解析
+	policy  IPPolicy // IP地址族策略
+	localIP net.IP   // 绑定的源地址
+	iface   string   // 绑定的网卡，按目标地址族选择其地址作为源地址
+
+	fallbackDelay time.Duration // Happy Eyeballs中启动下一次连接前的等待时间，见SetFallbackDelay
+	dialFunc      DialFunc      // 自定义的底层拨号函数，为nil时使用net.Dialer
+
+	keepAlive *net.KeepAliveConfig // TCP keepalive参数，为nil时使用默认值
+	nagle     bool                 // 是否开启Nagle算法
+
+	guard *ssrfGuard // 检查实际连接的IP地址的SSRF防护规则，为nil时不检查
+}
+
+// dial 解析addr中的域名后按策略排序，以Happy Eyeballs的方式连接解析结果，返回第一个成功的连接
+func (p dialPlan) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	network = p.policy.restrictNetwork(network)
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		if err := p.guard.checkIP(ip); err != nil {
+			return nil, err
+		}
+		return p.dialIP(ctx, network, ip, port)
+	}
+	res := p.res
+	if res == nil {
+		// 使用SSRF防护时自行解析，以便检查并连接解析得到的地址
+		if p.policy != PreferIPv4 && p.policy != PreferIPv6 && p.iface == "" && p.guard == nil {
+			return p.netDial(ctx, network, addr, p.localIP)
+		}
+		res = net.DefaultResolver
+	}
+	ips, err := res.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, newError(ErrDNS, fmt.Errorf("解析域名%s失败: %w", host, err))
+	}
+	var candidates []net.IP
+	for _, ip := range p.policy.sortIPs(ips) {
+		if !ipMatchesNetwork(ip.IP, network) || p.localIP != nil && (p.localIP.To4() != nil) != (ip.IP.To4() != nil) {
+			continue
+		}
+		candidates = append(candidates, ip.IP)
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("连接%s失败: 没有可用的地址", host)
+	}
+	// 解析结果中有任一地址被拒绝时整体拒绝，避免依赖连接顺序
+	for _, ip := range candidates {
+		if err := p.guard.checkIP(ip); err != nil {
+			return nil, fmt.Errorf("%s解析为%s: %w", host, ip, err)
+		}
+	}
+	conn, err := p.dialParallel(ctx, network, interleaveFamilies(candidates), port)
+	if err != nil {
+		return nil, fmt.Errorf("连接%s失败: %w", host, err)
+	}
+	return conn, nil
+}
+
+// dialIP 从绑定的源地址连接ip
+func (p dialPlan) dialIP(ctx context.Context, network string, ip net.IP, port string) (net.Conn, error) {
+	local := p.localIP
+	if p.iface != "" && p.dialFunc == nil {
+		var err error
+		if local, err = interfaceAddr(p.iface, ip.To4() == nil); err != nil {
+			return nil, err
+		}
+	}
+	return p.netDial(ctx, network, net.JoinHostPort(ip.String(), port), local)
+}
+
+// netDial 建立底层连接并应用TCP选项，设置了dialFunc时由其拨号，此时不绑定源地址
+func (p dialPlan) netDial(ctx context.Context, network, addr string, local net.IP) (net.Conn, error) {
+	var conn net.Conn
+	var err error
+	if p.dialFunc != nil {
+		conn, err = p.dialFunc(ctx, network, addr)
+	} else {
+		d := &net.Dialer{LocalAddr: localAddr(network, local), FallbackDelay: p.fallbackDelay}
+		conn, err = d.DialContext(ctx, network, addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := p.tuneTCP(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("设置TCP选项失败: %w", err)
+	}
+	return conn, nil
+}
+
+// ipMatchesNetwork 判断ip是否可用于network，如tcp4只接受IPv4地址
+func ipMatchesNetwork(ip net.IP, network string) bool {
+	switch network[len(network)-1] {
+	case '4':
+		return ip.To4() != nil
+	case '6':
+		return ip.To4() == nil
+	}
+	return true
+}
+
+// SetHostOverride 将访问指定主机的连接拨向固定地址，类似hosts文件，
+// URL、Host请求头、SNI和证书校验仍使用原主机名，可用于测试预发布环境或绕过DNS。
+// 使用HTTP/SOCKS5代理时由代理连接该固定地址
+// 参数:
+//   - host: 目标主机名，支持"*.example.com"形式的通配符
+//   - addr: 实际连接的地址，如"10.1.2.3:443"；省略端口时沿用请求的端口；为空时删除该主机的设置
+func (r *GoProxy) SetHostOverride(host, addr string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	host = normalizeHost(host)
+	if addr == "" {
+		delete(r.hostOverrides, host)
+	} else {
+		if r.hostOverrides == nil {
+			r.hostOverrides = make(map[string]string)
+		}
+		r.hostOverrides[host] = addr
+	}
+	r.closeIdleConns()
+}
+
+// overrideAddr 返回addr按SetHostOverride替换后的实际连接地址，调用方需持有r.mu
+func (r *GoProxy) overrideAddr(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	target, ok := lookupHost(r.hostOverrides, host)
+	if !ok {
+		return addr
+	}
+	if _, _, err := net.SplitHostPort(target); err == nil {
+		return target
+	}
+	return net.JoinHostPort(strings.Trim(target, "[]"), port)
+}
@@ -0,0 +1,109 @@
+package goproxy
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+var _ Resolver = (*net.Resolver)(nil)
+
+// staticResolver 按固定表解析域名
+type staticResolver map[string][]net.IPAddr
+
+func (s staticResolver) LookupIPAddr(_ context.Context, host string) ([]net.IPAddr, error) {
+	if ips, ok := s[host]; ok {
+		return ips, nil
+	}
+	return nil, errors.New("no such host")
+}
+
+func TestGoProxy_SetResolver(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Host)
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+	target := "http://internal.test:" + u.Port()
+
+	c := New()
+	res := staticResolver{"internal.test": {
+		{IP: net.ParseIP("::1")}, // 不可用的地址，应继续尝试下一个
+		{IP: net.ParseIP("127.0.0.1")},
+	}}
+	c.SetResolver(res)
+	if c.GetResolver() == nil {
+		t.Fatal("解析器未保存")
+	}
+	if got := getBody(t, c, target); got != "internal.test:"+u.Port() {
+		t.Errorf("响应为%q", got)
+	}
+
+	if _, err := c.GetClient().Get("http://missing.test/"); err == nil {
+		t.Error("无法解析的域名应返回错误")
+	}
+
+	c.SetResolver(nil)
+	if _, err := c.GetClient().Get(target); err == nil {
+		t.Error("恢复系统解析后不应解析测试域名")
+	}
+}
+
+func TestIPMatchesNetwork(t *testing.T) {
+	v4, v6 := net.ParseIP("127.0.0.1"), net.ParseIP("::1")
+	if !ipMatchesNetwork(v4, "tcp4") || ipMatchesNetwork(v6, "tcp4") || !ipMatchesNetwork(v6, "udp6") || !ipMatchesNetwork(v6, "tcp") {
+		t.Error("网络类型匹配错误")
+	}
+}
+
+func TestGoProxy_SetHostOverride(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Host)
+	}))
+	defer srv.Close()
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Host)
+	}))
+	defer plain.Close()
+	u, _ := url.Parse(srv.URL)
+	pu, _ := url.Parse(plain.URL)
+
+	c := New()
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+	c.SetRootCAs(pool)
+	c.SetTLSVerify(true)
+	// 测试证书签发给example.com，证书校验应使用原主机名
+	c.SetHostOverride("example.com", "127.0.0.1")
+	if got := getBody(t, c, "https://example.com:"+u.Port()); got != "example.com:"+u.Port() {
+		t.Errorf("响应为%q", got)
+	}
+
+	c.SetHostOverride("*.staging.test", pu.Host)
+	proxySrv, connects := newTestProxy(t)
+	if err := c.SetProxy(proxySrv.URL); err != nil {
+		t.Fatal(err)
+	}
+	if got := getBody(t, c, "http://api.staging.test/"); got != "api.staging.test" {
+		t.Errorf("响应为%q", got)
+	}
+	if connects.Load() != 1 {
+		t.Errorf("应通过CONNECT隧道连接固定地址, CONNECT次数为%d", connects.Load())
+	}
+
+	c.SetHostOverride("*.staging.test", "")
+	resp, err := c.GetClient().Get("http://api.staging.test/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("删除设置后应由代理按主机名连接, 状态码为%d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,251 @@
+package goproxy
+
+import (
+	"context"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// RetryPolicy 请求失败时的重试策略，是否重试由ClassifyRetry判断
+type RetryPolicy struct {
+	Attempts   int           // 最多重试的次数，小于等于0时不重试
+	Backoff    time.Duration // 第一次重试前的等待时间，之后每次翻倍并加入随机抖动，为0时为100ms
+	MaxBackoff time.Duration // 等待时间的上限，也限制服务器Retry-After要求的等待时间，为0时为10s
+
+	// StatusCodes 按请求方法指定可重试的状态码，代替ClassifyRetry内置的状态码列表，为nil时使用内置列表。
+	// 连接失败等错误仍按ClassifyRetry判断
+	StatusCodes *RetryStatusCodes
+}
+
+// RetryStatusCodes 可重试的状态码矩阵，某请求方法可重试的状态码为Any与Methods中该方法的状态码的并集，
+// 如GET重试500而POST不重试、所有方法都重试CDN的522和524:
+//
+//	&goproxy.RetryStatusCodes{
+//		Any:     []int{502, 503, 504, 522, 524},
+//		Methods: map[string][]int{"GET": {500}},
+//	}
+//
+// Methods中为POST、PATCH等非幂等方法指定的状态码使该方法的请求也可以重试，但只在返回这些状态码(或Any中的状态码)时重试，
+// 连接失败等错误不重试，因为请求可能已被服务器处理；没有为其指定时，非幂等请求仍需带有Idempotency-Key请求头才会重试。
+// 407和429仍建议更换代理重试(见RetryOtherProxy)，其他状态码通过同一代理重试
+type RetryStatusCodes struct {
+	Any     []int            // 所有请求方法都重试的状态码
+	Methods map[string][]int // 按请求方法重试的状态码，方法名不区分大小写
+}
+
+// clone 复制矩阵并将方法名转换为大写
+func (s *RetryStatusCodes) clone() *RetryStatusCodes {
+	if s == nil {
+		return nil
+	}
+	c := &RetryStatusCodes{Any: slices.Clone(s.Any)}
+	if s.Methods != nil {
+		c.Methods = make(map[string][]int, len(s.Methods))
+		for method, codes := range s.Methods {
+			method = strings.ToUpper(method)
+			c.Methods[method] = append(c.Methods[method], codes...)
+		}
+	}
+	return c
+}
+
+// hasMethod 判断是否为method指定了可重试的状态码
+func (s *RetryStatusCodes) hasMethod(method string) bool {
+	return s != nil && len(s.Methods[method]) > 0
+}
+
+// retryable 判断method请求返回的状态码code是否可重试
+func (s *RetryStatusCodes) retryable(method string, code int) bool {
+	if method == "" {
+		method = http.MethodGet
+	}
+	return slices.Contains(s.Any, code) || slices.Contains(s.Methods[method], code)
+}
+
+// classify 按策略给出请求结果的重试建议，设置了StatusCodes时按其判断状态码
+func (p RetryPolicy) classify(method string, resp *http.Response, err error) RetryAdvice {
+	if err != nil || resp == nil || p.StatusCodes == nil {
+		return ClassifyRetry(resp, err)
+	}
+	if !p.StatusCodes.retryable(method, resp.StatusCode) {
+		return RetryNever
+	}
+	if advice := classifyRetryStatus(resp.StatusCode); advice != RetryNever {
+		return advice
+	}
+	return RetrySameProxy
+}
+
+// 重试等待时间的默认值
+const (
+	defaultRetryBackoff    = 100 * time.Millisecond
+	defaultRetryMaxBackoff = 10 * time.Second
+)
+
+// RetryTransport 按RetryPolicy重试失败请求的中间件，通过SetTransport安装:
+//
+//	c.SetTransport(goproxy.NewRetryTransport(goproxy.RetryPolicy{Attempts: 3}, c.GetTransport()))
+//
+// 只重试幂等的请求(GET、HEAD、OPTIONS、TRACE、PUT、DELETE或带有Idempotency-Key请求头)
+// 以及RetryStatusCodes.Methods中指定了状态码的方法的请求，且请求体为空或可以通过GetBody重新获取。ClassifyRetry建议更换代理时同样重试，
+// 使用SetRouter的代理组时新连接会轮换到组中的下一个代理
+type RetryTransport struct {
+	next    http.RoundTripper
+	policy  atomic.Pointer[RetryPolicy]
+	retries atomic.Int64
+}
+
+// NewRetryTransport 创建重试中间件
+// 参数:
+//   - p: 重试策略
+//   - next: 实际发送请求的RoundTripper，为nil时使用http.DefaultTransport
+func NewRetryTransport(p RetryPolicy, next http.RoundTripper) *RetryTransport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	t := &RetryTransport{next: next}
+	t.SetPolicy(p)
+	return t
+}
+
+// Unwrap 返回实际发送请求的RoundTripper，GoProxy.SetTransport通过它在其中的*http.Transport上安装代理等设置
+func (t *RetryTransport) Unwrap() http.RoundTripper {
+	return t.next
+}
+
+// SetPolicy 修改重试策略，对之后开始的请求生效，调用后修改p.StatusCodes不影响已设置的策略
+func (t *RetryTransport) SetPolicy(p RetryPolicy) {
+	p.StatusCodes = p.StatusCodes.clone()
+	t.policy.Store(&p)
+}
+
+// Policy 返回当前的重试策略
+func (t *RetryTransport) Policy() RetryPolicy {
+	p := *t.policy.Load()
+	p.StatusCodes = p.StatusCodes.clone()
+	return p
+}
+
+// Retries 返回累计的重试次数
+func (t *RetryTransport) Retries() int64 {
+	return t.retries.Load()
+}
+
+func (t *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	p := *t.policy.Load()
+	if p.Attempts <= 0 || !rewindable(req) {
+		return t.next.RoundTrip(req)
+	}
+	// 非幂等的请求只在状态码矩阵为其方法指定了状态码时重试，且只按状态码重试
+	statusOnly := !idempotent(req)
+	if statusOnly && !p.StatusCodes.hasMethod(req.Method) {
+		return t.next.RoundTrip(req)
+	}
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			var err error
+			if req, err = rewindRequest(req); err != nil {
+				return nil, err
+			}
+		}
+		resp, err := t.next.RoundTrip(req)
+		if attempt >= p.Attempts || statusOnly && err != nil || p.classify(req.Method, resp, err) == RetryNever {
+			return resp, err
+		}
+		wait := p.backoff(attempt)
+		if err == nil {
+			wait = retryAfter(resp, wait, p.maxBackoff())
+			// 读完响应体以便复用连接
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+		}
+		if err := sleepContext(req.Context(), wait); err != nil {
+			return nil, err
+		}
+		t.retries.Add(1)
+	}
+}
+
+// backoff 返回第attempt次失败后的等待时间: 指数增长，在上限内取[d/2, d)的随机值
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.Backoff
+	if d <= 0 {
+		d = defaultRetryBackoff
+	}
+	limit := p.maxBackoff()
+	for i := 0; i < attempt && d < limit; i++ {
+		d *= 2
+	}
+	d = min(d, limit)
+	return d/2 + rand.N(d/2+1)
+}
+
+func (p RetryPolicy) maxBackoff() time.Duration {
+	if p.MaxBackoff <= 0 {
+		return defaultRetryMaxBackoff
+	}
+	return p.MaxBackoff
+}
+
+// retryAfter 按响应的Retry-After(秒数或HTTP日期)确定等待时间，不超过limit；没有或无法解析时返回wait
+func retryAfter(resp *http.Response, wait, limit time.Duration) time.Duration {
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return wait
+	}
+	var d time.Duration
+	if secs, err := strconv.Atoi(v); err == nil {
+		d = time.Duration(secs) * time.Second
+	} else if t, err := http.ParseTime(v); err == nil {
+		d = time.Until(t)
+	} else {
+		return wait
+	}
+	return min(max(d, 0), limit)
+}
+
+// rewindable 判断请求体是否为空或可以重新获取
+func rewindable(req *http.Request) bool {
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+// idempotent 判断请求是否可以安全地重新发送: 方法是幂等的或带有Idempotency-Key请求头
+func idempotent(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get("Idempotency-Key") != "" || req.Header.Get("X-Idempotency-Key") != ""
+}
+
+// rewindRequest 返回请求体重置到开头的请求副本
+func rewindRequest(req *http.Request) (*http.Request, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return req, nil
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	clone := req.Clone(req.Context())
+	clone.Body = body
+	return clone, nil
+}
+
+// sleepContext 等待d，ctx结束时提前返回其错误
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,246 @@
+package goproxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRetryTransport(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := requests.Add(1)
+		body, _ := io.ReadAll(r.Body)
+		if n%3 != 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(w, "ok:"+string(body))
+	}))
+	defer srv.Close()
+
+	c := New()
+	rt := NewRetryTransport(RetryPolicy{Attempts: 3, Backoff: time.Millisecond}, c.GetTransport())
+	c.SetTransport(rt)
+
+	// 前两次返回503，第三次成功
+	if got := getBody(t, c, srv.URL); got != "ok:" || requests.Load() != 3 {
+		t.Errorf("响应为%q，请求了%d次", got, requests.Load())
+	}
+	// 可以重新获取请求体的PUT请求同样重试，每次发送完整的请求体
+	req, _ := http.NewRequest(http.MethodPut, srv.URL, strings.NewReader("data"))
+	if got := doBody(t, c, req); got != "ok:data" || requests.Load() != 6 {
+		t.Errorf("PUT的响应为%q，请求了%d次", got, requests.Load())
+	}
+	// POST不是幂等的，不重试
+	resp, err := c.GetClient().Post(srv.URL, "text/plain", strings.NewReader("x"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || requests.Load() != 7 {
+		t.Errorf("POST的状态码为%d，请求了%d次", resp.StatusCode, requests.Load())
+	}
+	if rt.Retries() != 4 {
+		t.Errorf("重试了%d次", rt.Retries())
+	}
+
+	// 超过重试次数后返回最后一次的响应
+	rt.SetPolicy(RetryPolicy{Attempts: 1, Backoff: time.Millisecond})
+	requests.Store(0)
+	resp, err = c.GetClient().Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || requests.Load() != 2 {
+		t.Errorf("超过重试次数后状态码为%d，请求了%d次", resp.StatusCode, requests.Load())
+	}
+}
+
+func TestRetryTransport_StatusCodes(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		code, _ := strconv.Atoi(r.URL.Query().Get("code"))
+		w.WriteHeader(code)
+	}))
+	defer srv.Close()
+
+	c := New()
+	c.SetTransport(NewRetryTransport(RetryPolicy{
+		Attempts: 1,
+		Backoff:  time.Millisecond,
+		StatusCodes: &RetryStatusCodes{
+			Any:     []int{522, 524},
+			Methods: map[string][]int{"get": {500}},
+		},
+	}, c.GetTransport()))
+
+	cases := []struct {
+		method string
+		code   int
+		want   int32
+	}{
+		{http.MethodGet, 500, 2},
+		{http.MethodPut, 500, 1}, // 只有GET重试500
+		{http.MethodPut, 524, 2},
+		{http.MethodGet, 522, 2},
+		{http.MethodGet, 503, 1}, // 不在矩阵中的内置状态码不再重试
+		{http.MethodPost, 522, 1},
+	}
+	for _, tc := range cases {
+		requests.Store(0)
+		req, _ := http.NewRequest(tc.method, srv.URL+"?code="+strconv.Itoa(tc.code), nil)
+		resp, err := c.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if requests.Load() != tc.want {
+			t.Errorf("%s %d请求了%d次，应为%d次", tc.method, tc.code, requests.Load(), tc.want)
+		}
+	}
+	// 带有Idempotency-Key的POST同样按矩阵重试
+	requests.Store(0)
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"?code=522", strings.NewReader("x"))
+	req.Header.Set("Idempotency-Key", "1")
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if requests.Load() != 2 {
+		t.Errorf("带有Idempotency-Key的POST请求了%d次", requests.Load())
+	}
+}
+
+func TestRetryTransport_StatusCodesPost(t *testing.T) {
+	var requests atomic.Int32
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		b, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(b))
+		code, _ := strconv.Atoi(r.URL.Query().Get("code"))
+		w.WriteHeader(code)
+	}))
+	defer srv.Close()
+
+	c := New()
+	c.SetTransport(NewRetryTransport(RetryPolicy{
+		Attempts:    1,
+		Backoff:     time.Millisecond,
+		StatusCodes: &RetryStatusCodes{Any: []int{522}, Methods: map[string][]int{"post": {503}}},
+	}, c.GetTransport()))
+
+	cases := []struct {
+		method string
+		code   int
+		want   int32
+	}{
+		// 矩阵中为POST指定了状态码，没有Idempotency-Key时同样重试，请求体重新发送
+		{http.MethodPost, 503, 2},
+		{http.MethodPost, 522, 2},
+		{http.MethodPost, 500, 1},
+		// 没有为PATCH指定状态码，Any中的状态码不会使其重试
+		{http.MethodPatch, 522, 1},
+	}
+	for _, tc := range cases {
+		requests.Store(0)
+		bodies = nil
+		req, _ := http.NewRequest(tc.method, srv.URL+"?code="+strconv.Itoa(tc.code), strings.NewReader("x"))
+		resp, err := c.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if requests.Load() != tc.want || slices.ContainsFunc(bodies, func(b string) bool { return b != "x" }) {
+			t.Errorf("%s %d请求了%d次，应为%d次，请求体为%q", tc.method, tc.code, requests.Load(), tc.want, bodies)
+		}
+	}
+
+	// 连接失败时POST不重试
+	var dials atomic.Int32
+	c.SetDialContext(func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dials.Add(1)
+		return nil, syscall.ECONNREFUSED
+	})
+	req, _ := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader("x"))
+	if _, err := c.Do(req); err == nil || dials.Load() != 1 {
+		t.Errorf("错误为%v，拨号%d次", err, dials.Load())
+	}
+}
+
+func TestRetryPolicy_Classify(t *testing.T) {
+	p := RetryPolicy{StatusCodes: &RetryStatusCodes{Any: []int{429, 522}}}
+	cases := []struct {
+		code int
+		want RetryAdvice
+	}{
+		{429, RetryOtherProxy},
+		{522, RetrySameProxy},
+		{503, RetryNever},
+	}
+	for _, tc := range cases {
+		if got := p.classify(http.MethodGet, &http.Response{StatusCode: tc.code}, nil); got != tc.want {
+			t.Errorf("%d的建议为%v，应为%v", tc.code, got, tc.want)
+		}
+	}
+	if got := p.classify(http.MethodGet, nil, context.DeadlineExceeded); got != RetrySameProxy {
+		t.Errorf("超时的建议为%v", got)
+	}
+}
+
+func TestRetryTransport_RetryAfter(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.Header().Set("Retry-After", "3600")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		io.WriteString(w, "ok")
+	}))
+	defer srv.Close()
+
+	c := New()
+	c.SetTransport(NewRetryTransport(RetryPolicy{Attempts: 2, Backoff: time.Millisecond, MaxBackoff: 50 * time.Millisecond}, c.GetTransport()))
+	start := time.Now()
+	if got := getBody(t, c, srv.URL); got != "ok" {
+		t.Errorf("响应为%q", got)
+	}
+	// Retry-After受MaxBackoff限制
+	if d := time.Since(start); d < 50*time.Millisecond || d > 2*time.Second {
+		t.Errorf("等待了%v", d)
+	}
+
+	// 等待期间取消请求
+	requests.Store(0)
+	c.SetTransport(NewRetryTransport(RetryPolicy{Attempts: 2, Backoff: time.Hour, MaxBackoff: time.Hour}, c.GetTransport()))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	if _, err := c.Do(req); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("取消后错误为%v", err)
+	}
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	p := RetryPolicy{Backoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	for attempt, want := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second} {
+		if d := p.backoff(attempt); d < want/2 || d > want {
+			t.Errorf("第%d次的等待时间为%v", attempt, d)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package goproxy
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+)
+
+// RetryAdvice 对一次失败请求的重试建议
+type RetryAdvice int
+
+const (
+	// RetryNever 不应重试: 请求成功、被调用方取消，或重试也会得到相同的结果(如证书无效、域名不存在、4xx)
+	RetryNever RetryAdvice = iota
+	// RetrySameProxy 目标暂时不可用，可以通过同一代理重试
+	RetrySameProxy
+	// RetryOtherProxy 问题出在代理上(无法连接、认证失败、出口IP被限流)，应换一个代理重试；未使用代理时与RetrySameProxy相同
+	RetryOtherProxy
+)
+
+func (a RetryAdvice) String() string {
+	switch a {
+	case RetrySameProxy:
+		return "RetrySameProxy"
+	case RetryOtherProxy:
+		return "RetryOtherProxy"
+	}
+	return "RetryNever"
+}
+
+// ClassifyRetry 根据请求返回的响应和错误判断是否值得重试以及是否应更换代理
+// 只判断失败的性质，不检查请求方法是否幂等、请求体能否重放，这些由调用方负责
+// 参数:
+//   - resp: 请求返回的响应，err不为nil时忽略
+//   - err: 请求返回的错误
+func ClassifyRetry(resp *http.Response, err error) RetryAdvice {
+	if err != nil {
+		return classifyRetryError(err)
+	}
+	if resp == nil {
+		return RetryNever
+	}
+	return classifyRetryStatus(resp.StatusCode)
+}
+
+// IsRetryable 判断请求返回的响应和错误是否值得重试，见ClassifyRetry
+func IsRetryable(resp *http.Response, err error) bool {
+	return ClassifyRetry(resp, err) != RetryNever
+}
+
+// IsTemporary 判断err是否为暂时性的错误(超时、连接被重置、代理暂时无法连接等)，稍后重试可能成功
+func IsTemporary(err error) bool {
+	return err != nil && classifyRetryError(err) != RetryNever
+}
+
+// classifyRetryStatus 按状态码给出重试建议
+func classifyRetryStatus(code int) RetryAdvice {
+	switch code {
+	case http.StatusProxyAuthRequired, http.StatusTooManyRequests:
+		// 代理认证失败或出口IP被限流，换代理才可能成功
+		return RetryOtherProxy
+	case http.StatusRequestTimeout, http.StatusTooEarly, http.StatusInternalServerError,
+		http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return RetrySameProxy
+	}
+	return RetryNever
+}
+
+// classifyRetryError 按错误给出重试建议，优先按ErrProxyAuth等类别判断
+func classifyRetryError(err error) RetryAdvice {
+	var dnsErr *net.DNSError
+	var certErr *tls.CertificateVerificationError
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidCert x509.CertificateInvalidError
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, ErrClosed), errors.Is(err, ErrBodyTooLarge), errors.Is(err, ErrDestinationDenied):
+		return RetryNever
+	case errors.Is(err, ErrProxyUnreachable), errors.Is(err, ErrProxyAuth):
+		return RetryOtherProxy
+	case errors.As(err, &certErr), errors.As(err, &unknownAuthority), errors.As(err, &hostnameErr), errors.As(err, &invalidCert):
+		// 证书问题重试也不会改变
+		return RetryNever
+	case errors.Is(err, ErrTLSHandshake):
+		// 握手被中断或重置，可能是代理线路受到干扰
+		return RetryOtherProxy
+	case errors.As(err, &dnsErr):
+		if dnsErr.IsTemporary || dnsErr.IsTimeout {
+			return RetrySameProxy
+		}
+		return RetryNever
+	case isTimeout(err), isRetryableH2Err(err),
+		errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.ECONNREFUSED),
+		errors.Is(err, syscall.ECONNABORTED), errors.Is(err, syscall.EPIPE):
+		return RetrySameProxy
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		// 其他网络错误，如网络不可达
+		return RetrySameProxy
+	}
+	return RetryNever
+}
@@ -0,0 +1,75 @@
+package goproxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestClassifyRetry(t *testing.T) {
+	tests := []struct {
+		name string
+		code int
+		err  error
+		want RetryAdvice
+	}{
+		{"成功", http.StatusOK, nil, RetryNever},
+		{"404", http.StatusNotFound, nil, RetryNever},
+		{"503", http.StatusServiceUnavailable, nil, RetrySameProxy},
+		{"429", http.StatusTooManyRequests, nil, RetryOtherProxy},
+		{"407", http.StatusProxyAuthRequired, nil, RetryOtherProxy},
+		{"取消", 0, fmt.Errorf("请求失败: %w", context.Canceled), RetryNever},
+		{"已关闭", 0, ErrClosed, RetryNever},
+		{"响应体过大", 0, fmt.Errorf("%w: 超过1字节", ErrBodyTooLarge), RetryNever},
+		{"代理无法连接", 0, newError(ErrProxyUnreachable, syscall.ECONNREFUSED), RetryOtherProxy},
+		{"代理认证", 0, newError(ErrProxyAuth, errors.New("407")), RetryOtherProxy},
+		{"域名不存在", 0, newError(ErrDNS, &net.DNSError{Err: "no such host", IsNotFound: true}), RetryNever},
+		{"DNS超时", 0, &net.DNSError{Err: "timeout", IsTimeout: true}, RetrySameProxy},
+		{"连接被重置", 0, &net.OpError{Op: "read", Err: syscall.ECONNRESET}, RetrySameProxy},
+		{"意外EOF", 0, io.ErrUnexpectedEOF, RetrySameProxy},
+		{"超时", 0, newError(ErrTimeout, context.DeadlineExceeded), RetrySameProxy},
+		{"握手中断", 0, newError(ErrTLSHandshake, io.EOF), RetryOtherProxy},
+		{"未知错误", 0, errors.New("未知"), RetryNever},
+	}
+	for _, tt := range tests {
+		var resp *http.Response
+		if tt.code != 0 {
+			resp = &http.Response{StatusCode: tt.code}
+		}
+		if got := ClassifyRetry(resp, tt.err); got != tt.want {
+			t.Errorf("%s: 建议为%v，期望%v", tt.name, got, tt.want)
+		}
+		if IsRetryable(resp, tt.err) != (tt.want != RetryNever) {
+			t.Errorf("%s: IsRetryable结果错误", tt.name)
+		}
+	}
+	if IsTemporary(nil) {
+		t.Error("nil不是暂时性错误")
+	}
+}
+
+func TestClassifyRetry_Transport(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	c := New()
+	// 校验证书时自签名证书无法通过，重试没有意义
+	c.SetTLSVerify(true)
+	_, err := c.GetClient().Get(srv.URL)
+	if !errors.Is(err, ErrTLSHandshake) || IsRetryable(nil, err) {
+		t.Errorf("证书无效时错误为%v，建议为%v", err, ClassifyRetry(nil, err))
+	}
+
+	c = New()
+	c.SetProxy("http://" + strings.TrimPrefix(srv.URL, "https://"))
+	srv.Close()
+	if _, err := c.GetClient().Get("https://example.com"); ClassifyRetry(nil, err) != RetryOtherProxy {
+		t.Errorf("代理无法连接时错误为%v，建议为%v", err, ClassifyRetry(nil, err))
+	}
+}
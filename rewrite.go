@@ -0,0 +1,391 @@
+package goproxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// RewriteRule 请求和响应的改写规则，匹配条件均满足时执行其中的动作，条件为空时不作限制
+type RewriteRule struct {
+	Name string `json:"name,omitempty"` // 规则名称，只用于错误信息
+
+	// 匹配条件
+	Host   string            `json:"host,omitempty"`   // 主机名，支持"*.example.com"形式的通配符
+	Method string            `json:"method,omitempty"` // 请求方法
+	Path   string            `json:"path,omitempty"`   // 匹配路径的正则表达式
+	Header map[string]string `json:"header,omitempty"` // 请求头名到匹配其值的正则表达式，请求头不存在时不匹配
+
+	// 动作，按以下顺序执行
+	Respond               *CannedResponse `json:"respond,omitempty"`                 // 直接返回该响应，不再发送请求，之后的规则不再执行
+	RewriteURL            string          `json:"rewrite_url,omitempty"`             // 替换请求地址，可以是绝对URL或以"/"开头的路径(可带查询参数)，支持用$1、${name}引用Path中的分组
+	SetHeaders            http.Header     `json:"set_headers,omitempty"`             // 设置请求头
+	RemoveHeaders         []string        `json:"remove_headers,omitempty"`          // 删除请求头
+	ReplaceRequestBody    []BodyReplace   `json:"replace_request_body,omitempty"`    // 替换请求体
+	SetResponseHeaders    http.Header     `json:"set_response_headers,omitempty"`    // 设置响应头
+	RemoveResponseHeaders []string        `json:"remove_response_headers,omitempty"` // 删除响应头
+	ReplaceResponseBody   []BodyReplace   `json:"replace_response_body,omitempty"`   // 替换响应体，跳过经过压缩(Content-Encoding)的响应体
+}
+
+// BodyReplace 对消息体的正则替换，Replacement支持用$1、${name}引用分组
+type BodyReplace struct {
+	Pattern     string `json:"pattern"`
+	Replacement string `json:"replacement"`
+}
+
+// CannedResponse 规则直接返回的响应
+type CannedResponse struct {
+	Status int         `json:"status"` // 状态码，为0时为200
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body,omitempty"`
+}
+
+// rewriteRule 编译后的改写规则
+type rewriteRule struct {
+	RewriteRule
+	host         map[string]struct{} // 以lookupHost匹配Host
+	path         *regexp.Regexp
+	header       map[string]*regexp.Regexp
+	requestBody  []bodyReplace
+	responseBody []bodyReplace
+}
+
+// bodyReplace 编译后的消息体替换
+type bodyReplace struct {
+	re          *regexp.Regexp
+	replacement []byte
+}
+
+// Rewriter 按规则改写请求和响应，可通过NewRewriteTransport作为客户端的中间件，
+// 也可将HandleRequest和HandleResponse作为本地代理服务器(server包)的处理函数。
+// 请求依次经过所有匹配的规则，后面的规则按前面改写后的请求匹配；响应的动作只由匹配了请求的规则执行
+type Rewriter struct {
+	rules []*rewriteRule
+}
+
+// NewRewriter 编译改写规则，正则表达式无效时返回错误
+func NewRewriter(rules ...RewriteRule) (*Rewriter, error) {
+	rw := &Rewriter{}
+	for i, rule := range rules {
+		name := rule.Name
+		if name == "" {
+			name = "#" + strconv.Itoa(i+1)
+		}
+		compiled, err := compileRewriteRule(rule)
+		if err != nil {
+			return nil, fmt.Errorf("改写规则%s无效: %w", name, err)
+		}
+		rw.rules = append(rw.rules, compiled)
+	}
+	return rw, nil
+}
+
+// ParseRewriteRules 从JSON数组解析改写规则，字段名见RewriteRule的json标签
+func ParseRewriteRules(data []byte) (*Rewriter, error) {
+	var rules []RewriteRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("解析改写规则失败: %w", err)
+	}
+	return NewRewriter(rules...)
+}
+
+// compileRewriteRule 编译规则中的正则表达式
+func compileRewriteRule(rule RewriteRule) (*rewriteRule, error) {
+	r := &rewriteRule{RewriteRule: rule}
+	if rule.Host != "" {
+		r.host = map[string]struct{}{normalizeHost(rule.Host): {}}
+	}
+	var err error
+	if rule.Path != "" {
+		if r.path, err = regexp.Compile(rule.Path); err != nil {
+			return nil, err
+		}
+	}
+	for key, pattern := range rule.Header {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		if r.header == nil {
+			r.header = make(map[string]*regexp.Regexp)
+		}
+		r.header[http.CanonicalHeaderKey(key)] = re
+	}
+	if r.requestBody, err = compileBodyReplaces(rule.ReplaceRequestBody); err != nil {
+		return nil, err
+	}
+	if r.responseBody, err = compileBodyReplaces(rule.ReplaceResponseBody); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// compileBodyReplaces 编译消息体替换
+func compileBodyReplaces(replaces []BodyReplace) ([]bodyReplace, error) {
+	var out []bodyReplace
+	for _, br := range replaces {
+		re, err := regexp.Compile(br.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, bodyReplace{re: re, replacement: []byte(br.Replacement)})
+	}
+	return out, nil
+}
+
+// matches 判断请求是否满足规则的匹配条件
+func (r *rewriteRule) matches(req *http.Request) bool {
+	if r.host != nil {
+		if _, ok := lookupHost(r.host, requestHost(req)); !ok {
+			return false
+		}
+	}
+	if r.Method != "" && !strings.EqualFold(r.Method, req.Method) {
+		return false
+	}
+	if r.path != nil && !r.path.MatchString(req.URL.Path) {
+		return false
+	}
+	for key, re := range r.header {
+		values, ok := req.Header[key]
+		if !ok || !slices.ContainsFunc(values, re.MatchString) {
+			return false
+		}
+	}
+	return true
+}
+
+// requestHost 返回请求的主机名(不含端口)，服务器收到的请求URL中没有主机时使用Host
+func requestHost(req *http.Request) string {
+	if host := req.URL.Hostname(); host != "" {
+		return host
+	}
+	if host, _, err := net.SplitHostPort(req.Host); err == nil {
+		return host
+	}
+	return req.Host
+}
+
+// rewriteMatchesKey 请求上下文中记录匹配的规则的键，供改写响应时使用
+type rewriteMatchesKey struct{}
+
+// HandleRequest 按规则改写请求，有规则直接返回响应时返回该响应。不修改传入的请求，有规则匹配时返回改写后的副本
+func (rw *Rewriter) HandleRequest(req *http.Request) (*http.Request, *http.Response) {
+	var matched []*rewriteRule
+	out := req
+	for _, rule := range rw.rules {
+		if !rule.matches(out) {
+			continue
+		}
+		if out == req {
+			out = req.Clone(req.Context())
+		}
+		matched = append(matched, rule)
+		if rule.Respond != nil {
+			return out, rule.Respond.response(out)
+		}
+		if err := rule.rewriteRequest(out); err != nil {
+			return out, &http.Response{
+				Status:     "400 Bad Request",
+				StatusCode: http.StatusBadRequest,
+				Proto:      "HTTP/1.1",
+				ProtoMajor: 1,
+				ProtoMinor: 1,
+				Header:     http.Header{"Content-Type": {"text/plain; charset=utf-8"}},
+				Body:       io.NopCloser(strings.NewReader(err.Error())),
+				Request:    out,
+			}
+		}
+	}
+	if len(matched) == 0 {
+		return req, nil
+	}
+	return out.WithContext(context.WithValue(out.Context(), rewriteMatchesKey{}, matched)), nil
+}
+
+// HandleResponse 按匹配了请求的规则改写响应，resp.Request需为HandleRequest返回的请求
+func (rw *Rewriter) HandleResponse(resp *http.Response) *http.Response {
+	if resp.Request == nil {
+		return resp
+	}
+	matched, _ := resp.Request.Context().Value(rewriteMatchesKey{}).([]*rewriteRule)
+	for _, rule := range matched {
+		rule.rewriteResponse(resp)
+	}
+	return resp
+}
+
+// rewriteRequest 执行规则中改写请求的动作
+func (r *rewriteRule) rewriteRequest(req *http.Request) error {
+	if r.RewriteURL != "" {
+		if err := r.rewriteURL(req); err != nil {
+			return err
+		}
+	}
+	for key, values := range r.SetHeaders {
+		req.Header[http.CanonicalHeaderKey(key)] = append([]string(nil), values...)
+	}
+	for _, key := range r.RemoveHeaders {
+		req.Header.Del(key)
+	}
+	if len(r.requestBody) > 0 && req.Body != nil && req.Body != http.NoBody {
+		data, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return fmt.Errorf("读取请求体失败: %w", err)
+		}
+		data = replaceBody(data, r.requestBody)
+		req.ContentLength = int64(len(data))
+		req.Body = io.NopCloser(bytes.NewReader(data))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(data)), nil
+		}
+	}
+	return nil
+}
+
+// rewriteURL 按RewriteURL替换请求地址
+func (r *rewriteRule) rewriteURL(req *http.Request) error {
+	target := r.RewriteURL
+	if r.path != nil {
+		if m := r.path.FindStringSubmatchIndex(req.URL.Path); m != nil {
+			target = string(r.path.ExpandString(nil, target, req.URL.Path, m))
+		}
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return fmt.Errorf("改写后的地址%s无效: %w", target, err)
+	}
+	if u.IsAbs() {
+		req.URL = u
+		req.Host = ""
+		return nil
+	}
+	req.URL.Path, req.URL.RawPath = u.Path, u.RawPath
+	if u.RawQuery != "" || u.ForceQuery {
+		req.URL.RawQuery = u.RawQuery
+	}
+	return nil
+}
+
+// rewriteResponse 执行规则中改写响应的动作
+func (r *rewriteRule) rewriteResponse(resp *http.Response) {
+	for key, values := range r.SetResponseHeaders {
+		resp.Header[http.CanonicalHeaderKey(key)] = append([]string(nil), values...)
+	}
+	for _, key := range r.RemoveResponseHeaders {
+		resp.Header.Del(key)
+	}
+	if len(r.responseBody) == 0 || resp.Body == nil || resp.Body == http.NoBody {
+		return
+	}
+	if enc := resp.Header.Get("Content-Encoding"); enc != "" && !strings.EqualFold(enc, "identity") {
+		return
+	}
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		// 保留已读取的部分，读取到末尾时返回原错误
+		resp.Body = io.NopCloser(io.MultiReader(bytes.NewReader(data), &errReader{err: err}))
+		return
+	}
+	data = replaceBody(data, r.responseBody)
+	resp.ContentLength = int64(len(data))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(data)))
+	resp.Header.Del("Transfer-Encoding")
+	resp.TransferEncoding = nil
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+}
+
+// replaceBody 依次执行消息体替换
+func replaceBody(data []byte, replaces []bodyReplace) []byte {
+	for _, br := range replaces {
+		data = br.re.ReplaceAll(data, br.replacement)
+	}
+	return data
+}
+
+// errReader 总是返回err的Reader
+type errReader struct {
+	err error
+}
+
+func (r *errReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
+
+// response 构造规则直接返回的响应
+func (c *CannedResponse) response(req *http.Request) *http.Response {
+	code := c.Status
+	if code == 0 {
+		code = http.StatusOK
+	}
+	header := make(http.Header, len(c.Header)+1)
+	for key, values := range c.Header {
+		header[http.CanonicalHeaderKey(key)] = append([]string(nil), values...)
+	}
+	header.Set("Content-Length", strconv.Itoa(len(c.Body)))
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", code, http.StatusText(code)),
+		StatusCode:    code,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(c.Body)),
+		ContentLength: int64(len(c.Body)),
+		Request:       req,
+	}
+}
+
+// RewriteTransport 按Rewriter的规则改写请求和响应的中间件，
+// 可通过GoProxy.SetTransport安装在底层Transport之上，如c.SetTransport(NewRewriteTransport(rw, c.GetTransport()))
+type RewriteTransport struct {
+	rw   *Rewriter
+	next http.RoundTripper
+}
+
+// NewRewriteTransport 创建改写中间件
+// 参数:
+//   - rw: 改写规则
+//   - next: 实际发送请求的RoundTripper，为nil时使用http.DefaultTransport
+func NewRewriteTransport(rw *Rewriter, next http.RoundTripper) *RewriteTransport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &RewriteTransport{rw: rw, next: next}
+}
+
+// Unwrap 返回实际发送请求的RoundTripper，GoProxy.SetTransport通过它在其中的*http.Transport上安装代理等设置
+func (t *RewriteTransport) Unwrap() http.RoundTripper {
+	return t.next
+}
+
+// RoundTrip 实现http.RoundTripper接口
+func (t *RewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	out, resp := t.rw.HandleRequest(req)
+	if resp != nil {
+		// RoundTripper需要关闭请求体
+		if out.Body != nil {
+			out.Body.Close()
+		}
+		return resp, nil
+	}
+	resp, err := t.next.RoundTrip(out)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Request == nil {
+		resp.Request = out
+	}
+	return t.rw.HandleResponse(resp), nil
+}
@@ -0,0 +1,83 @@
+package goproxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRewriteTransport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Internal", "1")
+		fmt.Fprintf(w, "%s %s %q %q %s", r.Method, r.URL.RequestURI(), r.Header.Get("X-Added"), r.Header.Get("X-Secret"), body)
+	}))
+	defer srv.Close()
+	rw, err := ParseRewriteRules([]byte(`[
+		{"name": "mock", "path": "^/mock$", "respond": {"status": 418, "header": {"X-Mock": ["1"]}, "body": "mocked"}},
+		{"name": "v2", "host": "api.test", "path": "^/v1/(\\w+)$", "rewrite_url": "/v2/$1?from=v1",
+		 "set_headers": {"X-Added": ["yes"]}, "remove_headers": ["X-Secret"],
+		 "remove_response_headers": ["X-Internal"], "replace_response_body": [{"pattern": "v2", "replacement": "V2"}]},
+		{"name": "body", "method": "POST", "header": {"Content-Type": "^text/"},
+		 "replace_request_body": [{"pattern": "secret=\\w+", "replacement": "secret=***"}]}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := New()
+	c.SetHostOverride("api.test", "127.0.0.1")
+	c.SetTransport(NewRewriteTransport(rw, c.GetTransport()))
+	base := strings.Replace(srv.URL, "127.0.0.1", "api.test", 1)
+
+	req, _ := http.NewRequest(http.MethodGet, base+"/v1/users", nil)
+	req.Header.Set("X-Secret", "s")
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if want := `GET /V2/users?from=v1 "yes" "" `; string(body) != want || resp.Header.Get("X-Internal") != "" {
+		t.Errorf("响应为%q, 响应头为%v", body, resp.Header)
+	}
+	if req.Header.Get("X-Secret") != "s" || req.URL.Path != "/v1/users" {
+		t.Error("原请求被修改")
+	}
+
+	// 主机不匹配时不改写
+	if got := getBody(t, c, srv.URL+"/v1/users"); !strings.HasPrefix(got, "GET /v1/users ") {
+		t.Errorf("主机不匹配时响应为%q", got)
+	}
+
+	resp, err = c.GetClient().Get(srv.URL + "/mock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 418 || string(body) != "mocked" || resp.Header.Get("X-Mock") != "1" {
+		t.Errorf("直接返回的响应为%d %q", resp.StatusCode, body)
+	}
+
+	resp, err = c.GetClient().Post(srv.URL+"/form", "text/plain", strings.NewReader("user=a&secret=abc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if want := `POST /form "" "" user=a&secret=***`; string(body) != want {
+		t.Errorf("替换请求体后响应为%q", body)
+	}
+}
+
+func TestNewRewriter_Invalid(t *testing.T) {
+	if _, err := NewRewriter(RewriteRule{Name: "bad", Path: "("}); err == nil || !strings.Contains(err.Error(), "bad") {
+		t.Errorf("错误为%v", err)
+	}
+	if _, err := ParseRewriteRules([]byte("{")); err == nil {
+		t.Error("无效的JSON应返回错误")
+	}
+}
@@ -0,0 +1,314 @@
+package goproxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 路由规则中内置的上游名称
+const (
+	RouteDirect = "DIRECT" // 直接连接
+	RouteReject = "REJECT" // 拒绝连接，返回ErrRouteRejected
+)
+
+// ErrRouteRejected 连接匹配了目标为REJECT的路由规则
+var ErrRouteRejected = errors.New("连接被路由规则拒绝")
+
+// GeoIPFunc 返回IP地址所属国家或地区的代码(如"CN")，未知时返回空字符串，GEOIP规则通过它判断
+type GeoIPFunc func(ip net.IP) string
+
+// Router 类似Clash的规则路由，按目标地址为每个连接选择上游，使同一客户端可以分流:
+//   - DOMAIN,example.com,上游: 域名完全相同
+//   - DOMAIN-SUFFIX,example.com,上游: 域名为example.com或其子域名
+//   - DOMAIN-KEYWORD,google,上游: 域名包含关键字
+//   - IP-CIDR,10.0.0.0/8,上游[,no-resolve]: 目标IP在网段中，IP-CIDR6同义
+//   - GEOIP,CN,上游[,no-resolve]: 目标IP属于该国家或地区，需要通过SetGeoIP提供查询函数
+//   - FINAL,上游: 匹配所有连接，MATCH同义
+//
+// 规则按顺序匹配第一条，没有匹配的规则时使用SetProxy设置的代理。域名规则中的国际化域名可以使用Unicode或punycode写法。目标为域名时IP-CIDR和GEOIP规则先解析域名，
+// 带有no-resolve时不解析，该规则只匹配IP地址的目标。
+// 上游为DIRECT、REJECT或上游组的名称，上游组中有多个代理时轮流使用
+type Router struct {
+	groups map[string]*upstreamGroup
+	rules  []routeRule
+	geoIP  atomic.Pointer[GeoIPFunc]
+}
+
+// upstreamGroup 上游组，由一个或多个代理组成
+type upstreamGroup struct {
+	proxies []*url.URL
+	next    atomic.Uint32
+}
+
+// routeRule 解析后的路由规则
+type routeRule struct {
+	kind      string
+	value     string
+	cidr      *net.IPNet
+	target    string
+	noResolve bool
+}
+
+// NewRouter 创建规则路由
+// 参数:
+//   - upstreams: 上游组的名称到代理地址列表，地址格式与SetProxy相同(不支持Unix套接字)，名称不能为DIRECT或REJECT
+//   - rules: 规则列表，格式为"类型,值,上游[,no-resolve]"
+func NewRouter(upstreams map[string][]string, rules []string) (*Router, error) {
+	rt := &Router{groups: make(map[string]*upstreamGroup)}
+	for name, proxies := range upstreams {
+		if name == RouteDirect || name == RouteReject {
+			return nil, fmt.Errorf("上游组名称%s与内置名称冲突", name)
+		}
+		if len(proxies) == 0 {
+			return nil, fmt.Errorf("上游组%s没有代理", name)
+		}
+		g := &upstreamGroup{}
+		for _, p := range proxies {
+			u, err := url.Parse(p)
+			if err != nil {
+				return nil, fmt.Errorf("上游组%s的代理地址无效: %w", name, err)
+			}
+			switch u.Scheme {
+			case "http", "https", "socks5":
+			default:
+				return nil, fmt.Errorf("上游组%s的代理协议不支持: %s", name, u.Scheme)
+			}
+			g.proxies = append(g.proxies, u)
+		}
+		rt.groups[name] = g
+	}
+	for _, line := range rules {
+		rule, err := parseRouteRule(line)
+		if err != nil {
+			return nil, fmt.Errorf("路由规则%q无效: %w", line, err)
+		}
+		if _, ok := rt.groups[rule.target]; !ok && rule.target != RouteDirect && rule.target != RouteReject {
+			return nil, fmt.Errorf("路由规则%q无效: 上游%s不存在", line, rule.target)
+		}
+		rt.rules = append(rt.rules, rule)
+	}
+	return rt, nil
+}
+
+// routerConfig YAML格式的路由配置
+type routerConfig struct {
+	Upstreams map[string]stringList `yaml:"upstreams"`
+	Rules     []string              `yaml:"rules"`
+}
+
+// stringList 可以写成单个字符串或字符串列表的YAML字段
+type stringList []string
+
+func (l *stringList) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*l = stringList{node.Value}
+		return nil
+	}
+	var list []string
+	if err := node.Decode(&list); err != nil {
+		return err
+	}
+	*l = list
+	return nil
+}
+
+// ParseRouter 从YAML解析规则路由，格式如下:
+//
+//	upstreams:
+//	  proxyA: socks5://127.0.0.1:1080
+//	  pool1:
+//	    - http://10.0.0.1:8080
+//	    - http://10.0.0.2:8080
+//	rules:
+//	  - DOMAIN-SUFFIX,google.com,proxyA
+//	  - DOMAIN-KEYWORD,ads,REJECT
+//	  - IP-CIDR,10.0.0.0/8,DIRECT,no-resolve
+//	  - GEOIP,CN,DIRECT
+//	  - FINAL,pool1
+func ParseRouter(data []byte) (*Router, error) {
+	var cfg routerConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("解析路由配置失败: %w", err)
+	}
+	upstreams := make(map[string][]string, len(cfg.Upstreams))
+	for name, proxies := range cfg.Upstreams {
+		upstreams[name] = proxies
+	}
+	return NewRouter(upstreams, cfg.Rules)
+}
+
+// LoadRouterFile 从YAML文件加载规则路由，格式见ParseRouter
+func LoadRouterFile(path string) (*Router, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取路由配置文件失败: %w", err)
+	}
+	return ParseRouter(data)
+}
+
+// parseRouteRule 解析一条规则
+func parseRouteRule(line string) (routeRule, error) {
+	parts := strings.Split(line, ",")
+	for i := range parts {
+		parts[i] = strings.TrimSpace(parts[i])
+	}
+	kind := strings.ToUpper(parts[0])
+	if kind == "FINAL" || kind == "MATCH" {
+		if len(parts) != 2 {
+			return routeRule{}, errors.New("格式应为FINAL,上游")
+		}
+		return routeRule{kind: "FINAL", target: parts[1]}, nil
+	}
+	if len(parts) < 3 || len(parts) > 4 {
+		return routeRule{}, errors.New("格式应为类型,值,上游[,no-resolve]")
+	}
+	rule := routeRule{kind: kind, value: parts[1], target: parts[2]}
+	if len(parts) == 4 {
+		if !strings.EqualFold(parts[3], "no-resolve") {
+			return routeRule{}, fmt.Errorf("未知的选项: %s", parts[3])
+		}
+		rule.noResolve = true
+	}
+	switch kind {
+	case "DOMAIN", "DOMAIN-SUFFIX":
+		rule.value = normalizeHost(rule.value)
+	case "DOMAIN-KEYWORD":
+		rule.value = strings.ToLower(rule.value)
+	case "IP-CIDR", "IP-CIDR6":
+		_, cidr, err := net.ParseCIDR(rule.value)
+		if err != nil {
+			return routeRule{}, err
+		}
+		rule.kind, rule.cidr = "IP-CIDR", cidr
+	case "GEOIP":
+		rule.value = strings.ToUpper(rule.value)
+	default:
+		return routeRule{}, fmt.Errorf("不支持的规则类型: %s", parts[0])
+	}
+	return rule, nil
+}
+
+// SetGeoIP 设置GEOIP规则使用的查询函数，未设置时GEOIP规则不匹配任何连接
+func (rt *Router) SetGeoIP(fn GeoIPFunc) {
+	if fn == nil {
+		rt.geoIP.Store(nil)
+		return
+	}
+	rt.geoIP.Store(&fn)
+}
+
+// Match 返回host(域名或IP地址)匹配的上游名称，没有匹配的规则时返回空字符串，可用于检查规则。
+// IP规则需要解析域名时使用res，res为nil时使用系统默认解析
+func (rt *Router) Match(ctx context.Context, host string, res Resolver) string {
+	host = normalizeHost(strings.Trim(host, "[]"))
+	ip := net.ParseIP(host)
+	var ips []net.IP
+	resolved := ip != nil
+	if ip != nil {
+		ips = []net.IP{ip}
+	}
+	for _, rule := range rt.rules {
+		switch rule.kind {
+		case "FINAL":
+			return rule.target
+		case "DOMAIN":
+			if ip == nil && host == rule.value {
+				return rule.target
+			}
+		case "DOMAIN-SUFFIX":
+			if ip == nil && (host == rule.value || strings.HasSuffix(host, "."+rule.value)) {
+				return rule.target
+			}
+		case "DOMAIN-KEYWORD":
+			// 关键字可能是Unicode写法，同时匹配域名的两种形式
+			if ip == nil && (strings.Contains(host, rule.value) || strings.Contains(ToUnicodeHost(host), rule.value)) {
+				return rule.target
+			}
+		case "IP-CIDR", "GEOIP":
+			if ip == nil && rule.noResolve {
+				continue
+			}
+			if !resolved {
+				// 解析失败时IP规则都不匹配，连接时再报告解析错误
+				ips = lookupIPs(ctx, res, host)
+				resolved = true
+			}
+			if rule.matchIPs(ips, rt.geoIP.Load()) {
+				return rule.target
+			}
+		}
+	}
+	return ""
+}
+
+// matchIPs 判断ips中是否有IP匹配IP-CIDR或GEOIP规则
+func (r *routeRule) matchIPs(ips []net.IP, geoIP *GeoIPFunc) bool {
+	for _, ip := range ips {
+		if r.kind == "IP-CIDR" && r.cidr.Contains(ip) {
+			return true
+		}
+		if r.kind == "GEOIP" && geoIP != nil && strings.EqualFold((*geoIP)(ip), r.value) {
+			return true
+		}
+	}
+	return false
+}
+
+// lookupIPs 解析host，失败时返回nil
+func lookupIPs(ctx context.Context, res Resolver, host string) []net.IP {
+	if res == nil {
+		res = net.DefaultResolver
+	}
+	addrs, err := res.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil
+	}
+	ips := make([]net.IP, len(addrs))
+	for i, a := range addrs {
+		ips[i] = a.IP
+	}
+	return ips
+}
+
+// route 为到host的连接选择上游: matched为false时没有匹配的规则；proxy为nil时直接连接
+func (rt *Router) route(ctx context.Context, host string, res Resolver) (proxy *url.URL, matched bool, err error) {
+	target := rt.Match(ctx, host, res)
+	switch target {
+	case "":
+		return nil, false, nil
+	case RouteDirect:
+		return nil, true, nil
+	case RouteReject:
+		return nil, true, fmt.Errorf("%w: %s", ErrRouteRejected, host)
+	}
+	g := rt.groups[target]
+	return g.proxies[int(g.next.Add(1)-1)%len(g.proxies)], true, nil
+}
+
+// routedProxyKey 在拨号的上下文中记录路由选择的代理，用于错误信息
+type routedProxyKey struct{}
+
+// SetRouter 设置规则路由，为每个连接按目标选择直连、拒绝或某个上游组，没有匹配的规则时使用SetProxy设置的代理；
+// 为nil时取消路由。使用路由时访问http目标也通过CONNECT隧道连接HTTP代理，
+// 代理统计和流量日志中的代理仍为SetProxy设置的代理
+func (r *GoProxy) SetRouter(rt *Router) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.router = rt
+	r.closeIdleConns()
+}
+
+// GetRouter 返回SetRouter设置的规则路由
+func (r *GoProxy) GetRouter() *Router {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.router
+}
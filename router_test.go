@@ -0,0 +1,145 @@
+package goproxy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRouter_Match(t *testing.T) {
+	rt, err := ParseRouter([]byte(`
+upstreams:
+  proxyA: socks5://127.0.0.1:1080
+  pool1:
+    - http://10.0.0.1:8080
+    - http://10.0.0.2:8080
+rules:
+  - DOMAIN,exact.test,proxyA
+  - DOMAIN-SUFFIX,google.com,proxyA
+  - DOMAIN-KEYWORD,ads,REJECT
+  - IP-CIDR,10.0.0.0/8,DIRECT,no-resolve
+  - IP-CIDR,192.168.0.0/16,DIRECT
+  - GEOIP,CN,DIRECT
+  - FINAL,pool1
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt.SetGeoIP(func(ip net.IP) string {
+		if ip.Equal(net.ParseIP("1.2.4.8")) {
+			return "CN"
+		}
+		return ""
+	})
+	res := staticResolver{
+		"lan.test": {{IP: net.ParseIP("192.168.1.1")}},
+		"cn.test":  {{IP: net.ParseIP("1.2.4.8")}},
+		"ten.test": {{IP: net.ParseIP("10.1.1.1")}},
+	}
+	tests := map[string]string{
+		"exact.test":      "proxyA",
+		"sub.exact.test":  "pool1",
+		"google.com":      "proxyA",
+		"www.google.com":  "proxyA",
+		"notgoogle.com":   "pool1",
+		"myads.example":   "REJECT",
+		"10.2.3.4":        "DIRECT",
+		"ten.test":        "pool1", // no-resolve时不解析域名
+		"lan.test":        "DIRECT",
+		"cn.test":         "DIRECT",
+		"unresolved.test": "pool1",
+	}
+	for host, want := range tests {
+		if got := rt.Match(context.Background(), host, res); got != want {
+			t.Errorf("%s: 匹配%s，应为%s", host, got, want)
+		}
+	}
+
+	// 轮流使用上游组中的代理
+	a, _, _ := rt.route(context.Background(), "other.test", res)
+	b, _, _ := rt.route(context.Background(), "other.test", res)
+	if a.Host == b.Host {
+		t.Errorf("两次都使用了%s", a.Host)
+	}
+}
+
+func TestNewRouter_Invalid(t *testing.T) {
+	tests := []struct {
+		upstreams map[string][]string
+		rules     []string
+	}{
+		{nil, []string{"DOMAIN,a.test,missing"}},
+		{nil, []string{"UNKNOWN,a,DIRECT"}},
+		{nil, []string{"IP-CIDR,bad,DIRECT"}},
+		{nil, []string{"DOMAIN,a.test"}},
+		{nil, []string{"IP-CIDR,10.0.0.0/8,DIRECT,bad-option"}},
+		{map[string][]string{"DIRECT": {"http://a:1"}}, nil},
+		{map[string][]string{"p": {"ftp://a:1"}}, nil},
+		{map[string][]string{"p": nil}, nil},
+	}
+	for _, tt := range tests {
+		if _, err := NewRouter(tt.upstreams, tt.rules); err == nil {
+			t.Errorf("%v %v: 应返回错误", tt.upstreams, tt.rules)
+		}
+	}
+}
+
+func TestGoProxy_SetRouter(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer target.Close()
+	proxySrv, connects := newTestProxy(t)
+	defaultProxy, defaultConnects := newTestProxy(t)
+	rt, err := NewRouter(map[string][]string{"proxyA": {proxySrv.URL}}, []string{
+		"DOMAIN,via.test,proxyA",
+		"DOMAIN,blocked.test,REJECT",
+		"DOMAIN-SUFFIX,direct.test,DIRECT",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := New()
+	c.SetProxy(defaultProxy.URL)
+	c.SetRouter(rt)
+	c.SetHostOverride("*.test", "127.0.0.1")
+	_, port, _ := net.SplitHostPort(target.Listener.Addr().String())
+	get := func(host string) (string, error) {
+		resp, err := c.GetClient().Get("http://" + host + ":" + port)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		buf := make([]byte, 2)
+		n, _ := resp.Body.Read(buf)
+		return string(buf[:n]), nil
+	}
+
+	if got, err := get("via.test"); err != nil || got != "ok" || connects.Load() != 1 {
+		t.Errorf("响应为%q, 错误为%v, 经过上游%d次", got, err, connects.Load())
+	}
+	if got, err := get("www.direct.test"); err != nil || got != "ok" || connects.Load() != 1 || defaultConnects.Load() != 0 {
+		t.Errorf("直连时响应为%q, 错误为%v", got, err)
+	}
+	if _, err := get("other.test"); err != nil || defaultConnects.Load() != 1 {
+		t.Errorf("没有匹配规则时错误为%v, 经过默认代理%d次", err, defaultConnects.Load())
+	}
+	if _, err := get("blocked.test"); !errors.Is(err, ErrRouteRejected) {
+		t.Errorf("拒绝时错误为%v", err)
+	}
+
+	c.SetRouter(nil)
+	if _, err := get("via.test"); err != nil || connects.Load() != 1 {
+		t.Errorf("取消路由后错误为%v, 经过上游%d次", err, connects.Load())
+	}
+	if got := c.Clone().GetRouter(); got != nil {
+		t.Error("克隆的客户端应没有路由")
+	}
+	c.SetRouter(rt)
+	if c.Clone().GetRouter() != rt {
+		t.Error("克隆的客户端应使用同一路由")
+	}
+}
@@ -0,0 +1,260 @@
+package goproxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrStopJob JobHandler返回该错误时定时任务正常结束
+var ErrStopJob = errors.New("停止定时任务")
+
+// JobHandler 处理定时请求的响应，返回后响应体被关闭；返回错误时本次执行视为失败
+type JobHandler func(resp *http.Response) error
+
+// JobOption 定时任务的选项
+type JobOption func(*Job)
+
+// WithJobTimeout 设置单次执行的超时，默认只受客户端超时(SetTimeout)的限制
+func WithJobTimeout(d time.Duration) JobOption {
+	return func(j *Job) {
+		j.timeout = d
+	}
+}
+
+// WithJobBackoff 设置执行失败后的退避策略: 连续失败时在下一次计划时间的基础上再推迟退避时间，
+// Attempts大于0时连续失败超过该次数后停止任务。默认从1分钟退避到1小时，不停止
+func WithJobBackoff(p RetryPolicy) JobOption {
+	return func(j *Job) {
+		j.backoff = p
+	}
+}
+
+// WithJobErrorHandler 设置执行失败时的回调，failures为连续失败的次数
+func WithJobErrorHandler(fn func(err error, failures int)) JobOption {
+	return func(j *Job) {
+		j.onError = fn
+	}
+}
+
+// WithJobRunNow 启动后立即执行一次，而不是等待第一个计划时间
+func WithJobRunNow() JobOption {
+	return func(j *Job) {
+		j.runNow = true
+	}
+}
+
+// JobStats 定时任务的执行统计
+type JobStats struct {
+	Runs     int       // 执行的次数
+	Failures int       // 失败的次数
+	Skipped  int       // 因上一次执行未结束而跳过的次数
+	LastRun  time.Time // 最近一次开始执行的时间
+	LastErr  error     // 最近一次执行的错误，成功时为nil
+	Next     time.Time // 下一次执行的时间，任务结束后为零值
+}
+
+// Job 通过Every、Cron或Schedule启动的定时任务
+type Job struct {
+	client   *GoProxy
+	schedule Schedule
+	req      *http.Request
+	handler  JobHandler
+	timeout  time.Duration
+	backoff  RetryPolicy
+	onError  func(err error, failures int)
+	runNow   bool
+
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error
+
+	mu    sync.Mutex
+	stats JobStats
+}
+
+// Every 每隔interval通过客户端发送一次req，用于心跳和定时轮询。
+// 同一任务不会重叠执行: 执行时间超过间隔时跳过期间错过的计划时间，在之后的第一个计划时间继续；
+// 失败时按WithJobBackoff推迟下一次执行。客户端关闭(Close)后任务自动结束
+// 参数:
+//   - interval: 执行间隔
+//   - req: 请求，每次执行时复制，有请求体时首次读取后缓存
+//   - handler: 处理响应的函数，为nil时丢弃响应
+//   - opts: 选项
+func (r *GoProxy) Every(interval time.Duration, req *http.Request, handler JobHandler, opts ...JobOption) *Job {
+	return r.Schedule(everySchedule(max(interval, time.Millisecond)), req, handler, opts...)
+}
+
+// Cron 按cron表达式定时发送req，表达式的格式见ParseCron，其他行为与Every相同
+func (r *GoProxy) Cron(expr string, req *http.Request, handler JobHandler, opts ...JobOption) (*Job, error) {
+	s, err := ParseCron(expr)
+	if err != nil {
+		return nil, err
+	}
+	return r.Schedule(s, req, handler, opts...), nil
+}
+
+// Schedule 按自定义的时间表定时发送req，其他行为与Every相同
+func (r *GoProxy) Schedule(s Schedule, req *http.Request, handler JobHandler, opts ...JobOption) *Job {
+	j := &Job{
+		client:   r,
+		schedule: s,
+		handler:  handler,
+		backoff:  RetryPolicy{Backoff: time.Minute, MaxBackoff: time.Hour},
+		done:     make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(j)
+	}
+	j.req = req.Clone(req.Context())
+	if err := bufferBody(j.req); err != nil {
+		j.err = fmt.Errorf("读取定时请求的请求体失败: %w", err)
+		j.cancel = func() {}
+		close(j.done)
+		return j
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	j.cancel = cancel
+	go j.loop(ctx)
+	return j
+}
+
+// Stop 停止任务，正在进行的执行被取消，等待其结束后返回。重复调用是安全的，不能在handler中调用
+func (j *Job) Stop() {
+	j.cancel()
+	<-j.done
+}
+
+// Done 返回任务结束时关闭的通道
+func (j *Job) Done() <-chan struct{} {
+	return j.done
+}
+
+// Err 返回使任务结束的错误: 读取请求体失败、客户端已关闭或连续失败超过WithJobBackoff的次数；
+// 任务未结束、通过Stop停止或handler返回ErrStopJob时为nil
+func (j *Job) Err() error {
+	select {
+	case <-j.done:
+		return j.err
+	default:
+		return nil
+	}
+}
+
+// Stats 返回任务的执行统计
+func (j *Job) Stats() JobStats {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.stats
+}
+
+// loop 按时间表执行任务直到ctx结束
+func (j *Job) loop(ctx context.Context) {
+	defer close(j.done)
+	defer j.setNext(time.Time{})
+	next := time.Now()
+	if !j.runNow {
+		next = j.schedule.Next(next)
+	}
+	failures := 0
+	for !next.IsZero() {
+		j.setNext(next)
+		if sleepContext(ctx, time.Until(next)) != nil {
+			return
+		}
+		err := j.run(ctx)
+		end := time.Now()
+		// 执行期间错过的计划时间不再补执行
+		skipped := 0
+		for next = j.schedule.Next(next); !next.IsZero() && next.Before(end); next = j.schedule.Next(next) {
+			skipped++
+		}
+		j.mu.Lock()
+		j.stats.Runs++
+		j.stats.Skipped += skipped
+		j.stats.LastErr = err
+		if err != nil && !errors.Is(err, ErrStopJob) {
+			j.stats.Failures++
+		}
+		j.mu.Unlock()
+
+		switch {
+		case errors.Is(err, ErrStopJob):
+			return
+		case ctx.Err() != nil:
+			return
+		case err == nil:
+			failures = 0
+			continue
+		case errors.Is(err, ErrClosed):
+			j.err = err
+			return
+		}
+		failures++
+		if j.onError != nil {
+			j.onError(err, failures)
+		}
+		if j.backoff.Attempts > 0 && failures > j.backoff.Attempts {
+			j.err = fmt.Errorf("定时任务连续失败%d次: %w", failures, err)
+			return
+		}
+		if !next.IsZero() {
+			next = j.schedule.Next(next.Add(j.backoff.backoff(failures - 1)))
+		}
+	}
+}
+
+// run 执行一次请求
+func (j *Job) run(ctx context.Context) error {
+	j.mu.Lock()
+	j.stats.LastRun = time.Now()
+	j.mu.Unlock()
+	if j.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, j.timeout)
+		defer cancel()
+	}
+	req, err := rewindRequest(j.req)
+	if err != nil {
+		return err
+	}
+	resp, err := j.client.Do(req.Clone(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if j.handler != nil {
+		err = j.handler(resp)
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	return err
+}
+
+// setNext 记录下一次执行的时间
+func (j *Job) setNext(t time.Time) {
+	j.mu.Lock()
+	j.stats.Next = t
+	j.mu.Unlock()
+}
+
+// bufferBody 请求体不能通过GetBody重新获取时读入内存，以便每次执行时重新发送
+func bufferBody(req *http.Request) error {
+	if req.Body == nil || req.Body == http.NoBody || req.GetBody != nil {
+		return nil
+	}
+	data, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return err
+	}
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+	req.Body, _ = req.GetBody()
+	return nil
+}
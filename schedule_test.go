@@ -0,0 +1,121 @@
+package goproxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGoProxy_Every(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != "ping" {
+			t.Errorf("请求体为%q", body)
+		}
+		requests.Add(1)
+	}))
+	defer srv.Close()
+
+	c := New()
+	// 请求体不能通过GetBody重新获取，首次读取后缓存
+	req, _ := http.NewRequest(http.MethodPost, srv.URL, io.NopCloser(strings.NewReader("ping")))
+	var handled atomic.Int32
+	job := c.Every(10*time.Millisecond, req, func(resp *http.Response) error {
+		if handled.Add(1) == 3 {
+			return ErrStopJob
+		}
+		return nil
+	}, WithJobRunNow())
+	select {
+	case <-job.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("任务没有结束")
+	}
+	st := job.Stats()
+	if job.Err() != nil || requests.Load() != 3 || st.Runs != 3 || st.Failures != 0 || !st.Next.IsZero() {
+		t.Errorf("错误为%v，请求了%d次，统计为%+v", job.Err(), requests.Load(), st)
+	}
+}
+
+func TestGoProxy_EveryOverlap(t *testing.T) {
+	var running, overlapped atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if running.Add(1) > 1 {
+			overlapped.Store(1)
+		}
+		time.Sleep(35 * time.Millisecond)
+		running.Add(-1)
+	}))
+	defer srv.Close()
+
+	c := New()
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	job := c.Every(10*time.Millisecond, req, nil)
+	time.Sleep(150 * time.Millisecond)
+	job.Stop()
+	job.Stop()
+	st := job.Stats()
+	if overlapped.Load() != 0 || st.Runs == 0 || st.Skipped < st.Runs {
+		t.Errorf("重叠执行: %v，统计为%+v", overlapped.Load() != 0, st)
+	}
+	if job.Err() != nil {
+		t.Errorf("Stop后的错误为%v", job.Err())
+	}
+}
+
+func TestGoProxy_EveryBackoff(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	c := New()
+	c.SetExpectedStatus(http.StatusOK)
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	var failures []int
+	start := time.Now()
+	job := c.Every(time.Millisecond, req, nil,
+		WithJobBackoff(RetryPolicy{Attempts: 3, Backoff: 40 * time.Millisecond, MaxBackoff: 40 * time.Millisecond}),
+		WithJobErrorHandler(func(err error, n int) { failures = append(failures, n) }))
+	<-job.Done()
+	elapsed := time.Since(start)
+	if !errors.Is(job.Err(), ErrUnexpectedStatus) || requests.Load() != 4 || len(failures) != 4 || job.Stats().Failures != 4 {
+		t.Errorf("错误为%v，请求了%d次，失败回调为%v", job.Err(), requests.Load(), failures)
+	}
+	// 三次退避各至少20ms
+	if elapsed < 60*time.Millisecond {
+		t.Errorf("退避时间过短: %v", elapsed)
+	}
+}
+
+func TestGoProxy_CronClosed(t *testing.T) {
+	c := New()
+	req, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1:1", nil)
+	if _, err := c.Cron("61 * * * *", req, nil); err == nil {
+		t.Error("无效的cron表达式应返回错误")
+	}
+	job, err := c.Cron("@every 5ms", req, nil, WithJobBackoff(RetryPolicy{Backoff: time.Millisecond}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	select {
+	case <-job.Done():
+	case <-ctx.Done():
+		t.Fatal("客户端关闭后任务没有结束")
+	}
+	if !errors.Is(job.Err(), ErrClosed) {
+		t.Errorf("错误为%v", job.Err())
+	}
+}
@@ -0,0 +1,333 @@
+package server
+
+import (
+	"bufio"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fasnow/goproxy"
+)
+
+// maxLeafCerts 最多缓存的站点证书数，超过后清空重新签发
+const maxLeafCerts = 10000
+
+// leafValidity 签发的站点证书的有效期，不超过CA证书的有效期
+const leafValidity = 365 * 24 * time.Hour
+
+// CA 用于HTTPS中间人解密的证书颁发机构，按需为访问的主机签发站点证书。
+// 下游客户端需要信任该CA证书(如导入系统证书存储或通过CertPEM加入信任列表)才能正常访问
+type CA struct {
+	cert    *x509.Certificate
+	key     crypto.Signer
+	leafKey *ecdsa.PrivateKey // 所有站点证书共用的密钥，避免每个主机都生成一次
+
+	mu    sync.Mutex
+	leafs map[string]*tls.Certificate
+}
+
+// NewCA 生成新的自签名CA
+// 参数:
+//   - name: CA证书的名称(CommonName)，为空时使用"goproxy CA"
+//   - validity: 有效期，小于等于0时为10年
+func NewCA(name string, validity time.Duration) (*CA, error) {
+	if name == "" {
+		name = "goproxy CA"
+	}
+	if validity <= 0 {
+		validity = 10 * 365 * 24 * time.Hour
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := randSerial()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: name, Organization: []string{name}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(validity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return newCA(cert, key)
+}
+
+// LoadCA 从PEM格式的证书和私钥加载CA，可复用之前通过CertPEM和KeyPEM保存的CA，避免下游客户端重复导入
+func LoadCA(certPEM, keyPEM []byte) (*CA, error) {
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("加载CA证书失败: %w", err)
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("加载CA证书失败: %w", err)
+	}
+	if !cert.IsCA {
+		return nil, errors.New("加载CA证书失败: 不是CA证书")
+	}
+	key, ok := pair.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("加载CA证书失败: 不支持的私钥类型")
+	}
+	return newCA(cert, key)
+}
+
+// newCA 以证书和私钥创建CA并生成站点证书的密钥
+func newCA(cert *x509.Certificate, key crypto.Signer) (*CA, error) {
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &CA{cert: cert, key: key, leafKey: leafKey, leafs: make(map[string]*tls.Certificate)}, nil
+}
+
+// Certificate 返回CA证书
+func (ca *CA) Certificate() *x509.Certificate {
+	return ca.cert
+}
+
+// CertPEM 返回PEM格式的CA证书，用于导入下游客户端的信任列表
+func (ca *CA) CertPEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw})
+}
+
+// KeyPEM 返回PEM格式(PKCS#8)的CA私钥，应妥善保管
+func (ca *CA) KeyPEM() ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(ca.key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// leaf 返回host的站点证书，缓存中没有或即将过期时重新签发
+func (ca *CA) leaf(host string) (*tls.Certificate, error) {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	if cert, ok := ca.leafs[host]; ok && time.Until(cert.Leaf.NotAfter) > time.Hour {
+		return cert, nil
+	}
+	serial, err := randSerial()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	notAfter := now.Add(leafValidity)
+	if notAfter.After(ca.cert.NotAfter) {
+		notAfter = ca.cert.NotAfter
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: host},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		tmpl.IPAddresses = []net.IP{ip}
+	} else {
+		tmpl.DNSNames = []string{host}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &ca.leafKey.PublicKey, ca.key)
+	if err != nil {
+		return nil, fmt.Errorf("签发%s的证书失败: %w", host, err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	cert := &tls.Certificate{
+		Certificate: [][]byte{der, ca.cert.Raw},
+		PrivateKey:  ca.leafKey,
+		Leaf:        leaf,
+	}
+	if len(ca.leafs) >= maxLeafCerts {
+		ca.leafs = make(map[string]*tls.Certificate)
+	}
+	ca.leafs[host] = cert
+	return cert, nil
+}
+
+// randSerial 生成随机的128位证书序列号
+func randSerial() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
+
+// WithMITM 开启HTTPS中间人解密: CONNECT隧道中的TLS连接由ca签发的证书终止，解密后的请求与普通HTTP请求一样
+// 经由客户端的Transport转发(全局请求头、TLS指纹等生效)，并交给WithRequestHandler和WithResponseHandler处理。
+// 只支持HTTP/1.1，WebSocket等协议升级不会被转发；SOCKS5连接不解密
+// 参数:
+//   - ca: 签发站点证书的CA，见NewCA和LoadCA
+//   - hosts: 需要解密的主机，支持"*.example.com"形式的通配符；为空时解密所有主机，其他主机按普通隧道转发
+func WithMITM(ca *CA, hosts ...string) Option {
+	return func(s *Server) {
+		s.ca = ca
+		s.mitmHosts = hosts
+	}
+}
+
+// RequestHandler 处理转发前的请求，可修改或替换请求；返回的响应不为nil时直接以该响应回复，不再转发
+type RequestHandler func(req *http.Request) (*http.Request, *http.Response)
+
+// ResponseHandler 处理转发后的响应，可修改或替换响应，resp.Request为转发的请求
+type ResponseHandler func(resp *http.Response) *http.Response
+
+// WithRequestHandler 添加请求处理函数，多个处理函数按添加顺序调用，
+// 作用于普通HTTP请求和WithMITM解密后的HTTPS请求
+func WithRequestHandler(fn RequestHandler) Option {
+	return func(s *Server) {
+		s.reqHandlers = append(s.reqHandlers, fn)
+	}
+}
+
+// WithResponseHandler 添加响应处理函数，多个处理函数按添加顺序调用，
+// 作用于普通HTTP请求和WithMITM解密后的HTTPS请求，不包括RequestHandler直接返回的响应
+func WithResponseHandler(fn ResponseHandler) Option {
+	return func(s *Server) {
+		s.respHandlers = append(s.respHandlers, fn)
+	}
+}
+
+// WithRewriter 按goproxy.Rewriter的规则改写请求和响应，与依次添加rw.HandleRequest和rw.HandleResponse相同
+func WithRewriter(rw *goproxy.Rewriter) Option {
+	return func(s *Server) {
+		s.reqHandlers = append(s.reqHandlers, rw.HandleRequest)
+		s.respHandlers = append(s.respHandlers, rw.HandleResponse)
+	}
+}
+
+// shouldMITM 判断是否解密到host的CONNECT隧道
+func (s *Server) shouldMITM(host string) bool {
+	if s.ca == nil {
+		return false
+	}
+	if len(s.mitmHosts) == 0 {
+		return true
+	}
+	for _, pattern := range s.mitmHosts {
+		if matchHost(pattern, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchHost 判断host是否匹配pattern，"*.example.com"匹配所有子域名但不匹配example.com本身
+func matchHost(pattern, host string) bool {
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		return strings.HasSuffix(host, "."+suffix)
+	}
+	return strings.EqualFold(pattern, host)
+}
+
+// serveMITM 以CA签发的证书终止conn上的TLS连接，并将其中的请求转发到target(host:port)
+func (s *Server) serveMITM(conn net.Conn, br *bufio.Reader, target string, client *goproxy.GoProxy) {
+	host, _, err := net.SplitHostPort(target)
+	if err != nil {
+		host = target
+	}
+	tlsConn := tls.Server(&bufferedConn{Conn: conn, r: br}, &tls.Config{
+		NextProtos: []string{"http/1.1"},
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			name := hello.ServerName
+			if name == "" {
+				name = host
+			}
+			return s.ca.leaf(name)
+		},
+	})
+	srv := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.URL.Scheme = "https"
+			r.URL.Host = target
+			s.handleHTTP(w, r, client)
+		}),
+		ReadHeaderTimeout: 30 * time.Second,
+	}
+	var decrypted net.Conn = tlsConn
+	if s.pcap != nil {
+		decrypted = s.pcap.wrap(tlsConn, target)
+	}
+	srv.Serve(newSingleConnListener(decrypted))
+}
+
+// bufferedConn 先读取劫持连接时已缓冲的数据的连接
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// singleConnListener 只返回一个连接的net.Listener，连接关闭后Accept返回错误
+type singleConnListener struct {
+	conn chan net.Conn
+	done chan struct{}
+	addr net.Addr
+}
+
+func newSingleConnListener(conn net.Conn) *singleConnListener {
+	l := &singleConnListener{conn: make(chan net.Conn, 1), done: make(chan struct{}), addr: conn.LocalAddr()}
+	l.conn <- &notifyCloseConn{Conn: conn, done: l.done}
+	return l
+}
+
+func (l *singleConnListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conn:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *singleConnListener) Close() error {
+	return nil
+}
+
+func (l *singleConnListener) Addr() net.Addr {
+	return l.addr
+}
+
+// notifyCloseConn 关闭时通知singleConnListener的连接
+type notifyCloseConn struct {
+	net.Conn
+	once sync.Once
+	done chan struct{}
+}
+
+func (c *notifyCloseConn) Close() error {
+	c.once.Do(func() { close(c.done) })
+	return c.Conn.Close()
+}
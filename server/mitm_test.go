@@ -0,0 +1,197 @@
+package server
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/fasnow/goproxy"
+)
+
+func TestServer_MITM(t *testing.T) {
+	target := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Header.Get("X-Client")+" "+r.Header.Get("X-Inspected"))
+	}))
+	defer target.Close()
+	ca, err := NewCA("", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := goproxy.New()
+	client.SetTLSVerify(false)
+	client.SetGlobalHeader("X-Client", "goproxy")
+	var seen []string
+	_, proxyURL := newTestServer(t, client,
+		WithMITM(ca),
+		WithRequestHandler(func(req *http.Request) (*http.Request, *http.Response) {
+			if req.URL.Path == "/blocked" {
+				return req, &http.Response{StatusCode: http.StatusForbidden, Header: http.Header{}, Request: req}
+			}
+			req.Header.Set("X-Inspected", "1")
+			return req, nil
+		}),
+		WithResponseHandler(func(resp *http.Response) *http.Response {
+			seen = append(seen, resp.Request.URL.String())
+			resp.Header.Set("X-Modified", "1")
+			return resp
+		}),
+	)
+
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(ca.CertPEM())
+	hc := &http.Client{Transport: &http.Transport{
+		Proxy:           http.ProxyURL(proxyURL),
+		TLSClientConfig: &tls.Config{RootCAs: pool},
+	}}
+	resp, err := hc.Get(target.URL + "/path")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "goproxy 1" || resp.Header.Get("X-Modified") != "1" {
+		t.Errorf("响应为%q, 响应头为%v", body, resp.Header)
+	}
+	if len(seen) != 1 || seen[0] != target.URL+"/path" {
+		t.Errorf("响应处理函数收到的请求为%v", seen)
+	}
+	// 请求处理函数直接返回响应
+	resp, err = hc.Get(target.URL + "/blocked")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden || len(seen) != 1 {
+		t.Errorf("状态码为%d, 响应处理函数调用了%d次", resp.StatusCode, len(seen))
+	}
+}
+
+func TestLoadCA(t *testing.T) {
+	ca, err := NewCA("test CA", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM, err := ca.KeyPEM()
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadCA(ca.CertPEM(), keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(loaded.Certificate().Raw, ca.Certificate().Raw) {
+		t.Error("加载的CA证书不同")
+	}
+	// 加载的CA签发的证书可由原CA证书校验
+	leaf, err := loaded.leaf("example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Certificate())
+	if _, err := leaf.Leaf.Verify(x509.VerifyOptions{DNSName: "example.com", Roots: pool}); err != nil {
+		t.Error(err)
+	}
+	if cached, _ := loaded.leaf("example.com"); cached != leaf {
+		t.Error("站点证书未被缓存")
+	}
+	if _, err := LoadCA(ca.CertPEM(), []byte("invalid")); err == nil || !strings.Contains(err.Error(), "加载CA证书失败") {
+		t.Errorf("错误为%v", err)
+	}
+}
+
+func TestServer_ShouldMITM(t *testing.T) {
+	ca, err := NewCA("", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := New(goproxy.New(), WithMITM(ca, "*.example.com", "api.test"))
+	for host, want := range map[string]bool{
+		"www.example.com": true,
+		"example.com":     false,
+		"api.test":        true,
+		"other.test":      false,
+	} {
+		if got := s.shouldMITM(host); got != want {
+			t.Errorf("%s: %v", host, got)
+		}
+	}
+	if New(goproxy.New()).shouldMITM("api.test") {
+		t.Error("未开启WithMITM时不应解密")
+	}
+}
+
+// syncBuffer 可并发写入的bytes.Buffer
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return bytes.Clone(b.buf.Bytes())
+}
+
+func TestServer_Pcap(t *testing.T) {
+	target := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "secret-response")
+	}))
+	defer target.Close()
+	ca, err := NewCA("", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out syncBuffer
+	pw, err := NewPcapWriter(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := goproxy.New()
+	client.SetTLSVerify(false)
+	_, proxyURL := newTestServer(t, client, WithMITM(ca), WithPcap(pw))
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(ca.CertPEM())
+	hc := &http.Client{Transport: &http.Transport{
+		Proxy:           http.ProxyURL(proxyURL),
+		TLSClientConfig: &tls.Config{RootCAs: pool},
+	}}
+	resp, err := hc.Get(target.URL + "/captured")
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	data := out.Bytes()
+	if binary.LittleEndian.Uint32(data) != pcapMagic || binary.LittleEndian.Uint32(data[20:]) != pcapLinkRaw {
+		t.Fatalf("文件头为%x", data[:24])
+	}
+	if !bytes.Contains(data, []byte("GET /captured HTTP/1.1")) || !bytes.Contains(data, []byte("secret-response")) {
+		t.Error("没有记录明文请求和响应")
+	}
+	// 第一个包为客户端发往目标端口的IPv4包
+	pkt := data[24+16:]
+	_, port, _ := net.SplitHostPort(target.Listener.Addr().String())
+	if pkt[0] != 0x45 || ipChecksum(pkt[:20]) != 0 || strconv.Itoa(int(binary.BigEndian.Uint16(pkt[22:]))) != port {
+		t.Errorf("数据包为%x", pkt[:40])
+	}
+	if pw.Err() != nil {
+		t.Error(pw.Err())
+	}
+}
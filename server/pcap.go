@@ -0,0 +1,197 @@
+package server
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// pcap文件格式常量，数据包为不带链路层的原始IP包(LINKTYPE_RAW)
+const (
+	pcapMagic      = 0xa1b2c3d4
+	pcapLinkRaw    = 101
+	pcapSnapLen    = 65535
+	pcapMaxPayload = 65000 // 单个数据包的最大载荷，保证IPv4总长度不超过65535
+)
+
+// PcapWriter 以pcap格式记录WithMITM解密后的明文流量，可用Wireshark等工具分析。
+// 每个解密的连接记为一条从下游客户端到目标端口的TCP流，数据包由明文合成(没有握手包，TCP校验和为0)，
+// IP地址为下游客户端和本地代理的地址
+type PcapWriter struct {
+	mu  sync.Mutex
+	w   io.Writer
+	err error
+}
+
+// NewPcapWriter 写入pcap文件头并创建记录器，w由调用方负责关闭
+func NewPcapWriter(w io.Writer) (*PcapWriter, error) {
+	var hdr [24]byte
+	binary.LittleEndian.PutUint32(hdr[0:], pcapMagic)
+	binary.LittleEndian.PutUint16(hdr[4:], 2)
+	binary.LittleEndian.PutUint16(hdr[6:], 4)
+	binary.LittleEndian.PutUint32(hdr[16:], pcapSnapLen)
+	binary.LittleEndian.PutUint32(hdr[20:], pcapLinkRaw)
+	if _, err := w.Write(hdr[:]); err != nil {
+		return nil, err
+	}
+	return &PcapWriter{w: w}, nil
+}
+
+// WithPcap 将WithMITM解密后的明文流量写入pw
+func WithPcap(pw *PcapWriter) Option {
+	return func(s *Server) {
+		s.pcap = pw
+	}
+}
+
+// Err 返回写入时遇到的第一个错误，出错后不再写入
+func (pw *PcapWriter) Err() error {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	return pw.err
+}
+
+// wrap 包装解密后的连接conn，读取的数据记为客户端发出的包，写入的数据记为服务器发出的包
+// 参数:
+//   - conn: 与下游客户端之间的TLS连接
+//   - target: 目标地址(host:port)，其端口作为服务器端口
+func (pw *PcapWriter) wrap(conn net.Conn, target string) net.Conn {
+	client := tcpEndpoint(conn.RemoteAddr())
+	server := tcpEndpoint(conn.LocalAddr())
+	if _, port, err := net.SplitHostPort(target); err == nil {
+		if p, err := strconv.Atoi(port); err == nil {
+			server.port = uint16(p)
+		}
+	}
+	if client.ip.To4() == nil || server.ip.To4() == nil {
+		// 地址族不同时都使用IPv6
+		client.ip, server.ip = client.ip.To16(), server.ip.To16()
+	} else {
+		client.ip, server.ip = client.ip.To4(), server.ip.To4()
+	}
+	return &pcapConn{Conn: conn, pw: pw, client: client, server: server, clientSeq: 1, serverSeq: 1}
+}
+
+// endpoint TCP流的一端
+type endpoint struct {
+	ip   net.IP
+	port uint16
+}
+
+// tcpEndpoint 从地址取出IP和端口，不是TCP地址时为0.0.0.0:0
+func tcpEndpoint(addr net.Addr) endpoint {
+	if a, ok := addr.(*net.TCPAddr); ok && a.IP != nil {
+		return endpoint{ip: a.IP, port: uint16(a.Port)}
+	}
+	return endpoint{ip: net.IPv4zero}
+}
+
+// pcapConn 将收发的数据写入PcapWriter的连接
+type pcapConn struct {
+	net.Conn
+	pw     *PcapWriter
+	client endpoint
+	server endpoint
+
+	mu                   sync.Mutex // 保护序列号
+	clientSeq, serverSeq uint32
+}
+
+func (c *pcapConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.record(true, p[:n])
+	}
+	return n, err
+}
+
+func (c *pcapConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	if n > 0 {
+		c.record(false, p[:n])
+	}
+	return n, err
+}
+
+// record 将data按方向拆分为数据包写入
+func (c *pcapConn) record(fromClient bool, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(data) > 0 {
+		chunk := data[:min(len(data), pcapMaxPayload)]
+		data = data[len(chunk):]
+		if fromClient {
+			c.pw.writePacket(c.client, c.server, c.clientSeq, c.serverSeq, chunk)
+			c.clientSeq += uint32(len(chunk))
+		} else {
+			c.pw.writePacket(c.server, c.client, c.serverSeq, c.clientSeq, chunk)
+			c.serverSeq += uint32(len(chunk))
+		}
+	}
+}
+
+// writePacket 合成一个带有PSH和ACK标志的TCP数据包并写入
+func (pw *PcapWriter) writePacket(src, dst endpoint, seq, ack uint32, payload []byte) {
+	tcp := make([]byte, 20, 20+len(payload))
+	binary.BigEndian.PutUint16(tcp[0:], src.port)
+	binary.BigEndian.PutUint16(tcp[2:], dst.port)
+	binary.BigEndian.PutUint32(tcp[4:], seq)
+	binary.BigEndian.PutUint32(tcp[8:], ack)
+	tcp[12] = 5 << 4      // 首部长度20字节
+	tcp[13] = 0x08 | 0x10 // PSH | ACK
+	binary.BigEndian.PutUint16(tcp[14:], 65535)
+	tcp = append(tcp, payload...)
+
+	var ip []byte
+	if len(src.ip) == net.IPv4len {
+		ip = make([]byte, 20, 20+len(tcp))
+		ip[0] = 0x45
+		binary.BigEndian.PutUint16(ip[2:], uint16(20+len(tcp)))
+		binary.BigEndian.PutUint16(ip[6:], 0x4000) // 不分片
+		ip[8] = 64
+		ip[9] = 6 // TCP
+		copy(ip[12:], src.ip)
+		copy(ip[16:], dst.ip)
+		binary.BigEndian.PutUint16(ip[10:], ipChecksum(ip))
+	} else {
+		ip = make([]byte, 40, 40+len(tcp))
+		ip[0] = 0x60
+		binary.BigEndian.PutUint16(ip[4:], uint16(len(tcp)))
+		ip[6] = 6 // TCP
+		ip[7] = 64
+		copy(ip[8:], src.ip)
+		copy(ip[24:], dst.ip)
+	}
+	ip = append(ip, tcp...)
+
+	now := time.Now()
+	var rec [16]byte
+	binary.LittleEndian.PutUint32(rec[0:], uint32(now.Unix()))
+	binary.LittleEndian.PutUint32(rec[4:], uint32(now.Nanosecond()/1000))
+	binary.LittleEndian.PutUint32(rec[8:], uint32(len(ip)))
+	binary.LittleEndian.PutUint32(rec[12:], uint32(len(ip)))
+
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	if pw.err != nil {
+		return
+	}
+	if _, pw.err = pw.w.Write(rec[:]); pw.err == nil {
+		_, pw.err = pw.w.Write(ip)
+	}
+}
+
+// ipChecksum 计算IPv4首部校验和，校验和字段需为0
+func ipChecksum(hdr []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(hdr); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(hdr[i:]))
+	}
+	for sum > 0xffff {
+		sum = sum>>16 + sum&0xffff
+	}
+	return ^uint16(sum)
+}
@@ -0,0 +1,214 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/fasnow/goproxy"
+)
+
+// Route 反向代理的一条路由规则
+type Route struct {
+	Host            string      // 匹配的Host(不含端口)，支持"*.example.com"形式的通配符，为空时匹配所有主机
+	PathPrefix      string      // 匹配的路径前缀，为空时匹配所有路径
+	Backends        []string    // 后端地址，如"http://10.0.0.1:8080/api"，多个时轮流使用，重试时换下一个
+	StripPrefix     bool        // 转发前删除路径中的PathPrefix
+	PreserveHost    bool        // 转发时保留原请求的Host，默认使用后端的Host
+	SetHeaders      http.Header // 转发前设置的请求头
+	RemoveHeaders   []string    // 转发前删除的请求头
+	ResponseHeaders http.Header // 返回前设置的响应头
+}
+
+// route 解析后的路由规则
+type route struct {
+	Route
+	backends []*url.URL
+	next     atomic.Uint32
+}
+
+// ReverseProxy 反向代理，实现http.Handler，将请求按路由转发到后端，
+// 转发经由GoProxy客户端的Transport，上游代理、全局请求头、TLS设置等都生效
+type ReverseProxy struct {
+	client  *goproxy.GoProxy
+	retries int
+
+	mu     sync.RWMutex
+	routes []*route
+}
+
+// ReverseOption 反向代理的选项
+type ReverseOption func(*ReverseProxy)
+
+// WithRetries 设置转发失败时的重试次数，默认不重试。
+// 只重试没有请求体的请求，是否重试由goproxy.ClassifyRetry判断，重试时使用同一路由的下一个后端
+func WithRetries(n int) ReverseOption {
+	return func(p *ReverseProxy) {
+		p.retries = max(n, 0)
+	}
+}
+
+// NewReverseProxy 创建反向代理，通过AddRoute添加路由
+// 参数:
+//   - client: 转发请求使用的客户端
+//   - opts: 选项
+func NewReverseProxy(client *goproxy.GoProxy, opts ...ReverseOption) *ReverseProxy {
+	p := &ReverseProxy{client: client}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// AddRoute 添加路由，请求按添加顺序匹配第一条路由
+func (p *ReverseProxy) AddRoute(rt Route) error {
+	if len(rt.Backends) == 0 {
+		return errors.New("路由没有后端")
+	}
+	r := &route{Route: rt}
+	for _, backend := range rt.Backends {
+		u, err := url.Parse(backend)
+		if err != nil {
+			return fmt.Errorf("后端地址%s无效: %w", backend, err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+			return fmt.Errorf("后端地址%s无效: 需要http或https的绝对地址", backend)
+		}
+		r.backends = append(r.backends, u)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.routes = append(p.routes, r)
+	return nil
+}
+
+// match 返回匹配请求的路由，没有匹配时返回nil
+func (p *ReverseProxy) match(req *http.Request) *route {
+	host := req.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	for _, r := range p.routes {
+		if r.Host != "" && !matchHost(r.Host, host) {
+			continue
+		}
+		if !strings.HasPrefix(req.URL.Path, r.PathPrefix) {
+			continue
+		}
+		return r
+	}
+	return nil
+}
+
+// ServeHTTP 实现http.Handler，没有匹配的路由时返回404，后端不可达时返回502，超时返回504
+func (p *ReverseProxy) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	rt := p.match(req)
+	if rt == nil {
+		http.NotFound(w, req)
+		return
+	}
+	attempts := 1
+	if req.ContentLength == 0 {
+		attempts += p.retries
+	}
+	var resp *http.Response
+	var err error
+	for i := 0; i < attempts; i++ {
+		if resp != nil {
+			resp.Body.Close()
+		}
+		backend := rt.backends[int(rt.next.Add(1)-1)%len(rt.backends)]
+		resp, err = p.client.GetClient().Transport.RoundTrip(rt.outgoing(req, backend))
+		if goproxy.ClassifyRetry(resp, err) == goproxy.RetryNever || req.Context().Err() != nil {
+			break
+		}
+	}
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	defer resp.Body.Close()
+	removeHopHeaders(resp.Header)
+	for key, values := range resp.Header {
+		w.Header()[key] = values
+	}
+	for key, values := range rt.ResponseHeaders {
+		w.Header()[http.CanonicalHeaderKey(key)] = slices.Clone(values)
+	}
+	w.WriteHeader(resp.StatusCode)
+	if resp.ContentLength == -1 {
+		copyFlush(w, resp.Body)
+		return
+	}
+	io.Copy(w, resp.Body)
+}
+
+// outgoing 按路由规则构造转发到backend的请求
+func (r *route) outgoing(req *http.Request, backend *url.URL) *http.Request {
+	out := req.Clone(req.Context())
+	out.RequestURI = ""
+	if req.ContentLength == 0 {
+		out.Body = nil
+	}
+	path := req.URL.Path
+	if r.StripPrefix {
+		path = strings.TrimPrefix(path, r.PathPrefix)
+	}
+	out.URL = &url.URL{
+		Scheme:   backend.Scheme,
+		Host:     backend.Host,
+		Path:     joinPath(backend.Path, path),
+		RawQuery: req.URL.RawQuery,
+	}
+	if !r.PreserveHost {
+		out.Host = ""
+	}
+
+	removeHopHeaders(out.Header)
+	clientIP, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err == nil {
+		if prior := out.Header.Get("X-Forwarded-For"); prior != "" {
+			clientIP = prior + ", " + clientIP
+		}
+		out.Header.Set("X-Forwarded-For", clientIP)
+	}
+	out.Header.Set("X-Forwarded-Host", req.Host)
+	proto := "http"
+	if req.TLS != nil {
+		proto = "https"
+	}
+	out.Header.Set("X-Forwarded-Proto", proto)
+	for _, key := range r.RemoveHeaders {
+		out.Header.Del(key)
+	}
+	for key, values := range r.SetHeaders {
+		out.Header[http.CanonicalHeaderKey(key)] = slices.Clone(values)
+	}
+	return out
+}
+
+// joinPath 拼接后端路径和请求路径，保证中间只有一个"/"
+func joinPath(base, path string) string {
+	if base == "" {
+		if path == "" {
+			return "/"
+		}
+		return path
+	}
+	switch {
+	case strings.HasSuffix(base, "/") && strings.HasPrefix(path, "/"):
+		return base + path[1:]
+	case !strings.HasSuffix(base, "/") && !strings.HasPrefix(path, "/") && path != "":
+		return base + "/" + path
+	}
+	return base + path
+}
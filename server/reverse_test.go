@@ -0,0 +1,110 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/fasnow/goproxy"
+)
+
+func TestReverseProxy(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s %s %s %s %q", r.Host, r.URL.RequestURI(), r.Header.Get("X-Route"), r.Header.Get("X-Client"), r.Header.Get("X-Secret"))
+	}))
+	defer backend.Close()
+	client := goproxy.New()
+	client.SetGlobalHeader("X-Client", "goproxy")
+	p := NewReverseProxy(client)
+	if err := p.AddRoute(Route{
+		PathPrefix:      "/api/",
+		Backends:        []string{backend.URL + "/v1"},
+		StripPrefix:     true,
+		SetHeaders:      http.Header{"X-Route": {"api"}},
+		RemoveHeaders:   []string{"X-Secret"},
+		ResponseHeaders: http.Header{"X-Gateway": {"1"}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.AddRoute(Route{Host: "*.example.com", Backends: []string{backend.URL}, PreserveHost: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.AddRoute(Route{Backends: []string{"/relative"}}); err == nil {
+		t.Error("相对地址的后端应返回错误")
+	}
+
+	serve := func(host, target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Host = host
+		req.Header.Set("X-Secret", "s")
+		rec := httptest.NewRecorder()
+		p.ServeHTTP(rec, req)
+		return rec
+	}
+	backendHost := backend.Listener.Addr().String()
+	rec := serve("gateway.local", "/api/users?id=1")
+	if want := backendHost + ` /v1/users?id=1 api goproxy ""`; rec.Body.String() != want || rec.Header().Get("X-Gateway") != "1" {
+		t.Errorf("响应为%q, 响应头为%v", rec.Body.String(), rec.Header())
+	}
+	rec = serve("www.example.com", "/index")
+	if want := `www.example.com /index  goproxy "s"`; rec.Body.String() != want {
+		t.Errorf("按主机路由的响应为%q", rec.Body.String())
+	}
+	if rec = serve("other.test", "/index"); rec.Code != http.StatusNotFound {
+		t.Errorf("没有匹配的路由时状态码为%d", rec.Code)
+	}
+}
+
+func TestReverseProxy_Retry(t *testing.T) {
+	var failed atomic.Int32
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		failed.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer bad.Close()
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer good.Close()
+
+	p := NewReverseProxy(goproxy.New(), WithRetries(1))
+	p.AddRoute(Route{Backends: []string{bad.URL, good.URL}})
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		p.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		if rec.Code != http.StatusOK || rec.Body.String() != "ok" {
+			t.Errorf("第%d次请求状态码为%d", i+1, rec.Code)
+		}
+	}
+	// 轮流使用后端，每次请求都先请求失败的后端再重试
+	if failed.Load() != 2 {
+		t.Errorf("失败的后端被请求了%d次", failed.Load())
+	}
+
+	// 不重试时返回后端的响应
+	p = NewReverseProxy(goproxy.New())
+	p.AddRoute(Route{Backends: []string{bad.URL}})
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("状态码为%d", rec.Code)
+	}
+}
+
+func TestJoinPath(t *testing.T) {
+	for _, tt := range []struct{ base, path, want string }{
+		{"", "", "/"},
+		{"", "/a", "/a"},
+		{"/v1", "/a", "/v1/a"},
+		{"/v1/", "/a", "/v1/a"},
+		{"/v1", "a", "/v1/a"},
+		{"/v1", "", "/v1"},
+	} {
+		if got := joinPath(tt.base, tt.path); got != tt.want {
+			t.Errorf("joinPath(%q, %q) = %q", tt.base, tt.path, got)
+		}
+	}
+}
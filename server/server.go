@@ -0,0 +1,385 @@
+// Package server 提供本地HTTP和SOCKS5代理服务器，出站流量经由GoProxy客户端的配置发送，
+// 使浏览器、curl等非Go程序也能使用同一套上游代理、全局请求头和TLS设置
+//   - 普通HTTP请求: 由客户端的Transport转发，全局请求头、按主机设置的请求头、TLS指纹等都生效
+//   - CONNECT请求和SOCKS5连接: 通过客户端的上游代理建立到目标的TCP隧道后原样转发，TLS由浏览器与目标直接握手，
+//     请求头和TLS设置不生效
+//   - WithMITM: 解密CONNECT隧道中的HTTPS请求后按普通HTTP请求转发，可通过WithRequestHandler和WithResponseHandler检查或修改
+//
+// ReverseProxy 为反向代理，按主机和路径将请求转发到后端，可作为出站网关使用
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fasnow/goproxy"
+)
+
+// Server 本地HTTP代理服务器，实现http.Handler
+type Server struct {
+	client   *goproxy.GoProxy
+	user     string
+	password string
+	selector Selector
+
+	ca           *CA
+	mitmHosts    []string
+	reqHandlers  []RequestHandler
+	respHandlers []ResponseHandler
+	pcap         *PcapWriter
+
+	mu        sync.Mutex
+	srv       *http.Server
+	closed    bool
+	listeners map[net.Listener]struct{} // SOCKS5监听
+	tunnels   map[net.Conn]struct{}     // 正在转发的CONNECT隧道和SOCKS5连接，Close时一并关闭
+}
+
+// Option 代理服务器的选项
+type Option func(*Server)
+
+// WithAuth 要求客户端进行用户名密码认证，HTTP代理使用Proxy-Authorization的Basic认证，SOCKS5使用RFC 1929认证
+func WithAuth(user, password string) Option {
+	return func(s *Server) {
+		s.user, s.password = user, password
+	}
+}
+
+// Selector 为每个连接选择转发使用的客户端，返回nil时使用New传入的客户端
+// 参数:
+//   - ctx: 连接或请求的上下文
+//   - addr: 目标地址(host:port)
+//   - user: 客户端认证使用的用户名，未提供时为空；未设置WithAuth时不校验密码，可借助用户名传递选择参数
+type Selector func(ctx context.Context, addr, user string) *goproxy.GoProxy
+
+// WithSelector 按连接选择上游，如按用户名或目标地址使用不同代理的客户端
+func WithSelector(fn Selector) Option {
+	return func(s *Server) {
+		s.selector = fn
+	}
+}
+
+// New 创建代理服务器
+// 参数:
+//   - client: 转发请求使用的客户端，其后的配置修改对之后的请求立即生效
+//   - opts: 选项
+func New(client *goproxy.GoProxy, opts ...Option) *Server {
+	s := &Server{client: client, listeners: make(map[net.Listener]struct{}), tunnels: make(map[net.Conn]struct{})}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// ListenAndServe 在addr上监听并处理代理请求，直到Close或Shutdown
+func (s *Server) ListenAndServe(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ln)
+}
+
+// Serve 在ln上处理代理请求，直到Close或Shutdown，返回http.ErrServerClosed
+func (s *Server) Serve(ln net.Listener) error {
+	s.mu.Lock()
+	if s.srv == nil {
+		s.srv = &http.Server{Handler: s, ReadHeaderTimeout: 30 * time.Second}
+	}
+	srv := s.srv
+	s.mu.Unlock()
+	return srv.Serve(ln)
+}
+
+// Shutdown 停止接受新连接并等待正在处理的普通请求完成，CONNECT隧道和SOCKS5连接直接关闭
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.closeAll()
+	s.mu.Lock()
+	srv := s.srv
+	s.mu.Unlock()
+	if srv == nil {
+		return nil
+	}
+	return srv.Shutdown(ctx)
+}
+
+// Close 立即关闭监听和所有连接，包括CONNECT隧道和SOCKS5连接
+func (s *Server) Close() error {
+	s.closeAll()
+	s.mu.Lock()
+	srv := s.srv
+	s.mu.Unlock()
+	if srv == nil {
+		return nil
+	}
+	return srv.Close()
+}
+
+// closeAll 关闭SOCKS5监听和所有隧道，之后建立的隧道直接关闭
+func (s *Server) closeAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for ln := range s.listeners {
+		ln.Close()
+	}
+	clear(s.listeners)
+	for conn := range s.tunnels {
+		conn.Close()
+	}
+	clear(s.tunnels)
+}
+
+// clientFor 返回转发到addr使用的客户端
+func (s *Server) clientFor(ctx context.Context, addr, user string) *goproxy.GoProxy {
+	if s.selector != nil {
+		if c := s.selector(ctx, addr, user); c != nil {
+			return c
+		}
+	}
+	return s.client
+}
+
+// ServeHTTP 实现http.Handler，处理CONNECT请求和绝对路径形式的HTTP请求
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	user, password, _ := proxyAuth(r)
+	if !s.authorized(user, password) {
+		w.Header().Set("Proxy-Authenticate", `Basic realm="goproxy"`)
+		http.Error(w, "需要代理认证", http.StatusProxyAuthRequired)
+		return
+	}
+	if r.Method == http.MethodConnect {
+		s.handleConnect(w, r, s.clientFor(r.Context(), r.Host, user))
+		return
+	}
+	if !r.URL.IsAbs() {
+		http.Error(w, "不是代理请求", http.StatusBadRequest)
+		return
+	}
+	s.handleHTTP(w, r, s.clientFor(r.Context(), r.URL.Host, user))
+}
+
+// proxyAuth 解析Proxy-Authorization中的Basic认证信息
+func proxyAuth(r *http.Request) (user, password string, ok bool) {
+	scheme, encoded, ok := strings.Cut(r.Header.Get("Proxy-Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Basic") {
+		return "", "", false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", "", false
+	}
+	return strings.Cut(string(decoded), ":")
+}
+
+// authorized 校验用户名和密码，未设置WithAuth时总是通过
+func (s *Server) authorized(user, password string) bool {
+	if s.user == "" && s.password == "" {
+		return true
+	}
+	return subtle.ConstantTimeCompare([]byte(user), []byte(s.user)) == 1 &&
+		subtle.ConstantTimeCompare([]byte(password), []byte(s.password)) == 1
+}
+
+// handleHTTP 通过client的Transport转发普通HTTP请求，不跟随重定向，由下游客户端自行处理
+func (s *Server) handleHTTP(w http.ResponseWriter, r *http.Request, client *goproxy.GoProxy) {
+	out := r.Clone(r.Context())
+	out.RequestURI = ""
+	if r.ContentLength == 0 {
+		out.Body = nil
+	}
+	removeHopHeaders(out.Header)
+	resp, err := s.roundTrip(out, client)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	defer resp.Body.Close()
+	removeHopHeaders(resp.Header)
+	for key, values := range resp.Header {
+		w.Header()[key] = values
+	}
+	w.WriteHeader(resp.StatusCode)
+	if resp.ContentLength == -1 {
+		// 长度未知的响应可能是流式的(如SSE)，每次写入后立即发送
+		copyFlush(w, resp.Body)
+		return
+	}
+	io.Copy(w, resp.Body)
+}
+
+// roundTrip 依次调用请求处理函数后通过client的Transport转发，再依次调用响应处理函数
+func (s *Server) roundTrip(req *http.Request, client *goproxy.GoProxy) (*http.Response, error) {
+	for _, fn := range s.reqHandlers {
+		var resp *http.Response
+		if req, resp = fn(req); resp != nil {
+			if resp.Body == nil {
+				resp.Body = http.NoBody
+			}
+			return resp, nil
+		}
+	}
+	resp, err := client.GetClient().Transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Request == nil {
+		resp.Request = req
+	}
+	for _, fn := range s.respHandlers {
+		resp = fn(resp)
+	}
+	return resp, nil
+}
+
+// handleConnect 通过client的上游代理建立到目标的隧道并双向转发，开启WithMITM时解密隧道中的HTTPS请求
+func (s *Server) handleConnect(w http.ResponseWriter, r *http.Request, client *goproxy.GoProxy) {
+	if s.shouldMITM(r.URL.Hostname()) {
+		// 解密时由Transport为每个请求建立连接，不需要预先建立隧道
+		conn, br, ok := hijackTunnel(w)
+		if !ok || !s.track(conn) {
+			return
+		}
+		go func() {
+			defer s.untrack(conn)
+			s.serveMITM(conn, br, r.Host, client)
+		}()
+		return
+	}
+	upstream, err := client.DialContext(r.Context(), "tcp", r.Host)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+	conn, br, ok := hijackTunnel(w)
+	if !ok {
+		upstream.Close()
+		return
+	}
+	if !s.track(conn, upstream) {
+		return
+	}
+	go s.relay(conn, br, upstream)
+}
+
+// hijackTunnel 接管CONNECT请求的连接并回复隧道已建立，返回连接和其中已缓冲的数据
+func hijackTunnel(w http.ResponseWriter) (net.Conn, *bufio.Reader, bool) {
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "不支持CONNECT", http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	conn, buf, err := hj.Hijack()
+	if err != nil {
+		return nil, nil, false
+	}
+	if _, err := io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n"); err != nil {
+		conn.Close()
+		return nil, nil, false
+	}
+	return conn, buf.Reader, true
+}
+
+// track 记录隧道的两端，服务器已关闭时关闭连接并返回false
+func (s *Server) track(conns ...net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		for _, c := range conns {
+			c.Close()
+		}
+		return false
+	}
+	for _, c := range conns {
+		s.tunnels[c] = struct{}{}
+	}
+	return true
+}
+
+// untrack 关闭并删除隧道的连接
+func (s *Server) untrack(conns ...net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range conns {
+		c.Close()
+		delete(s.tunnels, c)
+	}
+}
+
+// relay 在下游连接和上游连接之间双向复制数据，任一方向结束后关闭两端
+// br为劫持连接时已缓冲的数据
+func (s *Server) relay(conn net.Conn, br *bufio.Reader, upstream net.Conn) {
+	defer s.untrack(conn, upstream)
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(upstream, br)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(conn, upstream)
+		done <- struct{}{}
+	}()
+	<-done
+}
+
+// hopHeaders 逐跳请求头，代理转发时删除
+var hopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// removeHopHeaders 删除逐跳请求头，包括Connection中列出的请求头
+func removeHopHeaders(h http.Header) {
+	for _, value := range h.Values("Connection") {
+		for _, key := range strings.Split(value, ",") {
+			if key = strings.TrimSpace(key); key != "" {
+				h.Del(key)
+			}
+		}
+	}
+	for _, key := range hopHeaders {
+		h.Del(key)
+	}
+}
+
+// errorStatus 按转发失败的原因返回状态码: 超时为504，其他为502
+func errorStatus(err error) int {
+	if errors.Is(err, goproxy.ErrTimeout) {
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusBadGateway
+}
+
+// copyFlush 复制响应体，每次写入后刷新
+func copyFlush(w http.ResponseWriter, body io.Reader) {
+	rc := http.NewResponseController(w)
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := body.Read(buf)
+		if n > 0 {
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return
+			}
+			rc.Flush()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/fasnow/goproxy"
+)
+
+// newTestServer 启动使用client转发的代理服务器，返回服务器和代理地址
+func newTestServer(t *testing.T, client *goproxy.GoProxy, opts ...Option) (*Server, *url.URL) {
+	s := New(client, opts...)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(ln)
+	t.Cleanup(func() { s.Close() })
+	return s, &url.URL{Scheme: "http", Host: ln.Addr().String()}
+}
+
+func TestServer_HTTP(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Header.Get("X-Client")+" "+r.Header.Get("Proxy-Connection"))
+	}))
+	defer target.Close()
+	client := goproxy.New()
+	client.SetGlobalHeader("X-Client", "goproxy")
+	_, proxyURL := newTestServer(t, client)
+
+	hc := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+	req, _ := http.NewRequest(http.MethodGet, target.URL, nil)
+	req.Header.Set("Proxy-Connection", "keep-alive")
+	resp, err := hc.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "goproxy " {
+		t.Errorf("响应为%q", body)
+	}
+}
+
+func TestServer_Connect(t *testing.T) {
+	target := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer target.Close()
+	_, proxyURL := newTestServer(t, goproxy.New())
+
+	hc := &http.Client{Transport: &http.Transport{
+		Proxy:           http.ProxyURL(proxyURL),
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}}
+	resp, err := hc.Get(target.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if body, _ := io.ReadAll(resp.Body); string(body) != "ok" {
+		t.Errorf("响应为%q", body)
+	}
+}
+
+func TestServer_Auth(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer target.Close()
+	_, proxyURL := newTestServer(t, goproxy.New(), WithAuth("user", "pass"))
+
+	get := func(u *url.URL) int {
+		t.Helper()
+		hc := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(u)}}
+		resp, err := hc.Get(target.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := get(proxyURL); code != http.StatusProxyAuthRequired {
+		t.Errorf("未认证时状态码为%d", code)
+	}
+	authed := *proxyURL
+	authed.User = url.UserPassword("user", "pass")
+	if code := get(&authed); code != http.StatusOK {
+		t.Errorf("认证后状态码为%d", code)
+	}
+}
+
+func TestServer_BadGateway(t *testing.T) {
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	closedAddr := ln.Addr().String()
+	ln.Close()
+	rec := httptest.NewRecorder()
+	New(goproxy.New()).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://"+closedAddr+"/", nil))
+	if rec.Code != http.StatusBadGateway {
+		t.Errorf("目标无法连接时状态码为%d", rec.Code)
+	}
+}
+
+func TestServer_Rewriter(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.URL.Path)
+	}))
+	defer target.Close()
+	rw, err := goproxy.NewRewriter(
+		goproxy.RewriteRule{Path: "^/old$", RewriteURL: "/new", SetResponseHeaders: http.Header{"X-Rewritten": {"1"}}},
+		goproxy.RewriteRule{Path: "^/blocked$", Respond: &goproxy.CannedResponse{Status: http.StatusForbidden}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, proxyURL := newTestServer(t, goproxy.New(), WithRewriter(rw))
+	hc := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+
+	resp, err := hc.Get(target.URL + "/old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "/new" || resp.Header.Get("X-Rewritten") != "1" {
+		t.Errorf("响应为%q, 响应头为%v", body, resp.Header)
+	}
+	resp, err = hc.Get(target.URL + "/blocked")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("状态码为%d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,275 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/fasnow/goproxy"
+)
+
+// SOCKS5协议常量，见RFC 1928和RFC 1929
+const (
+	socks5Version = 0x05
+
+	socks5AuthNone     = 0x00
+	socks5AuthPassword = 0x02
+	socks5AuthNoAccept = 0xff
+
+	socks5CmdConnect = 0x01
+
+	socks5AtypIPv4   = 0x01
+	socks5AtypDomain = 0x03
+	socks5AtypIPv6   = 0x04
+
+	socks5Succeeded           = 0x00
+	socks5GeneralFailure      = 0x01
+	socks5HostUnreachable     = 0x04
+	socks5ConnectionRefused   = 0x05
+	socks5CmdNotSupported     = 0x07
+	socks5AtypNotSupported    = 0x08
+	socks5PasswordAuthVersion = 0x01
+)
+
+// socks5HandshakeTimeout SOCKS5握手和连接目标的超时时间
+const socks5HandshakeTimeout = 30 * time.Second
+
+// ListenAndServeSOCKS5 在addr上监听并处理SOCKS5连接，直到Close或Shutdown
+func (s *Server) ListenAndServeSOCKS5(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.ServeSOCKS5(ln)
+}
+
+// ServeSOCKS5 在ln上处理SOCKS5连接，直到Close或Shutdown，返回http.ErrServerClosed
+// 只支持CONNECT命令，设置WithAuth时要求用户名密码认证
+func (s *Server) ServeSOCKS5(ln net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		ln.Close()
+		return http.ErrServerClosed
+	}
+	s.listeners[ln] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.listeners, ln)
+		s.mu.Unlock()
+		ln.Close()
+	}()
+
+	var delay time.Duration
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return http.ErrServerClosed
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				// 与http.Server相同，暂时性错误(如文件描述符耗尽)时退避后重试
+				delay = min(max(delay*2, 5*time.Millisecond), time.Second)
+				time.Sleep(delay)
+				continue
+			}
+			return err
+		}
+		delay = 0
+		go s.serveSOCKS5Conn(conn)
+	}
+}
+
+// serveSOCKS5Conn 完成SOCKS5握手后通过选择的客户端连接目标并双向转发
+func (s *Server) serveSOCKS5Conn(conn net.Conn) {
+	if !s.track(conn) {
+		return
+	}
+	conn.SetDeadline(time.Now().Add(socks5HandshakeTimeout))
+	br := bufio.NewReader(conn)
+	user, err := s.socks5Auth(conn, br)
+	if err != nil {
+		s.untrack(conn)
+		return
+	}
+	addr, err := readSOCKS5Request(conn, br)
+	if err != nil {
+		s.untrack(conn)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), socks5HandshakeTimeout)
+	upstream, err := s.clientFor(ctx, addr, user).DialContext(ctx, "tcp", addr)
+	cancel()
+	if err != nil {
+		writeSOCKS5Reply(conn, socks5ReplyCode(err), nil)
+		s.untrack(conn)
+		return
+	}
+	if err := writeSOCKS5Reply(conn, socks5Succeeded, upstream.LocalAddr()); err != nil {
+		upstream.Close()
+		s.untrack(conn)
+		return
+	}
+	conn.SetDeadline(time.Time{})
+	if !s.track(upstream) {
+		s.untrack(conn)
+		return
+	}
+	s.relay(conn, br, upstream)
+}
+
+// socks5Auth 协商认证方式并在需要时进行用户名密码认证，返回客户端提供的用户名
+// 客户端提供用户名密码认证时优先使用以取得用户名，未设置WithAuth时接受任意密码
+func (s *Server) socks5Auth(conn net.Conn, br *bufio.Reader) (string, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(br, head[:]); err != nil {
+		return "", err
+	}
+	if head[0] != socks5Version {
+		return "", fmt.Errorf("不支持的SOCKS版本: %d", head[0])
+	}
+	methods := make([]byte, head[1])
+	if _, err := io.ReadFull(br, methods); err != nil {
+		return "", err
+	}
+	requireAuth := s.user != "" || s.password != ""
+	var offerNone, offerPassword bool
+	for _, m := range methods {
+		offerNone = offerNone || m == socks5AuthNone
+		offerPassword = offerPassword || m == socks5AuthPassword
+	}
+	switch {
+	case offerPassword:
+	case !requireAuth && offerNone:
+		_, err := conn.Write([]byte{socks5Version, socks5AuthNone})
+		return "", err
+	default:
+		conn.Write([]byte{socks5Version, socks5AuthNoAccept})
+		return "", errors.New("客户端不支持可接受的认证方式")
+	}
+	if _, err := conn.Write([]byte{socks5Version, socks5AuthPassword}); err != nil {
+		return "", err
+	}
+
+	// RFC 1929: VER ULEN UNAME PLEN PASSWD
+	var ver [1]byte
+	if _, err := io.ReadFull(br, ver[:]); err != nil {
+		return "", err
+	}
+	if ver[0] != socks5PasswordAuthVersion {
+		return "", fmt.Errorf("不支持的认证版本: %d", ver[0])
+	}
+	user, err := readSOCKS5String(br)
+	if err != nil {
+		return "", err
+	}
+	password, err := readSOCKS5String(br)
+	if err != nil {
+		return "", err
+	}
+	if !s.authorized(user, password) {
+		conn.Write([]byte{socks5PasswordAuthVersion, 0x01})
+		return "", errors.New("用户名或密码错误")
+	}
+	_, err = conn.Write([]byte{socks5PasswordAuthVersion, 0x00})
+	return user, err
+}
+
+// readSOCKS5String 读取一个字节的长度和随后的字符串
+func readSOCKS5String(br *bufio.Reader) (string, error) {
+	n, err := br.ReadByte()
+	if err != nil {
+		return "", err
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(br, buf); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+// readSOCKS5Request 读取请求并返回目标地址，不支持的命令或地址类型回复错误后返回error
+func readSOCKS5Request(conn net.Conn, br *bufio.Reader) (string, error) {
+	// VER CMD RSV ATYP
+	var head [4]byte
+	if _, err := io.ReadFull(br, head[:]); err != nil {
+		return "", err
+	}
+	if head[0] != socks5Version {
+		return "", fmt.Errorf("不支持的SOCKS版本: %d", head[0])
+	}
+	var host string
+	switch head[3] {
+	case socks5AtypIPv4, socks5AtypIPv6:
+		ip := make(net.IP, net.IPv4len)
+		if head[3] == socks5AtypIPv6 {
+			ip = make(net.IP, net.IPv6len)
+		}
+		if _, err := io.ReadFull(br, ip); err != nil {
+			return "", err
+		}
+		host = ip.String()
+	case socks5AtypDomain:
+		domain, err := readSOCKS5String(br)
+		if err != nil {
+			return "", err
+		}
+		host = domain
+	default:
+		writeSOCKS5Reply(conn, socks5AtypNotSupported, nil)
+		return "", fmt.Errorf("不支持的地址类型: %d", head[3])
+	}
+	var port [2]byte
+	if _, err := io.ReadFull(br, port[:]); err != nil {
+		return "", err
+	}
+	if head[1] != socks5CmdConnect {
+		writeSOCKS5Reply(conn, socks5CmdNotSupported, nil)
+		return "", fmt.Errorf("不支持的命令: %d", head[1])
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port[:])))), nil
+}
+
+// writeSOCKS5Reply 发送回复，bind为nil或不是TCP地址时使用0.0.0.0:0
+func writeSOCKS5Reply(conn net.Conn, code byte, bind net.Addr) error {
+	ip, port := net.IPv4zero.To4(), 0
+	if addr, ok := bind.(*net.TCPAddr); ok && addr.IP != nil {
+		if ip = addr.IP.To4(); ip == nil {
+			ip = addr.IP.To16()
+		}
+		port = addr.Port
+	}
+	atyp := byte(socks5AtypIPv4)
+	if len(ip) == net.IPv6len {
+		atyp = socks5AtypIPv6
+	}
+	reply := append([]byte{socks5Version, code, 0x00, atyp}, ip...)
+	reply = binary.BigEndian.AppendUint16(reply, uint16(port))
+	_, err := conn.Write(reply)
+	return err
+}
+
+// socks5ReplyCode 按连接目标失败的原因返回回复码
+func socks5ReplyCode(err error) byte {
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return socks5ConnectionRefused
+	case errors.Is(err, goproxy.ErrDNS), errors.Is(err, goproxy.ErrTimeout):
+		return socks5HostUnreachable
+	}
+	return socks5GeneralFailure
+}
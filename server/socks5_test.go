@@ -0,0 +1,129 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/fasnow/goproxy"
+	"golang.org/x/net/proxy"
+)
+
+// newTestSOCKS5 启动SOCKS5服务器，返回监听地址
+func newTestSOCKS5(t *testing.T, s *Server) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.ServeSOCKS5(ln)
+	t.Cleanup(func() { s.Close() })
+	return ln.Addr().String()
+}
+
+// socks5Get 通过SOCKS5代理请求rawURL，返回响应体
+func socks5Get(addr string, auth *proxy.Auth, rawURL string) (string, error) {
+	dialer, err := proxy.SOCKS5("tcp", addr, auth, proxy.Direct)
+	if err != nil {
+		return "", err
+	}
+	hc := &http.Client{Transport: &http.Transport{
+		DialContext: dialer.(proxy.ContextDialer).DialContext,
+	}}
+	resp, err := hc.Get(rawURL)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	return string(body), err
+}
+
+func TestServer_SOCKS5(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer target.Close()
+	addr := newTestSOCKS5(t, New(goproxy.New()))
+	if got, err := socks5Get(addr, nil, target.URL); err != nil || got != "ok" {
+		t.Errorf("响应为%q, 错误为%v", got, err)
+	}
+	// 目标无法连接时连接失败
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	closedAddr := ln.Addr().String()
+	ln.Close()
+	if _, err := socks5Get(addr, nil, "http://"+closedAddr); err == nil {
+		t.Error("目标无法连接时请求成功")
+	}
+}
+
+func TestServer_SOCKS5Auth(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer target.Close()
+	addr := newTestSOCKS5(t, New(goproxy.New(), WithAuth("user", "pass")))
+	if _, err := socks5Get(addr, nil, target.URL); err == nil {
+		t.Error("未认证时请求成功")
+	}
+	if _, err := socks5Get(addr, &proxy.Auth{User: "user", Password: "wrong"}, target.URL); err == nil {
+		t.Error("密码错误时请求成功")
+	}
+	if got, err := socks5Get(addr, &proxy.Auth{User: "user", Password: "pass"}, target.URL); err != nil || got != "ok" {
+		t.Errorf("响应为%q, 错误为%v", got, err)
+	}
+}
+
+func TestServer_Selector(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer target.Close()
+	u, _ := url.Parse(target.URL)
+	// 只有选中的客户端能将internal.test解析到测试服务器
+	selected := goproxy.New()
+	selected.SetHostOverride("internal.test", "127.0.0.1")
+
+	var mu sync.Mutex
+	var users []string
+	s := New(goproxy.New(), WithSelector(func(ctx context.Context, addr, user string) *goproxy.GoProxy {
+		mu.Lock()
+		users = append(users, user)
+		mu.Unlock()
+		if user == "internal" {
+			return selected
+		}
+		return nil
+	}))
+	addr := newTestSOCKS5(t, s)
+	rawURL := "http://internal.test:" + u.Port()
+	if got, err := socks5Get(addr, &proxy.Auth{User: "internal", Password: "x"}, rawURL); err != nil || got != "ok" {
+		t.Errorf("响应为%q, 错误为%v", got, err)
+	}
+	if _, err := socks5Get(addr, &proxy.Auth{User: "other", Password: "x"}, rawURL); err == nil {
+		t.Error("未选中的客户端不应能连接internal.test")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(users) != 2 || users[0] != "internal" || users[1] != "other" {
+		t.Errorf("选择时的用户名为%v", users)
+	}
+}
+
+func TestServer_SOCKS5Close(t *testing.T) {
+	s := New(goproxy.New())
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- s.ServeSOCKS5(ln) }()
+	s.Close()
+	if err := <-done; err != http.ErrServerClosed {
+		t.Errorf("关闭后返回%v", err)
+	}
+}
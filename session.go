@@ -0,0 +1,91 @@
+package goproxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// sessionVersion 会话数据的格式版本，格式不兼容地变化时递增
+const sessionVersion = 1
+
+// session ExportSession导出的会话数据
+type session struct {
+	Version     int            `json:"version"`
+	Proxy       string         `json:"proxy,omitempty"`        // 代理地址，可能包含用户名和密码
+	Headers     http.Header    `json:"headers,omitempty"`      // 全局请求头
+	HeaderOrder []string       `json:"header_order,omitempty"` // 请求头顺序
+	Fingerprint TLSFingerprint `json:"fingerprint,omitempty"`  // TLS指纹
+	Cookies     []*cookieEntry `json:"cookies,omitempty"`      // 未过期的Cookie，包括会话Cookie
+}
+
+// ExportSession 将Cookie、全局请求头、请求头顺序、TLS指纹和当前代理导出为JSON，
+// 可通过ImportSession在其他进程或其他客户端中恢复同一身份
+// 注意: 导出的数据包含登录Cookie和代理密码，应按凭据妥善保存
+func (r *GoProxy) ExportSession() ([]byte, error) {
+	r.mu.Lock()
+	ct := r.transport
+	s := session{
+		Version:     sessionVersion,
+		Proxy:       r.proxyUrl,
+		Headers:     ct.Headers(),
+		Fingerprint: r.fingerprint,
+	}
+	if order := ct.headerOrder.Load(); order != nil {
+		s.HeaderOrder = *order
+	}
+	jar, _ := r.client.Jar.(*CookieJar)
+	r.mu.Unlock()
+
+	if jar != nil {
+		jar.mu.Lock()
+		s.Cookies = jar.validEntries()
+		jar.mu.Unlock()
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return nil, fmt.Errorf("序列化会话失败: %w", err)
+	}
+	return data, nil
+}
+
+// ImportSession 恢复ExportSession导出的会话，替换当前的全局请求头、请求头顺序、TLS指纹、代理和全部Cookie
+// 会话中包含Cookie时自动开启Cookie管理；使用SetCookieFile时导入的Cookie同样写入文件
+func (r *GoProxy) ImportSession(data []byte) error {
+	var s session
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("解析会话失败: %w", err)
+	}
+	if s.Version != sessionVersion {
+		return fmt.Errorf("不支持的会话版本: %d", s.Version)
+	}
+	if _, ok := fingerprintIDs[s.Fingerprint]; !ok && s.Fingerprint != FingerprintGo {
+		return fmt.Errorf("不支持的TLS指纹: %s", s.Fingerprint)
+	}
+	// 先校验指纹并设置可能失败的代理，避免只导入一部分
+	if err := r.SetProxy(s.Proxy); err != nil {
+		return err
+	}
+	if err := r.SetTLSFingerprint(s.Fingerprint); err != nil {
+		return err
+	}
+	r.SetHeaderOrder(s.HeaderOrder...)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ct := r.transport
+	ct.SetHeaders(s.Headers)
+	jar, _ := r.client.Jar.(*CookieJar)
+	if jar == nil && len(s.Cookies) == 0 {
+		return nil
+	}
+	if jar == nil {
+		jar = NewCookieJar()
+		r.client.Jar = jar
+	}
+	jar.mu.Lock()
+	defer jar.mu.Unlock()
+	clear(jar.entries)
+	jar.add(s.Cookies)
+	return nil
+}
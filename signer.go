@@ -0,0 +1,161 @@
+package goproxy
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// Signer 请求签名接口，在全局请求头、认证信息等都已添加之后、请求发出之前调用，
+// 可用于实现各类基于HMAC的私有签名方案。认证失败后的重试请求会重新签名
+type Signer interface {
+	// Sign 根据规范请求计算签名，并将签名写入req的请求头或查询参数，返回错误时请求不会发出
+	Sign(req *http.Request, canonical *CanonicalRequest) error
+}
+
+// SignerFunc 将函数转为Signer
+type SignerFunc func(req *http.Request, canonical *CanonicalRequest) error
+
+// Sign 实现Signer接口
+func (f SignerFunc) Sign(req *http.Request, canonical *CanonicalRequest) error {
+	return f(req, canonical)
+}
+
+// CanonicalRequest 规范化的请求，字段的编码方式与AWS Signature V4相同
+type CanonicalRequest struct {
+	Method        string      // 请求方法
+	Path          string      // 编码后的路径，为空时为"/"
+	Query         string      // 按参数名和值排序、按RFC 3986编码的查询字符串
+	Header        http.Header // 签名时请求中的全部请求头，包括Host
+	SignedHeaders []string    // 参与签名的请求头名称，小写并排序
+	PayloadHash   string      // 请求体SHA-256的十六进制
+}
+
+// String 返回规范请求的文本形式:
+// 方法、路径、查询字符串、各请求头("名称:值"，多个值以逗号连接)、空行、参与签名的请求头名称(以分号连接)、请求体哈希，以换行分隔
+func (c *CanonicalRequest) String() string {
+	var b strings.Builder
+	b.WriteString(c.Method + "\n" + c.Path + "\n" + c.Query + "\n")
+	for _, name := range c.SignedHeaders {
+		values := slices.Clone(c.Header.Values(name))
+		for i, v := range values {
+			values[i] = strings.Join(strings.Fields(v), " ")
+		}
+		b.WriteString(name + ":" + strings.Join(values, ",") + "\n")
+	}
+	b.WriteString("\n" + strings.Join(c.SignedHeaders, ";") + "\n" + c.PayloadHash)
+	return b.String()
+}
+
+// NewCanonicalRequest 根据req生成规范请求，所有请求头都参与签名
+// 需要读取请求体计算哈希: 设置了GetBody时通过GetBody读取，否则将请求体读入内存并替换req.Body
+func NewCanonicalRequest(req *http.Request) (*CanonicalRequest, error) {
+	c := &CanonicalRequest{
+		Method: req.Method,
+		Path:   req.URL.EscapedPath(),
+		Query:  canonicalQuery(req.URL.Query()),
+		Header: req.Header.Clone(),
+	}
+	if c.Path == "" {
+		c.Path = "/"
+	}
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	c.Header.Set("Host", host)
+	for name := range c.Header {
+		c.SignedHeaders = append(c.SignedHeaders, strings.ToLower(name))
+	}
+	slices.Sort(c.SignedHeaders)
+
+	h := sha256.New()
+	if req.Body != nil && req.Body != http.NoBody {
+		var body io.ReadCloser
+		if req.GetBody != nil {
+			rc, err := req.GetBody()
+			if err != nil {
+				return nil, fmt.Errorf("读取请求体失败: %w", err)
+			}
+			body = rc
+		} else {
+			data, err := io.ReadAll(req.Body)
+			req.Body.Close()
+			if err != nil {
+				return nil, fmt.Errorf("读取请求体失败: %w", err)
+			}
+			req.Body = io.NopCloser(bytes.NewReader(data))
+			req.GetBody = func() (io.ReadCloser, error) {
+				return io.NopCloser(bytes.NewReader(data)), nil
+			}
+			body = io.NopCloser(bytes.NewReader(data))
+		}
+		_, err := io.Copy(h, body)
+		body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("读取请求体失败: %w", err)
+		}
+	}
+	c.PayloadHash = hex.EncodeToString(h.Sum(nil))
+	return c, nil
+}
+
+// canonicalQuery 按参数名和值排序并按RFC 3986编码查询参数
+func canonicalQuery(values url.Values) string {
+	var pairs []string
+	for key, vs := range values {
+		for _, v := range vs {
+			pairs = append(pairs, escapeRFC3986(key)+"="+escapeRFC3986(v))
+		}
+	}
+	slices.Sort(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// escapeRFC3986 除字母、数字和"-_.~"外全部百分号编码
+func escapeRFC3986(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// SetSigner 设置请求签名，每个请求在发出前都会调用s.Sign，s为nil时取消签名
+// 注意: Transport在签名之后还会添加Accept-Encoding、Content-Length等请求头，签名方案应只依赖SignedHeaders中的请求头
+func (r *GoProxy) SetSigner(s Signer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ct := r.transport
+	if s == nil {
+		ct.signer.Store(nil)
+		return
+	}
+	ct.signer.Store(&s)
+}
+
+// sign 生成规范请求并调用签名接口，返回签名后的请求，不修改原请求的请求头和URL
+func sign(req *http.Request, s Signer) (*http.Request, error) {
+	req = cloneRequestHeader(req)
+	u := *req.URL
+	req.URL = &u
+	canonical, err := NewCanonicalRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Sign(req, canonical); err != nil {
+		return nil, fmt.Errorf("请求签名失败: %w", err)
+	}
+	return req, nil
+}
@@ -0,0 +1,80 @@
+package goproxy
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNewCanonicalRequest(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodPost, "http://example.com/a%20b?b=2&a=1&a=0&c=x%20y", io.NopCloser(strings.NewReader("hello")))
+	req.Header.Set("X-B", " v  1 ")
+	req.Header.Set("X-A", "1")
+	c, err := NewCanonicalRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "POST\n/a%20b\na=0&a=1&b=2&c=x%20y\nhost:example.com\nx-a:1\nx-b:v 1\n\nhost;x-a;x-b\n" +
+		"2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	if got := c.String(); got != want {
+		t.Errorf("规范请求为%q", got)
+	}
+	// 读入内存的请求体仍可发送
+	if body, _ := io.ReadAll(req.Body); string(body) != "hello" || req.GetBody == nil {
+		t.Errorf("请求体为%q", body)
+	}
+}
+
+// hmacSign 以secret计算规范请求的HMAC-SHA256
+func hmacSign(secret string, c *CanonicalRequest) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	io.WriteString(mac, c.String())
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestGoProxy_SetSigner(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := NewCanonicalRequest(r)
+		if err != nil {
+			t.Error(err)
+		}
+		c.SignedHeaders = strings.Split(r.Header.Get("X-Signed-Headers"), ";")
+		if r.Header.Get("X-Signature") != hmacSign("secret", c) {
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer srv.Close()
+
+	c := New()
+	c.SetGlobalHeader("X-Api-Key", "key")
+	c.SetSigner(SignerFunc(func(req *http.Request, canonical *CanonicalRequest) error {
+		if req.Header.Get("X-Api-Key") != "key" {
+			return errors.New("全局请求头未添加")
+		}
+		req.Header.Set("X-Signed-Headers", strings.Join(canonical.SignedHeaders, ";"))
+		req.Header.Set("X-Signature", hmacSign("secret", canonical))
+		return nil
+	}))
+	req, _ := http.NewRequest(http.MethodPut, srv.URL+"/obj?x=1", strings.NewReader("data"))
+	resp, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || req.Header.Get("X-Signature") != "" {
+		t.Errorf("状态码为%d, 原请求的请求头为%v", resp.StatusCode, req.Header)
+	}
+
+	c.SetSigner(SignerFunc(func(*http.Request, *CanonicalRequest) error {
+		return errors.New("密钥不可用")
+	}))
+	if _, err := c.GetClient().Get(srv.URL); err == nil || !strings.Contains(err.Error(), "密钥不可用") {
+		t.Errorf("签名失败时错误为%v", err)
+	}
+}
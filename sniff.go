@@ -0,0 +1,206 @@
+package goproxy
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// sniffLen 检测类型时读取的响应体长度，与http.DetectContentType相同
+const sniffLen = 512
+
+// ContentSniff 响应声明的类型和按响应体内容检测的类型
+type ContentSniff struct {
+	Declared string // Content-Type响应头中的媒体类型，小写且不含参数，没有或无法解析时为空
+	Charset  string // Content-Type响应头中的charset参数
+	Detected string // 按响应体开头的特征字节检测的媒体类型，不含参数，无法识别时为application/octet-stream
+}
+
+// Mismatch 判断声明的类型与检测的类型是否不一致，如声明为JSON实际为HTML错误页、声明为text/html实际为图片。
+// 没有声明类型或无法识别内容时返回false；text/plain与任何文本类型、XML与+xml类型、ZIP与Office文档等ZIP容器视为一致
+func (s ContentSniff) Mismatch() bool {
+	if s.Declared == "" || s.Detected == "application/octet-stream" {
+		return false
+	}
+	declared, detected := canonicalMediaType(s.Declared), canonicalMediaType(s.Detected)
+	switch {
+	case declared == detected:
+		return false
+	case detected == "text/plain":
+		return !isTextMediaType(declared)
+	case detected == "text/xml":
+		return declared != "application/xml" && !strings.HasSuffix(declared, "+xml")
+	case detected == "application/json":
+		return declared != "text/plain" && !strings.HasSuffix(declared, "+json")
+	case detected == "text/html":
+		return declared != "application/xhtml+xml"
+	case detected == "application/zip":
+		// Office文档、JAR、EPUB等都是ZIP容器
+		return !strings.HasSuffix(declared, "+zip") && !strings.HasPrefix(declared, "application/vnd.openxmlformats-officedocument.") &&
+			!strings.HasPrefix(declared, "application/vnd.oasis.opendocument.") &&
+			declared != "application/java-archive" && declared != "application/vnd.android.package-archive"
+	}
+	return true
+}
+
+// mediaTypeAliases 同一类型的不同写法
+var mediaTypeAliases = map[string]string{
+	"application/x-gzip":           "application/gzip",
+	"application/x-javascript":     "text/javascript",
+	"application/javascript":       "text/javascript",
+	"application/x-zip-compressed": "application/zip",
+	"image/jpg":                    "image/jpeg",
+	"image/x-icon":                 "image/vnd.microsoft.icon",
+	"audio/mp3":                    "audio/mpeg",
+	"font/x-woff":                  "font/woff",
+}
+
+func canonicalMediaType(t string) string {
+	if alias, ok := mediaTypeAliases[t]; ok {
+		return alias
+	}
+	return t
+}
+
+// isTextMediaType 判断媒体类型的内容是否为文本
+func isTextMediaType(t string) bool {
+	switch {
+	case strings.HasPrefix(t, "text/"), strings.HasSuffix(t, "+json"), strings.HasSuffix(t, "+xml"):
+		return true
+	}
+	switch t {
+	case "application/json", "application/xml", "application/x-www-form-urlencoded", "application/x-ndjson",
+		"application/yaml", "application/x-yaml", "application/toml", "image/svg+xml":
+		return true
+	}
+	return false
+}
+
+// DetectContentType 按data开头的特征字节检测媒体类型，返回的类型不含参数，data为空或无法识别时返回application/octet-stream。
+// 在http.DetectContentType的基础上识别JSON、SVG、7z、bzip2、xz、zstd、tar、ELF、PE、SQLite、AVIF和HEIC等格式，
+// 最多使用data的前512字节
+func DetectContentType(data []byte) string {
+	if len(data) == 0 {
+		return "application/octet-stream"
+	}
+	if len(data) > sniffLen {
+		data = data[:sniffLen]
+	}
+	for _, m := range magicSignatures {
+		if len(data) >= m.offset+len(m.magic) && bytes.Equal(data[m.offset:m.offset+len(m.magic)], m.magic) {
+			return m.mediaType
+		}
+	}
+	switch {
+	case len(data) >= 4 && string(data[:3]) == "BZh" && data[3] >= '1' && data[3] <= '9':
+		return "application/x-bzip2"
+	case isPE(data):
+		return "application/vnd.microsoft.portable-executable"
+	case len(data) >= 12 && string(data[4:8]) == "ftyp":
+		// AVIF和HEIC同样使用ISO媒体文件格式，按主品牌区分
+		switch string(data[8:12]) {
+		case "avif", "avis":
+			return "image/avif"
+		case "heic", "heix", "mif1":
+			return "image/heic"
+		}
+	}
+	detected, _, _ := strings.Cut(http.DetectContentType(data), ";")
+	switch detected {
+	case "text/plain":
+		if looksLikeJSON(data) {
+			return "application/json"
+		}
+	case "text/xml":
+		if isSVG(data) {
+			return "image/svg+xml"
+		}
+	}
+	return detected
+}
+
+// magicSignatures http.DetectContentType不识别的格式
+var magicSignatures = []struct {
+	offset    int
+	magic     []byte
+	mediaType string
+}{
+	{0, []byte("7z\xBC\xAF\x27\x1C"), "application/x-7z-compressed"},
+	{0, []byte("\xFD7zXZ\x00"), "application/x-xz"},
+	{0, []byte("\x28\xB5\x2F\xFD"), "application/zstd"},
+	{257, []byte("ustar"), "application/x-tar"},
+	{0, []byte("\x7FELF"), "application/x-elf"},
+	{0, []byte("SQLite format 3\x00"), "application/vnd.sqlite3"},
+}
+
+// isPE 判断data是否为Windows可执行文件: "MZ"开头，0x3C处的偏移指向"PE\0\0"
+func isPE(data []byte) bool {
+	if len(data) < 64 || string(data[:2]) != "MZ" {
+		return false
+	}
+	offset := int(binary.LittleEndian.Uint32(data[60:64]))
+	return offset+4 <= len(data) && string(data[offset:offset+4]) == "PE\x00\x00"
+}
+
+// looksLikeJSON 判断data是否为JSON对象或数组，data可能被截断
+func looksLikeJSON(data []byte) bool {
+	trimmed := bytes.TrimLeft(bytes.TrimPrefix(data, []byte("\xEF\xBB\xBF")), " \t\r\n")
+	if len(trimmed) == 0 || trimmed[0] != '{' && trimmed[0] != '[' {
+		return false
+	}
+	dec := json.NewDecoder(bytes.NewReader(trimmed))
+	for {
+		_, err := dec.Token()
+		switch {
+		case err == nil:
+			continue
+		case err == io.EOF:
+			return true
+		case errors.Is(err, io.ErrUnexpectedEOF):
+			// 只读取了开头的部分
+			return len(data) == sniffLen
+		}
+		return false
+	}
+}
+
+// isSVG 判断XML文档的根元素是否为svg
+func isSVG(data []byte) bool {
+	return bytes.Contains(data, []byte("<svg")) && bytes.Contains(data, []byte("http://www.w3.org/2000/svg"))
+}
+
+// peekedBody 已读取开头部分的响应体，读取时先返回已读取的部分
+type peekedBody struct {
+	io.Reader
+	io.Closer
+}
+
+// SniffContentType 读取响应体开头的最多512字节检测实际的媒体类型，与Content-Type响应头一起返回，
+// 用于识别返回了错误页面、图片被声明为text/html等配置错误的服务器。读取的内容会放回响应体，不影响之后的读取；
+// 响应体已被Transport解压时按解压后的内容检测
+func SniffContentType(resp *http.Response) (ContentSniff, error) {
+	var s ContentSniff
+	if ct := resp.Header.Get("Content-Type"); ct != "" {
+		if mediaType, params, err := mime.ParseMediaType(ct); err == nil {
+			s.Declared, s.Charset = mediaType, params["charset"]
+		}
+	}
+	if resp.Body == nil || resp.Body == http.NoBody {
+		s.Detected = DetectContentType(nil)
+		return s, nil
+	}
+	buf := make([]byte, sniffLen)
+	n, err := io.ReadFull(resp.Body, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return s, err
+	}
+	buf = buf[:n]
+	resp.Body = &peekedBody{Reader: io.MultiReader(bytes.NewReader(buf), resp.Body), Closer: resp.Body}
+	s.Detected = DetectContentType(buf)
+	return s, nil
+}
@@ -0,0 +1,111 @@
+package goproxy
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDetectContentType(t *testing.T) {
+	pe := make([]byte, 128)
+	copy(pe, "MZ")
+	binary.LittleEndian.PutUint32(pe[60:], 64)
+	copy(pe[64:], "PE\x00\x00")
+	tar := make([]byte, 512)
+	copy(tar[257:], "ustar")
+	truncatedJSON := `{"items":[` + strings.Repeat(`"xxxxxxxx",`, 60)
+
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"空", "", "application/octet-stream"},
+		{"HTML", "\n<!DOCTYPE html><html>", "text/html"},
+		{"PNG", "\x89PNG\r\n\x1a\n\x00\x00", "image/png"},
+		{"JSON", ` {"ok": true}`, "application/json"},
+		{"截断的JSON", truncatedJSON, "application/json"},
+		{"不是JSON", `{ok}`, "text/plain"},
+		{"文本", "hello", "text/plain"},
+		{"SVG", `<?xml version="1.0"?><svg xmlns="http://www.w3.org/2000/svg"></svg>`, "image/svg+xml"},
+		{"XML", `<?xml version="1.0"?><feed></feed>`, "text/xml"},
+		{"AVIF", "\x00\x00\x00\x1cftypavif\x00\x00\x00\x00avifmif1", "image/avif"},
+		{"7z", "7z\xBC\xAF\x27\x1C\x00\x04", "application/x-7z-compressed"},
+		{"bzip2", "BZh91AY&SY", "application/x-bzip2"},
+		{"zstd", "\x28\xB5\x2F\xFD\x00", "application/zstd"},
+		{"ELF", "\x7FELF\x02\x01\x01", "application/x-elf"},
+		{"PE", string(pe), "application/vnd.microsoft.portable-executable"},
+		{"MZ开头的文本", "MZ is not an executable", "text/plain"},
+		{"tar", string(tar), "application/x-tar"},
+		{"SQLite", "SQLite format 3\x00\x10\x00", "application/vnd.sqlite3"},
+	}
+	for _, tt := range tests {
+		if got := DetectContentType([]byte(tt.data)); got != tt.want {
+			t.Errorf("%s: DetectContentType = %q，期望%q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestContentSniff_Mismatch(t *testing.T) {
+	tests := []struct {
+		declared, detected string
+		want               bool
+	}{
+		{"application/json", "text/html", true},
+		{"text/html", "image/png", true},
+		{"application/json", "application/json", false},
+		{"application/problem+json", "application/json", false},
+		{"text/plain", "application/json", false},
+		{"application/javascript", "text/plain", false},
+		{"image/png", "text/plain", true},
+		{"application/atom+xml", "text/xml", false},
+		{"application/x-gzip", "application/gzip", false},
+		{"image/jpg", "image/jpeg", false},
+		{"application/vnd.openxmlformats-officedocument.wordprocessingml.document", "application/zip", false},
+		{"", "text/html", false},
+		{"image/png", "application/octet-stream", false},
+	}
+	for _, tt := range tests {
+		s := ContentSniff{Declared: tt.declared, Detected: tt.detected}
+		if got := s.Mismatch(); got != tt.want {
+			t.Errorf("声明%q检测%q: Mismatch = %v", tt.declared, tt.detected, got)
+		}
+	}
+}
+
+func TestSniffContentType(t *testing.T) {
+	page := "<html><body>" + strings.Repeat("维护中", 300) + "</body></html>"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 声明为JSON的HTML错误页
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		io.WriteString(w, page)
+	}))
+	defer srv.Close()
+
+	resp, err := New().GetClient().Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	s, err := SniffContentType(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Declared != "application/json" || s.Charset != "UTF-8" || s.Detected != "text/html" || !s.Mismatch() {
+		t.Errorf("检测结果为%+v", s)
+	}
+	// 读取的内容放回响应体
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != page {
+		t.Errorf("响应体长度为%d，期望%d", len(body), len(page))
+	}
+
+	resp = &http.Response{Header: http.Header{}, Body: io.NopCloser(bytes.NewReader([]byte("\x89PNG\r\n\x1a\n")))}
+	if s, _ := SniffContentType(resp); s.Declared != "" || s.Detected != "image/png" || s.Mismatch() {
+		t.Errorf("检测结果为%+v", s)
+	}
+}
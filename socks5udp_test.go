@@ -0,0 +1,141 @@
+package goproxy
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// newTestSOCKS5UDP 启动一个只支持UDP ASSOCIATE并要求用户名密码认证的SOCKS5代理
+func newTestSOCKS5UDP(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveTestSOCKS5UDP(conn)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func serveTestSOCKS5UDP(conn net.Conn) {
+	defer conn.Close()
+	buf := make([]byte, 512)
+	if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+		return
+	}
+	io.ReadFull(conn, buf[:buf[1]])
+	conn.Write([]byte{0x05, 0x02})
+	// 用户名密码认证: VER ULEN UNAME PLEN PASSWD
+	io.ReadFull(conn, buf[:2])
+	user := make([]byte, buf[1])
+	io.ReadFull(conn, user)
+	io.ReadFull(conn, buf[:1])
+	pass := make([]byte, buf[0])
+	io.ReadFull(conn, pass)
+	if string(user) != "user" || string(pass) != "pass" {
+		conn.Write([]byte{0x01, 0x01})
+		return
+	}
+	conn.Write([]byte{0x01, 0x00})
+
+	io.ReadFull(conn, buf[:3])
+	if _, _, err := readSOCKS5Addr(conn); err != nil || buf[1] != 0x03 {
+		return
+	}
+	relay, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		return
+	}
+	defer relay.Close()
+	// 返回全零地址，客户端应使用控制连接的地址
+	reply, _ := appendSOCKS5Addr([]byte{0x05, 0x00, 0x00}, net.JoinHostPort("0.0.0.0", strconv.Itoa(relay.LocalAddr().(*net.UDPAddr).Port)))
+	conn.Write(reply)
+
+	go func() {
+		var client net.Addr
+		pkt := make([]byte, 65535)
+		for {
+			n, from, err := relay.ReadFrom(pkt)
+			if err != nil {
+				return
+			}
+			if client == nil || from.String() == client.String() {
+				client = from
+				rd := bytes.NewReader(pkt[3:n])
+				host, port, err := readSOCKS5Addr(rd)
+				if err != nil {
+					continue
+				}
+				dst, _ := net.ResolveUDPAddr("udp", net.JoinHostPort(host, strconv.Itoa(port)))
+				relay.WriteTo(pkt[n-rd.Len():n], dst)
+				continue
+			}
+			head, _ := appendSOCKS5Addr([]byte{0, 0, 0}, from.String())
+			relay.WriteTo(append(head, pkt[:n]...), client)
+		}
+	}()
+	io.Copy(io.Discard, conn)
+}
+
+func TestListenUDPVia(t *testing.T) {
+	echo := newTestUDPEcho(t)
+	proxyAddr := newTestSOCKS5UDP(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := ListenUDPVia(ctx, "socks5://user:wrong@"+proxyAddr); err == nil {
+		t.Error("认证失败时应返回错误")
+	}
+
+	pc, err := ListenUDPVia(ctx, "socks5://user:pass@"+proxyAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	pc.SetDeadline(time.Now().Add(5 * time.Second))
+	dst, _ := net.ResolveUDPAddr("udp", echo)
+	if _, err := pc.WriteTo([]byte("ping"), dst); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 1500)
+	n, from, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf[:n]) != "ping" || from.String() != echo {
+		t.Fatalf("收到%q，来源%s", buf[:n], from)
+	}
+
+	// DialUDP在使用SOCKS5代理时经由UDP ASSOCIATE
+	c := New()
+	if err := c.SetProxy("socks5://user:pass@" + proxyAddr); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := c.DialUDP(ctx, echo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	conn.Write([]byte("pong"))
+	if n, err := conn.Read(buf); err != nil || string(buf[:n]) != "pong" {
+		t.Fatalf("收到%q: %v", buf[:n], err)
+	}
+
+	if _, err := New().ListenUDP(ctx); err == nil {
+		t.Error("未设置SOCKS5代理时应返回错误")
+	}
+}
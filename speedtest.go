@@ -0,0 +1,175 @@
+package goproxy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// SpeedTest默认的测速地址，下载地址中的"{{bytes}}"替换为测速的字节数
+const (
+	DefaultSpeedTestDownloadURL = "https://speed.cloudflare.com/__down?bytes={{bytes}}"
+	DefaultSpeedTestUploadURL   = "https://speed.cloudflare.com/__up"
+)
+
+// defaultSpeedTestSize SpeedTest默认传输的字节数
+const defaultSpeedTestSize = 10 << 20
+
+// SpeedTestResult 一次代理测速的结果，可直接序列化为JSON
+type SpeedTestResult struct {
+	Proxy       string    `json:"proxy"`           // 代理地址(密码已脱敏)，直连时为direct
+	OK          bool      `json:"ok"`              // 下载和上传是否都成功
+	LatencyMs   float64   `json:"latency_ms"`      // 下载请求从发出到收到响应头的耗时(毫秒)
+	Downloaded  int64     `json:"downloaded"`      // 下载的字节数
+	DownloadBps float64   `json:"download_bps"`    // 下载速度(字节/秒)，从收到响应头开始计算，不含连接和握手的时间
+	Uploaded    int64     `json:"uploaded"`        // 上传的字节数，未设置上传地址时为0
+	UploadBps   float64   `json:"upload_bps"`      // 上传速度(字节/秒)，从开始发送请求体到收到响应头
+	Error       string    `json:"error,omitempty"` // 失败的原因
+	TestedAt    time.Time `json:"tested_at"`       // 测速时间
+}
+
+// SetSpeedTestEndpoint 设置SpeedTest使用的测速地址
+// 参数:
+//   - download: 下载地址，其中的"{{bytes}}"替换为测速的字节数，服务器应返回该大小的响应体；为空时使用DefaultSpeedTestDownloadURL
+//   - upload: 上传地址，接收POST请求体；为空时使用DefaultSpeedTestUploadURL，为"-"时不测上传速度
+func (r *GoProxy) SetSpeedTestEndpoint(download, upload string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.speedTestDownload = download
+	r.speedTestUpload = upload
+}
+
+// SpeedTest 以当前客户端的配置通过proxy下载和上传sizeBytes字节，测量持续的吞吐量，
+// 与CheckProxy只测延迟不同，可用于按带宽为代理池排序。测速不受SetTimeout整体超时的限制，由ctx控制
+// 参数:
+//   - ctx: 控制测速的取消和超时
+//   - proxy: 代理地址，格式与SetProxy相同，为空时测试当前代理
+//   - sizeBytes: 下载和上传的字节数，小于等于0时为10MB
+func (r *GoProxy) SpeedTest(ctx context.Context, proxy string, sizeBytes int64) SpeedTestResult {
+	r.mu.Lock()
+	if proxy == "" {
+		proxy = r.proxyUrl
+	}
+	download, upload := r.speedTestDownload, r.speedTestUpload
+	r.mu.Unlock()
+	if download == "" {
+		download = DefaultSpeedTestDownloadURL
+	}
+	if upload == "" {
+		upload = DefaultSpeedTestUploadURL
+	}
+	if sizeBytes <= 0 {
+		sizeBytes = defaultSpeedTestSize
+	}
+	key := proxy
+	if key == "" {
+		key = directProxyKey
+	}
+	result := SpeedTestResult{Proxy: redactProxy(key), TestedAt: time.Now()}
+
+	c := r.Clone()
+	defer c.Close()
+	// 测试指定的代理，不经过规则路由
+	c.SetRouter(nil)
+	c.SetFlowExporter(nil)
+	if err := c.SetProxy(proxy); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	err := c.measureDownload(ctx, download, sizeBytes, &result)
+	if err == nil && upload != "-" {
+		err = c.measureUpload(ctx, upload, sizeBytes, &result)
+	}
+	if err != nil {
+		result.Error = err.Error()
+	} else {
+		result.OK = true
+	}
+	return result
+}
+
+// measureDownload 下载测速
+func (r *GoProxy) measureDownload(ctx context.Context, target string, size int64, result *SpeedTestResult) error {
+	target = expandHeaderTemplate(target, func(name string) (string, bool) {
+		if name != "bytes" {
+			return "", false
+		}
+		return strconv.FormatInt(size, 10), true
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	resp, err := r.doStream(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	first := time.Now()
+	result.LatencyMs = float64(first.Sub(start)) / float64(time.Millisecond)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("下载测速返回%s", resp.Status)
+	}
+	n, err := io.Copy(io.Discard, io.LimitReader(resp.Body, size))
+	result.Downloaded = n
+	result.DownloadBps = throughput(n, time.Since(first))
+	return err
+}
+
+// measureUpload 上传测速
+func (r *GoProxy) measureUpload(ctx context.Context, target string, size int64, result *SpeedTestResult) error {
+	body := &speedTestBody{size: size}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp, err := r.doStream(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	end := time.Now()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("上传测速返回%s", resp.Status)
+	}
+	result.Uploaded = body.sent.Load()
+	if started := body.started.Load(); started != 0 {
+		result.UploadBps = throughput(result.Uploaded, end.Sub(time.Unix(0, started)))
+	}
+	return nil
+}
+
+// throughput 按字节数和耗时计算每秒的字节数
+func throughput(n int64, d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+	return float64(n) / d.Seconds()
+}
+
+// speedTestBody 上传测速的请求体，记录开始读取的时间和已发送的字节数
+type speedTestBody struct {
+	size    int64
+	sent    atomic.Int64
+	started atomic.Int64
+}
+
+func (b *speedTestBody) Read(p []byte) (int, error) {
+	sent := b.sent.Load()
+	if sent >= b.size {
+		return 0, io.EOF
+	}
+	b.started.CompareAndSwap(0, time.Now().UnixNano())
+	n := int(min(int64(len(p)), b.size-sent))
+	clear(p[:n])
+	b.sent.Add(int64(n))
+	return n, nil
+}
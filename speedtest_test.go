@@ -0,0 +1,65 @@
+package goproxy
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestGoProxy_SpeedTest(t *testing.T) {
+	var uploaded atomic.Int64
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/down":
+			n, _ := strconv.Atoi(r.URL.Query().Get("bytes"))
+			w.Header().Set("Content-Length", strconv.Itoa(n))
+			io.Copy(w, strings.NewReader(strings.Repeat("x", n)))
+		case "/up":
+			n, _ := io.Copy(io.Discard, r.Body)
+			uploaded.Store(n)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer target.Close()
+	proxySrv, _ := newTestProxy(t)
+
+	c := New()
+	c.SetSpeedTestEndpoint(target.URL+"/down?bytes={{bytes}}", target.URL+"/up")
+	res := c.SpeedTest(context.Background(), proxySrv.URL, 1<<20)
+	if !res.OK || res.Proxy != proxySrv.URL || res.Downloaded != 1<<20 || res.Uploaded != 1<<20 || uploaded.Load() != 1<<20 {
+		t.Fatalf("测速结果为%+v", res)
+	}
+	if res.DownloadBps <= 0 || res.UploadBps <= 0 || res.LatencyMs <= 0 {
+		t.Errorf("速度为%+v", res)
+	}
+	if c.String() != "" {
+		t.Errorf("当前代理变为%s", c.String())
+	}
+
+	// 不测上传速度，测速地址随Clone复制
+	c2 := c.Clone()
+	c2.SetSpeedTestEndpoint(target.URL+"/down?bytes={{bytes}}", "-")
+	uploaded.Store(0)
+	if res = c2.SpeedTest(context.Background(), "", 1000); !res.OK || res.Proxy != "direct" || res.Downloaded != 1000 || res.Uploaded != 0 || uploaded.Load() != 0 {
+		t.Errorf("直连的测速结果为%+v", res)
+	}
+
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	closedAddr := ln.Addr().String()
+	ln.Close()
+	if res = c.SpeedTest(context.Background(), "http://"+closedAddr, 1000); res.OK || res.Error == "" {
+		t.Errorf("不可用代理的测速结果为%+v", res)
+	}
+
+	c.SetSpeedTestEndpoint(target.URL+"/missing", "")
+	if res = c.SpeedTest(context.Background(), "", 1000); res.OK || !strings.Contains(res.Error, "404") {
+		t.Errorf("测速地址不存在时的结果为%+v", res)
+	}
+}
@@ -0,0 +1,270 @@
+package goproxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ErrDestinationDenied 目标地址被SetSSRFGuard设置的规则拒绝
+var ErrDestinationDenied = errors.New("目标地址被SSRF防护拒绝")
+
+// SSRFGuard 防止服务端请求伪造(SSRF)的目标地址规则，用于按用户提供的URL发起请求的服务。
+// 主机名和端口规则在连接前按URL中的目标检查；IP规则在直接连接时按DNS解析后实际连接的每个地址检查，
+// 每次连接只解析一次，检查通过的地址就是实际连接的地址，因此域名解析到内网地址或DNS重绑定都不能绕过。
+// 注意: 通过代理访问时目标域名默认由代理解析，只能检查主机名和IP形式的目标，见ResolveForProxy
+type SSRFGuard struct {
+	// AllowPrivate 为false时拒绝回环、私有、链路本地(包括云服务的元数据地址169.254.169.254)、运营商级NAT、
+	// 组播、保留和未指定地址，以及localhost和*.localhost
+	AllowPrivate bool
+	// DenyHosts 拒绝的主机名，支持"*.example.com"形式的通配符
+	DenyHosts []string
+	// AllowHosts 不为空时只允许这些主机名，支持通配符
+	AllowHosts []string
+	// DenyCIDRs 额外拒绝的网段，如"203.0.113.0/24"
+	DenyCIDRs []string
+	// AllowCIDRs 允许的网段，优先于默认拒绝的地址和DenyCIDRs，如"10.1.0.0/16"允许访问某个内网服务
+	AllowCIDRs []string
+	// AllowPorts 不为空时只允许这些端口
+	AllowPorts []int
+	// ResolveForProxy 通过代理访问时在本地解析目标域名并检查，再让代理连接检查通过的IP地址，
+	// Host请求头、SNI和证书校验仍使用原域名。http目标因此也通过CONNECT隧道访问HTTP代理。
+	// 代理与本机的DNS解析结果不同(如分区解析)时可能连接到不同的服务器
+	ResolveForProxy bool
+}
+
+// ssrfGuard 解析后的SSRFGuard
+type ssrfGuard struct {
+	spec         SSRFGuard
+	denyHosts    map[string]struct{}
+	allowHosts   map[string]struct{}
+	denyNets     []*net.IPNet
+	allowNets    []*net.IPNet
+	allowedPorts map[int]struct{}
+}
+
+// nonPublicNets 默认拒绝的非公网地址，net.IP的IsPrivate等方法之外的部分
+var nonPublicNets = mustParseCIDRs(
+	"0.0.0.0/8",      // 本网络
+	"100.64.0.0/10",  // 运营商级NAT，包括部分云服务的元数据地址100.100.100.200
+	"192.0.0.0/24",   // IETF协议分配
+	"198.18.0.0/15",  // 基准测试
+	"240.0.0.0/4",    // 保留，包括广播地址
+	"100::/64",       // 丢弃
+	"2001:db8::/32",  // 文档
+	"fec0::/10",      // 已废弃的站点本地地址
+	"64:ff9b:1::/48", // 本地使用的NAT64
+	"2001::/32",      // Teredo，隧道另一端的地址无法检查
+	"2002::/16",      // 6to4，同上
+	"::/96",          // 已废弃的IPv4兼容地址
+)
+
+// nat64Prefix 知名NAT64前缀，地址的后4字节为实际访问的IPv4地址
+var nat64Prefix = mustParseCIDRs("64:ff9b::/96")[0]
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, len(cidrs))
+	for i, s := range cidrs {
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			panic(err)
+		}
+		nets[i] = n
+	}
+	return nets
+}
+
+// newSSRFGuard 解析规则
+func newSSRFGuard(g *SSRFGuard) (*ssrfGuard, error) {
+	sg := &ssrfGuard{spec: SSRFGuard{
+		AllowPrivate: g.AllowPrivate,
+		DenyHosts:    slices.Clone(g.DenyHosts),
+		AllowHosts:   slices.Clone(g.AllowHosts),
+		DenyCIDRs:    slices.Clone(g.DenyCIDRs),
+		AllowCIDRs:   slices.Clone(g.AllowCIDRs),
+		AllowPorts:   slices.Clone(g.AllowPorts),
+
+		ResolveForProxy: g.ResolveForProxy,
+	}}
+	hosts := func(patterns []string) map[string]struct{} {
+		if len(patterns) == 0 {
+			return nil
+		}
+		m := make(map[string]struct{}, len(patterns))
+		for _, p := range patterns {
+			m[normalizeHost(p)] = struct{}{}
+		}
+		return m
+	}
+	sg.denyHosts, sg.allowHosts = hosts(g.DenyHosts), hosts(g.AllowHosts)
+	for _, list := range []struct {
+		cidrs []string
+		nets  *[]*net.IPNet
+	}{{g.DenyCIDRs, &sg.denyNets}, {g.AllowCIDRs, &sg.allowNets}} {
+		for _, s := range list.cidrs {
+			_, n, err := net.ParseCIDR(s)
+			if err != nil {
+				return nil, fmt.Errorf("SSRF防护的网段无效: %w", err)
+			}
+			*list.nets = append(*list.nets, n)
+		}
+	}
+	for _, port := range g.AllowPorts {
+		if port <= 0 || port > 65535 {
+			return nil, fmt.Errorf("SSRF防护的端口无效: %d", port)
+		}
+		if sg.allowedPorts == nil {
+			sg.allowedPorts = make(map[int]struct{})
+		}
+		sg.allowedPorts[port] = struct{}{}
+	}
+	return sg, nil
+}
+
+// checkTarget 连接前按主机名、端口和IP形式的主机检查目标addr(host:port)
+func (g *ssrfGuard) checkTarget(addr string) error {
+	if _, ok := unixSocketPath(addr); ok {
+		return fmt.Errorf("%w: 不允许连接Unix套接字", ErrDestinationDenied)
+	}
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrDestinationDenied, err)
+	}
+	if g.allowedPorts != nil {
+		port, _ := strconv.Atoi(portStr)
+		if _, ok := g.allowedPorts[port]; !ok {
+			return fmt.Errorf("%w: 不允许的端口%s", ErrDestinationDenied, portStr)
+		}
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return g.checkIP(ip)
+	}
+	host = normalizeHost(host)
+	if g.allowHosts != nil {
+		if _, ok := lookupHost(g.allowHosts, host); !ok {
+			return fmt.Errorf("%w: %s不在允许的主机中", ErrDestinationDenied, host)
+		}
+	}
+	if _, ok := lookupHost(g.denyHosts, host); ok {
+		return fmt.Errorf("%w: %s为拒绝的主机", ErrDestinationDenied, host)
+	}
+	if !g.spec.AllowPrivate && (host == "localhost" || strings.HasSuffix(host, ".localhost")) {
+		return fmt.Errorf("%w: %s为本机地址", ErrDestinationDenied, host)
+	}
+	return nil
+}
+
+// checkIP 检查实际连接的IP地址，g为nil时不检查
+func (g *ssrfGuard) checkIP(ip net.IP) error {
+	if g == nil {
+		return nil
+	}
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+	for _, n := range g.allowNets {
+		if n.Contains(ip) {
+			return nil
+		}
+	}
+	for _, n := range g.denyNets {
+		if n.Contains(ip) {
+			return fmt.Errorf("%w: %s在拒绝的网段%s中", ErrDestinationDenied, ip, n)
+		}
+	}
+	if !g.spec.AllowPrivate && !isPublicIP(ip) {
+		return fmt.Errorf("%w: %s不是公网地址", ErrDestinationDenied, ip)
+	}
+	return nil
+}
+
+// isPublicIP 判断ip是否为公网单播地址，NAT64地址按其中的IPv4地址判断
+func isPublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return false
+	}
+	if ip.To4() == nil && nat64Prefix.Contains(ip) {
+		return isPublicIP(ip[12:])
+	}
+	for _, n := range nonPublicNets {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// ssrfGuardKey 在直接连接目标的拨号上下文中传递SSRF防护规则，连接代理服务器时不设置
+type ssrfGuardKey struct{}
+
+// SetSSRFGuard 设置SSRF防护，拒绝访问内网、云服务元数据等地址以及指定的主机，被拒绝的请求返回ErrDestinationDenied。
+// 跟随重定向、SetHostOverride替换后的地址和DialContext、DialUDP建立的连接同样受限制；连接代理服务器和DoH服务器不受限制
+// 参数:
+//   - g: 防护规则，零值即拒绝所有非公网地址；调用后修改g不影响已设置的规则；为nil时取消防护
+func (r *GoProxy) SetSSRFGuard(g *SSRFGuard) error {
+	var sg *ssrfGuard
+	if g != nil {
+		var err error
+		if sg, err = newSSRFGuard(g); err != nil {
+			return err
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ssrfGuard = sg
+	r.closeIdleConns()
+	return nil
+}
+
+// GetSSRFGuard 返回当前的SSRF防护规则，未设置时返回nil
+func (r *GoProxy) GetSSRFGuard() *SSRFGuard {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.ssrfGuard == nil {
+		return nil
+	}
+	g, _ := newSSRFGuard(&r.ssrfGuard.spec)
+	return &g.spec
+}
+
+// resolveForProxy 在本地解析通过代理访问的目标addr并检查解析得到的地址，
+// 返回按IP地址族策略选择的第一个地址，addr的主机为IP地址时原样返回
+func (r *GoProxy) resolveForProxy(ctx context.Context, g *ssrfGuard, network, addr string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || net.ParseIP(host) != nil {
+		return addr, nil
+	}
+	r.mu.Lock()
+	res, policy, cache := r.resolver, r.ipPolicy, r.dnsCache
+	r.mu.Unlock()
+	if cache != nil {
+		res = cachedResolver{cache, res}
+	} else if res == nil {
+		res = net.DefaultResolver
+	}
+	ips, err := res.LookupIPAddr(ctx, host)
+	if err != nil {
+		return "", newError(ErrDNS, fmt.Errorf("解析域名%s失败: %w", host, err))
+	}
+	network = policy.restrictNetwork(network)
+	var candidates []net.IP
+	for _, ip := range policy.sortIPs(ips) {
+		if ipMatchesNetwork(ip.IP, network) {
+			candidates = append(candidates, ip.IP)
+		}
+	}
+	if len(candidates) == 0 {
+		return "", fmt.Errorf("连接%s失败: 没有可用的地址", host)
+	}
+	// 与直接连接相同，有任一地址被拒绝时整体拒绝
+	for _, ip := range candidates {
+		if err := g.checkIP(ip); err != nil {
+			return "", fmt.Errorf("%s解析为%s: %w", host, ip, err)
+		}
+	}
+	return net.JoinHostPort(candidates[0].String(), port), nil
+}
@@ -0,0 +1,208 @@
+package goproxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+)
+
+func TestIsPublicIP(t *testing.T) {
+	for ip, want := range map[string]bool{
+		"8.8.8.8":          true,
+		"2606:4700::1111":  true,
+		"64:ff9b::808:808": true,
+		"127.0.0.1":        false,
+		"10.1.2.3":         false,
+		"169.254.169.254":  false,
+		"100.100.100.200":  false,
+		"0.0.0.0":          false,
+		"255.255.255.255":  false,
+		"::1":              false,
+		"fd00:ec2::254":    false,
+		"fe80::1":          false,
+		"::ffff:10.0.0.1":  false,
+		"64:ff9b::a00:1":   false,
+		"2002:7f00:1::":    false,
+	} {
+		if got := isPublicIP(net.ParseIP(ip)); got != want {
+			t.Errorf("isPublicIP(%s) = %v", ip, got)
+		}
+	}
+}
+
+func TestSSRFGuard_CheckTarget(t *testing.T) {
+	g, err := newSSRFGuard(&SSRFGuard{
+		DenyHosts:  []string{"*.internal.example.com"},
+		DenyCIDRs:  []string{"203.0.113.0/24"},
+		AllowCIDRs: []string{"10.1.0.0/16"},
+		AllowPorts: []int{80, 443},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for addr, allowed := range map[string]bool{
+		"example.com:443":             true,
+		"example.com:8080":            false,
+		"db.internal.example.com:443": false,
+		"localhost:80":                false,
+		"api.localhost:80":            false,
+		"203.0.113.7:443":             false,
+		"10.1.2.3:443":                true,
+		"10.2.0.1:443":                false,
+		"[::ffff:169.254.169.254]:80": false,
+		"7365727665722e736f636b.unix-socket.invalid:80": false,
+	} {
+		err := g.checkTarget(addr)
+		if (err == nil) != allowed || err != nil && !errors.Is(err, ErrDestinationDenied) {
+			t.Errorf("checkTarget(%s) = %v", addr, err)
+		}
+	}
+
+	g, _ = newSSRFGuard(&SSRFGuard{AllowHosts: []string{"api.example.com", "*.cdn.example.com"}})
+	if g.checkTarget("api.example.com:443") != nil || g.checkTarget("a.cdn.example.com:443") != nil || g.checkTarget("example.com:443") == nil {
+		t.Error("AllowHosts未生效")
+	}
+	for _, bad := range []*SSRFGuard{{DenyCIDRs: []string{"10.0.0.0"}}, {AllowPorts: []int{0}}} {
+		if _, err := newSSRFGuard(bad); err == nil {
+			t.Errorf("%+v应返回错误", bad)
+		}
+	}
+}
+
+func TestGoProxy_SetSSRFGuard(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	c := New()
+	if err := c.SetSSRFGuard(&SSRFGuard{}); err != nil {
+		t.Fatal(err)
+	}
+	// 域名解析到内网地址同样被拒绝
+	c.SetResolver(staticResolver{"rebind.test": {{IP: net.ParseIP("127.0.0.1")}}})
+	c.SetHostOverride("override.test", u.Host)
+	for _, target := range []string{srv.URL, "http://rebind.test:" + u.Port(), "http://override.test/", "http://localhost:" + u.Port()} {
+		_, err := c.GetClient().Get(target)
+		if !errors.Is(err, ErrDestinationDenied) || IsTemporary(err) {
+			t.Errorf("%s: 错误为%v", target, err)
+		}
+	}
+
+	// 允许的网段优先于默认规则
+	c.SetSSRFGuard(&SSRFGuard{AllowCIDRs: []string{"127.0.0.0/8"}})
+	resp, err := c.GetClient().Get("http://rebind.test:" + u.Port())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if g := c.GetSSRFGuard(); g == nil || len(g.AllowCIDRs) != 1 || c.Clone().GetSSRFGuard() == nil {
+		t.Errorf("GetSSRFGuard = %+v", g)
+	}
+
+	// 代理服务器本身不受限制，由代理转发的目标仍然检查
+	proxySrv, _ := newTestProxy(t)
+	c = New()
+	c.SetProxy(proxySrv.URL)
+	c.SetSSRFGuard(&SSRFGuard{DenyHosts: []string{"blocked.test"}})
+	if _, err := c.GetClient().Get(srv.URL); !errors.Is(err, ErrDestinationDenied) {
+		t.Errorf("经代理访问内网地址的错误为%v", err)
+	}
+	if _, err := c.GetClient().Get("http://blocked.test/"); !errors.Is(err, ErrDestinationDenied) {
+		t.Errorf("经代理访问拒绝的主机的错误为%v", err)
+	}
+	resp, err = c.GetClient().Get("http://unresolvable.invalid/")
+	if err != nil {
+		t.Fatalf("连接代理服务器被拒绝: %v", err)
+	}
+	resp.Body.Close()
+	c.SetSSRFGuard(nil)
+	if resp, err = c.GetClient().Get(srv.URL); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+}
+
+// rebindingResolver 第一次解析返回first，之后返回then，模拟DNS重绑定
+type rebindingResolver struct {
+	lookups     atomic.Int32
+	first, then net.IP
+}
+
+func (r *rebindingResolver) LookupIPAddr(_ context.Context, host string) ([]net.IPAddr, error) {
+	if r.lookups.Add(1) == 1 {
+		return []net.IPAddr{{IP: r.first}}, nil
+	}
+	return []net.IPAddr{{IP: r.then}}, nil
+}
+
+func TestGoProxy_SSRFGuardResolveOnce(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Host)
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	c := New()
+	c.SetSSRFGuard(&SSRFGuard{AllowCIDRs: []string{"127.0.0.1/32"}})
+	res := &rebindingResolver{first: net.ParseIP("127.0.0.1"), then: net.ParseIP("10.0.0.1")}
+	c.SetResolver(res)
+	var dialed []string
+	c.SetDialContext(func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialed = append(dialed, addr)
+		return (&net.Dialer{}).DialContext(ctx, network, addr)
+	})
+	resp, err := c.GetClient().Get("http://rebind.test:" + u.Port())
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	// 检查和连接使用同一次解析的结果，Host请求头仍为原域名
+	if res.lookups.Load() != 1 || len(dialed) != 1 || dialed[0] != "127.0.0.1:"+u.Port() || string(body) != "rebind.test:"+u.Port() {
+		t.Errorf("解析了%d次，连接了%v，Host为%q", res.lookups.Load(), dialed, body)
+	}
+
+	// 重绑定后的新连接按新的解析结果检查
+	c.transport.Transport.CloseIdleConnections()
+	if _, err := c.GetClient().Get("http://rebind.test:" + u.Port()); !errors.Is(err, ErrDestinationDenied) {
+		t.Errorf("重绑定到内网地址的错误为%v", err)
+	}
+}
+
+func TestGoProxy_SSRFGuardResolveForProxy(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Host)
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+	proxySrv, connects := newTestProxy(t)
+
+	c := New()
+	c.SetProxy(proxySrv.URL)
+	// 代理无法解析pinned.test，只有在本地解析后才能连接
+	c.SetResolver(staticResolver{
+		"pinned.test":  {{IP: net.ParseIP("127.0.0.1")}},
+		"private.test": {{IP: net.ParseIP("10.0.0.1")}},
+	})
+	c.SetSSRFGuard(&SSRFGuard{AllowCIDRs: []string{"127.0.0.0/8"}, ResolveForProxy: true})
+	resp, err := c.GetClient().Get("http://pinned.test:" + u.Port())
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "pinned.test:"+u.Port() || connects.Load() != 1 {
+		t.Errorf("Host为%q，CONNECT了%d次", body, connects.Load())
+	}
+	if _, err := c.GetClient().Get("http://private.test/"); !errors.Is(err, ErrDestinationDenied) || connects.Load() != 1 {
+		t.Errorf("解析到内网地址的错误为%v", err)
+	}
+}
@@ -0,0 +1,218 @@
+package goproxy
+
+import (
+	"net"
+	"net/url"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// statsWindow 滚动统计窗口大小，成功率和平均延迟只基于最近的statsWindow次请求计算
+const statsWindow = 100
+
+// directProxyKey 未使用代理时的统计键名
+const directProxyKey = "direct"
+
+// ProxyStats 单个代理的统计快照，可直接序列化为JSON供监控系统采集
+type ProxyStats struct {
+	Proxy        string    `json:"proxy"`                  // 代理地址(密码已脱敏)，直连时为direct
+	Requests     int64     `json:"requests"`               // 累计请求数
+	Successes    int64     `json:"successes"`              // 累计成功数
+	Failures     int64     `json:"failures"`               // 累计失败数
+	SuccessRate  float64   `json:"success_rate"`           // 最近窗口内的成功率(0-1)
+	AvgLatencyMs float64   `json:"avg_latency_ms"`         // 最近窗口内的平均延迟(毫秒)
+	LastError    string    `json:"last_error,omitempty"`   // 最近一次错误信息
+	LastErrorAt  time.Time `json:"last_error_at,omitzero"` // 最近一次错误发生时间
+	LastUsedAt   time.Time `json:"last_used_at,omitzero"`  // 最近一次使用时间
+	BytesSent    int64     `json:"bytes_sent"`             // 经由该代理的连接累计发送的字节数
+	BytesRecv    int64     `json:"bytes_recv"`             // 经由该代理的连接累计接收的字节数
+}
+
+// proxyStat 单个代理的内部统计状态
+type proxyStat struct {
+	requests    int64
+	successes   int64
+	failures    int64
+	outcomes    [statsWindow]bool          // 滚动窗口内每次请求是否成功
+	latencies   [statsWindow]time.Duration // 滚动窗口内每次请求的耗时
+	next        int                        // 下一次写入窗口的位置
+	filled      int                        // 窗口中已有的样本数
+	lastError   string
+	lastErrorAt time.Time
+	lastUsedAt  time.Time
+}
+
+// trafficCounter 单个代理的连接收发字节数，连接读写时无锁累加
+type trafficCounter struct {
+	sent, recv atomic.Int64
+}
+
+// statsCollector 按代理维度收集请求统计
+type statsCollector struct {
+	mu      sync.Mutex
+	current string // 当前使用的代理地址
+	items   map[string]*proxyStat
+	traffic map[string]*trafficCounter // 按代理统计的流量，重置时清零而不删除，已打开的连接继续计入
+}
+
+func newStatsCollector() *statsCollector {
+	return &statsCollector{items: make(map[string]*proxyStat), traffic: make(map[string]*trafficCounter)}
+}
+
+// setCurrent 切换当前代理，后续请求的统计将记录在该代理下
+func (s *statsCollector) setCurrent(proxy string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.current = proxy
+}
+
+// currentProxy 返回当前代理的统计键
+func (s *statsCollector) currentProxy() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.current == "" {
+		return directProxyKey
+	}
+	return s.current
+}
+
+// record 记录一次请求结果，err为nil视为成功
+func (s *statsCollector) record(proxy string, latency time.Duration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, ok := s.items[proxy]
+	if !ok {
+		st = &proxyStat{}
+		s.items[proxy] = st
+	}
+	now := time.Now()
+	st.requests++
+	st.lastUsedAt = now
+	if err == nil {
+		st.successes++
+	} else {
+		st.failures++
+		st.lastError = err.Error()
+		st.lastErrorAt = now
+	}
+	st.outcomes[st.next] = err == nil
+	st.latencies[st.next] = latency
+	st.next = (st.next + 1) % statsWindow
+	if st.filled < statsWindow {
+		st.filled++
+	}
+}
+
+// wrapConn 包装经由proxy建立的连接，将其收发的字节数计入该代理的流量，s为nil时原样返回
+func (s *statsCollector) wrapConn(conn net.Conn, proxy string) net.Conn {
+	if s == nil {
+		return conn
+	}
+	s.mu.Lock()
+	tc, ok := s.traffic[proxy]
+	if !ok {
+		tc = &trafficCounter{}
+		s.traffic[proxy] = tc
+	}
+	s.mu.Unlock()
+	return &trafficConn{Conn: conn, counter: tc}
+}
+
+// snapshot 返回所有代理的统计快照，按代理地址排序
+func (s *statsCollector) snapshot() []ProxyStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := make([]ProxyStats, 0, len(s.items))
+	for proxy, tc := range s.traffic {
+		// 只有流量没有请求记录的代理(如规则路由选择的上游)同样列出
+		if _, ok := s.items[proxy]; !ok && (tc.sent.Load() != 0 || tc.recv.Load() != 0) {
+			result = append(result, ProxyStats{Proxy: redactProxy(proxy), BytesSent: tc.sent.Load(), BytesRecv: tc.recv.Load()})
+		}
+	}
+	for proxy, st := range s.items {
+		ps := ProxyStats{
+			Proxy:       redactProxy(proxy),
+			Requests:    st.requests,
+			Successes:   st.successes,
+			Failures:    st.failures,
+			LastError:   st.lastError,
+			LastErrorAt: st.lastErrorAt,
+			LastUsedAt:  st.lastUsedAt,
+		}
+		if tc := s.traffic[proxy]; tc != nil {
+			ps.BytesSent, ps.BytesRecv = tc.sent.Load(), tc.recv.Load()
+		}
+		if st.filled > 0 {
+			var ok int
+			var total time.Duration
+			for i := 0; i < st.filled; i++ {
+				if st.outcomes[i] {
+					ok++
+				}
+				total += st.latencies[i]
+			}
+			ps.SuccessRate = float64(ok) / float64(st.filled)
+			ps.AvgLatencyMs = float64(total) / float64(st.filled) / float64(time.Millisecond)
+		}
+		result = append(result, ps)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Proxy < result[j].Proxy })
+	return result
+}
+
+// reset 清空所有统计数据
+func (s *statsCollector) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items = make(map[string]*proxyStat)
+	for _, tc := range s.traffic {
+		tc.sent.Store(0)
+		tc.recv.Store(0)
+	}
+}
+
+// trafficConn 将收发的字节数计入trafficCounter的连接
+type trafficConn struct {
+	net.Conn
+	counter *trafficCounter
+}
+
+func (c *trafficConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.counter.recv.Add(int64(n))
+	return n, err
+}
+
+func (c *trafficConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.counter.sent.Add(int64(n))
+	return n, err
+}
+
+// NetConn 返回被包装的连接
+func (c *trafficConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+// redactProxy 隐藏代理地址中的密码，避免凭据出现在监控数据中
+func redactProxy(proxy string) string {
+	u, err := url.Parse(proxy)
+	if err != nil || u.User == nil {
+		return proxy
+	}
+	return u.Redacted()
+}
+
+// PoolStats 返回每个使用过的代理的统计快照
+// 包括累计请求数、最近窗口内的成功率、平均延迟、连接的收发字节数以及最近一次错误，
+// 返回值可直接使用json.Marshal序列化供监控系统采集
+func (r *GoProxy) PoolStats() []ProxyStats {
+	return r.transport.stats.snapshot()
+}
+
+// ResetPoolStats 清空所有代理的统计数据
+func (r *GoProxy) ResetPoolStats() {
+	r.transport.stats.reset()
+}
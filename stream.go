@@ -0,0 +1,252 @@
+package goproxy
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrStopStream 流式处理函数返回该错误时Stream和SubscribeEvents正常结束并返回nil
+var ErrStopStream = errors.New("停止接收")
+
+// ReconnectPolicy 流式连接断开后的重连策略，由Stream和SubscribeEvents共用。
+// 本包没有WebSocket客户端，WebSocket连接的重连需要由调用方自行处理
+type ReconnectPolicy struct {
+	MaxAttempts int           // 连续重连的最多次数，小于等于0时不限制；连接上收到数据(SubscribeEvents为收到事件)后重新计数
+	Backoff     time.Duration // 第一次重连前的等待时间，之后每次翻倍并加入随机抖动，为0时为100ms
+	MaxBackoff  time.Duration // 等待时间的上限，为0时为10s
+
+	// OnDisconnect 连接断开或建立连接失败、准备重连时的回调，attempt为本次是连续第几次重连，可以为nil
+	OnDisconnect func(err error, attempt int)
+}
+
+// retryPolicy 转换为计算退避时间的RetryPolicy
+func (p ReconnectPolicy) retryPolicy() RetryPolicy {
+	return RetryPolicy{Attempts: p.MaxAttempts, Backoff: p.Backoff, MaxBackoff: p.MaxBackoff}
+}
+
+// StreamHandler 处理一次连接得到的流式响应，读取响应体直到结束，返回后响应体被关闭。
+// next为重连时使用的请求，可以修改其URL和请求头以携带恢复位置(如Range或偏移量参数)
+type StreamHandler func(resp *http.Response, next *http.Request) error
+
+// Stream 发送请求并以handler持续读取流式(如分块传输)的响应体，连接断开时按policy重连，
+// 直到handler返回nil(流正常结束)、ErrStopStream或不是连接断开引起的错误，或ctx结束。
+// 请求通过客户端发送，使用代理和请求头等配置，但不受SetTimeout整体超时的限制。
+// 响应状态码不是2xx时按ClassifyRetry判断是否重连，不可重试时返回*StatusError
+// 参数:
+//   - ctx: 结束接收的上下文，结束时返回ctx.Err()
+//   - req: 请求，有请求体时需要能够通过GetBody重新获取
+//   - policy: 重连策略
+//   - handler: 处理响应的函数
+func (r *GoProxy) Stream(ctx context.Context, req *http.Request, policy ReconnectPolicy, handler StreamHandler) error {
+	return r.stream(ctx, req, policy, func(resp *http.Response, next *http.Request) (bool, bool, time.Duration, error) {
+		body := &streamBody{ReadCloser: resp.Body}
+		resp.Body = body
+		err := handler(resp, next)
+		return body.received, err != nil, 0, err
+	})
+}
+
+// streamBody 记录是否读取到数据的响应体
+type streamBody struct {
+	io.ReadCloser
+	received bool
+}
+
+func (b *streamBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.received = true
+	}
+	return n, err
+}
+
+// streamFunc 处理一次连接的响应，返回连接上是否收到了数据、是否应该重连、
+// 服务器要求的重连等待时间(为0时按退避策略)以及出现的错误
+type streamFunc func(resp *http.Response, next *http.Request) (received, reconnect bool, wait time.Duration, err error)
+
+// stream Stream和SubscribeEvents共用的重连循环
+func (r *GoProxy) stream(ctx context.Context, req *http.Request, policy ReconnectPolicy, fn streamFunc) error {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return errors.New("流式请求的请求体无法重新获取")
+	}
+	retry := policy.retryPolicy()
+	attempt := 0
+	for {
+		next, err := rewindRequest(req)
+		if err != nil {
+			return err
+		}
+		next = next.Clone(ctx)
+		var wait time.Duration
+		resp, err := r.doStream(next)
+		switch {
+		case err != nil:
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if ClassifyRetry(nil, err) == RetryNever {
+				return err
+			}
+		case resp.StatusCode/100 != 2:
+			se, _ := newStatusError(next, resp, statusErrorBodyLimit)
+			resp.Body.Close()
+			if ClassifyRetry(resp, nil) == RetryNever {
+				return se
+			}
+			wait, err = retryAfter(resp, 0, retry.maxBackoff()), se
+		default:
+			req = next
+			var received, reconnect bool
+			received, reconnect, wait, err = fn(resp, next)
+			resp.Body.Close()
+			if received {
+				// 连接上收到了数据后重新计算连续重连的次数，
+				// 只建立连接而没有数据的连接(如服务器立即关闭)仍然计入，以免无限重连
+				attempt = 0
+			}
+			switch {
+			case errors.Is(err, ErrStopStream):
+				return nil
+			case ctx.Err() != nil:
+				return ctx.Err()
+			case !reconnect:
+				return err
+			case err == nil:
+				// 服务器正常关闭了连接
+				err = io.EOF
+			case !IsTemporary(err):
+				return err
+			}
+		}
+		attempt++
+		if policy.MaxAttempts > 0 && attempt > policy.MaxAttempts {
+			return fmt.Errorf("重连%d次后仍然失败: %w", policy.MaxAttempts, err)
+		}
+		if policy.OnDisconnect != nil {
+			policy.OnDisconnect(err, attempt)
+		}
+		if wait <= 0 {
+			wait = retry.backoff(attempt - 1)
+		}
+		if err := sleepContext(ctx, wait); err != nil {
+			return err
+		}
+	}
+}
+
+// doStream 与Do相同，但不受客户端整体超时(SetTimeout)的限制，用于长时间读取的流式响应
+func (r *GoProxy) doStream(req *http.Request) (*http.Response, error) {
+	r.mu.Lock()
+	client := *r.client
+	r.mu.Unlock()
+	client.Timeout = 0
+	return r.send(&client, req)
+}
+
+// Event 服务器推送事件(SSE)
+type Event struct {
+	ID    string        // 事件ID，重连时作为Last-Event-ID发送
+	Event string        // 事件类型，未指定时为"message"
+	Data  string        // 事件数据，多行data以换行连接
+	Retry time.Duration // 服务器通过retry字段要求的重连等待时间，没有时为0
+}
+
+// SubscribeEvents 订阅服务器推送事件(text/event-stream)，对每个事件调用fn，连接断开或服务器关闭连接时按policy重连，
+// 重连时通过Last-Event-ID请求头携带最后收到的事件ID以便服务器补发(服务器发送空的id字段时不再携带)，
+// 服务器通过retry字段指定的等待时间优先于policy。
+// fn返回ErrStopStream时返回nil，返回其他错误时结束并返回该错误；ctx结束时返回ctx.Err()
+// 参数:
+//   - ctx: 结束订阅的上下文
+//   - req: 订阅请求，自动设置Accept: text/event-stream
+//   - policy: 重连策略
+//   - fn: 处理事件的函数
+func (r *GoProxy) SubscribeEvents(ctx context.Context, req *http.Request, policy ReconnectPolicy, fn func(Event) error) error {
+	var retry time.Duration
+	req = req.Clone(ctx)
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Cache-Control", "no-cache")
+	lastID := req.Header.Get("Last-Event-ID")
+	return r.stream(ctx, req, policy, func(resp *http.Response, next *http.Request) (bool, bool, time.Duration, error) {
+		received := false
+		err := readEvents(resp.Body, &lastID, func(ev Event) error {
+			received = true
+			if lastID != "" {
+				next.Header.Set("Last-Event-ID", lastID)
+			} else {
+				next.Header.Del("Last-Event-ID")
+			}
+			if ev.Retry > 0 {
+				retry = ev.Retry
+			}
+			if ev.Data == "" && ev.Event == "" {
+				// 只有id或retry字段的事件不分发
+				return nil
+			}
+			return fn(ev)
+		})
+		// 服务器关闭连接后同样重连
+		return received, true, retry, err
+	})
+}
+
+// readEvents 按SSE格式解析事件流并逐个回调，回调返回错误时停止。
+// lastID为最后的事件ID，事件带有id字段时在回调前更新，id字段为空时清空
+func readEvents(body io.Reader, lastID *string, fn func(Event) error) error {
+	br := bufio.NewReader(body)
+	var ev Event
+	var data []string
+	hasData, hasID := false, false
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				// 未以空行结束的事件不分发
+				return nil
+			}
+			return err
+		}
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+		if line == "" {
+			if hasID {
+				*lastID = ev.ID
+			}
+			if hasData || hasID || ev.Retry > 0 {
+				ev.Data = strings.Join(data, "\n")
+				if ev.Event == "" && hasData {
+					ev.Event = "message"
+				}
+				if err := fn(ev); err != nil {
+					return err
+				}
+			}
+			ev, data, hasData, hasID = Event{}, nil, false, false
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			ev.Event = value
+		case "data":
+			data, hasData = append(data, value), true
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				ev.ID, hasID = value, true
+			}
+		case "retry":
+			if ms, err := strconv.Atoi(value); err == nil && ms >= 0 {
+				ev.Retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+}
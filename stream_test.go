@@ -0,0 +1,244 @@
+package goproxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGoProxy_SubscribeEvents(t *testing.T) {
+	var requests atomic.Int32
+	var lastID atomic.Value
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") != "text/event-stream" {
+			t.Errorf("Accept为%q", r.Header.Get("Accept"))
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		switch requests.Add(1) {
+		case 1:
+			fmt.Fprint(w, ": comment\nid: 1\ndata: a\n\nid: 2\nevent: update\ndata: b1\ndata: b2\n\nretry: 5\n\n")
+		default:
+			lastID.Store(r.Header.Get("Last-Event-ID"))
+			fmt.Fprint(w, "id: 3\r\ndata: c\r\n\r\n")
+		}
+	}))
+	defer srv.Close()
+
+	c := New()
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	var events []Event
+	var disconnects []int
+	policy := ReconnectPolicy{
+		Backoff:      time.Hour,
+		OnDisconnect: func(err error, attempt int) { disconnects = append(disconnects, attempt) },
+	}
+	err := c.SubscribeEvents(context.Background(), req, policy, func(ev Event) error {
+		events = append(events, ev)
+		if ev.ID == "3" {
+			return ErrStopStream
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Event{
+		{ID: "1", Event: "message", Data: "a"},
+		{ID: "2", Event: "update", Data: "b1\nb2"},
+		{ID: "3", Event: "message", Data: "c"},
+	}
+	if fmt.Sprint(events) != fmt.Sprint(want) {
+		t.Errorf("事件为%v，应为%v", events, want)
+	}
+	if lastID.Load() != "2" {
+		t.Errorf("重连时Last-Event-ID为%v", lastID.Load())
+	}
+	if fmt.Sprint(disconnects) != "[1]" {
+		t.Errorf("OnDisconnect的调用为%v", disconnects)
+	}
+}
+
+func TestGoProxy_SubscribeEventsResetID(t *testing.T) {
+	var requests atomic.Int32
+	var lastIDs []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		n := requests.Add(1)
+		lastIDs = append(lastIDs, r.Header.Get("Last-Event-ID"))
+		switch n {
+		case 1:
+			fmt.Fprint(w, "id: 1\ndata: a\n\nid:\ndata: b\n\n")
+		default:
+			fmt.Fprint(w, "data: c\n\n")
+		}
+	}))
+	defer srv.Close()
+
+	c := New()
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	req.Header.Set("Last-Event-ID", "0")
+	err := c.SubscribeEvents(context.Background(), req, ReconnectPolicy{Backoff: time.Millisecond}, func(ev Event) error {
+		if ev.Data == "c" {
+			return ErrStopStream
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 首次请求携带调用方设置的ID，服务器发送空的id字段后重连时不再携带
+	if fmt.Sprintf("%q", lastIDs) != `["0" ""]` {
+		t.Errorf("各次请求的Last-Event-ID为%q", lastIDs)
+	}
+}
+
+func TestGoProxy_StreamNoEvents(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 建立连接后不发送任何数据就关闭
+		requests.Add(1)
+		w.Header().Set("Content-Type", "text/event-stream")
+		if r.URL.Query().Has("truncated") {
+			w.Header().Set("Content-Length", "10")
+		}
+	}))
+	defer srv.Close()
+
+	c := New()
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	policy := ReconnectPolicy{MaxAttempts: 2, Backoff: time.Millisecond}
+	err := c.SubscribeEvents(context.Background(), req, policy, func(Event) error { return nil })
+	if err == nil || requests.Load() != 3 {
+		t.Errorf("错误为%v，请求了%d次", err, requests.Load())
+	}
+	requests.Store(0)
+	req, _ = http.NewRequest(http.MethodGet, srv.URL+"?truncated", nil)
+	err = c.Stream(context.Background(), req, policy, func(resp *http.Response, next *http.Request) error {
+		_, err := io.Copy(io.Discard, resp.Body)
+		return err
+	})
+	if err == nil || requests.Load() != 3 {
+		t.Errorf("错误为%v，请求了%d次", err, requests.Load())
+	}
+}
+
+func TestGoProxy_StreamResume(t *testing.T) {
+	const data = "0123456789"
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		if requests.Add(1) == 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		// 声明完整长度但只写出一部分，模拟连接中断
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)-offset))
+		end := min(offset+4, len(data))
+		w.Write([]byte(data[offset:end]))
+	}))
+	defer srv.Close()
+
+	c := New()
+	c.SetTimeout(time.Second)
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/stream?offset=0", nil)
+	var got strings.Builder
+	var errs []error
+	policy := ReconnectPolicy{
+		MaxAttempts:  3,
+		Backoff:      time.Millisecond,
+		OnDisconnect: func(err error, attempt int) { errs = append(errs, err) },
+	}
+	err := c.Stream(context.Background(), req, policy, func(resp *http.Response, next *http.Request) error {
+		_, err := io.Copy(&got, resp.Body)
+		q := next.URL.Query()
+		q.Set("offset", strconv.Itoa(got.Len()))
+		next.URL.RawQuery = q.Encode()
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != data {
+		t.Errorf("读取到%q", got.String())
+	}
+	if len(errs) != 3 || !errors.Is(errs[0], io.ErrUnexpectedEOF) || !errors.Is(errs[1], ErrUnexpectedStatus) {
+		t.Errorf("断开的原因为%v", errs)
+	}
+}
+
+func TestGoProxy_StreamGiveUp(t *testing.T) {
+	var requests atomic.Int32
+	var status atomic.Int32
+	status.Store(http.StatusServiceUnavailable)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer srv.Close()
+
+	c := New()
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	handler := func(resp *http.Response, next *http.Request) error {
+		t.Error("不应调用handler")
+		return nil
+	}
+	err := c.Stream(context.Background(), req, ReconnectPolicy{MaxAttempts: 2, Backoff: time.Millisecond}, handler)
+	var se *StatusError
+	if !errors.As(err, &se) || se.StatusCode != int(status.Load()) || requests.Load() != 3 {
+		t.Errorf("错误为%v，请求了%d次", err, requests.Load())
+	}
+
+	// 不可重试的状态码不重连
+	status.Store(http.StatusNotFound)
+	requests.Store(0)
+	err = c.Stream(context.Background(), req, ReconnectPolicy{Backoff: time.Millisecond}, handler)
+	if !errors.As(err, &se) || se.StatusCode != int(status.Load()) || requests.Load() != 1 {
+		t.Errorf("错误为%v，请求了%d次", err, requests.Load())
+	}
+
+	// 上下文结束时停止重连
+	status.Store(http.StatusServiceUnavailable)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = c.Stream(ctx, req, ReconnectPolicy{Backoff: 10 * time.Millisecond}, handler)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("错误为%v", err)
+	}
+}
+
+func TestReadEvents(t *testing.T) {
+	input := "data\n\nevent: ping\n\ndata:x\ndata:  y\nid: 7\n\nid: 8\nretry: 1500\n\ndata: partial"
+	var got []Event
+	lastID := "1"
+	if err := readEvents(strings.NewReader(input), &lastID, func(ev Event) error {
+		got = append(got, ev)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	want := []Event{
+		{Event: "message"},
+		{ID: "7", Event: "message", Data: "x\n y"},
+		{ID: "8", Retry: 1500 * time.Millisecond},
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("事件为%v，应为%v", got, want)
+	}
+	if lastID != "8" {
+		t.Errorf("最后的事件ID为%q", lastID)
+	}
+
+	// 空的id字段清空最后的事件ID
+	readEvents(strings.NewReader("id\ndata: x\n\n"), &lastID, func(Event) error { return nil })
+	if lastID != "" {
+		t.Errorf("空的id字段后最后的事件ID为%q", lastID)
+	}
+}
@@ -0,0 +1,45 @@
+package goproxy
+
+import (
+	"net"
+)
+
+// SetTCPKeepAlive 设置直接连接目标和连接代理服务器时TCP keepalive的参数，为nil时使用Go的默认值(15秒)
+// 部分代理会静默丢弃长时间空闲的隧道，开启keepalive并缩短间隔可以及时发现并避免这种情况；
+// Enable为false时关闭keepalive，字段为0时使用默认值，为负数时保留系统设置
+func (r *GoProxy) SetTCPKeepAlive(cfg *net.KeepAliveConfig) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if cfg != nil {
+		c := *cfg
+		cfg = &c
+	}
+	r.keepAlive = cfg
+	r.closeIdleConns()
+}
+
+// SetTCPNoDelay 设置TCP连接是否禁用Nagle算法，默认禁用(与Go一致)
+// 开启Nagle算法可以合并小包，以延迟换取更少的报文
+func (r *GoProxy) SetTCPNoDelay(noDelay bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nagle = !noDelay
+	r.closeIdleConns()
+}
+
+// tuneTCP 将TCP选项应用到新建立的连接，非TCP连接保持不变
+func (p dialPlan) tuneTCP(conn net.Conn) error {
+	tcp, ok := conn.(*net.TCPConn)
+	if !ok {
+		return nil
+	}
+	if p.keepAlive != nil {
+		if err := tcp.SetKeepAliveConfig(*p.keepAlive); err != nil {
+			return err
+		}
+	}
+	if p.nagle {
+		return tcp.SetNoDelay(false)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package goproxy
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestGoProxy_TCPOptions(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer srv.Close()
+
+	c := New()
+	c.SetTCPKeepAlive(&net.KeepAliveConfig{Enable: true, Idle: 5 * time.Second, Interval: 5 * time.Second, Count: 3})
+	c.SetTCPNoDelay(false)
+	if got := getBody(t, c, srv.URL); got != "ok" {
+		t.Errorf("响应为%q", got)
+	}
+	c.SetTCPKeepAlive(&net.KeepAliveConfig{Enable: false})
+	c.SetTCPNoDelay(true)
+	if got := getBody(t, c, srv.URL); got != "ok" {
+		t.Errorf("响应为%q", got)
+	}
+
+	// 非TCP连接不受影响
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+	p := dialPlan{keepAlive: &net.KeepAliveConfig{Enable: true}, nagle: true}
+	if err := p.tuneTCP(a); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,167 @@
+package goproxy
+
+import (
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// minThrottleChunk 限速时单次读写的最小字节数
+const minThrottleChunk = 512
+
+// rateLimiter 基于令牌桶的字节速率限制器，桶容量为一秒的配额
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   int64 // 每秒允许的字节数，<=0表示不限速
+	tokens float64
+	last   time.Time
+}
+
+// setRate 修改限速值，对使用该限制器的已有连接立即生效
+func (l *rateLimiter) setRate(bps int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rate = bps
+	l.tokens = 0
+	l.last = time.Now()
+}
+
+// getRate 返回当前限速值
+func (l *rateLimiter) getRate() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rate
+}
+
+// chunk 返回单次读写允许的最大字节数，避免一次读写过多数据导致长时间阻塞
+func (l *rateLimiter) chunk(n int) int {
+	rate := l.getRate()
+	if rate <= 0 {
+		return n
+	}
+	size := int(rate / 4)
+	if size < minThrottleChunk {
+		size = minThrottleChunk
+	}
+	if n > size {
+		return size
+	}
+	return n
+}
+
+// wait 消耗n个字节的配额，配额不足时阻塞直到补足
+// 并发调用时各自预支配额，等待时间会依次累加，总速率不超过限速值
+func (l *rateLimiter) wait(n int) {
+	l.mu.Lock()
+	if l.rate <= 0 {
+		l.mu.Unlock()
+		return
+	}
+	now := time.Now()
+	rate := float64(l.rate)
+	l.tokens += now.Sub(l.last).Seconds() * rate
+	if l.tokens > rate {
+		l.tokens = rate
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	var d time.Duration
+	if l.tokens < 0 {
+		d = time.Duration(-l.tokens / rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+	if d > 0 {
+		time.Sleep(d)
+	}
+}
+
+// bandwidthLimiter 下载和上传两个方向的限速器
+type bandwidthLimiter struct {
+	down rateLimiter
+	up   rateLimiter
+}
+
+func newBandwidthLimiter() *bandwidthLimiter {
+	return &bandwidthLimiter{}
+}
+
+// wrapConn 包装连接，使连接上的读写受限速器控制
+func (b *bandwidthLimiter) wrapConn(conn net.Conn) net.Conn {
+	if b == nil {
+		return conn
+	}
+	return &throttledConn{Conn: conn, limiter: b}
+}
+
+// throttledConn 受带宽限制的连接，读对应下载，写对应上传
+type throttledConn struct {
+	net.Conn
+	limiter *bandwidthLimiter
+}
+
+func (c *throttledConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b[:c.limiter.down.chunk(len(b))])
+	if n > 0 {
+		c.limiter.down.wait(n)
+	}
+	return n, err
+}
+
+func (c *throttledConn) Write(b []byte) (int, error) {
+	var written int
+	for written < len(b) {
+		size := c.limiter.up.chunk(len(b) - written)
+		c.limiter.up.wait(size)
+		n, err := c.Conn.Write(b[written : written+size])
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// throttledReader 受限速器控制的ReadCloser，用于单次请求的请求体和响应体
+type throttledReader struct {
+	rc      io.ReadCloser
+	limiter *rateLimiter
+}
+
+func (r *throttledReader) Read(b []byte) (int, error) {
+	n, err := r.rc.Read(b[:r.limiter.chunk(len(b))])
+	if n > 0 {
+		r.limiter.wait(n)
+	}
+	return n, err
+}
+
+func (r *throttledReader) Close() error {
+	return r.rc.Close()
+}
+
+// SetBandwidthLimit 设置客户端级别的带宽限制，单位为字节/秒
+// 限制作用在连接层面，客户端的所有连接共享同一配额，对已建立的连接同样生效
+// 参数:
+//   - downloadBps: 下载速率上限，<=0表示不限速
+//   - uploadBps: 上传速率上限，<=0表示不限速
+func (r *GoProxy) SetBandwidthLimit(downloadBps, uploadBps int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.bandwidth.down.setRate(downloadBps)
+	r.bandwidth.up.setRate(uploadBps)
+}
+
+// GetBandwidthLimit 获取客户端级别的带宽限制，单位为字节/秒
+func (r *GoProxy) GetBandwidthLimit() (downloadBps, uploadBps int64) {
+	return r.bandwidth.down.getRate(), r.bandwidth.up.getRate()
+}
+
+// WithBandwidthLimit 设置单次请求的带宽限制，单位为字节/秒，<=0表示该方向不限速
+// 与客户端级别的限制同时生效，实际速率取两者中较小的一个
+func WithBandwidthLimit(downloadBps, uploadBps int64) RequestOption {
+	return func(o *requestOptions) {
+		o.downloadBps = downloadBps
+		o.uploadBps = uploadBps
+	}
+}
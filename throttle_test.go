@@ -0,0 +1,56 @@
+package goproxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGoProxy_SetBandwidthLimit(t *testing.T) {
+	body := strings.Repeat("a", 64*1024)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, body)
+	}))
+	defer srv.Close()
+
+	c := New()
+	c.SetBandwidthLimit(64*1024, 0)
+	if down, up := c.GetBandwidthLimit(); down != 64*1024 || up != 0 {
+		t.Fatalf("限速值错误: %d %d", down, up)
+	}
+	start := time.Now()
+	resp, err := c.GetClient().Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	// 首秒配额为0，64KB在64KB/s的限速下至少需要约1秒
+	if elapsed := time.Since(start); elapsed < 800*time.Millisecond {
+		t.Errorf("限速未生效，耗时%v", elapsed)
+	}
+}
+
+func TestWithBandwidthLimit(t *testing.T) {
+	body := strings.Repeat("a", 32*1024)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, body)
+	}))
+	defer srv.Close()
+
+	c := New()
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	start := time.Now()
+	resp, err := c.Do(req, WithBandwidthLimit(32*1024, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if elapsed := time.Since(start); elapsed < 800*time.Millisecond {
+		t.Errorf("单次请求限速未生效，耗时%v", elapsed)
+	}
+}
@@ -0,0 +1,79 @@
+package goproxy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// errResponseHeaderTimeout 超过SetResponseHeaderTimeout设置的时间仍未收到响应头
+var errResponseHeaderTimeout = errors.New("等待响应头超时")
+
+// SetDialTimeout 设置建立连接的超时时间，包括连接代理服务器和建立CONNECT/SOCKS5隧道，不包括TLS握手，为0时不限制
+// 与SetTimeout设置的整体超时相互独立，可在不限制下载耗时的情况下快速放弃无法连接的目标
+func (r *GoProxy) SetDialTimeout(timeout time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.dialTimeout = timeout
+}
+
+// SetTLSHandshakeTimeout 设置TLS握手的超时时间，包括与HTTPS代理服务器的握手，为0时不限制
+func (r *GoProxy) SetTLSHandshakeTimeout(timeout time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tlsHandshakeTimeout = timeout
+}
+
+// SetResponseHeaderTimeout 设置发送完请求后等待响应头的超时时间，不包括读取响应体，为0时不限制
+func (r *GoProxy) SetResponseHeaderTimeout(timeout time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.transport.Transport.ResponseHeaderTimeout = timeout
+}
+
+// withDialTimeout 按SetDialTimeout限制ctx，cancel必须被调用
+func (r *GoProxy) withDialTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	r.mu.Lock()
+	timeout := r.dialTimeout
+	r.mu.Unlock()
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// withHandshakeTimeout 按SetTLSHandshakeTimeout限制ctx，cancel必须被调用
+func (r *GoProxy) withHandshakeTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	r.mu.Lock()
+	timeout := r.tlsHandshakeTimeout
+	r.mu.Unlock()
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// roundTripHeaderTimeout 通过rt发送req，超过timeout仍未收到响应头时取消请求
+// Transport自身支持ResponseHeaderTimeout，该函数用于uTLS HTTP/2、h2c等独立的RoundTripper
+func roundTripHeaderTimeout(rt http.RoundTripper, req *http.Request, timeout time.Duration) (*http.Response, error) {
+	ctx, cancel := context.WithCancelCause(req.Context())
+	timer := time.AfterFunc(timeout, func() { cancel(errResponseHeaderTimeout) })
+	resp, err := rt.RoundTrip(req.WithContext(ctx))
+	if !timer.Stop() {
+		if err == nil {
+			resp.Body.Close()
+		}
+		cancel(nil)
+		if err == http.ErrSkipAltProtocol {
+			return nil, err
+		}
+		return nil, errResponseHeaderTimeout
+	}
+	if err != nil {
+		cancel(nil)
+		return nil, err
+	}
+	resp.Body = &onCloseBody{ReadCloser: resp.Body, onClose: func() { cancel(nil) }}
+	return resp, nil
+}
@@ -0,0 +1,76 @@
+package goproxy
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGoProxy_SetTLSHandshakeTimeout(t *testing.T) {
+	// 接受连接但从不响应ClientHello的服务器
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	c := New()
+	c.SetTLSHandshakeTimeout(100 * time.Millisecond)
+	start := time.Now()
+	if _, err := c.GetClient().Get("https://" + ln.Addr().String()); err == nil {
+		t.Fatal("握手超时应返回错误")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("握手超时未生效, 耗时%v", elapsed)
+	}
+}
+
+func TestGoProxy_SetResponseHeaderTimeout(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(300 * time.Millisecond)
+		}
+		w.(http.Flusher).Flush()
+		// 响应头发出后响应体较慢不受影响
+		time.Sleep(100 * time.Millisecond)
+		io.WriteString(w, "ok")
+	})
+	srv := httptest.NewUnstartedServer(handler)
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	c := New()
+	c.SetResponseHeaderTimeout(50 * time.Millisecond)
+	c.SetDialTimeout(time.Second)
+	check := func(name string) {
+		if got := getBody(t, c, srv.URL+"/fast"); got != "ok" {
+			t.Errorf("%s: 响应为%q", name, got)
+		}
+		_, err := c.GetClient().Get(srv.URL + "/slow")
+		if err == nil || !strings.Contains(err.Error(), "timeout") && !errors.Is(err, errResponseHeaderTimeout) {
+			t.Errorf("%s: 等待响应头超时返回%v", name, err)
+		}
+	}
+	check("HTTP/1.1")
+	// 使用TLS指纹的HTTP/2请求由独立的RoundTripper发送
+	c.EnableHTTP2(true)
+	if err := c.SetTLSFingerprint(FingerprintChrome); err != nil {
+		t.Fatal(err)
+	}
+	check("uTLS HTTP/2")
+}
@@ -0,0 +1,379 @@
+package goproxy
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+)
+
+// updateTLSConfig 复制当前TLS配置，修改后整体替换
+// 避免直接修改Transport正在使用的配置对象，同时关闭空闲连接使新配置对后续请求生效
+func (r *GoProxy) updateTLSConfig(fn func(cfg *tls.Config)) {
+	ct := r.transport
+	cfg := ct.Transport.TLSClientConfig.Clone()
+	if cfg == nil {
+		cfg = &tls.Config{}
+	}
+	fn(cfg)
+	ct.Transport.TLSClientConfig = cfg
+	r.closeIdleConns()
+}
+
+// SetTLSVerify 设置是否校验目标服务器的证书
+// 注意: 为兼容旧版本，New创建的客户端默认不校验证书(InsecureSkipVerify)，
+// 访问公网或敏感服务时应调用SetTLSVerify(true)开启校验
+func (r *GoProxy) SetTLSVerify(verify bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.updateTLSConfig(func(cfg *tls.Config) {
+		cfg.InsecureSkipVerify = !verify
+	})
+}
+
+// GetTLSVerify 获取是否校验目标服务器的证书
+func (r *GoProxy) GetTLSVerify() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cfg := r.transport.Transport.TLSClientConfig
+	return cfg == nil || !cfg.InsecureSkipVerify
+}
+
+// SetRootCAs 设置校验服务器证书使用的根证书池，为nil时使用系统根证书
+func (r *GoProxy) SetRootCAs(pool *x509.CertPool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.updateTLSConfig(func(cfg *tls.Config) {
+		cfg.RootCAs = pool
+	})
+}
+
+// LoadCAFile 从PEM文件加载CA证书并加入根证书池
+// 尚未设置根证书池时以系统根证书为基础，因此加载内部CA后仍可访问公网站点。
+// 该方法不会改变校验开关，需配合SetTLSVerify(true)使用
+func (r *GoProxy) LoadCAFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("读取CA证书文件失败: %w", err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var appendErr error
+	r.updateTLSConfig(func(cfg *tls.Config) {
+		pool := cfg.RootCAs
+		if pool == nil {
+			if pool, err = x509.SystemCertPool(); err != nil {
+				pool = x509.NewCertPool()
+			}
+		} else {
+			pool = pool.Clone()
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			appendErr = fmt.Errorf("CA证书文件中没有有效的PEM证书: %s", path)
+			return
+		}
+		cfg.RootCAs = pool
+	})
+	return appendErr
+}
+
+// tlsConfigForHost 生成连接host时使用的TLS配置
+// 以按主机配置的TLS配置(没有时为Transport.TLSClientConfig)为基础，
+// 依次应用按主机和单次请求配置的SNI，以及按主机配置的客户端证书
+func (r *GoProxy) tlsConfigForHost(ctx context.Context, host string) *tls.Config {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cfg := r.transport.Transport.TLSClientConfig.Clone()
+	if hostCfg, ok := lookupHost(r.hostTLS, host); ok {
+		cfg = hostCfg.Clone()
+	}
+	if cfg == nil {
+		cfg = &tls.Config{}
+	}
+	if sni, ok := lookupHost(r.sniOverrides, host); ok {
+		cfg.ServerName = sni
+	}
+	if o, _ := ctx.Value(requestOptionsKey{}).(*requestOptions); o != nil && o.serverName != "" {
+		cfg.ServerName = o.serverName
+	}
+	if cfg.ServerName == "" {
+		cfg.ServerName = host
+	}
+	// SNI和证书校验使用punycode形式的域名
+	cfg.ServerName = asciiHostPort(cfg.ServerName)
+	if cert, ok := lookupHost(r.hostCerts, host); ok {
+		cfg.Certificates = []tls.Certificate{cert}
+		cfg.GetClientCertificate = nil
+	}
+	return cfg
+}
+
+// SetClientCertificate 设置双向TLS认证使用的客户端证书，对所有主机生效
+// 参数:
+//   - certPEM: PEM格式的证书(链)
+//   - keyPEM: PEM格式的私钥
+func (r *GoProxy) SetClientCertificate(certPEM, keyPEM []byte) error {
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return fmt.Errorf("解析客户端证书失败: %w", err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.updateTLSConfig(func(cfg *tls.Config) {
+		cfg.Certificates = []tls.Certificate{cert}
+	})
+	return nil
+}
+
+// LoadClientCertFile 从文件加载双向TLS认证使用的客户端证书，对所有主机生效
+func (r *GoProxy) LoadClientCertFile(certFile, keyFile string) error {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return fmt.Errorf("加载客户端证书失败: %w", err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.updateTLSConfig(func(cfg *tls.Config) {
+		cfg.Certificates = []tls.Certificate{cert}
+	})
+	return nil
+}
+
+// SetHostClientCertificate 为指定主机设置客户端证书，优先级高于全局客户端证书
+// 参数:
+//   - host: 主机名，支持"*.example.com"形式的通配符(匹配所有子域名)
+//   - certPEM: PEM格式的证书(链)
+//   - keyPEM: PEM格式的私钥
+func (r *GoProxy) SetHostClientCertificate(host string, certPEM, keyPEM []byte) error {
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return fmt.Errorf("解析客户端证书失败: %w", err)
+	}
+	r.setHostClientCert(host, cert)
+	return nil
+}
+
+// LoadHostClientCertFile 从文件加载指定主机使用的客户端证书，host规则同SetHostClientCertificate
+func (r *GoProxy) LoadHostClientCertFile(host, certFile, keyFile string) error {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return fmt.Errorf("加载客户端证书失败: %w", err)
+	}
+	r.setHostClientCert(host, cert)
+	return nil
+}
+
+// DelHostClientCertificate 删除指定主机的客户端证书
+func (r *GoProxy) DelHostClientCertificate(host string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.hostCerts, normalizeHost(host))
+	r.closeIdleConns()
+}
+
+func (r *GoProxy) setHostClientCert(host string, cert tls.Certificate) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.hostCerts == nil {
+		r.hostCerts = make(map[string]tls.Certificate)
+	}
+	r.hostCerts[normalizeHost(host)] = cert
+	r.closeIdleConns()
+}
+
+// lookupHost 按主机名查找配置，精确匹配优先，其次是最长的通配符后缀匹配
+// 通配符"*.example.com"匹配a.example.com和a.b.example.com，但不匹配example.com；
+// 国际化域名按punycode形式匹配，规则和host使用Unicode或punycode写法均可
+func lookupHost[T any](m map[string]T, host string) (T, bool) {
+	var zero T
+	if len(m) == 0 {
+		return zero, false
+	}
+	host = normalizeHost(host)
+	if v, ok := m[host]; ok {
+		return v, true
+	}
+	best := -1
+	var found T
+	for pattern, v := range m {
+		if !strings.HasPrefix(pattern, "*.") {
+			continue
+		}
+		suffix := pattern[1:]
+		if strings.HasSuffix(host, suffix) && len(suffix) > best {
+			best = len(suffix)
+			found = v
+		}
+	}
+	return found, best >= 0
+}
+
+// SetTLSMinVersion 设置允许的最低TLS版本，如tls.VersionTLS12
+func (r *GoProxy) SetTLSMinVersion(version uint16) error {
+	if err := checkTLSVersion(version); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.updateTLSConfig(func(cfg *tls.Config) {
+		cfg.MinVersion = version
+	})
+	return nil
+}
+
+// SetTLSMaxVersion 设置允许的最高TLS版本，如tls.VersionTLS13
+func (r *GoProxy) SetTLSMaxVersion(version uint16) error {
+	if err := checkTLSVersion(version); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.updateTLSConfig(func(cfg *tls.Config) {
+		cfg.MaxVersion = version
+	})
+	return nil
+}
+
+// SetCipherSuites 设置TLS 1.0-1.2可用的密码套件，为空时使用Go的默认列表
+// TLS 1.3的密码套件不可配置。包含未知的套件ID时返回错误
+func (r *GoProxy) SetCipherSuites(suites []uint16) error {
+	known := make(map[uint16]bool)
+	for _, s := range tls.CipherSuites() {
+		known[s.ID] = true
+	}
+	for _, s := range tls.InsecureCipherSuites() {
+		known[s.ID] = true
+	}
+	for _, id := range suites {
+		if !known[id] {
+			return fmt.Errorf("不支持的密码套件: 0x%04x", id)
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.updateTLSConfig(func(cfg *tls.Config) {
+		cfg.CipherSuites = append([]uint16(nil), suites...)
+	})
+	return nil
+}
+
+// checkTLSVersion 检查TLS版本号是否有效，0表示使用默认值
+func checkTLSVersion(version uint16) error {
+	switch version {
+	case 0, tls.VersionTLS10, tls.VersionTLS11, tls.VersionTLS12, tls.VersionTLS13:
+		return nil
+	default:
+		return fmt.Errorf("不支持的TLS版本: 0x%04x", version)
+	}
+}
+
+// SetSNIOverride 设置连接指定主机时TLS握手使用的SNI(ServerName)，
+// 与URL中的主机名及Host请求头相互独立，可用于域前置或测试基于SNI的路由。
+// 证书校验同样以该名称为准
+// 参数:
+//   - host: 目标主机名，支持"*.example.com"形式的通配符
+//   - serverName: 握手时发送的SNI，为空时删除该主机的设置
+func (r *GoProxy) SetSNIOverride(host, serverName string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	host = normalizeHost(host)
+	if serverName == "" {
+		delete(r.sniOverrides, host)
+	} else {
+		if r.sniOverrides == nil {
+			r.sniOverrides = make(map[string]string)
+		}
+		r.sniOverrides[host] = serverName
+	}
+	r.closeIdleConns()
+}
+
+// WithServerName 设置单次请求TLS握手使用的SNI，优先级高于SetSNIOverride
+// 设置后该请求使用独立的连接，不会复用或被复用
+func WithServerName(serverName string) RequestOption {
+	return func(o *requestOptions) {
+		o.serverName = serverName
+	}
+}
+
+// EnvSSLKeyLogFile 记录TLS会话密钥的环境变量名，与浏览器和curl的约定一致
+const EnvSSLKeyLogFile = "SSLKEYLOGFILE"
+
+// SetTLSKeyLogWriter 设置TLS会话密钥的输出位置(NSS Key Log格式)，为nil时关闭
+// 经由代理抓取的流量可以配合该文件在Wireshark中解密，仅应在调试时使用
+func (r *GoProxy) SetTLSKeyLogWriter(w io.Writer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.updateTLSConfig(func(cfg *tls.Config) {
+		cfg.KeyLogWriter = w
+	})
+}
+
+// EnableKeyLogFromEnv 环境变量SSLKEYLOGFILE非空时，将TLS会话密钥追加写入该文件
+// 返回打开的文件，调用方负责在不再需要时关闭；环境变量为空时返回nil
+func (r *GoProxy) EnableKeyLogFromEnv() (io.Closer, error) {
+	path := os.Getenv(EnvSSLKeyLogFile)
+	if path == "" {
+		return nil, nil
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("打开密钥日志文件失败: %w", err)
+	}
+	r.SetTLSKeyLogWriter(f)
+	return f, nil
+}
+
+// SetHostTLSConfig 为指定主机设置独立的TLS配置，连接匹配的主机时完全替代全局TLS配置
+// 例如只对"*.internal"跳过证书校验，或只对api.bank.com启用证书固定。
+// 配置在建立连接时解析，cfg会被复制，之后对cfg的修改不会生效
+// 参数:
+//   - host: 主机名，支持"*.example.com"形式的通配符
+//   - cfg: TLS配置，为nil时删除该主机的配置
+func (r *GoProxy) SetHostTLSConfig(host string, cfg *tls.Config) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	host = normalizeHost(host)
+	if cfg == nil {
+		delete(r.hostTLS, host)
+	} else {
+		if r.hostTLS == nil {
+			r.hostTLS = make(map[string]*tls.Config)
+		}
+		r.hostTLS[host] = cfg.Clone()
+	}
+	r.closeIdleConns()
+}
+
+// PinSHA256 返回校验证书公钥固定值的函数，可赋给tls.Config.VerifyConnection
+// pins为证书SubjectPublicKeyInfo的SHA-256摘要(base64编码)，与HPKP及curl --pinnedpubkey使用的格式相同。
+// 证书链经过校验时，校验通过的链中任一证书(如中间CA)匹配即通过；未校验时(InsecureSkipVerify，客户端的默认值)
+// 服务器发来的链由服务器任意构造，只有服务器自身的证书匹配才通过
+func PinSHA256(pins ...string) func(tls.ConnectionState) error {
+	allowed := make(map[string]bool, len(pins))
+	for _, p := range pins {
+		allowed[strings.TrimPrefix(p, "sha256//")] = true
+	}
+	match := func(cert *x509.Certificate) bool {
+		sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+		return allowed[base64.StdEncoding.EncodeToString(sum[:])]
+	}
+	return func(cs tls.ConnectionState) error {
+		if len(cs.VerifiedChains) > 0 {
+			for _, chain := range cs.VerifiedChains {
+				if slices.ContainsFunc(chain, match) {
+					return nil
+				}
+			}
+		} else if len(cs.PeerCertificates) > 0 && match(cs.PeerCertificates[0]) {
+			return nil
+		}
+		return fmt.Errorf("服务器证书公钥与固定值不匹配: %s", cs.ServerName)
+	}
+}
@@ -0,0 +1,346 @@
+package goproxy
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGoProxy_TLSVerify(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	c := New()
+	if c.GetTLSVerify() {
+		t.Fatal("默认不应校验证书")
+	}
+	c.SetTLSVerify(true)
+	if _, err := c.GetClient().Get(srv.URL); err == nil {
+		t.Fatal("开启校验后自签名证书应校验失败")
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+	c.SetRootCAs(pool)
+	resp, err := c.GetClient().Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+}
+
+func TestGoProxy_LoadCAFile(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := New()
+	c.SetTLSVerify(true)
+	if err := c.LoadCAFile(path); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := c.GetClient().Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if err := c.LoadCAFile(filepath.Join(t.TempDir(), "missing.pem")); err == nil {
+		t.Error("文件不存在时应返回错误")
+	}
+}
+
+// newTestCA 生成测试用的自签名CA
+func newTestCA(t *testing.T) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return cert, key
+}
+
+// newTestClientCert 使用CA签发客户端证书，返回PEM格式的证书和私钥
+func newTestClientCert(t *testing.T, ca *x509.Certificate, caKey *ecdsa.PrivateKey, name string) ([]byte, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func TestGoProxy_ClientCertificate(t *testing.T) {
+	ca, caKey := newTestCA(t)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.TLS.PeerCertificates[0].Subject.CommonName)
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: pool}
+	srv.StartTLS()
+	defer srv.Close()
+
+	c := New()
+	if _, err := c.GetClient().Get(srv.URL); err == nil {
+		t.Fatal("未设置客户端证书时应握手失败")
+	}
+
+	certPEM, keyPEM := newTestClientCert(t, ca, caKey, "global")
+	if err := c.SetClientCertificate(certPEM, keyPEM); err != nil {
+		t.Fatal(err)
+	}
+	if name := getBody(t, c, srv.URL); name != "global" {
+		t.Errorf("期望使用全局证书，实际%s", name)
+	}
+
+	certPEM, keyPEM = newTestClientCert(t, ca, caKey, "host")
+	if err := c.SetHostClientCertificate("127.0.0.1", certPEM, keyPEM); err != nil {
+		t.Fatal(err)
+	}
+	if name := getBody(t, c, srv.URL); name != "host" {
+		t.Errorf("期望使用主机证书，实际%s", name)
+	}
+}
+
+func TestGoProxy_DelHostClientCertificate(t *testing.T) {
+	// 删除时与设置时同样规范化主机名，国际化域名、大小写和末尾的点不影响删除
+	c := New()
+	c.setHostClientCert("Bücher.example.", tls.Certificate{})
+	c.DelHostClientCertificate("XN--BCHER-KVA.example")
+	if len(c.hostCerts) != 0 {
+		t.Errorf("删除后仍有证书: %v", c.hostCerts)
+	}
+}
+
+func TestLookupHost(t *testing.T) {
+	m := map[string]int{"example.com": 1, "*.example.com": 2, "*.api.example.com": 3}
+	cases := map[string]int{"example.com": 1, "a.example.com": 2, "x.api.example.com": 3, "other.com": 0}
+	for host, want := range cases {
+		if got, _ := lookupHost(m, host); got != want {
+			t.Errorf("%s: 期望%d，实际%d", host, want, got)
+		}
+	}
+}
+
+func getBody(t *testing.T, c *GoProxy, url string) string {
+	t.Helper()
+	resp, err := c.GetClient().Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return string(body)
+}
+
+func TestGoProxy_TLSVersion(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.TLS = &tls.Config{MaxVersion: tls.VersionTLS12}
+	srv.StartTLS()
+	defer srv.Close()
+
+	c := New()
+	if err := c.SetTLSMinVersion(tls.VersionTLS13); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetClient().Get(srv.URL); err == nil {
+		t.Fatal("服务器只支持TLS 1.2时应握手失败")
+	}
+	if err := c.SetTLSMinVersion(tls.VersionTLS12); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetCipherSuites([]uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := c.GetClient().Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.TLS.CipherSuite != tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 {
+		t.Errorf("密码套件未生效: %s", tls.CipherSuiteName(resp.TLS.CipherSuite))
+	}
+
+	if err := c.SetTLSMaxVersion(0x9999); err == nil {
+		t.Error("非法版本应返回错误")
+	}
+	if err := c.SetCipherSuites([]uint16{0xffff}); err == nil {
+		t.Error("未知密码套件应返回错误")
+	}
+}
+
+func TestGoProxy_SNIOverride(t *testing.T) {
+	snis := make(chan string, 10)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.TLS = &tls.Config{GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		snis <- hello.ServerName
+		return nil, nil
+	}}
+	srv.StartTLS()
+	defer srv.Close()
+	url := strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)
+
+	c := New()
+	c.SetSNIOverride("localhost", "front.example.com")
+	getBody(t, c, url)
+	if sni := <-snis; sni != "front.example.com" {
+		t.Errorf("按主机SNI未生效: %q", sni)
+	}
+
+	req, _ := http.NewRequest("GET", url, nil)
+	resp, err := c.Do(req, WithServerName("request.example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if sni := <-snis; sni != "request.example.com" {
+		t.Errorf("单次请求SNI未生效: %q", sni)
+	}
+}
+
+func TestGoProxy_TLSKeyLog(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "keys.log")
+	t.Setenv(EnvSSLKeyLogFile, path)
+	for _, fp := range []TLSFingerprint{FingerprintGo, FingerprintChrome} {
+		c := New()
+		if err := c.SetTLSFingerprint(fp); err != nil {
+			t.Fatal(err)
+		}
+		closer, err := c.EnableKeyLogFromEnv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		getBody(t, c, srv.URL)
+		closer.Close()
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(data), "CLIENT_TRAFFIC_SECRET_0"); n != 2 {
+		t.Errorf("期望2条会话密钥，实际%d条:\n%s", n, data)
+	}
+}
+
+func TestGoProxy_SetHostTLSConfig(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	url := strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)
+
+	c := New()
+	c.SetTLSVerify(true)
+	if _, err := c.GetClient().Get(url); err == nil {
+		t.Fatal("全局开启校验时应握手失败")
+	}
+	c.SetHostTLSConfig("localhost", &tls.Config{InsecureSkipVerify: true})
+	getBody(t, c, url)
+	if _, err := c.GetClient().Get(srv.URL); err == nil {
+		t.Error("其他主机仍应使用全局配置")
+	}
+
+	sum := sha256.Sum256(srv.Certificate().RawSubjectPublicKeyInfo)
+	good := base64.StdEncoding.EncodeToString(sum[:])
+	c.SetHostTLSConfig("localhost", &tls.Config{InsecureSkipVerify: true, VerifyConnection: PinSHA256(good)})
+	getBody(t, c, url)
+	c.SetHostTLSConfig("localhost", &tls.Config{InsecureSkipVerify: true, VerifyConnection: PinSHA256("AAAA")})
+	if _, err := c.GetClient().Get(url); err == nil {
+		t.Error("公钥固定值不匹配时应握手失败")
+	}
+	if err := c.SetTLSFingerprint(FingerprintChrome); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetClient().Get(url); err == nil {
+		t.Error("使用TLS指纹时公钥固定同样应生效")
+	}
+}
+
+func TestPinSHA256_UntrustedChain(t *testing.T) {
+	pin := func(cert *x509.Certificate) string {
+		sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+		return base64.StdEncoding.EncodeToString(sum[:])
+	}
+	site := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer site.Close()
+	realCert := site.Certificate()
+
+	// 攻击者使用自己的证书，并在链的后面附上真实站点的证书
+	fake, fakeKey := newTestCA(t)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{{
+		Certificate: [][]byte{fake.Raw, realCert.Raw},
+		PrivateKey:  fakeKey,
+	}}}
+	srv.StartTLS()
+	defer srv.Close()
+
+	c := New()
+	c.SetHostTLSConfig("127.0.0.1", &tls.Config{InsecureSkipVerify: true, VerifyConnection: PinSHA256(pin(realCert))})
+	if _, err := c.GetClient().Get(srv.URL); err == nil {
+		t.Error("未校验的链中其他证书匹配时不应通过")
+	}
+	getBody(t, c, site.URL)
+
+	// 校验通过的链中的CA证书可以作为固定值
+	ca, _ := newTestCA(t)
+	verify := PinSHA256(pin(ca))
+	if err := verify(tls.ConnectionState{PeerCertificates: []*x509.Certificate{fake, ca}}); err == nil {
+		t.Error("未校验时只应匹配服务器证书")
+	}
+	if err := verify(tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{fake},
+		VerifiedChains:   [][]*x509.Certificate{{fake, ca}},
+	}); err != nil {
+		t.Errorf("校验通过的链中的CA匹配时应通过: %v", err)
+	}
+}
@@ -0,0 +1,102 @@
+package goproxy
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// SetOnTLSState 设置TLS握手完成后的回调，可用于记录证书等元数据而无需再建立一次连接
+// 回调参数:
+//   - addr: 连接的目标地址(host:port)
+//   - state: 连接状态；证书校验失败时HandshakeComplete为false，PeerCertificates为未经校验的证书链
+//
+// fn为nil时取消回调
+func (r *GoProxy) SetOnTLSState(fn func(addr string, state tls.ConnectionState)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onTLSState = fn
+}
+
+// notifyTLSState 握手结束后调用回调，err为证书校验错误时传递未经校验的证书链
+func (r *GoProxy) notifyTLSState(addr, serverName string, conn interface {
+	ConnectionState() tls.ConnectionState
+}, err error) {
+	r.mu.Lock()
+	fn := r.onTLSState
+	r.mu.Unlock()
+	if fn == nil {
+		return
+	}
+	if err == nil {
+		fn(addr, conn.ConnectionState())
+		return
+	}
+	var verr *tls.CertificateVerificationError
+	if errors.As(err, &verr) {
+		fn(addr, tls.ConnectionState{ServerName: serverName, PeerCertificates: verr.UnverifiedCertificates})
+	}
+}
+
+// CertificateInfo 证书的摘要信息，可直接序列化为JSON
+type CertificateInfo struct {
+	Subject      string    `json:"subject"`
+	Issuer       string    `json:"issuer"`
+	SerialNumber string    `json:"serial_number"`
+	NotBefore    time.Time `json:"not_before"`
+	NotAfter     time.Time `json:"not_after"`
+	DNSNames     []string  `json:"dns_names,omitempty"`
+	IPAddresses  []string  `json:"ip_addresses,omitempty"`
+	IsCA         bool      `json:"is_ca"`
+	SHA256       string    `json:"sha256"` // 证书DER编码的SHA-256指纹(十六进制)
+}
+
+// NewCertificateInfo 提取证书的摘要信息
+func NewCertificateInfo(cert *x509.Certificate) CertificateInfo {
+	sum := sha256.Sum256(cert.Raw)
+	info := CertificateInfo{
+		Subject:      cert.Subject.String(),
+		Issuer:       cert.Issuer.String(),
+		SerialNumber: cert.SerialNumber.String(),
+		NotBefore:    cert.NotBefore,
+		NotAfter:     cert.NotAfter,
+		DNSNames:     cert.DNSNames,
+		IsCA:         cert.IsCA,
+		SHA256:       hex.EncodeToString(sum[:]),
+	}
+	for _, ip := range cert.IPAddresses {
+		info.IPAddresses = append(info.IPAddresses, ip.String())
+	}
+	return info
+}
+
+// PeerCertificates 返回响应所在连接的服务器证书链，非TLS连接时返回nil
+// 未开启证书校验时证书链同样可用，但未经校验
+func PeerCertificates(resp *http.Response) []*x509.Certificate {
+	if resp == nil || resp.TLS == nil {
+		return nil
+	}
+	return resp.TLS.PeerCertificates
+}
+
+// VerifiedChains 返回响应所在连接经过校验的证书链，未开启校验或非TLS连接时返回nil
+func VerifiedChains(resp *http.Response) [][]*x509.Certificate {
+	if resp == nil || resp.TLS == nil {
+		return nil
+	}
+	return resp.TLS.VerifiedChains
+}
+
+// PeerCertificateInfos 返回响应所在连接的服务器证书链摘要
+func PeerCertificateInfos(resp *http.Response) []CertificateInfo {
+	certs := PeerCertificates(resp)
+	infos := make([]CertificateInfo, 0, len(certs))
+	for _, cert := range certs {
+		infos = append(infos, NewCertificateInfo(cert))
+	}
+	return infos
+}
@@ -0,0 +1,46 @@
+package goproxy
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGoProxy_OnTLSState(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	var states []tls.ConnectionState
+	c := New()
+	c.SetOnTLSState(func(addr string, state tls.ConnectionState) {
+		states = append(states, state)
+	})
+
+	resp, err := c.GetClient().Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	infos := PeerCertificateInfos(resp)
+	if len(infos) == 0 || infos[0].SHA256 == "" {
+		t.Fatalf("响应缺少证书信息: %+v", infos)
+	}
+	if VerifiedChains(resp) != nil {
+		t.Error("未开启校验时不应有校验过的证书链")
+	}
+
+	c.SetTLSVerify(true)
+	if _, err := c.GetClient().Get(srv.URL); err == nil {
+		t.Fatal("自签名证书应校验失败")
+	}
+	if len(states) != 2 {
+		t.Fatalf("期望回调2次，实际%d次", len(states))
+	}
+	if !states[0].HandshakeComplete || states[1].HandshakeComplete {
+		t.Error("握手状态错误")
+	}
+	if len(states[1].PeerCertificates) == 0 {
+		t.Error("校验失败时应提供未经校验的证书链")
+	}
+}
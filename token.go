@@ -0,0 +1,116 @@
+package goproxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// TokenSource 返回Bearer令牌的函数，如通过刷新令牌向认证服务器换取新的访问令牌
+type TokenSource func(ctx context.Context) (string, error)
+
+// tokenExpiryDelta 令牌在过期前多久视为已过期，避免请求途中过期
+const tokenExpiryDelta = 10 * time.Second
+
+// tokenCache 缓存获取的令牌，直到令牌过期或服务器返回401
+type tokenCache struct {
+	// fetch 获取令牌，返回Authorization请求头的值和过期时间，过期时间为零值表示不会过期
+	fetch  func(ctx context.Context) (string, time.Time, error)
+	mu     sync.Mutex // 保证同一时间只有一次获取
+	auth   string     // 缓存的Authorization请求头，为空时需要重新获取
+	expiry time.Time  // 缓存的令牌的过期时间
+}
+
+// bearerTokens 由TokenSource获取Bearer令牌的tokenCache
+func bearerTokens(fn TokenSource) *tokenCache {
+	return &tokenCache{fetch: func(ctx context.Context) (string, time.Time, error) {
+		token, err := fn(ctx)
+		if err != nil || token == "" {
+			return "", time.Time{}, err
+		}
+		return "Bearer " + token, time.Time{}, nil
+	}}
+}
+
+// get 返回缓存的Authorization请求头，没有或已过期时重新获取
+func (t *tokenCache) get(ctx context.Context) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.auth != "" && (t.expiry.IsZero() || time.Now().Add(tokenExpiryDelta).Before(t.expiry)) {
+		return t.auth, nil
+	}
+	auth, expiry, err := t.fetch(context.WithValue(ctx, noTokenKey{}, true))
+	if err != nil {
+		return "", fmt.Errorf("获取令牌失败: %w", err)
+	}
+	if auth == "" {
+		return "", errors.New("获取令牌失败: 令牌为空")
+	}
+	t.auth, t.expiry = auth, expiry
+	return auth, nil
+}
+
+// invalidate 丢弃被服务器拒绝的令牌，令牌已被其他请求刷新时保留新令牌
+func (t *tokenCache) invalidate(auth string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.auth == auth {
+		t.auth = ""
+	}
+}
+
+// noTokenKey 标记获取令牌本身发出的请求，这类请求不携带令牌，以免获取令牌时递归
+type noTokenKey struct{}
+
+// SetTokenSource 为所有请求添加Bearer令牌认证，请求本身带有Authorization或使用Basic认证时不添加
+// 令牌在第一次请求前获取并缓存；服务器返回401时重新获取令牌并重试一次，请求体无法重放(未设置GetBody)时不重试。
+// 重定向时只有与最初请求同源的请求携带令牌，与SetBasicAuth相同
+// 参数:
+//   - fn: 获取令牌的函数，可能被并发调用的请求共享，但同一时间只会调用一次；为nil时取消令牌认证
+func (r *GoProxy) SetTokenSource(fn TokenSource) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ct := r.transport
+	if fn == nil {
+		ct.tokens.Store(nil)
+		return
+	}
+	ct.tokens.Store(bearerTokens(fn))
+}
+
+// roundTripWithToken 携带令牌发送请求，令牌被拒绝时换新令牌重试一次
+func (c *CustomTransport) roundTripWithToken(req *http.Request, opts *requestOptions, tokens *tokenCache) (*http.Response, error) {
+	auth, err := tokens.get(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	retry := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+	req.Header.Set("Authorization", auth)
+	resp, err := c.send(req, opts)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	tokens.invalidate(auth)
+	if !retry {
+		return resp, nil
+	}
+	auth, err = tokens.get(req.Context())
+	if err != nil {
+		// 无法获取新令牌时返回原来的401响应
+		return resp, nil
+	}
+	r2 := cloneRequestHeader(req)
+	if req.GetBody != nil {
+		if r2.Body, err = req.GetBody(); err != nil {
+			return resp, nil
+		}
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	resp.Body.Close()
+	r2.Header.Set("Authorization", auth)
+	return c.send(r2, opts)
+}
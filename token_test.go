@@ -0,0 +1,81 @@
+package goproxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestGoProxy_SetTokenSource(t *testing.T) {
+	var valid atomic.Value
+	valid.Store("Bearer t2")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != valid.Load() {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	var calls atomic.Int64
+	c := New()
+	c.SetTokenSource(func(ctx context.Context) (string, error) {
+		return fmt.Sprintf("t%d", calls.Add(1)), nil
+	})
+	post := func(body io.Reader) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, srv.URL, body)
+		resp, err := c.GetClient().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	// 第一个令牌被拒绝后换新令牌重试，请求体随之重放
+	resp := post(strings.NewReader("hello"))
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "hello" || calls.Load() != 2 {
+		t.Errorf("状态码为%d, 响应为%q, 获取令牌%d次", resp.StatusCode, body, calls.Load())
+	}
+	resp = post(nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || calls.Load() != 2 {
+		t.Errorf("缓存令牌时状态码为%d, 获取令牌%d次", resp.StatusCode, calls.Load())
+	}
+
+	// 请求体无法重放时不重试
+	valid.Store("Bearer t4")
+	resp = post(io.NopCloser(strings.NewReader("hello")))
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized || calls.Load() != 2 {
+		t.Errorf("无法重放时状态码为%d, 获取令牌%d次", resp.StatusCode, calls.Load())
+	}
+	resp = post(nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || calls.Load() != 4 {
+		t.Errorf("状态码为%d, 获取令牌%d次", resp.StatusCode, calls.Load())
+	}
+
+	c.SetTokenSource(func(ctx context.Context) (string, error) {
+		return "", errors.New("refresh token expired")
+	})
+	if _, err := c.GetClient().Get(srv.URL); err == nil || !strings.Contains(err.Error(), "refresh token expired") {
+		t.Errorf("获取令牌失败时错误为%v", err)
+	}
+	c.SetTokenSource(nil)
+	resp = post(nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("取消后状态码为%d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,181 @@
+package goproxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultTrafficLogMaxSize 单个流量日志文件的默认大小上限
+const DefaultTrafficLogMaxSize = 100 << 20
+
+// TrafficRecord 一条流量日志记录，以JSONL格式写入文件
+type TrafficRecord struct {
+	Time       time.Time `json:"ts"`               // 请求开始时间
+	Method     string    `json:"method"`           // 请求方法
+	URL        string    `json:"url"`              // 请求地址(密码已脱敏)
+	Status     int       `json:"status,omitempty"` // 响应状态码，请求失败时为空
+	Proxy      string    `json:"proxy"`            // 使用的代理(密码已脱敏)，直连时为direct
+	DurationMs float64   `json:"duration_ms"`      // 从发出请求到响应体关闭的耗时(毫秒)
+	ReqBytes   int64     `json:"req_bytes"`        // 请求体大小，未知时为0
+	RespBytes  int64     `json:"resp_bytes"`       // 实际读取的响应体大小
+	Error      string    `json:"error,omitempty"`  // 错误信息
+}
+
+// TrafficLogger 将请求记录写入按大小滚动的JSONL日志文件
+// 当前文件超过大小上限时重命名为path.1，原有的path.1重命名为path.2，依次类推，
+// 超出保留数量的旧文件会被删除
+type TrafficLogger struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// NewTrafficLogger 创建流量日志记录器
+// 参数:
+//   - path: 日志文件路径
+//   - maxSize: 单个文件的大小上限(字节)，<=0时使用DefaultTrafficLogMaxSize
+//   - maxBackups: 保留的历史文件数量，<=0时不保留历史文件
+func NewTrafficLogger(path string, maxSize int64, maxBackups int) (*TrafficLogger, error) {
+	if maxSize <= 0 {
+		maxSize = DefaultTrafficLogMaxSize
+	}
+	l := &TrafficLogger{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// open 以追加方式打开日志文件
+func (l *TrafficLogger) open() error {
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("打开流量日志文件失败: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("读取流量日志文件信息失败: %w", err)
+	}
+	l.file = f
+	l.size = info.Size()
+	return nil
+}
+
+// rotate 滚动日志文件
+func (l *TrafficLogger) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return fmt.Errorf("关闭流量日志文件失败: %w", err)
+	}
+	l.file = nil
+	if l.maxBackups <= 0 {
+		os.Remove(l.path)
+	} else {
+		os.Remove(fmt.Sprintf("%s.%d", l.path, l.maxBackups))
+		for i := l.maxBackups - 1; i >= 1; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", l.path, i), fmt.Sprintf("%s.%d", l.path, i+1))
+		}
+		if err := os.Rename(l.path, l.path+".1"); err != nil {
+			return fmt.Errorf("滚动流量日志文件失败: %w", err)
+		}
+	}
+	return l.open()
+}
+
+// Log 写入一条记录，必要时先滚动日志文件
+func (l *TrafficLogger) Log(rec TrafficRecord) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("序列化流量日志失败: %w", err)
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return fmt.Errorf("流量日志已关闭")
+	}
+	if l.size > 0 && l.size+int64(len(line)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := l.file.Write(line)
+	l.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("写入流量日志失败: %w", err)
+	}
+	return nil
+}
+
+// Close 关闭日志文件，关闭后的写入会返回错误
+func (l *TrafficLogger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// observe 记录一次请求，请求成功时在响应体关闭后写入日志，以便记录实际传输的字节数
+func (l *TrafficLogger) observe(req *http.Request, resp *http.Response, err error, proxy string, start time.Time) {
+	rec := TrafficRecord{
+		Time:   start,
+		Method: req.Method,
+		URL:    displayURL(req.URL),
+		Proxy:  redactProxy(proxy),
+	}
+	if req.ContentLength > 0 {
+		rec.ReqBytes = req.ContentLength
+	}
+	if err != nil {
+		rec.Error = err.Error()
+		rec.DurationMs = float64(time.Since(start)) / float64(time.Millisecond)
+		l.Log(rec)
+		return
+	}
+	rec.Status = resp.StatusCode
+	resp.Body = &loggedBody{rc: resp.Body, logger: l, rec: rec, start: start}
+}
+
+// loggedBody 统计响应体读取的字节数，关闭时写入流量日志
+type loggedBody struct {
+	rc     io.ReadCloser
+	logger *TrafficLogger
+	rec    TrafficRecord
+	start  time.Time
+	once   sync.Once
+}
+
+func (b *loggedBody) Read(p []byte) (int, error) {
+	n, err := b.rc.Read(p)
+	b.rec.RespBytes += int64(n)
+	return n, err
+}
+
+func (b *loggedBody) Close() error {
+	err := b.rc.Close()
+	b.once.Do(func() {
+		b.rec.DurationMs = float64(time.Since(b.start)) / float64(time.Millisecond)
+		b.logger.Log(b.rec)
+	})
+	return err
+}
+
+// SetTrafficLogger 设置流量日志记录器，为nil时关闭流量日志
+// 记录器由调用方负责关闭
+func (r *GoProxy) SetTrafficLogger(l *TrafficLogger) {
+	r.transport.logger.Store(l)
+}
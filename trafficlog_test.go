@@ -0,0 +1,60 @@
+package goproxy
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTrafficLogger(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello")
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "traffic.log")
+	logger, err := NewTrafficLogger(path, 300, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+
+	c := New()
+	c.SetTrafficLogger(logger)
+	for i := 0; i < 5; i++ {
+		resp, err := c.GetClient().Get(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	if !scanner.Scan() {
+		t.Fatal("日志文件为空")
+	}
+	var rec TrafficRecord
+	if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Method != "GET" || rec.Status != 200 || rec.RespBytes != 5 || rec.Proxy != directProxyKey {
+		t.Errorf("日志记录错误: %+v", rec)
+	}
+	if _, err := os.Stat(path + ".1"); err != nil {
+		t.Errorf("日志未滚动: %v", err)
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("超出保留数量的日志未删除")
+	}
+}
@@ -0,0 +1,272 @@
+package goproxy
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// tusVersion 实现的tus协议版本
+const tusVersion = "1.0.0"
+
+// defaultTusChunkSize 每个PATCH请求上传的默认大小
+const defaultTusChunkSize = 8 << 20
+
+// TusOption TusUpload的选项
+type TusOption func(*tusUpload)
+
+// tusUpload TusUpload的配置
+type tusUpload struct {
+	uploadURL string
+	chunkSize int64
+	retry     RetryPolicy
+	metadata  map[string]string
+	onCreate  func(uploadURL string)
+	progress  func(offset, size int64)
+}
+
+// WithTusURL 从已创建的上传继续，先通过HEAD请求查询服务器已接收的位置；
+// 服务器返回404或410(上传已过期)时重新创建
+func WithTusURL(uploadURL string) TusOption {
+	return func(u *tusUpload) {
+		u.uploadURL = uploadURL
+	}
+}
+
+// WithTusChunkSize 设置每个PATCH请求上传的大小，默认为8MB，单个请求失败时只需重传该部分
+func WithTusChunkSize(n int64) TusOption {
+	return func(u *tusUpload) {
+		if n > 0 {
+			u.chunkSize = n
+		}
+	}
+}
+
+// WithTusRetry 设置请求失败后的重试策略，Attempts为允许连续失败的次数，每次重试前向服务器查询已接收的位置。
+// 默认重试5次，上传有进展后重新计数
+func WithTusRetry(p RetryPolicy) TusOption {
+	return func(u *tusUpload) {
+		u.retry = p
+	}
+}
+
+// WithTusMetadata 设置创建上传时的Upload-Metadata，如文件名和类型
+func WithTusMetadata(m map[string]string) TusOption {
+	return func(u *tusUpload) {
+		u.metadata = m
+	}
+}
+
+// WithTusCreated 设置创建上传后的回调，调用方应保存上传地址，之后通过WithTusURL继续中断的上传
+func WithTusCreated(fn func(uploadURL string)) TusOption {
+	return func(u *tusUpload) {
+		u.onCreate = fn
+	}
+}
+
+// WithTusProgress 设置上传进度回调，每个PATCH请求完成后以服务器确认的位置调用
+func WithTusProgress(fn func(offset, size int64)) TusOption {
+	return func(u *tusUpload) {
+		u.progress = fn
+	}
+}
+
+// TusUpload 按tus协议(https://tus.io)分块上传，连接中断或代理不稳定时从服务器已接收的位置继续而不是从头上传。
+// 请求通过客户端发送，使用代理和请求头等配置，但不受SetTimeout整体超时的限制。
+// 支持core协议和creation扩展，返回上传地址
+// 参数:
+//   - ctx: 上下文，结束时停止上传，之后可以通过WithTusURL继续
+//   - endpoint: 创建上传的地址
+//   - src: 上传的数据
+//   - size: 数据的大小
+//   - opts: 选项
+func (r *GoProxy) TusUpload(ctx context.Context, endpoint string, src io.ReaderAt, size int64, opts ...TusOption) (string, error) {
+	u := tusUpload{chunkSize: defaultTusChunkSize, retry: RetryPolicy{Attempts: 5}}
+	for _, opt := range opts {
+		opt(&u)
+	}
+	if size < 0 {
+		return "", errors.New("上传的大小不能小于0")
+	}
+
+	offset := int64(-1)
+	failures := 0
+	for {
+		var err error
+		var resp *http.Response
+		switch {
+		case u.uploadURL == "":
+			resp, err = r.tusCreate(ctx, endpoint, size, &u)
+			if err == nil {
+				offset = 0
+				if u.onCreate != nil {
+					u.onCreate(u.uploadURL)
+				}
+			}
+		case offset < 0:
+			// 查询服务器已接收的位置
+			offset, resp, err = r.tusOffset(ctx, u.uploadURL, size)
+			if resp != nil && (resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone) {
+				u.uploadURL, err = "", nil
+				continue
+			}
+		case offset >= size:
+			return u.uploadURL, nil
+		default:
+			var next int64
+			next, resp, err = r.tusPatch(ctx, u.uploadURL, src, offset, min(u.chunkSize, size-offset))
+			if err == nil {
+				if next <= offset {
+					return u.uploadURL, fmt.Errorf("tus服务器没有接收数据，位置停留在%d", offset)
+				}
+				offset, failures = next, 0
+				if u.progress != nil {
+					u.progress(offset, size)
+				}
+			} else if resp != nil && resp.StatusCode == http.StatusConflict {
+				// 本地记录的位置与服务器不一致，重新查询
+				offset, err = -1, nil
+			}
+		}
+		if err == nil {
+			continue
+		}
+		if ctx.Err() != nil {
+			return u.uploadURL, ctx.Err()
+		}
+		advice := ClassifyRetry(nil, err)
+		if resp != nil {
+			advice = ClassifyRetry(resp, nil)
+		}
+		if failures++; advice == RetryNever || failures > u.retry.Attempts {
+			return u.uploadURL, err
+		}
+		wait := u.retry.backoff(failures - 1)
+		if resp != nil {
+			wait = retryAfter(resp, wait, u.retry.maxBackoff())
+		}
+		if err := sleepContext(ctx, wait); err != nil {
+			return u.uploadURL, err
+		}
+		if u.uploadURL != "" {
+			// 请求失败时不确定服务器接收了多少，重试前重新查询
+			offset = -1
+		}
+	}
+}
+
+// tusCreate 通过POST请求创建上传，成功时设置u.uploadURL
+func (r *GoProxy) tusCreate(ctx context.Context, endpoint string, size int64, u *tusUpload) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Upload-Length", strconv.FormatInt(size, 10))
+	if len(u.metadata) > 0 {
+		req.Header.Set("Upload-Metadata", encodeTusMetadata(u.metadata))
+	}
+	resp, err := r.tusDo(req, http.StatusCreated)
+	if err != nil {
+		return resp, err
+	}
+	loc := resp.Header.Get("Location")
+	if loc == "" {
+		return nil, errors.New("tus服务器创建上传的响应缺少Location")
+	}
+	ref, err := req.URL.Parse(loc)
+	if err != nil {
+		return nil, fmt.Errorf("tus服务器返回的上传地址无效: %w", err)
+	}
+	u.uploadURL = ref.String()
+	return nil, nil
+}
+
+// tusOffset 通过HEAD请求查询服务器已接收的位置
+func (r *GoProxy) tusOffset(ctx context.Context, uploadURL string, size int64) (int64, *http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, uploadURL, nil)
+	if err != nil {
+		return -1, nil, err
+	}
+	req.Header.Set("Cache-Control", "no-store")
+	resp, err := r.tusDo(req, http.StatusOK, http.StatusNoContent)
+	if err != nil {
+		return -1, resp, err
+	}
+	offset, err := tusUploadOffset(resp)
+	if err != nil {
+		return -1, nil, err
+	}
+	if l := resp.Header.Get("Upload-Length"); l != "" && l != strconv.FormatInt(size, 10) {
+		return -1, nil, fmt.Errorf("tus上传的大小为%s，与本地数据的大小%d不一致", l, size)
+	}
+	return offset, nil, nil
+}
+
+// tusPatch 通过PATCH请求上传从offset开始的n字节，返回服务器确认的新位置
+func (r *GoProxy) tusPatch(ctx context.Context, uploadURL string, src io.ReaderAt, offset, n int64) (int64, *http.Response, error) {
+	body := func() (io.ReadCloser, error) {
+		return io.NopCloser(io.NewSectionReader(src, offset, n)), nil
+	}
+	rc, _ := body()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPatch, uploadURL, rc)
+	if err != nil {
+		return -1, nil, err
+	}
+	req.GetBody = body
+	req.ContentLength = n
+	req.Header.Set("Content-Type", "application/offset+octet-stream")
+	req.Header.Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	resp, err := r.tusDo(req, http.StatusNoContent, http.StatusOK)
+	if err != nil {
+		return -1, resp, err
+	}
+	next, err := tusUploadOffset(resp)
+	return next, nil, err
+}
+
+// tusDo 发送tus请求，状态码不在codes中时返回*StatusError和已关闭响应体的响应，否则关闭响应体后返回响应
+func (r *GoProxy) tusDo(req *http.Request, codes ...int) (*http.Response, error) {
+	req.Header.Set("Tus-Resumable", tusVersion)
+	// 状态码由TusUpload自己检查
+	resp, err := r.doStream(WithOptions(req, WithExpectedStatus()))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if !slices.Contains(codes, resp.StatusCode) {
+		se, _ := newStatusError(req, resp, statusErrorBodyLimit)
+		return resp, se
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4<<10))
+	return resp, nil
+}
+
+// tusUploadOffset 读取响应的Upload-Offset
+func tusUploadOffset(resp *http.Response) (int64, error) {
+	v := resp.Header.Get("Upload-Offset")
+	offset, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || offset < 0 {
+		return -1, fmt.Errorf("tus服务器返回的Upload-Offset无效: %q", v)
+	}
+	return offset, nil
+}
+
+// encodeTusMetadata 按tus协议编码Upload-Metadata: 以逗号分隔的"键 base64值"，按键排序
+func encodeTusMetadata(m map[string]string) string {
+	pairs := make([]string, 0, len(m))
+	for k, v := range m {
+		if v == "" {
+			pairs = append(pairs, k)
+		} else {
+			pairs = append(pairs, k+" "+base64.StdEncoding.EncodeToString([]byte(v)))
+		}
+	}
+	slices.Sort(pairs)
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,155 @@
+package goproxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// tusTestServer 简单的tus服务器，dropAfter大于0时第一次PATCH只接收该数量的字节后断开连接
+type tusTestServer struct {
+	mu        sync.Mutex
+	uploads   map[string]*bytes.Buffer
+	sizes     map[string]int64
+	metadata  string
+	patches   int
+	heads     int
+	dropAfter int64
+}
+
+func (s *tusTestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		w.WriteHeader(http.StatusPreconditionFailed)
+		return
+	}
+	w.Header().Set("Tus-Resumable", tusVersion)
+	switch r.Method {
+	case http.MethodPost:
+		size, _ := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+		id := fmt.Sprintf("/files/%d", len(s.uploads)+1)
+		s.uploads[id], s.sizes[id] = &bytes.Buffer{}, size
+		s.metadata = r.Header.Get("Upload-Metadata")
+		w.Header().Set("Location", id)
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodHead:
+		s.heads++
+		buf, ok := s.uploads[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Upload-Offset", strconv.Itoa(buf.Len()))
+		w.Header().Set("Upload-Length", strconv.FormatInt(s.sizes[r.URL.Path], 10))
+		w.WriteHeader(http.StatusOK)
+	case http.MethodPatch:
+		s.patches++
+		buf := s.uploads[r.URL.Path]
+		if r.Header.Get("Upload-Offset") != strconv.Itoa(buf.Len()) {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		if s.dropAfter > 0 && s.patches == 2 {
+			io.CopyN(buf, r.Body, s.dropAfter)
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		io.Copy(buf, r.Body)
+		w.Header().Set("Upload-Offset", strconv.Itoa(buf.Len()))
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func newTusTestServer(t *testing.T) (*tusTestServer, *httptest.Server) {
+	s := &tusTestServer{uploads: map[string]*bytes.Buffer{}, sizes: map[string]int64{}}
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	return s, srv
+}
+
+func TestGoProxy_TusUpload(t *testing.T) {
+	s, srv := newTusTestServer(t)
+	s.dropAfter = 3
+	data := []byte(strings.Repeat("abcdefghij", 5))
+
+	c := New()
+	var created string
+	var offsets []int64
+	uploadURL, err := c.TusUpload(context.Background(), srv.URL+"/files", bytes.NewReader(data), int64(len(data)),
+		WithTusChunkSize(20),
+		WithTusRetry(RetryPolicy{Attempts: 2, Backoff: time.Millisecond}),
+		WithTusMetadata(map[string]string{"filename": "a.txt", "public": ""}),
+		WithTusCreated(func(u string) { created = u }),
+		WithTusProgress(func(offset, size int64) { offsets = append(offsets, offset) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uploadURL != srv.URL+"/files/1" || created != uploadURL {
+		t.Errorf("上传地址为%s，回调为%s", uploadURL, created)
+	}
+	if got := s.uploads["/files/1"].String(); got != string(data) {
+		t.Errorf("服务器收到%q", got)
+	}
+	// 第二块中断后从23继续
+	if fmt.Sprint(offsets) != "[20 43 50]" || s.heads != 1 {
+		t.Errorf("进度为%v，查询了%d次位置", offsets, s.heads)
+	}
+	if s.metadata != "filename YS50eHQ=,public" {
+		t.Errorf("Upload-Metadata为%q", s.metadata)
+	}
+}
+
+func TestGoProxy_TusUploadResume(t *testing.T) {
+	s, srv := newTusTestServer(t)
+	data := []byte("0123456789")
+	s.uploads["/files/old"] = bytes.NewBufferString("01234")
+	s.sizes["/files/old"] = 10
+
+	c := New()
+	uploadURL, err := c.TusUpload(context.Background(), srv.URL+"/files", bytes.NewReader(data), 10, WithTusURL(srv.URL+"/files/old"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uploadURL != srv.URL+"/files/old" || s.uploads["/files/old"].String() != string(data) || s.patches != 1 {
+		t.Errorf("上传地址为%s，内容为%q，PATCH %d次", uploadURL, s.uploads["/files/old"], s.patches)
+	}
+
+	// 上传已过期时重新创建
+	uploadURL, err = c.TusUpload(context.Background(), srv.URL+"/files", bytes.NewReader(data), 10, WithTusURL(srv.URL+"/files/expired"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uploadURL == srv.URL+"/files/expired" || s.uploads[strings.TrimPrefix(uploadURL, srv.URL)].String() != string(data) {
+		t.Errorf("重新创建的上传地址为%s", uploadURL)
+	}
+
+	// 大小不一致时返回错误
+	_, err = c.TusUpload(context.Background(), srv.URL+"/files", bytes.NewReader(data[:8]), 8, WithTusURL(srv.URL+"/files/old"))
+	if err == nil {
+		t.Error("大小不一致时应返回错误")
+	}
+}
+
+func TestGoProxy_TusUploadErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer srv.Close()
+	c := New()
+	_, err := c.TusUpload(context.Background(), srv.URL, strings.NewReader("x"), 1)
+	var se *StatusError
+	if !errors.As(err, &se) || se.StatusCode != http.StatusForbidden {
+		t.Errorf("错误为%v", err)
+	}
+}
@@ -0,0 +1,59 @@
+package goproxy
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// unixHostSuffix 编码了Unix套接字路径的主机名后缀
+// 套接字路径以十六进制编码为主机名交给Transport，使同一套接字的连接可被连接池复用，拨号时再还原为路径
+const unixHostSuffix = ".unix-socket.invalid"
+
+// unixSocketHost 将Unix套接字路径编码为主机名
+func unixSocketHost(path string) string {
+	return hex.EncodeToString([]byte(path)) + unixHostSuffix
+}
+
+// unixSocketPath 从host:port形式的addr中还原unixSocketHost编码的套接字路径
+func unixSocketPath(addr string) (string, bool) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	encoded, ok := strings.CutSuffix(host, unixHostSuffix)
+	if !ok {
+		return "", false
+	}
+	path, err := hex.DecodeString(encoded)
+	if err != nil {
+		return "", false
+	}
+	return string(path), true
+}
+
+// rewriteUnixRequest 将http+unix请求改写为访问编码主机名的http请求，其他请求原样返回
+// URL形如"http+unix:///var/run/docker.sock:/v1.41/info"，套接字路径与请求路径以":"分隔，
+// 未设置Host时Host请求头使用localhost
+func rewriteUnixRequest(req *http.Request) (*http.Request, error) {
+	if req.URL == nil || req.URL.Scheme != "http+unix" {
+		return req, nil
+	}
+	sock, path, ok := strings.Cut(req.URL.Path, ":")
+	if !ok || sock == "" || req.URL.Host != "" {
+		return nil, fmt.Errorf("无效的http+unix地址: %s", req.URL)
+	}
+	if path == "" {
+		path = "/"
+	}
+	r2 := *req
+	u := *req.URL
+	u.Scheme, u.Host, u.Path, u.RawPath = "http", unixSocketHost(sock), path, ""
+	r2.URL = &u
+	if r2.Host == "" {
+		r2.Host = "localhost"
+	}
+	return &r2, nil
+}
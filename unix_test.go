@@ -0,0 +1,84 @@
+package goproxy
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+// newTestUnixServer 在临时目录的Unix套接字上启动HTTP服务，返回套接字路径
+func newTestUnixServer(t *testing.T, handler http.Handler) string {
+	sock := filepath.Join(t.TempDir(), "test.sock")
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Skipf("不支持Unix套接字: %v", err)
+	}
+	srv := httptest.NewUnstartedServer(handler)
+	srv.Listener = ln
+	srv.Start()
+	t.Cleanup(srv.Close)
+	return sock
+}
+
+func TestGoProxy_UnixSocketTarget(t *testing.T) {
+	sock := newTestUnixServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Host+" "+r.URL.RequestURI())
+	}))
+
+	c := New()
+	proxySrv, _ := newTestProxy(t)
+	if err := c.SetProxy(proxySrv.URL); err != nil {
+		t.Fatal(err)
+	}
+	// Unix套接字目标不经过代理
+	if got := getBody(t, c, "http+unix://"+sock+":/v1/info?all=1"); got != "localhost /v1/info?all=1" {
+		t.Errorf("响应为%q", got)
+	}
+	if _, err := c.GetClient().Get("http+unix://" + sock); err == nil {
+		t.Error("缺少路径分隔符应返回错误")
+	}
+}
+
+func TestGoProxy_UnixSocketProxy(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer target.Close()
+	tlsTarget := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "secure")
+	}))
+	defer tlsTarget.Close()
+	proxySrv, connects := newTestProxy(t)
+	sock := newTestUnixServer(t, proxySrv.Config.Handler)
+
+	c := New()
+	if err := c.SetProxy("unix://" + sock); err != nil {
+		t.Fatal(err)
+	}
+	if got := getBody(t, c, target.URL); got != "ok" {
+		t.Errorf("响应为%q", got)
+	}
+	if got := getBody(t, c, tlsTarget.URL); got != "secure" || connects.Load() != 1 {
+		t.Errorf("响应为%q, CONNECT次数为%d", got, connects.Load())
+	}
+
+	if err := c.SetProxy("socks5+unix://" + sock); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetProxy("unix://host/path.sock"); err == nil {
+		t.Error("包含主机的Unix套接字地址应返回错误")
+	}
+}
+
+func TestUnixSocketHost(t *testing.T) {
+	path, ok := unixSocketPath(unixSocketHost("/var/run/docker.sock") + ":80")
+	if !ok || path != "/var/run/docker.sock" {
+		t.Errorf("还原结果为%q", path)
+	}
+	if _, ok := unixSocketPath("example.com:80"); ok {
+		t.Error("普通主机不应识别为Unix套接字")
+	}
+}
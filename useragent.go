@@ -0,0 +1,110 @@
+package goproxy
+
+import (
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// UARotation 从SetUserAgents设置的列表中选择User-Agent的方式
+type UARotation uint8
+
+const (
+	// UARandom 每个请求随机选择
+	UARandom UARotation = iota
+	// UARoundRobin 按顺序轮流使用
+	UARoundRobin
+)
+
+// maxStickyHosts 按主机固定User-Agent时最多记录的主机数，超过后清空重新分配
+const maxStickyHosts = 10000
+
+// SetUserAgents 设置轮换使用的User-Agent列表，没有User-Agent的请求按mode从中选择一个，
+// 优先于全局请求头中的User-Agent；按主机设置的User-Agent仍然优先，与请求本身的User-Agent的优先级见SetHeaderPolicy
+// 参数:
+//   - agents: User-Agent列表，为空时不轮换，恢复使用全局请求头
+//   - mode: 选择方式，UARandom或UARoundRobin
+func (r *GoProxy) SetUserAgents(agents []string, mode UARotation) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	perHost := false
+	if p := r.transport.userAgents.Load(); p != nil {
+		perHost = p.perHost
+	}
+	r.transport.userAgents.Store(newUAPool(agents, mode, perHost))
+}
+
+// SetUserAgentPerHost 设置是否按主机固定User-Agent: 开启后同一主机的请求始终使用第一次为其选择的User-Agent，
+// 模拟同一浏览器访问一个站点，不同主机之间仍按SetUserAgents的方式轮换
+func (r *GoProxy) SetUserAgentPerHost(sticky bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if p := r.transport.userAgents.Load(); p != nil {
+		r.transport.userAgents.Store(newUAPool(p.agents, p.mode, sticky))
+	}
+}
+
+// GetUserAgents 返回SetUserAgents设置的User-Agent列表
+func (r *GoProxy) GetUserAgents() []string {
+	if p := r.transport.userAgents.Load(); p != nil {
+		return slices.Clone(p.agents)
+	}
+	return nil
+}
+
+// uaPool 轮换使用的User-Agent列表
+type uaPool struct {
+	agents  []string
+	mode    UARotation
+	perHost bool
+	next    atomic.Uint64 // 轮流使用时下一个的序号
+
+	mu    sync.Mutex
+	hosts map[string]string // 按主机固定的User-Agent
+}
+
+// newUAPool 创建User-Agent列表，agents为空时返回nil
+func newUAPool(agents []string, mode UARotation, perHost bool) *uaPool {
+	if len(agents) == 0 {
+		return nil
+	}
+	return &uaPool{agents: slices.Clone(agents), mode: mode, perHost: perHost}
+}
+
+// pick 为访问host的请求选择User-Agent
+func (p *uaPool) pick(host string) string {
+	if !p.perHost {
+		return p.choose()
+	}
+	host = normalizeHost(host)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if ua, ok := p.hosts[host]; ok {
+		return ua
+	}
+	if p.hosts == nil || len(p.hosts) >= maxStickyHosts {
+		p.hosts = make(map[string]string)
+	}
+	ua := p.choose()
+	p.hosts[host] = ua
+	return ua
+}
+
+// choose 按选择方式取一个User-Agent
+func (p *uaPool) choose() string {
+	if p.mode == UARoundRobin {
+		return p.agents[(p.next.Add(1)-1)%uint64(len(p.agents))]
+	}
+	return p.agents[rand.IntN(len(p.agents))]
+}
+
+// applyUserAgent 按请求头合并规则从轮换列表中选择User-Agent
+func (c *CustomTransport) applyUserAgent(req *http.Request, m *headerMerge) {
+	p := c.userAgents.Load()
+	if p == nil || !m.applies(req.Header, "User-Agent") {
+		return
+	}
+	m.merge(req.Header, http.Header{"User-Agent": {p.pick(req.URL.Hostname())}}, nil)
+}
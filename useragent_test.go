@@ -0,0 +1,67 @@
+package goproxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestUAPool_PickNormalizeHost(t *testing.T) {
+	// 同一主机的不同写法使用同一个User-Agent
+	p := newUAPool([]string{"ua-1", "ua-2"}, UARoundRobin, true)
+	first := p.pick("bücher.example")
+	if got := p.pick("XN--BCHER-KVA.example."); got != first || len(p.hosts) != 1 {
+		t.Errorf("punycode写法的User-Agent为%q，第一次为%q", got, first)
+	}
+}
+
+func TestGoProxy_SetUserAgents(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Header.Get("User-Agent"))
+	}))
+	defer srv.Close()
+	port := mustParseURL(t, srv.URL).Port()
+	c := New()
+	agents := []string{"ua-1", "ua-2", "ua-3"}
+	c.SetUserAgents(agents, UARoundRobin)
+	for i := 0; i < 6; i++ {
+		if got := getBody(t, c, srv.URL); got != agents[i%3] {
+			t.Errorf("第%d次请求的User-Agent为%q", i, got)
+		}
+	}
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	req.Header.Set("User-Agent", "own")
+	if got := doBody(t, c, req); got != "own" {
+		t.Errorf("请求本身的User-Agent被替换为%q", got)
+	}
+
+	c.SetUserAgents(agents, UARandom)
+	seen := make(map[string]bool)
+	for i := 0; i < 50; i++ {
+		seen[getBody(t, c, srv.URL)] = true
+	}
+	if len(seen) < 2 {
+		t.Errorf("随机选择只使用了%v", seen)
+	}
+
+	// 按主机固定后同一主机始终使用同一个
+	c.SetUserAgents(agents, UARoundRobin)
+	c.SetUserAgentPerHost(true)
+	c.SetHostOverride("other.test", "127.0.0.1")
+	first := getBody(t, c, srv.URL)
+	other := getBody(t, c, "http://other.test:"+port)
+	for i := 0; i < 3; i++ {
+		if got := getBody(t, c, srv.URL); got != first {
+			t.Errorf("固定后的User-Agent为%q，第一次为%q", got, first)
+		}
+	}
+	if other == first {
+		t.Errorf("不同主机使用了同一个User-Agent: %q", other)
+	}
+
+	c.SetUserAgents(nil, UARandom)
+	if got := getBody(t, c, srv.URL); got != DefaultUA {
+		t.Errorf("清空后的User-Agent为%q", got)
+	}
+}
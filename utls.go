@@ -0,0 +1,205 @@
+package goproxy
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+
+	utls "github.com/refraction-networking/utls"
+)
+
+// TLSFingerprint TLS客户端指纹(ClientHello)类型
+// 许多反爬系统会根据JA3/JA4指纹直接拦截Go默认的ClientHello，
+// 设置指纹后握手由uTLS完成，模拟对应浏览器的ClientHello
+type TLSFingerprint string
+
+const (
+	FingerprintGo         TLSFingerprint = ""           // Go标准库默认的ClientHello
+	FingerprintChrome     TLSFingerprint = "chrome"     // 最新版Chrome
+	FingerprintChrome120  TLSFingerprint = "chrome120"  // Chrome 120
+	FingerprintChrome131  TLSFingerprint = "chrome131"  // Chrome 131
+	FingerprintFirefox    TLSFingerprint = "firefox"    // 最新版Firefox
+	FingerprintFirefox120 TLSFingerprint = "firefox120" // Firefox 120
+	FingerprintSafari     TLSFingerprint = "safari"     // 最新版Safari
+	FingerprintIOS        TLSFingerprint = "ios"        // iOS Safari
+	FingerprintEdge       TLSFingerprint = "edge"       // Edge
+	FingerprintRandomized TLSFingerprint = "randomized" // 每次握手随机生成
+)
+
+// fingerprintIDs 指纹到uTLS ClientHelloID的映射
+var fingerprintIDs = map[TLSFingerprint]utls.ClientHelloID{
+	FingerprintChrome:     utls.HelloChrome_Auto,
+	FingerprintChrome120:  utls.HelloChrome_120,
+	FingerprintChrome131:  utls.HelloChrome_131,
+	FingerprintFirefox:    utls.HelloFirefox_Auto,
+	FingerprintFirefox120: utls.HelloFirefox_120,
+	FingerprintSafari:     utls.HelloSafari_Auto,
+	FingerprintIOS:        utls.HelloIOS_Auto,
+	FingerprintEdge:       utls.HelloEdge_Auto,
+	FingerprintRandomized: utls.HelloRandomizedALPN,
+}
+
+// SetTLSFingerprint 设置访问https目标时使用的TLS指纹，FingerprintGo表示使用标准库握手
+// 注意: 指纹中的ALPN按是否开启HTTP/2替换为h2和http/1.1或只保留http/1.1，见EnableHTTP2
+func (r *GoProxy) SetTLSFingerprint(fp TLSFingerprint) error {
+	if fp != FingerprintGo {
+		if _, ok := fingerprintIDs[fp]; !ok {
+			return fmt.Errorf("不支持的TLS指纹: %s", fp)
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.fingerprint = fp
+	r.closeIdleConns()
+	return nil
+}
+
+// GetTLSFingerprint 获取当前使用的TLS指纹
+func (r *GoProxy) GetTLSFingerprint() TLSFingerprint {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.fingerprint
+}
+
+// randomizedRetries 随机指纹握手失败时的最多重试次数
+const randomizedRetries = 4
+
+// handshakeUTLS 建立到addr的连接并使用uTLS按指纹握手
+// 随机指纹可能选中服务器在HelloRetryRequest中要求、而uTLS不支持的密钥交换组，此时换一个随机指纹重试
+func (r *GoProxy) handshakeUTLS(ctx context.Context, network, addr string, cfg *tls.Config, fp TLSFingerprint) (tlsConn, error) {
+	for attempt := 0; ; attempt++ {
+		conn, err := r.dialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		setFlowSNI(conn, cfg.ServerName)
+		hsCtx, cancel := r.withHandshakeTimeout(ctx)
+		uconn, err := utlsHandshake(hsCtx, conn, cfg, fp)
+		cancel()
+		if err == nil {
+			r.notifyTLSState(addr, cfg.ServerName, uconn, nil)
+			return uconn, nil
+		}
+		conn.Close()
+		if fp != FingerprintRandomized || attempt >= randomizedRetries || !errors.Is(err, errUnsupportedHRRGroup) {
+			return nil, r.annotate(ctx, newError(ErrTLSHandshake, err), PhaseTLS)
+		}
+	}
+}
+
+// utlsHandshake 使用uTLS按指纹完成握手，指纹中的ALPN替换为cfg.NextProtos，未指定时为http/1.1
+func utlsHandshake(ctx context.Context, conn net.Conn, cfg *tls.Config, fp TLSFingerprint) (*utlsConn, error) {
+	id := fingerprintIDs[fp]
+	ucfg := toUTLSConfig(cfg)
+	alpn := cfg.NextProtos
+	if len(alpn) == 0 {
+		alpn = []string{"http/1.1"}
+	}
+	var uconn *utls.UConn
+	if spec, err := utls.UTLSIdToSpec(id); err == nil {
+		for _, ext := range spec.Extensions {
+			if ext, ok := ext.(*utls.ALPNExtension); ok {
+				ext.AlpnProtocols = alpn
+			}
+		}
+		uconn = utls.UClient(conn, ucfg, utls.HelloCustom)
+		if err := uconn.ApplyPreset(&spec); err != nil {
+			return nil, fmt.Errorf("应用TLS指纹失败: %w", err)
+		}
+	} else {
+		// 随机指纹无法预先生成固定的spec，通过NextProtos限定ALPN
+		ucfg.NextProtos = alpn
+		uconn = utls.UClient(conn, ucfg, id)
+	}
+	if err := uconn.HandshakeContext(ctx); err != nil {
+		if fp == FingerprintRandomized && hasUnsupportedHRRGroup(uconn.HandshakeState.Hello) {
+			err = fmt.Errorf("%w: %w", errUnsupportedHRRGroup, err)
+		}
+		return nil, err
+	}
+	return &utlsConn{UConn: uconn}, nil
+}
+
+// errUnsupportedHRRGroup 随机指纹声明了uTLS无法在HelloRetryRequest后补发密钥的密钥交换组，服务器选中该组时握手失败
+var errUnsupportedHRRGroup = errors.New("随机TLS指纹声明了不支持的密钥交换组")
+
+// hasUnsupportedHRRGroup 判断ClientHello是否声明了没有附带密钥、且uTLS无法在HelloRetryRequest后生成密钥的组，
+// uTLS只能为X25519和P-256/384/521补发密钥，混合后量子组等只能在首次ClientHello中附带
+func hasUnsupportedHRRGroup(hello *utls.PubClientHelloMsg) bool {
+	if hello == nil {
+		return false
+	}
+	for _, group := range hello.SupportedCurves {
+		switch {
+		case group == utls.X25519, group == utls.CurveP256, group == utls.CurveP384, group == utls.CurveP521:
+			continue
+		case group&0x0f0f == 0x0a0a:
+			// GREASE
+			continue
+		}
+		if !slices.ContainsFunc(hello.KeyShares, func(ks utls.KeyShare) bool { return ks.Group == group }) {
+			return true
+		}
+	}
+	return false
+}
+
+// toUTLSConfig 将标准库的TLS配置转换为uTLS配置
+func toUTLSConfig(cfg *tls.Config) *utls.Config {
+	ucfg := &utls.Config{
+		ServerName:                     cfg.ServerName,
+		InsecureSkipVerify:             cfg.InsecureSkipVerify,
+		RootCAs:                        cfg.RootCAs,
+		NextProtos:                     cfg.NextProtos,
+		MinVersion:                     cfg.MinVersion,
+		MaxVersion:                     cfg.MaxVersion,
+		CipherSuites:                   cfg.CipherSuites,
+		KeyLogWriter:                   cfg.KeyLogWriter,
+		VerifyPeerCertificate:          cfg.VerifyPeerCertificate,
+		EncryptedClientHelloConfigList: cfg.EncryptedClientHelloConfigList,
+	}
+	if verify := cfg.VerifyConnection; verify != nil {
+		ucfg.VerifyConnection = func(s utls.ConnectionState) error {
+			return verify(toTLSState(s))
+		}
+	}
+	for _, c := range cfg.Certificates {
+		ucfg.Certificates = append(ucfg.Certificates, utls.Certificate{
+			Certificate: c.Certificate,
+			PrivateKey:  c.PrivateKey,
+			OCSPStaple:  c.OCSPStaple,
+			Leaf:        c.Leaf,
+		})
+	}
+	return ucfg
+}
+
+// utlsConn 包装uTLS连接，提供标准库类型的ConnectionState，使响应的TLS字段可用
+type utlsConn struct {
+	*utls.UConn
+}
+
+// ConnectionState 返回标准库类型的连接状态
+func (c *utlsConn) ConnectionState() tls.ConnectionState {
+	return toTLSState(c.UConn.ConnectionState())
+}
+
+// toTLSState 将uTLS的连接状态转换为标准库类型
+func toTLSState(s utls.ConnectionState) tls.ConnectionState {
+	return tls.ConnectionState{
+		Version:                     s.Version,
+		HandshakeComplete:           s.HandshakeComplete,
+		DidResume:                   s.DidResume,
+		CipherSuite:                 s.CipherSuite,
+		NegotiatedProtocol:          s.NegotiatedProtocol,
+		NegotiatedProtocolIsMutual:  s.NegotiatedProtocolIsMutual,
+		ServerName:                  s.ServerName,
+		PeerCertificates:            s.PeerCertificates,
+		VerifiedChains:              s.VerifiedChains,
+		SignedCertificateTimestamps: s.SignedCertificateTimestamps,
+		OCSPResponse:                s.OCSPResponse,
+	}
+}
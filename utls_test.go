@@ -0,0 +1,71 @@
+package goproxy
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	utls "github.com/refraction-networking/utls"
+)
+
+func TestGoProxy_SetTLSFingerprint(t *testing.T) {
+	hellos := make(chan *tls.ClientHelloInfo, 10)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.TLS = &tls.Config{GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		hellos <- hello
+		return nil, nil
+	}}
+	srv.StartTLS()
+	defer srv.Close()
+
+	c := New()
+	getBody(t, c, srv.URL)
+	goHello := <-hellos
+
+	for _, fp := range []TLSFingerprint{FingerprintChrome, FingerprintFirefox, FingerprintSafari, FingerprintRandomized} {
+		if err := c.SetTLSFingerprint(fp); err != nil {
+			t.Fatal(err)
+		}
+		resp, err := c.GetClient().Get(srv.URL)
+		if err != nil {
+			t.Fatalf("%s: %v", fp, err)
+		}
+		resp.Body.Close()
+		if resp.TLS == nil || !resp.TLS.HandshakeComplete {
+			t.Errorf("%s: 响应缺少TLS连接状态", fp)
+		}
+		hello := <-hellos
+		if len(hello.CipherSuites) == len(goHello.CipherSuites) && fp != FingerprintRandomized {
+			t.Errorf("%s: ClientHello与Go默认值相同", fp)
+		}
+	}
+
+	if err := c.SetTLSFingerprint("netscape"); err == nil {
+		t.Error("未知指纹应返回错误")
+	}
+}
+
+func TestHasUnsupportedHRRGroup(t *testing.T) {
+	cases := []struct {
+		hello *utls.PubClientHelloMsg
+		want  bool
+	}{
+		{nil, false},
+		{&utls.PubClientHelloMsg{SupportedCurves: []utls.CurveID{utls.X25519, utls.CurveP256}}, false},
+		// 附带了密钥的混合组和GREASE不受影响
+		{&utls.PubClientHelloMsg{
+			SupportedCurves: []utls.CurveID{utls.GREASE_PLACEHOLDER, utls.X25519MLKEM768, utls.X25519},
+			KeyShares:       []utls.KeyShare{{Group: utls.X25519MLKEM768}},
+		}, false},
+		{&utls.PubClientHelloMsg{
+			SupportedCurves: []utls.CurveID{utls.X25519MLKEM768, utls.X25519},
+			KeyShares:       []utls.KeyShare{{Group: utls.X25519}},
+		}, true},
+	}
+	for i, tc := range cases {
+		if got := hasUnsupportedHRRGroup(tc.hello); got != tc.want {
+			t.Errorf("#%d: hasUnsupportedHRRGroup() = %v", i, got)
+		}
+	}
+}